@@ -27,6 +27,7 @@ import (
 
 	// Import all the required archivers here
 	_ "github.com/rclone/rclone/backend/archive/squashfs"
+	_ "github.com/rclone/rclone/backend/archive/tar"
 	_ "github.com/rclone/rclone/backend/archive/zip"
 
 	"github.com/rclone/rclone/backend/archive/archiver"
@@ -44,6 +45,7 @@ func init() {
 		Name:        "archive",
 		Description: "Read archives",
 		NewFs:       NewFs,
+		CommandHelp: commandHelp,
 		MetadataInfo: &fs.MetadataInfo{
 			Help: `Any metadata supported by the underlying remote is read and written.`,
 		},
@@ -205,6 +207,12 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (outFs fs
 	if err != fs.ErrorIsFile && err != nil {
 		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", remote, err)
 	}
+	if foundArchive != nil && err != fs.ErrorIsFile {
+		wrappedFs, err = archiveParent(ctx, remotePath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	f := &Fs{
 		name: name,
@@ -234,9 +242,6 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (outFs fs
 
 	if foundArchive != nil {
 		fs.Debugf(f, "Root is an archive")
-		if err != fs.ErrorIsFile {
-			return nil, fmt.Errorf("expecting to find a file at %q", remote)
-		}
 		return foundArchive.init(ctx, f.f)
 	}
 	// Correct root if definitely pointing to a file
@@ -249,6 +254,29 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (outFs fs
 	return f, err
 }
 
+// archiveParent is called when remotePath isn't a file. If the
+// archive doesn't exist it returns the parent of remotePath so the
+// archive can be created there by writing to it.
+func archiveParent(ctx context.Context, remotePath string) (fs.Fs, error) {
+	parent, leaf, err := fspath.Split(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	parentFs, err := cache.Get(ctx, parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", parent, err)
+	}
+	// The archive may have been created since remotePath was cached
+	if _, err = parentFs.NewObject(ctx, leaf); err == nil {
+		return parentFs, nil
+	}
+	entries, err := parentFs.List(ctx, leaf)
+	if err == nil && len(entries) > 0 || err != nil && err != fs.ErrorDirNotFound {
+		return nil, fmt.Errorf("expecting to find a file at %q", remotePath)
+	}
+	return parentFs, nil
+}
+
 // Name of the remote (as passed into NewFs)
 func (f *Fs) Name() string {
 	return f.name
@@ -281,7 +309,11 @@ func (f *Fs) Hashes() hash.Set {
 
 // Mkdir makes the root directory of the Fs object
 func (f *Fs) Mkdir(ctx context.Context, dir string) error {
-	return f.f.Mkdir(ctx, dir)
+	subFs, err := f.findFs(ctx, dir)
+	if err != nil {
+		return err
+	}
+	return subFs.Mkdir(ctx, dir)
 }
 
 // Purge all files in the directory
@@ -394,12 +426,23 @@ func (f *Fs) DirCacheFlush() {
 }
 
 func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (fs.Object, error) {
+	dir := path.Dir(src.Remote())
+	if dir == "/" || dir == "." {
+		dir = ""
+	}
+	subFs, err := f.findFs(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
 	var o fs.Object
-	var err error
 	if stream {
-		o, err = f.f.Features().PutStream(ctx, in, src, options...)
+		do := subFs.Features().PutStream
+		if do == nil {
+			return nil, errors.New("can't PutStream")
+		}
+		o, err = do(ctx, in, src, options...)
 	} else {
-		o, err = f.f.Put(ctx, in, src, options...)
+		o, err = subFs.Put(ctx, in, src, options...)
 	}
 	if err != nil {
 		return nil, err
@@ -534,13 +577,70 @@ func (f *Fs) Precision() time.Duration {
 	return time.Second
 }
 
+// flush finishes writing any archives being written returning the
+// first error
+func (f *Fs) flush(ctx context.Context) (err error) {
+	f.mu.Lock()
+	for _, archive := range f.archives {
+		archive.mu.Lock()
+		if do, ok := archive.f.(fs.Shutdowner); ok {
+			if shutdownErr := do.Shutdown(ctx); err == nil {
+				err = shutdownErr
+			}
+		}
+		archive.mu.Unlock()
+	}
+	f.mu.Unlock()
+	return err
+}
+
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
-func (f *Fs) Shutdown(ctx context.Context) error {
+func (f *Fs) Shutdown(ctx context.Context) (err error) {
+	// Finish writing any archives first
+	err = f.flush(ctx)
 	if do := f.f.Features().Shutdown; do != nil {
-		return do(ctx)
+		if shutdownErr := do(ctx); err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "flush",
+	Short: "Finish writing the zip archives being written.",
+	Long: `Zip archives being written to are normally finished when rclone
+exits, or when the remote is removed from the cache if it is being
+used by the rc. This writes them now and returns an error if any of
+them couldn't be written, so the caller can tell the new entries are
+safely stored.
+
+Further writes will start a new version of the archive.
+
+Usage examples:
+
+` + "```console" + `
+rclone rc backend/command command=flush fs=:archive:s3:bucket/out.zip
+` + "```",
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "flush":
+		return nil, f.flush(ctx)
+	default:
+		return nil, fs.ErrorCommandNotFound
 	}
-	return nil
 }
 
 // PublicLink generates a public link to the remote path (usually readable by anyone)
@@ -667,6 +767,7 @@ var (
 	_ fs.ChangeNotifier  = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
 	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
 	_ fs.PublicLinker    = (*Fs)(nil)
 	_ fs.PutUncheckeder  = (*Fs)(nil)
 	_ fs.MergeDirser     = (*Fs)(nil)
@@ -3,22 +3,32 @@
 package archive
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
 	"github.com/stretchr/testify/assert"
@@ -219,3 +229,204 @@ func TestArchiveSquashfs(t *testing.T) {
 		run(t, "mksquashfs", input, output)
 	})
 }
+
+// Test creating and reading back some tar archives
+//
+// Note that this uses rclone and tar as external binaries.
+func TestArchiveTar(t *testing.T) {
+	fstest.Initialise()
+	skipIfNoExe(t, "tar")
+	skipIfNoExe(t, "rclone")
+	for _, test := range []struct {
+		archiveName string
+		exeName     string
+		flag        string
+	}{
+		{"test.tar", "", ""},
+		{"test.tar.gz", "gzip", "-z"},
+		{"test.tgz", "gzip", "-z"},
+		{"test.tar.zst", "zstd", "--zstd"},
+		{"test.tar.xz", "xz", "-J"},
+	} {
+		t.Run(test.archiveName, func(t *testing.T) {
+			if test.exeName != "" {
+				skipIfNoExe(t, test.exeName)
+			}
+			testArchive(t, test.archiveName, func(t *testing.T, output, input string) {
+				args := []string{"tar", "-c", "-f", output, "-C", input}
+				if test.flag != "" {
+					args = append(args, test.flag)
+				}
+				run(t, append(args, ".")...)
+			})
+		})
+	}
+}
+
+// writeTar writes a tar file containing files with the given names
+// and contents
+func writeTar(t *testing.T, tarFile string, files map[string]string) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(files[name])),
+			ModTime: time.Now(),
+		}))
+		_, err := tw.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, os.WriteFile(tarFile, buf.Bytes(), 0666))
+}
+
+// Test a root within a tar archive doesn't include siblings whose
+// names start with the root
+func TestArchiveTarRoot(t *testing.T) {
+	ctx := context.Background()
+	fstest.Initialise()
+	cache.Clear()
+
+	tarFile := path.Join(t.TempDir(), "test.tar")
+	writeTar(t, tarFile, map[string]string{
+		"dir/one.txt":  "one",
+		"dirx/two.txt": "two",
+		"dir.txt":      "three",
+	})
+	f, err := fs.NewFs(ctx, ":archive:"+tarFile+"/dir")
+	require.NoError(t, err)
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.Equal(t, []string{"one.txt"}, names)
+}
+
+// Test shutting down a compressed tar archive closes the idle
+// streams and it can still be read afterwards
+func TestArchiveTarShutdown(t *testing.T) {
+	ctx := context.Background()
+	fstest.Initialise()
+	cache.Clear()
+
+	dir := t.TempDir()
+	tarFile := path.Join(dir, "test.tar")
+	writeTar(t, tarFile, map[string]string{
+		"one.txt": "one",
+		"two.txt": "two",
+	})
+	data, err := os.ReadFile(tarFile)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(tarFile+".gz", buf.Bytes(), 0666))
+
+	f, err := fs.NewFs(ctx, ":archive:"+tarFile+".gz")
+	require.NoError(t, err)
+	read := func(remote string) string {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		got, err := operations.ReadFile(ctx, o)
+		require.NoError(t, err)
+		return string(got)
+	}
+	assert.Equal(t, "one", read("one.txt"))
+
+	do := f.Features().Shutdown
+	require.NotNil(t, do)
+	require.NoError(t, do(ctx))
+	assert.Equal(t, "two", read("two.txt"))
+	require.NoError(t, do(ctx))
+}
+
+// Test writing to a zip archive and appending to it
+func TestArchiveZipWrite(t *testing.T) {
+	ctx := context.Background()
+	fstest.Initialise()
+
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "one.txt"), []byte("one"), 0666))
+	require.NoError(t, os.Mkdir(filepath.Join(src, "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "two.txt"), []byte("two"), 0666))
+	zipFile := path.Join(t.TempDir(), "test.zip")
+
+	// copy src into the archive then finish writing it
+	copyAndShutdown := func() {
+		cache.Clear()
+		Fsrc, err := cache.Get(ctx, src)
+		require.NoError(t, err)
+		Fdst, err := fs.NewFs(ctx, ":archive:"+zipFile+"/")
+		require.NoError(t, err)
+		require.NoError(t, sync.CopyDir(ctx, Fdst, Fsrc, false))
+		do := Fdst.Features().Shutdown
+		require.NotNil(t, do)
+		require.NoError(t, do(ctx))
+	}
+
+	// Create the archive
+	copyAndShutdown()
+	checkTree(ctx, "Create", t, ":archive:"+zipFile, src, 2)
+
+	// Append to the archive
+	require.NoError(t, os.WriteFile(filepath.Join(src, "three.txt"), []byte("three"), 0666))
+	copyAndShutdown()
+	checkTree(ctx, "Append", t, ":archive:"+zipFile, src, 3)
+
+	// Check no temporary files were left behind
+	fis, err := os.ReadDir(path.Dir(zipFile))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(fis))
+}
+
+// Test a failed write to a zip archive fails only that write and
+// the flush command finishes the archive
+func TestArchiveZipWriteError(t *testing.T) {
+	ctx := context.Background()
+	fstest.Initialise()
+	cache.Clear()
+
+	zipFile := path.Join(t.TempDir(), "test.zip")
+	Fdst, err := fs.NewFs(ctx, ":archive:"+zipFile+"/")
+	require.NoError(t, err)
+	put := func(remote string, in io.Reader, size int64) error {
+		src := object.NewStaticObjectInfo(remote, time.Now(), size, true, nil, nil)
+		_, err := Fdst.Put(ctx, in, src)
+		return err
+	}
+
+	require.NoError(t, put("one.txt", strings.NewReader("one"), -1))
+	errRead := errors.New("read failed")
+	err = put("two.txt", io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errRead)), -1)
+	assert.ErrorIs(t, err, errRead)
+	err = put("short.txt", strings.NewReader("short"), 100)
+	assert.ErrorContains(t, err, "expected 100 bytes")
+
+	// Writes after the failures work and can be retried
+	require.NoError(t, put("three.txt", strings.NewReader("three"), 5))
+	require.NoError(t, put("two.txt", strings.NewReader("two"), 3))
+	require.NoError(t, Fdst.Mkdir(ctx, "dir"))
+
+	// Finish writing the archive
+	do := Fdst.Features().Command
+	require.NotNil(t, do)
+	_, err = do(ctx, "flush", nil, nil)
+	require.NoError(t, err)
+	_, err = os.Stat(zipFile)
+	require.NoError(t, err)
+
+	var names []string
+	entries, err := Fdst.List(ctx, "")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.Equal(t, []string{"dir", "one.txt", "three.txt", "two.txt"}, names)
+	require.NoError(t, Fdst.Features().Shutdown(ctx))
+}
@@ -0,0 +1,57 @@
+package tar
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mikelolasagasti/xz"
+)
+
+// compression describes how the tar stream is compressed
+type compression struct {
+	name       string
+	extensions []string
+	decompress func(in io.Reader) (io.ReadCloser, error)
+}
+
+// compressions is the list of supported stream compressions
+var compressions = []compression{{
+	name:       "none",
+	extensions: []string{".tar"},
+	decompress: func(in io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(in), nil
+	},
+}, {
+	name:       "gzip",
+	extensions: []string{".tar.gz", ".tgz"},
+	decompress: func(in io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(in)
+	},
+}, {
+	name:       "zstd",
+	extensions: []string{".tar.zst", ".tzst"},
+	decompress: func(in io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	},
+}, {
+	name:       "xz",
+	extensions: []string{".tar.xz", ".txz"},
+	decompress: func(in io.Reader) (io.ReadCloser, error) {
+		xr, err := xz.NewReader(in, 0)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	},
+}}
+
+// seekable returns true if the data in the tar stream can be read
+// directly at its offset without decompressing everything before it
+func (c *compression) seekable() bool {
+	return c.name == "none"
+}
@@ -0,0 +1,184 @@
+package tar
+
+// The tar format has no central directory so the only way of finding
+// out what is in a tar file is to read it from start to finish. To
+// avoid doing that every time the archive is opened, the result of
+// the scan is stored in a sidecar index in the kv database, keyed on
+// the archive path and fingerprinted by its size and modification
+// time.
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// kvFacility is the name of the kv database the indexes are kept in
+const kvFacility = "archive-tar"
+
+// indexEntry describes a single item in the tar file
+type indexEntry struct {
+	Name    string    `json:"name"`          // name as stored in the archive
+	Dir     bool      `json:"dir,omitempty"` // set if this is a directory
+	Size    int64     `json:"size"`          // size of the data
+	ModTime time.Time `json:"mtime"`         // modification time
+	Offset  int64     `json:"offset"`        // offset of the data in the uncompressed stream
+}
+
+// indexRecord is what is stored in the kv database
+type indexRecord struct {
+	Fp      string       `json:"fp"`
+	Entries []indexEntry `json:"entries"`
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	in io.Reader
+	n  int64
+}
+
+// Read bytes counting them as they go through
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.in.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// fingerprint returns a string which changes if the archive changes
+func (f *Fs) fingerprint() string {
+	return fmt.Sprintf("%d,%d", f.node.Size(), f.node.ModTime().UnixNano())
+}
+
+// indexKey returns the key the index for this archive is stored under
+func (f *Fs) indexKey() string {
+	return f.name
+}
+
+// readIndex reads the index from the kv database if possible,
+// otherwise it scans the archive and stores the result
+func (f *Fs) readIndex(ctx context.Context) (entries []indexEntry, err error) {
+	db, err := kv.Start(ctx, kvFacility, nil)
+	if err != nil {
+		fs.Debugf(f, "Index cache unavailable: %v", err)
+		return f.scan()
+	}
+	defer func() {
+		_ = db.Stop(false)
+	}()
+
+	get := &kvGet{key: f.indexKey(), fp: f.fingerprint()}
+	err = db.Do(false, get)
+	if err == nil {
+		fs.Debugf(f, "Read %d entries from index cache", len(get.entries))
+		return get.entries, nil
+	}
+	if !errors.Is(err, kv.ErrEmpty) {
+		fs.Debugf(f, "Index cache miss: %v", err)
+	}
+
+	entries, err = f.scan()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Do(true, &kvPut{key: f.indexKey(), fp: f.fingerprint(), entries: entries})
+	if err != nil {
+		fs.Debugf(f, "Failed to write index cache: %v", err)
+	}
+	return entries, nil
+}
+
+// scan reads the whole archive to make the index
+func (f *Fs) scan() (entries []indexEntry, err error) {
+	fh, err := f.node.Open(os.O_RDONLY)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tar file: %w", err)
+	}
+	defer fs.CheckClose(fh, &err)
+	in, err := f.compression.decompress(fh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress tar file: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+
+	// The tar reader doesn't read ahead, so after Next returns
+	// the underlying stream is positioned at the start of the data.
+	cr := &countingReader{in: in}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar file: %w", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entries = append(entries, indexEntry{
+				Name:    hdr.Name,
+				Dir:     true,
+				ModTime: hdr.ModTime,
+			})
+		case tar.TypeReg:
+			entries = append(entries, indexEntry{
+				Name:    hdr.Name,
+				Size:    hdr.Size,
+				ModTime: hdr.ModTime,
+				Offset:  cr.n,
+			})
+		default:
+			fs.Debugf(f, "Skipping %q: unsupported tar entry type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+	fs.Debugf(f, "Scanned %d entries from archive", len(entries))
+	return entries, nil
+}
+
+// kvGet: read the index for an archive
+type kvGet struct {
+	key     string
+	fp      string
+	entries []indexEntry
+}
+
+func (op *kvGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if len(data) == 0 {
+		return kv.ErrEmpty
+	}
+	var r indexRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return errors.New("invalid record")
+	}
+	if r.Fp != op.fp {
+		return errors.New("fingerprint changed")
+	}
+	op.entries = r.Entries
+	return nil
+}
+
+// kvPut: write the index for an archive
+type kvPut struct {
+	key     string
+	fp      string
+	entries []indexEntry
+}
+
+func (op *kvPut) Do(ctx context.Context, b kv.Bucket) error {
+	data, err := json.Marshal(indexRecord{Fp: op.fp, Entries: op.entries})
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	if err = b.Put([]byte(op.key), data); err != nil {
+		return fmt.Errorf("put failed: %w", err)
+	}
+	return nil
+}
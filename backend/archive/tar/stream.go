@@ -0,0 +1,167 @@
+package tar
+
+// Compressed tar streams can't be seeked, so reading a file from the
+// middle of the archive means decompressing everything before it.
+//
+// To avoid doing that for every file when the archive is read in
+// order (eg when copying the whole thing) keep a small pool of
+// decompressed streams which can carry on from where they left off.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// maxIdleStreams is the maximum number of idle streams kept in the pool
+const maxIdleStreams = 4
+
+// stream is a decompressed view of the tar file
+type stream struct {
+	fh  io.Closer     // underlying file handle
+	in  io.ReadCloser // decompressor
+	pos int64         // position in the decompressed stream
+}
+
+// Read bytes from the stream keeping track of the position
+func (s *stream) Read(p []byte) (n int, err error) {
+	n, err = s.in.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+// close the decompressor and the file handle
+func (s *stream) close() error {
+	err := s.in.Close()
+	if closeErr := s.fh.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// streamPool is a pool of idle streams
+type streamPool struct {
+	f       *Fs
+	mu      sync.Mutex
+	streams []*stream
+}
+
+// newStreamPool makes a new pool of streams reading from f
+func newStreamPool(f *Fs) *streamPool {
+	return &streamPool{
+		f: f,
+	}
+}
+
+// get returns a stream positioned at off
+//
+// It reuses the idle stream which is closest to off without being
+// past it, or opens a new one if there isn't one.
+func (p *streamPool) get(off int64) (s *stream, err error) {
+	p.mu.Lock()
+	best := -1
+	for i, idle := range p.streams {
+		if idle.pos <= off && (best < 0 || idle.pos > p.streams[best].pos) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		s = p.streams[best]
+		p.streams = append(p.streams[:best], p.streams[best+1:]...)
+	}
+	p.mu.Unlock()
+
+	if s == nil {
+		fh, err := p.f.node.Open(os.O_RDONLY)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tar file: %w", err)
+		}
+		in, err := p.f.compression.decompress(fh)
+		if err != nil {
+			_ = fh.Close()
+			return nil, fmt.Errorf("failed to decompress tar file: %w", err)
+		}
+		s = &stream{fh: fh, in: in}
+	}
+
+	_, err = io.CopyN(io.Discard, s, off-s.pos)
+	if err != nil {
+		_ = s.close()
+		return nil, fmt.Errorf("failed to seek in tar file: %w", err)
+	}
+	return s, nil
+}
+
+// put returns a stream to the pool, closing the oldest stream if
+// there are too many
+func (p *streamPool) put(s *stream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.streams = append(p.streams, s)
+	if len(p.streams) > maxIdleStreams {
+		old := p.streams[0]
+		p.streams = p.streams[1:]
+		if err := old.close(); err != nil {
+			fs.Debugf(p.f, "Failed to close idle stream: %v", err)
+		}
+	}
+}
+
+// shutdown closes the idle streams returning the first error
+//
+// Streams which are in use are returned to the pool as normal when
+// they are closed.
+func (p *streamPool) shutdown() (err error) {
+	p.mu.Lock()
+	streams := p.streams
+	p.streams = nil
+	p.mu.Unlock()
+	for _, s := range streams {
+		if closeErr := s.close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// streamReader reads a limited amount of data from a stream
+// returning it to the pool when closed
+type streamReader struct {
+	pool   *streamPool
+	s      *stream
+	n      int64 // bytes remaining
+	failed bool  // set if the stream had an error
+}
+
+// Read up to n bytes from the stream
+func (r *streamReader) Read(p []byte) (n int, err error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err = r.s.Read(p)
+	r.n -= int64(n)
+	if err != nil && err != io.EOF {
+		r.failed = true
+	}
+	return n, err
+}
+
+// Close the reader returning the stream to the pool if it is still good
+func (r *streamReader) Close() error {
+	if r.s == nil {
+		return nil
+	}
+	s := r.s
+	r.s = nil
+	if r.failed {
+		return s.close()
+	}
+	r.pool.put(s)
+	return nil
+}
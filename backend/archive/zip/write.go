@@ -0,0 +1,316 @@
+package zip
+
+// Writing to zip files
+//
+// Remotes can't append to files, so adding entries to a zip file
+// means writing a new zip file. This is done by streaming it to the
+// wrapped remote. The existing entries are copied into the new zip
+// file without recompressing them when the first entry is added, new
+// entries are appended as they are Put and the central directory is
+// written when the Fs is shut down.
+//
+// If the zip file already exists the new zip file is uploaded to a
+// temporary name and moved into place when complete so the existing
+// entries can be read while it is being written.
+//
+// Each entry is spooled to a local temporary file before it is added
+// so an entry which fails to read, or which isn't the size its source
+// said it would be, fails only its own Put and can be retried.
+//
+// If adding a spooled entry to the zip stream fails then the upload
+// itself has failed, so it is abandoned and the existing archive is
+// left as it was. This failure is sticky - all the following writes
+// and the flush return the error so the lost entries are noticed.
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// errors returned when writing
+var (
+	errCantOverwrite = errors.New("zip: can't overwrite or remove existing entries in the archive")
+	errNotWritten    = errors.New("zip: entry can't be read until the archive has been written")
+)
+
+// writer holds the state for an archive being written
+type writer struct {
+	pw       *io.PipeWriter // write end of the pipe to the upload
+	zw       *zip.Writer    // zip writer writing to pw
+	remote   string         // name the archive is being uploaded to
+	errChan  chan error     // result of the upload
+	uploaded fs.Object      // the uploaded archive - valid after errChan
+}
+
+// toNative converts a remote into a name in the archive
+func (f *Fs) toNative(remote string) string {
+	if f.prefix != "" {
+		remote = strings.TrimPrefix(remote, f.prefixSlash)
+	}
+	return path.Join(f.root, remote)
+}
+
+// getWriter returns the current writer starting one if necessary
+//
+// Call with f.mu held
+func (f *Fs) getWriter(ctx context.Context) (w *writer, err error) {
+	if f.werr != nil {
+		return nil, f.werr
+	}
+	if f.w != nil {
+		return f.w, nil
+	}
+	remote := f.remote
+	if f.node != nil {
+		remote = fmt.Sprintf("%s.%s.partial", f.remote, random.String(8))
+	}
+	pr, pw := io.Pipe()
+	w = &writer{
+		pw:      pw,
+		zw:      zip.NewWriter(pw),
+		remote:  remote,
+		errChan: make(chan error, 1),
+	}
+	// The upload lives longer than the call which started it
+	uploadCtx := context.WithoutCancel(ctx)
+	go func() {
+		var err error
+		w.uploaded, err = operations.Rcat(uploadCtx, f.f, remote, pr, time.Now(), nil)
+		_ = pr.CloseWithError(err)
+		w.errChan <- err
+	}()
+	fs.Debugf(f, "Started writing archive to %q", remote)
+
+	// Copy the existing entries without recompressing them
+	if f.zr != nil {
+		for _, file := range f.zr.File {
+			if err = w.zw.Copy(file); err != nil {
+				f.abort(w, err)
+				return nil, fmt.Errorf("zip: failed to copy existing entry %q: %w", file.Name, err)
+			}
+		}
+	}
+	f.w = w
+	return w, nil
+}
+
+// abort the upload in progress removing any pending entries
+//
+// All further writes will fail with err.
+//
+// Call with f.mu held
+func (f *Fs) abort(w *writer, err error) {
+	f.werr = fmt.Errorf("zip: archive abandoned after failed write: %w", err)
+	_ = w.pw.CloseWithError(err)
+	<-w.errChan
+	for _, o := range f.pending {
+		dir := path.Dir(o.remote)
+		if dir == "." {
+			dir = ""
+		}
+		dirEntries := f.dt[dir]
+		for i := range dirEntries {
+			if dirEntries[i] == o {
+				f.dt[dir] = append(dirEntries[:i], dirEntries[i+1:]...)
+				break
+			}
+		}
+	}
+	f.pending = nil
+	f.w = nil
+}
+
+// spool reads in into a temporary file checking it is size bytes
+// long if size is known. It returns the open file positioned at the
+// start, its length and its CRC32.
+//
+// The caller should call closeSpool on the file when done.
+func spool(in io.Reader, size int64) (spoolFile *os.File, n int64, crc uint32, err error) {
+	out, err := os.CreateTemp("", "rclone-zip-entry-")
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("zip: failed to make spool file: %w", err)
+	}
+	hasher := crc32.NewIEEE()
+	n, err = io.Copy(io.MultiWriter(out, hasher), in)
+	if err != nil {
+		err = fmt.Errorf("zip: failed to read entry: %w", err)
+	} else if size >= 0 && n != size {
+		err = fmt.Errorf("zip: entry was %d bytes but expected %d bytes", n, size)
+	} else if _, err = out.Seek(0, io.SeekStart); err != nil {
+		err = fmt.Errorf("zip: failed to rewind spool file: %w", err)
+	}
+	if err != nil {
+		closeSpool(out)
+		return nil, 0, 0, err
+	}
+	return out, n, hasher.Sum32(), nil
+}
+
+// closeSpool closes and removes a spool file made by spool
+func closeSpool(spoolFile *os.File) {
+	_ = spoolFile.Close()
+	_ = os.Remove(spoolFile.Name())
+}
+
+// putEntry writes in to the archive as remote
+func (f *Fs) putEntry(ctx context.Context, in io.Reader, src fs.ObjectInfo) (o *Object, err error) {
+	remote := src.Remote()
+	f.mu.Lock()
+	_, entry := f.dt.Find(remote)
+	f.mu.Unlock()
+	if entry != nil {
+		return nil, errCantOverwrite
+	}
+
+	// Spool the entry without the lock so a failed read only
+	// fails this entry and slow sources don't hold up the others
+	spoolFile, n, crc, err := spool(in, src.Size())
+	if err != nil {
+		return nil, err
+	}
+	defer closeSpool(spoolFile)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, entry := f.dt.Find(remote); entry != nil {
+		return nil, errCantOverwrite
+	}
+	w, err := f.getWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fh := &zip.FileHeader{
+		Name:     f.toNative(remote),
+		Method:   zip.Deflate,
+		Modified: src.ModTime(ctx),
+	}
+	out, err := w.zw.CreateHeader(fh)
+	if err != nil {
+		f.abort(w, err)
+		return nil, fmt.Errorf("zip: failed to create entry: %w", err)
+	}
+	_, err = io.Copy(out, spoolFile)
+	if err != nil {
+		// The zip stream is now corrupt so we have to start again
+		f.abort(w, err)
+		return nil, fmt.Errorf("zip: failed to write entry: %w", err)
+	}
+	// The zip writer updates fh when the entry is closed so keep a copy
+	ofh := *fh
+	ofh.UncompressedSize64 = uint64(n)
+	ofh.CRC32 = crc
+	o = &Object{
+		f:      f,
+		remote: remote,
+		fh:     &ofh,
+	}
+	f.dt.AddEntry(o)
+	f.pending = append(f.pending, o)
+	return o, nil
+}
+
+// mkdirEntry adds a directory entry to the archive
+func (f *Fs) mkdirEntry(ctx context.Context, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.dt[dir]; ok {
+		return nil
+	}
+	w, err := f.getWriter(ctx)
+	if err != nil {
+		return err
+	}
+	modTime := time.Now()
+	_, err = w.zw.CreateHeader(&zip.FileHeader{
+		Name:     f.toNative(dir) + "/",
+		Modified: modTime,
+	})
+	if err != nil {
+		f.abort(w, err)
+		return fmt.Errorf("zip: failed to create directory: %w", err)
+	}
+	f.dt.AddEntry(fs.NewDir(dir, modTime))
+	return nil
+}
+
+// flush finishes writing the archive if there is one in progress
+// and reads it back in so the new entries can be read
+func (f *Fs) flush(ctx context.Context) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.werr != nil {
+		return f.werr
+	}
+	w := f.w
+	if w == nil {
+		return nil
+	}
+	f.w = nil
+	f.pending = nil
+	err = w.zw.Close()
+	if err != nil {
+		_ = w.pw.CloseWithError(err)
+		<-w.errChan
+		return fmt.Errorf("zip: failed to write central directory: %w", err)
+	}
+	_ = w.pw.Close()
+	err = <-w.errChan
+	if err != nil {
+		return fmt.Errorf("zip: failed to upload archive: %w", err)
+	}
+
+	// Replace the old archive with the new one if necessary
+	if w.remote != f.remote {
+		dst, err := f.f.NewObject(ctx, f.remote)
+		if err != nil && err != fs.ErrorObjectNotFound {
+			return fmt.Errorf("zip: failed to find archive to replace: %w", err)
+		}
+		_, err = operations.Move(ctx, f.f, dst, f.remote, w.uploaded)
+		if err != nil {
+			return fmt.Errorf("zip: failed to move archive into place: %w", err)
+		}
+	}
+	fs.Debugf(f, "Finished writing archive")
+
+	// Read the new archive back in
+	f.vfs.FlushDirCache()
+	f.node, err = f.vfs.Stat(f.remote)
+	if err != nil {
+		return fmt.Errorf("zip: failed to find written archive: %w", err)
+	}
+	_, err = f.readZip()
+	return err
+}
+
+// Shutdown the backend, finishing writing the archive if necessary
+func (f *Fs) Shutdown(ctx context.Context) error {
+	return f.flush(ctx)
+}
+
+// Command the backend to run a named command
+//
+// The flush command finishes writing the archive - see the archive
+// backend for the help.
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "flush":
+		return nil, f.flush(ctx)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/backend/archive/archiver"
@@ -36,12 +37,18 @@ type Fs struct {
 	name        string
 	features    *fs.Features // optional features
 	vfs         *vfs.VFS
-	node        vfs.Node        // zip file object - set if reading
-	remote      string          // remote of the zip file object
-	prefix      string          // position for objects
-	prefixSlash string          // position for objects with a slash on
-	root        string          // position to read from within the archive
-	dt          dirtree.DirTree // read from zipfile
+	node        vfs.Node // zip file object - nil if it doesn't exist yet
+	remote      string   // remote of the zip file object
+	prefix      string   // position for objects
+	prefixSlash string   // position for objects with a slash on
+	root        string   // position to read from within the archive
+
+	mu      sync.Mutex      // protects the below
+	dt      dirtree.DirTree // read from zipfile
+	zr      *zip.Reader     // reader for the zipfile if it exists
+	w       *writer         // set if writing the zipfile
+	pending []*Object       // objects written but not yet uploaded
+	werr    error           // set if writing the zipfile failed
 }
 
 // New constructs an Fs from the (wrappedFs, remote) with the objects
@@ -54,7 +61,10 @@ func New(ctx context.Context, wrappedFs fs.Fs, remote, prefix, root string) (fs.
 	vfsOpt.ReadWait = 0
 	VFS := vfs.New(wrappedFs, &vfsOpt)
 	node, err := VFS.Stat(remote)
-	if err != nil {
+	if errors.Is(err, vfs.ENOENT) {
+		// The archive will be created when written to
+		node = nil
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to find %q archive: %w", remote, err)
 	}
 
@@ -88,6 +98,9 @@ func New(ctx context.Context, wrappedFs fs.Fs, remote, prefix, root string) (fs.
 		BucketBased:             false,
 		CanHaveEmptyDirectories: true,
 	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
+	// Shutdown is needed to finish writing the archive regardless
+	// of whether wrappedFs has it
+	f.features.Shutdown = f.Shutdown
 
 	if singleObject {
 		return f, fs.ErrorIsFile
@@ -117,10 +130,15 @@ func (f *Fs) String() string {
 
 // readZip the zip file into f
 //
+// If the zip file doesn't exist yet then f is set up empty.
+//
 // Returns singleObject=true if f.root points to a file
 func (f *Fs) readZip() (singleObject bool, err error) {
 	if f.node == nil {
-		return singleObject, fs.ErrorDirNotFound
+		f.dt = dirtree.New()
+		f.dt[""] = nil
+		f.zr = nil
+		return singleObject, nil
 	}
 	size := f.node.Size()
 	if size < 0 {
@@ -175,7 +193,11 @@ func (f *Fs) readZip() (singleObject bool, err error) {
 	}
 	dt.CheckParents("")
 	dt.Sort()
+	if _, ok := dt[""]; !ok && !singleObject {
+		dt[""] = nil
+	}
 	f.dt = dt
+	f.zr = zr
 	//fs.Debugf(nil, "dt = %v", dt)
 	return singleObject, nil
 }
@@ -191,14 +213,14 @@ func (f *Fs) readZip() (singleObject bool, err error) {
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
 	defer log.Trace(f, "dir=%q", dir)("entries=%v, err=%v", &entries, &err)
-	// _, err = f.strip(dir)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	entries, ok := f.dt[dir]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dirEntries, ok := f.dt[dir]
 	if !ok {
 		return nil, fs.ErrorDirNotFound
 	}
+	// Copy the entries as they may be added to by Put
+	entries = append(fs.DirEntries(nil), dirEntries...)
 	fs.Debugf(f, "dir=%q, entries=%v", dir, entries)
 	return entries, nil
 }
@@ -206,6 +228,8 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 // NewObject finds the Object at remote.
 func (f *Fs) NewObject(ctx context.Context, remote string) (o fs.Object, err error) {
 	defer log.Trace(f, "remote=%q", remote)("obj=%v, err=%v", &o, &err)
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.dt == nil {
 		return nil, fs.ErrorObjectNotFound
 	}
@@ -229,7 +253,7 @@ func (f *Fs) Precision() time.Duration {
 //
 // Shouldn't return an error if it already exists
 func (f *Fs) Mkdir(ctx context.Context, dir string) error {
-	return vfs.EROFS
+	return f.mkdirEntry(ctx, dir)
 }
 
 // Rmdir removes the directory (container, bucket) if empty
@@ -245,7 +269,16 @@ func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 // will return the object and the error, otherwise will return
 // nil and the error
 func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (o fs.Object, err error) {
-	return nil, vfs.EROFS
+	return f.putEntry(ctx, in, src)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.putEntry(ctx, in, src)
 }
 
 // Hashes returns the supported hash sets.
@@ -273,7 +306,7 @@ type Object struct {
 	f      *Fs
 	remote string
 	fh     *zip.FileHeader
-	file   *zip.File
+	file   *zip.File // nil if the object hasn't been uploaded yet
 }
 
 // Fs returns read only access to the Fs that this object is part of
@@ -321,10 +354,6 @@ func (o *Object) Storable() bool {
 // If no checksum is available it returns ""
 func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
 	if ht == hash.CRC32 {
-		// FIXME return empty CRC if writing
-		if o.f.dt == nil {
-			return "", nil
-		}
 		return fmt.Sprintf("%08x", o.fh.CRC32), nil
 	}
 	return "", hash.ErrUnsupported
@@ -346,6 +375,9 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		}
 	}
 
+	if o.file == nil {
+		return nil, errNotWritten
+	}
 	rc, err = o.file.Open()
 	if err != nil {
 		return nil, err
@@ -368,18 +400,21 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 
 // Update in to the object with the modTime given of the given size
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
-	return vfs.EROFS
+	return errCantOverwrite
 }
 
 // Remove an object
 func (o *Object) Remove(ctx context.Context) error {
-	return vfs.EROFS
+	return errCantOverwrite
 }
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs        = (*Fs)(nil)
-	_ fs.UnWrapper = (*Fs)(nil)
-	_ fs.Wrapper   = (*Fs)(nil)
-	_ fs.Object    = (*Object)(nil)
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Shutdowner  = (*Fs)(nil)
+	_ fs.Commander   = (*Fs)(nil)
+	_ fs.UnWrapper   = (*Fs)(nil)
+	_ fs.Wrapper     = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
 )
@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -57,6 +58,7 @@ const (
 	decayConstant         = 1    // bigger for slower decay, exponential
 	maxListChunkSize      = 5000 // number of items to read at once
 	modTimeKey            = "mtime"
+	crc64Key              = "crc64"
 	dirMetaKey            = "hdi_isfolder"
 	dirMetaValue          = "true"
 	timeFormatIn          = time.RFC3339
@@ -264,7 +266,10 @@ archive tier blobs early may be chargable.
 Normally rclone will calculate the MD5 checksum of the input before
 uploading it so it can add it to metadata on the object. This is great
 for data integrity checking but can cause long delays for large files
-to start uploading.`,
+to start uploading.
+
+This also stops rclone storing the CRC-64/NVME checksum in the blob
+metadata.`,
 			Default:  false,
 			Advanced: true,
 		}, {
@@ -736,6 +741,55 @@ func (o *Object) updateMetadataWithModTime(modTime time.Time) {
 	o.meta[modTimeKey] = modTime.Format(timeFormatOut)
 }
 
+// sourceHashes returns the MD5 and CRC64NVME of src if known.
+//
+// If the source has to read the data to find its hashes (eg a local
+// file) then both are computed in a single pass rather than reading
+// it once for each. If that isn't possible then only the MD5 is
+// returned so the data isn't read an extra time for the CRC64NVME.
+func sourceHashes(ctx context.Context, src fs.ObjectInfo) (md5, crc64 string) {
+	srcFs := src.Fs()
+	if srcFs == nil || !srcFs.Features().SlowHash {
+		md5, _ = src.Hash(ctx, hash.MD5)
+		crc64, _ = src.Hash(ctx, hash.CRC64NVME)
+		return md5, crc64
+	}
+	types := srcFs.Hashes().Overlap(hash.NewHashSet(hash.MD5, hash.CRC64NVME))
+	srcObj := fs.UnWrapObjectInfo(src)
+	if types.Count() != 2 || srcObj == nil {
+		md5, _ = src.Hash(ctx, hash.MD5)
+		return md5, ""
+	}
+	in, err := srcObj.Open(ctx)
+	if err != nil {
+		fs.Debugf(src, "Failed to open to read hashes: %v", err)
+		return "", ""
+	}
+	sums, err := hash.StreamTypes(in, types)
+	closeErr := in.Close()
+	if err != nil || closeErr != nil {
+		fs.Debugf(src, "Failed to read hashes: %v", errors.Join(err, closeErr))
+		return "", ""
+	}
+	return sums[hash.MD5], sums[hash.CRC64NVME]
+}
+
+// updateMetadataWithCRC64 sets the CRC64NVME passed in in o.meta
+// or removes it if it is empty.
+func (o *Object) updateMetadataWithCRC64(crc64 string) {
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+
+	if crc64 == "" {
+		delete(o.meta, crc64Key)
+		return
+	}
+	if o.meta == nil {
+		o.meta = make(map[string]string, 1)
+	}
+	o.meta[crc64Key] = crc64
+}
+
 // parseXMsTags parses the value of the x-ms-tags header into a map.
 // It expects comma-separated key=value pairs. Whitespace around keys and
 // values is trimmed. Empty pairs and empty keys are rejected.
@@ -1602,7 +1656,7 @@ func (f *Fs) Precision() time.Duration {
 
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
-	return hash.Set(hash.MD5)
+	return hash.NewHashSet(hash.MD5, hash.CRC64NVME)
 }
 
 // Purge deletes all the files and directories including the old versions.
@@ -1996,8 +2050,14 @@ func (o *Object) Remote() string {
 	return o.remote
 }
 
-// Hash returns the MD5 of an object returning a lowercase hex string
+// Hash returns the MD5 or CRC64NVME of an object returning a lowercase hex string
 func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
+	if t == hash.CRC64NVME {
+		// This is stored in the metadata if it was known on upload
+		metadataMu.Lock()
+		defer metadataMu.Unlock()
+		return o.meta[crc64Key], nil
+	}
 	if t != hash.MD5 {
 		return "", hash.ErrUnsupported
 	}
@@ -2479,6 +2539,105 @@ type azChunkWriter struct {
 	o         *Object
 	bic       *blockIDCreator
 	checker   *checkForInvalidBlockOrBlob
+	resumed   bool // set if carrying on with a saved upload
+}
+
+// azResumeState is the state of an azChunkWriter saved so the upload
+// can be resumed
+type azResumeState struct {
+	Remote    string          `json:"name"`   // remote being uploaded
+	ChunkSize int64           `json:"cs"`     // chunk size in use
+	Random    []byte          `json:"random"` // random part of the block IDs
+	Blocks    []azResumeBlock `json:"blocks"` // blocks staged so far
+}
+
+// azResumeBlock is a staged block in azResumeState
+type azResumeBlock struct {
+	ChunkNumber uint64 `json:"n"`
+	ID          string `json:"id"`
+}
+
+// resume the upload saved in state, checking the blocks are still
+// staged
+func (w *azChunkWriter) resume(ctx context.Context, state []byte) error {
+	var rs azResumeState
+	err := json.Unmarshal(state, &rs)
+	if err != nil {
+		return fmt.Errorf("failed to decode state: %w", err)
+	}
+	if rs.Remote != w.o.remote {
+		return fmt.Errorf("saved upload is for %q not %q", rs.Remote, w.o.remote)
+	}
+	if len(rs.Random) != len(w.bic.random) || rs.ChunkSize <= 0 {
+		return errors.New("bad saved upload")
+	}
+	var blockList blockblob.GetBlockListResponse
+	err = w.f.pacer.Call(func() (bool, error) {
+		blockList, err = w.ui.blb.GetBlockList(ctx, blockblob.BlockListTypeUncommitted, nil)
+		return w.f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read uncommitted blocks: %w", err)
+	}
+	staged := make(map[string]struct{}, len(blockList.UncommittedBlocks))
+	for _, block := range blockList.UncommittedBlocks {
+		staged[*block.Name] = struct{}{}
+	}
+	for _, block := range rs.Blocks {
+		if _, found := staged[block.ID]; !found {
+			return fmt.Errorf("block %d is no longer staged", block.ChunkNumber)
+		}
+	}
+	copy(w.bic.random[:], rs.Random)
+	w.chunkSize = rs.ChunkSize
+	for _, block := range rs.Blocks {
+		w.addBlock(block.ChunkNumber, block.ID)
+	}
+	w.resumed = true
+	return nil
+}
+
+// ResumeState returns the state of the upload so it can be resumed
+func (w *azChunkWriter) ResumeState() ([]byte, error) {
+	rs := azResumeState{
+		Remote:    w.o.remote,
+		ChunkSize: w.chunkSize,
+		Random:    w.bic.random[:],
+	}
+	w.blocksMu.Lock()
+	for _, block := range w.blocks {
+		rs.Blocks = append(rs.Blocks, azResumeBlock{
+			ChunkNumber: block.chunkNumber,
+			ID:          block.id,
+		})
+	}
+	w.blocksMu.Unlock()
+	return json.Marshal(&rs)
+}
+
+// Resumed returns true if the upload was resumed
+func (w *azChunkWriter) Resumed() bool {
+	return w.resumed
+}
+
+// addBlock records a staged block for Close
+//
+// This replaces the block if it is already there, which happens if a
+// chunk is uploaded again after resuming.
+func (w *azChunkWriter) addBlock(chunkNumber uint64, id string) {
+	w.blocksMu.Lock()
+	defer w.blocksMu.Unlock()
+	block := azBlock{
+		chunkNumber: chunkNumber,
+		id:          id,
+	}
+	for i := range w.blocks {
+		if w.blocks[i].chunkNumber == chunkNumber {
+			w.blocks[i] = block
+			return
+		}
+	}
+	w.blocks = append(w.blocks, block)
 }
 
 // OpenChunkWriter returns the chunk size and a ChunkWriter
@@ -2546,6 +2705,15 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 	if err != nil {
 		return info, nil, err
 	}
+	if state := fs.ChunkWriterResumeState(options); state != nil {
+		err = chunkWriter.resume(ctx, state)
+		if err == nil {
+			info.ChunkSize = chunkWriter.chunkSize
+			fs.Debugf(o, "open chunk writer: resumed multipart upload")
+			return info, chunkWriter, nil
+		}
+		fs.Debugf(o, "open chunk writer: can't resume multipart upload: %v", err)
+	}
 	fs.Debugf(o, "open chunk writer: started multipart upload")
 	return info, chunkWriter, nil
 }
@@ -2654,14 +2822,6 @@ func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader
 	// Create a new blockID
 	blockID := w.bic.newBlockID(uint64(chunkNumber))
 
-	// Save the blockID for the commit
-	w.blocksMu.Lock()
-	w.blocks = append(w.blocks, azBlock{
-		chunkNumber: uint64(chunkNumber),
-		id:          blockID,
-	})
-	w.blocksMu.Unlock()
-
 	err = w.f.pacer.Call(func() (bool, error) {
 		// rewind the reader on retry and after reading md5
 		_, err = reader.Seek(0, io.SeekStart)
@@ -2694,6 +2854,9 @@ func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader
 		return -1, fmt.Errorf("failed to upload chunk %d with %v bytes: %w", chunkNumber+1, currentChunkSize, err)
 	}
 
+	// Save the blockID for the commit
+	w.addBlock(uint64(chunkNumber), blockID)
+
 	fs.Debugf(w.o, "multipart upload wrote chunk %d with %v bytes", chunkNumber+1, currentChunkSize)
 	return currentChunkSize, err
 }
@@ -2939,8 +3102,10 @@ func (o *Object) prepareUpload(ctx context.Context, src fs.ObjectInfo, options [
 
 	// Compute the Content-MD5 of the file. As we stream all uploads it
 	// will be set in PutBlockList API call using the 'x-ms-blob-content-md5' header
+	var sourceMD5, sourceCRC64 string
 	if !o.fs.opt.DisableCheckSum {
-		if sourceMD5, _ := src.Hash(ctx, hash.MD5); sourceMD5 != "" {
+		sourceMD5, sourceCRC64 = sourceHashes(ctx, src)
+		if sourceMD5 != "" {
 			sourceMD5bytes, err := hex.DecodeString(sourceMD5)
 			if err == nil {
 				ui.httpHeaders.BlobContentMD5 = sourceMD5bytes
@@ -2950,6 +3115,11 @@ func (o *Object) prepareUpload(ctx context.Context, src fs.ObjectInfo, options [
 		}
 	}
 
+	// Azure doesn't store a checksum of the whole blob other than the
+	// MD5, so store the CRC64NVME in the metadata if known. This is
+	// the same polynomial Azure uses for transactional CRC64s.
+	o.updateMetadataWithCRC64(sourceCRC64)
+
 	// Apply upload options (also allows one to overwrite content-type)
 	for _, option := range options {
 		key, value := option.Header()
@@ -3123,4 +3293,6 @@ var (
 	_ fs.MimeTyper       = &Object{}
 	_ fs.GetTierer       = &Object{}
 	_ fs.SetTierer       = &Object{}
+
+	_ fs.ResumableChunkWriter = &azChunkWriter{}
 )
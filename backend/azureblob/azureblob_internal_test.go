@@ -13,7 +13,9 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
@@ -50,6 +52,60 @@ func TestBlockIDCreator(t *testing.T) {
 	assert.ErrorContains(t, bic2.checkID(chunkNumber, got), "random bytes")
 }
 
+func TestUpdateMetadataWithCRC64(t *testing.T) {
+	ctx := context.Background()
+	o := &Object{}
+
+	// Check unknown to start with
+	got, err := o.Hash(ctx, hash.CRC64NVME)
+	require.NoError(t, err)
+	assert.Equal(t, "", got)
+
+	// Check setting it
+	o.updateMetadataWithCRC64("ae8b14860a799888")
+	assert.Equal(t, "ae8b14860a799888", o.meta[crc64Key])
+	got, err = o.Hash(ctx, hash.CRC64NVME)
+	require.NoError(t, err)
+	assert.Equal(t, "ae8b14860a799888", got)
+
+	// Check clearing it leaves other metadata alone
+	o.meta[modTimeKey] = "2009-05-06T04:05:06.499999999Z"
+	o.updateMetadataWithCRC64("")
+	assert.Equal(t, map[string]string{modTimeKey: "2009-05-06T04:05:06.499999999Z"}, o.meta)
+	got, err = o.Hash(ctx, hash.CRC64NVME)
+	require.NoError(t, err)
+	assert.Equal(t, "", got)
+}
+
+func TestSourceHashes(t *testing.T) {
+	ctx := context.Background()
+	const (
+		content = "hello world"
+		md5     = "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	)
+	crc64, err := hash.StreamTypes(strings.NewReader(content), hash.NewHashSet(hash.CRC64NVME))
+	require.NoError(t, err)
+
+	// Hashes which are cheap to read are read from the source
+	src := object.NewStaticObjectInfo("file", time.Now(), int64(len(content)), true, map[hash.Type]string{
+		hash.MD5:       md5,
+		hash.CRC64NVME: crc64[hash.CRC64NVME],
+	}, nil)
+	gotMD5, gotCRC64 := sourceHashes(ctx, src)
+	assert.Equal(t, md5, gotMD5)
+	assert.Equal(t, crc64[hash.CRC64NVME], gotCRC64)
+
+	// Slow hashes are computed together from a local file
+	r := fstest.NewRunIndividual(t)
+	r.WriteFile("file", content, time.Now())
+	o, err := r.Flocal.NewObject(ctx, "file")
+	require.NoError(t, err)
+	require.True(t, r.Flocal.Features().SlowHash)
+	gotMD5, gotCRC64 = sourceHashes(ctx, o)
+	assert.Equal(t, md5, gotMD5)
+	assert.Equal(t, crc64[hash.CRC64NVME], gotCRC64)
+}
+
 func (f *Fs) testFeatures(t *testing.T) {
 	// Check first feature flags are set on this remote
 	enabled := f.Features().SetTier
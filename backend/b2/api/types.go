@@ -341,6 +341,21 @@ type CancelLargeFileResponse struct {
 	BucketID  string `json:"bucketId"`  // The unique ID of the bucket.
 }
 
+// ListPartsRequest is passed to b2_list_parts
+//
+// The response is a ListPartsResponse
+type ListPartsRequest struct {
+	ID              string `json:"fileId"`                    // The unique identifier of the large file being uploaded.
+	StartPartNumber int64  `json:"startPartNumber,omitempty"` // The first part to return.
+	MaxPartCount    int    `json:"maxPartCount,omitempty"`    // The maximum number of parts to return.
+}
+
+// ListPartsResponse is the response to ListPartsRequest
+type ListPartsResponse struct {
+	Parts          []UploadPartResponse `json:"parts"`          // The parts uploaded so far.
+	NextPartNumber *int64               `json:"nextPartNumber"` // What to pass in to startPartNumber for the next search.
+}
+
 // CopyFileRequest is as passed to b2_copy_file
 type CopyFileRequest struct {
 	SourceID                        string                `json:"sourceFileId"`                              // The ID of the source file being copied.
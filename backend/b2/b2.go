@@ -2368,9 +2368,18 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		return info, nil, err
 	}
 
-	up, err := f.newLargeUpload(ctx, o, nil, src, f.opt.ChunkSize, false, nil, options...)
-	if err != nil {
-		return info, nil, err
+	var up *largeUpload
+	if state := fs.ChunkWriterResumeState(options); state != nil {
+		up, err = f.resumeLargeUpload(ctx, o, src, state)
+		if err != nil {
+			fs.Debugf(o, "Can't resume large file upload: %v", err)
+		}
+	}
+	if up == nil {
+		up, err = f.newLargeUpload(ctx, o, nil, src, f.opt.ChunkSize, false, nil, options...)
+		if err != nil {
+			return info, nil, err
+		}
 	}
 
 	info = fs.ChunkWriterInfo{
@@ -2627,4 +2636,6 @@ var (
 	_ fs.Object          = &Object{}
 	_ fs.MimeTyper       = &Object{}
 	_ fs.IDer            = &Object{}
+
+	_ fs.ResumableChunkWriter = &largeUpload{}
 )
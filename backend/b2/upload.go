@@ -8,6 +8,8 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	gohash "hash"
 	"io"
@@ -87,6 +89,16 @@ type largeUpload struct {
 	chunkSize int64                           // chunk size to use
 	src       *Object                         // if copying, object we are reading from
 	info      *api.FileInfo                   // final response with info about the object
+	resumed   bool                            // set if carrying on with a saved upload
+}
+
+// largeUploadState is the state of a largeUpload saved so the upload
+// can be resumed
+type largeUploadState struct {
+	ID        string   `json:"id"`    // ID of the file being uploaded
+	Remote    string   `json:"name"`  // remote being uploaded
+	ChunkSize int64    `json:"cs"`    // chunk size in use
+	SHA1s     []string `json:"sha1s"` // SHA1s for each part
 }
 
 // newLargeUpload starts an upload of object o from in with metadata in src
@@ -188,6 +200,77 @@ func (f *Fs) newLargeUpload(ctx context.Context, o *Object, in io.Reader, src fs
 	return up, nil
 }
 
+// resumeLargeUpload carries on with the upload of object o saved in
+// state by largeUpload.ResumeState
+func (f *Fs) resumeLargeUpload(ctx context.Context, o *Object, src fs.ObjectInfo, state []byte) (up *largeUpload, err error) {
+	var ls largeUploadState
+	err = json.Unmarshal(state, &ls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	if ls.ChunkSize <= 0 {
+		return nil, errors.New("bad chunk size in saved upload")
+	}
+	if ls.Remote != o.remote {
+		return nil, fmt.Errorf("saved upload is for %q not %q", ls.Remote, o.remote)
+	}
+	// Check the upload still exists
+	opts := rest.Opts{
+		Method: "POST",
+		Path:   "/b2_list_parts",
+	}
+	var request = api.ListPartsRequest{
+		ID:           ls.ID,
+		MaxPartCount: 1,
+	}
+	var response api.ListPartsResponse
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.CallJSON(ctx, &opts, &request, &response)
+		return f.shouldRetry(ctx, resp, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find large file %q: %w", ls.ID, err)
+	}
+	size := src.Size()
+	parts := 0
+	if size >= 0 {
+		parts = int(size / ls.ChunkSize)
+		if size%ls.ChunkSize != 0 {
+			parts++
+		}
+	}
+	up = &largeUpload{
+		f:         f,
+		o:         o,
+		what:      "upload",
+		id:        ls.ID,
+		size:      size,
+		parts:     parts,
+		sha1s:     ls.SHA1s,
+		chunkSize: ls.ChunkSize,
+		resumed:   true,
+	}
+	up.in, up.wrap = accounting.UnWrap(nil)
+	return up, nil
+}
+
+// ResumeState returns the state of the upload so it can be resumed
+func (up *largeUpload) ResumeState() ([]byte, error) {
+	up.sha1smu.Lock()
+	defer up.sha1smu.Unlock()
+	return json.Marshal(&largeUploadState{
+		ID:        up.id,
+		Remote:    up.o.remote,
+		ChunkSize: up.chunkSize,
+		SHA1s:     up.sha1s,
+	})
+}
+
+// Resumed returns true if the upload was resumed
+func (up *largeUpload) Resumed() bool {
+	return up.resumed
+}
+
 // getUploadURL returns the upload info with the UploadURL and the AuthorizationToken
 //
 // This should be returned with returnUploadURL when finished
@@ -0,0 +1,101 @@
+package dedup
+
+// Content defined chunking
+//
+// This uses a gear based rolling hash (as used by FastCDC) to find
+// chunk boundaries which depend only on the data near them. This
+// means that inserting or removing data in a file only changes the
+// chunks near the change, so the other chunks can be shared with
+// the previous version of the file.
+
+import (
+	"io"
+	"math/bits"
+
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// gear is the table of random values for the rolling hash
+//
+// This must never change, otherwise the chunk boundaries will
+// change and nothing will be deduplicated against existing chunks.
+var gear [256]uint64
+
+func init() {
+	// Fill the table with splitmix64 from a fixed seed
+	x := uint64(0x72636c6f6e650001)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker splits a stream into content defined chunks
+type chunker struct {
+	in    io.Reader
+	min   int    // minimum chunk size
+	max   int    // maximum chunk size
+	mask  uint64 // boundary when hash & mask == 0
+	buf   []byte // buffer of size max
+	start int    // start of unread data in buf
+	end   int    // end of data in buf
+	eof   bool   // set when in is exhausted
+}
+
+// newChunker makes a chunker which makes chunks of avg size on
+// average, but no smaller than avg/4 and no bigger than avg*4.
+func newChunker(in io.Reader, avg int) *chunker {
+	n := bits.Len(uint(avg)) - 1
+	return &chunker{
+		in:   in,
+		min:  avg / 4,
+		max:  avg * 4,
+		mask: ((uint64(1) << n) - 1) << (64 - n),
+		buf:  make([]byte, avg*4),
+	}
+}
+
+// fill the buffer with as much data as possible
+func (c *chunker) fill() error {
+	if c.eof || c.end-c.start >= c.max {
+		return nil
+	}
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	n, err := readers.ReadFill(c.in, c.buf[c.end:])
+	c.end += n
+	if err == io.EOF {
+		c.eof = true
+		err = nil
+	}
+	return err
+}
+
+// next returns the next chunk or io.EOF if there are no more
+//
+// The chunk returned is only valid until the next call.
+func (c *chunker) next() (chunk []byte, err error) {
+	if err = c.fill(); err != nil {
+		return nil, err
+	}
+	data := c.buf[c.start:c.end]
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+	cut := len(data)
+	if cut > c.min {
+		var h uint64
+		for i := c.min; i < cut; i++ {
+			h = (h << 1) + gear[data[i]]
+			if h&c.mask == 0 {
+				cut = i + 1
+				break
+			}
+		}
+	}
+	c.start += cut
+	return data[:cut], nil
+}
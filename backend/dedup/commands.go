@@ -0,0 +1,203 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "gc":
+		minAge := fs.Duration(defaultMinAge)
+		if s, ok := opt["min-age"]; ok {
+			if err := minAge.Set(s); err != nil {
+				return nil, fmt.Errorf("bad min-age: %w", err)
+			}
+		}
+		// Chunks reused within knownTime of being checked aren't
+		// touched again so could be younger than they look
+		if time.Duration(minAge) <= knownTime {
+			return nil, fmt.Errorf("min-age must be more than %v", fs.Duration(knownTime))
+		}
+		return f.gc(ctx, time.Duration(minAge))
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// defaultMinAge is the default age chunks must be before gc removes them
+//
+// This stops gc removing chunks uploaded by a transfer which hasn't
+// written its manifest yet.
+const defaultMinAge = time.Hour
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "gc",
+	Short: "Remove chunks which aren't used by any file.",
+	Long: `Deleting or overwriting a file only removes its manifest, so the
+chunks it used stay in the remote as they may be shared with other
+files. This command reads every manifest in the remote (not just the
+ones under the path given) and deletes the chunks none of them use.
+
+It respects ` + "`--dry-run`" + `, so run with that first to see what
+would be deleted.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend gc dedup:
+rclone backend gc --dry-run dedup:
+rclone backend gc -o min-age=24h dedup:
+` + "```" + `
+
+Chunks younger than min-age (default 1h) are never deleted so files
+being uploaded while this runs aren't damaged. Uploads refresh the
+modification time of any existing chunk they reuse so it counts as
+young. Don't set this lower than the time the longest upload to the
+remote might take. It must be more than 10m as chunks reused within
+10 minutes of being checked aren't touched again.
+
+It returns a summary of the referenced chunks and the chunks and
+bytes deleted.`,
+	Opts: map[string]string{
+		"min-age": "Only delete unused chunks older than this (default 1h).",
+	},
+}}
+
+// gcStats is the result of the gc command
+type gcStats struct {
+	Manifests  int   `json:"manifests"`  // number of manifests read
+	Referenced int   `json:"referenced"` // number of distinct chunks referenced
+	Chunks     int   `json:"chunks"`     // number of chunks found
+	Deleted    int   `json:"deleted"`    // number of chunks deleted
+	Freed      int64 `json:"freed"`      // bytes freed by deleting chunks
+	Young      int   `json:"young"`      // unreferenced chunks kept for being younger than min-age
+}
+
+// gc removes chunks which aren't referenced by any manifest
+func (f *Fs) gc(ctx context.Context, minAge time.Duration) (stats *gcStats, err error) {
+	stats = new(gcStats)
+
+	// Chunks must be checked and touched again once gc has started
+	// as it may remove any chunk which isn't referenced yet
+	f.clearKnown()
+
+	// Read every manifest in the repository, not just those under root
+	filesFs, err := cache.Get(ctx, fspath.JoinRootPath(f.opt.Remote, filesDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote for files: %w", err)
+	}
+	var mu sync.Mutex
+	used := make(map[string]struct{})
+	err = walk.ListR(ctx, filesFs, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			mo, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			// Any unreadable manifest must stop the gc as it might
+			// reference chunks which would then be deleted
+			m, err := readManifest(ctx, mo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", mo.Remote(), err)
+			}
+			mu.Lock()
+			stats.Manifests++
+			for _, c := range m.Chunks {
+				used[c.Hash] = struct{}{}
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil && err != fs.ErrorDirNotFound {
+		return nil, fmt.Errorf("gc aborted: failed to read manifests: %w", err)
+	}
+	stats.Referenced = len(used)
+	if f.gcHook != nil {
+		f.gcHook()
+	}
+
+	// Remove the chunks nothing refers to
+	cutoff := time.Now().Add(-minAge)
+	err = walk.ListR(ctx, f.chunks, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			stats.Chunks++
+			_, found := used[path.Base(o.Remote())]
+			mu.Unlock()
+			if found {
+				continue
+			}
+			deleted, err := f.gcChunk(ctx, o, cutoff)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			if deleted {
+				stats.Deleted++
+				stats.Freed += o.Size()
+			} else {
+				stats.Young++
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil && err != fs.ErrorDirNotFound {
+		return nil, fmt.Errorf("gc failed to remove chunks: %w", err)
+	}
+	fs.Infof(f, "gc: %d manifests reference %d chunks, deleted %d of %d chunks freeing %v", stats.Manifests, stats.Referenced, stats.Deleted, stats.Chunks, fs.SizeSuffix(stats.Freed))
+	return stats, nil
+}
+
+// gcChunk deletes the unreferenced chunk o unless it was modified
+// after cutoff, returning whether it was deleted.
+//
+// The modification time is read again just before the delete as
+// putChunk touches chunks it reuses, and putChunk is locked out while
+// this runs.
+func (f *Fs) gcChunk(ctx context.Context, o fs.Object, cutoff time.Time) (deleted bool, err error) {
+	if o.ModTime(ctx).After(cutoff) {
+		return false, nil
+	}
+	f.gcMu.Lock()
+	defer f.gcMu.Unlock()
+	o, err = f.chunks.NewObject(ctx, o.Remote())
+	if err == fs.ErrorObjectNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if o.ModTime(ctx).After(cutoff) {
+		return false, nil
+	}
+	err = operations.DeleteFile(ctx, o)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
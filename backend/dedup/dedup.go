@@ -0,0 +1,522 @@
+// Package dedup implements a deduplicating overlay backend
+//
+// Files are split into content defined chunks which are stored once
+// by their SHA-256 in the wrapped remote. Each file is stored as a
+// small manifest listing the chunks it is made from.
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+	"golang.org/x/sync/errgroup"
+)
+
+// Globals
+const (
+	filesDir  = "files"  // directory in the wrapped remote for the manifests
+	chunksDir = "chunks" // directory in the wrapped remote for the chunks
+
+	// How long a chunk is trusted to exist after it was last
+	// uploaded or touched. This must be well below the min-age of
+	// gc so chunks reused by a transfer are always younger than
+	// min-age.
+	knownTime = 10 * time.Minute
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "dedup",
+		Description: "Deduplicate a remote with content defined chunking",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: `Remote to store the deduplicated data in.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+			Required: true,
+		}, {
+			Name: "chunk_size",
+			Help: `Average size of the chunks files are split into.
+
+Chunks will be between a quarter and four times this size. Smaller
+chunks find more duplicate data but need more objects and bigger
+manifests.
+
+Changing this will change where files are split so new uploads won't
+deduplicate against data uploaded with a different chunk size.`,
+			Default:  fs.SizeSuffix(1024 * 1024),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote    string        `config:"remote"`
+	ChunkSize fs.SizeSuffix `config:"chunk_size"`
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	name     string
+	root     string
+	opt      Options
+	files    fs.Fs        // where the manifests are stored, rooted at root
+	chunks   fs.Fs        // where the chunks are stored
+	wrapper  fs.Fs        // the Fs wrapping this one
+	features *fs.Features // optional features
+
+	knownMu sync.Mutex           // protects known
+	known   map[string]time.Time // chunks known to exist and when they were last touched
+	gcMu    sync.RWMutex         // held for reading while using a chunk and for writing while gc deletes one
+	gcHook  func()               // if set called by gc after reading the manifests - for testing
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point dedup remote at itself - check the value of the remote setting")
+	}
+	if opt.ChunkSize < 64 {
+		return nil, errors.New("chunk_size is too small")
+	}
+
+	chunksFs, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, chunksDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote for chunks: %w", err)
+	}
+	filesFs, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, path.Join(filesDir, rpath)))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote for files: %w", err)
+	}
+
+	f := &Fs{
+		name:   name,
+		root:   rpath,
+		opt:    *opt,
+		files:  filesFs,
+		chunks: chunksFs,
+		known:  make(map[string]time.Time),
+	}
+	// Pin both the remotes we use until f is finalized
+	cache.Pin(f.files)
+	cache.Pin(f.chunks)
+	runtime.SetFinalizer(f, func(f *Fs) {
+		cache.Unpin(f.files)
+		cache.Unpin(f.chunks)
+	})
+	// Correct root if definitely pointing to a file
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(f.root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+	}
+
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from the files remote
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+	}).Fill(ctx, f).Mask(ctx, f.files).WrapsFs(f, f.files)
+	// We can always stream as chunks are uploaded as they are read
+	f.features.PutStream = f.PutStream
+
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Dedup '%s:%s'", f.name, f.root)
+}
+
+// Precision of the ModTimes in this Fs
+//
+// Modification times are stored in the manifest so are exact.
+func (f *Fs) Precision() time.Duration {
+	return time.Nanosecond
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.SHA256)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.files
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.files.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	newEntries := entries[:0] // in place filter
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			o, err := f.newObject(ctx, x)
+			if err != nil {
+				fs.Errorf(x, "Skipping file with bad manifest: %v", err)
+				continue
+			}
+			newEntries = append(newEntries, o)
+		case fs.Directory:
+			newEntries = append(newEntries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	mo, err := f.files.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(ctx, mo)
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o := &Object{
+		f:      f,
+		remote: src.Remote(),
+	}
+	err := o.Update(ctx, in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(ctx, in, src, options...)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.files.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.files.Rmdir(ctx, dir)
+}
+
+// Purge all files in the directory
+//
+// The chunks are left behind to be removed with the gc command.
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.files.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do(ctx, dir)
+}
+
+// sameRepo returns true if src stores its chunks in the same place as f
+func (f *Fs) sameRepo(src *Fs) bool {
+	return fs.ConfigString(f.chunks) == fs.ConfigString(src.chunks)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// Only the manifest needs to be copied as the chunks are shared.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.files.Features().Copy
+	srcObj, ok := src.(*Object)
+	if do == nil || !ok || !f.sameRepo(srcObj.f) {
+		return nil, fs.ErrorCantCopy
+	}
+	mo, err := do(ctx, srcObj.mo, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObjectWithManifest(remote, mo, srcObj.m), nil
+}
+
+// Move src to this remote using server-side move operations.
+//
+// Only the manifest needs to be moved as the chunks are shared.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.files.Features().Move
+	srcObj, ok := src.(*Object)
+	if do == nil || !ok || !f.sameRepo(srcObj.f) {
+		return nil, fs.ErrorCantMove
+	}
+	mo, err := do(ctx, srcObj.mo, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObjectWithManifest(remote, mo, srcObj.m), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.files.Features().DirMove
+	srcFs, ok := src.(*Fs)
+	if do == nil || !ok || !f.sameRepo(srcFs) {
+		return fs.ErrorCantDirMove
+	}
+	return do(ctx, srcFs.files, srcRemote, dstRemote)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.files.Features().DirCacheFlush; do != nil {
+		do()
+	}
+	if do := f.chunks.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// chunkPath returns the path of the chunk with the hex SHA-256 sum
+//
+// Chunks are spread over 256 directories to keep directories small.
+func chunkPath(sum string) string {
+	return sum[:2] + "/" + sum
+}
+
+// isKnown returns true if the chunk is known to exist and was
+// touched recently enough that gc won't remove it
+func (f *Fs) isKnown(sum string) bool {
+	f.knownMu.Lock()
+	defer f.knownMu.Unlock()
+	touched, found := f.known[sum]
+	return found && time.Since(touched) < knownTime
+}
+
+// setKnown marks the chunk as existing and touched at the time given
+func (f *Fs) setKnown(sum string, touched time.Time) {
+	f.knownMu.Lock()
+	defer f.knownMu.Unlock()
+	f.known[sum] = touched
+}
+
+// clearKnown forgets all the chunks known to exist
+func (f *Fs) clearKnown() {
+	f.knownMu.Lock()
+	defer f.knownMu.Unlock()
+	f.known = make(map[string]time.Time)
+}
+
+// putChunk uploads the chunk with the given hex SHA-256 sum unless it
+// exists already.
+//
+// If the chunk exists its modification time is refreshed so gc
+// doesn't remove it before the manifest using it is written.
+func (f *Fs) putChunk(ctx context.Context, sum string, data []byte) error {
+	if f.isKnown(sum) {
+		return nil
+	}
+	f.gcMu.RLock()
+	defer f.gcMu.RUnlock()
+	remote := chunkPath(sum)
+	now := time.Now()
+	src := object.NewStaticObjectInfo(remote, now, int64(len(data)), true, nil, f.chunks)
+	o, err := f.chunks.NewObject(ctx, remote)
+	if err == fs.ErrorObjectNotFound {
+		_, err = f.chunks.Put(ctx, bytes.NewReader(data), src)
+	} else if err == nil {
+		err = f.touchChunk(ctx, o, data, src)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload chunk %s: %w", sum, err)
+	}
+	f.setKnown(sum, now)
+	return nil
+}
+
+// touchChunk refreshes the modification time of the existing chunk o
+// so gc sees it as young.
+//
+// If the wrapped remote can't set modification times the chunk is
+// copied server-side to a temporary name and moved back, which makes
+// a new object, and only if that isn't possible is it uploaded again.
+func (f *Fs) touchChunk(ctx context.Context, o fs.Object, data []byte, src fs.ObjectInfo) error {
+	err := o.SetModTime(ctx, src.ModTime(ctx))
+	if !errors.Is(err, fs.ErrorCantSetModTime) && !errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
+		return err
+	}
+	features := f.chunks.Features()
+	if features.Copy != nil && features.Move != nil {
+		tmp, err := features.Copy(ctx, o, o.Remote()+".touch-"+random.String(8))
+		if err == nil {
+			_, err = features.Move(ctx, tmp, o.Remote())
+			if err == nil {
+				return nil
+			}
+			_ = tmp.Remove(ctx)
+		}
+		if !errors.Is(err, fs.ErrorCantCopy) && !errors.Is(err, fs.ErrorCantMove) {
+			return err
+		}
+	}
+	// Upload the chunk again to refresh its modification time
+	return o.Update(ctx, bytes.NewReader(data), src)
+}
+
+// putChunks splits in into chunks, uploads the ones which don't exist
+// and returns a manifest for them
+//
+// Up to --checkers chunks are checked, touched or uploaded at once as
+// most of the work for files sharing data is checking and touching the
+// chunks which exist already.
+func (f *Fs) putChunks(ctx context.Context, in io.Reader) (m *manifest, err error) {
+	m = newManifest()
+	fileHash := sha256.New()
+	c := newChunker(in, int(f.opt.ChunkSize))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(max(fs.GetConfig(ctx).Checkers, 1))
+	for {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = g.Wait()
+			return nil, err
+		}
+		if gCtx.Err() != nil {
+			break
+		}
+		_, _ = fileHash.Write(data)
+		chunkSum := sha256.Sum256(data)
+		sum := hex.EncodeToString(chunkSum[:])
+		m.Chunks = append(m.Chunks, chunkRef{Hash: sum, Size: int64(len(data))})
+		m.Size += int64(len(data))
+		if f.isKnown(sum) {
+			continue
+		}
+		// The chunker reuses its buffer so take a copy
+		data = bytes.Clone(data)
+		g.Go(func() error {
+			return f.putChunk(gCtx, sum, data)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+	return m, nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+)
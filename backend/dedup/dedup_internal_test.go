@@ -0,0 +1,298 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunk in into chunks returning copies of them
+func chunk(t *testing.T, in []byte, avg int) (chunks [][]byte) {
+	c := newChunker(bytes.NewReader(in), avg)
+	for {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, bytes.Clone(data))
+	}
+	return chunks
+}
+
+func TestChunker(t *testing.T) {
+	const avg = 4096
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := chunk(t, data, avg)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, c := range chunks {
+		assert.LessOrEqual(t, len(c), 4*avg)
+		if i < len(chunks)-1 {
+			assert.Greater(t, len(c), avg/4)
+		}
+	}
+	// Check the average is about right
+	mean := len(data) / len(chunks)
+	assert.Greater(t, mean, avg/2)
+	assert.Less(t, mean, avg*2)
+
+	// Inserting data at the start should only change the first chunks
+	edited := append([]byte("inserted data"), data...)
+	editedChunks := chunk(t, edited, avg)
+	seen := make(map[string]struct{})
+	for _, c := range chunks {
+		seen[string(c)] = struct{}{}
+	}
+	shared := 0
+	for _, c := range editedChunks {
+		if _, ok := seen[string(c)]; ok {
+			shared++
+		}
+	}
+	assert.GreaterOrEqual(t, shared, len(chunks)-2)
+
+	// Empty input has no chunks
+	assert.Empty(t, chunk(t, nil, avg))
+}
+
+// countChunks returns the number of chunks stored
+func countChunks(ctx context.Context, t *testing.T, f *Fs) int {
+	n := 0
+	err := operations.ListFn(ctx, f.chunks, func(fs.Object) { n++ })
+	require.NoError(t, err)
+	return n
+}
+
+func TestDedupAndGC(t *testing.T) {
+	ctx := context.Background()
+	fsi, err := NewFs(ctx, "TestDedup", "", configmap.Simple{
+		"remote":     t.TempDir(),
+		"chunk_size": "4Ki",
+	})
+	require.NoError(t, err)
+	f := fsi.(*Fs)
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	put := func(remote string, data []byte) fs.Object {
+		src := object.NewStaticObjectInfo(remote, modTime, int64(len(data)), true, nil, nil)
+		o, err := f.Put(ctx, bytes.NewReader(data), src)
+		require.NoError(t, err)
+		return o
+	}
+
+	// Uploading the same data twice stores no new chunks
+	o1 := put("one", data)
+	n := countChunks(ctx, t, f)
+	put("two", data)
+	assert.Equal(t, n, countChunks(ctx, t, f))
+
+	// Changing the end of the file only adds a few chunks
+	changed := append(bytes.Clone(data[:len(data)-10]), []byte("new ending")...)
+	o3 := put("three", changed)
+	assert.LessOrEqual(t, countChunks(ctx, t, f), n+2)
+
+	// Check the hash and contents of the reassembled file
+	sum, err := o3.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, hashBytes(t, changed), sum)
+	in, err := o3.Open(ctx, &fs.RangeOption{Start: 10000, End: 200000})
+	require.NoError(t, err)
+	got, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, changed[10000:200001], got)
+
+	// gc shouldn't remove anything while everything is referenced
+	stats, err := f.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Deleted)
+
+	// Removing a file shouldn't remove chunks until gc is run
+	before := countChunks(ctx, t, f)
+	require.NoError(t, o3.Remove(ctx))
+	assert.Equal(t, before, countChunks(ctx, t, f))
+
+	// min-age can't be short enough for reused chunks to look old
+	_, err = f.Command(ctx, "gc", nil, map[string]string{"min-age": "10m"})
+	assert.ErrorContains(t, err, "min-age must be more than 10m")
+
+	// Chunks younger than min-age are kept
+	stats, err = f.gc(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Deleted)
+	assert.NotEqual(t, 0, stats.Young)
+
+	stats, err = f.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, 0, stats.Deleted)
+	assert.Equal(t, n, countChunks(ctx, t, f))
+
+	// The other files can still be read
+	in, err = o1.Open(ctx)
+	require.NoError(t, err)
+	got, err = io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, data, got)
+}
+
+// Test a gc running while a file reusing old unreferenced chunks is
+// uploaded doesn't delete those chunks
+func TestGCWhilePutReusesChunks(t *testing.T) {
+	ctx := context.Background()
+	fsi, err := NewFs(ctx, "TestDedupGC", "", configmap.Simple{
+		"remote":     t.TempDir(),
+		"chunk_size": "4Ki",
+	})
+	require.NoError(t, err)
+	f := fsi.(*Fs)
+
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	put := func(remote string) fs.Object {
+		src := object.NewStaticObjectInfo(remote, modTime, int64(len(data)), true, nil, nil)
+		o, err := f.Put(ctx, bytes.NewReader(data), src)
+		require.NoError(t, err)
+		return o
+	}
+
+	// Leave the chunks unreferenced and older than min-age
+	require.NoError(t, put("old").Remove(ctx))
+	old := time.Now().Add(-2 * time.Hour)
+	err = operations.ListFn(ctx, f.chunks, func(o fs.Object) {
+		require.NoError(t, o.SetModTime(ctx, old))
+	})
+	require.NoError(t, err)
+	n := countChunks(ctx, t, f)
+
+	// Upload the same data after gc has read the manifests but
+	// before it removes the chunks
+	var o fs.Object
+	f.gcHook = func() {
+		o = put("new")
+	}
+	stats, err := f.gc(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Deleted)
+	assert.Equal(t, n, stats.Young)
+	assert.Equal(t, n, countChunks(ctx, t, f))
+
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	got, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, data, got)
+}
+
+// Test chunks are uploaded in parallel in the right order and reused
+// chunks are touched
+func TestPutChunks(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Checkers = 4
+	fsi, err := NewFs(ctx, "TestDedupPutChunks", "", configmap.Simple{
+		"remote":     t.TempDir(),
+		"chunk_size": "4Ki",
+	})
+	require.NoError(t, err)
+	f := fsi.(*Fs)
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	chunks := chunk(t, data, 4096)
+
+	check := func(m *manifest) {
+		require.Len(t, m.Chunks, len(chunks))
+		for i, c := range chunks {
+			assert.Equal(t, hashBytes(t, c), m.Chunks[i].Hash)
+			assert.Equal(t, int64(len(c)), m.Chunks[i].Size)
+		}
+		assert.Equal(t, int64(len(data)), m.Size)
+		assert.Equal(t, hashBytes(t, data), m.SHA256)
+	}
+	m, err := f.putChunks(ctx, bytes.NewReader(data))
+	require.NoError(t, err)
+	check(m)
+	n := countChunks(ctx, t, f)
+
+	// Age the chunks and forget them so they are checked again
+	old := time.Now().Add(-2 * time.Hour)
+	err = operations.ListFn(ctx, f.chunks, func(o fs.Object) {
+		require.NoError(t, o.SetModTime(ctx, old))
+	})
+	require.NoError(t, err)
+	f.clearKnown()
+
+	m, err = f.putChunks(ctx, bytes.NewReader(data))
+	require.NoError(t, err)
+	check(m)
+	assert.Equal(t, n, countChunks(ctx, t, f))
+	err = operations.ListFn(ctx, f.chunks, func(o fs.Object) {
+		assert.True(t, o.ModTime(ctx).After(old.Add(time.Hour)), "chunk should have been touched")
+	})
+	require.NoError(t, err)
+}
+
+// Test corrupted chunks are detected when read
+func TestCorruptChunk(t *testing.T) {
+	ctx := context.Background()
+	fsi, err := NewFs(ctx, "TestDedupCorrupt", "", configmap.Simple{
+		"remote":     t.TempDir(),
+		"chunk_size": "4Ki",
+	})
+	require.NoError(t, err)
+	f := fsi.(*Fs)
+
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(5)).Read(data)
+	src := object.NewStaticObjectInfo("file", time.Now(), int64(len(data)), true, nil, nil)
+	o, err := f.Put(ctx, bytes.NewReader(data), src)
+	require.NoError(t, err)
+	m := o.(*Object).m
+
+	// Overwrite the last chunk with different data of the same size
+	last := m.Chunks[len(m.Chunks)-1]
+	co, err := f.chunks.NewObject(ctx, chunkPath(last.Hash))
+	require.NoError(t, err)
+	bad := bytes.Repeat([]byte{'x'}, int(last.Size))
+	require.NoError(t, co.Update(ctx, bytes.NewReader(bad), object.NewStaticObjectInfo(co.Remote(), time.Now(), last.Size, true, nil, nil)))
+
+	read := func(options ...fs.OpenOption) error {
+		in, err := o.Open(ctx, options...)
+		require.NoError(t, err)
+		_, err = io.ReadAll(in)
+		require.NoError(t, in.Close())
+		return err
+	}
+	// Reading the whole file or part of the bad chunk fails
+	assert.ErrorContains(t, read(), "chunk "+last.Hash+" is corrupted")
+	assert.ErrorContains(t, read(&fs.RangeOption{Start: m.Size - 10, End: -1}), "is corrupted")
+
+	// But reading the good chunks is fine
+	assert.NoError(t, read(&fs.RangeOption{Start: 0, End: m.Chunks[0].Size - 1}))
+}
+
+// hashBytes returns the hex SHA-256 of data
+func hashBytes(t *testing.T, data []byte) string {
+	sums, err := hash.StreamTypes(bytes.NewReader(data), hash.NewHashSet(hash.SHA256))
+	require.NoError(t, err)
+	return sums[hash.SHA256]
+}
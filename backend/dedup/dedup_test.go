@@ -0,0 +1,89 @@
+// Test Dedup filesystem interface
+package dedup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/dedup"
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var unimplementableFsMethods = []string{
+	"OpenWriterAt",
+	"OpenChunkWriter",
+	"MergeDirs",
+	"PutUnchecked",
+	"UserInfo",
+	"Disconnect",
+	"ListR",
+	"ListP",
+	"ChangeNotify",
+	"PublicLink",
+	"Shutdown",
+	"CleanUp",
+	"About",
+	"SetTier",
+	"GetTier",
+	"MkdirMetadata",
+	"DirSetModTime",
+}
+
+var unimplementableObjectMethods = []string{
+	"MimeType",
+	"ID",
+	"GetTier",
+	"SetTier",
+	"Metadata",
+	"SetMetadata",
+}
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		tempDir := filepath.Join(os.TempDir(), "rclone-dedup-test")
+		name := "TestDedup"
+		fstests.Run(t, &fstests.Opt{
+			RemoteName: name + ":",
+			NilObject:  nil,
+			ExtraConfig: []fstests.ExtraConfigItem{
+				{Name: name, Key: "type", Value: "dedup"},
+				{Name: name, Key: "remote", Value: tempDir},
+				{Name: name, Key: "chunk_size", Value: "4Ki"},
+			},
+			UnimplementableFsMethods:     unimplementableFsMethods,
+			UnimplementableObjectMethods: unimplementableObjectMethods,
+			QuickTestOK:                  true,
+		})
+		return
+	}
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  nil,
+	})
+}
+
+// TestMemory runs integration tests against a bucket based remote
+// which supports server-side copy
+func TestMemory(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestDedupMemory"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  nil,
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "dedup"},
+			{Name: name, Key: "remote", Value: ":memory:dedup"},
+			{Name: name, Key: "chunk_size", Value: "4Ki"},
+		},
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: unimplementableObjectMethods,
+		QuickTestOK:                  true,
+	})
+}
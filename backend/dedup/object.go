@@ -0,0 +1,348 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// manifestVersion is the current version of the manifest format
+const manifestVersion = 1
+
+// maxManifestSize is the largest manifest which will be read
+//
+// This stops large files which aren't manifests being read into
+// memory by mistake.
+const maxManifestSize = 64 * 1024 * 1024
+
+// chunkRef is a reference to a chunk in a manifest
+type chunkRef struct {
+	Hash string `json:"h"` // hex SHA-256 of the chunk
+	Size int64  `json:"s"` // size of the chunk
+}
+
+// manifest describes how to reassemble a file from its chunks
+type manifest struct {
+	Version int        `json:"ver"`
+	Size    int64      `json:"size"`
+	ModTime time.Time  `json:"mtime"`
+	SHA256  string     `json:"sha256"` // hex SHA-256 of the whole file
+	Chunks  []chunkRef `json:"chunks"`
+}
+
+// newManifest makes a new empty manifest
+func newManifest() *manifest {
+	return &manifest{
+		Version: manifestVersion,
+		Chunks:  []chunkRef{},
+	}
+}
+
+// readManifest reads and decodes the manifest from mo
+func readManifest(ctx context.Context, mo fs.Object) (m *manifest, err error) {
+	if mo.Size() > maxManifestSize {
+		return nil, errors.New("manifest too large")
+	}
+	in, err := mo.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	m = new(manifest)
+	err = json.NewDecoder(io.LimitReader(in, maxManifestSize)).Decode(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	var size int64
+	for _, c := range m.Chunks {
+		if len(c.Hash) != 2*32 || c.Size < 0 {
+			return nil, errors.New("corrupted chunk reference in manifest")
+		}
+		size += c.Size
+	}
+	if size != m.Size {
+		return nil, fmt.Errorf("manifest size %d doesn't match chunk sizes %d", m.Size, size)
+	}
+	return m, nil
+}
+
+// Object describes a deduplicated file
+type Object struct {
+	f      *Fs
+	remote string
+	mo     fs.Object // the manifest object
+	m      *manifest // the decoded manifest
+}
+
+// newObject makes an Object by reading the manifest mo
+func (f *Fs) newObject(ctx context.Context, mo fs.Object) (*Object, error) {
+	m, err := readManifest(ctx, mo)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObjectWithManifest(mo.Remote(), mo, m), nil
+}
+
+// newObjectWithManifest makes an Object from an already decoded manifest
+func (f *Fs) newObjectWithManifest(remote string, mo fs.Object, m *manifest) *Object {
+	return &Object{
+		f:      f,
+		remote: remote,
+		mo:     mo,
+		m:      m,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.m.Size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.m.ModTime
+}
+
+// Hash returns the SHA-256 of the reassembled file
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.SHA256 {
+		return "", hash.ErrUnsupported
+	}
+	return o.m.SHA256, nil
+}
+
+// Storable returns a boolean showing whether this object storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// UnWrap returns the manifest object
+func (o *Object) UnWrap() fs.Object {
+	return o.mo
+}
+
+// putManifest uploads m as the manifest for o
+func (o *Object) putManifest(ctx context.Context, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	src := object.NewStaticObjectInfo(o.remote, m.ModTime, int64(len(data)), true, nil, o.f.files)
+	if o.mo != nil {
+		err = o.mo.Update(ctx, bytes.NewReader(data), src)
+	} else {
+		o.mo, err = o.f.files.Put(ctx, bytes.NewReader(data), src)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	o.m = m
+	return nil
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	m := *o.m
+	m.ModTime = modTime
+	return o.putManifest(ctx, &m)
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// Only chunks which don't already exist are uploaded.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	m, err := o.f.putChunks(ctx, in)
+	if err != nil {
+		return err
+	}
+	if size := src.Size(); size >= 0 && size != m.Size {
+		return fmt.Errorf("size mismatch: expecting %d but read %d", size, m.Size)
+	}
+	if srcSum, err := src.Hash(ctx, hash.SHA256); err == nil && srcSum != "" && srcSum != m.SHA256 {
+		return fmt.Errorf("corrupted on transfer: SHA256 differ %q vs %q", srcSum, m.SHA256)
+	}
+	m.ModTime = src.ModTime(ctx)
+	return o.putManifest(ctx, m)
+}
+
+// Remove an object
+//
+// Only the manifest is removed. Chunks which are no longer
+// referenced can be removed with the gc command.
+func (o *Object) Remove(ctx context.Context) error {
+	return o.mo.Remove(ctx)
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.m.Size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if limit < 0 || offset+limit > o.m.Size {
+		limit = o.m.Size - offset
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	r := &chunkReader{
+		ctx:    ctx,
+		f:      o.f,
+		chunks: o.m.Chunks,
+	}
+	// Find the chunk containing offset
+	for len(r.chunks) > 0 && offset >= r.chunks[0].Size {
+		offset -= r.chunks[0].Size
+		r.chunks = r.chunks[1:]
+	}
+	r.offset = offset
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.LimitReader(r, limit),
+		Closer: r,
+	}, nil
+}
+
+// chunkReader reads the chunks of a file in order, opening each one
+// when it is needed
+type chunkReader struct {
+	ctx    context.Context
+	f      *Fs
+	chunks []chunkRef    // chunks still to read
+	offset int64         // offset into the first chunk
+	in     io.ReadCloser // current chunk or nil
+	hash   gohash.Hash   // SHA-256 of the current chunk so far
+	sum    string        // expected SHA-256 of the current chunk
+	left   int64         // bytes left to read of the current chunk
+	err    error         // sticky error
+}
+
+// Read bytes from the chunks
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	for r.err == nil {
+		if r.in == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			r.err = r.openChunk()
+			continue
+		}
+		n, err = r.in.Read(p)
+		_, _ = r.hash.Write(p[:n])
+		r.left -= int64(n)
+		// Check the chunk as soon as it has all been read as the
+		// reader may not be called again for the EOF at the end
+		// of the file
+		if r.left <= 0 || err == io.EOF {
+			err = r.in.Close()
+			r.in = nil
+			if err != nil {
+				r.err = err
+			} else if r.left != 0 {
+				r.err = fmt.Errorf("chunk %s is corrupted: it is the wrong size", r.sum)
+			} else if got := hex.EncodeToString(r.hash.Sum(nil)); got != r.sum {
+				r.err = fmt.Errorf("chunk %s is corrupted: SHA-256 is %s", r.sum, got)
+			}
+			if n == 0 && r.err == nil {
+				continue
+			}
+			return n, r.err
+		} else if err != nil {
+			r.err = err
+		}
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// openChunk opens the next chunk
+//
+// The whole chunk is read, even if the read starts part way through
+// it, so its SHA-256 can be checked against its name.
+func (r *chunkReader) openChunk() error {
+	c := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	obj, err := r.f.chunks.NewObject(r.ctx, chunkPath(c.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to find chunk %s: %w", c.Hash, err)
+	}
+	if obj.Size() != c.Size {
+		return fmt.Errorf("chunk %s is corrupted: expecting size %d but found %d", c.Hash, c.Size, obj.Size())
+	}
+	r.in, err = obj.Open(r.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk %s: %w", c.Hash, err)
+	}
+	r.hash = sha256.New()
+	r.sum = c.Hash
+	r.left = c.Size
+	if r.offset > 0 {
+		// Skip to the offset hashing what is skipped
+		_, err = io.CopyN(r.hash, r.in, r.offset)
+		r.left -= r.offset
+		r.offset = 0
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %s: %w", c.Hash, err)
+		}
+	}
+	return nil
+}
+
+// Close the reader
+func (r *chunkReader) Close() error {
+	if r.in == nil {
+		return nil
+	}
+	err := r.in.Close()
+	r.in = nil
+	return err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
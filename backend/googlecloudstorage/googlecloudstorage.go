@@ -432,6 +432,7 @@ type Object struct {
 	remote   string    // The remote path
 	url      string    // download path
 	md5sum   string    // The MD5Sum of the object
+	crc32c   string    // The CRC32C of the object as lowercase hex
 	bytes    int64     // Bytes in the object
 	modTime  time.Time // Modified time of the object
 	mimeType string
@@ -1189,7 +1190,7 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
-	return hash.Set(hash.MD5)
+	return hash.NewHashSet(hash.MD5, hash.CRC32C)
 }
 
 // ------------------------------------------------------------
@@ -1212,12 +1213,15 @@ func (o *Object) Remote() string {
 	return o.remote
 }
 
-// Hash returns the Md5sum of an object returning a lowercase hex string
+// Hash returns the Md5sum or CRC32C of an object returning a lowercase hex string
 func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
-	if t != hash.MD5 {
-		return "", hash.ErrUnsupported
+	switch t {
+	case hash.MD5:
+		return o.md5sum, nil
+	case hash.CRC32C:
+		return o.crc32c, nil
 	}
-	return o.md5sum, nil
+	return "", hash.ErrUnsupported
 }
 
 // Size returns the size of an object in bytes
@@ -1240,6 +1244,24 @@ func (o *Object) setMetaData(info *storage.Object) {
 		o.md5sum = hex.EncodeToString(md5sumData)
 	}
 
+	// Read crc32c - this is big-endian as is the hex form
+	o.crc32c = ""
+	if info.Crc32c != "" {
+		crc32cData, err := base64.StdEncoding.DecodeString(info.Crc32c)
+		if err != nil || len(crc32cData) != 4 {
+			fs.Logf(o, "Bad CRC32C decode: %q", info.Crc32c)
+		} else {
+			o.crc32c = hex.EncodeToString(crc32cData)
+		}
+	}
+
+	// If gunzipping then size and hashes are unknown
+	if o.gzipped && o.fs.opt.Decompress {
+		o.bytes = -1
+		o.md5sum = ""
+		o.crc32c = ""
+	}
+
 	// read mtime out of metadata if available
 	mtimeString, ok := info.Metadata[metaMtime]
 	if ok {
@@ -1270,11 +1292,6 @@ func (o *Object) setMetaData(info *storage.Object) {
 		o.modTime = modTime
 	}
 
-	// If gunzipping then size and md5sum are unknown
-	if o.gzipped && o.fs.opt.Decompress {
-		o.bytes = -1
-		o.md5sum = ""
-	}
 }
 
 // readObjectInfo reads the definition for an object
@@ -0,0 +1,1027 @@
+// Package rename provides wrappers for Fs and Object which rename
+// files and directories with reversible transforms
+package rename
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
+	"github.com/rclone/rclone/lib/transform"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "rename",
+		Description: "Rename files and directories of a remote with reversible transforms",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to rename.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\",\n\"myremote:bucket\" or maybe \"myremote:\" (not recommended).",
+			Required: true,
+		}, {
+			Name: "transform",
+			Help: `Transforms to apply to the names on the remote to make the names shown.
+
+These are in the same format as the --name-transform flag, e.g.
+"all,trimprefix=legacy_". Use a comma separated list for more than
+one. They are applied in the order given.
+
+Only transforms which don't lose information may be used: none,
+prefix, suffix, trimprefix, trimsuffix, replace, base64encode,
+base64decode, encoder and decoder.`,
+			Required: true,
+		}, {
+			Name: "inverse",
+			Help: `Transforms to apply to the names shown to make the names on the remote.
+
+These must undo the transform option. If not set they are worked out
+from the transform option where possible.
+
+The remote won't be created if the inverse doesn't undo the
+transform.`,
+		}, {
+			Name: "strict_names",
+			Help: `If set, raise an error when a name on the remote can't be reversed.
+
+Names on the remote which don't come back to the same name after being
+transformed and reversed can't be used through this remote, for
+example names without the prefix removed by trimprefix.
+
+By default rclone will log a NOTICE and skip these names.`,
+			Default:  false,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote      string   `config:"remote"`
+	Transform   []string `config:"transform"`
+	Inverse     []string `config:"inverse"`
+	StrictNames bool     `config:"strict_names"`
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	wrapper  fs.Fs
+	name     string
+	root     string
+	opt      Options
+	features *fs.Features // optional features
+	tr       *transform.Transformer
+	inv      *transform.Transformer
+}
+
+// joinTags rejoins the file, dir and all tags to the transform they
+// belong to as the config parser splits them on the comma.
+func joinTags(items []string) (out []string) {
+	tag := ""
+	for _, item := range items {
+		switch item {
+		case "file", "dir", "all":
+			tag = item + ","
+			continue
+		}
+		out = append(out, tag+item)
+		tag = ""
+	}
+	if tag != "" {
+		out = append(out, strings.TrimSuffix(tag, ","))
+	}
+	return out
+}
+
+// newTransformers makes the transform and its inverse from the
+// options checking the inverse undoes the transform.
+func newTransformers(ctx context.Context, opt *Options) (tr, inv *transform.Transformer, err error) {
+	transforms := joinTags(opt.Transform)
+	if len(transforms) == 0 {
+		return nil, nil, errors.New("transform not set in config file")
+	}
+	tr, err = transform.New(transforms...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if inverses := joinTags(opt.Inverse); len(inverses) > 0 {
+		inv, err = transform.New(inverses...)
+	} else {
+		inv, err = tr.Inverse()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad inverse: %w", err)
+	}
+	err = tr.CheckInverse(ctx, inv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transform can't be reversed: %w", err)
+	}
+	return tr, inv, nil
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	tr, inv, err := newTransformers(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	remote := opt.Remote
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point rename remote at itself - check the value of the remote setting")
+	}
+	// Make sure to remove trailing . referring to the current dir
+	if path.Base(rpath) == "." {
+		rpath = strings.TrimSuffix(rpath, ".")
+	}
+	// Names are transformed without leading or trailing /
+	rpath = strings.Trim(rpath, "/")
+	f := &Fs{
+		name: name,
+		root: rpath,
+		opt:  *opt,
+		tr:   tr,
+		inv:  inv,
+	}
+	// Look for a file first
+	var wrappedFs fs.Fs
+	if rpath == "" {
+		wrappedFs, err = cache.Get(ctx, remote)
+	} else {
+		var wrappedPath string
+		wrappedPath, err = f.toWrapped(ctx, rpath, false)
+		if err == nil {
+			wrappedFs, err = cache.Get(ctx, fspath.JoinRootPath(remote, wrappedPath))
+		}
+		// if that didn't produce a file, look for a directory
+		if err != fs.ErrorIsFile {
+			wrappedPath, err = f.toWrapped(ctx, rpath, true)
+			if err != nil {
+				return nil, err
+			}
+			wrappedFs, err = cache.Get(ctx, fspath.JoinRootPath(remote, wrappedPath))
+		}
+	}
+	if err != fs.ErrorIsFile && err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", remote, err)
+	}
+	f.Fs = wrappedFs
+	cache.PinUntilFinalized(f.Fs, f)
+	// Correct root if definitely pointing to a file
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(f.root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+	}
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		DuplicateFiles:           true,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		BucketBased:              true,
+		CanHaveEmptyDirectories:  true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		PartialUploads:           true,
+	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
+
+	// Enable ListP always
+	f.features.ListP = f.ListP
+
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Renamed '%s:%s'", f.name, f.root)
+}
+
+// fromWrapped transforms a name on the wrapped remote into the name
+// shown, checking that the inverse gives the original name back.
+func (f *Fs) fromWrapped(ctx context.Context, remote string, isDir bool) (string, error) {
+	if remote == "" {
+		return "", nil
+	}
+	shown, err := f.tr.Path(ctx, remote, isDir)
+	if err != nil {
+		return "", err
+	}
+	back, err := f.inv.Path(ctx, shown, isDir)
+	if err != nil {
+		return "", err
+	}
+	if back != remote {
+		return "", fmt.Errorf("transformed name %q reverses to %q", shown, back)
+	}
+	return shown, nil
+}
+
+// toWrapped transforms a name shown into the name on the wrapped
+// remote, checking that the transform gives the original name back.
+func (f *Fs) toWrapped(ctx context.Context, remote string, isDir bool) (string, error) {
+	if remote == "" {
+		return "", nil
+	}
+	wrapped, err := f.inv.Path(ctx, remote, isDir)
+	if err != nil {
+		return "", fmt.Errorf("can't store %q: %w", remote, err)
+	}
+	back, err := f.tr.Path(ctx, wrapped, isDir)
+	if err != nil {
+		return "", fmt.Errorf("can't store %q: %w", remote, err)
+	}
+	if back != remote {
+		return "", fmt.Errorf("can't store %q: it would be stored as %q which is shown as %q", remote, wrapped, back)
+	}
+	return wrapped, nil
+}
+
+// Rename a directory entry and add it to entries.
+func (f *Fs) add(ctx context.Context, entries *fs.DirEntries, entry fs.DirEntry) error {
+	wrappedRemote := entry.Remote()
+	_, isDir := entry.(fs.Directory)
+	remote, err := f.fromWrapped(ctx, wrappedRemote, isDir)
+	if err != nil {
+		if f.opt.StrictNames {
+			return fmt.Errorf("%s: irreversible name detected: %w", wrappedRemote, err)
+		}
+		fs.Logf(wrappedRemote, "Skipping irreversible name: %v", err)
+		return nil
+	}
+	switch x := entry.(type) {
+	case fs.Object:
+		*entries = append(*entries, f.newObject(x, remote))
+	case fs.Directory:
+		*entries = append(*entries, fs.NewDirWrapper(remote, x))
+	default:
+		return fmt.Errorf("unknown object type %T", entry)
+	}
+	return nil
+}
+
+// Rename some directory entries.  This alters entries returning it as newEntries.
+func (f *Fs) renameEntries(ctx context.Context, entries fs.DirEntries) (newEntries fs.DirEntries, err error) {
+	newEntries = entries[:0] // in place filter
+	errors := 0
+	var firsterr error
+	for _, entry := range entries {
+		err = f.add(ctx, &newEntries, entry)
+		if err != nil {
+			errors++
+			if firsterr == nil {
+				firsterr = err
+			}
+		}
+	}
+	if firsterr != nil {
+		return nil, fmt.Errorf("there were %v irreversible name errors. first error: %v", errors, firsterr)
+	}
+	return newEntries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	return list.WithListP(ctx, dir, f)
+}
+
+// ListP lists the objects and directories of the Fs starting
+// from dir non recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	wrappedCallback := func(entries fs.DirEntries) error {
+		entries, err := f.renameEntries(ctx, entries)
+		if err != nil {
+			return err
+		}
+		return callback(entries)
+	}
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return fs.ErrorDirNotFound
+	}
+	listP := f.Fs.Features().ListP
+	if listP == nil {
+		entries, err := f.Fs.List(ctx, wrappedDir)
+		if err != nil {
+			return err
+		}
+		return wrappedCallback(entries)
+	}
+	return listP(ctx, wrappedDir, wrappedCallback)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+//
+// Don't implement this unless you have a more efficient way
+// of listing recursively that doing a directory traversal.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return fs.ErrorDirNotFound
+	}
+	return f.Fs.Features().ListR(ctx, wrappedDir, func(entries fs.DirEntries) error {
+		newEntries, err := f.renameEntries(ctx, entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	wrappedRemote, err := f.toWrapped(ctx, remote, false)
+	if err != nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.Fs.NewObject(ctx, wrappedRemote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, remote), nil
+}
+
+type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error)
+
+// put implements Put, PutStream and PutUnchecked
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, put putFn) (fs.Object, error) {
+	wrappedRemote, err := f.toWrapped(ctx, src.Remote(), false)
+	if err != nil {
+		return nil, err
+	}
+	o, err := put(ctx, in, f.newObjectInfo(src, wrappedRemote), options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o, src.Remote()), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, options, f.Fs.Put)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, options, f.Fs.Features().PutStream)
+}
+
+// PutUnchecked uploads the object
+//
+// This will create a duplicate if we upload a new file without
+// checking to see if there is one already - use Put() for that.
+func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.Fs.Features().PutUnchecked
+	if do == nil {
+		return nil, errors.New("can't PutUnchecked")
+	}
+	return f.put(ctx, in, src, options, do)
+}
+
+// Hashes returns the supported hash sets.
+//
+// The data isn't changed so these are the hashes of the wrapped remote.
+func (f *Fs) Hashes() hash.Set {
+	return f.Fs.Hashes()
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return err
+	}
+	return f.Fs.Mkdir(ctx, wrappedDir)
+}
+
+// MkdirMetadata makes the root directory of the Fs object
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	do := f.Fs.Features().MkdirMetadata
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return nil, err
+	}
+	newDir, err := do(ctx, wrappedDir, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewDirWrapper(dir, newDir), nil
+}
+
+// DirSetModTime sets the directory modtime for dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	do := f.Fs.Features().DirSetModTime
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return err
+	}
+	return do(ctx, wrappedDir, modTime)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return fs.ErrorDirNotFound
+	}
+	return f.Fs.Rmdir(ctx, wrappedDir)
+}
+
+// Purge all files in the directory specified
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	wrappedDir, err := f.toWrapped(ctx, dir, true)
+	if err != nil {
+		return fs.ErrorDirNotFound
+	}
+	return do(ctx, wrappedDir)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	wrappedRemote, err := f.toWrapped(ctx, remote, false)
+	if err != nil {
+		return nil, err
+	}
+	oResult, err := do(ctx, o.Object, wrappedRemote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(oResult, remote), nil
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	wrappedRemote, err := f.toWrapped(ctx, remote, false)
+	if err != nil {
+		return nil, err
+	}
+	oResult, err := do(ctx, o.Object, wrappedRemote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(oResult, remote), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	wrappedSrcRemote, err := srcFs.toWrapped(ctx, srcRemote, true)
+	if err != nil {
+		return fs.ErrorDirNotFound
+	}
+	wrappedDstRemote, err := f.toWrapped(ctx, dstRemote, true)
+	if err != nil {
+		return err
+	}
+	return do(ctx, srcFs.Fs, wrappedSrcRemote, wrappedDstRemote)
+}
+
+// CleanUp the trash in the Fs
+//
+// Implement this if you have a way of emptying the trash or
+// otherwise cleaning up old versions of files.
+func (f *Fs) CleanUp(ctx context.Context) error {
+	do := f.Fs.Features().CleanUp
+	if do == nil {
+		return errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.Fs.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.Fs
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// MergeDirs merges the contents of all the directories passed
+// in into the first one and rmdirs the other directories.
+func (f *Fs) MergeDirs(ctx context.Context, dirs []fs.Directory) error {
+	do := f.Fs.Features().MergeDirs
+	if do == nil {
+		return errors.New("MergeDirs not supported")
+	}
+	out := make([]fs.Directory, len(dirs))
+	for i, dir := range dirs {
+		wrappedDir, err := f.toWrapped(ctx, dir.Remote(), true)
+		if err != nil {
+			return err
+		}
+		out[i] = fs.NewDirWrapper(wrappedDir, dir)
+	}
+	return do(ctx, out)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	do := f.Fs.Features().DirCacheFlush
+	if do != nil {
+		do()
+	}
+}
+
+// PublicLink generates a public link to the remote path (usually readable by anyone)
+func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (string, error) {
+	do := f.Fs.Features().PublicLink
+	if do == nil {
+		return "", errors.New("PublicLink not supported")
+	}
+	o, err := f.NewObject(ctx, remote)
+	if err != nil {
+		// assume it is a directory
+		wrappedDir, err := f.toWrapped(ctx, remote, true)
+		if err != nil {
+			return "", err
+		}
+		return do(ctx, wrappedDir, expire, unlink)
+	}
+	return do(ctx, o.(*Object).Object.Remote(), expire, unlink)
+}
+
+// ChangeNotify calls the passed function with a path
+// that has had changes. If the implementation
+// uses polling, it should adhere to the given interval.
+func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryType), pollIntervalChan <-chan time.Duration) {
+	do := f.Fs.Features().ChangeNotify
+	if do == nil {
+		return
+	}
+	wrappedNotifyFunc := func(path string, entryType fs.EntryType) {
+		var isDir bool
+		switch entryType {
+		case fs.EntryDirectory:
+			isDir = true
+		case fs.EntryObject:
+		default:
+			fs.Errorf(path, "rename ChangeNotify: ignoring unknown EntryType %d", entryType)
+			return
+		}
+		renamed, err := f.fromWrapped(ctx, path, isDir)
+		if err != nil {
+			fs.Logf(f, "ChangeNotify was unable to rename %q: %s", path, err)
+			return
+		}
+		notifyFunc(renamed, entryType)
+	}
+	do(ctx, wrappedNotifyFunc, pollIntervalChan)
+}
+
+var commandHelp = []fs.CommandHelp{
+	{
+		Name:  "encode",
+		Short: "Show the names on the remote of the given name(s).",
+		Long: `This applies the inverse transform to the names given as arguments
+returning a list of the names they are stored as on the remote. It
+will return an error if any of the names can't be stored.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend encode rename: file1 [file2...]
+rclone rc backend/command command=encode fs=rename: file1 [file2...]
+` + "```",
+	},
+	{
+		Name:  "decode",
+		Short: "Show the names shown for the given name(s) on the remote.",
+		Long: `This applies the transform to the names on the remote given as
+arguments returning a list of the names shown. It will return an
+error if any of the names can't be reversed.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend decode rename: remotefile1 [remotefile2...]
+rclone rc backend/command command=decode fs=rename: remotefile1 [remotefile2...]
+` + "```",
+	},
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	var convert func(ctx context.Context, remote string, isDir bool) (string, error)
+	switch name {
+	case "decode":
+		convert = f.fromWrapped
+	case "encode":
+		convert = f.toWrapped
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+	names := make([]string, 0, len(arg))
+	for _, remote := range arg {
+		converted, err := convert(ctx, remote, false)
+		if err != nil {
+			return names, fmt.Errorf("failed to %s %q: %w", name, remote, err)
+		}
+		names = append(names, converted)
+	}
+	return names, nil
+}
+
+// UserInfo returns info about the connected user
+func (f *Fs) UserInfo(ctx context.Context) (map[string]string, error) {
+	do := f.Fs.Features().UserInfo
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return do(ctx)
+}
+
+// Disconnect the current user
+func (f *Fs) Disconnect(ctx context.Context) error {
+	do := f.Fs.Features().Disconnect
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	return do(ctx)
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	do := f.Fs.Features().Shutdown
+	if do == nil {
+		return nil
+	}
+	return do(ctx)
+}
+
+// Object describes a wrapped Object
+//
+// This shows the object with its name transformed
+type Object struct {
+	fs.Object
+	f      *Fs
+	remote string
+}
+
+func (f *Fs) newObject(o fs.Object, remote string) *Object {
+	return &Object{
+		Object: o,
+		f:      f,
+		remote: remote,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return o.Object.Update(ctx, in, o.f.newObjectInfo(src, o.Object.Remote()), options...)
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *Object) ID() string {
+	do, ok := o.Object.(fs.IDer)
+	if !ok {
+		return ""
+	}
+	return do.ID()
+}
+
+// SetTier performs changing storage tier of the Object if
+// multiple storage classes supported
+func (o *Object) SetTier(tier string) error {
+	do, ok := o.Object.(fs.SetTierer)
+	if !ok {
+		return errors.New("rename: underlying remote does not support SetTier")
+	}
+	return do.SetTier(tier)
+}
+
+// GetTier returns storage tier or class of the Object
+func (o *Object) GetTier() string {
+	do, ok := o.Object.(fs.GetTierer)
+	if !ok {
+		return ""
+	}
+	return do.GetTier()
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *Object) MimeType(ctx context.Context) string {
+	do, ok := o.Object.(fs.MimeTyper)
+	if !ok {
+		return ""
+	}
+	return do.MimeType(ctx)
+}
+
+// ObjectInfo describes a wrapped fs.ObjectInfo for being the source
+//
+// This gives the remote name it will have on the wrapped remote
+type ObjectInfo struct {
+	fs.ObjectInfo
+	f      *Fs
+	remote string
+}
+
+func (f *Fs) newObjectInfo(src fs.ObjectInfo, remote string) *ObjectInfo {
+	return &ObjectInfo{
+		ObjectInfo: src,
+		f:          f,
+		remote:     remote,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *ObjectInfo) Fs() fs.Info {
+	return o.f
+}
+
+// Remote returns the remote path
+func (o *ObjectInfo) Remote() string {
+	return o.remote
+}
+
+// GetTier returns storage tier or class of the Object
+func (o *ObjectInfo) GetTier() string {
+	do, ok := o.ObjectInfo.(fs.GetTierer)
+	if !ok {
+		return ""
+	}
+	return do.GetTier()
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *ObjectInfo) ID() string {
+	do, ok := o.ObjectInfo.(fs.IDer)
+	if !ok {
+		return ""
+	}
+	return do.ID()
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *ObjectInfo) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.ObjectInfo.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// MimeType returns the content type of the Object if
+// known, or "" if not
+func (o *ObjectInfo) MimeType(ctx context.Context) string {
+	do, ok := o.ObjectInfo.(fs.MimeTyper)
+	if !ok {
+		return ""
+	}
+	return do.MimeType(ctx)
+}
+
+// UnWrap returns the Object that this Object is wrapping or
+// nil if it isn't wrapping anything
+func (o *ObjectInfo) UnWrap() fs.Object {
+	return fs.UnWrapObjectInfo(o.ObjectInfo)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.PutUncheckeder  = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+	_ fs.MergeDirser     = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.ChangeNotifier  = (*Fs)(nil)
+	_ fs.PublicLinker    = (*Fs)(nil)
+	_ fs.UserInfoer      = (*Fs)(nil)
+	_ fs.Disconnecter    = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.FullObjectInfo  = (*ObjectInfo)(nil)
+	_ fs.FullObject      = (*Object)(nil)
+)
@@ -0,0 +1,124 @@
+package rename
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local" // pull in test backend
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinTags(t *testing.T) {
+	for _, test := range []struct {
+		in   []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"prefix=x"}, []string{"prefix=x"}},
+		{[]string{"all", "prefix=x"}, []string{"all,prefix=x"}},
+		{[]string{"file", "prefix=x", "suffix=y", "dir", "trimprefix=z"}, []string{"file,prefix=x", "suffix=y", "dir,trimprefix=z"}},
+		{[]string{"prefix=x", "all"}, []string{"prefix=x", "all"}},
+	} {
+		assert.Equal(t, test.want, joinTags(test.in), test.in)
+	}
+}
+
+func TestNewTransformers(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		transform []string
+		inverse   []string
+		wantErr   string
+	}{
+		{[]string{"all", "trimprefix=legacy_"}, nil, ""},
+		{[]string{"file", "trimsuffix=.dat"}, []string{"file", "suffix=.dat"}, ""},
+		{[]string{"all", "base64decode"}, nil, ""},
+		{[]string{"all", "replace=_:-"}, nil, ""},
+		{nil, nil, "transform not set"},
+		{[]string{"all", "lowercase"}, nil, "can't be reversed automatically"},
+		{[]string{"all", "lowercase"}, []string{"all", "uppercase"}, "loses information"},
+		{[]string{"all", "trimprefix=legacy_"}, []string{"all", "prefix=old_"}, "isn't undone"},
+		{[]string{"all", "replace=e:E"}, nil, "isn't undone"},
+		{[]string{"all", "date=-{YYYYMMDD}"}, nil, "can't be reversed automatically"},
+		{[]string{"all", "potato"}, nil, "bad transform"},
+	} {
+		opt := &Options{Transform: test.transform, Inverse: test.inverse}
+		_, _, err := newTransformers(ctx, opt)
+		if test.wantErr == "" {
+			assert.NoError(t, err, test.transform)
+		} else {
+			assert.ErrorContains(t, err, test.wantErr, test.transform)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	for _, file := range []string{"legacy_one.txt", "other.txt", "legacy_dir/legacy_two.txt", "legacy_dir/three.txt"} {
+		p := filepath.Join(root, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, os.WriteFile(p, []byte(file), 0666))
+	}
+	m := configmap.Simple{
+		"type":      "rename",
+		"remote":    root,
+		"transform": "all,trimprefix=legacy_",
+	}
+	f, err := NewFs(ctx, "TestRenameInternal", "", m)
+	require.NoError(t, err)
+
+	list := func(f fs.Fs, dir string) (names []string, err error) {
+		entries, err := f.List(ctx, dir)
+		for _, entry := range entries {
+			names = append(names, entry.Remote())
+		}
+		return names, err
+	}
+	names, err := list(f, "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"one.txt", "dir"}, names)
+	names, err = list(f, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/two.txt"}, names)
+
+	o, err := f.NewObject(ctx, "dir/two.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/two.txt", o.Remote())
+	assert.Equal(t, "legacy_dir/legacy_two.txt", o.(*Object).Object.Remote())
+	_, err = f.NewObject(ctx, "other.txt")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	// Check the root is renamed
+	sub, err := NewFs(ctx, "TestRenameInternal", "dir", m)
+	require.NoError(t, err)
+	names, err = list(sub, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two.txt"}, names)
+
+	// Check the root can point to a file
+	_, err = NewFs(ctx, "TestRenameInternal", "dir/two.txt", m)
+	assert.Equal(t, fs.ErrorIsFile, err)
+
+	// Check the commands
+	out, err := f.(*Fs).Command(ctx, "encode", []string{"dir/two.txt"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"legacy_dir/legacy_two.txt"}, out)
+	out, err = f.(*Fs).Command(ctx, "decode", []string{"legacy_one.txt"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one.txt"}, out)
+	_, err = f.(*Fs).Command(ctx, "decode", []string{"other.txt"}, nil)
+	assert.Error(t, err)
+
+	// Check strict names gives an error
+	m["strict_names"] = "true"
+	f, err = NewFs(ctx, "TestRenameInternalStrict", "", m)
+	require.NoError(t, err)
+	_, err = list(f, "")
+	assert.ErrorContains(t, err, "irreversible name")
+}
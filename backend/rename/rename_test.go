@@ -0,0 +1,67 @@
+// Test Rename filesystem interface
+package rename_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/backend/rename"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	fstests.Run(t, &fstests.Opt{
+		RemoteName:               *fstest.RemoteName,
+		NilObject:                (*rename.Object)(nil),
+		UnimplementableFsMethods: []string{"OpenWriterAt", "OpenChunkWriter"},
+	})
+}
+
+// TestPrefix runs integration tests with a prefix on all the names
+func TestPrefix(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-rename-test-prefix")
+	name := "TestRename"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*rename.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "rename"},
+			{Name: name, Key: "remote", Value: tempdir},
+			{Name: name, Key: "transform", Value: "all,trimprefix=legacy_"},
+		},
+		UnimplementableFsMethods: []string{"OpenWriterAt", "OpenChunkWriter"},
+		QuickTestOK:              true,
+	})
+}
+
+// TestSuffix runs integration tests with a suffix on the file names
+// and an explicit inverse
+func TestSuffix(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-rename-test-suffix")
+	name := "TestRenameSuffix"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*rename.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "rename"},
+			{Name: name, Key: "remote", Value: tempdir},
+			{Name: name, Key: "transform", Value: "file,trimsuffix=.dat"},
+			{Name: name, Key: "inverse", Value: "file,suffix=.dat"},
+		},
+		UnimplementableFsMethods: []string{"OpenWriterAt", "OpenChunkWriter"},
+		QuickTestOK:              true,
+	})
+}
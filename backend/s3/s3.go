@@ -1166,6 +1166,11 @@ type Object struct {
 	fs           *Fs               // what this object is part of
 	remote       string            // The remote path
 	md5          string            // md5sum of the object
+	partsETag    string            // ETag of a multipart upload as hex followed by -<parts> if known
+	crc32c       string            // CRC-32C of the whole object as hex if known
+	partsCRC32C  string            // composite CRC-32C of a multipart upload as hex followed by -<parts> if known
+	crc64nvme    string            // CRC-64/NVME of the whole object as hex if known
+	checksums    bool              // set if the checksums have been asked for with HEAD
 	bytes        int64             // size of the object
 	lastModified time.Time         // Last modified
 	meta         map[string]string // The object metadata if known - may be nil - with lower case keys
@@ -3174,7 +3179,13 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 }
 
 // Hashes returns the supported hash sets.
+//
+// The CRC-32C and CRC-64/NVME checksums are only read if data
+// integrity protections are in use.
 func (f *Fs) Hashes() hash.Set {
+	if f.opt.UseDataIntegrityProtections.Value {
+		return hash.NewHashSet(hash.MD5, hash.CRC32C, hash.CRC64NVME)
+	}
 	return hash.Set(hash.MD5)
 }
 
@@ -3891,10 +3902,17 @@ func (o *Object) Remote() string {
 	return o.remote
 }
 
-var matchMd5 = regexp.MustCompile(`^[0-9a-f]{32}$`)
+var (
+	matchMd5           = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	matchMultipartETag = regexp.MustCompile(`^[0-9a-f]{32}-[1-9][0-9]*$`)
+)
 
 // Set the MD5 from the etag
+//
+// If the etag is from a multipart upload this is stored in
+// o.partsETag instead.
 func (o *Object) setMD5FromEtag(etag string) {
+	o.partsETag = ""
 	if o.fs.etagIsNotMD5 {
 		o.md5 = ""
 		return
@@ -3906,6 +3924,9 @@ func (o *Object) setMD5FromEtag(etag string) {
 	hash := strings.Trim(strings.ToLower(etag), `"`)
 	// Check the etag is a valid md5sum
 	if !matchMd5.MatchString(hash) {
+		if matchMultipartETag.MatchString(hash) {
+			o.partsETag = hash
+		}
 		o.md5 = ""
 		return
 	}
@@ -3913,8 +3934,19 @@ func (o *Object) setMD5FromEtag(etag string) {
 }
 
 // Hash returns the Md5sum of an object returning a lowercase hex string
+//
+// It returns the CRC-32C or CRC-64/NVME checksums if these were
+// stored with the object, reading them with a HEAD request if
+// necessary.
 func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
-	if t != hash.MD5 {
+	switch t {
+	case hash.MD5:
+	case hash.CRC32C, hash.CRC64NVME:
+		if !o.fs.opt.UseDataIntegrityProtections.Value {
+			return "", hash.ErrUnsupported
+		}
+		return o.checksum(ctx, t)
+	default:
 		return "", hash.ErrUnsupported
 	}
 	// If decompressing, erase the hash
@@ -3931,6 +3963,154 @@ func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
 	return o.md5, nil
 }
 
+// checksum returns the CRC-32C or CRC-64/NVME of the whole object
+//
+// These aren't returned in listings so this does a HEAD request to
+// read them if they haven't been read already.
+func (o *Object) checksum(ctx context.Context, t hash.Type) (string, error) {
+	// If decompressing, erase the hash
+	if o.bytes < 0 {
+		return "", nil
+	}
+	if !o.checksums {
+		resp, err := o.headObject(ctx)
+		if err != nil {
+			return "", err
+		}
+		o.setMetaData(resp)
+	}
+	if t == hash.CRC32C {
+		return o.crc32c, nil
+	}
+	return o.crc64nvme, nil
+}
+
+// checksumToHex converts a base64 checksum returned by S3 into a hex
+// string.
+//
+// It returns "" if the checksum is missing or it is a composite
+// checksum made from the checksums of the parts of a multipart
+// upload as these can't be compared with the checksum of the data.
+func checksumToHex(checksum *string, checksumType types.ChecksumType) string {
+	if checksum == nil || checksumType == types.ChecksumTypeComposite || strings.ContainsRune(*checksum, '-') {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(*checksum)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(data)
+}
+
+// compositeChecksumToHex converts a base64 composite checksum
+// returned by S3 for a multipart upload into a hex string followed by
+// "-" and the number of parts.
+//
+// It returns "" if the checksum is missing or isn't composite.
+func compositeChecksumToHex(checksum *string, checksumType types.ChecksumType) string {
+	if checksum == nil || checksumType == types.ChecksumTypeFullObject {
+		return ""
+	}
+	checksumBase64, parts, ok := strings.Cut(*checksum, "-")
+	if !ok {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(checksumBase64)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(data) + "-" + parts
+}
+
+// CompositeHash returns the composite hash of the object if it was
+// uploaded in parts. This is read from the multipart ETag or the
+// composite CRC-32C checksum.
+//
+// The chunk size is discovered by reading the sizes of the first and
+// last parts with HEAD requests. It returns nil if the hash can't be
+// checked, for example if the object wasn't uploaded in parts, the
+// parts aren't the same size, or the ETag isn't made from MD5s
+// because the object is encrypted with SSE-KMS or SSE-C.
+func (o *Object) CompositeHash(ctx context.Context) (*hash.Composite, error) {
+	// If decompressing there is no composite hash of the data
+	if o.bytes < 0 {
+		return nil, nil
+	}
+	composite := &hash.Composite{Type: hash.MD5}
+	if o.fs.opt.UseMultipartEtag.Value {
+		composite.Sum = o.partsETag
+	}
+	if composite.Sum == "" && o.fs.opt.UseDataIntegrityProtections.Value {
+		if !o.checksums {
+			resp, err := o.headObject(ctx)
+			if err != nil {
+				fs.Debugf(o, "Can't use composite hash: failed to read checksums: %v", err)
+				return nil, nil
+			}
+			o.setMetaData(resp)
+		}
+		composite = &hash.Composite{Type: hash.CRC32C, Sum: o.partsCRC32C}
+	}
+	parts := composite.Parts()
+	if parts == 0 {
+		return nil, nil
+	}
+	first, err := o.headPart(ctx, 1)
+	if err != nil {
+		fs.Debugf(o, "Can't use composite hash: failed to read first part: %v", err)
+		return nil, nil
+	}
+	if composite.Type == hash.MD5 && etagIsEncrypted(first) {
+		fs.Debugf(o, "Can't use composite hash: ETag isn't made from MD5s as the object is encrypted")
+		return nil, nil
+	}
+	chunkSize := deref(first.ContentLength)
+	lastSize := o.bytes - (parts-1)*chunkSize
+	if chunkSize <= 0 || lastSize <= 0 || lastSize > chunkSize {
+		fs.Debugf(o, "Can't use composite hash: first part of %d bytes doesn't match %d parts in %d bytes", chunkSize, parts, o.bytes)
+		return nil, nil
+	}
+	// Check the last part is the size it should be if the parts
+	// before it are all the same size as the first
+	if parts > 1 {
+		last, err := o.headPart(ctx, parts)
+		if err != nil {
+			fs.Debugf(o, "Can't use composite hash: failed to read last part: %v", err)
+			return nil, nil
+		}
+		if size := deref(last.ContentLength); size != lastSize {
+			fs.Debugf(o, "Can't use composite hash: last part is %d bytes not %d bytes", size, lastSize)
+			return nil, nil
+		}
+	}
+	composite.ChunkSize = chunkSize
+	return composite, nil
+}
+
+// etagIsEncrypted returns true if the response is for an object
+// encrypted with SSE-KMS or SSE-C whose ETags aren't made from the
+// MD5 of the data.
+func etagIsEncrypted(resp *s3.HeadObjectOutput) bool {
+	switch resp.ServerSideEncryption {
+	case types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+		return true
+	}
+	return resp.SSECustomerAlgorithm != nil
+}
+
+// headPart reads the metadata of part of a multipart upload with a
+// HEAD request.
+func (o *Object) headPart(ctx context.Context, part int64) (*s3.HeadObjectOutput, error) {
+	bucket, bucketPath := o.split()
+	req := s3.HeadObjectInput{
+		Bucket:     &bucket,
+		Key:        &bucketPath,
+		VersionId:  o.versionID,
+		PartNumber: aws.Int32(int32(part)),
+	}
+	return o.fs.headObject(ctx, &req)
+}
+
 // Size returns the size of an object in bytes
 func (o *Object) Size() int64 {
 	return o.bytes
@@ -3943,6 +4123,15 @@ func (o *Object) headObject(ctx context.Context) (resp *s3.HeadObjectOutput, err
 		Key:       &bucketPath,
 		VersionId: o.versionID,
 	}
+	// Ask for the checksums too
+	if o.fs.opt.UseDataIntegrityProtections.Value {
+		req.ChecksumMode = types.ChecksumModeEnabled
+		defer func() {
+			if err == nil {
+				o.checksums = true
+			}
+		}()
+	}
 	return o.fs.headObject(ctx, &req)
 }
 
@@ -4014,6 +4203,16 @@ func (o *Object) setMetaData(resp *s3.HeadObjectOutput) {
 		o.bytes = *resp.ContentLength
 	}
 	o.setMD5FromEtag(deref(resp.ETag))
+	// Checksums are only returned if asked for so keep any we have
+	if crc := checksumToHex(resp.ChecksumCRC32C, resp.ChecksumType); crc != "" {
+		o.crc32c = crc
+	}
+	if crc := checksumToHex(resp.ChecksumCRC64NVME, resp.ChecksumType); crc != "" {
+		o.crc64nvme = crc
+	}
+	if crc := compositeChecksumToHex(resp.ChecksumCRC32C, resp.ChecksumType); crc != "" {
+		o.partsCRC32C = crc
+	}
 	o.meta = s3MetadataToMap(resp.Metadata)
 	// Read MD5 from metadata if present
 	if md5sumBase64, ok := o.meta[metaMD5Hash]; ok {
@@ -4066,6 +4265,10 @@ func (o *Object) setMetaData(resp *s3.HeadObjectOutput) {
 	if o.fs.opt.Decompress && deref(o.contentEncoding) == "gzip" {
 		o.bytes = -1
 		o.md5 = ""
+		o.crc32c = ""
+		o.crc64nvme = ""
+		o.partsETag = ""
+		o.partsCRC32C = ""
 	}
 }
 
@@ -4360,6 +4563,51 @@ type s3ChunkWriter struct {
 	md5s                 []byte
 	ui                   uploadInfo
 	o                    *Object
+	resumed              bool
+}
+
+// s3ResumeState is the state of an s3ChunkWriter saved so the upload
+// can be resumed
+type s3ResumeState struct {
+	UploadID  string         `json:"id"`
+	Key       string         `json:"key"`
+	ChunkSize int64          `json:"cs"`
+	Parts     []s3ResumePart `json:"parts"`
+	MD5s      []byte         `json:"md5s"`
+}
+
+// s3ResumePart is a completed part in s3ResumeState
+type s3ResumePart struct {
+	PartNumber int32  `json:"n"`
+	ETag       string `json:"etag"`
+}
+
+// resumeMultipartUpload checks the upload saved in state can be
+// carried on with and returns the decoded state if so
+func (f *Fs) resumeMultipartUpload(ctx context.Context, mReq *s3.CreateMultipartUploadInput, state []byte) (rs *s3ResumeState, err error) {
+	rs = new(s3ResumeState)
+	err = json.Unmarshal(state, rs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	if rs.Key != deref(mReq.Key) {
+		return nil, fmt.Errorf("saved upload is for %q not %q", rs.Key, deref(mReq.Key))
+	}
+	// Check the upload still exists
+	err = f.pacer.Call(func() (bool, error) {
+		_, err = f.c.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:       mReq.Bucket,
+			Key:          mReq.Key,
+			UploadId:     &rs.UploadID,
+			MaxParts:     aws.Int32(1),
+			RequestPayer: mReq.RequestPayer,
+		})
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find upload %q: %w", rs.UploadID, err)
+	}
+	return rs, nil
 }
 
 // OpenChunkWriter returns the chunk size and a ChunkWriter
@@ -4404,51 +4652,106 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		chunkSize = chunksize.Calculator(src, size, uploadParts, chunkSize)
 	}
 
-	var mOut *s3.CreateMultipartUploadOutput
-	err = f.pacer.Call(func() (bool, error) {
-		mOut, err = f.c.CreateMultipartUpload(ctx, &mReq)
-		if err == nil {
-			if mOut == nil {
-				err = fserrors.RetryErrorf("internal error: no info from multipart upload")
-			} else if mOut.UploadId == nil {
-				err = fserrors.RetryErrorf("internal error: no UploadId in multipart upload: %#v", *mOut)
-			}
-		}
-		return f.shouldRetry(ctx, err)
-	})
-	if err != nil {
-		return info, nil, fmt.Errorf("create multipart upload failed: %w", err)
-	}
-
 	chunkWriter := &s3ChunkWriter{
-		chunkSize:            int64(chunkSize),
 		size:                 size,
 		f:                    f,
 		bucket:               ui.req.Bucket,
 		key:                  ui.req.Key,
-		uploadID:             mOut.UploadId,
 		multiPartUploadInput: &mReq,
 		completedParts:       make([]types.CompletedPart, 0),
 		ui:                   ui,
 		o:                    o,
 	}
+
+	// Carry on with a saved upload if possible
+	if state := fs.ChunkWriterResumeState(options); state != nil {
+		rs, err := f.resumeMultipartUpload(ctx, &mReq, state)
+		if err == nil {
+			chunkSize = fs.SizeSuffix(rs.ChunkSize)
+			chunkWriter.uploadID = &rs.UploadID
+			for _, part := range rs.Parts {
+				chunkWriter.addCompletedPart(aws.Int32(part.PartNumber), aws.String(part.ETag))
+			}
+			chunkWriter.md5s = rs.MD5s
+			chunkWriter.resumed = true
+			fs.Debugf(o, "open chunk writer: resumed multipart upload: %v", rs.UploadID)
+		} else {
+			fs.Debugf(o, "open chunk writer: can't resume multipart upload: %v", err)
+		}
+	}
+
+	if !chunkWriter.resumed {
+		var mOut *s3.CreateMultipartUploadOutput
+		err = f.pacer.Call(func() (bool, error) {
+			mOut, err = f.c.CreateMultipartUpload(ctx, &mReq)
+			if err == nil {
+				if mOut == nil {
+					err = fserrors.RetryErrorf("internal error: no info from multipart upload")
+				} else if mOut.UploadId == nil {
+					err = fserrors.RetryErrorf("internal error: no UploadId in multipart upload: %#v", *mOut)
+				}
+			}
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return info, nil, fmt.Errorf("create multipart upload failed: %w", err)
+		}
+		chunkWriter.uploadID = mOut.UploadId
+		fs.Debugf(o, "open chunk writer: started multipart upload: %v", *mOut.UploadId)
+	}
+	chunkWriter.chunkSize = int64(chunkSize)
 	info = fs.ChunkWriterInfo{
 		ChunkSize:         int64(chunkSize),
 		Concurrency:       o.fs.opt.UploadConcurrency,
 		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
 	}
-	fs.Debugf(o, "open chunk writer: started multipart upload: %v", *mOut.UploadId)
 	return info, chunkWriter, err
 }
 
 // add a part number and etag to the completed parts
+//
+// This replaces the part if it is already there, which happens if a
+// part is uploaded again after resuming.
 func (w *s3ChunkWriter) addCompletedPart(partNum *int32, eTag *string) {
 	w.completedPartsMu.Lock()
 	defer w.completedPartsMu.Unlock()
-	w.completedParts = append(w.completedParts, types.CompletedPart{
+	part := types.CompletedPart{
 		PartNumber: partNum,
 		ETag:       eTag,
-	})
+	}
+	for i := range w.completedParts {
+		if *w.completedParts[i].PartNumber == *partNum {
+			w.completedParts[i] = part
+			return
+		}
+	}
+	w.completedParts = append(w.completedParts, part)
+}
+
+// ResumeState returns the state of the upload so it can be resumed
+func (w *s3ChunkWriter) ResumeState() ([]byte, error) {
+	rs := s3ResumeState{
+		UploadID:  *w.uploadID,
+		Key:       *w.key,
+		ChunkSize: w.chunkSize,
+	}
+	w.completedPartsMu.Lock()
+	for _, part := range w.completedParts {
+		rs.Parts = append(rs.Parts, s3ResumePart{
+			PartNumber: *part.PartNumber,
+			ETag:       deref(part.ETag),
+		})
+	}
+	w.completedPartsMu.Unlock()
+	w.md5sMu.Lock()
+	rs.MD5s = bytes.Clone(w.md5s)
+	w.md5sMu.Unlock()
+	return json.Marshal(&rs)
+}
+
+// Resumed returns true if the upload was resumed
+func (w *s3ChunkWriter) Resumed() bool {
+	return w.resumed
 }
 
 // addMd5 adds a binary md5 to the md5 calculated so far
@@ -5002,6 +5305,8 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	// so make up the object as best we can assuming it got
 	// uploaded properly. If size < 0 then we need to do the HEAD.
 	var head *s3.HeadObjectOutput
+	// The checksums of the old object are no longer valid
+	o.crc32c, o.crc64nvme, o.partsCRC32C, o.checksums = "", "", "", false
 	if o.fs.opt.NoHead && size >= 0 {
 		head = new(s3.HeadObjectOutput)
 		//structs.SetFrom(head, &req)
@@ -5292,4 +5597,8 @@ var (
 	_ fs.GetTierer       = &Object{}
 	_ fs.SetTierer       = &Object{}
 	_ fs.Metadataer      = &Object{}
+	_ fs.CompositeHasher = &Object{}
+
+	_ fs.ChunkWriter          = &s3ChunkWriter{}
+	_ fs.ResumableChunkWriter = &s3ChunkWriter{}
 )
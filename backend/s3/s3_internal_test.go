@@ -289,6 +289,79 @@ func TestRemoveAWSChunked(t *testing.T) {
 	}
 }
 
+func TestChecksumToHex(t *testing.T) {
+	ps := func(s string) *string {
+		return &s
+	}
+	tests := []struct {
+		name         string
+		in           *string
+		checksumType types.ChecksumType
+		want         string
+	}{
+		{"nil", nil, "", ""},
+		{"crc32c", ps("TYrgFw=="), "", "4d8ae017"},
+		{"crc32c full object", ps("TYrgFw=="), types.ChecksumTypeFullObject, "4d8ae017"},
+		{"crc64nvme", ps("aHDD//UkVWM="), types.ChecksumTypeFullObject, "6870c3fff5245563"},
+		{"composite", ps("TYrgFw=="), types.ChecksumTypeComposite, ""},
+		{"composite suffix", ps("TYrgFw==-3"), "", ""},
+		{"bad base64", ps("not base64!"), "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, checksumToHex(tc.in, tc.checksumType))
+		})
+	}
+}
+
+func TestCompositeChecksumToHex(t *testing.T) {
+	ps := func(s string) *string {
+		return &s
+	}
+	tests := []struct {
+		name         string
+		in           *string
+		checksumType types.ChecksumType
+		want         string
+	}{
+		{"nil", nil, "", ""},
+		{"full object", ps("TYrgFw=="), types.ChecksumTypeFullObject, ""},
+		{"no suffix", ps("TYrgFw=="), types.ChecksumTypeComposite, ""},
+		{"composite", ps("TYrgFw==-3"), types.ChecksumTypeComposite, "4d8ae017-3"},
+		{"composite no type", ps("TYrgFw==-3"), "", "4d8ae017-3"},
+		{"bad base64", ps("not base64!-3"), types.ChecksumTypeComposite, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, compositeChecksumToHex(tc.in, tc.checksumType))
+		})
+	}
+}
+
+func TestSetMD5FromEtag(t *testing.T) {
+	o := &Object{fs: &Fs{}}
+	for _, test := range []struct {
+		etag      string
+		md5       string
+		partsETag string
+	}{
+		{"", "", ""},
+		{`"D41D8CD98F00B204E9800998ECF8427E"`, "d41d8cd98f00b204e9800998ecf8427e", ""},
+		{`"d41d8cd98f00b204e9800998ecf8427e-12"`, "", "d41d8cd98f00b204e9800998ecf8427e-12"},
+		{`"d41d8cd98f00b204e9800998ecf8427e-0"`, "", ""},
+		{"potato", "", ""},
+	} {
+		o.setMD5FromEtag(test.etag)
+		assert.Equal(t, test.md5, o.md5, test.etag)
+		assert.Equal(t, test.partsETag, o.partsETag, test.etag)
+	}
+
+	// Check nothing is set if the ETag isn't an MD5
+	o.fs.etagIsNotMD5 = true
+	o.setMD5FromEtag(`"d41d8cd98f00b204e9800998ecf8427e-12"`)
+	assert.Equal(t, "", o.partsETag)
+}
+
 func (f *Fs) InternalTestVersions(t *testing.T) {
 	ctx := context.Background()
 
@@ -43,6 +43,7 @@ docs = [
     "crypt.md",
     "compress.md",
     "combine.md",
+    "dedup.md",
     "doi.md",
     "drime.md",
     "dropbox.md",
@@ -77,6 +78,7 @@ docs = [
     "oracleobjectstorage/_index.md",
     "qingstor.md",
     "quatrix.md",
+    "rename.md",
     "sia.md",
     "swift.md",
     "pcloud.md",
@@ -0,0 +1,68 @@
+// Package auditcheck provides the auditcheck command.
+package auditcheck
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/audit"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "auditcheck file",
+	Short: `Check the hash chain of an audit log.`,
+	Long: `Checks the hash chain of an audit log written with ` + "`--audit-log`" + `.
+
+Each entry in the audit log contains the hash of the entry before it,
+so if an entry is edited, inserted or removed the chain is broken and
+this command reports the first entry which doesn't match and returns
+an error. The log must start at the first entry.
+
+If the log was written with ` + "`--audit-key`" + ` pass the same key to check
+it. Without a key the hashes can be recalculated by anyone who can
+edit the log, so only accidental changes are detected.
+
+Use ` + "`-`" + ` to read the audit log from STDIN, for example to check the
+entries sent to syslog.
+
+` + "```console" + `
+rclone auditcheck /var/log/rclone-audit.log
+RCLONE_AUDIT_KEY=secret rclone auditcheck /var/log/rclone-audit.log
+` + "```" + `
+
+Note that removing entries from the end of the log can't be detected
+from the log alone, so compare the last ` + "`seq`" + ` with a copy kept
+elsewhere, for example in syslog.`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.74",
+	},
+	RunE: func(command *cobra.Command, args []string) error {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(false, false, command, func() error {
+			in := os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer func() {
+					_ = f.Close()
+				}()
+				in = f
+			}
+			n, err := audit.Verify(in, audit.Opt.Key)
+			if err != nil {
+				return fmt.Errorf("audit log check failed: %w", err)
+			}
+			fmt.Printf("%d entries OK\n", n)
+			return nil
+		})
+		return nil
+	},
+}
@@ -44,6 +44,16 @@ func SessionName(fs1, fs2 fs.Fs) string {
 	return StripHexString(CanonicalPath(FsPath(fs1))) + ".." + StripHexString(CanonicalPath(FsPath(fs2)))
 }
 
+// SessionNameN makes a unique base name for the sync operation of
+// any number of paths
+func SessionNameN(fss []fs.Fs) string {
+	names := make([]string, len(fss))
+	for i, f := range fss {
+		names[i] = StripHexString(CanonicalPath(FsPath(f)))
+	}
+	return strings.Join(names, "..")
+}
+
 // StripHexString strips the (first) canonical {hexstring} suffix
 func StripHexString(path string) string {
 	open := strings.IndexRune(path, '{')
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -61,12 +62,18 @@ type Options struct {
 	ConflictSuffixFlag    string
 	ConflictSuffix1       string
 	ConflictSuffix2       string
+	Watch                 bool
+	WatchDelay            fs.Duration
+	WatchInterval         fs.Duration
+	changed               []string // paths to relist in an incremental --watch pass
 }
 
 // Default values
 const (
 	DefaultMaxDelete     int    = 50
 	DefaultCheckFilename string = "RCLONE_TEST"
+	DefaultWatchDelay           = fs.Duration(5 * time.Second)
+	DefaultWatchInterval        = fs.Duration(time.Minute)
 )
 
 // DefaultWorkdir is default working directory
@@ -120,6 +127,8 @@ var Opt Options
 
 func init() {
 	Opt.MaxLock = 0
+	Opt.WatchDelay = DefaultWatchDelay
+	Opt.WatchInterval = DefaultWatchInterval
 	cmd.Root.AddCommand(commandDefinition)
 	cmdFlags := commandDefinition.Flags()
 	// when adding new flags, remember to also update the rc params:
@@ -150,7 +159,10 @@ func init() {
 	flags.FVarP(cmdFlags, &Opt.MaxLock, "max-lock", "", "Consider lock files older than this to be expired (default: 0 (never expire)) (minimum: 2m)", "")
 	flags.FVarP(cmdFlags, &Opt.ConflictResolve, "conflict-resolve", "", "Automatically resolve conflicts by preferring the version that is: "+ConflictResolveList+" (default: none)", "")
 	flags.FVarP(cmdFlags, &Opt.ConflictLoser, "conflict-loser", "", "Action to take on the loser of a sync conflict (when there is a winner) or on both files (when there is no winner): "+ConflictLoserList+" (default: num)", "")
-	flags.StringVarP(cmdFlags, &Opt.ConflictSuffixFlag, "conflict-suffix", "", Opt.ConflictSuffixFlag, "Suffix to use when renaming a --conflict-loser. Can be either one string or two comma-separated strings to assign different suffixes to Path1/Path2. (default: 'conflict')", "")
+	flags.StringVarP(cmdFlags, &Opt.ConflictSuffixFlag, "conflict-suffix", "", Opt.ConflictSuffixFlag, "Suffix to use when renaming a --conflict-loser. Can be either one string or one comma-separated string per path to assign different suffixes to Path1/Path2/etc. (default: 'conflict')", "")
+	flags.BoolVarP(cmdFlags, &Opt.Watch, "watch", "", Opt.Watch, "Keep running and sync only the changed paths whenever changes are detected on either path.", "")
+	flags.FVarP(cmdFlags, &Opt.WatchDelay, "watch-delay", "", "Wait for changes to settle for this long before syncing them with --watch.", "")
+	flags.FVarP(cmdFlags, &Opt.WatchInterval, "watch-interval", "", "How often remotes are polled for changes with --watch.", "")
 	_ = cmdFlags.MarkHidden("debugname")
 	_ = cmdFlags.MarkHidden("localtime")
 	addRC()
@@ -158,7 +170,7 @@ func init() {
 
 // bisync command definition
 var commandDefinition = &cobra.Command{
-	Use:   "bisync remote1:path1 remote2:path2",
+	Use:   "bisync remote1:path1 remote2:path2 [remote3:path3 ...]",
 	Short: shortHelp,
 	Long:  longHelp,
 	Annotations: map[string]string{
@@ -168,7 +180,10 @@ var commandDefinition = &cobra.Command{
 	RunE: func(command *cobra.Command, args []string) error {
 		// NOTE: avoid putting too much handling here, as it won't apply to the rc.
 		// Generally it's best to put init-type stuff in Bisync() (operations.go)
-		cmd.CheckArgs(2, 2, command, args)
+		cmd.CheckArgs(2, math.MaxInt, command, args)
+		if len(args) > 2 {
+			return runN(command, args)
+		}
 		fs1, file1, fs2, file2 := cmd.NewFsSrcDstFiles(args)
 		if file1 != "" || file2 != "" {
 			return errors.New("paths must be existing directories")
@@ -192,7 +207,11 @@ var commandDefinition = &cobra.Command{
 		}
 
 		cmd.Run(false, true, command, func() error {
-			err := Bisync(ctx, fs1, fs2, &opt)
+			run := Bisync
+			if opt.Watch {
+				run = Watch
+			}
+			err := run(ctx, fs1, fs2, &opt)
 			if err == ErrBisyncAborted {
 				return fserrors.FatalError(err)
 			}
@@ -202,6 +221,34 @@ var commandDefinition = &cobra.Command{
 	},
 }
 
+// runN runs a bisync of more than two paths
+func runN(command *cobra.Command, args []string) error {
+	fss := make([]fs.Fs, len(args))
+	for i, arg := range args {
+		f, file := cmd.NewFsFile(arg)
+		if file != "" {
+			return errors.New("paths must be existing directories")
+		}
+		fss[i] = f
+	}
+
+	ctx := context.Background()
+	opt := Opt
+	opt.applyContext(ctx)
+	if tzLocal {
+		TZ = time.Local
+	}
+
+	cmd.Run(false, true, command, func() error {
+		err := BisyncN(ctx, fss, &opt)
+		if err == ErrBisyncAborted {
+			return fserrors.FatalError(err)
+		}
+		return err
+	})
+	return nil
+}
+
 func (opt *Options) applyContext(ctx context.Context) {
 	maxDelete := DefaultMaxDelete
 	ci := fs.GetConfig(ctx)
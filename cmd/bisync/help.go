@@ -40,6 +40,7 @@ func RcHelp() string {
 
 - path1 (required) - (string) a remote directory string e.g. ||drive:path1||
 - path2 (required) - (string) a remote directory string e.g. ||drive:path2||
+- path3, path4, ... - (string) further remote directories to sync with path1 and path2 in one pass
 - dryRun - (bool) dry-run mode
 `+GenerateParams()+`
 See [bisync command help](https://rclone.org/commands/rclone_bisync/)
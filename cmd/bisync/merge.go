@@ -0,0 +1,245 @@
+package bisync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/terminal"
+)
+
+// MaxMergeSize is the largest file --conflict-resolve merge will merge
+const MaxMergeSize = 1 << 20
+
+// errNotMergeable is returned for files which are too big or aren't text
+var errNotMergeable = errors.New("not a text file smaller than 1 MiB")
+
+// mergeBaseDir returns the directory the merge bases are kept in
+func (b *bisyncRun) mergeBaseDir() string {
+	return b.basePath + ".merge"
+}
+
+// mergeBaseFile returns the name of the file the merge base of remote
+// is kept in
+func (b *bisyncRun) mergeBaseFile(remote string) string {
+	return filepath.Join(b.mergeBaseDir(), fmt.Sprintf("%x", sha256.Sum256([]byte(remote))))
+}
+
+// readMergeVersion reads remote from f if it can be merged
+func readMergeVersion(ctx context.Context, f fs.Fs, remote string) ([]byte, error) {
+	obj, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Size() < 0 || obj.Size() > MaxMergeSize {
+		return nil, errNotMergeable
+	}
+	in, err := operations.Open(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(in, MaxMergeSize+1))
+	_ = in.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxMergeSize || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return nil, errNotMergeable
+	}
+	return data, nil
+}
+
+// updateMergeBases saves the synced version of each text file in the
+// workdir so that a later conflict can be merged with it as the base.
+//
+// Only files which have changed since they were last saved are read.
+// Errors are logged but not returned as a missing base only means a
+// conflict can't be merged.
+func (b *bisyncRun) updateMergeBases(ctx context.Context) {
+	fs.Infof(nil, "Updating merge bases")
+	ls, err := b.loadListing(b.listing1)
+	if err != nil {
+		fs.Errorf(nil, "Failed to update merge bases: %v", err)
+		return
+	}
+	indexFile := b.mergeBaseDir() + ".lst"
+	index, err := b.loadListing(indexFile)
+	if err != nil {
+		index = newFileList()
+	}
+	if err = os.MkdirAll(b.mergeBaseDir(), 0o700); err != nil {
+		fs.Errorf(nil, "Failed to update merge bases: %v", err)
+		return
+	}
+
+	newIndex := newFileList()
+	newIndex.hash = ls.hash
+	for _, file := range ls.list {
+		info := ls.get(file)
+		if info.flags == "d" || info.size < 0 || info.size > MaxMergeSize {
+			continue
+		}
+		if old := index.get(file); old != nil && old.size == info.size && old.time.Equal(info.time) && old.hash == info.hash {
+			newIndex.put(file, info.size, info.time, info.hash, info.id, info.flags)
+			continue
+		}
+		baseFile := b.mergeBaseFile(file)
+		data, err := readMergeVersion(ctx, b.fs1, file)
+		if err == nil {
+			err = os.WriteFile(baseFile, data, bilib.PermSecure)
+		}
+		if err != nil {
+			_ = os.Remove(baseFile)
+			if !errors.Is(err, errNotMergeable) {
+				fs.Errorf(file, "Failed to save merge base: %v", err)
+				continue
+			}
+		}
+		// files which can't be merged are indexed too so they aren't read again
+		newIndex.put(file, info.size, info.time, info.hash, info.id, info.flags)
+	}
+
+	// remove the bases of files which have gone
+	for _, file := range index.list {
+		if !newIndex.has(file) {
+			_ = os.Remove(b.mergeBaseFile(file))
+		}
+	}
+	if err = newIndex.save(indexFile); err != nil {
+		fs.Errorf(nil, "Failed to save merge base index: %v", err)
+	}
+}
+
+// merge tries a three-way merge of the Path1 and Path2 versions of a
+// conflicting file with the base version from the last sync.
+//
+// If the changes don't overlap the merged version is queued for copying
+// to both paths and it returns true. Otherwise it returns false so the
+// conflict can be handled by --conflict-loser.
+func (b *bisyncRun) merge(ctx context.Context, path1, file, alias string, copy1to2, copy2to1 *bilib.Names) (merged bool, err error) {
+	base, err := os.ReadFile(b.mergeBaseFile(file))
+	if err != nil {
+		fs.Infoc(file, Color(terminal.RedFg, "Can't merge as the base version was not saved."))
+		return false, nil
+	}
+	ours, err := readMergeVersion(ctx, b.fs1, file)
+	if err != nil {
+		fs.Infof(file, Color(terminal.RedFg, "Can't merge Path1 version: %v"), err)
+		return false, nil
+	}
+	theirs, err := readMergeVersion(ctx, b.fs2, alias)
+	if err != nil {
+		fs.Infof(file, Color(terminal.RedFg, "Can't merge Path2 version: %v"), err)
+		return false, nil
+	}
+	result, ok := merge3(base, ours, theirs)
+	if !ok {
+		fs.Infoc(file, Color(terminal.RedFg, "Can't merge as the changes on Path1 and Path2 overlap."))
+		return false, nil
+	}
+
+	switch {
+	case bytes.Equal(result, ours):
+		b.indent("Path1", file, "Merged version is the same as Path1 - queue copy to Path2")
+		copy1to2.Add(file)
+	case bytes.Equal(result, theirs):
+		b.indent("Path2", alias, "Merged version is the same as Path2 - queue copy to Path1")
+		copy2to1.Add(alias)
+	default:
+		b.indent("!Path1", path1+file, "Saving merged version")
+		if !operations.SkipDestructive(ctx, file, "save merged version") {
+			_, err = operations.Rcat(ctx, b.fs1, file, io.NopCloser(bytes.NewReader(result)), time.Now(), nil)
+			if err != nil {
+				b.critical = true
+				return false, fmt.Errorf("%s failed to save merged version of %s: %w", path1, file, err)
+			}
+		}
+		b.indent("Path1", file, "Queue copy to Path2")
+		copy1to2.Add(file)
+	}
+	fs.Infoc(file, Color(terminal.GreenFg, "Merged the changes on Path1 and Path2."))
+	return true, nil
+}
+
+// splitLines splits data into lines keeping the line endings
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns, for each line of a, the index of the line of b
+// it matches or -1
+func matchLines(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	m := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, block := range m.GetMatchingBlocks() {
+		for k := range block.Size {
+			match[block.A+k] = block.B + k
+		}
+	}
+	return match
+}
+
+// merge3 does a line based three-way merge of ours and theirs which
+// were both changed from base.
+//
+// It returns false if the same lines were changed differently in ours
+// and theirs.
+func merge3(base, ours, theirs []byte) ([]byte, bool) {
+	baseLines, ourLines, theirLines := splitLines(base), splitLines(ours), splitLines(theirs)
+	matchOurs, matchTheirs := matchLines(baseLines, ourLines), matchLines(baseLines, theirLines)
+	var out bytes.Buffer
+	i, o, t := 0, 0, 0
+	for {
+		// find the next base line which is unchanged in both
+		k := i
+		for k < len(baseLines) && (matchOurs[k] < 0 || matchTheirs[k] < 0) {
+			k++
+		}
+		endOurs, endTheirs := len(ourLines), len(theirLines)
+		if k < len(baseLines) {
+			endOurs, endTheirs = matchOurs[k], matchTheirs[k]
+		}
+		// merge the changed chunk before it
+		baseChunk := baseLines[i:k]
+		ourChunk, theirChunk := ourLines[o:endOurs], theirLines[t:endTheirs]
+		switch {
+		case slices.Equal(ourChunk, baseChunk):
+			writeLines(&out, theirChunk)
+		case slices.Equal(theirChunk, baseChunk), slices.Equal(ourChunk, theirChunk):
+			writeLines(&out, ourChunk)
+		default:
+			return nil, false
+		}
+		if k >= len(baseLines) {
+			return out.Bytes(), true
+		}
+		out.WriteString(baseLines[k])
+		i, o, t = k+1, endOurs+1, endTheirs+1
+	}
+}
+
+func writeLines(out *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
@@ -0,0 +1,86 @@
+package bisync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/bisync"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConflictResolveMerge checks --conflict-resolve merge
+func TestConflictResolveMerge(t *testing.T) {
+	// use our own stats so errors from other tests don't abort the runs
+	ctx := accounting.WithStatsGroup(context.Background(), "TestConflictResolveMerge")
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	fs1, err := fs.NewFs(ctx, dir1)
+	require.NoError(t, err)
+	fs2, err := fs.NewFs(ctx, dir2)
+	require.NoError(t, err)
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(dir, name, contents string, modTime time.Time) {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0666))
+		require.NoError(t, os.Chtimes(p, modTime, modTime))
+	}
+	read := func(dir, name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(data)
+	}
+	workDir := t.TempDir()
+	run := func(resync bool) {
+		t.Helper()
+		opt := bisync.Options{
+			Workdir:         workDir,
+			Resync:          resync,
+			MaxDelete:       50,
+			Force:           true,
+			ConflictResolve: bisync.PreferMerge,
+		}
+		require.NoError(t, bisync.Bisync(ctx, fs1, fs2, &opt))
+	}
+
+	const base = "one\ntwo\nthree\nfour\nfive\n"
+	write(dir1, "notes.txt", base, t0)
+	write(dir1, "other.txt", base, t0)
+	write(dir1, "binary.bin", "one\x00two\n", t0)
+	run(true)
+
+	// changes to different lines are merged
+	write(dir1, "notes.txt", "one\nTWO\nthree\nfour\nfive\n", t0.Add(time.Minute))
+	write(dir2, "notes.txt", "one\ntwo\nthree\nfour\nFIVE\nsix\n", t0.Add(2*time.Minute))
+	run(false)
+	const merged = "one\nTWO\nthree\nfour\nFIVE\nsix\n"
+	assert.Equal(t, merged, read(dir1, "notes.txt"))
+	assert.Equal(t, merged, read(dir2, "notes.txt"))
+
+	// the merged version is the base for the next merge
+	write(dir1, "notes.txt", "zero\n"+merged, t0.Add(3*time.Minute))
+	write(dir2, "notes.txt", merged+"seven\n", t0.Add(4*time.Minute))
+	run(false)
+	assert.Equal(t, "zero\n"+merged+"seven\n", read(dir1, "notes.txt"))
+	assert.Equal(t, "zero\n"+merged+"seven\n", read(dir2, "notes.txt"))
+
+	// overlapping changes fall back to renaming both versions
+	write(dir1, "other.txt", "one\ntwo\n3\nfour\nfive\n", t0.Add(time.Minute))
+	write(dir2, "other.txt", "one\ntwo\nTHREE\nfour\nfive\n", t0.Add(2*time.Minute))
+	// binary files aren't merged
+	write(dir1, "binary.bin", "one\x00two\nthree\n", t0.Add(time.Minute))
+	write(dir2, "binary.bin", "zero\none\x00two\n", t0.Add(2*time.Minute))
+	run(false)
+	for _, dir := range []string{dir1, dir2} {
+		assert.NoFileExists(t, filepath.Join(dir, "other.txt"))
+		assert.Equal(t, "one\ntwo\n3\nfour\nfive\n", read(dir, "other.txt.conflict1"))
+		assert.Equal(t, "one\ntwo\nTHREE\nfour\nfive\n", read(dir, "other.txt.conflict2"))
+		assert.NoFileExists(t, filepath.Join(dir, "binary.bin"))
+		assert.Equal(t, "one\x00two\nthree\n", read(dir, "binary.bin.conflict1"))
+		assert.Equal(t, "zero\none\x00two\n", read(dir, "binary.bin.conflict2"))
+	}
+}
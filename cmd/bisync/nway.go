@@ -0,0 +1,855 @@
+package bisync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/terminal"
+	"golang.org/x/sync/errgroup"
+)
+
+// nwayRun performs a bisync of more than two paths.
+//
+// Each path keeps its own prior listing and the changes found on any
+// of them are propagated to all the others in one pass.
+type nwayRun struct {
+	*bisyncRun
+	fss      []fs.Fs
+	listings []string               // prior listing of each path
+	suffixes []string               // conflict suffix of each path
+	hashType hash.Type              // hash type shared by all the paths
+	old      []*fileList            // listings from the prior run
+	now      []*fileList            // current listings
+	objs     []map[string]fs.Object // current objects of each path
+	copies   []nwayCopy             // queued copies
+	deletes  []nwayDelete           // queued deletes
+}
+
+// nwayCopy is a queued copy of file from path src to path dst
+type nwayCopy struct {
+	file string
+	src  int
+	dst  int
+}
+
+// nwayDelete is a queued delete of file from path member
+type nwayDelete struct {
+	file   string
+	member int
+}
+
+// file states of a path relative to the prior run
+const (
+	nwayAbsent  = iota // not present now or in the prior run
+	nwaySame           // unchanged since the prior run
+	nwayChanged        // new or modified since the prior run
+	nwayDeleted        // deleted since the prior run
+)
+
+// BisyncN performs a bisync of any number of paths.
+//
+// With two paths this is the same as Bisync. With more, one prior
+// listing is kept for each path and --conflict-resolve and
+// --conflict-loser are applied across all of them.
+func BisyncN(ctx context.Context, fss []fs.Fs, optArg *Options) (err error) {
+	if len(fss) < 2 {
+		return errors.New("bisync needs at least two paths")
+	} else if len(fss) == 2 {
+		return Bisync(ctx, fss[0], fss[1], optArg)
+	}
+	opt := *optArg // ensure that input is never changed
+	n := &nwayRun{
+		bisyncRun: &bisyncRun{
+			fs1:       fss[0],
+			fs2:       fss[1],
+			opt:       &opt,
+			DebugName: opt.DebugName,
+		},
+		fss: fss,
+	}
+
+	if opt.Workdir == "" {
+		opt.Workdir = DefaultWorkdir
+	}
+	ci := fs.GetConfig(ctx)
+	opt.OrigBackupDir = ci.BackupDir
+	if err = n.checkOptions(); err != nil {
+		return err
+	}
+
+	if ci.TerminalColorMode == fs.TerminalColorModeAlways || (ci.TerminalColorMode == fs.TerminalColorModeAuto && !log.Redirected()) {
+		ColorsLock.Lock()
+		Colors = true
+		ColorsLock.Unlock()
+	}
+
+	if err = n.setCompareDefaults(ctx); err != nil {
+		return err
+	}
+	if err = n.setHashType(); err != nil {
+		return err
+	}
+	n.setResyncDefaults()
+	if err = n.setResolveDefaults(); err != nil {
+		return err
+	}
+
+	if n.workDir, err = filepath.Abs(opt.Workdir); err != nil {
+		return fmt.Errorf("failed to make workdir absolute: %w", err)
+	}
+	if err = os.MkdirAll(n.workDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create workdir: %w", err)
+	}
+
+	// Produce a unique name for the sync operation
+	n.basePath = filepath.Join(n.workDir, bilib.SessionNameN(fss))
+	for i := range fss {
+		n.listings = append(n.listings, n.basePath+fmt.Sprintf(".path%d.lst", i+1))
+	}
+	n.listing1, n.listing2 = n.listings[0], n.listings[1]
+
+	if err = n.checkSyntax(); err != nil {
+		return err
+	}
+	if err = n.setLockFile(); err != nil {
+		return err
+	}
+
+	fnHandle := atexit.Register(func() {
+		if atexit.Signalled() {
+			if !opt.Resync {
+				fs.Log(nil, Color(terminal.RedFg, "Bisync interrupted. Must run --resync to recover."))
+				for _, listing := range n.listings {
+					markFailed(listing)
+				}
+			}
+			_ = n.removeLockFile()
+		}
+	})
+	defer atexit.Unregister(fnHandle)
+
+	err = n.run(ctx)
+
+	removeLockErr := n.removeLockFile()
+	if err == nil {
+		err = removeLockErr
+	}
+
+	if n.critical {
+		if n.retryable && opt.Resilient {
+			fs.Errorf(nil, Color(terminal.RedFg, "Bisync critical error: %v"), err)
+			fs.Error(nil, Color(terminal.YellowFg, "Bisync aborted. Error is retryable without --resync due to --resilient mode."))
+			return ErrBisyncAborted
+		}
+		for _, listing := range n.listings {
+			if bilib.FileExists(listing) {
+				_ = os.Rename(listing, listing+"-err")
+			}
+		}
+		fs.Errorf(nil, Color(terminal.RedFg, "Bisync critical error: %v"), err)
+		fs.Error(nil, Color(terminal.RedFg, "Bisync aborted. Must run --resync to recover."))
+		return ErrBisyncAborted
+	}
+	if n.abort {
+		fs.Log(nil, Color(terminal.RedFg, "Bisync aborted. Please try again."))
+	}
+	if err == nil {
+		fs.Infoc(nil, Color(terminal.GreenFg, "Bisync successful"))
+	}
+	return err
+}
+
+// checkOptions returns an error for the options which can't be used
+// with more than two paths
+func (n *nwayRun) checkOptions() error {
+	for _, o := range []struct {
+		name string
+		set  bool
+	}{
+		{"--backup-dir", n.opt.OrigBackupDir != ""},
+		{"--backup-dir1", n.opt.BackupDir1 != ""},
+		{"--backup-dir2", n.opt.BackupDir2 != ""},
+		{"--check-access", n.opt.CheckAccess},
+		{"--conflict-resolve " + n.opt.ConflictResolve.String(), !nwayPreferSupported(n.opt.ConflictResolve)},
+		{"--create-empty-src-dirs", n.opt.CreateEmptySrcDirs},
+		{"--remove-empty-dirs", n.opt.RemoveEmptyDirs},
+		{"--resync-mode " + n.opt.ResyncMode.String(), n.opt.Resync && !nwayPreferSupported(n.opt.ResyncMode)},
+		{"--recover", n.opt.Recover},
+		{"--watch", n.opt.Watch},
+	} {
+		if o.set {
+			return fmt.Errorf("%s is not supported with more than two paths", o.name)
+		}
+	}
+	return nil
+}
+
+// nwayPreferSupported returns true if winner can choose between more
+// than two paths with prefer
+func nwayPreferSupported(prefer Prefer) bool {
+	switch prefer {
+	case PreferNone, PreferPath1, PreferPath2, PreferNewer, PreferOlder, PreferLarger, PreferSmaller:
+		return true
+	}
+	return false
+}
+
+// setHashType chooses a hash type supported by all the paths for the
+// listings
+func (n *nwayRun) setHashType() error {
+	n.hashType = hash.None
+	if n.opt.IgnoreListingChecksum {
+		return nil
+	}
+	common := n.fss[0].Hashes()
+	for _, f := range n.fss[1:] {
+		common = common.Overlap(f.Hashes())
+	}
+	n.hashType = common.GetOne()
+	if n.hashType == hash.None && n.opt.Compare.Checksum {
+		return errors.New(Color(terminal.RedFg, "--compare checksum needs a hash type which all the paths support"))
+	}
+	return nil
+}
+
+// setResolveDefaults sets the conflict suffixes for each path and
+// checks --conflict-resolve and --resync-mode against all the paths
+func (n *nwayRun) setResolveDefaults() (err error) {
+	if n.opt.ConflictLoser == ConflictLoserSkip {
+		n.opt.ConflictLoser = ConflictLoserNumber
+	}
+	if n.suffixes, err = n.conflictSuffixes(len(n.fss)); err != nil {
+		return err
+	}
+	n.opt.ConflictSuffix1, n.opt.ConflictSuffix2 = n.suffixes[0], n.suffixes[1]
+
+	noModtime := !n.opt.Compare.Modtime
+	for _, f := range n.fss {
+		if f.Precision() == fs.ModTimeNotSupported {
+			noModtime = true
+		}
+	}
+	check := func(name string, prefer *Prefer, fallback Prefer) {
+		switch {
+		case (*prefer == PreferNewer || *prefer == PreferOlder) && noModtime:
+			fs.Logf(nil, Color(terminal.YellowFg, "WARNING: ignoring %s %s as modtimes are not compared on all paths."), name, prefer.String())
+			*prefer = fallback
+		case (*prefer == PreferLarger || *prefer == PreferSmaller) && !n.opt.Compare.Size:
+			fs.Logf(nil, Color(terminal.YellowFg, "WARNING: ignoring %s %s as --compare does not include size."), name, prefer.String())
+			*prefer = fallback
+		}
+	}
+	check("--conflict-resolve", &n.opt.ConflictResolve, PreferNone)
+	if n.opt.Resync {
+		check("--resync-mode", &n.opt.ResyncMode, PreferPath1)
+	}
+	return nil
+}
+
+// pathName returns the name used in logs for path i
+func pathName(i int) string {
+	return fmt.Sprintf("Path%d", i+1)
+}
+
+// run performs the N-way bisync with the lock held
+func (n *nwayRun) run(octx context.Context) (err error) {
+	opt := n.opt
+	n.octx, n.fctx = octx, octx
+	if opt.CheckSync == CheckSyncOnly {
+		fs.Infof(nil, "Validating listings for %d paths", len(n.fss))
+		if err = n.checkSync(n.listings); err != nil {
+			n.critical = true
+			n.retryable = true
+		}
+		return err
+	}
+
+	quoted := make([]string, len(n.fss))
+	for i, f := range n.fss {
+		quoted[i] = quotePath(bilib.FsPath(f))
+	}
+	fs.Infof(nil, "Synching %s", strings.Join(quoted, ", "))
+
+	// In --dry-run mode, preserve original listings and save updates to the .lst-dry files
+	newListings := slices.Clone(n.listings)
+	if opt.DryRun {
+		for i := range newListings {
+			newListings[i] += "-dry"
+		}
+	}
+
+	fctx, err := opt.applyFilters(octx)
+	if err != nil {
+		n.critical = true
+		n.retryable = true
+		return err
+	}
+	n.fctx = fctx
+
+	for i := range n.fss {
+		for j := i + 1; j < len(n.fss); j++ {
+			if err = n.overlappingPathsCheck(fctx, n.fss[i], n.fss[j]); err != nil {
+				n.critical = true
+				n.retryable = true
+				return err
+			}
+		}
+	}
+
+	if !opt.Resync {
+		for i, listing := range n.listings {
+			if !bilib.FileExists(listing) {
+				n.critical = true
+				n.retryable = true
+				return fmt.Errorf("cannot find prior %s listing %s, likely due to critical error on prior run", pathName(i), listing)
+			}
+		}
+	}
+
+	fs.Infof(nil, "Building listings for %d paths", len(n.fss))
+	if err = n.makeListings(fctx); err != nil || accounting.Stats(fctx).Errored() {
+		fs.Error(nil, Color(terminal.RedFg, "There were errors while building listings. Aborting as it is too dangerous to continue."))
+		n.critical = true
+		n.retryable = true
+		return err
+	}
+
+	if opt.Resync {
+		fs.Infof(nil, "Resync is copying files to make all %d paths identical", len(n.fss))
+		n.planResync()
+	} else {
+		n.old = make([]*fileList, len(n.fss))
+		for i, listing := range n.listings {
+			if n.old[i], err = n.loadListing(listing); err != nil {
+				n.critical = true
+				n.retryable = true
+				return fmt.Errorf("cannot read prior %s listing: %w", pathName(i), err)
+			}
+		}
+		if err = n.planSync(octx); err != nil {
+			return err
+		}
+	}
+
+	// The listings are saved even if some of the changes failed as
+	// apply leaves them so the next run tries those changes again
+	var applyErr error
+	if len(n.copies) == 0 && len(n.deletes) == 0 {
+		fs.Infof(nil, "No changes found")
+	} else {
+		applyErr = n.apply(octx)
+	}
+
+	for i, ls := range n.now {
+		ls.hash = n.hashType
+		if err = ls.save(newListings[i]); err != nil {
+			n.critical = true
+			return fmt.Errorf("failed to save %s listing: %w", pathName(i), err)
+		}
+	}
+	if applyErr != nil {
+		return applyErr
+	}
+
+	if opt.CheckSync == CheckSyncTrue {
+		fs.Infof(nil, "Validating listings for %d paths", len(n.fss))
+		if err = n.checkSync(newListings); err != nil {
+			n.critical = true
+			return err
+		}
+	}
+	return nil
+}
+
+// makeListings lists all the paths at once
+func (n *nwayRun) makeListings(ctx context.Context) error {
+	n.now = make([]*fileList, len(n.fss))
+	n.objs = make([]map[string]fs.Object, len(n.fss))
+	var g errgroup.Group
+	for i, f := range n.fss {
+		ls, objs := newFileList(), map[string]fs.Object{}
+		n.now[i], n.objs[i] = ls, objs
+		g.Go(func() error {
+			err := walk.ListR(ctx, f, "", false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+				for _, entry := range entries {
+					obj, ok := entry.(fs.Object)
+					if !ok {
+						continue
+					}
+					h := ""
+					if n.hashType != hash.None {
+						var err error
+						if h, err = obj.Hash(ctx, n.hashType); err != nil {
+							fs.Debugf(obj, "failed to read hash: %v", err)
+						}
+					}
+					ls.put(obj.Remote(), obj.Size(), obj.ModTime(ctx).In(TZ), h, "", "-")
+					objs[obj.Remote()] = obj
+				}
+				return nil
+			})
+			if errors.Is(err, fs.ErrorDirNotFound) && n.opt.Resync {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to list %s: %w", pathName(i), err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// allFiles returns the sorted names of the files in any of lists
+func allFiles(lists []*fileList) []string {
+	seen := map[string]struct{}{}
+	for _, ls := range lists {
+		for _, file := range ls.list {
+			seen[file] = struct{}{}
+		}
+	}
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+	return files
+}
+
+// differs returns true if file is definitely different on paths i and j
+func (n *nwayRun) differs(file string, i, j int) bool {
+	a, b := n.now[i].get(file), n.now[j].get(file)
+	return n.infoDiffers(a, b, n.fss[i], n.fss[j])
+}
+
+// infoDiffers returns true if a and b are definitely different versions
+func (n *nwayRun) infoDiffers(a, b *fileInfo, fa, fb fs.Fs) bool {
+	if n.opt.Compare.Size && sizeDiffers(a.size, b.size) {
+		return true
+	}
+	if n.opt.Compare.Modtime && timeDiffers(n.fctx, a.time, b.time, fa, fb) {
+		return true
+	}
+	if n.opt.Compare.Checksum && a.hash != "" && b.hash != "" && a.hash != b.hash {
+		return true
+	}
+	return false
+}
+
+// state returns the state of file on path i relative to the prior run
+func (n *nwayRun) state(file string, i int) int {
+	inOld, inNow := n.old[i].has(file), n.now[i].has(file)
+	switch {
+	case !inOld && !inNow:
+		return nwayAbsent
+	case !inNow:
+		n.indent(pathName(i), file, Color(terminal.RedFg, "File was deleted"))
+		return nwayDeleted
+	case !inOld:
+		n.indent(pathName(i), file, Color(terminal.GreenFg, "File is new"))
+		return nwayChanged
+	case n.infoDiffers(n.old[i].get(file), n.now[i].get(file), n.fss[i], n.fss[i]):
+		n.indent(pathName(i), file, Color(terminal.YellowFg, "File changed"))
+		return nwayChanged
+	}
+	return nwaySame
+}
+
+// planResync queues the copies to make all the paths identical,
+// preferring the version chosen by --resync-mode
+func (n *nwayRun) planResync() {
+	for _, file := range allFiles(n.now) {
+		var have []int
+		for i := range n.fss {
+			if n.now[i].has(file) {
+				have = append(have, i)
+			}
+		}
+		src := -1
+		if len(have) > 1 {
+			src = n.winner(file, have, n.opt.ResyncMode)
+		}
+		if src < 0 {
+			src = have[0]
+		}
+		n.queueCopies(file, src)
+	}
+}
+
+// planSync works out the changes on each path relative to the prior
+// run and queues what is needed to propagate them to the other paths
+func (n *nwayRun) planSync(ctx context.Context) error {
+	type change struct {
+		file             string
+		changed, deleted []int
+		same             []int
+	}
+	var changes []change
+	deleted := make([]int, len(n.fss))
+	for _, file := range allFiles(append(slices.Clone(n.old), n.now...)) {
+		c := change{file: file}
+		for i := range n.fss {
+			switch n.state(file, i) {
+			case nwayChanged:
+				c.changed = append(c.changed, i)
+			case nwayDeleted:
+				c.deleted = append(c.deleted, i)
+				deleted[i]++
+			case nwaySame:
+				c.same = append(c.same, i)
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	// Check for too many deleted files - possible error condition.
+	// Don't want to start deleting on the other paths!
+	if !n.opt.Force {
+		for i, f := range n.fss {
+			ds := &deltaSet{opt: n.opt, fs: f, msg: pathName(i), oldCount: len(n.old[i].list), deleted: deleted[i]}
+			if ds.excessDeletes() {
+				n.abort = true
+				return errors.New("too many deletes")
+			}
+		}
+	}
+
+	for _, c := range changes {
+		switch {
+		case len(c.changed) == 0 && len(c.deleted) == 0:
+			// unchanged so only copy to paths missing it, eg after an interrupted run
+			if len(c.same) > 0 {
+				n.queueCopies(c.file, c.same[0])
+			}
+		case len(c.changed) == 0:
+			// deleted on some paths and unchanged on the others
+			for _, i := range c.same {
+				n.queueDelete(c.file, i)
+			}
+		default:
+			groups := n.groupVersions(c.file, c.changed)
+			if len(groups) == 1 {
+				// changes win over deletes
+				n.queueCopies(c.file, groups[0][0])
+			} else if err := n.resolve(ctx, c.file, groups); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// groupVersions groups the paths in members which have the same
+// version of file
+func (n *nwayRun) groupVersions(file string, members []int) (groups [][]int) {
+outer:
+	for _, i := range members {
+		for g, group := range groups {
+			if !n.differs(file, group[0], i) {
+				groups[g] = append(group, i)
+				continue outer
+			}
+		}
+		groups = append(groups, []int{i})
+	}
+	return groups
+}
+
+// resolve resolves a conflict between the different versions of file
+// in groups, applying --conflict-resolve and --conflict-loser
+func (n *nwayRun) resolve(ctx context.Context, file string, groups [][]int) error {
+	n.indentf("!", file, "New or changed on %d paths with %d different versions", n.countMembers(groups), len(groups))
+	winner := -1
+	if n.opt.ConflictResolve != PreferNone {
+		candidates := make([]int, len(groups))
+		for g, group := range groups {
+			candidates[g] = group[0]
+		}
+		winner = n.winner(file, candidates, n.opt.ConflictResolve)
+	}
+	if winner >= 0 {
+		fs.Infof(file, Color(terminal.GreenFg, "The winner is: %s"), pathName(winner))
+		if n.opt.ConflictLoser == ConflictLoserDelete {
+			// the losers are overwritten by the winner
+			n.queueCopies(file, winner)
+			return nil
+		}
+	} else {
+		fs.Infoc(file, Color(terminal.RedFg, "A winner could not be determined."))
+	}
+
+	// rename each losing version and copy it to the other paths
+	num := 0
+	for _, group := range groups {
+		member := group[0]
+		if member == winner {
+			continue
+		}
+		newName := n.conflictName(ctx, file, member, &num)
+		if err := n.rename(ctx, file, newName, member); err != nil {
+			return err
+		}
+		n.queueCopies(newName, member)
+	}
+	if winner >= 0 {
+		n.queueCopies(file, winner)
+		return nil
+	}
+	// no version keeps the original name
+	for i := range n.fss {
+		if n.now[i].has(file) {
+			n.queueDelete(file, i)
+		}
+	}
+	return nil
+}
+
+// countMembers returns the number of paths in groups
+func (n *nwayRun) countMembers(groups [][]int) (count int) {
+	for _, group := range groups {
+		count += len(group)
+	}
+	return count
+}
+
+// conflictName returns the name to rename the losing version of file
+// on path member to
+func (n *nwayRun) conflictName(ctx context.Context, file string, member int, num *int) string {
+	suffix := n.suffixes[member]
+	if n.opt.ConflictLoser == ConflictLoserPathname {
+		if !slices.ContainsFunc(n.suffixes, func(s string) bool { return s != suffix }) {
+			// numerate, but not if user supplied different suffixes
+			suffix += fmt.Sprint(member + 1)
+		}
+		return SuffixName(ctx, file, suffix)
+	}
+	for *num++; ; *num++ {
+		newName := SuffixName(ctx, file, suffix+fmt.Sprint(*num))
+		if !slices.ContainsFunc(n.now, func(ls *fileList) bool { return ls.has(newName) }) {
+			fs.Debugf(file, "The first available suffix is: %d", *num)
+			return newName
+		}
+	}
+}
+
+// rename renames file to newName on path member
+func (n *nwayRun) rename(ctx context.Context, file, newName string, member int) error {
+	f, obj := n.fss[member], n.objs[member][file]
+	n.indent("!"+pathName(member), bilib.FsPath(f)+newName, fmt.Sprintf("Renaming %s copy", pathName(member)))
+	if !operations.SkipDestructive(ctx, file, "rename") {
+		// The listings aren't saved if this fails so the next run
+		// finds the conflict again
+		if err := operations.MoveFile(ctx, f, f, newName, file); err != nil {
+			return fmt.Errorf("%s rename failed for %s: %w", pathName(member), file, err)
+		}
+		newObj, err := f.NewObject(ctx, newName)
+		if err != nil {
+			return fmt.Errorf("%s rename failed for %s: %w", pathName(member), file, err)
+		}
+		obj = newObj
+	}
+	info := n.now[member].get(file)
+	n.now[member].put(newName, info.size, info.time, info.hash, info.id, info.flags)
+	n.now[member].remove(file)
+	n.objs[member][newName] = obj
+	delete(n.objs[member], file)
+	return nil
+}
+
+// winner returns the path among candidates preferred by prefer for
+// file or -1 if there isn't one
+func (n *nwayRun) winner(file string, candidates []int, prefer Prefer) int {
+	var value func(i int) (int64, bool)
+	switch prefer {
+	case PreferPath1, PreferPath2:
+		want := 0
+		if prefer == PreferPath2 {
+			want = 1
+		}
+		if slices.Contains(candidates, want) {
+			return want
+		}
+		fs.Debugf(file, "Winner cannot be determined as %s has no candidate version.", pathName(want))
+		return -1
+	case PreferNewer, PreferOlder:
+		if fs.GetModifyWindow(n.octx, fsInfos(n.fss)...) == fs.ModTimeNotSupported {
+			fs.Debugf(file, "Winner cannot be determined as at least one path lacks modtime support.")
+			return -1
+		}
+		value = func(i int) (int64, bool) {
+			t := n.now[i].getTime(file)
+			return t.UnixNano(), !t.IsZero()
+		}
+	case PreferLarger, PreferSmaller:
+		value = func(i int) (int64, bool) {
+			s := n.now[i].getSize(file)
+			return s, s >= 0
+		}
+	default:
+		return -1
+	}
+	best, bestValue, tie := -1, int64(0), false
+	for _, i := range candidates {
+		v, ok := value(i)
+		if !ok {
+			fs.Debugf(file, "Winner cannot be determined as the %s of %s is unknown.", prefer.String(), pathName(i))
+			return -1
+		}
+		if prefer == PreferOlder || prefer == PreferSmaller {
+			v = -v
+		}
+		switch {
+		case best < 0 || v > bestValue:
+			best, bestValue, tie = i, v, false
+		case v == bestValue:
+			tie = true
+		}
+	}
+	if tie {
+		fs.Debugf(file, "Winner cannot be determined as more than one version is %s.", prefer.String())
+		return -1
+	}
+	return best
+}
+
+// fsInfos converts fss to a slice of fs.Info
+func fsInfos(fss []fs.Fs) []fs.Info {
+	infos := make([]fs.Info, len(fss))
+	for i, f := range fss {
+		infos[i] = f
+	}
+	return infos
+}
+
+// queueCopies queues copies of file from path src to every path which
+// doesn't have the same version
+func (n *nwayRun) queueCopies(file string, src int) {
+	for dst := range n.fss {
+		if dst == src || (n.now[dst].has(file) && !n.differs(file, src, dst)) {
+			continue
+		}
+		n.indent(pathName(src), file, "Queue copy to "+pathName(dst))
+		n.copies = append(n.copies, nwayCopy{file: file, src: src, dst: dst})
+	}
+}
+
+// queueDelete queues a delete of file from path member
+func (n *nwayRun) queueDelete(file string, member int) {
+	n.indent(pathName(member), file, "Queue delete")
+	n.deletes = append(n.deletes, nwayDelete{file: file, member: member})
+}
+
+// apply performs the queued deletes and copies and updates the
+// current listings to match.
+//
+// Failed changes are left out of the listings so the next run makes
+// them again: a file which failed to be deleted stays in the listing
+// of its path, and the source of a failed copy has its entry reverted
+// to the prior run so the file is seen as changed again.
+func (n *nwayRun) apply(ctx context.Context) error {
+	var firstErr error
+	for _, d := range n.deletes {
+		if err := operations.DeleteFile(ctx, n.objs[d.member][d.file]); err != nil {
+			n.handleErr(d.file, pathName(d.member)+" delete failed", err, false, true)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		n.now[d.member].remove(d.file)
+	}
+
+	ci := fs.GetConfig(ctx)
+	results := make([]fs.Object, len(n.copies))
+	errs := make([]error, len(n.copies))
+	var g errgroup.Group
+	g.SetLimit(max(ci.Transfers, 1))
+	for i, c := range n.copies {
+		src, dst := n.objs[c.src][c.file], n.objs[c.dst][c.file]
+		g.Go(func() error {
+			results[i], errs[i] = operations.Copy(ctx, n.fss[c.dst], dst, c.file, src)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var failed []nwayCopy
+	for i, c := range n.copies {
+		if errs[i] != nil {
+			n.handleErr(c.file, fmt.Sprintf("copy from %s to %s failed", pathName(c.src), pathName(c.dst)), errs[i], false, true)
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			failed = append(failed, c)
+			continue
+		}
+		info := n.now[c.src].get(c.file)
+		size, modTime := info.size, info.time
+		if obj := results[i]; obj != nil {
+			size, modTime = obj.Size(), obj.ModTime(ctx).In(TZ)
+		}
+		n.now[c.dst].put(c.file, size, modTime, info.hash, info.id, info.flags)
+	}
+	for _, c := range failed {
+		n.revert(c.file, c.src)
+	}
+	return firstErr
+}
+
+// revert sets the listing entry for file on path i back to what it
+// was in the prior run, removing it if it wasn't there, so the next
+// run sees the file as changed on path i
+func (n *nwayRun) revert(file string, i int) {
+	if n.old != nil && n.old[i].has(file) {
+		info := n.old[i].get(file)
+		n.now[i].put(file, info.size, info.time, info.hash, info.id, info.flags)
+		return
+	}
+	n.now[i].remove(file)
+}
+
+// checkSync checks that the listings of all the paths match
+func (n *nwayRun) checkSync(listings []string) error {
+	lists := make([]*fileList, len(listings))
+	for i, listing := range listings {
+		ls, err := n.loadListing(listing)
+		if err != nil {
+			return fmt.Errorf("cannot read prior listing of %s: %w", pathName(i), err)
+		}
+		lists[i] = ls
+	}
+	ok := true
+	for _, file := range allFiles(lists) {
+		for i := 1; i < len(lists); i++ {
+			has1, hasI := lists[0].has(file), lists[i].has(file)
+			switch {
+			case has1 && !hasI:
+				n.indent("ERROR", file, "Path1 file not found in "+pathName(i))
+				ok = false
+			case !has1 && hasI:
+				n.indent("ERROR", file, pathName(i)+" file not found in Path1")
+				ok = false
+			case has1 && n.infoDiffers(lists[0].get(file), lists[i].get(file), n.fss[0], n.fss[i]):
+				n.indent("ERROR", file, "Path1 and "+pathName(i)+" files differ")
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		return errors.New("paths are out of sync, run --resync to recover")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package bisync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/bisync"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBisyncN checks a bisync of three paths
+func TestBisyncN(t *testing.T) {
+	// use our own stats so errors from other tests don't abort the runs
+	ctx := accounting.WithStatsGroup(context.Background(), "TestBisyncN")
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	fss := make([]fs.Fs, len(dirs))
+	for i, dir := range dirs {
+		f, err := fs.NewFs(ctx, dir)
+		require.NoError(t, err)
+		fss[i] = f
+	}
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(dir int, name, contents string, modTime time.Time) {
+		p := filepath.Join(dirs[dir], name)
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0666))
+		require.NoError(t, os.Chtimes(p, modTime, modTime))
+	}
+	// check that all the paths contain exactly want
+	check := func(want map[string]string) {
+		t.Helper()
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			got := map[string]string{}
+			for _, entry := range entries {
+				data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+				require.NoError(t, err)
+				got[entry.Name()] = string(data)
+			}
+			assert.Equal(t, want, got, dir)
+		}
+	}
+	run := func(opt bisync.Options) {
+		t.Helper()
+		opt.MaxDelete = 50
+		require.NoError(t, bisync.BisyncN(ctx, fss, &opt))
+	}
+	workDir := t.TempDir()
+
+	// resync merges the unique files of every path
+	write(0, "one.txt", "one", t0)
+	write(1, "two.txt", "two", t0)
+	write(2, "three.txt", "three", t0)
+	write(0, "four.txt", "four", t0)
+	write(2, "four.txt", "four from path3", t0)
+	run(bisync.Options{Workdir: workDir, Resync: true})
+	check(map[string]string{"one.txt": "one", "two.txt": "two", "three.txt": "three", "four.txt": "four"})
+	for _, suffix := range []string{".path1.lst", ".path2.lst", ".path3.lst"} {
+		matches, err := filepath.Glob(filepath.Join(workDir, "*"+suffix))
+		require.NoError(t, err)
+		assert.Len(t, matches, 1, suffix)
+	}
+
+	// a change on one path is copied to the others
+	write(2, "one.txt", "one changed", t0.Add(time.Minute))
+	run(bisync.Options{Workdir: workDir})
+	check(map[string]string{"one.txt": "one changed", "two.txt": "two", "three.txt": "three", "four.txt": "four"})
+
+	// a delete on one path is propagated
+	require.NoError(t, os.Remove(filepath.Join(dirs[1], "two.txt")))
+	run(bisync.Options{Workdir: workDir})
+	check(map[string]string{"one.txt": "one changed", "three.txt": "three", "four.txt": "four"})
+
+	// the same change on two paths isn't a conflict
+	write(0, "three.txt", "three changed", t0.Add(time.Minute))
+	write(1, "three.txt", "three changed", t0.Add(time.Minute))
+	run(bisync.Options{Workdir: workDir})
+	check(map[string]string{"one.txt": "one changed", "three.txt": "three changed", "four.txt": "four"})
+
+	// different changes with no winner are all kept
+	write(0, "four.txt", "four 1", t0.Add(time.Minute))
+	write(2, "four.txt", "four 3", t0.Add(2*time.Minute))
+	run(bisync.Options{Workdir: workDir})
+	check(map[string]string{"one.txt": "one changed", "three.txt": "three changed", "four.txt.conflict1": "four 1", "four.txt.conflict2": "four 3"})
+
+	// the newer version wins and the losers are renamed
+	write(0, "one.txt", "one 1", t0.Add(3*time.Minute))
+	write(1, "one.txt", "one 2", t0.Add(5*time.Minute))
+	write(2, "one.txt", "one 3", t0.Add(4*time.Minute))
+	run(bisync.Options{Workdir: workDir, ConflictResolve: bisync.PreferNewer, ConflictLoser: bisync.ConflictLoserPathname})
+	check(map[string]string{"one.txt": "one 2", "one.txt.conflict1": "one 1", "one.txt.conflict3": "one 3",
+		"three.txt": "three changed", "four.txt.conflict1": "four 1", "four.txt.conflict2": "four 3"})
+
+	// a change wins over a delete
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "three.txt")))
+	write(2, "three.txt", "three again", t0.Add(time.Hour))
+	run(bisync.Options{Workdir: workDir, ConflictLoser: bisync.ConflictLoserDelete})
+	check(map[string]string{"one.txt": "one 2", "one.txt.conflict1": "one 1", "one.txt.conflict3": "one 3",
+		"three.txt": "three again", "four.txt.conflict1": "four 1", "four.txt.conflict2": "four 3"})
+
+	// failed copies don't need a resync and are made by the next run
+	failCtx, ci := fs.AddConfig(accounting.WithStatsGroup(ctx, "TestBisyncNFail"))
+	ci.MaxTransfer = 1
+	write(2, "one.txt", "one changed again", t0.Add(2*time.Hour))
+	err := bisync.BisyncN(failCtx, fss, &bisync.Options{Workdir: workDir, MaxDelete: 50})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, bisync.ErrBisyncAborted)
+	run(bisync.Options{Workdir: workDir})
+	check(map[string]string{"one.txt": "one changed again", "one.txt.conflict1": "one 1", "one.txt.conflict3": "one 3",
+		"three.txt": "three again", "four.txt.conflict1": "four 1", "four.txt.conflict2": "four 3"})
+
+	// options which need exactly two paths are refused
+	err = bisync.BisyncN(ctx, fss, &bisync.Options{Workdir: workDir, Watch: true})
+	assert.ErrorContains(t, err, "--watch is not supported with more than two paths")
+	err = bisync.BisyncN(ctx, fss, &bisync.Options{Workdir: workDir, Resync: true, ResyncMode: bisync.PreferMerge})
+	assert.ErrorContains(t, err, "--resync-mode merge is not supported with more than two paths")
+}
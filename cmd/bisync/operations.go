@@ -178,6 +178,9 @@ func Bisync(ctx context.Context, fs1, fs2 fs.Fs, optArg *Options) (err error) {
 
 	// run bisync
 	err = b.runLocked(ctx)
+	if err == nil && !b.critical && opt.ConflictResolve == PreferMerge && !opt.DryRun && opt.CheckSync != CheckSyncOnly {
+		b.updateMergeBases(ctx)
+	}
 
 	removeLockErr := b.removeLockFile()
 	if err == nil {
@@ -307,8 +310,13 @@ func (b *bisyncRun) runLocked(octx context.Context) (err error) {
 		}
 	}
 
-	fs.Infof(nil, "Building Path1 and Path2 listings")
-	b.march.ls1, b.march.ls2, err = b.makeMarchListing(fctx)
+	if opt.changed != nil {
+		fs.Infof(nil, "Building Path1 and Path2 listings for %d changed paths", len(opt.changed))
+		b.march.ls1, b.march.ls2, err = b.makeWatchListing(fctx)
+	} else {
+		fs.Infof(nil, "Building Path1 and Path2 listings")
+		b.march.ls1, b.march.ls2, err = b.makeMarchListing(fctx)
+	}
 	if err != nil || accounting.Stats(fctx).Errored() {
 		fs.Error(nil, Color(terminal.RedFg, "There were errors while building listings. Aborting as it is too dangerous to continue."))
 		b.critical = true
@@ -5,6 +5,7 @@ import (
 	"context"
 	_ "embed"
 	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
 	"strconv"
@@ -23,13 +24,14 @@ func addRC() {
 		Fn:           rcBisync,
 		Title:        shortHelp,
 		Help:         rcHelp,
+		RemoteParams: map[string]string{"workdir": "", "filtersFile": "", "backupDir1": "", "backupdir1": "", "backupDir2": "", "backupdir2": ""},
 	})
 }
 
 //go:embed rc.md
 var rcHelp string
 
-var shortHelp = `Perform bidirectional synchronization between two paths.`
+var shortHelp = `Perform bidirectional synchronization between two or more paths.`
 
 var longHelp = shortHelp + MakeHelp(`
 
@@ -164,6 +166,22 @@ func rcBisync(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 		fs.Debugf("maxLock", "optional parameter is missing. using default value: %v", opt.MaxLock)
 	}
 
+	if opt.Watch, err = in.GetBool("watch"); rc.NotErrParamNotFound(err) {
+		fs.Debugf("watch", "optional parameter is missing. using default value: %v", opt.Watch)
+	}
+	if opt.WatchDelay, err = in.GetFsDuration("watchDelay"); rc.IsErrParamNotFound(err) {
+		opt.WatchDelay = DefaultWatchDelay
+		fs.Debugf("watchDelay", "optional parameter is missing. using default value: %v", opt.WatchDelay)
+	} else if err != nil {
+		return nil, err
+	}
+	if opt.WatchInterval, err = in.GetFsDuration("watchInterval"); rc.IsErrParamNotFound(err) {
+		opt.WatchInterval = DefaultWatchInterval
+		fs.Debugf("watchInterval", "optional parameter is missing. using default value: %v", opt.WatchInterval)
+	} else if err != nil {
+		return nil, err
+	}
+
 	fs1, err := rc.GetFsNamed(octx, in, "path1")
 	if err != nil {
 		return nil, err
@@ -174,26 +192,51 @@ func rcBisync(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 		return nil, err
 	}
 
+	// any further paths are path3, path4, etc
+	fss := []fs.Fs{fs1, fs2}
+	for i := 3; ; i++ {
+		f, err := rc.GetFsNamed(octx, in, fmt.Sprintf("path%d", i))
+		if rc.IsErrParamNotFound(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		fss = append(fss, f)
+	}
+
 	output := bilib.CaptureOutput(func() {
-		err = Bisync(octx, fs1, fs2, opt)
+		if len(fss) > 2 {
+			err = BisyncN(octx, fss, opt)
+		} else if opt.Watch {
+			err = Watch(octx, fs1, fs2, opt)
+		} else {
+			err = Bisync(octx, fs1, fs2, opt)
+		}
 	})
 
 	workDir, _ := filepath.Abs(DefaultWorkdir)
 	if opt.Workdir != "" {
 		workDir, _ = filepath.Abs(opt.Workdir)
 	}
+	session := bilib.SessionName(fs1, fs2)
 	basePath := bilib.BasePath(ctx, workDir, fs1, fs2)
+	if len(fss) > 2 {
+		session = bilib.SessionNameN(fss)
+		basePath = filepath.Join(workDir, session)
+	}
 
 	_, _ = log.Writer().Write(output)
-	return rc.Params{
+	out = rc.Params{
 		"output":   string(output),
-		"session":  bilib.SessionName(fs1, fs2),
+		"session":  session,
 		"workDir":  workDir,
 		"basePath": basePath,
-		"listing1": basePath + ".path1.lst",
-		"listing2": basePath + ".path2.lst",
 		"logFile":  fslog.Opt.File,
-	}, err
+	}
+	for i := range fss {
+		out[fmt.Sprintf("listing%d", i+1)] = basePath + fmt.Sprintf(".path%d.lst", i+1)
+	}
+	return out, err
 }
 
 func setEnum(in rc.Params, name string, defaultVal string, set func(s string) error) error {
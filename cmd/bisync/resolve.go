@@ -26,6 +26,7 @@ const (
 	PreferOlder
 	PreferLarger
 	PreferSmaller
+	PreferMerge
 )
 
 type preferChoices struct{}
@@ -39,6 +40,7 @@ func (preferChoices) Choices() []string {
 		PreferSmaller: "smaller",
 		PreferPath1:   "path1",
 		PreferPath2:   "path2",
+		PreferMerge:   "merge",
 	}
 }
 
@@ -81,27 +83,12 @@ func (b *bisyncRun) setResolveDefaults() error {
 	if b.opt.ConflictLoser == ConflictLoserSkip {
 		b.opt.ConflictLoser = ConflictLoserNumber
 	}
-	if b.opt.ConflictSuffixFlag == "" {
-		b.opt.ConflictSuffixFlag = "conflict"
-	}
-	suffixes := strings.Split(b.opt.ConflictSuffixFlag, ",")
-	if len(suffixes) == 1 {
-		b.opt.ConflictSuffix1 = suffixes[0]
-		b.opt.ConflictSuffix2 = suffixes[0]
-	} else if len(suffixes) == 2 {
-		b.opt.ConflictSuffix1 = suffixes[0]
-		b.opt.ConflictSuffix2 = suffixes[1]
-	} else {
-		return fmt.Errorf("--conflict-suffix cannot have more than 2 comma-separated values. Received %v: %v", len(suffixes), suffixes)
+	suffixes, err := b.conflictSuffixes(2)
+	if err != nil {
+		return err
 	}
-	// replace glob variables, if any
-	t := time.Now() // capture static time here so it is the same for all files throughout this run
-	b.opt.ConflictSuffix1 = transform.AppyTimeGlobs(b.opt.ConflictSuffix1, t)
-	b.opt.ConflictSuffix2 = transform.AppyTimeGlobs(b.opt.ConflictSuffix2, t)
-
-	// append dot (intentionally allow more than one)
-	b.opt.ConflictSuffix1 = "." + b.opt.ConflictSuffix1
-	b.opt.ConflictSuffix2 = "." + b.opt.ConflictSuffix2
+	b.opt.ConflictSuffix1 = suffixes[0]
+	b.opt.ConflictSuffix2 = suffixes[1]
 
 	// checks and warnings
 	if (b.opt.ConflictResolve == PreferNewer || b.opt.ConflictResolve == PreferOlder) && (b.fs1.Precision() == fs.ModTimeNotSupported || b.fs2.Precision() == fs.ModTimeNotSupported) {
@@ -119,6 +106,31 @@ func (b *bisyncRun) setResolveDefaults() error {
 	return nil
 }
 
+// conflictSuffixes parses --conflict-suffix into one suffix for each
+// of the paths being synced
+func (b *bisyncRun) conflictSuffixes(paths int) ([]string, error) {
+	if b.opt.ConflictSuffixFlag == "" {
+		b.opt.ConflictSuffixFlag = "conflict"
+	}
+	suffixes := strings.Split(b.opt.ConflictSuffixFlag, ",")
+	if len(suffixes) > paths {
+		return nil, fmt.Errorf("--conflict-suffix cannot have more than %d comma-separated values. Received %v: %v", paths, len(suffixes), suffixes)
+	} else if len(suffixes) != 1 && len(suffixes) != paths {
+		return nil, fmt.Errorf("--conflict-suffix must have either 1 or %d comma-separated values. Received %v: %v", paths, len(suffixes), suffixes)
+	}
+	t := time.Now() // capture static time here so it is the same for all files throughout this run
+	out := make([]string, paths)
+	for i := range out {
+		suffix := suffixes[0]
+		if len(suffixes) > 1 {
+			suffix = suffixes[i]
+		}
+		// replace glob variables, if any, and append dot (intentionally allow more than one)
+		out[i] = "." + transform.AppyTimeGlobs(suffix, t)
+	}
+	return out, nil
+}
+
 type (
 	renames map[string]renamesInfo // [originalName]newName (remember the originalName may have an alias)
 	// the newName may be the same as the old name (if winner), but should not be blank, unless we're deleting.
@@ -136,6 +148,14 @@ type namePair struct {
 }
 
 func (b *bisyncRun) resolve(ctxMove context.Context, path1, path2, file, alias string, renameSkipped, copy1to2, copy2to1 *bilib.Names, ds1, ds2 *deltaSet) (err error) {
+	if b.opt.ConflictResolve == PreferMerge {
+		merged, err := b.merge(ctxMove, path1, file, alias, copy1to2, copy2to1)
+		if err != nil || merged {
+			return err
+		}
+		// fall back to --conflict-loser with no winner
+	}
+
 	winningPath := 0
 	if b.opt.ConflictResolve != PreferNone {
 		winningPath = b.conflictWinner(ds1, ds2, file, alias)
@@ -21,6 +21,10 @@ func (b *bisyncRun) setResyncDefaults() {
 	if b.opt.ResyncMode != PreferNone {
 		b.opt.Resync = true
 	}
+	if b.opt.ResyncMode == PreferMerge {
+		fs.Logf(nil, Color(terminal.YellowFg, "WARNING: ignoring --resync-mode merge as it is only supported by --conflict-resolve."))
+		b.opt.ResyncMode = PreferPath1
+	}
 
 	// checks and warnings
 	if (b.opt.ResyncMode == PreferNewer || b.opt.ResyncMode == PreferOlder) && (b.fs1.Precision() == fs.ModTimeNotSupported || b.fs2.Precision() == fs.ModTimeNotSupported) {
@@ -0,0 +1,337 @@
+package bisync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/terminal"
+)
+
+// watcher collects the paths changed on either side for --watch
+type watcher struct {
+	opt     *Options
+	mu      sync.Mutex
+	changed map[string]struct{}
+	wake    chan struct{}
+}
+
+// Watch runs a bisync then keeps running incremental bisyncs of only
+// the paths which change on Path1 or Path2 until ctx is cancelled.
+//
+// The listings and lock file are shared with normal bisync runs so
+// occasional full runs can be made while watching. The lock file is
+// only held while a pass is running.
+func Watch(ctx context.Context, fs1, fs2 fs.Fs, opt *Options) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := &watcher{
+		opt:     opt,
+		changed: map[string]struct{}{},
+		wake:    make(chan struct{}, 1),
+	}
+
+	// Start watching before the first run so no changes are missed
+	for _, f := range []fs.Fs{fs1, fs2} {
+		if err := w.start(ctx, f); err != nil {
+			return err
+		}
+	}
+	if err := Bisync(ctx, fs1, fs2, opt); err != nil {
+		return err
+	}
+
+	passOpt := *opt
+	passOpt.Resync = false
+	passOpt.ResyncMode = PreferNone
+	lockFile := watchLockFile(ctx, fs1, fs2, opt)
+	delay := time.Duration(opt.WatchDelay)
+	// Don't wait longer than this after the first pending change for
+	// the changes to settle, otherwise a steady stream of changes
+	// would never be synced.
+	maxDelay := max(time.Duration(opt.WatchInterval), delay)
+	var first time.Time // time of the first pending change if set
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	fs.Infoc(nil, Color(terminal.GreenFg, "Watching for changes"))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.wake:
+			if first.IsZero() {
+				first = time.Now()
+			}
+			timer.Reset(min(delay, maxDelay-time.Since(first)))
+			continue
+		case <-timer.C:
+		}
+		first = time.Time{}
+		changed := w.take()
+		if len(changed) == 0 {
+			continue
+		}
+		if lockFile != "" && bilib.FileExists(lockFile) {
+			fs.Infof(nil, "Lock file %s found - postponing sync of %d changed paths", lockFile, len(changed))
+			w.requeue(changed)
+			timer.Reset(time.Duration(opt.WatchInterval))
+			continue
+		}
+		// errors from earlier passes would abort this one
+		accounting.Stats(ctx).ResetErrors()
+		passOpt.changed = changed
+		if changed[0] == "" {
+			// everything has changed so do a full run
+			passOpt.changed = nil
+		}
+		err := Bisync(ctx, fs1, fs2, &passOpt)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, ErrBisyncAborted):
+			return err
+		default:
+			fs.Errorf(nil, "Bisync of changed paths failed, will retry: %v", err)
+			w.requeue(changed)
+			timer.Reset(time.Duration(opt.WatchInterval))
+		}
+	}
+}
+
+// watchLockFile returns the name of the lock file bisync uses for
+// fs1 and fs2 or "" if there isn't one
+func watchLockFile(ctx context.Context, fs1, fs2 fs.Fs, opt *Options) string {
+	if opt.DryRun {
+		return ""
+	}
+	workDir := opt.Workdir
+	if workDir == "" {
+		workDir = DefaultWorkdir
+	}
+	workDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return ""
+	}
+	return bilib.BasePath(ctx, workDir, fs1, fs2) + ".lck"
+}
+
+// start starts receiving change notifications for f
+func (w *watcher) start(ctx context.Context, f fs.Fs) error {
+	notify := func(remote string, entryType fs.EntryType) {
+		fs.Debugf(f, "Change detected: %q", remote)
+		w.add(remote)
+	}
+	if changeNotify := f.Features().ChangeNotify; changeNotify != nil {
+		pollInterval := make(chan time.Duration, 1)
+		pollInterval <- time.Duration(w.opt.WatchInterval)
+		changeNotify(ctx, notify, pollInterval)
+		go func() {
+			<-ctx.Done()
+			close(pollInterval)
+		}()
+		return nil
+	}
+	if f.Features().IsLocal {
+		return localChangeNotify(ctx, filepath.FromSlash(f.Root()), notify)
+	}
+	return fmt.Errorf("--watch needs change notifications which %v doesn't support", f)
+}
+
+// add adds changed paths
+func (w *watcher) add(paths ...string) {
+	w.mu.Lock()
+	for _, p := range paths {
+		w.changed[p] = struct{}{}
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// requeue adds back paths which couldn't be synced without waking
+// the watcher so they are retried after --watch-interval
+func (w *watcher) requeue(paths []string) {
+	w.mu.Lock()
+	for _, p := range paths {
+		w.changed[p] = struct{}{}
+	}
+	w.mu.Unlock()
+}
+
+// take removes and returns the changed paths sorted with any paths
+// inside other changed paths removed
+func (w *watcher) take() (changed []string) {
+	w.mu.Lock()
+	for p := range w.changed {
+		changed = append(changed, p)
+	}
+	w.changed = map[string]struct{}{}
+	w.mu.Unlock()
+	sort.Strings(changed)
+	out := changed[:0]
+	for _, p := range changed {
+		if isChanged(p, out) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// isInside returns true if file is dir or inside it
+func isInside(file, dir string) bool {
+	return dir == "" || file == dir || strings.HasPrefix(file, dir+"/")
+}
+
+// isChanged returns true if file is inside any of the changed paths
+func isChanged(file string, changed []string) bool {
+	i := sort.SearchStrings(changed, file)
+	if i < len(changed) && changed[i] == file {
+		return true
+	}
+	// any changed dir containing file sorts before it
+	for _, dir := range changed[:i] {
+		if isInside(file, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// makeWatchListing builds the listings for an incremental --watch pass.
+//
+// Only the changed paths are listed again, the entries for everything
+// else are taken from the prior listings.
+func (b *bisyncRun) makeWatchListing(ctx context.Context) (*fileList, *fileList, error) {
+	b.march.marchCtx = ctx
+	b.setupListing()
+	changed := b.opt.changed
+	for _, side := range []struct {
+		f       fs.Fs
+		listing string
+		isPath1 bool
+	}{
+		{b.fs1, b.listing1, true},
+		{b.fs2, b.listing2, false},
+	} {
+		old, err := b.loadListing(side.listing)
+		if err != nil {
+			b.critical = true
+			b.retryable = true
+			return b.march.ls1, b.march.ls2, fmt.Errorf("failed to load prior %s listing: %w", whichPath(side.isPath1), err)
+		}
+		ls := b.whichLs(side.isPath1)
+		for _, file := range old.list {
+			if !isChanged(file, changed) {
+				old.getPut(file, ls)
+			}
+		}
+		if err = b.relistChanged(ctx, side.f, side.isPath1); err == nil {
+			err = b.march.firstErr
+		}
+		if err != nil {
+			b.handleErr("watch", "error listing changed paths", err, true, true)
+			b.abort = true
+			return b.march.ls1, b.march.ls2, err
+		}
+	}
+
+	b.march.err = b.march.ls1.save(b.newListing1)
+	b.handleErr(b.march.ls1, "error saving b.march.ls1 from watch", b.march.err, true, true)
+	b.march.err = b.march.ls2.save(b.newListing2)
+	b.handleErr(b.march.ls2, "error saving b.march.ls2 from watch", b.march.err, true, true)
+
+	return b.march.ls1, b.march.ls2, b.march.err
+}
+
+// relistChanged adds the changed paths which exist on f to its listing
+func (b *bisyncRun) relistChanged(ctx context.Context, f fs.Fs, isPath1 bool) error {
+	fi := filter.GetConfig(ctx)
+	includeDir := fi.IncludeDirectory(ctx, f)
+
+	// List each parent directory once to find the changed entries
+	byParent := map[string]map[string]struct{}{}
+	for _, p := range b.opt.changed {
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		if byParent[parent] == nil {
+			byParent[parent] = map[string]struct{}{}
+		}
+		byParent[parent][p] = struct{}{}
+	}
+	for parent, names := range byParent {
+		include, err := includeParents(parent, includeDir)
+		if err != nil {
+			return err
+		}
+		if !include {
+			continue
+		}
+		entries, err := f.List(ctx, parent)
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if _, ok := names[entry.Remote()]; !ok {
+				continue
+			}
+			switch x := entry.(type) {
+			case fs.Object:
+				if fi.IncludeObject(ctx, x) {
+					b.ForObject(x, isPath1)
+				}
+			case fs.Directory:
+				if include, err = includeDir(x.Remote()); err != nil {
+					return err
+				} else if !include {
+					continue
+				}
+				b.parse(x, isPath1)
+				err = walk.ListR(ctx, f, x.Remote(), false, -1, walk.ListAll, func(entries fs.DirEntries) error {
+					for _, entry := range entries {
+						b.parse(entry, isPath1)
+					}
+					return nil
+				})
+				if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// includeParents checks that dir and all of its parents are included
+// by the filters
+func includeParents(dir string, includeDir func(string) (bool, error)) (bool, error) {
+	for dir != "" {
+		include, err := includeDir(dir)
+		if err != nil || !include {
+			return false, err
+		}
+		dir = path.Dir(dir)
+		if dir == "." {
+			dir = ""
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,170 @@
+//go:build linux
+
+package bisync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	rfs "github.com/rclone/rclone/fs"
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_ATTRIB | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF |
+	unix.IN_MOVE_SELF | unix.IN_ONLYDIR | unix.IN_EXCL_UNLINK
+
+// inotifyWatcher watches a local directory tree with inotify
+type inotifyWatcher struct {
+	file   *os.File
+	fd     int
+	root   string
+	dirs   map[int32]string // watch descriptor to directory relative to root
+	notify func(string, rfs.EntryType)
+}
+
+// localChangeNotify watches the local directory root and everything
+// below it calling notify with the changed paths relative to root
+// until ctx is cancelled.
+func localChangeNotify(ctx context.Context, root string, notify func(string, rfs.EntryType)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to start inotify: %w", err)
+	}
+	w := &inotifyWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		root:   root,
+		dirs:   map[int32]string{},
+		notify: notify,
+	}
+	if err := w.addTree(""); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = w.file.Close()
+	}()
+	go w.run()
+	return nil
+}
+
+// addTree adds watches for the directory dir and all the directories
+// below it
+func (w *inotifyWatcher) addTree(dir string) error {
+	start := filepath.Join(w.root, filepath.FromSlash(dir))
+	return filepath.WalkDir(start, func(osPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if osPath == start {
+				return err
+			}
+			// the directory may have been removed while we walked it
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, osPath, inotifyMask)
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf("failed to watch %q: too many inotify watches - increase fs.inotify.max_user_watches: %w", osPath, err)
+		} else if err != nil {
+			if osPath == start {
+				return fmt.Errorf("failed to watch %q: %w", osPath, err)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, osPath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		w.dirs[int32(wd)] = filepath.ToSlash(rel)
+		return nil
+	})
+}
+
+// removeTree removes the watches for dir and the directories below it
+func (w *inotifyWatcher) removeTree(dir string) {
+	for wd, d := range w.dirs {
+		if isInside(d, dir) {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// run reads events until the inotify file is closed
+func (w *inotifyWatcher) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				rfs.Errorf(w.root, "Failed to read inotify events: %v", err)
+			}
+			return
+		}
+		for b := buf[:n]; len(b) >= unix.SizeofInotifyEvent; {
+			wd := int32(binary.NativeEndian.Uint32(b[0:]))
+			mask := binary.NativeEndian.Uint32(b[4:])
+			nameLen := int(binary.NativeEndian.Uint32(b[12:]))
+			b = b[unix.SizeofInotifyEvent:]
+			if nameLen > len(b) {
+				break
+			}
+			name := string(bytes.TrimRight(b[:nameLen], "\x00"))
+			b = b[nameLen:]
+			w.handle(wd, mask, name)
+		}
+	}
+}
+
+// handle a single inotify event
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		// events were lost so everything may have changed
+		w.notify("", rfs.EntryDirectory)
+		return
+	}
+	dir, ok := w.dirs[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return
+	}
+	if !ok {
+		return
+	}
+	if name == "" {
+		// events on the watched directory itself are reported
+		// by its parent apart from for the root
+		if dir == "" && mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+			rfs.Errorf(w.root, "Watched directory was removed")
+			w.notify("", rfs.EntryDirectory)
+		}
+		return
+	}
+	p := path.Join(dir, name)
+	entryType := rfs.EntryObject
+	if mask&unix.IN_ISDIR != 0 {
+		entryType = rfs.EntryDirectory
+		if mask&unix.IN_MOVED_FROM != 0 {
+			w.removeTree(p)
+		}
+		if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			if err := w.addTree(p); err != nil {
+				rfs.Errorf(w.root, "%v", err)
+			}
+		}
+	}
+	w.notify(p, entryType)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package bisync
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// localChangeNotify isn't supported on this OS
+func localChangeNotify(ctx context.Context, root string, notify func(string, fs.EntryType)) error {
+	return errors.New("--watch isn't supported for local paths on this OS")
+}
@@ -0,0 +1,150 @@
+package bisync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/bisync"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWatch checks that --watch syncs changes made on either side
+func TestWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("--watch of local paths needs inotify")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir1, "file1.txt"), []byte("one"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir2, "file2.txt"), []byte("two"), 0666))
+	fs1, err := fs.NewFs(ctx, dir1)
+	require.NoError(t, err)
+	fs2, err := fs.NewFs(ctx, dir2)
+	require.NoError(t, err)
+
+	opt := bisync.Options{
+		Resync:        true,
+		Workdir:       t.TempDir(),
+		MaxDelete:     100,
+		WatchDelay:    fs.Duration(100 * time.Millisecond),
+		WatchInterval: fs.Duration(time.Second),
+	}
+	done := make(chan error)
+	go func() {
+		done <- bisync.Watch(ctx, fs1, fs2, &opt)
+	}()
+
+	hasContents := func(name, want string) func() bool {
+		return func() bool {
+			got, err := os.ReadFile(name)
+			return err == nil && string(got) == want
+		}
+	}
+	isMissing := func(name string) func() bool {
+		return func() bool {
+			_, err := os.Stat(name)
+			return os.IsNotExist(err)
+		}
+	}
+	const waitFor, tick = 10 * time.Second, 50 * time.Millisecond
+
+	// initial resync
+	assert.Eventually(t, hasContents(filepath.Join(dir2, "file1.txt"), "one"), waitFor, tick)
+	assert.Eventually(t, hasContents(filepath.Join(dir1, "file2.txt"), "two"), waitFor, tick)
+
+	// new file in a new directory on Path1
+	require.NoError(t, os.MkdirAll(filepath.Join(dir1, "sub", "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir1, "sub", "dir", "file3.txt"), []byte("three"), 0666))
+	assert.Eventually(t, hasContents(filepath.Join(dir2, "sub", "dir", "file3.txt"), "three"), waitFor, tick)
+
+	// changed file on Path2
+	require.NoError(t, os.WriteFile(filepath.Join(dir2, "file1.txt"), []byte("one changed"), 0666))
+	assert.Eventually(t, hasContents(filepath.Join(dir1, "file1.txt"), "one changed"), waitFor, tick)
+
+	// deleted file on Path1
+	require.NoError(t, os.Remove(filepath.Join(dir1, "file2.txt")))
+	assert.Eventually(t, isMissing(filepath.Join(dir2, "file2.txt")), waitFor, tick)
+
+	// renamed directory on Path2
+	require.NoError(t, os.Rename(filepath.Join(dir2, "sub"), filepath.Join(dir2, "moved")))
+	assert.Eventually(t, hasContents(filepath.Join(dir1, "moved", "dir", "file3.txt"), "three"), waitFor, tick)
+	assert.Eventually(t, isMissing(filepath.Join(dir1, "sub", "dir", "file3.txt")), waitFor, tick)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(waitFor):
+		t.Fatal("timed out waiting for Watch to return")
+	}
+}
+
+// TestWatchContinuousChanges checks that --watch syncs changes even
+// if they never settle for --watch-delay
+func TestWatchContinuousChanges(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("--watch of local paths needs inotify")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir1, "file1.txt"), []byte("one"), 0666))
+	fs1, err := fs.NewFs(ctx, dir1)
+	require.NoError(t, err)
+	fs2, err := fs.NewFs(ctx, dir2)
+	require.NoError(t, err)
+
+	opt := bisync.Options{
+		Resync:        true,
+		Workdir:       t.TempDir(),
+		MaxDelete:     100,
+		WatchDelay:    fs.Duration(100 * time.Millisecond),
+		WatchInterval: fs.Duration(500 * time.Millisecond),
+	}
+	done := make(chan error)
+	go func() {
+		done <- bisync.Watch(ctx, fs1, fs2, &opt)
+	}()
+
+	// Keep changing a file on Path1 much more often than --watch-delay
+	stop := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			_ = os.WriteFile(filepath.Join(dir1, "busy.txt"), []byte(time.Now().String()), 0666)
+			if i == 0 {
+				require.NoError(t, os.WriteFile(filepath.Join(dir1, "file.txt"), []byte("synced"), 0666))
+			}
+		}
+	}()
+
+	assert.Eventually(t, func() bool {
+		got, err := os.ReadFile(filepath.Join(dir2, "file.txt"))
+		return err == nil && string(got) == "synced"
+	}, 10*time.Second, 50*time.Millisecond)
+
+	close(stop)
+	<-writerDone
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for Watch to return")
+	}
+}
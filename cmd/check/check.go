@@ -145,6 +145,11 @@ For the [crypt](/crypt/) remote there is a dedicated command,
 [cryptcheck](/commands/rclone_cryptcheck/), that are able to check
 the checksums of the encrypted files.
 
+If a file has no hash in common with the other side, but has a
+composite hash, such as the ETag of an S3 multipart upload, and the
+other side is on the local disk, then the composite hash will be
+calculated from the local file and compared.
+
 If you supply the |--size-only| flag, it will only compare the sizes not
 the hashes as well.  Use this for a quick check.
 
@@ -22,6 +22,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config/configfile"
 	"github.com/rclone/rclone/fs/config/configflags"
@@ -31,6 +32,7 @@ import (
 	"github.com/rclone/rclone/fs/fspath"
 	fslog "github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
 	"github.com/rclone/rclone/fs/rc/rcserver"
 	fssync "github.com/rclone/rclone/fs/sync"
 	"github.com/rclone/rclone/lib/atexit"
@@ -241,6 +243,7 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	ctx := context.Background()
 	ci := fs.GetConfig(ctx)
 	var cmdErr error
+	audit.SetCommand(cmd.CommandPath())
 	stopStats := func() {}
 	if !showStats && ShowStats() {
 		showStats = true
@@ -251,6 +254,7 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 		stopStats = StartStats()
 	}
 	SigInfoHandler()
+	notifyFinish := jobs.NotifyCommand(ctx, cmd.CommandPath())
 	for try := 1; try <= ci.Retries; try++ {
 		cmdErr = f()
 		cmdErr = fs.CountError(ctx, cmdErr)
@@ -326,6 +330,7 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	if lastErr := accounting.GlobalStats().GetLastError(); cmdErr == nil {
 		cmdErr = lastErr
 	}
+	notifyFinish(cmdErr)
 
 	// Log the final error message and exit
 	if cmdErr != nil {
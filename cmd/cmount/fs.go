@@ -606,6 +606,8 @@ func translateError(err error) (errc int) {
 		return -fuse.EINVAL
 	case vfs.ELOOP:
 		return -fuse.ELOOP
+	case vfs.ENOSPC:
+		return -fuse.ENOSPC
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return -fuse.EIO
@@ -65,8 +65,52 @@ This is used by adding the tag into the transform name like this:
 For some conversions using all is more likely to be useful, for example
 ¡--name-transform all,nfc¡.
 
-Note that ¡--name-transform¡ may not add path separators ¡/¡ to the name.
-This will cause an error.
+Note that ¡--name-transform¡ may not add path separators ¡/¡ to the name,
+except with ¡template¡ as described below. This will cause an error.
+
+### Templates
+
+The ¡template¡ transform replaces the name with the output of a [Go
+template](https://pkg.go.dev/text/template) which can use information
+about the object being transferred as well as its name. For example
+this organises photos into directories by year and month of their
+modification time:
+
+¡¡¡console
+rclone copy --name-transform "template={{.ModTime.Year}}/{{.ModTime.Format \"01\"}}/{{.Name}}" /photos remote:photos
+¡¡¡
+
+The template may use these fields
+
+| Field | Value |
+|------|------|
+| ¡{{.Name}}¡ | The name being transformed, e.g. ¡file.jpg¡ |
+| ¡{{.Base}}¡ | The name without its extension, e.g. ¡file¡ |
+| ¡{{.Ext}}¡ | The extension of the name, e.g. ¡.jpg¡ |
+| ¡{{.Dir}}¡ | The directory of the path, e.g. ¡path/to¡ |
+| ¡{{.Path}}¡ | The whole path, e.g. ¡path/to/file.jpg¡ |
+| ¡{{.ModTime}}¡ | The modification time in the local time zone |
+| ¡{{.Size}}¡ | The size in bytes |
+| ¡{{.Hash "md5"}}¡ | The hash named, if supported by the remote |
+| ¡{{.MimeType}}¡ | The MIME type |
+| ¡{{.Metadata}}¡ | The [metadata](/docs/#metadata), e.g. ¡{{index .Metadata "btime"}}¡ |
+
+¡{{.ModTime}}¡ is a Go [time](https://pkg.go.dev/time#Time) so may be
+formatted with e.g. ¡{{.ModTime.Year}}¡ or ¡{{.ModTime.Format "2006-01-02"}}¡.
+The metadata is only available with the ¡--metadata¡/¡-M¡ flag for most
+backends, and a missing key gives an empty string.
+
+The fields other than the names are those of the object being
+transferred, so are only available in ¡sync¡, ¡copy¡, ¡move¡ and
+¡convmv¡. Using them elsewhere is an error. Reading a hash may mean
+reading the whole file on some backends.
+
+When transforming file names (the default ¡file¡ tag) a template may
+add directories, but only if there is a ¡/¡ in the template itself. As
+rclone can then no longer find these files by listing the matching
+directories, it looks them up one at a time. Templates like this can
+be used with ¡copy¡ and ¡move¡ but not with ¡sync¡ as it would delete
+the files in the new directories.
 
 ### Ordering and Conflicts
 
@@ -78,6 +78,7 @@ The vfsOpt are as described in options/get and can be seen in the
 rclone rc options/get
 ` + "```" + `
 `,
+		RemoteParams: map[string]string{"mountPoint": ""},
 	})
 }
 
@@ -164,6 +165,7 @@ Example:
 
     rclone rc mount/unmount mountPoint=/home/<user>/mountPoint
 `,
+		RemoteParams: map[string]string{"mountPoint": ""},
 	})
 }
 
@@ -55,4 +55,13 @@ func TestMount(t *testing.T) {
 			vfstest.RunTests(t, false, vfscommon.CacheModeWrites, false, mount)
 		})
 	}
+	t.Run("v4", func(t *testing.T) {
+		nfs.Opt.Version = 4
+		_ = os.Setenv("RCLONE_NFS_VERSION", "4")
+		t.Cleanup(func() {
+			nfs.Opt.Version = 3
+			_ = os.Unsetenv("RCLONE_NFS_VERSION")
+		})
+		vfstest.RunTests(t, false, vfscommon.CacheModeWrites, false, mount)
+	})
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/rcserver"
+	"github.com/rclone/rclone/fs/rc/schedule"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/spf13/cobra"
@@ -30,6 +31,9 @@ If you pass in a path to a directory, rclone will serve that directory
 for GET requests on the URL passed in.  It will also open the URL in
 the browser when rclone is run.
 
+It also runs the jobs added with the schedule/add rc command, which
+other rclone commands run with ` + "`--rc`" + ` don't.
+
 See the [rc documentation](/rc/) for more info on the rc flags.
 
 ` + strings.TrimSpace(libhttp.Help(rcflags.FlagPrefix)+libhttp.TemplateHelp(rcflags.FlagPrefix)+libhttp.AuthHelp(rcflags.FlagPrefix)),
@@ -57,6 +61,9 @@ See the [rc documentation](/rc/) for more info on the rc flags.
 			fs.Fatal(nil, "rc server not configured")
 		}
 
+		// Only rcd runs the scheduled jobs
+		schedule.Start(context.Background())
+
 		// Notify stopping on exit
 		defer systemd.Notify()()
 
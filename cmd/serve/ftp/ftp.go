@@ -24,6 +24,7 @@ import (
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/config/obscure"
@@ -367,6 +368,12 @@ func (d *driver) getVFS(sctx *ftp.Context) (VFS *vfs.VFS, err error) {
 	return VFS, nil
 }
 
+// auditContext returns a context which records the changes in the
+// audit log against the logged in user
+func auditContext(sctx *ftp.Context) context.Context {
+	return audit.WithActor(sctx, audit.Actor{Type: audit.ActorServe, User: sctx.Sess.LoginUser()})
+}
+
 // Stat get information on file or folder
 func (d *driver) Stat(sctx *ftp.Context, path string) (fi iofs.FileInfo, err error) {
 	defer log.Trace(path, "")("fi=%+v, err = %v", &fi, &err)
@@ -450,11 +457,7 @@ func (d *driver) DeleteDir(sctx *ftp.Context, path string) (err error) {
 	if !node.IsDir() {
 		return errors.New("not a directory")
 	}
-	err = node.Remove()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.RemoveContext(auditContext(sctx), path)
 }
 
 // DeleteFile delete a file
@@ -471,11 +474,7 @@ func (d *driver) DeleteFile(sctx *ftp.Context, path string) (err error) {
 	if !node.IsFile() {
 		return errors.New("not a file")
 	}
-	err = node.Remove()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.RemoveContext(auditContext(sctx), path)
 }
 
 // Rename rename a file or folder
@@ -485,7 +484,7 @@ func (d *driver) Rename(sctx *ftp.Context, oldName, newName string) (err error)
 	if err != nil {
 		return err
 	}
-	return VFS.Rename(oldName, newName)
+	return VFS.RenameContext(auditContext(sctx), oldName, newName)
 }
 
 // MakeDir create a folder
@@ -566,14 +565,15 @@ func (d *driver) PutFile(sctx *ftp.Context, path string, data io.Reader, offset
 
 	var f vfs.Handle
 
+	ctx := auditContext(sctx)
 	if offset == -1 {
 		if isExist {
-			err = VFS.Remove(path)
+			err = VFS.RemoveContext(ctx, path)
 			if err != nil {
 				return 0, err
 			}
 		}
-		f, err = VFS.Create(path)
+		f, err = VFS.OpenFileContext(ctx, path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
 			return 0, err
 		}
@@ -585,7 +585,7 @@ func (d *driver) PutFile(sctx *ftp.Context, path string, data io.Reader, offset
 		return n, nil
 	}
 
-	f, err = VFS.OpenFile(path, os.O_APPEND|os.O_RDWR, 0660)
+	f, err = VFS.OpenFileContext(ctx, path, os.O_APPEND|os.O_RDWR, 0660)
 	if err != nil {
 		return 0, err
 	}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
@@ -27,6 +28,7 @@ import (
 	"github.com/rclone/rclone/fs/rc"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/rclone/rclone/vfs"
 	"github.com/rclone/rclone/vfs/vfscommon"
@@ -46,6 +48,7 @@ type Options struct {
 	HTTP       libhttp.Config
 	Template   libhttp.TemplateConfig
 	DisableZip bool
+	ReadWrite  bool
 }
 
 // DefaultOpt is the default values used for Options
@@ -75,6 +78,7 @@ func init() {
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 	flagSet.BoolVar(&Opt.DisableZip, "disable-zip", false, "Disable zip download of directories")
+	flagSet.BoolVar(&Opt.ReadWrite, "read-write", false, "Allow uploading and deleting files")
 	cmdserve.Command.AddCommand(Command)
 	cmdserve.AddRc("http", func(ctx context.Context, f fs.Fs, in rc.Params) (cmdserve.Handle, error) {
 		// Read VFS Opts
@@ -113,6 +117,32 @@ is served.
 
 The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 
+By default the server is read only. Use ` + "`--read-write`" + ` to allow
+files to be uploaded and deleted. The directory listings will then
+show an upload button and files can also be dropped onto the listing
+to upload them into that directory. Files can be deleted with the
+button next to each file. This can also be used by other clients:
+
+- ` + "`POST`" + ` a ` + "`multipart/form-data`" + ` form to a directory URL (ending
+  in ` + "`/`" + `) to upload the files in it into that directory.
+- ` + "`PUT`" + ` to a file URL to upload the body of the request to that
+  file, making any parent directories needed.
+- ` + "`DELETE`" + ` a file URL to delete the file, or an empty directory
+  URL to remove the directory.
+
+Existing files are overwritten. Each upload is written to a temporary
+file next to it and renamed into place when complete, so a failed
+upload leaves any existing file alone. Uploads are written through the VFS,
+so the ` + "`--vfs-cache-mode`" + ` flags apply to them. Use the
+authentication flags to control who can upload.
+
+Requests which change files are rejected if a browser says they came
+from a different web site, using the ` + "`Sec-Fetch-Site`" + ` or ` + "`Origin`" + `
+headers, so other sites can't change files using the login of someone
+viewing them. Requests from the origin set with ` + "`--allow-origin`" + ` are
+allowed. Clients which aren't browsers don't send these headers so
+aren't affected.
+
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
 
@@ -176,6 +206,15 @@ func (s *HTTP) auth(user, pass string) (value any, err error) {
 	return VFS, err
 }
 
+// tokenAuth does proxy authorization for bearer tokens
+func (s *HTTP) tokenAuth(user string, claims map[string]any) (value any, err error) {
+	VFS, _, err := s.proxy.CallWithClaims(user, claims)
+	if err != nil {
+		return nil, err
+	}
+	return VFS, err
+}
+
 func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (s *HTTP, err error) {
 	s = &HTTP{
 		f:   f,
@@ -187,6 +226,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
 		// override auth
 		s.opt.Auth.CustomAuthFn = s.auth
+		s.opt.Auth.CustomTokenAuthFn = s.tokenAuth
 	} else {
 		s._vfs = vfs.New(f, vfsOpt)
 	}
@@ -209,6 +249,20 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	router.Get("/favicon.ico", s.serveFavicon)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.ReadWrite {
+		// Stop other web sites using the browser of a logged in
+		// user to change files
+		csrf := http.NewCrossOriginProtection()
+		if origin := s.opt.HTTP.AllowOrigin; origin != "" && origin != "*" {
+			if err := csrf.AddTrustedOrigin(origin); err != nil {
+				return nil, fmt.Errorf("bad --allow-origin: %w", err)
+			}
+		}
+		writer := router.With(csrf.Handler)
+		writer.Post("/*", s.serveUpload)
+		writer.Put("/*", s.servePut)
+		writer.Delete("/*", s.serveDelete)
+	}
 
 	return s, nil
 }
@@ -328,6 +382,7 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 	w.Header().Set("Last-Modified", dir.ModTime().UTC().Format(http.TimeFormat))
 
 	directory.DisableZip = s.opt.DisableZip
+	directory.ReadWrite = s.opt.ReadWrite
 
 	directory.Serve(w, r)
 }
@@ -420,3 +475,190 @@ func (s *HTTP) serveFile(w http.ResponseWriter, r *http.Request, remote string)
 	}
 
 }
+
+// writeError reports an error from a write to remote, mapping VFS
+// errors to HTTP statuses where possible
+func writeError(ctx context.Context, remote string, w http.ResponseWriter, text string, err error) {
+	switch {
+	case errors.Is(err, vfs.ENOENT):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		http.Error(w, "Read only file system", http.StatusForbidden)
+	case errors.Is(err, vfs.ENOTEMPTY):
+		http.Error(w, "Directory not empty", http.StatusConflict)
+	default:
+		serve.Error(ctx, remote, w, text, err)
+	}
+}
+
+// writeFile writes in to the file at remote, replacing it if it
+// exists. It returns whether the file was created.
+//
+// The file is written to a temporary name and renamed into place when
+// complete so a failed upload leaves any existing file alone.
+func writeFile(ctx context.Context, VFS *vfs.VFS, remote string, in io.Reader) (created bool, err error) {
+	_, err = VFS.Stat(remote)
+	created = err == vfs.ENOENT
+	tmpRemote := fmt.Sprintf("%s.%s.partial", remote, random.String(8))
+	fd, err := VFS.OpenFileContext(ctx, tmpRemote, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return created, err
+	}
+	_, err = io.Copy(fd, in)
+	closeErr := fd.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = VFS.RenameContext(ctx, tmpRemote, remote)
+	}
+	if err != nil {
+		// Don't leave a partial file behind
+		_ = VFS.RemoveContext(ctx, tmpRemote)
+	}
+	return created, err
+}
+
+// validLeaf returns true if leaf can be used as the name of an
+// uploaded file
+func validLeaf(leaf string) bool {
+	return leaf != "" && leaf != "." && leaf != ".." && !strings.ContainsAny(leaf, "/\\")
+}
+
+// serveUpload saves the files in a multipart form posted to a directory
+func (s *HTTP) serveUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Can only upload to a directory", http.StatusMethodNotAllowed)
+		return
+	}
+	dirRemote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to upload: %v", err)
+		return
+	}
+	node, err := VFS.Stat(dirRemote)
+	if err == vfs.ENOENT || (err == nil && !node.IsDir()) {
+		http.Error(w, "Directory not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		serve.Error(ctx, dirRemote, w, "Failed to find directory", err)
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expecting a multipart/form-data upload", http.StatusBadRequest)
+		return
+	}
+	var uploaded int
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			fs.Errorf(dirRemote, "%s: Failed to read upload: %v", r.RemoteAddr, err)
+			return
+		}
+		leaf := part.FileName()
+		if leaf == "" {
+			// Not a file so ignore it
+			continue
+		}
+		if !validLeaf(leaf) {
+			http.Error(w, "Invalid file name", http.StatusBadRequest)
+			return
+		}
+		remote := path.Join(dirRemote, leaf)
+		fs.Infof(remote, "%s: Uploading file", r.RemoteAddr)
+		_, err = writeFile(ctx, VFS, remote, part)
+		if err != nil {
+			writeError(ctx, remote, w, "Failed to upload file", err)
+			return
+		}
+		uploaded++
+	}
+	if uploaded == 0 {
+		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+	// Send browsers back to the directory listing
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, s.redirectURL(r.URL.Path), http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintf(w, "Uploaded %d files\n", uploaded)
+}
+
+// redirectURL returns the URL for urlPath with the --baseurl which
+// was stripped from the request added back
+func (s *HTTP) redirectURL(urlPath string) string {
+	baseURL := strings.Trim(s.opt.HTTP.BaseURL, "/")
+	if baseURL != "" {
+		urlPath = "/" + baseURL + urlPath
+	}
+	return (&url.URL{Path: urlPath}).EscapedPath()
+}
+
+// servePut saves the body of the request to a file
+func (s *HTTP) servePut(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	remote := strings.Trim(r.URL.Path, "/")
+	if strings.HasSuffix(r.URL.Path, "/") || remote == "" {
+		http.Error(w, "Can only PUT to a file", http.StatusMethodNotAllowed)
+		return
+	}
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to upload: %v", err)
+		return
+	}
+	node, err := VFS.Stat(remote)
+	if err == nil && node.IsDir() {
+		http.Error(w, "Can't overwrite a directory", http.StatusConflict)
+		return
+	}
+	err = VFS.MkdirAll(path.Dir(remote), 0777)
+	if err != nil {
+		writeError(ctx, remote, w, "Failed to make directory", err)
+		return
+	}
+	fs.Infof(remote, "%s: Uploading file", r.RemoteAddr)
+	created, err := writeFile(ctx, VFS, remote, r.Body)
+	if err != nil {
+		writeError(ctx, remote, w, "Failed to upload file", err)
+		return
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// serveDelete deletes a file or an empty directory
+func (s *HTTP) serveDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	remote := strings.Trim(r.URL.Path, "/")
+	if remote == "" {
+		http.Error(w, "Can't delete the root", http.StatusForbidden)
+		return
+	}
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to delete: %v", err)
+		return
+	}
+	fs.Infof(remote, "%s: Deleting", r.RemoteAddr)
+	err = VFS.RemoveContext(ctx, remote)
+	if err != nil {
+		writeError(ctx, remote, w, "Failed to delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
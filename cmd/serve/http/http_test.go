@@ -1,11 +1,13 @@
 package http
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"flag"
 	"io"
 	stdfs "io/fs"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -36,7 +38,7 @@ const (
 	testTemplate    = "testdata/golden/testindex.html"
 )
 
-func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string) {
+func start(ctx context.Context, t *testing.T, f fs.Fs, setOpts ...func(*Options)) (s *HTTP, testURL string) {
 	opts := Options{
 		HTTP: libhttp.DefaultCfg(),
 		Template: libhttp.TemplateConfig{
@@ -48,6 +50,9 @@ func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string)
 		opts.Auth.BasicUser = testUser
 		opts.Auth.BasicPass = testPass
 	}
+	for _, setOpt := range setOpts {
+		setOpt(&opts)
+	}
 
 	s, err := newServer(ctx, f, &opts, &vfscommon.Opt, &proxy.Opt)
 	require.NoError(t, err, "failed to start server")
@@ -414,3 +419,218 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+func TestReadWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing.txt"), []byte("existing"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	s, testURL := start(ctx, t, f, func(opt *Options) {
+		opt.ReadWrite = true
+		opt.Template = libhttp.TemplateConfig{} // use the built in template
+	})
+	defer func() { assert.NoError(t, s.server.Shutdown()) }()
+
+	do := func(method, path, contentType string, body io.Reader) (status int, respBody string) {
+		req, err := http.NewRequest(method, testURL+path, body)
+		require.NoError(t, err)
+		req.SetBasicAuth(testUser, testPass)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	readFile := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// The listing should have the upload form
+	status, body := do("GET", "", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `<form id="upload"`)
+
+	// Upload two files with a form
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	require.NoError(t, mw.WriteField("ignored", "not a file"))
+	for name, contents := range map[string]string{"one.txt": "one", "existing.txt": "replaced"} {
+		fw, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	status, body = do("POST", "", mw.FormDataContentType(), &buf)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "Uploaded 2 files\n", body)
+	assert.Equal(t, "one", readFile("one.txt"))
+	assert.Equal(t, "replaced", readFile("existing.txt"))
+
+	// Can't upload to a file or a missing directory
+	status, _ = do("POST", "one.txt", mw.FormDataContentType(), strings.NewReader(""))
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+	status, _ = do("POST", "notfound/", mw.FormDataContentType(), strings.NewReader(""))
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// PUT makes the directories needed
+	status, _ = do("PUT", "sub/dir/two.txt", "", strings.NewReader("two"))
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "two", readFile("sub/dir/two.txt"))
+	status, _ = do("PUT", "sub/dir/two.txt", "", strings.NewReader("two again"))
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, "two again", readFile("sub/dir/two.txt"))
+	status, _ = do("PUT", "sub/", "", strings.NewReader("dir"))
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// A failed PUT leaves the existing file alone
+	req, err := http.NewRequest("PUT", testURL+"sub/dir/two.txt", strings.NewReader("trunc"))
+	require.NoError(t, err)
+	req.SetBasicAuth(testUser, testPass)
+	req.ContentLength = 100
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(filepath.Join(dir, "sub/dir"))
+		return err == nil && len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond, "partial file not removed")
+	assert.Equal(t, "two again", readFile("sub/dir/two.txt"))
+
+	// DELETE files and empty directories
+	status, _ = do("DELETE", "sub/dir/", "", nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = do("DELETE", "sub/dir/two.txt", "", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoFileExists(t, filepath.Join(dir, "sub/dir/two.txt"))
+	status, _ = do("DELETE", "sub/dir/", "", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoDirExists(t, filepath.Join(dir, "sub/dir"))
+	status, _ = do("DELETE", "notfound.txt", "", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestReadWriteBaseURL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub dir"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	s, testURL := start(ctx, t, f, func(opt *Options) {
+		opt.ReadWrite = true
+		opt.HTTP.BaseURL = "/prefix/"
+	})
+	defer func() { assert.NoError(t, s.server.Shutdown()) }()
+	require.True(t, strings.HasSuffix(testURL, "/prefix/"), testURL)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", "one.txt")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("one"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	req, err := http.NewRequest("POST", testURL+"sub%20dir/", &buf)
+	require.NoError(t, err)
+	req.SetBasicAuth(testUser, testPass)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Accept", "text/html")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	// Browsers are sent back to the directory including the base URL
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "/prefix/sub%20dir/", resp.Header.Get("Location"))
+	data, err := os.ReadFile(filepath.Join(dir, "sub dir", "one.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(data))
+}
+
+func TestReadWriteCrossOrigin(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	s, testURL := start(ctx, t, f, func(opt *Options) {
+		opt.ReadWrite = true
+		opt.HTTP.AllowOrigin = "https://trusted.example.com"
+	})
+	defer func() { assert.NoError(t, s.server.Shutdown()) }()
+
+	do := func(method, path string, headers map[string]string) int {
+		req, err := http.NewRequest(method, testURL+path, strings.NewReader("data"))
+		require.NoError(t, err)
+		req.SetBasicAuth(testUser, testPass)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Requests from other sites are rejected
+	for _, method := range []string{"POST", "PUT", "DELETE"} {
+		status := do(method, "file.txt", map[string]string{"Sec-Fetch-Site": "cross-site"})
+		assert.Equal(t, http.StatusForbidden, status, method)
+		status = do(method, "file.txt", map[string]string{"Origin": "https://evil.example.com"})
+		assert.Equal(t, http.StatusForbidden, status, method)
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "file.txt"))
+
+	// Requests from the same site, the trusted origin and non
+	// browsers are allowed
+	status := do("PUT", "file.txt", map[string]string{"Sec-Fetch-Site": "same-origin"})
+	assert.Equal(t, http.StatusCreated, status)
+	status = do("PUT", "file.txt", map[string]string{"Origin": "https://trusted.example.com"})
+	assert.Equal(t, http.StatusNoContent, status)
+	status = do("DELETE", "file.txt", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoFileExists(t, filepath.Join(dir, "file.txt"))
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	s, testURL := start(ctx, t, f, func(opt *Options) {
+		opt.Template = libhttp.TemplateConfig{}
+	})
+	defer func() { assert.NoError(t, s.server.Shutdown()) }()
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		req, err := http.NewRequest(method, testURL+"file.txt", strings.NewReader("data"))
+		require.NoError(t, err)
+		req.SetBasicAuth(testUser, testPass)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode, method)
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "file.txt"))
+
+	req, err := http.NewRequest("GET", testURL, nil)
+	require.NoError(t, err)
+	req.SetBasicAuth(testUser, testPass)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.NotContains(t, string(body), `<form id="upload"`)
+}
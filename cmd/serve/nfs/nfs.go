@@ -1,6 +1,7 @@
 //go:build unix
 
-// Package nfs implements a server to serve a VFS remote over the NFSv3 protocol
+// Package nfs implements a server to serve a VFS remote over the NFSv3
+// or NFSv4 protocols
 //
 // There is no authentication available on this server and it is
 // served on the loopback interface by default.
@@ -43,6 +44,10 @@ var OptionsInfo = fs.Options{{
 	Name:    "nfs_cache_dir",
 	Default: "",
 	Help:    "The directory the NFS handle cache will use if set",
+}, {
+	Name:    "nfs_version",
+	Default: 3,
+	Help:    "NFS protocol version to serve, 3 or 4",
 }}
 
 func init() {
@@ -73,6 +78,7 @@ type Options struct {
 	HandleLimit    int         `config:"nfs_cache_handle_limit"` // max file handles cached by go-nfs CachingHandler
 	HandleCache    handleCache `config:"nfs_cache_type"`         // what kind of handle cache to use
 	HandleCacheDir string      `config:"nfs_cache_dir"`          // where the handle cache should be stored
+	Version        int         `config:"nfs_version"`            // NFS protocol version to serve
 }
 
 // Opt is the default set of serve nfs options
@@ -126,7 +132,8 @@ var Command = &cobra.Command{
 	Short: `Serve the remote as an NFS mount`,
 	Long: strings.ReplaceAll(`Create an NFS server that serves the given remote over the network.
 
-This implements an NFSv3 server to serve any rclone remote via NFS.
+This implements an NFSv3 server, or with |--nfs-version 4| an NFSv4.0
+and NFSv4.1 server, to serve any rclone remote via NFS.
 
 The primary purpose for this command is to enable the [mount
 command](/commands/rclone_mount/) on recent macOS versions where
@@ -194,6 +201,29 @@ Where |$PORT| is the same port number used in the |serve nfs| command
 and |$HOSTNAME| is the network address of the machine that |serve nfs|
 was run on.
 
+### NFSv4
+
+|--nfs-version 4| serves NFSv4.0 and NFSv4.1 instead of NFSv3. NFSv4
+only needs the one port, so doesn't need |mountport| or a portmapper,
+and clients open and close files explicitly. Rclone keeps each VFS
+file open for as long as the client has it open, so with
+|--vfs-cache-mode writes| or |full| files are uploaded when the last
+client closes them rather than after every write.
+
+Byte range locks and share reservations are enforced between the
+clients of the server, but they are held in memory so are lost if the
+server is restarted, as are any open files. Rclone never hands out
+delegations so clients check with the server before using cached data.
+
+To mount the server with NFSv4 under Linux, use the following command:
+
+|||sh
+mount -t nfs -o vers=4.1,port=$PORT $HOSTNAME:/ path/to/mountpoint
+|||
+
+As with NFSv3, without |--vfs-cache-mode| the files are served
+read-only.
+
 If |--vfs-metadata-extension| is in use then for the |--nfs-cache-type disk|
 and |--nfs-cache-type cache| the metadata files will have the file
 handle of their parent file suffixed with |0x00, 0x00, 0x00, 0x01|.
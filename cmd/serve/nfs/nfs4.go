@@ -0,0 +1,297 @@
+//go:build unix
+
+package nfs
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+const (
+	nfs4MaxRecord   = nfs4MaxIO + 64*1024 // largest RPC record we accept
+	nfs4MaxInFlight = 16                  // max requests processed at once per connection
+)
+
+// server4 serves the VFS over NFSv4.0 and NFSv4.1
+//
+// It implements its own ONC RPC layer as go-nfs only speaks NFSv3
+// but it shares the file handle cache with the NFSv3 server.
+type server4 struct {
+	h        *Handler
+	vfs      *vfs.VFS
+	readOnly bool
+	boot     [8]byte // server verifier, changes on every restart
+
+	fhMu sync.Mutex // protects the handle cache which isn't thread safe
+
+	mu        sync.Mutex // protects the state below
+	clientSeq uint64
+	clients   map[uint64]*client4
+	sessions  map[[16]byte]*session4
+	stateSeq  uint64
+	states    map[[12]byte]*state4
+	locks     map[string][]byteLock // byte range locks by path
+	exclusive map[string][8]byte    // exclusive create verifiers by path
+	dirChange map[string]uint64     // incremented when we change a directory
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	quit    chan struct{}
+}
+
+// newServer4 makes a new NFSv4 server using the handler passed in
+func newServer4(h *Handler) *server4 {
+	s := &server4{
+		h:         h,
+		vfs:       h.vfs,
+		readOnly:  h.vfs.Opt.ReadOnly || h.vfs.Opt.CacheMode == vfscommon.CacheModeOff,
+		clients:   map[uint64]*client4{},
+		sessions:  map[[16]byte]*session4{},
+		states:    map[[12]byte]*state4{},
+		locks:     map[string][]byteLock{},
+		exclusive: map[string][8]byte{},
+		dirChange: map[string]uint64{},
+		conns:     map[net.Conn]struct{}{},
+		quit:      make(chan struct{}),
+	}
+	_, _ = rand.Read(s.boot[:])
+	return s
+}
+
+// serve accepts connections on the listener until it is closed
+func (s *server4) serve(listener net.Listener) error {
+	go s.expireLoop()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.connsMu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsMu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// shutdown closes all the connections and releases all the state
+func (s *server4) shutdown() {
+	s.connsMu.Lock()
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.connsMu.Unlock()
+	var handles []vfs.Handle
+	s.mu.Lock()
+	for _, cl := range s.clients {
+		handles = append(handles, s.removeClient(cl)...)
+	}
+	s.mu.Unlock()
+	closeHandles(handles)
+}
+
+// expireLoop expires clients which have stopped renewing their leases
+func (s *server4) expireLoop() {
+	ticker := time.NewTicker(nfs4LeaseTime / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expireClients()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// conn4 is a single client connection
+type conn4 struct {
+	s       *server4
+	conn    net.Conn
+	writeMu sync.Mutex
+}
+
+// serveConn reads RPC calls from the connection and replies to them
+func (s *server4) serveConn(conn net.Conn) {
+	c := &conn4{s: s, conn: conn}
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+		_ = conn.Close()
+	}()
+	var (
+		wg       sync.WaitGroup
+		inFlight = make(chan struct{}, nfs4MaxInFlight)
+		br       = bufio.NewReader(conn)
+	)
+	defer wg.Wait()
+	for {
+		record, err := readRecord(br)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fs.Debugf("nfs", "NFSv4: closing connection from %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-inFlight
+				wg.Done()
+			}()
+			reply := s.handleCall(record)
+			if reply == nil {
+				return
+			}
+			if err := c.writeRecord(reply); err != nil {
+				fs.Debugf("nfs", "NFSv4: failed to write reply to %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// readRecord reads a whole RPC record made of one or more fragments
+func readRecord(r io.Reader) (record []byte, err error) {
+	var header [4]byte
+	for {
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		mark := binary.BigEndian.Uint32(header[:])
+		size := int(mark &^ rpcLastFragment)
+		if len(record)+size > nfs4MaxRecord {
+			return nil, fmt.Errorf("RPC record too large (%d bytes)", len(record)+size)
+		}
+		start := len(record)
+		record = append(record, make([]byte, size)...)
+		if _, err = io.ReadFull(r, record[start:]); err != nil {
+			return nil, err
+		}
+		if mark&rpcLastFragment != 0 {
+			return record, nil
+		}
+	}
+}
+
+// writeRecord writes reply as a single RPC record
+func (c *conn4) writeRecord(reply []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	header := binary.BigEndian.AppendUint32(nil, rpcLastFragment|uint32(len(reply)))
+	_, err := c.conn.Write(append(header, reply...))
+	return err
+}
+
+// handleCall decodes an RPC call and returns the reply
+//
+// It returns nil if the record should be ignored
+func (s *server4) handleCall(record []byte) []byte {
+	r := &xdrReader{buf: record}
+	xid := r.uint32()
+	msgType := r.uint32()
+	if r.err != nil || msgType != rpcCall {
+		return nil
+	}
+	rpcVers := r.uint32()
+	prog := r.uint32()
+	vers := r.uint32()
+	proc := r.uint32()
+	credFlavor := r.uint32()
+	_ = r.opaque() // credentials
+	_ = r.uint32() // verifier flavor
+	_ = r.opaque() // verifier
+	w := &xdrWriter{}
+	w.uint32(xid)
+	w.uint32(rpcReply)
+	switch {
+	case rpcVers != rpcVersion:
+		w.uint32(rpcMsgDenied)
+		w.uint32(rpcMismatch)
+		w.uint32(rpcVersion)
+		w.uint32(rpcVersion)
+		return w.buf
+	case credFlavor != rpcAuthNone && credFlavor != rpcAuthSys:
+		w.uint32(rpcMsgDenied)
+		w.uint32(rpcAuthError)
+		w.uint32(rpcAuthTooWeak)
+		return w.buf
+	}
+	w.uint32(rpcMsgAccepted)
+	w.uint32(rpcAuthNone)
+	w.opaque(nil)
+	switch {
+	case r.err != nil:
+		w.uint32(rpcGarbageArgs)
+	case prog != nfs4Program:
+		w.uint32(rpcProgUnavail)
+	case vers != nfs4Version:
+		w.uint32(rpcProgMismatch)
+		w.uint32(nfs4Version)
+		w.uint32(nfs4Version)
+	case proc == nfs4ProcNull:
+		w.uint32(rpcSuccess)
+	case proc == nfs4ProcCompound:
+		w.uint32(rpcSuccess)
+		w.buf = append(w.buf, s.compound(r.buf)...)
+	default:
+		w.uint32(rpcProcUnavail)
+	}
+	return w.buf
+}
+
+// splitPath splits a VFS path into the form the handle cache uses
+func splitPath(p string) []string {
+	if p == "" {
+		return []string{}
+	}
+	return strings.Split(p, "/")
+}
+
+// toHandle returns the file handle for the VFS path p
+func (s *server4) toHandle(p string) []byte {
+	s.fhMu.Lock()
+	defer s.fhMu.Unlock()
+	return s.h.ToHandle(s.h.billyFS, splitPath(p))
+}
+
+// fromHandle returns the VFS path for the file handle fh
+func (s *server4) fromHandle(fh []byte) (string, error) {
+	s.fhMu.Lock()
+	defer s.fhMu.Unlock()
+	_, parts, err := s.h.FromHandle(fh)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// invalidateHandle invalidates the file handle for the VFS path p
+func (s *server4) invalidateHandle(p string) {
+	s.fhMu.Lock()
+	defer s.fhMu.Unlock()
+	fh := s.h.ToHandle(s.h.billyFS, splitPath(p))
+	if err := s.h.InvalidateHandle(s.h.billyFS, fh); err != nil {
+		fs.Debugf("nfs", "NFSv4: failed to invalidate handle for %q: %v", p, err)
+	}
+}
@@ -0,0 +1,376 @@
+//go:build unix
+
+package nfs
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// fattr4 attribute numbers
+const (
+	attrSupportedAttrs    = 0
+	attrType              = 1
+	attrFHExpireType      = 2
+	attrChange            = 3
+	attrSize              = 4
+	attrLinkSupport       = 5
+	attrSymlinkSupport    = 6
+	attrNamedAttr         = 7
+	attrFSID              = 8
+	attrUniqueHandles     = 9
+	attrLeaseTime         = 10
+	attrRdattrError       = 11
+	attrACLSupport        = 13
+	attrCanSetTime        = 15
+	attrCaseInsensitive   = 16
+	attrCasePreserving    = 17
+	attrChownRestricted   = 18
+	attrFilehandle        = 19
+	attrFileID            = 20
+	attrFilesAvail        = 21
+	attrFilesFree         = 22
+	attrFilesTotal        = 23
+	attrHomogeneous       = 26
+	attrMaxFileSize       = 27
+	attrMaxLink           = 28
+	attrMaxName           = 29
+	attrMaxRead           = 30
+	attrMaxWrite          = 31
+	attrMode              = 33
+	attrNoTrunc           = 34
+	attrNumLinks          = 35
+	attrOwner             = 36
+	attrOwnerGroup        = 37
+	attrRawDev            = 41
+	attrSpaceAvail        = 42
+	attrSpaceFree         = 43
+	attrSpaceTotal        = 44
+	attrSpaceUsed         = 45
+	attrTimeAccess        = 47
+	attrTimeAccessSet     = 48
+	attrTimeDelta         = 51
+	attrTimeMetadata      = 52
+	attrTimeModify        = 53
+	attrTimeModifySet     = 54
+	attrMountedOnFileID   = 55
+	attrSuppattrExclcreat = 75
+)
+
+// Attributes we can return in GETATTR and READDIR
+var readableAttrs = []int{
+	attrSupportedAttrs, attrType, attrFHExpireType, attrChange, attrSize,
+	attrLinkSupport, attrSymlinkSupport, attrNamedAttr, attrFSID,
+	attrUniqueHandles, attrLeaseTime, attrRdattrError, attrACLSupport,
+	attrCanSetTime, attrCaseInsensitive, attrCasePreserving,
+	attrChownRestricted, attrFilehandle, attrFileID, attrFilesAvail,
+	attrFilesFree, attrFilesTotal, attrHomogeneous, attrMaxFileSize,
+	attrMaxLink, attrMaxName, attrMaxRead, attrMaxWrite, attrMode,
+	attrNoTrunc, attrNumLinks, attrOwner, attrOwnerGroup, attrRawDev,
+	attrSpaceAvail, attrSpaceFree, attrSpaceTotal, attrSpaceUsed,
+	attrTimeAccess, attrTimeDelta, attrTimeMetadata, attrTimeModify,
+	attrMountedOnFileID,
+}
+
+// Attributes which can be set with SETATTR, CREATE and OPEN
+var writableAttrs = []int{
+	attrSize, attrMode, attrOwner, attrOwnerGroup, attrTimeAccessSet, attrTimeModifySet,
+}
+
+// Attributes which can be set with an EXCLUSIVE4_1 create
+var exclusiveAttrs = []int{
+	attrSize, attrMode, attrOwner, attrOwnerGroup,
+}
+
+// makeBitmap makes a bitmap4 from the attributes passed in
+func makeBitmap(attrs ...[]int) (bitmap []uint32) {
+	for _, list := range attrs {
+		for _, attr := range list {
+			bitmap = bitmapSet(bitmap, attr)
+		}
+	}
+	return bitmap
+}
+
+// supportedAttrs returns the supported attributes for the minor version
+func supportedAttrs(minor uint32) []uint32 {
+	bitmap := makeBitmap(readableAttrs, writableAttrs)
+	if minor >= 1 {
+		bitmap = bitmapSet(bitmap, attrSuppattrExclcreat)
+	}
+	return bitmap
+}
+
+// isWritable returns true if attr can be set
+func isWritable(attr int) bool {
+	for _, a := range writableAttrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// write an nfstime4
+func (w *xdrWriter) time(t time.Time) {
+	w.uint64(uint64(t.Unix()))
+	w.uint32(uint32(t.Nanosecond()))
+}
+
+// read an nfstime4
+func (r *xdrReader) time() time.Time {
+	seconds := int64(r.uint64())
+	nanoseconds := r.uint32()
+	return time.Unix(seconds, int64(nanoseconds))
+}
+
+// change returns the change attribute for node at path p
+func (s *server4) change(node vfs.Node, p string) uint64 {
+	change := uint64(node.ModTime().UnixNano())
+	if node.IsDir() {
+		s.mu.Lock()
+		change += s.dirChange[p]
+		s.mu.Unlock()
+	} else {
+		change += uint64(node.Size())
+	}
+	return change
+}
+
+// fileType returns the nfs_ftype4 for node
+func fileType(node vfs.Node) uint32 {
+	if node.IsDir() {
+		return nf4Dir
+	}
+	if file, ok := node.(*vfs.File); ok && file.IsSymlink() {
+		return nf4Lnk
+	}
+	return nf4Reg
+}
+
+// timeDelta returns the granularity of the modification times
+func (s *server4) timeDelta() time.Duration {
+	precision := s.vfs.Fs().Precision()
+	if precision <= 0 {
+		return time.Nanosecond
+	}
+	if precision == fs.ModTimeNotSupported || precision > time.Second {
+		return time.Second
+	}
+	return precision
+}
+
+// encodeAttrs writes a fattr4 for the node at path p containing the
+// requested attributes which are supported
+func (c *compound4) encodeAttrs(w *xdrWriter, request []uint32, node vfs.Node, p string) {
+	supported := supportedAttrs(c.minor)
+	var (
+		mask []uint32
+		vals = &xdrWriter{}
+		size = max(node.Size(), 0)
+	)
+	for attr := 0; attr < 32*len(request); attr++ {
+		if !bitmapIsSet(request, attr) || !bitmapIsSet(supported, attr) || attr == attrTimeAccessSet || attr == attrTimeModifySet {
+			continue
+		}
+		mask = bitmapSet(mask, attr)
+		switch attr {
+		case attrSupportedAttrs:
+			vals.bitmap(supported)
+		case attrType:
+			vals.uint32(fileType(node))
+		case attrFHExpireType:
+			vals.uint32(0) // FH4_PERSISTENT
+		case attrChange:
+			vals.uint64(c.s.change(node, p))
+		case attrSize:
+			vals.uint64(uint64(size))
+		case attrLinkSupport, attrNamedAttr, attrUniqueHandles:
+			vals.bool(false)
+		case attrSymlinkSupport:
+			vals.bool(c.s.vfs.Opt.Links)
+		case attrFSID:
+			vals.uint64(1)
+			vals.uint64(0)
+		case attrLeaseTime:
+			vals.uint32(uint32(nfs4LeaseTime / time.Second))
+		case attrRdattrError, attrACLSupport:
+			vals.uint32(0)
+		case attrCanSetTime, attrCasePreserving, attrChownRestricted, attrHomogeneous, attrNoTrunc:
+			vals.bool(true)
+		case attrCaseInsensitive:
+			vals.bool(c.s.vfs.Opt.CaseInsensitive)
+		case attrFilehandle:
+			vals.opaque(c.s.toHandle(p))
+		case attrFileID, attrMountedOnFileID:
+			vals.uint64(node.Inode())
+		case attrFilesAvail, attrFilesFree, attrFilesTotal:
+			vals.uint64(math.MaxInt32)
+		case attrMaxFileSize:
+			vals.uint64(math.MaxInt64)
+		case attrMaxLink:
+			vals.uint32(1)
+		case attrMaxName:
+			vals.uint32(255)
+		case attrMaxRead, attrMaxWrite:
+			vals.uint64(nfs4MaxIO)
+		case attrMode:
+			vals.uint32(uint32(node.Mode().Perm()))
+		case attrNumLinks:
+			if node.IsDir() {
+				vals.uint32(2)
+			} else {
+				vals.uint32(1)
+			}
+		case attrOwner:
+			vals.string(strconv.FormatUint(uint64(c.s.vfs.Opt.UID), 10))
+		case attrOwnerGroup:
+			vals.string(strconv.FormatUint(uint64(c.s.vfs.Opt.GID), 10))
+		case attrRawDev:
+			vals.uint32(0)
+			vals.uint32(0)
+		case attrSpaceAvail, attrSpaceFree, attrSpaceTotal:
+			total, _, free := c.s.vfs.Statfs()
+			if attr == attrSpaceTotal {
+				vals.uint64(uint64(max(total, 0)))
+			} else {
+				vals.uint64(uint64(max(free, 0)))
+			}
+		case attrSpaceUsed:
+			vals.uint64(uint64(size))
+		case attrTimeAccess, attrTimeMetadata, attrTimeModify:
+			vals.time(node.ModTime())
+		case attrTimeDelta:
+			delta := c.s.timeDelta()
+			vals.uint64(uint64(delta / time.Second))
+			vals.uint32(uint32(delta % time.Second))
+		case attrSuppattrExclcreat:
+			vals.bitmap(makeBitmap(exclusiveAttrs))
+		}
+	}
+	w.bitmap(mask)
+	w.opaque(vals.buf)
+}
+
+// setAttrs4 are the attributes decoded from a fattr4 for setting
+type setAttrs4 struct {
+	mask     []uint32
+	size     uint64
+	modTime  time.Time
+	hasSize  bool
+	hasMtime bool
+}
+
+// decodeSetAttrs decodes a fattr4 containing settable attributes
+func (c *compound4) decodeSetAttrs(r *xdrReader) (sa setAttrs4, status uint32) {
+	mask := r.bitmap()
+	vals := &xdrReader{buf: r.opaque()}
+	if r.err != nil {
+		return sa, nfs4ErrBadXDR
+	}
+	supported := supportedAttrs(c.minor)
+	for attr := 0; attr < 32*len(mask); attr++ {
+		if !bitmapIsSet(mask, attr) {
+			continue
+		}
+		if !bitmapIsSet(supported, attr) {
+			return sa, nfs4ErrAttrNotSupp
+		}
+		if !isWritable(attr) {
+			return sa, nfs4ErrInval
+		}
+		sa.mask = bitmapSet(sa.mask, attr)
+		switch attr {
+		case attrSize:
+			sa.size = vals.uint64()
+			sa.hasSize = true
+		case attrMode:
+			_ = vals.uint32()
+		case attrOwner, attrOwnerGroup:
+			_ = vals.string()
+		case attrTimeAccessSet, attrTimeModifySet:
+			t := time.Now()
+			if vals.uint32() == 1 { // SET_TO_CLIENT_TIME4
+				t = vals.time()
+			}
+			if attr == attrTimeModifySet {
+				sa.modTime = t
+				sa.hasMtime = true
+			}
+		}
+	}
+	if vals.err != nil {
+		return sa, nfs4ErrBadXDR
+	}
+	return sa, nfs4OK
+}
+
+// applySetAttrs sets the attributes in sa on node
+//
+// If handle is set then it is used to change the size.
+// The mode, owner and access time are accepted but ignored as the VFS
+// can't store them.
+func (c *compound4) applySetAttrs(node vfs.Node, handle vfs.Handle, sa setAttrs4) uint32 {
+	if len(sa.mask) == 0 {
+		return nfs4OK
+	}
+	if c.s.readOnly {
+		return nfs4ErrROFS
+	}
+	if sa.hasSize {
+		if node.IsDir() {
+			return nfs4ErrIsDir
+		}
+		var err error
+		if handle != nil {
+			err = handle.Truncate(int64(sa.size))
+		} else {
+			err = node.Truncate(int64(sa.size))
+		}
+		if err != nil {
+			return nfs4Status(err)
+		}
+	}
+	if sa.hasMtime {
+		if err := node.SetModTime(sa.modTime); err != nil {
+			return nfs4Status(err)
+		}
+	}
+	return nfs4OK
+}
+
+// verifyAttrs compares the fattr4 in r with the attributes of node
+// returning nfs4ErrSame if they match or nfs4ErrNotSame if they don't
+func (c *compound4) verifyAttrs(r *xdrReader, node vfs.Node, p string) uint32 {
+	mask := r.bitmap()
+	vals := r.opaque()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	supported := supportedAttrs(c.minor)
+	for attr := 0; attr < 32*len(mask); attr++ {
+		if !bitmapIsSet(mask, attr) {
+			continue
+		}
+		if !bitmapIsSet(supported, attr) {
+			return nfs4ErrAttrNotSupp
+		}
+		// These can't be compared
+		if attr == attrRdattrError || attr == attrTimeAccessSet || attr == attrTimeModifySet {
+			return nfs4ErrInval
+		}
+	}
+	w := &xdrWriter{}
+	c.encodeAttrs(w, mask, node, p)
+	r = &xdrReader{buf: w.buf}
+	_ = r.bitmap()
+	if bytes.Equal(r.opaque(), vals) {
+		return nfs4ErrSame
+	}
+	return nfs4ErrNotSame
+}
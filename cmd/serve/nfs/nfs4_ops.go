@@ -0,0 +1,1785 @@
+//go:build unix
+
+package nfs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// Protocol constants used by the operations
+const (
+	accessRead    = 0x01
+	accessLookup  = 0x02
+	accessModify  = 0x04
+	accessExtend  = 0x08
+	accessDelete  = 0x10
+	accessExecute = 0x20
+
+	shareAccessRead  = 1
+	shareAccessWrite = 2
+	shareAccessMask  = 3
+
+	openCreate = 1
+
+	createUnchecked   = 0
+	createGuarded     = 1
+	createExclusive   = 2
+	createExclusive41 = 3
+
+	claimNull         = 0
+	claimPrevious     = 1
+	claimDelegateCur  = 2
+	claimDelegatePrev = 3
+	claimFH           = 4
+	claimDelegCurFH   = 5
+	claimDelegPrevFH  = 6
+
+	openResultLocktypePosix = 4
+	openDelegateNone        = 0
+
+	readLT   = 1
+	writeLT  = 2
+	writewLT = 4
+
+	fileSync4 = 2
+
+	exchgIDFlagUseNonPNFS = 0x00010000
+	exchgIDFlagConfirmedR = 0x80000000
+	sp4None               = 0
+	sp4MachCred           = 1
+	cdfs4Fore             = 1
+)
+
+// Names of the operations for logging
+var opNames = map[uint32]string{
+	opAccess: "ACCESS", opClose: "CLOSE", opCommit: "COMMIT", opCreate: "CREATE",
+	opDelegPurge: "DELEGPURGE", opDelegReturn: "DELEGRETURN", opGetattr: "GETATTR",
+	opGetFH: "GETFH", opLink: "LINK", opLock: "LOCK", opLockT: "LOCKT", opLockU: "LOCKU",
+	opLookup: "LOOKUP", opLookupP: "LOOKUPP", opNVerify: "NVERIFY", opOpen: "OPEN",
+	opOpenAttr: "OPENATTR", opOpenConfirm: "OPEN_CONFIRM", opOpenDowngrade: "OPEN_DOWNGRADE",
+	opPutFH: "PUTFH", opPutPubFH: "PUTPUBFH", opPutRootFH: "PUTROOTFH", opRead: "READ",
+	opReaddir: "READDIR", opReadlink: "READLINK", opRemove: "REMOVE", opRename: "RENAME",
+	opRenew: "RENEW", opRestoreFH: "RESTOREFH", opSaveFH: "SAVEFH", opSecinfo: "SECINFO",
+	opSetattr: "SETATTR", opSetClientID: "SETCLIENTID", opSetClientIDConfirm: "SETCLIENTID_CONFIRM",
+	opVerify: "VERIFY", opWrite: "WRITE", opReleaseLockOwner: "RELEASE_LOCKOWNER",
+	opBindConnToSession: "BIND_CONN_TO_SESSION", opExchangeID: "EXCHANGE_ID",
+	opCreateSession: "CREATE_SESSION", opDestroySession: "DESTROY_SESSION",
+	opFreeStateID: "FREE_STATEID", opSecinfoNoName: "SECINFO_NO_NAME", opSequence: "SEQUENCE",
+	opTestStateID: "TEST_STATEID", opDestroyClientID: "DESTROY_CLIENTID",
+	opReclaimComplete: "RECLAIM_COMPLETE", opIllegal: "ILLEGAL",
+}
+
+// fh4 is a current or saved file handle along with its VFS path
+type fh4 struct {
+	fh   []byte
+	path string
+}
+
+// compound4 is the state kept while processing a COMPOUND
+type compound4 struct {
+	s          *server4
+	minor      uint32
+	cur        fh4
+	saved      fh4
+	curState   stateid4
+	savedState stateid4
+	client     *client4  // client from SEQUENCE
+	session    *session4 // session from SEQUENCE
+	slot       *slot4    // slot from SEQUENCE
+	replay     []byte    // set if this is a replay of a cached reply
+}
+
+// compound processes a COMPOUND request returning the COMPOUND4res
+func (s *server4) compound(args []byte) []byte {
+	r := &xdrReader{buf: args}
+	tag := r.opaque()
+	minor := r.uint32()
+	n := r.uint32()
+	c := &compound4{s: s, minor: minor}
+	var (
+		res    = &xdrWriter{}
+		status = uint32(nfs4OK)
+		count  uint32
+	)
+	switch {
+	case r.err != nil:
+		status = nfs4ErrBadXDR
+	case minor > nfs4MaxMinor:
+		status = nfs4ErrMinorVersMismatch
+	case n > nfs4MaxOps:
+		status = nfs4ErrTooManyOps
+	default:
+		for i := range n {
+			op := r.uint32()
+			if r.err != nil {
+				status = nfs4ErrBadXDR
+				break
+			}
+			count++
+			status = c.op(i, n, op, r, res)
+			if c.replay != nil {
+				return c.replay
+			}
+			if status != nfs4OK {
+				break
+			}
+		}
+	}
+	w := &xdrWriter{}
+	w.uint32(status)
+	w.opaque(tag)
+	w.uint32(count)
+	w.buf = append(w.buf, res.buf...)
+	if c.slot != nil {
+		c.session.mu.Lock()
+		c.slot.reply = w.buf
+		c.slot.busy = false
+		c.session.mu.Unlock()
+	}
+	return w.buf
+}
+
+// isSessionless returns true for NFSv4.1 operations which don't need a session
+func isSessionless(op uint32) bool {
+	switch op {
+	case opExchangeID, opCreateSession, opDestroySession, opBindConnToSession, opDestroyClientID:
+		return true
+	}
+	return false
+}
+
+// op runs operation i of n writing its result to w and returning its status
+func (c *compound4) op(i, n, op uint32, r *xdrReader, w *xdrWriter) (status uint32) {
+	illegal := op < opAccess || (c.minor == 0 && op > opReleaseLockOwner) || (op > opReclaimComplete && op != opIllegal)
+	if illegal {
+		op = opIllegal
+	}
+	w.uint32(op)
+	statusPos := len(w.buf)
+	w.uint32(0)
+	switch {
+	case illegal:
+		status = nfs4ErrOpIllegal
+	case c.minor >= 1 && op == opSequence && i != 0:
+		status = nfs4ErrSequencePos
+	case c.minor >= 1 && i == 0 && op != opSequence && !isSessionless(op):
+		status = nfs4ErrOpNotInSession
+	case c.minor >= 1 && i == 0 && isSessionless(op) && n > 1:
+		status = nfs4ErrNotOnlyOp
+	default:
+		status = c.dispatch(op, r, w)
+	}
+	if r.err != nil {
+		status = nfs4ErrBadXDR
+	}
+	// Only some operations return a body with an error
+	keepBody := op == opSetattr ||
+		(status == nfs4ErrDenied && (op == opLock || op == opLockT)) ||
+		(status == nfs4ErrClidInUse && op == opSetClientID)
+	if status != nfs4OK && !keepBody {
+		w.buf = w.buf[:statusPos+4]
+	}
+	binary.BigEndian.PutUint32(w.buf[statusPos:], status)
+	if status != nfs4OK {
+		fs.Debugf("nfs", "NFSv4: %s on %q failed with status %d", opNames[op], c.cur.path, status)
+	}
+	return status
+}
+
+// dispatch runs a single operation
+func (c *compound4) dispatch(op uint32, r *xdrReader, w *xdrWriter) uint32 {
+	// Operations removed in NFSv4.1
+	if c.minor >= 1 {
+		switch op {
+		case opOpenConfirm, opRenew, opSetClientID, opSetClientIDConfirm, opReleaseLockOwner:
+			return nfs4ErrNotSupp
+		}
+	}
+	switch op {
+	case opAccess:
+		return c.opAccess(r, w)
+	case opClose:
+		return c.opClose(r, w)
+	case opCommit:
+		return c.opCommit(r, w)
+	case opCreate:
+		return c.opCreate(r, w)
+	case opDelegReturn:
+		_ = r.stateid()
+		return nfs4ErrBadStateID // we never hand out delegations
+	case opGetattr:
+		return c.opGetattr(r, w)
+	case opGetFH:
+		return c.opGetFH(w)
+	case opLock:
+		return c.opLock(r, w)
+	case opLockT:
+		return c.opLockT(r, w)
+	case opLockU:
+		return c.opLockU(r, w)
+	case opLookup:
+		return c.opLookup(r)
+	case opLookupP:
+		return c.opLookupP()
+	case opNVerify, opVerify:
+		return c.opVerify(op, r)
+	case opOpen:
+		return c.opOpen(r, w)
+	case opOpenConfirm:
+		return c.opOpenConfirm(r, w)
+	case opOpenDowngrade:
+		return c.opOpenDowngrade(r, w)
+	case opPutFH:
+		return c.opPutFH(r)
+	case opPutPubFH, opPutRootFH:
+		c.setCur("")
+		return nfs4OK
+	case opRead:
+		return c.opRead(r, w)
+	case opReaddir:
+		return c.opReaddir(r, w)
+	case opReadlink:
+		return c.opReadlink(w)
+	case opRemove:
+		return c.opRemove(r, w)
+	case opRename:
+		return c.opRename(r, w)
+	case opRenew:
+		_, status := c.findClient(r.uint64())
+		return status
+	case opRestoreFH:
+		if c.saved.fh == nil {
+			return nfs4ErrRestoreFH
+		}
+		c.cur, c.curState = c.saved, c.savedState
+		return nfs4OK
+	case opSaveFH:
+		if c.cur.fh == nil {
+			return nfs4ErrNoFileHandle
+		}
+		c.saved, c.savedState = c.cur, c.curState
+		return nfs4OK
+	case opSecinfo:
+		return c.opSecinfo(r, w)
+	case opSetattr:
+		return c.opSetattr(r, w)
+	case opSetClientID:
+		return c.opSetClientID(r, w)
+	case opSetClientIDConfirm:
+		return c.opSetClientIDConfirm(r)
+	case opWrite:
+		return c.opWrite(r, w)
+	case opReleaseLockOwner:
+		return c.opReleaseLockOwner(r)
+	case opBindConnToSession:
+		return c.opBindConnToSession(r, w)
+	case opExchangeID:
+		return c.opExchangeID(r, w)
+	case opCreateSession:
+		return c.opCreateSession(r, w)
+	case opDestroySession:
+		return c.opDestroySession(r)
+	case opFreeStateID:
+		return c.opFreeStateID(r)
+	case opSecinfoNoName:
+		_ = r.uint32() // style
+		return c.opSecinfoNoName(w)
+	case opSequence:
+		return c.opSequence(r, w)
+	case opTestStateID:
+		return c.opTestStateID(r, w)
+	case opDestroyClientID:
+		return c.opDestroyClientID(r)
+	case opReclaimComplete:
+		_ = r.bool() // one_fs
+		return nfs4OK
+	}
+	// LINK, OPENATTR, DELEGPURGE, BACKCHANNEL_CTL and the pNFS and
+	// delegation operations
+	return nfs4ErrNotSupp
+}
+
+// nfs4Status converts a VFS error into an NFSv4 status
+func nfs4Status(err error) uint32 {
+	switch {
+	case err == nil:
+		return nfs4OK
+	case errors.Is(err, vfs.ENOENT):
+		return nfs4ErrNoEnt
+	case errors.Is(err, vfs.EEXIST):
+		return nfs4ErrExist
+	case errors.Is(err, vfs.EPERM):
+		return nfs4ErrPerm
+	case errors.Is(err, vfs.EINVAL):
+		return nfs4ErrInval
+	case errors.Is(err, vfs.ECLOSED):
+		return nfs4ErrBadStateID
+	case errors.Is(err, vfs.ENOTEMPTY):
+		return nfs4ErrNotEmpty
+	case errors.Is(err, vfs.EROFS):
+		return nfs4ErrROFS
+	case errors.Is(err, vfs.ENOSYS):
+		return nfs4ErrNotSupp
+	}
+	fs.Debugf("nfs", "NFSv4: returning I/O error for: %v", err)
+	return nfs4ErrIO
+}
+
+// joinPath joins a directory path and a leaf name
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// checkName checks a component name is valid
+func checkName(name string) uint32 {
+	switch {
+	case name == "":
+		return nfs4ErrInval
+	case len(name) > 255:
+		return nfs4ErrNameTooLong
+	case name == "." || name == ".." || strings.ContainsAny(name, "/\x00"):
+		return nfs4ErrBadName
+	}
+	return nfs4OK
+}
+
+// setCur sets the current file handle to the VFS path p
+func (c *compound4) setCur(p string) {
+	c.cur = fh4{fh: c.s.toHandle(p), path: p}
+}
+
+// node returns the VFS node for the current file handle
+func (c *compound4) node() (vfs.Node, uint32) {
+	if c.cur.fh == nil {
+		return nil, nfs4ErrNoFileHandle
+	}
+	node, err := c.s.vfs.Stat(c.cur.path)
+	if errors.Is(err, vfs.ENOENT) {
+		return nil, nfs4ErrStale
+	} else if err != nil {
+		return nil, nfs4Status(err)
+	}
+	return node, nfs4OK
+}
+
+// dir returns the current file handle which must be a directory
+func (c *compound4) dir() (*vfs.Dir, uint32) {
+	node, status := c.node()
+	if status != nfs4OK {
+		return nil, status
+	}
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		if fileType(node) == nf4Lnk {
+			return nil, nfs4ErrSymlink
+		}
+		return nil, nfs4ErrNotDir
+	}
+	return dir, nfs4OK
+}
+
+// file returns the current file handle which must be a regular file
+func (c *compound4) file() (vfs.Node, uint32) {
+	node, status := c.node()
+	if status != nfs4OK {
+		return nil, status
+	}
+	switch fileType(node) {
+	case nf4Dir:
+		return nil, nfs4ErrIsDir
+	case nf4Lnk:
+		return nil, nfs4ErrInval
+	}
+	return node, nfs4OK
+}
+
+// writeChangeInfo writes a change_info4
+func writeChangeInfo(w *xdrWriter, before, after uint64) {
+	w.bool(false) // not atomic
+	w.uint64(before)
+	w.uint64(after)
+}
+
+// resolveState replaces the NFSv4.1 current stateid with the real one
+func (c *compound4) resolveState(id stateid4) stateid4 {
+	if c.minor >= 1 && id.isCurrent() {
+		return c.curState
+	}
+	return id
+}
+
+// findClient finds a confirmed client, renewing its lease
+func (c *compound4) findClient(id uint64) (*client4, uint32) {
+	if c.minor >= 1 {
+		return c.client, nfs4OK
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	cl := c.s.clients[id]
+	if cl == nil || !cl.confirmed {
+		return nil, nfs4ErrStaleClientID
+	}
+	cl.renewed = time.Now()
+	return cl, nfs4OK
+}
+
+// ioHandle returns the handle to use for I/O with stateid id
+//
+// For the special stateids a temporary read only handle is opened
+// for the current file which must be closed after use. Writes with
+// the special stateids are refused as they would need a VFS handle
+// opening and closing for each WRITE and the share reservations of
+// the file checking each time - clients must OPEN the file first.
+func (c *compound4) ioHandle(id stateid4, write bool) (handle vfs.Handle, temp bool, status uint32) {
+	id = c.resolveState(id)
+	if id.isSpecial() {
+		if write {
+			return nil, false, nfs4ErrOpenMode
+		}
+		c.s.mu.Lock()
+		denied := c.s.shareConflict(c.cur.path, "", shareAccessRead, 0)
+		c.s.mu.Unlock()
+		if denied {
+			return nil, false, nfs4ErrLocked
+		}
+		handle, err := c.s.vfs.OpenFile(c.cur.path, os.O_RDONLY, 0666)
+		return handle, true, nfs4Status(err)
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	st, status := c.s.findState(id, c.minor)
+	if status != nfs4OK {
+		return nil, false, status
+	}
+	if st.kind == stateLock {
+		st = st.open
+	}
+	if st.handle == nil {
+		return nil, false, nfs4ErrBadStateID
+	}
+	if write && !st.write {
+		return nil, false, nfs4ErrOpenMode
+	}
+	return st.handle, false, nfs4OK
+}
+
+func (c *compound4) opPutFH(r *xdrReader) uint32 {
+	fh := r.opaque()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if len(fh) == 0 || len(fh) > 128 {
+		return nfs4ErrBadHandle
+	}
+	p, err := c.s.fromHandle(fh)
+	if err != nil {
+		return nfs4ErrStale
+	}
+	c.cur = fh4{fh: fh, path: p}
+	return nfs4OK
+}
+
+func (c *compound4) opGetFH(w *xdrWriter) uint32 {
+	if c.cur.fh == nil {
+		return nfs4ErrNoFileHandle
+	}
+	w.opaque(c.cur.fh)
+	return nfs4OK
+}
+
+func (c *compound4) opLookup(r *xdrReader) uint32 {
+	name := r.string()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	if _, err := dir.Stat(name); err != nil {
+		return nfs4Status(err)
+	}
+	c.setCur(joinPath(c.cur.path, name))
+	return nfs4OK
+}
+
+func (c *compound4) opLookupP() uint32 {
+	if _, status := c.dir(); status != nfs4OK {
+		return status
+	}
+	if c.cur.path == "" {
+		return nfs4ErrNoEnt
+	}
+	parent := path.Dir(c.cur.path)
+	if parent == "." {
+		parent = ""
+	}
+	c.setCur(parent)
+	return nfs4OK
+}
+
+func (c *compound4) opGetattr(r *xdrReader, w *xdrWriter) uint32 {
+	request := r.bitmap()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	node, status := c.node()
+	if status != nfs4OK {
+		return status
+	}
+	c.encodeAttrs(w, request, node, c.cur.path)
+	return nfs4OK
+}
+
+func (c *compound4) opVerify(op uint32, r *xdrReader) uint32 {
+	node, status := c.node()
+	if status != nfs4OK {
+		return status
+	}
+	status = c.verifyAttrs(r, node, c.cur.path)
+	switch {
+	case op == opVerify && status == nfs4ErrSame:
+		return nfs4OK
+	case op == opNVerify && status == nfs4ErrNotSame:
+		return nfs4OK
+	}
+	return status
+}
+
+func (c *compound4) opAccess(r *xdrReader, w *xdrWriter) uint32 {
+	request := r.uint32()
+	if _, status := c.node(); status != nfs4OK {
+		return status
+	}
+	supported := request & (accessRead | accessLookup | accessModify | accessExtend | accessDelete | accessExecute)
+	allowed := supported
+	if c.s.readOnly {
+		allowed &^= accessModify | accessExtend | accessDelete
+	}
+	w.uint32(supported)
+	w.uint32(allowed)
+	return nfs4OK
+}
+
+func (c *compound4) opReaddir(r *xdrReader, w *xdrWriter) uint32 {
+	cookie := r.uint64()
+	verifier := r.fixed(8)
+	_ = r.uint32() // dircount
+	maxCount := int(r.uint32())
+	request := r.bitmap()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	// Cookies are the index into the listing plus 3 as 0, 1 and 2 are reserved
+	if cookie == 1 || cookie == 2 {
+		return nfs4ErrBadCookie
+	}
+	start := 0
+	if cookie > 2 {
+		start = int(cookie - 2)
+	}
+	items, err := dir.ReadDirAll()
+	if err != nil {
+		return nfs4Status(err)
+	}
+	// status, verifier, end of list and eof
+	const overhead = 4 + 8 + 4 + 4
+	w.fixed(verifier)
+	var (
+		entries = &xdrWriter{}
+		eof     = true
+	)
+	for i := start; i < len(items); i++ {
+		item := items[i]
+		entry := &xdrWriter{}
+		entry.bool(true)
+		entry.uint64(uint64(i + 3))
+		entry.string(item.Name())
+		c.encodeAttrs(entry, request, item, joinPath(c.cur.path, item.Name()))
+		if overhead+len(entries.buf)+len(entry.buf) > maxCount {
+			if len(entries.buf) == 0 {
+				w.buf = w.buf[:len(w.buf)-8]
+				return nfs4ErrTooSmall
+			}
+			eof = false
+			break
+		}
+		entries.buf = append(entries.buf, entry.buf...)
+	}
+	w.buf = append(w.buf, entries.buf...)
+	w.bool(false)
+	w.bool(eof)
+	return nfs4OK
+}
+
+func (c *compound4) opReadlink(w *xdrWriter) uint32 {
+	node, status := c.node()
+	if status != nfs4OK {
+		return status
+	}
+	if fileType(node) != nf4Lnk {
+		return nfs4ErrInval
+	}
+	target, err := c.s.vfs.Readlink(c.cur.path)
+	if err != nil {
+		return nfs4Status(err)
+	}
+	w.string(target)
+	return nfs4OK
+}
+
+func (c *compound4) opCreate(r *xdrReader, w *xdrWriter) uint32 {
+	objType := r.uint32()
+	var target string
+	switch objType {
+	case nf4Lnk:
+		target = r.string()
+	case 3, 4: // NF4BLK, NF4CHR
+		_, _ = r.uint32(), r.uint32()
+	}
+	name := r.string()
+	sa, status := c.decodeSetAttrs(r)
+	if status != nfs4OK {
+		return status
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	if c.s.readOnly {
+		return nfs4ErrROFS
+	}
+	if _, err := dir.Stat(name); err == nil {
+		return nfs4ErrExist
+	}
+	dirPath := c.cur.path
+	p := joinPath(dirPath, name)
+	before := c.s.change(dir, dirPath)
+	var (
+		node vfs.Node
+		err  error
+	)
+	switch objType {
+	case nf4Dir:
+		node, err = dir.Mkdir(name)
+	case nf4Lnk:
+		node, err = c.s.vfs.CreateSymlink(target, p)
+	default:
+		return nfs4ErrBadType
+	}
+	if err != nil {
+		return nfs4Status(err)
+	}
+	c.s.mu.Lock()
+	c.s.bumpChange(dirPath)
+	c.s.mu.Unlock()
+	if status := c.applySetAttrs(node, nil, sa); status != nfs4OK {
+		return status
+	}
+	c.setCur(p)
+	writeChangeInfo(w, before, c.s.change(dir, dirPath))
+	w.bitmap(sa.mask)
+	return nfs4OK
+}
+
+func (c *compound4) opRemove(r *xdrReader, w *xdrWriter) uint32 {
+	name := r.string()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	if c.s.readOnly {
+		return nfs4ErrROFS
+	}
+	dirPath := c.cur.path
+	before := c.s.change(dir, dirPath)
+	node, err := dir.Stat(name)
+	if err != nil {
+		return nfs4Status(err)
+	}
+	if err = node.Remove(); err != nil {
+		return nfs4Status(err)
+	}
+	p := joinPath(dirPath, name)
+	c.s.invalidateHandle(p)
+	c.s.mu.Lock()
+	c.s.bumpChange(dirPath)
+	delete(c.s.exclusive, p)
+	c.s.mu.Unlock()
+	writeChangeInfo(w, before, c.s.change(dir, dirPath))
+	return nfs4OK
+}
+
+func (c *compound4) opRename(r *xdrReader, w *xdrWriter) uint32 {
+	oldName := r.string()
+	newName := r.string()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if c.saved.fh == nil {
+		return nfs4ErrNoFileHandle
+	}
+	dstDir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	srcNode, err := c.s.vfs.Stat(c.saved.path)
+	if err != nil {
+		return nfs4ErrStale
+	}
+	srcDir, ok := srcNode.(*vfs.Dir)
+	if !ok {
+		return nfs4ErrNotDir
+	}
+	if status := checkName(oldName); status != nfs4OK {
+		return status
+	}
+	if status := checkName(newName); status != nfs4OK {
+		return status
+	}
+	if c.s.readOnly {
+		return nfs4ErrROFS
+	}
+	srcPath, dstPath := c.saved.path, c.cur.path
+	oldPath, newPath := joinPath(srcPath, oldName), joinPath(dstPath, newName)
+	srcBefore, dstBefore := c.s.change(srcDir, srcPath), c.s.change(dstDir, dstPath)
+	src, err := srcDir.Stat(oldName)
+	if err != nil {
+		return nfs4Status(err)
+	}
+	if oldPath != newPath {
+		// Renaming over an existing object needs the types to match
+		// and directories to be empty
+		if dst, err := dstDir.Stat(newName); err == nil {
+			if src.IsDir() != dst.IsDir() {
+				return nfs4ErrExist
+			}
+			if dst.IsDir() {
+				if err := dst.Remove(); err != nil {
+					return nfs4Status(err)
+				}
+			}
+		}
+		if err := c.s.vfs.Rename(oldPath, newPath); err != nil {
+			return nfs4Status(err)
+		}
+		c.s.invalidateHandle(oldPath)
+		c.s.mu.Lock()
+		c.s.renamePath(oldPath, newPath)
+		c.s.bumpChange(srcPath)
+		c.s.bumpChange(dstPath)
+		delete(c.s.exclusive, oldPath)
+		c.s.mu.Unlock()
+	}
+	writeChangeInfo(w, srcBefore, c.s.change(srcDir, srcPath))
+	writeChangeInfo(w, dstBefore, c.s.change(dstDir, dstPath))
+	return nfs4OK
+}
+
+// writeSecinfo writes the security flavors we support
+func writeSecinfo(w *xdrWriter) {
+	w.uint32(2)
+	w.uint32(rpcAuthSys)
+	w.uint32(rpcAuthNone)
+}
+
+func (c *compound4) opSecinfo(r *xdrReader, w *xdrWriter) uint32 {
+	name := r.string()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	if _, err := dir.Stat(name); err != nil {
+		return nfs4Status(err)
+	}
+	writeSecinfo(w)
+	c.cur = fh4{}
+	return nfs4OK
+}
+
+func (c *compound4) opSecinfoNoName(w *xdrWriter) uint32 {
+	if c.cur.fh == nil {
+		return nfs4ErrNoFileHandle
+	}
+	writeSecinfo(w)
+	c.cur = fh4{}
+	return nfs4OK
+}
+
+func (c *compound4) opSetattr(r *xdrReader, w *xdrWriter) uint32 {
+	id := c.resolveState(r.stateid())
+	sa, status := c.decodeSetAttrs(r)
+	if status == nfs4OK {
+		status = c.setattr(id, sa)
+	}
+	if status != nfs4OK {
+		sa.mask = nil
+	}
+	w.bitmap(sa.mask)
+	return status
+}
+
+// setattr sets the attributes in sa on the current file
+func (c *compound4) setattr(id stateid4, sa setAttrs4) uint32 {
+	node, status := c.node()
+	if status != nfs4OK {
+		return status
+	}
+	var handle vfs.Handle
+	if sa.hasSize {
+		if id.isSpecial() {
+			c.s.mu.Lock()
+			denied := c.s.shareConflict(c.cur.path, "", shareAccessWrite, 0)
+			c.s.mu.Unlock()
+			if denied {
+				return nfs4ErrLocked
+			}
+		} else {
+			handle, _, status = c.ioHandle(id, true)
+			if status != nfs4OK {
+				return status
+			}
+		}
+	}
+	return c.applySetAttrs(node, handle, sa)
+}
+
+func (c *compound4) opRead(r *xdrReader, w *xdrWriter) uint32 {
+	id := r.stateid()
+	offset := r.uint64()
+	count := min(r.uint32(), nfs4MaxIO)
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	node, status := c.file()
+	if status != nfs4OK {
+		return status
+	}
+	handle, temp, status := c.ioHandle(id, false)
+	if status != nfs4OK {
+		return status
+	}
+	if temp {
+		defer closeHandles([]vfs.Handle{handle})
+	}
+	buf := make([]byte, count)
+	n, err := handle.ReadAt(buf, int64(offset))
+	if err != nil && err != io.EOF {
+		return nfs4Status(err)
+	}
+	eof := err == io.EOF || int64(offset)+int64(n) >= node.Size()
+	w.bool(eof)
+	w.opaque(buf[:n])
+	return nfs4OK
+}
+
+func (c *compound4) opWrite(r *xdrReader, w *xdrWriter) uint32 {
+	id := r.stateid()
+	offset := r.uint64()
+	_ = r.uint32() // stable
+	data := r.opaque()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	if c.s.readOnly {
+		return nfs4ErrROFS
+	}
+	handle, _, status := c.ioHandle(id, true)
+	if status != nfs4OK {
+		return status
+	}
+	n, err := handle.WriteAt(data, int64(offset))
+	if err != nil {
+		return nfs4Status(err)
+	}
+	// The data has been handed to the VFS so it is as stable as we
+	// can make it
+	w.uint32(uint32(n))
+	w.uint32(fileSync4)
+	w.fixed(c.s.boot[:])
+	return nfs4OK
+}
+
+func (c *compound4) opCommit(r *xdrReader, w *xdrWriter) uint32 {
+	_ = r.uint64() // offset
+	_ = r.uint32() // count
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	w.fixed(c.s.boot[:])
+	return nfs4OK
+}
+
+func (c *compound4) opOpen(r *xdrReader, w *xdrWriter) uint32 {
+	_ = r.uint32() // seqid
+	access := r.uint32() & shareAccessMask
+	deny := r.uint32() & shareAccessMask
+	clientID := r.uint64()
+	ownerBytes := r.opaque()
+	var (
+		create     = r.uint32() == openCreate
+		createMode uint32
+		verifier   [8]byte
+		sa         setAttrs4
+		status     uint32
+	)
+	if create {
+		createMode = r.uint32()
+		switch createMode {
+		case createUnchecked, createGuarded:
+			sa, status = c.decodeSetAttrs(r)
+		case createExclusive:
+			copy(verifier[:], r.fixed(8))
+		case createExclusive41:
+			copy(verifier[:], r.fixed(8))
+			sa, status = c.decodeSetAttrs(r)
+		default:
+			return nfs4ErrInval
+		}
+		if status != nfs4OK {
+			return status
+		}
+	}
+	var name string
+	switch claim := r.uint32(); claim {
+	case claimNull:
+		name = r.string()
+	case claimFH:
+		if c.minor == 0 || create {
+			return nfs4ErrInval
+		}
+	case claimPrevious, claimDelegatePrev, claimDelegPrevFH:
+		return nfs4ErrNoGrace
+	case claimDelegateCur, claimDelegCurFH:
+		return nfs4ErrBadStateID // we never hand out delegations
+	default:
+		return nfs4ErrInval
+	}
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if access == 0 {
+		return nfs4ErrInval
+	}
+	cl, status := c.findClient(clientID)
+	if status != nfs4OK {
+		return status
+	}
+	write := access&shareAccessWrite != 0
+	if (write || create) && c.s.readOnly {
+		return nfs4ErrROFS
+	}
+
+	// Find the file to open
+	var (
+		dir     *vfs.Dir
+		dirPath string
+		p       = c.cur.path
+		before  uint64
+	)
+	if name != "" {
+		if dir, status = c.dir(); status != nfs4OK {
+			return status
+		}
+		if status := checkName(name); status != nfs4OK {
+			return status
+		}
+		dirPath = c.cur.path
+		p = joinPath(dirPath, name)
+		before = c.s.change(dir, dirPath)
+	}
+	flags := os.O_RDONLY
+	if write {
+		flags = os.O_RDWR
+	}
+	node, err := c.s.vfs.Stat(p)
+	switch {
+	case errors.Is(err, vfs.ENOENT):
+		if !create {
+			return nfs4ErrNoEnt
+		}
+		flags |= os.O_CREATE
+	case err != nil:
+		return nfs4Status(err)
+	case node.IsDir():
+		return nfs4ErrIsDir
+	case fileType(node) == nf4Lnk:
+		return nfs4ErrSymlink
+	case create && createMode == createGuarded:
+		return nfs4ErrExist
+	case create && (createMode == createExclusive || createMode == createExclusive41):
+		// This is OK if it is a retransmission of the create
+		c.s.mu.Lock()
+		stored, found := c.s.exclusive[p]
+		c.s.mu.Unlock()
+		if !found || stored != verifier {
+			return nfs4ErrExist
+		}
+		sa = setAttrs4{}
+	}
+	if sa.hasSize && sa.size == 0 && write {
+		flags |= os.O_TRUNC
+		sa.hasSize = false
+	}
+
+	// Check share reservations and find any existing open
+	owner := ownerKey(cl.id, ownerBytes)
+	c.s.mu.Lock()
+	if c.s.shareConflict(p, owner, access, deny) {
+		c.s.mu.Unlock()
+		return nfs4ErrShareDenied
+	}
+	st := c.s.findOpen(owner, p)
+	needOpen := st == nil || (write && !st.write)
+	c.s.mu.Unlock()
+
+	var handle vfs.Handle
+	if needOpen {
+		handle, err = c.s.vfs.OpenFile(p, flags, 0666)
+		if err != nil {
+			return nfs4Status(err)
+		}
+	}
+	var oldHandle vfs.Handle
+	c.s.mu.Lock()
+	if st == nil || c.s.states[st.id.other] != st {
+		st = c.s.newState(stateOpen, cl, owner, p)
+	} else {
+		st.id.seqid++
+	}
+	st.access |= access
+	st.deny |= deny
+	if handle != nil {
+		oldHandle, st.handle = st.handle, handle
+		st.write = write
+	}
+	if flags&os.O_CREATE != 0 {
+		c.s.bumpChange(dirPath)
+		if createMode == createExclusive || createMode == createExclusive41 {
+			c.s.exclusive[p] = verifier
+		}
+	}
+	id := st.id
+	handle = st.handle
+	c.s.mu.Unlock()
+	if oldHandle != nil {
+		closeHandles([]vfs.Handle{oldHandle})
+	}
+	if !needOpen && flags&os.O_TRUNC != 0 {
+		if err := handle.Truncate(0); err != nil {
+			return nfs4Status(err)
+		}
+	}
+	if status := c.applySetAttrs(handle.Node(), handle, sa); status != nfs4OK {
+		return status
+	}
+
+	c.setCur(p)
+	c.curState = id
+	after := before
+	if dir != nil {
+		after = c.s.change(dir, dirPath)
+	}
+	w.stateid(id)
+	writeChangeInfo(w, before, after)
+	w.uint32(openResultLocktypePosix)
+	w.bitmap(sa.mask)
+	w.uint32(openDelegateNone)
+	return nfs4OK
+}
+
+// findOpenState finds the open state for id
+func (c *compound4) findOpenState(id stateid4) (*state4, uint32) {
+	st, status := c.s.findState(c.resolveState(id), c.minor)
+	if status != nfs4OK {
+		return nil, status
+	}
+	if st.kind != stateOpen {
+		return nil, nfs4ErrBadStateID
+	}
+	return st, nfs4OK
+}
+
+func (c *compound4) opOpenConfirm(r *xdrReader, w *xdrWriter) uint32 {
+	id := r.stateid()
+	_ = r.uint32() // seqid
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	st, status := c.findOpenState(id)
+	if status != nfs4OK {
+		return status
+	}
+	st.id.seqid++
+	c.curState = st.id
+	w.stateid(st.id)
+	return nfs4OK
+}
+
+func (c *compound4) opOpenDowngrade(r *xdrReader, w *xdrWriter) uint32 {
+	id := r.stateid()
+	_ = r.uint32() // seqid
+	access := r.uint32() & shareAccessMask
+	deny := r.uint32() & shareAccessMask
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	st, status := c.findOpenState(id)
+	if status != nfs4OK {
+		return status
+	}
+	if access == 0 || access&^st.access != 0 || deny&^st.deny != 0 {
+		return nfs4ErrInval
+	}
+	st.access, st.deny = access, deny
+	st.id.seqid++
+	c.curState = st.id
+	w.stateid(st.id)
+	return nfs4OK
+}
+
+func (c *compound4) opClose(r *xdrReader, w *xdrWriter) uint32 {
+	_ = r.uint32() // seqid
+	id := r.stateid()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	st, status := c.findOpenState(id)
+	if status != nfs4OK {
+		c.s.mu.Unlock()
+		return status
+	}
+	handle := c.s.removeState(st)
+	st.id.seqid++
+	id = st.id
+	c.s.mu.Unlock()
+	if handle != nil {
+		if err := handle.Close(); err != nil {
+			return nfs4Status(err)
+		}
+	}
+	c.curState = id
+	w.stateid(id)
+	return nfs4OK
+}
+
+// writeDenied writes a LOCK4denied for the conflicting lock
+func writeDenied(w *xdrWriter, l *byteLock) {
+	w.uint64(l.start)
+	w.uint64(lockLength(l.start, l.end))
+	if l.write {
+		w.uint32(writeLT)
+	} else {
+		w.uint32(readLT)
+	}
+	w.uint64(l.state.client.id)
+	w.opaque(l.state.ownerBytes)
+}
+
+func (c *compound4) opLock(r *xdrReader, w *xdrWriter) uint32 {
+	lockType := r.uint32()
+	reclaim := r.bool()
+	offset := r.uint64()
+	length := r.uint64()
+	newOwner := r.bool()
+	var (
+		openID, lockID stateid4
+		clientID       uint64
+		ownerBytes     []byte
+	)
+	if newOwner {
+		_ = r.uint32() // open_seqid
+		openID = r.stateid()
+		_ = r.uint32() // lock_seqid
+		clientID = r.uint64()
+		ownerBytes = r.opaque()
+	} else {
+		lockID = r.stateid()
+		_ = r.uint32() // lock_seqid
+	}
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if lockType < readLT || lockType > writewLT {
+		return nfs4ErrInval
+	}
+	if reclaim {
+		return nfs4ErrNoGrace
+	}
+	end, ok := lockEnd(offset, length)
+	if !ok {
+		return nfs4ErrInval
+	}
+	write := lockType == writeLT || lockType == writewLT
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	var st *state4
+	if newOwner {
+		open, status := c.findOpenState(openID)
+		if status != nfs4OK {
+			return status
+		}
+		if c.minor >= 1 {
+			clientID = open.client.id
+		}
+		owner := ownerKey(clientID, ownerBytes)
+		for _, lockState := range open.locks {
+			if lockState.owner == owner {
+				st = lockState
+			}
+		}
+		if st == nil {
+			st = c.s.newState(stateLock, open.client, owner, open.path)
+			st.id.seqid = 0 // incremented to 1 below
+			st.open = open
+			st.ownerBytes = ownerBytes
+			open.locks = append(open.locks, st)
+		}
+	} else {
+		var status uint32
+		st, status = c.s.findState(c.resolveState(lockID), c.minor)
+		if status != nfs4OK {
+			return status
+		}
+		if st.kind != stateLock {
+			return nfs4ErrBadStateID
+		}
+	}
+	if write && st.open.access&shareAccessWrite == 0 {
+		return nfs4ErrOpenMode
+	}
+	if l := c.s.lockConflict(st.path, st.owner, offset, end, write); l != nil {
+		writeDenied(w, l)
+		return nfs4ErrDenied
+	}
+	c.s.unlockRange(st, offset, end)
+	c.s.locks[st.path] = append(c.s.locks[st.path], byteLock{state: st, start: offset, end: end, write: write})
+	st.id.seqid++
+	c.curState = st.id
+	w.stateid(st.id)
+	return nfs4OK
+}
+
+func (c *compound4) opLockT(r *xdrReader, w *xdrWriter) uint32 {
+	lockType := r.uint32()
+	offset := r.uint64()
+	length := r.uint64()
+	clientID := r.uint64()
+	ownerBytes := r.opaque()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if lockType < readLT || lockType > writewLT {
+		return nfs4ErrInval
+	}
+	end, ok := lockEnd(offset, length)
+	if !ok {
+		return nfs4ErrInval
+	}
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	if c.minor >= 1 {
+		clientID = c.client.id
+	}
+	owner := ownerKey(clientID, ownerBytes)
+	write := lockType == writeLT || lockType == writewLT
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if l := c.s.lockConflict(c.cur.path, owner, offset, end, write); l != nil {
+		writeDenied(w, l)
+		return nfs4ErrDenied
+	}
+	return nfs4OK
+}
+
+func (c *compound4) opLockU(r *xdrReader, w *xdrWriter) uint32 {
+	_ = r.uint32() // locktype
+	_ = r.uint32() // seqid
+	id := r.stateid()
+	offset := r.uint64()
+	length := r.uint64()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	end, ok := lockEnd(offset, length)
+	if !ok {
+		return nfs4ErrInval
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	st, status := c.s.findState(c.resolveState(id), c.minor)
+	if status != nfs4OK {
+		return status
+	}
+	if st.kind != stateLock {
+		return nfs4ErrBadStateID
+	}
+	c.s.unlockRange(st, offset, end)
+	st.id.seqid++
+	c.curState = st.id
+	w.stateid(st.id)
+	return nfs4OK
+}
+
+func (c *compound4) opReleaseLockOwner(r *xdrReader) uint32 {
+	clientID := r.uint64()
+	ownerBytes := r.opaque()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	owner := ownerKey(clientID, ownerBytes)
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	var lockStates []*state4
+	for _, st := range c.s.states {
+		if st.kind == stateLock && st.owner == owner {
+			if c.s.hasLocks(st) {
+				return nfs4ErrLocksHeld
+			}
+			lockStates = append(lockStates, st)
+		}
+	}
+	for _, st := range lockStates {
+		c.s.removeState(st)
+	}
+	return nfs4OK
+}
+
+func (c *compound4) opTestStateID(r *xdrReader, w *xdrWriter) uint32 {
+	n := r.uint32()
+	if n > 1024 {
+		return nfs4ErrBadXDR
+	}
+	ids := make([]stateid4, n)
+	for i := range ids {
+		ids[i] = r.stateid()
+	}
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	w.uint32(n)
+	for _, id := range ids {
+		_, status := c.s.findState(id, c.minor)
+		w.uint32(status)
+	}
+	return nfs4OK
+}
+
+func (c *compound4) opFreeStateID(r *xdrReader) uint32 {
+	id := r.stateid()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	st, status := c.s.findState(c.resolveState(id), c.minor)
+	if status != nfs4OK {
+		return status
+	}
+	if st.kind == stateOpen || c.s.hasLocks(st) {
+		return nfs4ErrLocksHeld
+	}
+	c.s.removeState(st)
+	return nfs4OK
+}
+
+func (c *compound4) opSetClientID(r *xdrReader, w *xdrWriter) uint32 {
+	var verifier [8]byte
+	copy(verifier[:], r.fixed(8))
+	owner := string(r.opaque())
+	_ = r.uint32() // cb_program
+	_ = r.string() // cb netid
+	_ = r.string() // cb addr
+	_ = r.uint32() // callback_ident
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	var cl *client4
+	for _, existing := range c.s.clients {
+		if existing.confirmed && existing.owner == owner && existing.verifier == verifier {
+			cl = existing
+		}
+	}
+	if cl == nil {
+		cl = &client4{
+			id:       c.s.newClientID(),
+			owner:    owner,
+			verifier: verifier,
+			sessions: map[[16]byte]*session4{},
+		}
+		c.s.clients[cl.id] = cl
+	}
+	cl.renewed = time.Now()
+	_, _ = rand.Read(cl.confirm[:])
+	w.uint64(cl.id)
+	w.fixed(cl.confirm[:])
+	return nfs4OK
+}
+
+func (c *compound4) opSetClientIDConfirm(r *xdrReader) uint32 {
+	id := r.uint64()
+	var confirm [8]byte
+	copy(confirm[:], r.fixed(8))
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	var handles []vfs.Handle
+	defer func() {
+		closeHandles(handles)
+	}()
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	cl := c.s.clients[id]
+	if cl == nil || cl.confirm != confirm {
+		return nfs4ErrStaleClientID
+	}
+	cl.confirmed = true
+	cl.renewed = time.Now()
+	// Any other records for this client are from before it rebooted
+	for _, other := range c.s.clients {
+		if other != cl && other.owner == cl.owner {
+			handles = append(handles, c.s.removeClient(other)...)
+		}
+	}
+	return nfs4OK
+}
+
+func (c *compound4) opExchangeID(r *xdrReader, w *xdrWriter) uint32 {
+	var verifier [8]byte
+	copy(verifier[:], r.fixed(8))
+	owner := string(r.opaque())
+	_ = r.uint32() // flags
+	switch r.uint32() {
+	case sp4None:
+	case sp4MachCred:
+		_, _ = r.bitmap(), r.bitmap()
+	default:
+		return nfs4ErrNotSupp
+	}
+	n := r.uint32()
+	if n > 1 {
+		return nfs4ErrBadXDR
+	}
+	for range n {
+		_, _, _ = r.string(), r.string(), r.time()
+	}
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	var handles []vfs.Handle
+	c.s.mu.Lock()
+	var cl *client4
+	for _, existing := range c.s.clients {
+		if existing.owner != owner {
+			continue
+		}
+		if existing.verifier == verifier {
+			cl = existing
+		} else {
+			// The client has rebooted so drop its old state
+			handles = append(handles, c.s.removeClient(existing)...)
+		}
+	}
+	if cl == nil {
+		cl = &client4{
+			id:       c.s.newClientID(),
+			owner:    owner,
+			verifier: verifier,
+			seqid:    1,
+			sessions: map[[16]byte]*session4{},
+		}
+		c.s.clients[cl.id] = cl
+	}
+	cl.renewed = time.Now()
+	flags := uint32(exchgIDFlagUseNonPNFS)
+	if cl.confirmed {
+		flags |= exchgIDFlagConfirmedR
+	}
+	w.uint64(cl.id)
+	w.uint32(cl.seqid)
+	w.uint32(flags)
+	c.s.mu.Unlock()
+	closeHandles(handles)
+	w.uint32(sp4None)
+	w.uint64(0) // server_owner minor id
+	w.string("rclone")
+	w.string("rclone") // server scope
+	w.uint32(1)
+	w.string("rclone.org")
+	w.string("rclone " + fs.Version)
+	w.time(time.Time{})
+	return nfs4OK
+}
+
+// channelAttrs4 are the attributes of a session channel
+type channelAttrs4 struct {
+	headerPadSize         uint32
+	maxRequestSize        uint32
+	maxResponseSize       uint32
+	maxResponseSizeCached uint32
+	maxOperations         uint32
+	maxRequests           uint32
+	rdmaIRD               []uint32
+}
+
+// read a channel_attrs4
+func (r *xdrReader) channelAttrs() (ca channelAttrs4) {
+	ca.headerPadSize = r.uint32()
+	ca.maxRequestSize = r.uint32()
+	ca.maxResponseSize = r.uint32()
+	ca.maxResponseSizeCached = r.uint32()
+	ca.maxOperations = r.uint32()
+	ca.maxRequests = r.uint32()
+	n := r.uint32()
+	if n > 1 {
+		r.err = errXDR
+		return ca
+	}
+	for range n {
+		ca.rdmaIRD = append(ca.rdmaIRD, r.uint32())
+	}
+	return ca
+}
+
+// write a channel_attrs4
+func (w *xdrWriter) channelAttrs(ca channelAttrs4) {
+	w.uint32(ca.headerPadSize)
+	w.uint32(ca.maxRequestSize)
+	w.uint32(ca.maxResponseSize)
+	w.uint32(ca.maxResponseSizeCached)
+	w.uint32(ca.maxOperations)
+	w.uint32(ca.maxRequests)
+	w.uint32(uint32(len(ca.rdmaIRD)))
+	for _, x := range ca.rdmaIRD {
+		w.uint32(x)
+	}
+}
+
+func (c *compound4) opCreateSession(r *xdrReader, w *xdrWriter) uint32 {
+	clientID := r.uint64()
+	seq := r.uint32()
+	_ = r.uint32() // flags
+	fore := r.channelAttrs()
+	back := r.channelAttrs()
+	_ = r.uint32() // cb_program
+	n := r.uint32()
+	if n > 16 {
+		return nfs4ErrBadXDR
+	}
+	for range n {
+		switch r.uint32() {
+		case rpcAuthSys:
+			_, _, _, _ = r.uint32(), r.string(), r.uint32(), r.uint32()
+			gids := r.uint32()
+			if gids > 16 {
+				return nfs4ErrBadXDR
+			}
+			for range gids {
+				_ = r.uint32()
+			}
+		case 6: // RPCSEC_GSS
+			_, _, _ = r.uint32(), r.opaque(), r.opaque()
+		}
+	}
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	cl := c.s.clients[clientID]
+	if cl == nil {
+		return nfs4ErrStaleClientID
+	}
+	if seq == cl.seqid-1 && cl.createReply != nil {
+		w.buf = append(w.buf, cl.createReply...)
+		return nfs4OK
+	}
+	if seq != cl.seqid {
+		return nfs4ErrSeqMisordered
+	}
+	cl.confirmed = true
+	cl.seqid++
+	cl.renewed = time.Now()
+	fore.headerPadSize = 0
+	fore.maxRequestSize = min(fore.maxRequestSize, nfs4MaxRecord)
+	fore.maxResponseSize = min(fore.maxResponseSize, nfs4MaxRecord)
+	fore.maxResponseSizeCached = min(fore.maxResponseSizeCached, nfs4MaxRecord)
+	fore.maxOperations = min(fore.maxOperations, nfs4MaxOps)
+	fore.maxRequests = max(min(fore.maxRequests, nfs4MaxSlots), 1)
+	fore.rdmaIRD = nil
+	back.rdmaIRD = nil
+	sess := &session4{
+		client: cl,
+		slots:  make([]slot4, fore.maxRequests),
+	}
+	_, _ = rand.Read(sess.id[:])
+	c.s.sessions[sess.id] = sess
+	cl.sessions[sess.id] = sess
+	res := &xdrWriter{}
+	res.fixed(sess.id[:])
+	res.uint32(seq)
+	res.uint32(0) // flags - no persistence or back channel
+	res.channelAttrs(fore)
+	res.channelAttrs(back)
+	cl.createReply = res.buf
+	w.buf = append(w.buf, res.buf...)
+	return nfs4OK
+}
+
+// findSession finds the session with the id read from r
+func (c *compound4) findSession(r *xdrReader) (sess *session4, status uint32) {
+	var id [16]byte
+	copy(id[:], r.fixed(16))
+	if r.err != nil {
+		return nil, nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	sess = c.s.sessions[id]
+	if sess == nil {
+		return nil, nfs4ErrBadSession
+	}
+	sess.client.renewed = time.Now()
+	return sess, nfs4OK
+}
+
+func (c *compound4) opDestroySession(r *xdrReader) uint32 {
+	sess, status := c.findSession(r)
+	if status != nfs4OK {
+		return status
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	delete(c.s.sessions, sess.id)
+	delete(sess.client.sessions, sess.id)
+	return nfs4OK
+}
+
+func (c *compound4) opBindConnToSession(r *xdrReader, w *xdrWriter) uint32 {
+	sess, status := c.findSession(r)
+	_ = r.uint32() // direction
+	_ = r.bool()   // use_conn_in_rdma_mode
+	if status != nfs4OK {
+		return status
+	}
+	w.fixed(sess.id[:])
+	w.uint32(cdfs4Fore)
+	w.bool(false)
+	return nfs4OK
+}
+
+func (c *compound4) opSequence(r *xdrReader, w *xdrWriter) uint32 {
+	sess, status := c.findSession(r)
+	seq := r.uint32()
+	slotID := r.uint32()
+	_ = r.uint32() // highest_slotid
+	_ = r.bool()   // cachethis
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if status != nfs4OK {
+		return status
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if slotID >= uint32(len(sess.slots)) {
+		return nfs4ErrBadSlot
+	}
+	slot := &sess.slots[slotID]
+	switch seq {
+	case slot.seqid + 1:
+		slot.seqid = seq
+		slot.busy = true
+		slot.reply = nil
+	case slot.seqid:
+		if slot.busy {
+			return nfs4ErrDelay
+		}
+		if slot.reply == nil {
+			return nfs4ErrRetryUncachedRep
+		}
+		c.replay = slot.reply
+		return nfs4OK
+	default:
+		return nfs4ErrSeqMisordered
+	}
+	c.session, c.slot, c.client = sess, slot, sess.client
+	highest := uint32(len(sess.slots) - 1)
+	w.fixed(sess.id[:])
+	w.uint32(seq)
+	w.uint32(slotID)
+	w.uint32(highest)
+	w.uint32(highest)
+	w.uint32(0) // status flags
+	return nfs4OK
+}
+
+func (c *compound4) opDestroyClientID(r *xdrReader) uint32 {
+	id := r.uint64()
+	if r.err != nil {
+		return nfs4ErrBadXDR
+	}
+	c.s.mu.Lock()
+	cl := c.s.clients[id]
+	if cl == nil {
+		c.s.mu.Unlock()
+		return nfs4ErrStaleClientID
+	}
+	if len(cl.sessions) > 0 {
+		c.s.mu.Unlock()
+		return nfs4ErrClientIDBusy
+	}
+	handles := c.s.removeClient(cl)
+	c.s.mu.Unlock()
+	closeHandles(handles)
+	return nfs4OK
+}
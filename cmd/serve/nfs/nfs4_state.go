@@ -0,0 +1,392 @@
+//go:build unix
+
+package nfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	nfs4LeaseTime = 90 * time.Second // how long a client lease lasts
+	nfs4MaxSlots  = 64               // max slots in a session
+	nfs4MaxOps    = 64               // max operations in a compound
+	nfs4MaxIO     = 1024 * 1024      // max read or write size
+	nfs4LockEOF   = math.MaxUint64   // lock length meaning up to EOF
+)
+
+// stateid4 identifies open and lock state
+type stateid4 struct {
+	seqid uint32
+	other [12]byte
+}
+
+// read a stateid4
+func (r *xdrReader) stateid() (id stateid4) {
+	id.seqid = r.uint32()
+	copy(id.other[:], r.fixed(12))
+	return id
+}
+
+// write a stateid4
+func (w *xdrWriter) stateid(id stateid4) {
+	w.uint32(id.seqid)
+	w.fixed(id.other[:])
+}
+
+// isSpecial returns true for the anonymous and read bypass stateids
+func (id stateid4) isSpecial() bool {
+	var zero, ones [12]byte
+	for i := range ones {
+		ones[i] = 0xFF
+	}
+	return (id.other == zero && id.seqid == 0) || (id.other == ones && id.seqid == math.MaxUint32)
+}
+
+// isCurrent returns true for the NFSv4.1 current stateid
+func (id stateid4) isCurrent() bool {
+	return id.other == [12]byte{} && id.seqid == 1
+}
+
+// client4 is a client record made by SETCLIENTID or EXCHANGE_ID
+type client4 struct {
+	id          uint64
+	owner       string  // the client supplied identifier
+	verifier    [8]byte // changes when the client reboots
+	confirm     [8]byte // for SETCLIENTID_CONFIRM
+	confirmed   bool
+	renewed     time.Time // last time the lease was renewed
+	seqid       uint32    // next CREATE_SESSION sequence id
+	createReply []byte    // last CREATE_SESSION reply for replays
+	sessions    map[[16]byte]*session4
+}
+
+// session4 is an NFSv4.1 session
+type session4 struct {
+	id     [16]byte
+	client *client4
+	mu     sync.Mutex
+	slots  []slot4
+}
+
+// slot4 is a slot in the session reply cache
+type slot4 struct {
+	seqid uint32
+	busy  bool
+	reply []byte // cached COMPOUND reply
+}
+
+// Kinds of state4
+const (
+	stateOpen = iota
+	stateLock
+)
+
+// state4 is the state identified by a stateid
+type state4 struct {
+	id     stateid4
+	kind   int
+	client *client4
+	owner  string // key for the open or lock owner
+	path   string // the file this state is for
+
+	// open state
+	access uint32     // share access bits
+	deny   uint32     // share deny bits
+	handle vfs.Handle // open VFS handle
+	write  bool       // set if handle is writable
+	locks  []*state4  // lock states for this open
+
+	// lock state
+	open       *state4 // the open this lock state belongs to
+	ownerBytes []byte  // lock owner as sent by the client
+}
+
+// byteLock is a byte range lock held by a lock owner
+type byteLock struct {
+	state *state4
+	start uint64
+	end   uint64 // exclusive, nfs4LockEOF for up to end of file
+	write bool
+}
+
+// overlaps returns true if the lock overlaps start, end
+func (l *byteLock) overlaps(start, end uint64) bool {
+	return l.start < end && start < l.end
+}
+
+// lockEnd returns the end of a lock range, or false if it is invalid
+func lockEnd(offset, length uint64) (uint64, bool) {
+	if length == 0 {
+		return 0, false
+	}
+	if length == nfs4LockEOF {
+		return nfs4LockEOF, true
+	}
+	end := offset + length
+	if end < offset {
+		return 0, false
+	}
+	return end, true
+}
+
+// lockLength converts an end back into an NFSv4 length
+func lockLength(start, end uint64) uint64 {
+	if end == nfs4LockEOF {
+		return nfs4LockEOF
+	}
+	return end - start
+}
+
+// ownerKey makes a key for an open or lock owner
+func ownerKey(clientID uint64, owner []byte) string {
+	return string(binary.BigEndian.AppendUint64(nil, clientID)) + string(owner)
+}
+
+// newClientID makes a new client ID with the boot time in the top bits
+//
+// Call with s.mu held
+func (s *server4) newClientID() uint64 {
+	s.clientSeq++
+	return uint64(binary.BigEndian.Uint32(s.boot[:4]))<<32 | s.clientSeq&math.MaxUint32
+}
+
+// newState makes a new state and stores it
+//
+// Call with s.mu held
+func (s *server4) newState(kind int, cl *client4, owner, path string) *state4 {
+	s.stateSeq++
+	st := &state4{
+		kind:   kind,
+		client: cl,
+		owner:  owner,
+		path:   path,
+	}
+	st.id.seqid = 1
+	copy(st.id.other[:4], s.boot[:4])
+	binary.BigEndian.PutUint64(st.id.other[4:], s.stateSeq)
+	s.states[st.id.other] = st
+	return st
+}
+
+// findState finds the state for id returning an NFS status
+//
+// Call with s.mu held
+func (s *server4) findState(id stateid4, minor uint32) (*state4, uint32) {
+	st := s.states[id.other]
+	if st == nil {
+		if minor == 0 && !bytes.Equal(id.other[:4], s.boot[:4]) {
+			return nil, nfs4ErrStaleStateID
+		}
+		return nil, nfs4ErrBadStateID
+	}
+	// A seqid of 0 means the current seqid in NFSv4.1
+	if id.seqid != st.id.seqid && (minor == 0 || id.seqid != 0) {
+		if id.seqid < st.id.seqid {
+			return nil, nfs4ErrOldStateID
+		}
+		return nil, nfs4ErrBadStateID
+	}
+	st.client.renewed = time.Now()
+	return st, nfs4OK
+}
+
+// findOpen finds an open state for the owner and path
+//
+// Call with s.mu held
+func (s *server4) findOpen(owner, path string) *state4 {
+	for _, st := range s.states {
+		if st.kind == stateOpen && st.owner == owner && st.path == path {
+			return st
+		}
+	}
+	return nil
+}
+
+// shareConflict checks whether an open with access and deny
+// conflicts with any other open of path
+//
+// Call with s.mu held
+func (s *server4) shareConflict(path, owner string, access, deny uint32) bool {
+	for _, st := range s.states {
+		if st.kind != stateOpen || st.path != path || st.owner == owner {
+			continue
+		}
+		if access&st.deny != 0 || deny&st.access != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lockConflict returns the first lock on path which conflicts with a
+// lock from owner
+//
+// Call with s.mu held
+func (s *server4) lockConflict(path, owner string, start, end uint64, write bool) *byteLock {
+	for i := range s.locks[path] {
+		l := &s.locks[path][i]
+		if l.state.owner != owner && l.overlaps(start, end) && (write || l.write) {
+			return l
+		}
+	}
+	return nil
+}
+
+// unlockRange removes the range start, end from the locks held by
+// the lock state st, splitting locks as necessary
+//
+// Call with s.mu held
+func (s *server4) unlockRange(st *state4, start, end uint64) {
+	locks := s.locks[st.path]
+	newLocks := locks[:0:0]
+	for _, l := range locks {
+		if l.state.owner != st.owner || !l.overlaps(start, end) {
+			newLocks = append(newLocks, l)
+			continue
+		}
+		if l.start < start {
+			before := l
+			before.end = start
+			newLocks = append(newLocks, before)
+		}
+		if l.end > end {
+			after := l
+			after.start = end
+			newLocks = append(newLocks, after)
+		}
+	}
+	if len(newLocks) == 0 {
+		delete(s.locks, st.path)
+	} else {
+		s.locks[st.path] = newLocks
+	}
+}
+
+// hasLocks returns true if the lock state holds any locks
+//
+// Call with s.mu held
+func (s *server4) hasLocks(st *state4) bool {
+	for _, l := range s.locks[st.path] {
+		if l.state == st {
+			return true
+		}
+	}
+	return false
+}
+
+// removeState removes a state and any lock states which depend on
+// it, returning the handle to close if any
+//
+// Call with s.mu held
+func (s *server4) removeState(st *state4) (handle vfs.Handle) {
+	delete(s.states, st.id.other)
+	switch st.kind {
+	case stateOpen:
+		for _, lockState := range st.locks {
+			s.removeState(lockState)
+		}
+		st.locks = nil
+		handle, st.handle = st.handle, nil
+	case stateLock:
+		s.unlockRange(st, 0, nfs4LockEOF)
+		if open := st.open; open != nil {
+			for i, lockState := range open.locks {
+				if lockState == st {
+					open.locks = append(open.locks[:i], open.locks[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return handle
+}
+
+// removeClient removes a client and all of its state returning the
+// handles which need closing
+//
+// Call with s.mu held
+func (s *server4) removeClient(cl *client4) (handles []vfs.Handle) {
+	for id := range cl.sessions {
+		delete(s.sessions, id)
+	}
+	for _, st := range s.states {
+		if st.client == cl && st.kind == stateOpen {
+			if handle := s.removeState(st); handle != nil {
+				handles = append(handles, handle)
+			}
+		}
+	}
+	for _, st := range s.states {
+		if st.client == cl {
+			s.removeState(st)
+		}
+	}
+	delete(s.clients, cl.id)
+	return handles
+}
+
+// closeHandles closes the handles passed in logging any errors
+func closeHandles(handles []vfs.Handle) {
+	for _, handle := range handles {
+		if err := handle.Close(); err != nil {
+			fs.Errorf(handle.Node().Path(), "NFSv4: error closing file: %v", err)
+		}
+	}
+}
+
+// expireClients removes clients whose leases have expired
+func (s *server4) expireClients() {
+	var handles []vfs.Handle
+	s.mu.Lock()
+	for _, cl := range s.clients {
+		if time.Since(cl.renewed) > 2*nfs4LeaseTime {
+			fs.Debugf("nfs", "NFSv4: expiring client %016x", cl.id)
+			handles = append(handles, s.removeClient(cl)...)
+		}
+	}
+	s.mu.Unlock()
+	closeHandles(handles)
+}
+
+// bumpChange records that the directory at dirPath has changed
+//
+// Call with s.mu held
+func (s *server4) bumpChange(dirPath string) {
+	s.dirChange[dirPath]++
+}
+
+// renamePath updates the state for files at or below oldPath
+//
+// Call with s.mu held
+func (s *server4) renamePath(oldPath, newPath string) {
+	rename := func(p string) (string, bool) {
+		if p == oldPath {
+			return newPath, true
+		}
+		if rest, ok := strings.CutPrefix(p, oldPath+"/"); ok {
+			return newPath + "/" + rest, true
+		}
+		return p, false
+	}
+	for _, st := range s.states {
+		st.path, _ = rename(st.path)
+	}
+	renamed := map[string][]byteLock{}
+	for p, locks := range s.locks {
+		if np, ok := rename(p); ok {
+			delete(s.locks, p)
+			renamed[np] = locks
+		}
+	}
+	for p, locks := range renamed {
+		s.locks[p] = locks
+	}
+}
@@ -0,0 +1,568 @@
+//go:build unix
+
+package nfs
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// start an NFSv4 server serving dir returning its address
+func start4(t *testing.T, dir string, cacheMode vfscommon.CacheMode) string {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	vfsOpt := vfscommon.Opt
+	vfsOpt.CacheMode = cacheMode
+	vfsOpt.WriteBack = 0
+	VFS := vfs.New(f, &vfsOpt)
+	opt := Opt
+	opt.Version = 4
+	opt.ListenAddr = "localhost:0"
+	s, err := NewServer(ctx, VFS, &opt)
+	require.NoError(t, err)
+	quit := make(chan struct{})
+	go func() {
+		assert.NoError(t, s.Serve())
+		close(quit)
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, s.Shutdown())
+		<-quit
+		VFS.Shutdown()
+	})
+	return s.Addr().String()
+}
+
+// testClient4 is a minimal NFSv4 client
+type testClient4 struct {
+	t        *testing.T
+	conn     net.Conn
+	xid      uint32
+	minor    uint32
+	clientID uint64
+	session  [16]byte
+	seqid    uint32
+}
+
+func newTestClient4(t *testing.T, addr string, minor uint32) *testClient4 {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &testClient4{t: t, conn: conn, minor: minor}
+}
+
+// rpc makes an RPC call returning the results after the RPC header
+func (tc *testClient4) rpc(proc uint32, args []byte) *xdrReader {
+	tc.xid++
+	w := &xdrWriter{}
+	w.uint32(tc.xid)
+	w.uint32(rpcCall)
+	w.uint32(rpcVersion)
+	w.uint32(nfs4Program)
+	w.uint32(nfs4Version)
+	w.uint32(proc)
+	cred := &xdrWriter{}
+	cred.uint32(0)      // stamp
+	cred.string("test") // machine name
+	cred.uint32(0)      // uid
+	cred.uint32(0)      // gid
+	cred.uint32(0)      // gids
+	w.uint32(rpcAuthSys)
+	w.opaque(cred.buf)
+	w.uint32(rpcAuthNone)
+	w.opaque(nil)
+	w.buf = append(w.buf, args...)
+	record := binary.BigEndian.AppendUint32(nil, rpcLastFragment|uint32(len(w.buf)))
+	_, err := tc.conn.Write(append(record, w.buf...))
+	require.NoError(tc.t, err)
+	reply, err := readRecord(tc.conn)
+	require.NoError(tc.t, err)
+	r := &xdrReader{buf: reply}
+	require.Equal(tc.t, tc.xid, r.uint32())
+	require.Equal(tc.t, uint32(rpcReply), r.uint32())
+	require.Equal(tc.t, uint32(rpcMsgAccepted), r.uint32())
+	_, _ = r.uint32(), r.opaque() // verifier
+	require.Equal(tc.t, uint32(rpcSuccess), r.uint32())
+	return r
+}
+
+// ops4 builds the operations for a COMPOUND
+type ops4 struct {
+	xdrWriter
+	n uint32
+}
+
+// op adds an operation
+func (o *ops4) op(op uint32) *ops4 {
+	o.n++
+	o.uint32(op)
+	return o
+}
+
+// sequence adds a SEQUENCE op for an NFSv4.1 client
+func (tc *testClient4) sequence() *ops4 {
+	o := &ops4{}
+	if tc.minor >= 1 {
+		tc.seqid++
+		o.op(opSequence)
+		o.fixed(tc.session[:])
+		o.uint32(tc.seqid)
+		o.uint32(0) // slot
+		o.uint32(0) // highest slot
+		o.bool(false)
+	}
+	return o
+}
+
+// compound4 sends a COMPOUND returning its status and the results
+func (tc *testClient4) compound(o *ops4) (uint32, *xdrReader) {
+	w := &xdrWriter{}
+	w.string("test")
+	w.uint32(tc.minor)
+	w.uint32(o.n)
+	w.buf = append(w.buf, o.buf...)
+	r := tc.rpc(nfs4ProcCompound, w.buf)
+	status := r.uint32()
+	assert.Equal(tc.t, "test", r.string())
+	_ = r.uint32() // count
+	if tc.minor >= 1 && o.n > 0 && binary.BigEndian.Uint32(o.buf) == opSequence {
+		tc.result(r, opSequence)
+		_ = r.fixed(16)
+		_, _, _, _, _ = r.uint32(), r.uint32(), r.uint32(), r.uint32(), r.uint32()
+	}
+	return status, r
+}
+
+// result reads the op and status of a result
+func (tc *testClient4) result(r *xdrReader, op uint32) uint32 {
+	require.Equal(tc.t, op, r.uint32())
+	return r.uint32()
+}
+
+// setup sets up the client ID and session
+func (tc *testClient4) setup() {
+	if tc.minor == 0 {
+		o := (&ops4{}).op(opSetClientID)
+		o.fixed([]byte("verifier"))
+		o.string("test client")
+		o.uint32(0)
+		o.string("tcp")
+		o.string("127.0.0.1.0.0")
+		o.uint32(0)
+		status, r := tc.compound(o)
+		require.Equal(tc.t, uint32(nfs4OK), status)
+		require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opSetClientID))
+		tc.clientID = r.uint64()
+		confirm := r.fixed(8)
+		o = (&ops4{}).op(opSetClientIDConfirm)
+		o.uint64(tc.clientID)
+		o.fixed(confirm)
+		status, _ = tc.compound(o)
+		require.Equal(tc.t, uint32(nfs4OK), status)
+		return
+	}
+	o := (&ops4{}).op(opExchangeID)
+	o.fixed([]byte("verifier"))
+	o.string("test client")
+	o.uint32(0) // flags
+	o.uint32(0) // SP4_NONE
+	o.uint32(0) // no implementation id
+	status, r := tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opExchangeID))
+	tc.clientID = r.uint64()
+	seq := r.uint32()
+	o = (&ops4{}).op(opCreateSession)
+	o.uint64(tc.clientID)
+	o.uint32(seq)
+	o.uint32(0) // flags
+	for range 2 {
+		o.uint32(0)       // header pad
+		o.uint32(1 << 20) // max request
+		o.uint32(1 << 20) // max response
+		o.uint32(4096)    // max response cached
+		o.uint32(16)      // max operations
+		o.uint32(4)       // max requests
+		o.uint32(0)       // rdma ird
+	}
+	o.uint32(0x40000000) // cb_program
+	o.uint32(1)
+	o.uint32(rpcAuthNone)
+	status, r = tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opCreateSession))
+	copy(tc.session[:], r.fixed(16))
+	o = tc.sequence().op(opReclaimComplete)
+	o.bool(false)
+	status, _ = tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+}
+
+// lookup adds ops to look up path from the root
+func lookup(o *ops4, names ...string) *ops4 {
+	o.op(opPutRootFH)
+	for _, name := range names {
+		o.op(opLookup).string(name)
+	}
+	return o
+}
+
+// readLookup reads the results for the ops added by lookup
+func (tc *testClient4) readLookup(r *xdrReader, names ...string) {
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opPutRootFH))
+	for range names {
+		require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opLookup))
+	}
+}
+
+// open opens name in the root with access and deny for owner
+// returning the status and stateid
+func (tc *testClient4) open(name, owner string, access, deny uint32, create bool) (uint32, stateid4) {
+	o := lookup(tc.sequence())
+	o.op(opOpen)
+	o.uint32(0) // seqid
+	o.uint32(access)
+	o.uint32(deny)
+	o.uint64(tc.clientID)
+	o.string(owner)
+	if create {
+		o.uint32(openCreate)
+		o.uint32(createUnchecked)
+		o.bitmap(nil)
+		o.opaque(nil)
+	} else {
+		o.uint32(0)
+	}
+	o.uint32(claimNull)
+	o.string(name)
+	status, r := tc.compound(o)
+	if status != nfs4OK {
+		return status, stateid4{}
+	}
+	tc.readLookup(r)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opOpen))
+	return status, r.stateid()
+}
+
+// fileOps adds ops to select name in the root
+func fileOps(tc *testClient4, name string) *ops4 {
+	return lookup(tc.sequence(), name)
+}
+
+// writeStatus writes data to name returning the status of the WRITE
+func (tc *testClient4) writeStatus(name string, id stateid4, offset uint64, data string) uint32 {
+	o := fileOps(tc, name).op(opWrite)
+	o.stateid(id)
+	o.uint64(offset)
+	o.uint32(fileSync4)
+	o.opaque([]byte(data))
+	status, _ := tc.compound(o)
+	return status
+}
+
+func (tc *testClient4) write(name string, id stateid4, offset uint64, data string) {
+	o := fileOps(tc, name).op(opWrite)
+	o.stateid(id)
+	o.uint64(offset)
+	o.uint32(fileSync4)
+	o.opaque([]byte(data))
+	status, r := tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+	tc.readLookup(r, name)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opWrite))
+	assert.Equal(tc.t, uint32(len(data)), r.uint32())
+}
+
+// readStatus reads from name returning the status of the READ
+func (tc *testClient4) readStatus(name string, id stateid4) uint32 {
+	o := fileOps(tc, name).op(opRead)
+	o.stateid(id)
+	o.uint64(0)
+	o.uint32(100)
+	status, _ := tc.compound(o)
+	return status
+}
+
+func (tc *testClient4) read(name string, id stateid4, offset uint64, count uint32) (string, bool) {
+	o := fileOps(tc, name).op(opRead)
+	o.stateid(id)
+	o.uint64(offset)
+	o.uint32(count)
+	status, r := tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+	tc.readLookup(r, name)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opRead))
+	eof := r.bool()
+	return string(r.opaque()), eof
+}
+
+func (tc *testClient4) close(name string, id stateid4) {
+	o := fileOps(tc, name).op(opClose)
+	o.uint32(0)
+	o.stateid(id)
+	status, _ := tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+}
+
+// getattr returns the type and size of path
+func (tc *testClient4) getattr(names ...string) (uint32, uint32, uint64) {
+	o := lookup(tc.sequence(), names...).op(opGetattr)
+	o.bitmap(makeBitmap([]int{attrType, attrSize}))
+	status, r := tc.compound(o)
+	if status != nfs4OK {
+		return status, 0, 0
+	}
+	tc.readLookup(r, names...)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opGetattr))
+	_ = r.bitmap()
+	vals := &xdrReader{buf: r.opaque()}
+	return status, vals.uint32(), vals.uint64()
+}
+
+// readdir returns the names in the root
+func (tc *testClient4) readdir(names ...string) (entries []string) {
+	o := lookup(tc.sequence(), names...).op(opReaddir)
+	o.uint64(0)
+	o.fixed(make([]byte, 8))
+	o.uint32(4096)
+	o.uint32(8192)
+	o.bitmap(makeBitmap([]int{attrType}))
+	status, r := tc.compound(o)
+	require.Equal(tc.t, uint32(nfs4OK), status)
+	tc.readLookup(r, names...)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opReaddir))
+	_ = r.fixed(8)
+	for r.bool() {
+		_ = r.uint64()
+		entries = append(entries, r.string())
+		_, _ = r.bitmap(), r.opaque()
+	}
+	assert.True(tc.t, r.bool())
+	return entries
+}
+
+// lock locks or tests a range returning the status
+func (tc *testClient4) lock(name string, openID stateid4, owner string, offset, length uint64) (uint32, stateid4) {
+	o := fileOps(tc, name).op(opLock)
+	o.uint32(writeLT)
+	o.bool(false)
+	o.uint64(offset)
+	o.uint64(length)
+	o.bool(true)
+	o.uint32(0)
+	o.stateid(openID)
+	o.uint32(0)
+	o.uint64(tc.clientID)
+	o.string(owner)
+	status, r := tc.compound(o)
+	if status != nfs4OK {
+		return status, stateid4{}
+	}
+	tc.readLookup(r, name)
+	require.Equal(tc.t, uint32(nfs4OK), tc.result(r, opLock))
+	return status, r.stateid()
+}
+
+func testNFSv4(t *testing.T, minor uint32) {
+	dir := t.TempDir()
+	addr := start4(t, dir, vfscommon.CacheModeWrites)
+	tc := newTestClient4(t, addr, minor)
+	tc.rpc(nfs4ProcNull, nil)
+	tc.setup()
+
+	// Root is a directory
+	status, fileType, _ := tc.getattr()
+	require.Equal(t, uint32(nfs4OK), status)
+	assert.Equal(t, uint32(nf4Dir), fileType)
+
+	// Create and write a file then read it back
+	status, id := tc.open("file.txt", "owner1", shareAccessMask, 0, true)
+	require.Equal(t, uint32(nfs4OK), status)
+	tc.write("file.txt", id, 0, "hello world")
+	data, eof := tc.read("file.txt", id, 6, 100)
+	assert.Equal(t, "world", data)
+	assert.True(t, eof)
+
+	// The special stateids can read but not write
+	data, _ = tc.read("file.txt", stateid4{}, 0, 5)
+	assert.Equal(t, "hello", data)
+	assert.Equal(t, uint32(nfs4ErrOpenMode), tc.writeStatus("file.txt", stateid4{}, 0, "potato"))
+
+	// Share reservations and byte range locks
+	status, id2 := tc.open("file.txt", "owner2", shareAccessMask, 0, false)
+	require.Equal(t, uint32(nfs4OK), status)
+	status, lockID := tc.lock("file.txt", id, "locker1", 0, 10)
+	require.Equal(t, uint32(nfs4OK), status)
+	status, _ = tc.lock("file.txt", id2, "locker2", 5, 10)
+	assert.Equal(t, uint32(nfs4ErrDenied), status)
+	status, _ = tc.lock("file.txt", id2, "locker2", 10, 10)
+	assert.Equal(t, uint32(nfs4OK), status)
+	o := fileOps(tc, "file.txt").op(opLockU)
+	o.uint32(writeLT)
+	o.uint32(0)
+	o.stateid(lockID)
+	o.uint64(0)
+	o.uint64(nfs4LockEOF)
+	status, _ = tc.compound(o)
+	require.Equal(t, uint32(nfs4OK), status)
+	status, _ = tc.lock("file.txt", id2, "locker2", 5, 10)
+	assert.Equal(t, uint32(nfs4OK), status)
+	tc.close("file.txt", id2)
+	tc.close("file.txt", id)
+
+	// The special stateids honour the share reservations
+	status, id = tc.open("file.txt", "owner1", shareAccessRead, shareAccessRead, false)
+	require.Equal(t, uint32(nfs4OK), status)
+	assert.Equal(t, uint32(nfs4ErrLocked), tc.readStatus("file.txt", stateid4{}))
+	tc.close("file.txt", id)
+
+	// The file is written to the disk when closed
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+		return err == nil && string(data) == "hello world"
+	}, 10*time.Second, 10*time.Millisecond)
+	status, fileType, size := tc.getattr("file.txt")
+	require.Equal(t, uint32(nfs4OK), status)
+	assert.Equal(t, uint32(nf4Reg), fileType)
+	assert.Equal(t, uint64(11), size)
+
+	// Make a directory and move the file into it
+	o = lookup(tc.sequence()).op(opCreate)
+	o.uint32(nf4Dir)
+	o.string("dir")
+	o.bitmap(nil)
+	o.opaque(nil)
+	status, _ = tc.compound(o)
+	require.Equal(t, uint32(nfs4OK), status)
+	assert.Equal(t, []string{"dir", "file.txt"}, tc.readdir())
+	o = lookup(tc.sequence()).op(opSaveFH)
+	lookup(o, "dir").op(opRename)
+	o.string("file.txt")
+	o.string("moved.txt")
+	status, _ = tc.compound(o)
+	require.Equal(t, uint32(nfs4OK), status)
+	assert.Equal(t, []string{"moved.txt"}, tc.readdir("dir"))
+	_, err := os.Stat(filepath.Join(dir, "dir", "moved.txt"))
+	require.NoError(t, err)
+
+	// Can't remove a non empty directory
+	o = lookup(tc.sequence()).op(opRemove)
+	o.string("dir")
+	status, _ = tc.compound(o)
+	assert.Equal(t, uint32(nfs4ErrNotEmpty), status)
+	o = lookup(tc.sequence(), "dir").op(opRemove)
+	o.string("moved.txt")
+	status, _ = tc.compound(o)
+	require.Equal(t, uint32(nfs4OK), status)
+	status, _, _ = tc.getattr("dir", "moved.txt")
+	assert.Equal(t, uint32(nfs4ErrNoEnt), status)
+	_, err = os.Stat(filepath.Join(dir, "dir", "moved.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNFSv4(t *testing.T) {
+	t.Run("4.0", func(t *testing.T) {
+		testNFSv4(t, 0)
+	})
+	t.Run("4.1", func(t *testing.T) {
+		testNFSv4(t, 1)
+	})
+}
+
+func TestNFSv4Sessions(t *testing.T) {
+	addr := start4(t, t.TempDir(), vfscommon.CacheModeWrites)
+	tc := newTestClient4(t, addr, 1)
+	tc.setup()
+
+	// Ops need a session
+	status, _ := tc.compound((&ops4{}).op(opPutRootFH))
+	assert.Equal(t, uint32(nfs4ErrOpNotInSession), status)
+
+	// Retransmissions get the cached reply
+	o := lookup(tc.sequence()).op(opGetFH)
+	status, r := tc.compound(o)
+	require.Equal(t, uint32(nfs4OK), status)
+	first := r.buf
+	status, r = tc.compound(o)
+	require.Equal(t, uint32(nfs4OK), status)
+	assert.Equal(t, first, r.buf)
+
+	// A sequence id which is too far ahead is misordered
+	tc.seqid++
+	status, _ = tc.compound(lookup(tc.sequence()))
+	assert.Equal(t, uint32(nfs4ErrSeqMisordered), status)
+
+	// Unknown minor versions are rejected
+	tc.minor = 2
+	status, _ = tc.compound(&ops4{})
+	assert.Equal(t, uint32(nfs4ErrMinorVersMismatch), status)
+}
+
+func TestNFSv4ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+	addr := start4(t, dir, vfscommon.CacheModeOff)
+	tc := newTestClient4(t, addr, 0)
+	tc.setup()
+
+	status, _ := tc.open("new.txt", "owner", shareAccessMask, 0, true)
+	assert.Equal(t, uint32(nfs4ErrROFS), status)
+
+	status, id := tc.open("file.txt", "owner", shareAccessRead, 0, false)
+	require.Equal(t, uint32(nfs4OK), status)
+	data, eof := tc.read("file.txt", id, 0, 100)
+	assert.Equal(t, "hello", data)
+	assert.True(t, eof)
+	tc.close("file.txt", id)
+}
+
+func TestLockRanges(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	VFS := vfs.New(f, nil)
+	defer VFS.Shutdown()
+	s := newServer4(&Handler{vfs: VFS})
+	cl := &client4{}
+	a := s.newState(stateLock, cl, "a", "file")
+	b := s.newState(stateLock, cl, "b", "file")
+	s.locks["file"] = []byteLock{{state: a, start: 0, end: 100, write: true}}
+
+	// Unlocking the middle splits the lock
+	s.unlockRange(a, 10, 20)
+	assert.Nil(t, s.lockConflict("file", "b", 10, 20, true))
+	assert.Equal(t, &s.locks["file"][0], s.lockConflict("file", "b", 0, 11, true))
+	assert.Equal(t, &s.locks["file"][1], s.lockConflict("file", "b", 19, nfs4LockEOF, false))
+	assert.Nil(t, s.lockConflict("file", "a", 0, nfs4LockEOF, true))
+
+	// Read locks don't conflict with each other
+	s.locks["file"] = []byteLock{{state: a, start: 0, end: 100}}
+	assert.Nil(t, s.lockConflict("file", "b", 0, 10, false))
+	assert.NotNil(t, s.lockConflict("file", "b", 0, 10, true))
+
+	// Removing the state removes the locks
+	s.removeState(a)
+	assert.Nil(t, s.lockConflict("file", "b", 0, nfs4LockEOF, true))
+	assert.False(t, s.hasLocks(b))
+
+	end, ok := lockEnd(10, 0)
+	assert.False(t, ok)
+	end, ok = lockEnd(nfs4LockEOF-1, 10)
+	assert.False(t, ok)
+	end, ok = lockEnd(10, 10)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(20), end)
+}
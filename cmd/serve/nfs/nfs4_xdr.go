@@ -0,0 +1,301 @@
+//go:build unix
+
+package nfs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ONC RPC constants (RFC 5531)
+const (
+	rpcVersion      = 2
+	rpcCall         = 0
+	rpcReply        = 1
+	rpcMsgAccepted  = 0
+	rpcMsgDenied    = 1
+	rpcSuccess      = 0
+	rpcProgUnavail  = 1
+	rpcProgMismatch = 2
+	rpcProcUnavail  = 3
+	rpcGarbageArgs  = 4
+	rpcMismatch     = 0
+	rpcAuthError    = 1
+	rpcAuthTooWeak  = 5
+	rpcAuthNone     = 0
+	rpcAuthSys      = 1
+	rpcLastFragment = 0x80000000
+)
+
+// NFSv4 program constants
+const (
+	nfs4Program      = 100003
+	nfs4Version      = 4
+	nfs4ProcNull     = 0
+	nfs4ProcCompound = 1
+	nfs4MaxMinor     = 1
+)
+
+// NFSv4 operation numbers (RFC 7530 and RFC 5661)
+const (
+	opAccess             = 3
+	opClose              = 4
+	opCommit             = 5
+	opCreate             = 6
+	opDelegPurge         = 7
+	opDelegReturn        = 8
+	opGetattr            = 9
+	opGetFH              = 10
+	opLink               = 11
+	opLock               = 12
+	opLockT              = 13
+	opLockU              = 14
+	opLookup             = 15
+	opLookupP            = 16
+	opNVerify            = 17
+	opOpen               = 18
+	opOpenAttr           = 19
+	opOpenConfirm        = 20
+	opOpenDowngrade      = 21
+	opPutFH              = 22
+	opPutPubFH           = 23
+	opPutRootFH          = 24
+	opRead               = 25
+	opReaddir            = 26
+	opReadlink           = 27
+	opRemove             = 28
+	opRename             = 29
+	opRenew              = 30
+	opRestoreFH          = 31
+	opSaveFH             = 32
+	opSecinfo            = 33
+	opSetattr            = 34
+	opSetClientID        = 35
+	opSetClientIDConfirm = 36
+	opVerify             = 37
+	opWrite              = 38
+	opReleaseLockOwner   = 39
+	opBindConnToSession  = 41
+	opExchangeID         = 42
+	opCreateSession      = 43
+	opDestroySession     = 44
+	opFreeStateID        = 45
+	opSecinfoNoName      = 52
+	opSequence           = 53
+	opTestStateID        = 55
+	opDestroyClientID    = 57
+	opReclaimComplete    = 58
+	opIllegal            = 10044
+)
+
+// nfsstat4 values
+const (
+	nfs4OK                   = 0
+	nfs4ErrPerm              = 1
+	nfs4ErrNoEnt             = 2
+	nfs4ErrIO                = 5
+	nfs4ErrExist             = 17
+	nfs4ErrNotDir            = 20
+	nfs4ErrIsDir             = 21
+	nfs4ErrInval             = 22
+	nfs4ErrROFS              = 30
+	nfs4ErrNameTooLong       = 63
+	nfs4ErrNotEmpty          = 66
+	nfs4ErrStale             = 70
+	nfs4ErrBadHandle         = 10001
+	nfs4ErrBadCookie         = 10003
+	nfs4ErrNotSupp           = 10004
+	nfs4ErrTooSmall          = 10005
+	nfs4ErrBadType           = 10007
+	nfs4ErrDelay             = 10008
+	nfs4ErrSame              = 10009
+	nfs4ErrDenied            = 10010
+	nfs4ErrLocked            = 10012
+	nfs4ErrShareDenied       = 10015
+	nfs4ErrClidInUse         = 10017
+	nfs4ErrNoFileHandle      = 10020
+	nfs4ErrMinorVersMismatch = 10021
+	nfs4ErrStaleClientID     = 10022
+	nfs4ErrStaleStateID      = 10023
+	nfs4ErrOldStateID        = 10024
+	nfs4ErrBadStateID        = 10025
+	nfs4ErrNotSame           = 10027
+	nfs4ErrSymlink           = 10029
+	nfs4ErrRestoreFH         = 10030
+	nfs4ErrAttrNotSupp       = 10032
+	nfs4ErrNoGrace           = 10033
+	nfs4ErrBadXDR            = 10036
+	nfs4ErrLocksHeld         = 10037
+	nfs4ErrOpenMode          = 10038
+	nfs4ErrBadName           = 10041
+	nfs4ErrOpIllegal         = 10044
+	nfs4ErrBadSession        = 10052
+	nfs4ErrBadSlot           = 10053
+	nfs4ErrSeqMisordered     = 10063
+	nfs4ErrSequencePos       = 10064
+	nfs4ErrRetryUncachedRep  = 10068
+	nfs4ErrTooManyOps        = 10070
+	nfs4ErrOpNotInSession    = 10071
+	nfs4ErrClientIDBusy      = 10074
+	nfs4ErrNotOnlyOp         = 10081
+)
+
+// nfs_ftype4 values
+const (
+	nf4Reg = 1
+	nf4Dir = 2
+	nf4Lnk = 5
+)
+
+// errXDR is returned when decoding runs off the end of the data
+var errXDR = errors.New("nfs: XDR decode error")
+
+// xdrReader decodes XDR data from a buffer
+//
+// Errors are sticky so the caller only needs to check err once
+// after decoding a whole structure.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+// take returns the next n bytes
+func (r *xdrReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = errXDR
+		r.buf = nil
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *xdrReader) bool() bool {
+	return r.uint32() != 0
+}
+
+// fixed reads fixed length opaque data of n bytes
+func (r *xdrReader) fixed(n int) []byte {
+	b := r.take((n + 3) &^ 3)
+	if b == nil {
+		return nil
+	}
+	return b[:n]
+}
+
+// opaque reads variable length opaque data
+func (r *xdrReader) opaque() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint32(len(r.buf)) {
+		r.err = errXDR
+		return nil
+	}
+	return r.fixed(int(n))
+}
+
+func (r *xdrReader) string() string {
+	return string(r.opaque())
+}
+
+// bitmap reads a bitmap4
+func (r *xdrReader) bitmap() []uint32 {
+	n := r.uint32()
+	if n > 8 {
+		r.err = errXDR
+		return nil
+	}
+	bitmap := make([]uint32, n)
+	for i := range bitmap {
+		bitmap[i] = r.uint32()
+	}
+	return bitmap
+}
+
+// xdrWriter encodes XDR data
+type xdrWriter struct {
+	buf []byte
+}
+
+func (w *xdrWriter) uint32(x uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, x)
+}
+
+func (w *xdrWriter) uint64(x uint64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, x)
+}
+
+func (w *xdrWriter) bool(x bool) {
+	if x {
+		w.uint32(1)
+	} else {
+		w.uint32(0)
+	}
+}
+
+// fixed writes fixed length opaque data
+func (w *xdrWriter) fixed(b []byte) {
+	w.buf = append(w.buf, b...)
+	for len(w.buf)%4 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// opaque writes variable length opaque data
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.fixed(b)
+}
+
+func (w *xdrWriter) string(s string) {
+	w.opaque([]byte(s))
+}
+
+// bitmap writes a bitmap4 trimming trailing zero words
+func (w *xdrWriter) bitmap(bitmap []uint32) {
+	n := len(bitmap)
+	for n > 0 && bitmap[n-1] == 0 {
+		n--
+	}
+	w.uint32(uint32(n))
+	for _, word := range bitmap[:n] {
+		w.uint32(word)
+	}
+}
+
+// bitmapIsSet returns true if bit is set in bitmap
+func bitmapIsSet(bitmap []uint32, bit int) bool {
+	word := bit / 32
+	return word < len(bitmap) && bitmap[word]&(1<<(bit%32)) != 0
+}
+
+// bitmapSet sets bit in bitmap, growing it as necessary
+func bitmapSet(bitmap []uint32, bit int) []uint32 {
+	for bit/32 >= len(bitmap) {
+		bitmap = append(bitmap, 0)
+	}
+	bitmap[bit/32] |= 1 << (bit % 32)
+	return bitmap
+}
@@ -17,3 +17,11 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+func TestRcVersion4(t *testing.T) {
+	servetest.TestRc(t, rc.Params{
+		"type":           "nfs",
+		"vfs_cache_mode": "writes",
+		"nfs_version":    4,
+	})
+}
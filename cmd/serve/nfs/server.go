@@ -18,6 +18,7 @@ import (
 type Server struct {
 	opt                 Options
 	handler             nfs.Handler
+	v4                  *server4        // set if serving NFSv4
 	ctx                 context.Context // for global config
 	listener            net.Listener
 	UnmountedExternally bool
@@ -41,6 +42,13 @@ func NewServer(ctx context.Context, vfs *vfs.VFS, opt *Options) (s *Server, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to make NFS handler: %w", err)
 	}
+	switch opt.Version {
+	case 0, 3:
+	case 4:
+		s.v4 = newServer4(s.handler.(*Handler))
+	default:
+		return nil, fmt.Errorf("unsupported NFS version %d: must be 3 or 4", opt.Version)
+	}
 	s.listener, err = net.Listen("tcp", s.opt.ListenAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open listening socket: %w", err)
@@ -55,11 +63,18 @@ func (s *Server) Addr() net.Addr {
 
 // Shutdown stops the server
 func (s *Server) Shutdown() error {
-	return s.listener.Close()
+	err := s.listener.Close()
+	if s.v4 != nil {
+		s.v4.shutdown()
+	}
+	return err
 }
 
 // Serve starts the server
 func (s *Server) Serve() (err error) {
 	fs.Logf(nil, "NFS Server running at %s\n", s.listener.Addr())
+	if s.v4 != nil {
+		return s.v4.serve(s.listener)
+	}
 	return nfs.Serve(s.listener, s.handler)
 }
@@ -10,10 +10,12 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
@@ -49,9 +51,14 @@ This config generated must have this extra parameter
 
 - |_root| - root to use for the backend
 
-And it may have this parameter
+And it may have these parameters
 
 - |_obscure| - comma separated strings for parameters to obscure
+- |_quota_bytes| - max total size of the user's files, eg |10G|
+- |_quota_files| - max number of the user's files
+
+|_quota_bytes| and |_quota_files| override |--vfs-quota-bytes| and
+|--vfs-quota-files| for the user. Use |-1| for no limit.
 
 If password authentication was used by the client, input to the proxy
 process (on STDIN) would look similar to this:
@@ -73,6 +80,28 @@ proxy process (on STDIN) would look similar to this:
 }
 |||
 
+If the client authenticated with a bearer token (see |--jwt-issuer|)
+then the token has already been verified and the input to the proxy
+process contains the claims from the token instead of the password:
+
+|||json
+{
+  "user": "me",
+  "claims": {
+    "sub": "me",
+    "email": "me@example.com",
+    "groups": ["staff"]
+  }
+}
+|||
+
+Some protocols, like SMB with NTLM authentication, never send the
+password to the server. For these only the |user| is sent to the proxy
+process and it must return the user's password in the |_password|
+parameter of its output. Rclone then checks the client knew this
+password. Rclone only keeps a hash of the password and doesn't pass
+it on to the backend.
+
 And as an example return this on STDOUT
 
 |||json
@@ -138,8 +167,9 @@ type Proxy struct {
 
 // cacheEntry is what is stored in the vfsCache
 type cacheEntry struct {
-	vfs    *vfs.VFS          // stored VFS
-	pwHash [sha256.Size]byte // sha256 hash of the password/publicKey
+	vfs      *vfs.VFS          // stored VFS
+	pwHash   [sha256.Size]byte // sha256 hash of the password/publicKey
+	passHash []byte            // hash of the password returned by the proxy if using CallWithPassword
 }
 
 // New creates a new proxy with the Options passed in
@@ -156,7 +186,7 @@ func New(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) *Proxy {
 }
 
 // run the proxy command returning a config map
-func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
+func (p *Proxy) run(in map[string]any) (config configmap.Simple, err error) {
 	cmd := exec.Command(p.cmdLine[0], p.cmdLine[1:]...)
 	inBytes, err := json.MarshalIndent(in, "", "\t")
 	if err != nil {
@@ -201,12 +231,12 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 	var config configmap.Simple
 	// Contact the proxy
 	if isPublicKey {
-		config, err = p.run(map[string]string{
+		config, err = p.run(map[string]any{
 			"user":       user,
 			"public_key": auth,
 		})
 	} else {
-		config, err = p.run(map[string]string{
+		config, err = p.run(map[string]any{
 			"user": user,
 			"pass": auth,
 		})
@@ -216,6 +246,17 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		return nil, err
 	}
 
+	// We hash the auth here so we don't copy the auth more than we
+	// need to in memory. An attacker would find it easier to go
+	// after the unencrypted password in memory most likely.
+	return p.newEntry(user, config, cacheEntry{
+		pwHash: sha256.Sum256([]byte(auth)),
+	})
+}
+
+// newEntry makes the backend described by config for user and puts
+// entry with its VFS in the cache
+func (p *Proxy) newEntry(user string, config configmap.Simple, entry cacheEntry) (value any, err error) {
 	// Look for required fields in the answer
 	fsName, ok := config.Get("type")
 	if !ok {
@@ -232,6 +273,12 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		return nil, fmt.Errorf("proxy: couldn't find backend for %q: %w", fsName, err)
 	}
 
+	// Set any per user VFS options
+	vfsOpt, err := p.userVFSOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// base name of config on user name.  This may appear in logs
 	name := "proxy-" + user
 	fsString := name + ":" + root
@@ -252,14 +299,8 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		if err != nil {
 			return nil, false, err
 		}
-
-		// We hash the auth here so we don't copy the auth more than we
-		// need to in memory. An attacker would find it easier to go
-		// after the unencrypted password in memory most likely.
-		entry := cacheEntry{
-			vfs:    vfs.New(f, &p.vfsOpt),
-			pwHash: sha256.Sum256([]byte(auth)),
-		}
+		entry.vfs = vfs.New(f, vfsOpt)
+		entry.vfs.SetAuditActor(audit.Actor{Type: audit.ActorServe, User: user})
 		return entry, true, nil
 	})
 	if err != nil {
@@ -268,6 +309,25 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 	return value, nil
 }
 
+// userVFSOptions returns the VFS options to use with the per user
+// overrides in config applied
+func (p *Proxy) userVFSOptions(config configmap.Simple) (*vfscommon.Options, error) {
+	vfsOpt := p.vfsOpt
+	if value, ok := config.Get("_quota_bytes"); ok {
+		if err := vfsOpt.QuotaBytes.Set(value); err != nil {
+			return nil, fmt.Errorf("proxy: bad _quota_bytes: %w", err)
+		}
+	}
+	if value, ok := config.Get("_quota_files"); ok {
+		quotaFiles, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: bad _quota_files: %w", err)
+		}
+		vfsOpt.QuotaFiles = quotaFiles
+	}
+	return &vfsOpt, nil
+}
+
 // Call runs the auth proxy with the username and password/public key provided
 // returning a *vfs.VFS and the key used in the VFS cache.
 func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
@@ -304,6 +364,96 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	return entry.vfs, user, nil
 }
 
+// CallWithClaims runs the auth proxy with the username and the claims
+// from a bearer token which has already been verified, returning a
+// *vfs.VFS and the key used in the VFS cache.
+func (p *Proxy) CallWithClaims(user string, claims map[string]any) (VFS *vfs.VFS, vfsKey string, err error) {
+	// Look in the cache first
+	value, ok := p.vfsCache.GetMaybe(user)
+
+	// If not found then call the proxy for a fresh answer
+	if !ok {
+		config, err := p.run(map[string]any{
+			"user":   user,
+			"claims": claims,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		// The entry has no password hash so it can't be used
+		// by Call with a password.
+		value, err = p.newEntry(user, config, cacheEntry{})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// check we got what we were expecting
+	entry, ok := value.(cacheEntry)
+	if !ok {
+		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
+	}
+	return entry.vfs, user, nil
+}
+
+// CallWithPassword runs the auth proxy with just the username for
+// protocols which don't send the password to the server, like NTLM,
+// returning a *vfs.VFS and the key used in the VFS cache.
+//
+// The proxy must return the password for the user in _password. This
+// is hashed with hash, and only the hash is kept. The hash is passed
+// to check which should return an error if the client didn't prove
+// it knows the password.
+func (p *Proxy) CallWithPassword(user string, hash func(pass string) []byte, check func(passHash []byte) error) (VFS *vfs.VFS, vfsKey string, err error) {
+	// Look in the cache first
+	value, ok := p.vfsCache.GetMaybe(user)
+
+	// If not found then call the proxy for a fresh answer
+	if !ok {
+		config, err := p.run(map[string]any{
+			"user": user,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		pass, ok := config.Get("_password")
+		if !ok {
+			return nil, "", errors.New("proxy: _password not set in result")
+		}
+		// Don't pass the password on to the backend
+		delete(config, "_password")
+		passHash := hash(pass)
+		// Check the password before making the backend
+		err = check(passHash)
+		if err != nil {
+			return nil, "", fmt.Errorf("proxy: incorrect password: %w", err)
+		}
+		value, err = p.newEntry(user, config, cacheEntry{
+			passHash: passHash,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// check we got what we were expecting
+	entry, ok := value.(cacheEntry)
+	if !ok {
+		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
+	}
+
+	// Check the password in the cached entry as in Call
+	if entry.passHash == nil {
+		return nil, "", errors.New("proxy: password not known for user")
+	}
+	err = check(entry.passHash)
+	if err != nil {
+		return nil, "", fmt.Errorf("proxy: incorrect password: %w", err)
+	}
+
+	return entry.vfs, user, nil
+}
+
 // Get VFS from the cache using key - returns nil if not found
 func (p *Proxy) Get(key string) *vfs.VFS {
 	value, ok := p.vfsCache.GetMaybe(key)
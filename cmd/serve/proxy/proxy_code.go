@@ -11,7 +11,7 @@ import (
 
 func main() {
 	// Read the input
-	var in map[string]string
+	var in map[string]any
 	err := json.NewDecoder(os.Stdin).Decode(&in)
 	if err != nil {
 		log.Fatal(err)
@@ -20,13 +20,24 @@ func main() {
 	// Write the output
 	var out = map[string]string{}
 	for k, v := range in {
+		if k == "claims" {
+			// Pass the string claims from a bearer token
+			claims, _ := v.(map[string]any)
+			for claim, value := range claims {
+				if s, ok := value.(string); ok {
+					out["claim_"+claim] = s
+				}
+			}
+			continue
+		}
+		s, _ := v.(string)
 		switch k {
 		case "user":
-			v += "-test"
+			s += "-test"
 		case "error":
-			log.Fatal(v)
+			log.Fatal(s)
 		}
-		out[k] = v
+		out[k] = s
 	}
 	if out["type"] == "" {
 		out["type"] = "local"
@@ -34,6 +45,13 @@ func main() {
 	if out["_root"] == "" {
 		out["_root"] = ""
 	}
+	// Return a password if the client didn't supply one
+	user, _ := in["user"].(string)
+	pass, _ := in["pass"].(string)
+	publicKey, _ := in["public_key"].(string)
+	if pass == "" && publicKey == "" && in["claims"] == nil {
+		out["_password"] = "pass-" + user
+	}
 	json.NewEncoder(os.Stdout).Encode(&out)
 	if err != nil {
 		log.Fatal(err)
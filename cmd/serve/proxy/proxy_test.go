@@ -1,11 +1,13 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"strings"
 	"testing"
 
@@ -26,7 +28,7 @@ func TestRun(t *testing.T) {
 	p := New(context.Background(), &opt, &vfscommon.Opt)
 
 	t.Run("Normal", func(t *testing.T) {
-		config, err := p.run(map[string]string{
+		config, err := p.run(map[string]any{
 			"type": "ftp",
 			"user": "me",
 			"pass": "pass",
@@ -42,8 +44,25 @@ func TestRun(t *testing.T) {
 		}, config)
 	})
 
+	t.Run("Claims", func(t *testing.T) {
+		config, err := p.run(map[string]any{
+			"user": "me",
+			"claims": map[string]any{
+				"email":  "me@example.com",
+				"groups": []string{"staff"},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, configmap.Simple{
+			"type":        "local",
+			"user":        "me-test",
+			"claim_email": "me@example.com",
+			"_root":       "",
+		}, config)
+	})
+
 	t.Run("Error", func(t *testing.T) {
-		config, err := p.run(map[string]string{
+		config, err := p.run(map[string]any{
 			"error": "potato",
 		})
 		assert.Nil(t, config)
@@ -52,7 +71,7 @@ func TestRun(t *testing.T) {
 	})
 
 	t.Run("Obscure", func(t *testing.T) {
-		config, err := p.run(map[string]string{
+		config, err := p.run(map[string]any{
 			"type":     "ftp",
 			"user":     "me",
 			"pass":     "pass",
@@ -148,6 +167,100 @@ func TestRun(t *testing.T) {
 
 	})
 
+	t.Run("CallWithPassword", func(t *testing.T) {
+		// check cache empty
+		assert.Equal(t, 0, p.vfsCache.Entries())
+		defer p.vfsCache.Clear()
+
+		hash := func(pass string) []byte {
+			sum := sha256.Sum256([]byte(pass))
+			return sum[:]
+		}
+		wantHash := hash("pass-" + testUser)
+		var checked [][]byte
+		check := func(passHash []byte) error {
+			checked = append(checked, passHash)
+			if !bytes.Equal(passHash, wantHash) {
+				return errors.New("bad password")
+			}
+			return nil
+		}
+
+		vfs, vfsKey, err := p.CallWithPassword(testUser, hash, check)
+		require.NoError(t, err)
+		require.NotNil(t, vfs)
+		assert.Equal(t, "proxy-"+testUser, vfs.Fs().Name())
+		assert.Equal(t, testUser, vfsKey)
+		assert.Equal(t, 1, p.vfsCache.Entries())
+
+		// only the hash of the password is kept
+		value, ok := p.vfsCache.GetMaybe(testUser)
+		require.True(t, ok)
+		assert.Equal(t, wantHash, value.(cacheEntry).passHash)
+
+		// now try again from the cache
+		checked = nil
+		vfs2, _, err := p.CallWithPassword(testUser, hash, check)
+		require.NoError(t, err)
+		assert.Equal(t, vfs, vfs2)
+		assert.Equal(t, [][]byte{wantHash}, checked)
+
+		// now try again from the cache but with the check failing
+		vfs, vfsKey, err = p.CallWithPassword(testUser, hash, func(passHash []byte) error {
+			return errors.New("bad password")
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "incorrect password")
+		require.Nil(t, vfs)
+		require.Equal(t, "", vfsKey)
+	})
+
+	t.Run("CallWithPassword wrong", func(t *testing.T) {
+		// check cache empty
+		assert.Equal(t, 0, p.vfsCache.Entries())
+		defer p.vfsCache.Clear()
+
+		vfs, _, err := p.CallWithPassword(testUser, func(pass string) []byte {
+			return []byte(pass)
+		}, func(passHash []byte) error {
+			return errors.New("bad password")
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "incorrect password")
+		require.Nil(t, vfs)
+
+		// check nothing was cached
+		assert.Equal(t, 0, p.vfsCache.Entries())
+	})
+
+	t.Run("CallWithClaims", func(t *testing.T) {
+		// check cache empty
+		assert.Equal(t, 0, p.vfsCache.Entries())
+		defer p.vfsCache.Clear()
+
+		claims := map[string]any{
+			"sub":    testUser,
+			"email":  "test@example.com",
+			"groups": []any{"staff"},
+		}
+		vfs, vfsKey, err := p.CallWithClaims(testUser, claims)
+		require.NoError(t, err)
+		require.NotNil(t, vfs)
+		assert.Equal(t, "proxy-"+testUser, vfs.Fs().Name())
+		assert.Equal(t, testUser, vfsKey)
+		assert.Equal(t, 1, p.vfsCache.Entries())
+
+		// now try again from the cache
+		vfs2, _, err := p.CallWithClaims(testUser, claims)
+		require.NoError(t, err)
+		assert.Equal(t, vfs, vfs2)
+
+		// the cached entry can't be used with a password
+		_, _, err = p.Call(testUser, "", false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "incorrect password")
+	})
+
 	privateKey, privateKeyErr := rsa.GenerateKey(rand.Reader, 2048)
 	if privateKeyErr != nil {
 		fs.Fatal(nil, "error generating test private key "+privateKeyErr.Error())
@@ -234,3 +347,27 @@ func TestRun(t *testing.T) {
 		assert.Equal(t, 1, p.vfsCache.Entries())
 	})
 }
+
+func TestUserVFSOptions(t *testing.T) {
+	vfsOpt := vfscommon.Opt
+	vfsOpt.QuotaBytes = fs.Gibi
+	p := New(context.Background(), &Opt, &vfsOpt)
+
+	// Defaults are used if not overridden
+	opt, err := p.userVFSOptions(configmap.Simple{"_root": ""})
+	require.NoError(t, err)
+	assert.Equal(t, fs.SizeSuffix(fs.Gibi), opt.QuotaBytes)
+	assert.Equal(t, int64(-1), opt.QuotaFiles)
+
+	// Overridden for the user
+	opt, err = p.userVFSOptions(configmap.Simple{"_quota_bytes": "10M", "_quota_files": "100"})
+	require.NoError(t, err)
+	assert.Equal(t, fs.SizeSuffix(10*fs.Mebi), opt.QuotaBytes)
+	assert.Equal(t, int64(100), opt.QuotaFiles)
+	assert.Equal(t, fs.SizeSuffix(fs.Gibi), p.vfsOpt.QuotaBytes, "defaults changed")
+
+	_, err = p.userVFSOptions(configmap.Simple{"_quota_bytes": "potato"})
+	assert.ErrorContains(t, err, "bad _quota_bytes")
+	_, err = p.userVFSOptions(configmap.Simple{"_quota_files": "potato"})
+	assert.ErrorContains(t, err, "bad _quota_files")
+}
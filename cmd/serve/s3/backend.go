@@ -15,6 +15,7 @@ import (
 	"github.com/ncw/swift/v2"
 	"github.com/rclone/gofakes3"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/vfs"
 )
 
@@ -49,7 +50,7 @@ func (b *s3Backend) ListBuckets(ctx context.Context) ([]gofakes3.BucketInfo, err
 	}
 	var response []gofakes3.BucketInfo
 	for _, entry := range dirEntries {
-		if entry.IsDir() {
+		if entry.IsDir() && entry.Name() != versionIDDir {
 			response = append(response, gofakes3.BucketInfo{
 				Name:         entry.Name(),
 				CreationDate: gofakes3.NewContentTime(entry.ModTime()),
@@ -112,19 +113,23 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 	if err != nil {
 		return nil, err
 	}
-	_, err = _vfs.Stat(bucketName)
+	// gofakes3 doesn't pass the versionId for HEAD requests so it
+	// is passed in the context
+	versionID, _ := ctx.Value(ctxKeyVersionID).(gofakes3.VersionID)
+	return b.headObject(_vfs, bucketName, objectName, versionID)
+}
+
+// headObject returns the fileinfo for versionID of the given object
+// name, or the current version if versionID is empty.
+func (b *s3Backend) headObject(_vfs *vfs.VFS, bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
+	_, err := _vfs.Stat(bucketName)
 	if err != nil {
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
 
-	fp := path.Join(bucketName, objectName)
-	node, err := _vfs.Stat(fp)
+	fp, node, versionID, err := b.findObject(_vfs, bucketName, objectName, versionID)
 	if err != nil {
-		return nil, gofakes3.KeyNotFound(objectName)
-	}
-
-	if !node.IsFile() {
-		return nil, gofakes3.KeyNotFound(objectName)
+		return nil, err
 	}
 
 	entry := node.DirEntry()
@@ -147,11 +152,12 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     hash,
-		Metadata: meta,
-		Size:     size,
-		Contents: noOpReadCloser{},
+		Name:      objectName,
+		Hash:      hash,
+		Metadata:  meta,
+		Size:      size,
+		VersionID: versionID,
+		Contents:  noOpReadCloser{},
 	}, nil
 }
 
@@ -161,19 +167,20 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	if err != nil {
 		return nil, err
 	}
+	return b.getObject(_vfs, bucketName, objectName, "", rangeRequest)
+}
+
+// getObject fetches versionID of the object from the filesystem, or
+// the current version if versionID is empty.
+func (b *s3Backend) getObject(_vfs *vfs.VFS, bucketName, objectName string, versionID gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (obj *gofakes3.Object, err error) {
 	_, err = _vfs.Stat(bucketName)
 	if err != nil {
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
 
-	fp := path.Join(bucketName, objectName)
-	node, err := _vfs.Stat(fp)
+	fp, node, versionID, err := b.findObject(_vfs, bucketName, objectName, versionID)
 	if err != nil {
-		return nil, gofakes3.KeyNotFound(objectName)
-	}
-
-	if !node.IsFile() {
-		return nil, gofakes3.KeyNotFound(objectName)
+		return nil, err
 	}
 
 	entry := node.DirEntry()
@@ -222,12 +229,13 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     hash,
-		Metadata: meta,
-		Size:     size,
-		Range:    rnge,
-		Contents: rdr,
+		Name:      objectName,
+		Hash:      hash,
+		Metadata:  meta,
+		Size:      size,
+		Range:     rnge,
+		VersionID: versionID,
+		Contents:  rdr,
 	}, nil
 }
 
@@ -247,7 +255,7 @@ func (b *s3Backend) TouchObject(ctx context.Context, fp string, meta map[string]
 	}
 	_, err = _vfs.Stat(fp)
 	if err == vfs.ENOENT {
-		f, err := _vfs.Create(fp)
+		f, err := _vfs.OpenFileContext(ctx, fp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
 			return result, err
 		}
@@ -301,7 +309,21 @@ func (b *s3Backend) PutObject(
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
 
-	fp := path.Join(bucketName, objectName)
+	fp := b.objectPath(bucketName, objectName)
+	if b.s.opt.KeepVersions {
+		if err := keepVersion(ctx, _vfs, fp); err != nil {
+			return result, err
+		}
+	}
+	result, err = b.putObject(ctx, _vfs, fp, meta, input)
+	if err == nil && b.s.versioned {
+		result.VersionID, err = setVersionID(ctx, _vfs, fp)
+	}
+	return result, err
+}
+
+// putObject creates or overwrites the object at fp.
+func (b *s3Backend) putObject(ctx context.Context, _vfs *vfs.VFS, fp string, meta map[string]string, input io.Reader) (result gofakes3.PutObjectResult, err error) {
 	objectDir := path.Dir(fp)
 	// _, err = db.fs.Stat(objectDir)
 	// if err == vfs.ENOENT {
@@ -315,21 +337,33 @@ func (b *s3Backend) PutObject(
 		}
 	}
 
-	f, err := _vfs.Create(fp)
+	hasher, err := hash.NewMultiHasherTypes(checksumTypes(meta))
 	if err != nil {
 		return result, err
 	}
 
-	if _, err := io.Copy(f, input); err != nil {
+	f, err := _vfs.OpenFileContext(ctx, fp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return result, err
+	}
+
+	if _, err := io.Copy(f, io.TeeReader(input, hasher)); err != nil {
 		// remove file when i/o error occurred (FsPutErr)
 		_ = f.Close()
-		_ = _vfs.Remove(fp)
+		_ = _vfs.RemoveContext(ctx, fp)
+		return result, err
+	}
+
+	if err := checkChecksums(meta, hasher.Sums()); err != nil {
+		// remove file when the checksums don't match
+		_ = f.Close()
+		_ = _vfs.RemoveContext(ctx, fp)
 		return result, err
 	}
 
 	if err := f.Close(); err != nil {
 		// remove file when close error occurred (FsPutErr)
-		_ = _vfs.Remove(fp)
+		_ = _vfs.RemoveContext(ctx, fp)
 		return result, err
 	}
 
@@ -394,15 +428,21 @@ func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName str
 		return gofakes3.BucketNotFound(bucketName)
 	}
 
-	fp := path.Join(bucketName, objectName)
+	fp := b.objectPath(bucketName, objectName)
+	if b.s.opt.KeepVersions {
+		return keepVersion(ctx, _vfs, fp)
+	}
 	// S3 does not report an error when attempting to delete a key that does not exist, so
 	// we need to skip IsNotExist errors.
-	if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
+	if err := _vfs.RemoveContext(ctx, fp); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	if b.s.versioned {
+		removeVersionID(ctx, _vfs, fp)
+	}
 
 	// FIXME: unsafe operation
-	rmdirRecursive(fp, _vfs)
+	rmdirRecursive(ctx, fp, _vfs)
 	return nil
 }
 
@@ -438,7 +478,7 @@ func (b *s3Backend) DeleteBucket(ctx context.Context, name string) error {
 		return gofakes3.BucketNotFound(name)
 	}
 
-	if err := _vfs.Remove(name); err != nil {
+	if err := _vfs.RemoveContext(ctx, name); err != nil {
 		return gofakes3.ErrBucketNotEmpty
 	}
 
@@ -465,7 +505,7 @@ func (b *s3Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket
 	if err != nil {
 		return result, err
 	}
-	fp := path.Join(srcBucket, srcKey)
+	fp := b.objectPath(srcBucket, srcKey)
 	if srcBucket == dstBucket && srcKey == dstKey {
 		b.meta.Store(fp, meta)
 
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/lib/version"
 	"github.com/rclone/rclone/vfs"
 )
 
@@ -19,6 +20,14 @@ func (b *s3Backend) entryListR(_vfs *vfs.VFS, bucket, fdPath, name string, addPr
 	for _, entry := range dirEntries {
 		object := entry.Name()
 
+		if b.s.versioned && !entry.IsDir() {
+			// old versions are only shown by ListObjectVersions
+			if t, _ := version.Remove(object); !t.IsZero() {
+				continue
+			}
+			object = unescapeLeaf(object)
+		}
+
 		// workaround for control-chars detect
 		objectPath := path.Join(fdPath, object)
 
@@ -37,6 +37,14 @@ var OptionsInfo = fs.Options{{
 	Name:    "no_cleanup",
 	Default: false,
 	Help:    "Not to cleanup empty folder after object is deleted",
+}, {
+	Name:    "versions",
+	Default: false,
+	Help:    "Serve old versions of objects with the versioning API",
+}, {
+	Name:    "keep_versions",
+	Default: false,
+	Help:    "Keep old versions of objects when they are overwritten or deleted",
 }}.
 	Add(httplib.ConfigInfo).
 	Add(httplib.AuthConfigInfo)
@@ -48,6 +56,8 @@ type Options struct {
 	EtagHash       string   `config:"etag_hash"`
 	AuthKey        []string `config:"auth_key"`
 	NoCleanup      bool     `config:"no_cleanup"`
+	Versions       bool     `config:"versions"`
+	KeepVersions   bool     `config:"keep_versions"`
 	Auth           httplib.AuthConfig
 	HTTP           httplib.Config
 }
@@ -6,18 +6,25 @@ package s3
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/s3"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
@@ -26,6 +33,7 @@ import (
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
 	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
@@ -37,12 +45,15 @@ const (
 )
 
 // Configure and serve the server
-func serveS3(t *testing.T, f fs.Fs) (testURL string, keyid string, keysec string, w *Server) {
+func serveS3(t *testing.T, f fs.Fs, setOpts ...func(*Options)) (testURL string, keyid string, keysec string, w *Server) {
 	keyid = random.String(16)
 	keysec = random.String(16)
 	opt := Opt // copy default options
 	opt.AuthKey = []string{fmt.Sprintf("%s,%s", keyid, keysec)}
 	opt.HTTP.ListenAddr = []string{endpoint}
+	for _, setOpt := range setOpts {
+		setOpt(&opt)
+	}
 	w, _ = newServer(context.Background(), f, &opt, &vfscommon.Opt, &proxy.Opt)
 	go func() {
 		require.NoError(t, w.Serve())
@@ -297,3 +308,351 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+// TestResumeMultipartUpload checks an interrupted multipart upload
+// with the s3 remote can be resumed.
+func TestResumeMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.ResumeUploads = true
+
+	fstest.Initialise()
+	f, _, clean, err := fstest.RandomRemote()
+	require.NoError(t, err)
+	defer clean()
+	require.NoError(t, f.Mkdir(ctx, "bucket"))
+
+	testURL, keyid, keysec, _ := serveS3(t, f)
+	fs3, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Rclone,endpoint='%s',access_key_id=%s,secret_access_key=%s,chunk_size=5Mi,upload_cutoff=5Mi,upload_concurrency=1:bucket", testURL, keyid, keysec))
+	require.NoError(t, err)
+
+	// Keep the saved uploads open between the runs as kv removes
+	// the database when it is first opened in tests
+	db, err := kv.Start(ctx, "multipart", fs3)
+	require.NoError(t, err)
+	defer func() { _ = db.Stop(false) }()
+
+	const size = 12 << 20
+	data := []byte(random.String(size))
+	modTime := fstest.Time("2024-01-02T03:04:05Z")
+	put := func(in io.Reader) error {
+		src := object.NewStaticObjectInfo("file.bin", modTime, size, true, nil, nil)
+		_, err := fs3.Put(ctx, in, src)
+		return err
+	}
+	read := func() []byte {
+		o, err := fs3.NewObject(ctx, "file.bin")
+		require.NoError(t, err)
+		in, err := o.Open(ctx)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, in.Close()) }()
+		got, err := io.ReadAll(in)
+		require.NoError(t, err)
+		return got
+	}
+
+	// Fail the upload after the first two chunks
+	err = put(io.MultiReader(bytes.NewReader(data[:11<<20]), iotest.ErrReader(errors.New("interrupted"))))
+	require.ErrorContains(t, err, "interrupted")
+
+	// Resume with the first two chunks changed - these shouldn't be
+	// uploaded again so the original data should be there
+	changed := slices.Clone(data)
+	clear(changed[:10<<20])
+	require.NoError(t, put(bytes.NewReader(changed)))
+	assert.True(t, bytes.Equal(data, read()), "resumed upload has wrong contents")
+
+	// The saved upload should be removed so this is uploaded afresh
+	require.NoError(t, put(bytes.NewReader(changed)))
+	assert.True(t, bytes.Equal(changed, read()), "new upload has wrong contents")
+}
+
+// TestVersions checks old versions are kept and can be read with the
+// versioning API.
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	endpoint, keyid, keysec, _ := serveS3(t, f, func(opt *Options) {
+		opt.KeepVersions = true
+	})
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	put := func(contents string, mtime string) string {
+		info, err := client.PutObject(ctx, "bucket", "dir/file.txt", strings.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{
+			UserMetadata: map[string]string{"mtime": mtime},
+		})
+		require.NoError(t, err)
+		return info.VersionID
+	}
+	listVersions := func() (versions []minio.ObjectInfo) {
+		for object := range client.ListObjects(ctx, "bucket", minio.ListObjectsOptions{Recursive: true, WithVersions: true}) {
+			require.NoError(t, object.Err)
+			versions = append(versions, object)
+		}
+		return versions
+	}
+	read := func(versionID string) string {
+		obj, err := client.GetObject(ctx, "bucket", "dir/file.txt", minio.GetObjectOptions{VersionID: versionID})
+		require.NoError(t, err)
+		defer func() { _ = obj.Close() }()
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	v1 := put("one", "1700000000")
+	assert.Equal(t, "v2023-11-14-221320-000", v1)
+	v2 := put("two!", "1700000001.5")
+	assert.Equal(t, "v2023-11-14-221321-500", v2)
+
+	// Only the current version is listed normally
+	var keys []string
+	for object := range client.ListObjects(ctx, "bucket", minio.ListObjectsOptions{Recursive: true}) {
+		require.NoError(t, object.Err)
+		keys = append(keys, object.Key)
+	}
+	assert.Equal(t, []string{"dir/file.txt"}, keys)
+
+	// All versions are listed newest first
+	versions := listVersions()
+	require.Len(t, versions, 2)
+	assert.Equal(t, v2, versions[0].VersionID)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, int64(4), versions[0].Size)
+	assert.Equal(t, v1, versions[1].VersionID)
+	assert.False(t, versions[1].IsLatest)
+	assert.Equal(t, int64(3), versions[1].Size)
+
+	// Read and stat the versions
+	assert.Equal(t, "two!", read(""))
+	assert.Equal(t, "two!", read(v2))
+	assert.Equal(t, "one", read(v1))
+	info, err := client.StatObject(ctx, "bucket", "dir/file.txt", minio.StatObjectOptions{VersionID: v1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), info.Size)
+	assert.Equal(t, v1, info.VersionID)
+	_, err = client.StatObject(ctx, "bucket", "dir/file.txt", minio.StatObjectOptions{VersionID: "v2000-01-01-000000-000"})
+	assert.Error(t, err)
+
+	// The s3 backend can read the versions too
+	fs3, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Rclone,endpoint='%s',access_key_id=%s,secret_access_key=%s,versions=true:bucket", endpoint, keyid, keysec))
+	require.NoError(t, err)
+	o, err := fs3.NewObject(ctx, "dir/file-v2023-11-14-221320-000.txt")
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "one", string(data))
+
+	// Deleting the object keeps it as an old version
+	require.NoError(t, client.RemoveObject(ctx, "bucket", "dir/file.txt", minio.RemoveObjectOptions{}))
+	versions = listVersions()
+	require.Len(t, versions, 2)
+	assert.Equal(t, v2, versions[0].VersionID)
+	assert.False(t, versions[0].IsLatest)
+
+	// Deleting a version removes it permanently
+	require.NoError(t, client.RemoveObject(ctx, "bucket", "dir/file.txt", minio.RemoveObjectOptions{VersionID: v1}))
+	versions = listVersions()
+	require.Len(t, versions, 1)
+	assert.Equal(t, v2, versions[0].VersionID)
+	assert.Equal(t, "two!", read(v2))
+}
+
+// TestVersionsSameModTime checks versions uploaded with the same
+// modification time get different version IDs without changing the
+// modification time.
+func TestVersionsSameModTime(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	endpoint, keyid, keysec, _ := serveS3(t, f, func(opt *Options) {
+		opt.KeepVersions = true
+	})
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	contents := []string{"one", "two", "three"}
+	var ids []string
+	for _, content := range contents {
+		info, err := client.PutObject(ctx, "bucket", "file.txt", strings.NewReader(content), int64(len(content)), minio.PutObjectOptions{
+			UserMetadata: map[string]string{"mtime": "1700000000"},
+		})
+		require.NoError(t, err)
+		ids = append(ids, info.VersionID)
+	}
+	assert.Equal(t, []string{"v2023-11-14-221320-000", "v2023-11-14-221320-001", "v2023-11-14-221320-002"}, ids)
+
+	// Every version can still be read
+	for i, id := range ids {
+		obj, err := client.GetObject(ctx, "bucket", "file.txt", minio.GetObjectOptions{VersionID: id})
+		require.NoError(t, err)
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		require.NoError(t, obj.Close())
+		assert.Equal(t, contents[i], string(data))
+	}
+	var listed []string
+	for object := range client.ListObjects(ctx, "bucket", minio.ListObjectsOptions{WithVersions: true}) {
+		require.NoError(t, object.Err)
+		listed = append(listed, object.VersionID)
+	}
+	assert.Equal(t, []string{ids[2], ids[1], ids[0]}, listed)
+
+	// The modification time of the current version is unchanged
+	info, err := client.StatObject(ctx, "bucket", "file.txt", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ids[2], info.VersionID)
+	fi, err := os.Stat(filepath.Join(dir, "bucket", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 0), fi.ModTime())
+
+	// The version ID is kept when the current version is replaced
+	require.NoError(t, client.RemoveObject(ctx, "bucket", "file.txt", minio.RemoveObjectOptions{}))
+	obj, err := client.GetObject(ctx, "bucket", "file.txt", minio.GetObjectOptions{VersionID: ids[2]})
+	require.NoError(t, err)
+	data, err := io.ReadAll(obj)
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+	assert.Equal(t, "three", string(data))
+
+	// The stored version ID isn't listed as a bucket
+	buckets, err := client.ListBuckets(ctx)
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, "bucket", buckets[0].Name)
+}
+
+// TestVersionsLiteralNames checks objects with names like old
+// versions aren't taken for old versions.
+func TestVersionsLiteralNames(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	endpoint, keyid, keysec, _ := serveS3(t, f, func(opt *Options) {
+		opt.KeepVersions = true
+	})
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	names := []string{"file.txt", "file-v2023-11-14-221320-000.txt", "file-literal.txt"}
+	for _, name := range names {
+		_, err := client.PutObject(ctx, "bucket", name, strings.NewReader(name), int64(len(name)), minio.PutObjectOptions{})
+		require.NoError(t, err)
+	}
+
+	// The objects are all listed under their own names
+	var keys []string
+	for object := range client.ListObjects(ctx, "bucket", minio.ListObjectsOptions{}) {
+		require.NoError(t, object.Err)
+		keys = append(keys, object.Key)
+	}
+	assert.ElementsMatch(t, names, keys)
+	keys = nil
+	for object := range client.ListObjects(ctx, "bucket", minio.ListObjectsOptions{WithVersions: true}) {
+		require.NoError(t, object.Err)
+		assert.True(t, object.IsLatest, object.Key)
+		keys = append(keys, object.Key)
+	}
+	assert.ElementsMatch(t, names, keys)
+
+	// And can be read back
+	for _, name := range names {
+		obj, err := client.GetObject(ctx, "bucket", name, minio.GetObjectOptions{})
+		require.NoError(t, err)
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		require.NoError(t, obj.Close())
+		assert.Equal(t, name, string(data))
+	}
+
+	// The names which could be mistaken are escaped on disk
+	entries, err := os.ReadDir(filepath.Join(dir, "bucket"))
+	require.NoError(t, err)
+	var onDisk []string
+	for _, entry := range entries {
+		onDisk = append(onDisk, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"file.txt", "file-v2023-11-14-221320-000-literal.txt", "file-literal-literal.txt"}, onDisk)
+}
+
+func TestChecksums(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	endpoint, keyid, keysec, _ := serveS3(t, f)
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	const contents = "hello world"
+	sums, err := hash.StreamTypes(strings.NewReader(contents), hash.NewHashSet(hash.CRC32C, hash.CRC64NVME))
+	require.NoError(t, err)
+	toBase64 := func(hexSum string) string {
+		data, err := hex.DecodeString(hexSum)
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	// The headers are passed in the metadata with canonical case so
+	// minio doesn't require trailing header support
+	put := func(remote string, meta map[string]string) error {
+		_, err := client.PutObject(ctx, "bucket", remote, strings.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{
+			UserMetadata: meta,
+		})
+		return err
+	}
+
+	// A correct checksum is accepted and the CRC64NVME calculated
+	require.NoError(t, put("good.txt", map[string]string{"X-Amz-Checksum-Crc32c": toBase64(sums[hash.CRC32C])}))
+	info, err := client.StatObject(ctx, "bucket", "good.txt", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, toBase64(sums[hash.CRC32C]), info.ChecksumCRC32C)
+	assert.Equal(t, toBase64(sums[hash.CRC64NVME]), info.ChecksumCRC64NVME)
+
+	// A bad checksum is rejected and the object not stored
+	err = put("bad.txt", map[string]string{"X-Amz-Checksum-Crc64nvme": toBase64("0000000000000000")})
+	require.Error(t, err)
+	assert.Equal(t, "BadDigest", minio.ToErrorResponse(err).Code)
+	_, err = client.StatObject(ctx, "bucket", "bad.txt", minio.StatObjectOptions{})
+	assert.Error(t, err)
+
+	// The s3 backend can read the CRC64NVME
+	fs3, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Rclone,endpoint='%s',access_key_id=%s,secret_access_key=%s,use_data_integrity_protections=true:bucket", endpoint, keyid, keysec))
+	require.NoError(t, err)
+	o, err := fs3.NewObject(ctx, "good.txt")
+	require.NoError(t, err)
+	gotCRC64, err := o.Hash(ctx, hash.CRC64NVME)
+	require.NoError(t, err)
+	assert.Equal(t, sums[hash.CRC64NVME], gotCRC64)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/gofakes3/signature"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/hash"
 	httplib "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/vfs"
@@ -27,6 +28,7 @@ type ctxKey int
 
 const (
 	ctxKeyID ctxKey = iota
+	ctxKeyVersionID
 )
 
 // Server is a s3.FileSystem interface
@@ -41,6 +43,7 @@ type Server struct {
 	ctx          context.Context // for global config
 	s3Secret     string
 	etagHashType hash.Type
+	versioned    bool // set if the versioning API is enabled
 }
 
 // Make a new S3 Server to serve the remote
@@ -50,6 +53,11 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		ctx:          ctx,
 		opt:          *opt,
 		etagHashType: hash.None,
+		versioned:    opt.Versions || opt.KeepVersions,
+	}
+
+	if w.versioned && proxy.Opt.AuthProxy != "" {
+		return nil, errors.New("can't use --versions or --keep-versions with --auth-proxy")
 	}
 
 	if w.opt.EtagHash == "auto" {
@@ -76,17 +84,22 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	}
 
 	var newLogger logger
-	w.faker = gofakes3.New(
-		newBackend(w),
+	fakerOpts := []gofakes3.Option{
 		gofakes3.WithHostBucket(!opt.ForcePathStyle),
 		gofakes3.WithLogger(newLogger),
 		gofakes3.WithRequestID(rand.Uint64()),
-		gofakes3.WithoutVersioning(),
 		gofakes3.WithV4Auth(authList),
 		gofakes3.WithIntegrityCheck(true), // Check Content-MD5 if supplied
-	)
+	}
+	if !w.versioned {
+		fakerOpts = append(fakerOpts, gofakes3.WithoutVersioning())
+	}
+	w.faker = gofakes3.New(newBackend(w), fakerOpts...)
 
 	w.handler = w.faker.Server()
+	if w.versioned {
+		w.handler = versionIDMiddleware(w.handler)
+	}
 
 	if proxy.Opt.AuthProxy != "" {
 		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
@@ -101,6 +114,10 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		}
 	}
 
+	if proxy.Opt.AuthProxy != "" || len(opt.AuthKey) > 0 {
+		w.handler = auditActorMiddleware(w.handler)
+	}
+
 	w.server, err = httplib.NewServer(ctx,
 		httplib.WithConfig(opt.HTTP),
 		httplib.WithAuth(opt.Auth),
@@ -191,6 +208,30 @@ func proxyAuthMiddleware(next http.Handler, ws *Server) http.Handler {
 	})
 }
 
+// auditActorMiddleware records the access key of the request as the
+// actor for the audit log.
+func auditActorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessKey, _ := parseAccessKeyID(r); accessKey != "" {
+			r = r.WithContext(audit.WithActor(r.Context(), audit.Actor{Type: audit.ActorServe, User: accessKey}))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionIDMiddleware passes the versionId of HEAD requests in the
+// context as gofakes3 doesn't pass it to the backend.
+func versionIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			if versionID := r.URL.Query().Get("versionId"); versionID != "" {
+				r = r.WithContext(context.WithValue(r.Context(), ctxKeyVersionID, gofakes3.VersionID(versionID)))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func parseAccessKeyID(r *http.Request) (accessKey string, error signature.ErrorCode) {
 	v4Auth := r.Header.Get("Authorization")
 	req, err := signature.ParseSignV4(v4Auth)
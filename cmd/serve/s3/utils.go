@@ -2,6 +2,7 @@ package s3
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"io"
@@ -86,6 +87,57 @@ func getFileHash(node any, hashType hash.Type) string {
 	return hash
 }
 
+// checksumHeaders maps the S3 checksum headers onto rclone hash types
+var checksumHeaders = map[string]hash.Type{
+	"X-Amz-Checksum-Crc32":     hash.CRC32,
+	"X-Amz-Checksum-Crc32c":    hash.CRC32C,
+	"X-Amz-Checksum-Crc64nvme": hash.CRC64NVME,
+	"X-Amz-Checksum-Sha1":      hash.SHA1,
+	"X-Amz-Checksum-Sha256":    hash.SHA256,
+}
+
+// checksumTypes returns the hashes which need calculating for an
+// upload with the metadata passed in.
+//
+// This is the CRC64NVME which S3 calculates for all objects along
+// with any checksums the client sent.
+func checksumTypes(meta map[string]string) hash.Set {
+	hashes := hash.NewHashSet(hash.CRC64NVME)
+	for header, hashType := range checksumHeaders {
+		if _, ok := meta[header]; ok {
+			hashes.Add(hashType)
+		}
+	}
+	return hashes
+}
+
+// checkChecksums checks any checksums the client sent in meta
+// against the sums calculated for the upload, returning
+// gofakes3.ErrBadDigest if they don't match.
+//
+// If the client didn't send a CRC64NVME it is added to meta.
+func checkChecksums(meta map[string]string, sums map[hash.Type]string) error {
+	for header, hashType := range checksumHeaders {
+		value, ok := meta[header]
+		if !ok {
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || hex.EncodeToString(want) != sums[hashType] {
+			fs.Debugf("serve s3", "%s: checksum mismatch: got %q want %q", header, sums[hashType], value)
+			return gofakes3.ErrBadDigest
+		}
+	}
+	const header = "X-Amz-Checksum-Crc64nvme"
+	if _, ok := meta[header]; !ok {
+		sum, err := hex.DecodeString(sums[hash.CRC64NVME])
+		if err == nil {
+			meta[header] = base64.StdEncoding.EncodeToString(sum)
+		}
+	}
+	return nil
+}
+
 func prefixParser(p *gofakes3.Prefix) (path, remaining string) {
 	idx := strings.LastIndexByte(p.Prefix, '/')
 	if idx < 0 {
@@ -111,18 +163,18 @@ func mkdirRecursive(path string, VFS *vfs.VFS) error {
 	return nil
 }
 
-func rmdirRecursive(p string, VFS *vfs.VFS) {
+func rmdirRecursive(ctx context.Context, p string, VFS *vfs.VFS) {
 	dir := path.Dir(p)
 	if !strings.ContainsAny(dir, "/\\") {
 		// might be bucket(root)
 		return
 	}
 	if _, err := VFS.Stat(dir); err == nil {
-		err := VFS.Remove(dir)
+		err := VFS.RemoveContext(ctx, dir)
 		if err != nil {
 			return
 		}
-		rmdirRecursive(dir, VFS)
+		rmdirRecursive(ctx, dir, VFS)
 	}
 }
 
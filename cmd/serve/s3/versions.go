@@ -0,0 +1,478 @@
+package s3
+
+// Object versioning
+//
+// Old versions of an object are stored as files next to it with a
+// version string in the name, eg "file-v2006-01-02-150405-000.txt".
+// This is how the s3 and b2 backends show old versions when
+// --s3-versions or --b2-versions are set, and how old versions are
+// kept with --keep-versions. The version ID is the version string.
+//
+// The version ID of the current version is made from its
+// modification time. The version strings only have millisecond
+// resolution so this may be the same as the ID of an old version. If
+// so the current version is given the next free ID which is stored
+// in a file in versionIDDir along with the modification time and
+// size it is for.
+//
+// Objects whose names would be taken for old versions are stored with
+// literalSuffix added to the name.
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/version"
+	"github.com/rclone/rclone/vfs"
+)
+
+// check interface
+var _ gofakes3.VersionedBackend = (*s3Backend)(nil)
+
+// makeVersionID returns the version ID for the version made at t
+func makeVersionID(t time.Time) gofakes3.VersionID {
+	return gofakes3.VersionID(strings.TrimPrefix(version.Add("", t.UTC()), "-"))
+}
+
+// parseVersionID returns the time the version with id was made
+func parseVersionID(id gofakes3.VersionID) (t time.Time, ok bool) {
+	t, rest := version.Remove("-" + string(id))
+	return t, !t.IsZero() && rest == ""
+}
+
+// versionIDDir is the directory at the root of the VFS holding the
+// version IDs of current versions which aren't made from their
+// modification times. Bucket names can't start with "." so it can't
+// be a bucket.
+const versionIDDir = ".rclone-version-ids"
+
+// literalSuffix is added to the names of objects which would be
+// taken for old versions
+const literalSuffix = "-literal"
+
+// versionIDRecord is stored in versionIDDir
+type versionIDRecord struct {
+	ModTime   time.Time          // modification time of the version
+	Size      int64              // size of the version
+	VersionID gofakes3.VersionID // version ID of the version
+}
+
+// splitExt splits leaf into base and extension in the same way as
+// lib/version does
+func splitExt(leaf string) (base, ext string) {
+	ext = path.Ext(leaf)
+	base = leaf[:len(leaf)-len(ext)]
+	if ext != "" && base == "" {
+		base, ext = ext, base
+	}
+	return base, ext
+}
+
+// escapeLeaf returns the name to store an object called leaf under
+// when versioning is enabled.
+//
+// Names which would be taken for old versions, and names which end in
+// literalSuffix already, have literalSuffix added to them.
+func escapeLeaf(leaf string) string {
+	base, ext := splitExt(leaf)
+	if t, _ := version.Remove(leaf); !t.IsZero() || strings.HasSuffix(base, literalSuffix) {
+		return base + literalSuffix + ext
+	}
+	return leaf
+}
+
+// unescapeLeaf returns the name of the object stored as leaf
+func unescapeLeaf(leaf string) string {
+	base, ext := splitExt(leaf)
+	if strings.HasSuffix(base, literalSuffix) {
+		return strings.TrimSuffix(base, literalSuffix) + ext
+	}
+	return leaf
+}
+
+// objectPath returns the path of objectName in bucketName
+func (b *s3Backend) objectPath(bucketName, objectName string) string {
+	if b.s.versioned {
+		dir, leaf := path.Split(objectName)
+		objectName = dir + escapeLeaf(leaf)
+	}
+	return path.Join(bucketName, objectName)
+}
+
+// currentVersionID returns the version ID of node, the current
+// version at fp
+func currentVersionID(_vfs *vfs.VFS, fp string, node vfs.Node) gofakes3.VersionID {
+	data, err := _vfs.ReadFile(path.Join(versionIDDir, fp))
+	if err == nil {
+		var r versionIDRecord
+		if json.Unmarshal(data, &r) == nil && r.ModTime.Equal(node.ModTime()) && r.Size == node.Size() {
+			return r.VersionID
+		}
+	}
+	return makeVersionID(node.ModTime())
+}
+
+// removeVersionID removes the stored version ID of the current
+// version at fp if there is one
+func removeVersionID(ctx context.Context, _vfs *vfs.VFS, fp string) {
+	idPath := path.Join(versionIDDir, fp)
+	if _, err := _vfs.Stat(idPath); err != nil {
+		return
+	}
+	if err := _vfs.RemoveContext(ctx, idPath); err != nil {
+		fs.Errorf(fp, "Failed to remove version ID: %v", err)
+		return
+	}
+	rmdirRecursive(ctx, idPath, _vfs)
+}
+
+// findObject finds versionID of objectName in bucketName, or the
+// current version if versionID is empty.
+//
+// It returns the path of the file, its node, and its version ID, which
+// is empty if versioning isn't enabled.
+func (b *s3Backend) findObject(_vfs *vfs.VFS, bucketName, objectName string, versionID gofakes3.VersionID) (fp string, node vfs.Node, id gofakes3.VersionID, err error) {
+	fp = b.objectPath(bucketName, objectName)
+	node, err = _vfs.Stat(fp)
+	if err == nil && node.IsFile() {
+		if b.s.versioned {
+			id = currentVersionID(_vfs, fp, node)
+		}
+		if versionID == "" || versionID == "null" || versionID == id {
+			return fp, node, id, nil
+		}
+	} else if versionID == "" || versionID == "null" {
+		return "", nil, "", gofakes3.KeyNotFound(objectName)
+	}
+
+	t, ok := parseVersionID(versionID)
+	if !ok {
+		return "", nil, "", gofakes3.ErrNoSuchVersion
+	}
+	fp = version.Add(fp, t)
+	node, err = _vfs.Stat(fp)
+	if err != nil || !node.IsFile() {
+		return "", nil, "", gofakes3.ErrNoSuchVersion
+	}
+	return fp, node, versionID, nil
+}
+
+// uniqueVersionTime returns t, moved on a millisecond at a time if
+// necessary, so that no old version of fp has the same version ID.
+func uniqueVersionTime(_vfs *vfs.VFS, fp string, t time.Time) time.Time {
+	t = t.UTC()
+	for {
+		if _, err := _vfs.Stat(version.Add(fp, t)); err != nil {
+			return t
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// setVersionID gives the new current version at fp a version ID
+// different from those of its old versions, returning the ID.
+//
+// If the ID isn't the one made from the modification time it is
+// stored in versionIDDir.
+func setVersionID(ctx context.Context, _vfs *vfs.VFS, fp string) (gofakes3.VersionID, error) {
+	node, err := _vfs.Stat(fp)
+	if err != nil {
+		return "", err
+	}
+	modTime := node.ModTime()
+	versionTime := uniqueVersionTime(_vfs, fp, modTime)
+	if versionTime.Equal(modTime) {
+		removeVersionID(ctx, _vfs, fp)
+		return makeVersionID(modTime), nil
+	}
+	id := makeVersionID(versionTime)
+	fs.Debugf(fp, "Using version ID %s as the modification time is the same as an old version", id)
+	data, err := json.Marshal(versionIDRecord{
+		ModTime:   modTime,
+		Size:      node.Size(),
+		VersionID: id,
+	})
+	if err != nil {
+		return "", err
+	}
+	idPath := path.Join(versionIDDir, fp)
+	if err := mkdirRecursive(path.Dir(idPath), _vfs); err != nil {
+		return "", err
+	}
+	if err := _vfs.WriteFile(idPath, data, 0600); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// keepVersion renames the file at fp, if it exists, to an old
+// version named with its version ID so it isn't overwritten or
+// deleted.
+func keepVersion(ctx context.Context, _vfs *vfs.VFS, fp string) error {
+	node, err := _vfs.Stat(fp)
+	if err == vfs.ENOENT {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !node.IsFile() {
+		return nil
+	}
+	t, ok := parseVersionID(currentVersionID(_vfs, fp, node))
+	if !ok {
+		t = node.ModTime()
+	}
+	// The ID can only be in use already if the file was changed
+	// elsewhere, in which case the next free one is used
+	err = _vfs.RenameContext(ctx, fp, version.Add(fp, uniqueVersionTime(_vfs, fp, t)))
+	if err != nil {
+		return err
+	}
+	removeVersionID(ctx, _vfs, fp)
+	return nil
+}
+
+// getVersionedVFS gets the VFS and checks bucketName exists.
+//
+// The VersionedBackend calls aren't passed a context so they can only
+// use the VFS for the remote being served, which is why versioning
+// can't be used with --auth-proxy.
+func (b *s3Backend) getVersionedVFS(bucketName string) (*vfs.VFS, error) {
+	_vfs, err := b.s.getVFS(b.s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = _vfs.Stat(bucketName)
+	if err != nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	return _vfs, nil
+}
+
+// VersioningConfiguration returns the versioning configuration of the
+// bucket which is always enabled.
+func (b *s3Backend) VersioningConfiguration(bucketName string) (config gofakes3.VersioningConfiguration, err error) {
+	_, err = b.getVersionedVFS(bucketName)
+	if err != nil {
+		return config, err
+	}
+	config.SetEnabled(true)
+	return config, nil
+}
+
+// SetVersioningConfiguration sets the versioning configuration of the
+// bucket.
+//
+// Versioning can't be suspended as it is set for the whole server.
+func (b *s3Backend) SetVersioningConfiguration(bucketName string, config gofakes3.VersioningConfiguration) error {
+	_, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return err
+	}
+	if config.Status == gofakes3.VersioningSuspended {
+		return gofakes3.ErrNotImplemented
+	}
+	return nil
+}
+
+// GetObjectVersion fetches versionID of the object from the filesystem.
+func (b *s3Backend) GetObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	_vfs, err := b.s.getVFS(b.s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.getObject(_vfs, bucketName, objectName, versionID, rangeRequest)
+}
+
+// HeadObjectVersion returns the fileinfo for versionID of the object.
+func (b *s3Backend) HeadObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
+	_vfs, err := b.s.getVFS(b.s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.headObject(_vfs, bucketName, objectName, versionID)
+}
+
+// DeleteObjectVersion permanently deletes versionID of the object.
+func (b *s3Backend) DeleteObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return result, err
+	}
+	fp, _, id, err := b.findObject(_vfs, bucketName, objectName, versionID)
+	if err != nil {
+		// S3 doesn't report an error if the version doesn't exist
+		return result, nil
+	}
+	if err := _vfs.Remove(fp); err != nil {
+		return result, err
+	}
+	removeVersionID(b.s.ctx, _vfs, fp)
+	rmdirRecursive(b.s.ctx, fp, _vfs)
+	result.VersionID = id
+	return result, nil
+}
+
+// versionListItem is an entry in the version listing - either a
+// version or a common prefix if version is nil
+type versionListItem struct {
+	key     string
+	version *gofakes3.Version
+}
+
+// ListBucketVersions lists all the versions of the objects in the bucket.
+func (b *s3Backend) ListBucketVersions(bucketName string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	var p gofakes3.Prefix
+	if prefix != nil {
+		p = *prefix
+	}
+	if page == nil {
+		page = &gofakes3.ListBucketVersionsPage{}
+	}
+
+	// workaround
+	if strings.TrimSpace(p.Prefix) == "" {
+		p.HasPrefix = false
+	}
+	if strings.TrimSpace(p.Delimiter) == "" {
+		p.HasDelimiter = false
+	}
+
+	var items []versionListItem
+	dir, remaining := prefixParser(&p)
+	err = b.versionListR(_vfs, bucketName, dir, remaining, p.HasDelimiter, &items)
+	if err != nil && err != gofakes3.ErrNoSuchKey {
+		return nil, err
+	}
+
+	// Sort by key then the current version then newest version first
+	// like S3
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].key != items[j].key {
+			return items[i].key < items[j].key
+		}
+		if items[i].version == nil || items[j].version == nil {
+			return items[i].version == nil
+		}
+		if items[i].version.IsLatest != items[j].version.IsLatest {
+			return items[i].version.IsLatest
+		}
+		return items[i].version.LastModified.After(items[j].version.LastModified.Time)
+	})
+
+	// Skip to the markers
+	start := 0
+	if page.HasKeyMarker {
+		start = len(items)
+		for i, item := range items {
+			if item.key < page.KeyMarker {
+				continue
+			}
+			if item.key == page.KeyMarker {
+				if page.HasVersionIDMarker && item.version != nil && item.version.VersionID == page.VersionIDMarker {
+					start = i + 1
+					break
+				}
+				continue
+			}
+			start = i
+			break
+		}
+	}
+	items = items[start:]
+
+	maxKeys := page.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = gofakes3.DefaultMaxBucketVersionKeys
+	}
+	result := gofakes3.NewListBucketVersionsResult(bucketName, prefix, page)
+	if int64(len(items)) > maxKeys {
+		items = items[:maxKeys]
+		last := items[len(items)-1]
+		result.IsTruncated = true
+		result.NextKeyMarker = last.key
+		if last.version != nil {
+			result.NextVersionIDMarker = last.version.VersionID
+		}
+	}
+	for _, item := range items {
+		if item.version == nil {
+			result.AddPrefix(item.key)
+		} else {
+			result.Versions = append(result.Versions, item.version)
+		}
+	}
+	return result, nil
+}
+
+// versionListR lists the current and old versions of the objects in
+// fdPath which start with name, recursing into directories unless
+// addPrefix is set.
+func (b *s3Backend) versionListR(_vfs *vfs.VFS, bucket, fdPath, name string, addPrefix bool, items *[]versionListItem) error {
+	fp := path.Join(bucket, fdPath)
+
+	dirEntries, err := getDirEntries(fp, _vfs)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range dirEntries {
+		object := entry.Name()
+		objectPath := path.Join(fdPath, object)
+
+		if entry.IsDir() {
+			if !strings.HasPrefix(object, name) {
+				continue
+			}
+			if addPrefix {
+				*items = append(*items, versionListItem{key: objectPath + "/"})
+				continue
+			}
+			err := b.versionListR(_vfs, bucket, objectPath, "", false, items)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		isLatest := true
+		modTime := entry.ModTime()
+		var id gofakes3.VersionID
+		if t, leaf := version.Remove(object); !t.IsZero() {
+			object = leaf
+			isLatest = false
+			modTime = t
+			id = makeVersionID(t)
+		} else {
+			id = currentVersionID(_vfs, path.Join(fp, object), entry)
+		}
+		object = unescapeLeaf(object)
+		objectPath = path.Join(fdPath, object)
+		if !strings.HasPrefix(object, name) {
+			continue
+		}
+		*items = append(*items, versionListItem{
+			key: objectPath,
+			version: &gofakes3.Version{
+				Key:          objectPath,
+				VersionID:    id,
+				IsLatest:     isLatest,
+				LastModified: gofakes3.NewContentTime(modTime.UTC()),
+				Size:         entry.Size(),
+				StorageClass: gofakes3.StorageStandard,
+				ETag:         getFileHash(entry, b.s.etagHashType),
+			},
+		})
+	}
+	return nil
+}
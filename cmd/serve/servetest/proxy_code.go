@@ -28,6 +28,10 @@ func main() {
 		"_root":    root,
 		"_obscure": "pass",
 	}
+	// Return a password for protocols which don't send one
+	if in["pass"] == "" && in["public_key"] == "" {
+		out["_password"] = "pass-" + in["user"]
+	}
 	json.NewEncoder(os.Stdout).Encode(&out)
 	if err != nil {
 		log.Fatal(err)
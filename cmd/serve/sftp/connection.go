@@ -67,23 +67,29 @@ func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (
 	fs.Debugf(c.what, "exec command: binary = %q, args = %q", binary, args)
 	switch binary {
 	case "df":
-		about := c.vfs.Fs().Features().About
-		if about == nil {
-			return errors.New("df not supported")
-		}
-		usage, err := about(ctx)
-		if err != nil {
-			return fmt.Errorf("about failed: %w", err)
-		}
 		total, used, free := int64(-1), int64(-1), int64(-1)
-		if usage.Total != nil {
-			total = *usage.Total / 1024
-		}
-		if usage.Used != nil {
-			used = *usage.Used / 1024
-		}
-		if usage.Free != nil {
-			free = *usage.Free / 1024
+		if _, maxBytes, _, _, ok := c.vfs.Quota(); ok && maxBytes >= 0 {
+			// Report the quota
+			total, used, free = c.vfs.Statfs()
+			total, used, free = total/1024, used/1024, free/1024
+		} else {
+			about := c.vfs.Fs().Features().About
+			if about == nil {
+				return errors.New("df not supported")
+			}
+			usage, err := about(ctx)
+			if err != nil {
+				return fmt.Errorf("about failed: %w", err)
+			}
+			if usage.Total != nil {
+				total = *usage.Total / 1024
+			}
+			if usage.Used != nil {
+				used = *usage.Used / 1024
+			}
+			if usage.Free != nil {
+				free = *usage.Free / 1024
+			}
 		}
 		perc := int64(0)
 		if total > 0 && used >= 0 {
@@ -358,7 +364,7 @@ func serveStdio(f fs.Fs) error {
 		stdin:  os.Stdin,
 		stdout: os.Stdout,
 	}
-	handlers := newVFSHandler(vfs.New(f, &vfscommon.Opt))
+	handlers := newVFSHandler(vfs.New(f, &vfscommon.Opt), "")
 	return serveChannel(sshChannel, handlers, "stdio")
 }
 
@@ -3,6 +3,7 @@
 package sftp
 
 import (
+	"context"
 	"io"
 	"os"
 	"syscall"
@@ -10,17 +11,24 @@ import (
 
 	"github.com/pkg/sftp"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/vfs"
 )
 
 // vfsHandler converts the VFS to be served by SFTP
 type vfsHandler struct {
 	*vfs.VFS
+	ctx context.Context // holds the audit actor for the changes
 }
 
 // vfsHandler returns a Handlers object with the test handlers.
-func newVFSHandler(vfs *vfs.VFS) sftp.Handlers {
-	v := vfsHandler{VFS: vfs}
+//
+// The changes are recorded in the audit log against user if set.
+func newVFSHandler(vfs *vfs.VFS, user string) sftp.Handlers {
+	v := vfsHandler{VFS: vfs, ctx: context.Background()}
+	if user != "" {
+		v.ctx = audit.WithActor(v.ctx, audit.Actor{Type: audit.ActorServe, User: user})
+	}
 	return sftp.Handlers{
 		FileGet:  v,
 		FilePut:  v,
@@ -38,7 +46,7 @@ func (v vfsHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
 }
 
 func (v vfsHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
-	file, err := v.OpenFile(r.Filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	file, err := v.OpenFileContext(v.ctx, r.Filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
 		return nil, err
 	}
@@ -58,12 +66,12 @@ func (v vfsHandler) Filecmd(r *sftp.Request) error {
 		}
 		return nil
 	case "Rename":
-		err := v.Rename(r.Filepath, r.Target)
+		err := v.RenameContext(v.ctx, r.Filepath, r.Target)
 		if err != nil {
 			return err
 		}
 	case "Rmdir", "Remove":
-		err := v.Remove(r.Filepath)
+		err := v.RemoveContext(v.ctx, r.Filepath)
 		if err != nil {
 			return err
 		}
@@ -90,6 +98,30 @@ func (v vfsHandler) Filecmd(r *sftp.Request) error {
 	return nil
 }
 
+// StatVFS returns info about the filing system for the
+// statvfs@openssh.com extension
+func (v vfsHandler) StatVFS(r *sftp.Request) (*sftp.StatVFS, error) {
+	const blockSize = 4096
+	total, _, free := v.Statfs()
+	stat := &sftp.StatVFS{
+		Bsize:   blockSize,
+		Frsize:  blockSize,
+		Blocks:  uint64(total) / blockSize,
+		Bfree:   uint64(free) / blockSize,
+		Bavail:  uint64(free) / blockSize,
+		Files:   1e9,
+		Ffree:   1e9,
+		Favail:  1e9,
+		Namemax: 255,
+	}
+	if _, _, usedFiles, maxFiles, ok := v.Quota(); ok && maxFiles >= 0 {
+		stat.Files = uint64(maxFiles)
+		stat.Ffree = uint64(max(maxFiles-usedFiles, 0))
+		stat.Favail = stat.Ffree
+	}
+	return stat, nil
+}
+
 type listerat []os.FileInfo
 
 // Modeled after strings.Reader's ReadAt() implementation
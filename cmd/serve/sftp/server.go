@@ -112,7 +112,7 @@ func (s *server) acceptConnection(nConn net.Conn) {
 		_ = nConn.Close()
 		return
 	}
-	c.handlers = newVFSHandler(c.vfs)
+	c.handlers = newVFSHandler(c.vfs, sshConn.User())
 
 	// Accept all channels
 	go c.handleChannels(chans)
@@ -23,6 +23,7 @@ import (
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -37,6 +38,8 @@ var (
 	_ sftp.FileWriter = vfsHandler{}
 	_ sftp.FileCmder  = vfsHandler{}
 	_ sftp.FileLister = vfsHandler{}
+
+	_ sftp.StatVFSFileCmder = vfsHandler{}
 )
 
 // TestSftp runs the sftp server then runs the unit tests for the
@@ -85,3 +88,69 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+func TestQuota(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+
+	opt := Opt
+	opt.ListenAddr = testBindAddress
+	opt.User = testUser
+	opt.Pass = testPass
+	vfsOpt := vfscommon.Opt
+	vfsOpt.QuotaBytes = 1024 * 1024
+	vfsOpt.QuotaFiles = 10
+
+	w, err := newServer(context.Background(), f, &opt, &vfsOpt, &proxy.Opt)
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, w.Serve())
+	}()
+	defer func() {
+		assert.NoError(t, w.Shutdown())
+	}()
+
+	sshClient, err := ssh.Dial("tcp", w.Addr().String(), &ssh.ClientConfig{
+		User:            testUser,
+		Auth:            []ssh.AuthMethod{ssh.Password(testPass)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = sshClient.Close()
+	}()
+	client, err := sftp.NewClient(sshClient)
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	// Write a file
+	file, err := client.Create("file.txt")
+	require.NoError(t, err)
+	_, err = file.Write(make([]byte, 256*1024))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// Check the quota is reported by statvfs
+	stat, err := client.StatVFS("/")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1024*1024), stat.TotalSpace())
+	assert.Equal(t, uint64(768*1024), stat.FreeSpace())
+	assert.Equal(t, uint64(10), stat.Files)
+	assert.Equal(t, uint64(9), stat.Ffree)
+
+	// Check the quota is reported by df
+	session, err := sshClient.NewSession()
+	require.NoError(t, err)
+	out, err := session.Output("df")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "/dev/root 1024 256  768  25% /")
+
+	// Check writes over the quota fail
+	file, err = client.Create("big.txt")
+	require.NoError(t, err)
+	_, err = file.Write(make([]byte, 1024*1024))
+	assert.ErrorContains(t, err, "No space left on device")
+	_ = file.Close()
+}
@@ -0,0 +1,484 @@
+package smb
+
+// NTLMv2 authentication wrapped in SPNEGO from MS-NLMP and RFC 4178
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // NTLM needs md4
+)
+
+// ASN.1 object identifiers
+var (
+	oidSPNEGO  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidNTLMSSP = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+// SPNEGO negotiation states
+const (
+	negStateAcceptCompleted  = 0
+	negStateAcceptIncomplete = 1
+)
+
+// negTokenResp is the SPNEGO response token
+type negTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"explicit,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// negTokenInit is the server's initial SPNEGO token
+type negTokenInit struct {
+	MechTypes []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+}
+
+// spnegoToken is what is read from a SPNEGO token from the client
+type spnegoToken struct {
+	mechTypes     []byte // DER encoded MechTypeList if sent
+	hasNTLM       bool   // set if NTLM is one of the mechTypes
+	responseToken []byte // the NTLM message
+	mechListMIC   []byte // optional MIC
+}
+
+// marshalContext marshals b wrapped in an ASN.1 tag of class
+func marshalContext(class, tag int, b []byte) []byte {
+	out, _ := asn1.Marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: true, Bytes: b})
+	return out
+}
+
+// spnegoInitToken returns the token the server sends in the
+// negotiate response advertising NTLM
+func spnegoInitToken() []byte {
+	inner, _ := asn1.Marshal(negTokenInit{MechTypes: []asn1.ObjectIdentifier{oidNTLMSSP}})
+	oid, _ := asn1.Marshal(oidSPNEGO)
+	return marshalContext(asn1.ClassApplication, 0, append(oid, marshalContext(asn1.ClassContextSpecific, 0, inner)...))
+}
+
+// spnegoResponse returns a SPNEGO response token
+func spnegoResponse(state int, ntlmToken, mic []byte) []byte {
+	resp := negTokenResp{
+		NegState:      asn1.Enumerated(state),
+		ResponseToken: ntlmToken,
+		MechListMIC:   mic,
+	}
+	if state == negStateAcceptIncomplete {
+		resp.SupportedMech = oidNTLMSSP
+	}
+	inner, _ := asn1.Marshal(resp)
+	return marshalContext(asn1.ClassContextSpecific, 1, inner)
+}
+
+// parseSPNEGO parses the security buffer from a session setup
+// request.
+//
+// Raw NTLM messages are accepted too.
+func parseSPNEGO(b []byte) (tok spnegoToken, err error) {
+	if bytes.HasPrefix(b, ntlmSignature) {
+		tok.hasNTLM = true
+		tok.responseToken = b
+		return tok, nil
+	}
+	var outer asn1.RawValue
+	_, err = asn1.Unmarshal(b, &outer)
+	if err != nil {
+		return tok, fmt.Errorf("bad SPNEGO token: %w", err)
+	}
+	var fields []byte
+	switch {
+	case outer.Class == asn1.ClassApplication && outer.Tag == 0:
+		// NegTokenInit: OID then [0] SEQUENCE
+		var oid asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(outer.Bytes, &oid)
+		if err != nil || !oid.Equal(oidSPNEGO) {
+			return tok, errors.New("bad SPNEGO init token")
+		}
+		var init asn1.RawValue
+		_, err = asn1.Unmarshal(rest, &init)
+		if err != nil || init.Class != asn1.ClassContextSpecific || init.Tag != 0 {
+			return tok, errors.New("bad SPNEGO init token")
+		}
+		fields = init.Bytes
+	case outer.Class == asn1.ClassContextSpecific && outer.Tag == 1:
+		// NegTokenResp
+		fields = outer.Bytes
+	default:
+		return tok, errors.New("unknown SPNEGO token")
+	}
+	var seq asn1.RawValue
+	_, err = asn1.Unmarshal(fields, &seq)
+	if err != nil || seq.Tag != asn1.TagSequence {
+		return tok, errors.New("bad SPNEGO token sequence")
+	}
+	rest := seq.Bytes
+	for len(rest) > 0 {
+		var field asn1.RawValue
+		rest, err = asn1.Unmarshal(rest, &field)
+		if err != nil {
+			return tok, fmt.Errorf("bad SPNEGO token field: %w", err)
+		}
+		if field.Class != asn1.ClassContextSpecific {
+			continue
+		}
+		switch {
+		case outer.Tag == 0 && field.Tag == 0:
+			tok.mechTypes = field.Bytes
+			var mechs []asn1.ObjectIdentifier
+			_, err = asn1.Unmarshal(field.Bytes, &mechs)
+			if err != nil {
+				return tok, fmt.Errorf("bad SPNEGO mech types: %w", err)
+			}
+			for _, mech := range mechs {
+				if mech.Equal(oidNTLMSSP) {
+					tok.hasNTLM = true
+				}
+			}
+		case field.Tag == 2:
+			_, err = asn1.Unmarshal(field.Bytes, &tok.responseToken)
+			if err != nil {
+				return tok, fmt.Errorf("bad SPNEGO token: %w", err)
+			}
+		case field.Tag == 3:
+			_, err = asn1.Unmarshal(field.Bytes, &tok.mechListMIC)
+			if err != nil {
+				return tok, fmt.Errorf("bad SPNEGO mechListMIC: %w", err)
+			}
+		}
+	}
+	if outer.Tag == 1 {
+		tok.hasNTLM = true
+	}
+	return tok, nil
+}
+
+// NTLM message types
+const (
+	ntlmNegotiate    = 1
+	ntlmChallenge    = 2
+	ntlmAuthenticate = 3
+)
+
+// NTLM negotiate flags
+const (
+	ntlmNegotiateUnicode     = 0x00000001
+	ntlmRequestTarget        = 0x00000004
+	ntlmNegotiateSign        = 0x00000010
+	ntlmNegotiateSeal        = 0x00000020
+	ntlmNegotiateNTLM        = 0x00000200
+	ntlmNegotiateAlwaysSign  = 0x00008000
+	ntlmTargetTypeServer     = 0x00020000
+	ntlmNegotiateExtendedSec = 0x00080000
+	ntlmNegotiateTargetInfo  = 0x00800000
+	ntlmNegotiateVersion     = 0x02000000
+	ntlmNegotiate128         = 0x20000000
+	ntlmNegotiateKeyExch     = 0x40000000
+	ntlmNegotiate56          = 0x80000000
+)
+
+// flags the server supports
+const ntlmServerFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateSign | ntlmNegotiateSeal |
+	ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSec | ntlmNegotiateTargetInfo |
+	ntlmNegotiateVersion | ntlmNegotiate128 | ntlmNegotiateKeyExch | ntlmNegotiate56
+
+// NTLM AV pair IDs
+const (
+	avEOL             = 0
+	avNbComputerName  = 1
+	avNbDomainName    = 2
+	avDNSComputerName = 3
+	avDNSDomainName   = 4
+	avFlags           = 6
+	avTimestamp       = 7
+	avFlagMICPresent  = 0x00000002
+)
+
+// ntlmSignature starts every NTLM message
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmVersion is sent as the server version - Windows 10
+var ntlmVersion = []byte{10, 0, 0x61, 0x4a, 0, 0, 0, 0x0f}
+
+// ntlmAuth is the server side of an NTLM authentication
+type ntlmAuth struct {
+	targetName string // NetBIOS name of the server
+	negotiate  []byte // the NEGOTIATE message
+	challenge  []byte // the CHALLENGE message
+	flags      uint32 // negotiated flags
+	mechTypes  []byte // mechTypes sent by the client for the mechListMIC
+}
+
+// ntlmResult is what an authentication produced
+type ntlmResult struct {
+	user       string
+	domain     string
+	anonymous  bool
+	sessionKey []byte // exported session key
+	flags      uint32
+}
+
+// newNTLMAuth makes a new NTLM authentication for targetName
+func newNTLMAuth(targetName string) *ntlmAuth {
+	return &ntlmAuth{
+		targetName: targetName,
+	}
+}
+
+// payload appends the security buffer b to payload and writes its
+// fields at off in msg
+func ntlmPutField(msg []byte, off int, b []byte, payloadOffset int) {
+	le.PutUint16(msg[off:], uint16(len(b)))
+	le.PutUint16(msg[off+2:], uint16(len(b)))
+	le.PutUint32(msg[off+4:], uint32(payloadOffset))
+}
+
+// ntlmField reads the security buffer described at off in msg
+func ntlmField(msg []byte, off int) ([]byte, error) {
+	if len(msg) < off+8 {
+		return nil, errors.New("NTLM message too short")
+	}
+	length := int(le.Uint16(msg[off:]))
+	offset := int(le.Uint32(msg[off+4:]))
+	if length == 0 {
+		return nil, nil
+	}
+	if offset+length > len(msg) {
+		return nil, errors.New("NTLM field out of range")
+	}
+	return msg[offset : offset+length], nil
+}
+
+// avPair encodes an AV pair
+func avPair(e *encoder, id uint16, value []byte) {
+	e.u16(id)
+	e.u16(uint16(len(value)))
+	e.bytes(value)
+}
+
+// parseAVPairs parses the AV pairs in b
+func parseAVPairs(b []byte) map[uint16][]byte {
+	pairs := make(map[uint16][]byte)
+	for len(b) >= 4 {
+		id := le.Uint16(b)
+		n := int(le.Uint16(b[2:]))
+		if id == avEOL || len(b) < 4+n {
+			break
+		}
+		pairs[id] = b[4 : 4+n]
+		b = b[4+n:]
+	}
+	return pairs
+}
+
+// Challenge reads the NEGOTIATE message and returns the CHALLENGE
+func (a *ntlmAuth) Challenge(negotiate []byte) ([]byte, error) {
+	if len(negotiate) < 16 || !bytes.HasPrefix(negotiate, ntlmSignature) || le.Uint32(negotiate[8:]) != ntlmNegotiate {
+		return nil, errors.New("bad NTLM NEGOTIATE message")
+	}
+	a.negotiate = bytes.Clone(negotiate)
+	a.flags = le.Uint32(negotiate[12:])&ntlmServerFlags | ntlmTargetTypeServer | ntlmNegotiateTargetInfo | ntlmRequestTarget
+
+	targetName := encodeString(a.targetName)
+	var info encoder
+	avPair(&info, avNbDomainName, targetName)
+	avPair(&info, avNbComputerName, targetName)
+	avPair(&info, avDNSDomainName, encodeString(strings.ToLower(a.targetName)))
+	avPair(&info, avDNSComputerName, encodeString(strings.ToLower(a.targetName)))
+	avPair(&info, avTimestamp, le.AppendUint64(nil, filetime(time.Now())))
+	avPair(&info, avEOL, nil)
+
+	const fixed = 56
+	msg := make([]byte, fixed, fixed+len(targetName)+len(info.b))
+	copy(msg, ntlmSignature)
+	le.PutUint32(msg[8:], ntlmChallenge)
+	ntlmPutField(msg, 12, targetName, len(msg))
+	msg = append(msg, targetName...)
+	le.PutUint32(msg[20:], a.flags)
+	_, err := rand.Read(msg[24:32])
+	if err != nil {
+		return nil, err
+	}
+	ntlmPutField(msg, 40, info.b, len(msg))
+	msg = append(msg, info.b...)
+	copy(msg[48:56], ntlmVersion)
+	a.challenge = msg
+	return msg, nil
+}
+
+// ntHash returns the NT hash of the password which is all that is
+// needed to check NTLM logins
+func ntHash(pass string) []byte {
+	h := md4.New()
+	h.Write(encodeString(pass))
+	return h.Sum(nil)
+}
+
+// ntowfv2 returns the NTLMv2 hash of the user, the NT hash of the
+// password and domain
+func ntowfv2(user string, passHash []byte, domain string) []byte {
+	m := hmac.New(md5.New, passHash)
+	m.Write(encodeString(strings.ToUpper(user) + domain))
+	return m.Sum(nil)
+}
+
+// authenticateMessage is the parsed AUTHENTICATE message
+type authenticateMessage struct {
+	raw          []byte
+	lmResponse   []byte
+	ntResponse   []byte
+	domain       string
+	user         string
+	encryptedKey []byte
+	flags        uint32
+}
+
+// ParseAuthenticate parses the AUTHENTICATE message
+func (a *ntlmAuth) ParseAuthenticate(msg []byte) (am *authenticateMessage, err error) {
+	if len(msg) < 64 || !bytes.HasPrefix(msg, ntlmSignature) || le.Uint32(msg[8:]) != ntlmAuthenticate {
+		return nil, errors.New("bad NTLM AUTHENTICATE message")
+	}
+	if a.challenge == nil {
+		return nil, errors.New("NTLM AUTHENTICATE without CHALLENGE")
+	}
+	am = &authenticateMessage{
+		raw:   bytes.Clone(msg),
+		flags: le.Uint32(msg[60:]),
+	}
+	var domain, user []byte
+	for _, field := range []struct {
+		off int
+		p   *[]byte
+	}{
+		{12, &am.lmResponse},
+		{20, &am.ntResponse},
+		{28, &domain},
+		{36, &user},
+		{52, &am.encryptedKey},
+	} {
+		*field.p, err = ntlmField(msg, field.off)
+		if err != nil {
+			return nil, err
+		}
+	}
+	am.domain = decodeString(domain)
+	am.user = decodeString(user)
+	return am, nil
+}
+
+// Anonymous returns true if this is an anonymous login
+func (am *authenticateMessage) Anonymous() bool {
+	return am.user == "" && len(am.ntResponse) == 0 && len(am.lmResponse) <= 1
+}
+
+// Verify checks the client knew the password with NT hash passHash
+// and returns the result of the authentication if so
+func (a *ntlmAuth) Verify(am *authenticateMessage, passHash []byte) (res *ntlmResult, err error) {
+	if len(am.ntResponse) < 16+28 {
+		return nil, errors.New("NTLMv2 response required")
+	}
+	proof, blob := am.ntResponse[:16], am.ntResponse[16:]
+	serverChallenge := a.challenge[24:32]
+
+	// Some clients use an empty domain
+	var key []byte
+	for _, domain := range []string{am.domain, ""} {
+		k := ntowfv2(am.user, passHash, domain)
+		m := hmac.New(md5.New, k)
+		m.Write(serverChallenge)
+		m.Write(blob)
+		if hmac.Equal(m.Sum(nil), proof) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, errors.New("bad password")
+	}
+
+	m := hmac.New(md5.New, key)
+	m.Write(proof)
+	sessionBaseKey := m.Sum(nil)
+	res = &ntlmResult{
+		user:       am.user,
+		domain:     am.domain,
+		sessionKey: sessionBaseKey,
+		flags:      a.flags & am.flags,
+	}
+	if res.flags&ntlmNegotiateKeyExch != 0 && len(am.encryptedKey) == 16 {
+		c, err := rc4.NewCipher(sessionBaseKey)
+		if err != nil {
+			return nil, err
+		}
+		res.sessionKey = make([]byte, 16)
+		c.XORKeyStream(res.sessionKey, am.encryptedKey)
+	}
+
+	// Check the MIC if the client says it sent one
+	pairs := parseAVPairs(blob[28:])
+	if flags, ok := pairs[avFlags]; ok && len(flags) == 4 && le.Uint32(flags)&avFlagMICPresent != 0 {
+		if len(am.raw) < 88 {
+			return nil, errors.New("NTLM MIC missing")
+		}
+		raw := bytes.Clone(am.raw)
+		mic := bytes.Clone(raw[72:88])
+		clear(raw[72:88])
+		m := hmac.New(md5.New, res.sessionKey)
+		m.Write(a.negotiate)
+		m.Write(a.challenge)
+		m.Write(raw)
+		if !hmac.Equal(m.Sum(nil), mic) {
+			return nil, errors.New("bad NTLM MIC")
+		}
+	}
+	return res, nil
+}
+
+// ntlmKey derives a signing or sealing key from the session key
+func ntlmKey(sessionKey []byte, magic string) []byte {
+	h := md5.New()
+	h.Write(sessionKey)
+	h.Write([]byte(magic))
+	return h.Sum(nil)
+}
+
+// ntlmMAC returns the NTLM message signature of msg using sequence
+// number 0 with the keys for the direction given by from
+func ntlmMAC(res *ntlmResult, from string, msg []byte) []byte {
+	signKey := ntlmKey(res.sessionKey, "session key to "+from+" signing key magic constant\x00")
+	seq := []byte{0, 0, 0, 0}
+	m := hmac.New(md5.New, signKey)
+	m.Write(seq)
+	m.Write(msg)
+	checksum := m.Sum(nil)[:8]
+	if res.flags&ntlmNegotiateKeyExch != 0 {
+		sealKey := ntlmKey(res.sessionKey, "session key to "+from+" sealing key magic constant\x00")
+		c, _ := rc4.NewCipher(sealKey)
+		c.XORKeyStream(checksum, checksum)
+	}
+	out := []byte{1, 0, 0, 0}
+	out = append(out, checksum...)
+	return append(out, seq...)
+}
+
+// MechListMIC checks the client's mechListMIC if it sent one and
+// returns the server's mechListMIC to send.
+//
+// This protects the list of mechanisms from being tampered with. The
+// server's MIC is only needed if the client sent one.
+func (a *ntlmAuth) MechListMIC(res *ntlmResult, clientMIC []byte) (serverMIC []byte, err error) {
+	if clientMIC == nil || a.mechTypes == nil || res.flags&ntlmNegotiateSign == 0 || res.flags&ntlmNegotiateExtendedSec == 0 {
+		return nil, nil
+	}
+	if !hmac.Equal(clientMIC, ntlmMAC(res, "client-to-server", a.mechTypes)) {
+		return nil, errors.New("bad SPNEGO mechListMIC")
+	}
+	return ntlmMAC(res, "server-to-client", a.mechTypes), nil
+}
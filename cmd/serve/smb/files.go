@@ -0,0 +1,727 @@
+package smb
+
+// Opening, reading and writing files
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// open is a file or directory opened by the client with CREATE
+type open struct {
+	id            uint64
+	sess          *session
+	tree          *tree
+	vfs           *vfs.VFS
+	access        uint32 // granted access mask
+	isDir         bool
+	mu            sync.Mutex
+	path          string     // path of the file in the VFS
+	fh            vfs.Handle // open handle, nil until needed
+	deleteOnClose bool
+	dir           *dirListing // listing in progress for directories
+}
+
+// errorStatus converts a VFS error into an NTSTATUS
+func errorStatus(err error) uint32 {
+	switch {
+	case err == nil:
+		return statusSuccess
+	case errors.Is(err, vfs.ENOENT), errors.Is(err, fs.ErrorObjectNotFound), errors.Is(err, fs.ErrorDirNotFound):
+		return statusObjectNameNotFound
+	case errors.Is(err, vfs.EEXIST):
+		return statusObjectNameCollision
+	case errors.Is(err, vfs.ENOTEMPTY), errors.Is(err, fs.ErrorDirectoryNotEmpty):
+		return statusDirectoryNotEmpty
+	case errors.Is(err, vfs.EPERM), errors.Is(err, vfs.EROFS):
+		return statusAccessDenied
+	case errors.Is(err, vfs.EINVAL):
+		return statusInvalidParameter
+	case errors.Is(err, vfs.EBADF), errors.Is(err, vfs.ECLOSED):
+		return statusFileClosed
+	case errors.Is(err, vfs.ENOSYS):
+		return statusNotSupported
+	}
+	fs.Errorf(nil, "SMB: unexpected error: %v", err)
+	return statusUnexpectedIOError
+}
+
+// vfsPath converts the SMB path name into a VFS path returning an
+// NTSTATUS if it isn't valid
+func vfsPath(name string) (string, uint32) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.Contains(name, ":") {
+		// Alternate data streams aren't supported
+		return "", statusObjectNameNotFound
+	}
+	if strings.ContainsAny(name, `*?<>"|`) {
+		return "", statusObjectNameInvalid
+	}
+	p := path.Clean("/" + name)
+	if p == "/" {
+		return "", statusSuccess
+	}
+	return p[1:], statusSuccess
+}
+
+// parentPath returns the VFS path of the parent of p
+func parentPath(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// getOpen finds the open file from the FileId in b
+func (c *conn) getOpen(r *request, b []byte) *open {
+	id := le.Uint64(b[8:])
+	if le.Uint64(b) == ^uint64(0) && id == ^uint64(0) && r.state.hasFileID {
+		// related compound request using the previous FileId
+		id = r.state.fileID
+	}
+	c.mu.Lock()
+	o := c.opens[id]
+	c.mu.Unlock()
+	if o == nil || o.sess != r.sess || o.tree != r.tree {
+		return nil
+	}
+	r.state.fileID = id
+	r.state.hasFileID = true
+	return o
+}
+
+// putFileID encodes the id of o as an SMB2 FileId
+func (o *open) putFileID(e *encoder) {
+	e.u64(o.id)
+	e.u64(o.id)
+}
+
+// node returns the VFS node for the open
+func (o *open) node() (vfs.Node, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.vfs.Stat(o.path)
+}
+
+// canWrite returns true if the open was granted write access
+func (o *open) canWrite() bool {
+	return o.access&(accessWriteData|accessAppendData) != 0
+}
+
+// handle returns an open VFS handle for the file, opening it if
+// necessary.
+//
+// Must be called with o.mu held.
+func (o *open) handle(write bool) (vfs.Handle, error) {
+	if o.fh != nil {
+		return o.fh, nil
+	}
+	if o.isDir {
+		return nil, vfs.EINVAL
+	}
+	flags := os.O_RDONLY
+	if write || o.canWrite() {
+		if !o.canWrite() {
+			return nil, vfs.EPERM
+		}
+		// Without the cache files can only be opened for read or
+		// for write
+		flags = os.O_WRONLY
+		if o.vfs.Opt.CacheMode >= vfscommon.CacheModeMinimal {
+			flags = os.O_RDWR
+		}
+	}
+	fh, err := o.vfs.OpenFile(o.path, flags, 0777)
+	if err != nil {
+		return nil, err
+	}
+	o.fh = fh
+	return fh, nil
+}
+
+// close the open releasing any resources
+func (o *open) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var err error
+	if o.fh != nil {
+		err = o.fh.Close()
+		o.fh = nil
+	}
+	if o.deleteOnClose {
+		o.deleteOnClose = false
+		if rmErr := o.vfs.Remove(o.path); rmErr != nil && !errors.Is(rmErr, vfs.ENOENT) {
+			fs.Errorf(o.path, "SMB: delete on close failed: %v", rmErr)
+			if err == nil {
+				err = rmErr
+			}
+		}
+	}
+	o.dir = nil
+	return err
+}
+
+// grantedAccess works out the access to grant for the desired access
+func grantedAccess(desired uint32, readOnly bool) uint32 {
+	access := desired
+	if access&(accessMaximumAllowed|accessGenericAll) != 0 {
+		access |= maximalAccessFullAccess
+	}
+	if access&accessGenericRead != 0 {
+		access |= accessReadData | accessReadEA | accessReadAttributes | accessReadControl
+	}
+	if access&accessGenericWrite != 0 {
+		access |= accessWriteData | accessAppendData | accessWriteEA | accessWriteAttributes
+	}
+	if access&accessGenericExecute != 0 {
+		access |= accessExecute | accessReadAttributes
+	}
+	access &= maximalAccessFullAccess
+	if readOnly {
+		access &= maximalAccessReadOnly
+	}
+	return access
+}
+
+// create handles the CREATE request which opens or creates files
+// and directories
+func (c *conn) create(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 56 {
+		return statusInvalidParameter, nil
+	}
+	if r.tree.pipe {
+		// no named pipes are supported
+		return statusObjectNameNotFound, nil
+	}
+	desiredAccess := le.Uint32(b[24:])
+	disposition := le.Uint32(b[36:])
+	options := le.Uint32(b[40:])
+	name := decodeString(buffer(b, int(le.Uint16(b[44:])), int(le.Uint16(b[46:]))))
+	p, status := vfsPath(name)
+	fs.Debugf(c.what, "CREATE %q disposition %d options 0x%X access 0x%X", name, disposition, options, desiredAccess)
+	if status != statusSuccess {
+		return status, nil
+	}
+	if disposition > fileOverwriteIf || options&(fileDirectoryFile|fileNonDirectoryFile) == fileDirectoryFile|fileNonDirectoryFile {
+		return statusInvalidParameter, nil
+	}
+	VFS := r.sess.vfs
+	readOnly := VFS.Opt.ReadOnly
+	wantDir := options&fileDirectoryFile != 0
+	wantFile := options&fileNonDirectoryFile != 0
+
+	node, err := VFS.Stat(p)
+	exists := err == nil
+	if err != nil && !errors.Is(err, vfs.ENOENT) {
+		return errorStatus(err), nil
+	}
+	if !exists {
+		// Check the parent exists
+		parent, err := VFS.Stat(parentPath(p))
+		if err != nil || parent.IsFile() {
+			return statusObjectPathNotFound, nil
+		}
+	}
+
+	o := &open{
+		sess:   r.sess,
+		tree:   r.tree,
+		vfs:    VFS,
+		access: grantedAccess(desiredAccess, readOnly),
+		path:   p,
+	}
+	var action uint32
+	switch {
+	case exists && disposition == fileCreate:
+		return statusObjectNameCollision, nil
+	case exists:
+		if !node.IsFile() && wantFile {
+			return statusFileIsADirectory, nil
+		}
+		if node.IsFile() && wantDir {
+			return statusNotADirectory, nil
+		}
+		o.isDir = !node.IsFile()
+		action = fileOpened
+		if disposition == fileOverwrite || disposition == fileOverwriteIf || disposition == fileSupersede {
+			if o.isDir {
+				return statusInvalidParameter, nil
+			}
+			if readOnly {
+				return statusAccessDenied, nil
+			}
+			action = fileOverwritten
+			if disposition == fileSupersede {
+				action = fileSuperseded
+			}
+		}
+	case disposition == fileOpen || disposition == fileOverwrite:
+		return statusObjectNameNotFound, nil
+	default:
+		if readOnly {
+			return statusAccessDenied, nil
+		}
+		action = fileCreated
+		o.isDir = wantDir
+	}
+
+	switch {
+	case action == fileCreated && o.isDir:
+		err = VFS.Mkdir(p, 0777)
+	case action == fileCreated || action == fileOverwritten || action == fileSuperseded:
+		// Create or truncate the file now so it exists
+		flags := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+		if VFS.Opt.CacheMode >= vfscommon.CacheModeMinimal {
+			flags = os.O_CREATE | os.O_TRUNC | os.O_RDWR
+		}
+		o.fh, err = VFS.OpenFile(p, flags, 0777)
+		if err == nil && !o.canWrite() {
+			err = o.fh.Close()
+			o.fh = nil
+		}
+	}
+	if err != nil {
+		if o.fh != nil {
+			_ = o.fh.Close()
+		}
+		return errorStatus(err), nil
+	}
+	if options&fileDeleteOnClose != 0 {
+		if o.access&accessDelete == 0 {
+			_ = o.close()
+			return statusAccessDenied, nil
+		}
+		o.deleteOnClose = true
+	}
+
+	node, err = VFS.Stat(p)
+	if err != nil {
+		_ = o.close()
+		return errorStatus(err), nil
+	}
+
+	o.id = c.s.fileID.Add(1)
+	c.mu.Lock()
+	c.opens[o.id] = o
+	c.mu.Unlock()
+	r.state.fileID = o.id
+	r.state.hasFileID = true
+
+	var e encoder
+	e.u16(89)
+	e.u8(0) // no oplock
+	e.u8(0)
+	e.u32(action)
+	putTimes(&e, node)
+	e.u64(allocationSize(node))
+	e.u64(endOfFile(node))
+	e.u32(fileAttributes(node))
+	e.u32(0)
+	o.putFileID(&e)
+	e.u32(0) // no create contexts
+	e.u32(0)
+	e.u8(0)
+	return statusSuccess, e.b
+}
+
+// closeFile handles the CLOSE request
+func (c *conn) closeFile(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	o := c.getOpen(r, b[8:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	c.mu.Lock()
+	delete(c.opens, o.id)
+	c.mu.Unlock()
+	flags := le.Uint16(b[2:])
+	err := o.close()
+
+	var e encoder
+	e.u16(60)
+	if flags&closeFlagPostQueryAttrib != 0 && err == nil {
+		node, statErr := o.vfs.Stat(o.path)
+		if statErr == nil {
+			e.u16(closeFlagPostQueryAttrib)
+			e.u32(0)
+			putTimes(&e, node)
+			e.u64(allocationSize(node))
+			e.u64(endOfFile(node))
+			e.u32(fileAttributes(node))
+			return statusSuccess, e.b
+		}
+	}
+	e.zero(58)
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	return statusSuccess, e.b
+}
+
+// flush handles the FLUSH request
+func (c *conn) flush(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	o := c.getOpen(r, b[8:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	o.mu.Lock()
+	var err error
+	if o.fh != nil {
+		err = o.fh.Flush()
+	}
+	o.mu.Unlock()
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// read handles the READ request
+func (c *conn) read(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 48 {
+		return statusInvalidParameter, nil
+	}
+	length := le.Uint32(b[4:])
+	offset := int64(le.Uint64(b[8:]))
+	o := c.getOpen(r, b[16:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	if o.isDir {
+		return statusInvalidDeviceRequest, nil
+	}
+	if o.access&accessReadData == 0 {
+		return statusAccessDenied, nil
+	}
+	if length > maxReadSize || offset < 0 {
+		return statusInvalidParameter, nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fh, err := o.handle(false)
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	const dataOffset = headerSize + 16
+	var e encoder
+	e.b = make([]byte, 16, 16+length)
+	data := e.b[16 : 16+length]
+	n, err := fh.ReadAt(data, offset)
+	if n == 0 && err == io.EOF {
+		return statusEndOfFile, nil
+	}
+	if err != nil && err != io.EOF {
+		return errorStatus(err), nil
+	}
+	e.b = e.b[:16+n]
+	le.PutUint16(e.b[0:], 17)
+	e.b[2] = dataOffset
+	le.PutUint32(e.b[4:], uint32(n))
+	return statusSuccess, e.b
+}
+
+// write handles the WRITE request
+func (c *conn) write(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 48 {
+		return statusInvalidParameter, nil
+	}
+	length := int(le.Uint32(b[4:]))
+	offset := int64(le.Uint64(b[8:]))
+	data := buffer(b, int(le.Uint16(b[2:])), length)
+	if data == nil && length != 0 {
+		return statusInvalidParameter, nil
+	}
+	o := c.getOpen(r, b[16:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	if o.isDir {
+		return statusInvalidDeviceRequest, nil
+	}
+	if !o.canWrite() {
+		return statusAccessDenied, nil
+	}
+	if offset == -1 {
+		// append to the end of the file - we don't support
+		// this without a cache so just try the end
+		node, err := o.node()
+		if err != nil {
+			return errorStatus(err), nil
+		}
+		offset = node.Size()
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fh, err := o.handle(true)
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	n, err := fh.WriteAt(data, offset)
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	var e encoder
+	e.u16(17)
+	e.u16(0)
+	e.u32(uint32(n))
+	e.zero(8)
+	return statusSuccess, e.b
+}
+
+// lock handles the LOCK request.
+//
+// Byte range locks aren't supported by the VFS so we just say yes.
+func (c *conn) lock(r *request) (status uint32, body []byte) {
+	if len(r.body) < 24 {
+		return statusInvalidParameter, nil
+	}
+	if c.getOpen(r, r.body[8:]) == nil {
+		return statusFileClosed, nil
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// ioctl handles the IOCTL request
+func (c *conn) ioctl(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 56 {
+		return statusInvalidParameter, nil
+	}
+	ctlCode := le.Uint32(b[4:])
+	var out []byte
+	switch ctlCode {
+	case fsctlValidateNegotiate:
+		in := buffer(b, int(le.Uint32(b[24:])), int(le.Uint32(b[28:])))
+		c.mu.Lock()
+		dialect, guid, sec, caps := c.dialect, c.clientGUID, c.clientSec, c.clientCaps
+		c.mu.Unlock()
+		if len(in) < 24 || le.Uint32(in) != caps || string(in[4:20]) != string(guid[:]) || le.Uint16(in[20:]) != sec {
+			// The negotiate was tampered with so drop the connection
+			fs.Errorf(c.what, "SMB: validate negotiate failed")
+			_ = c.nc.Close()
+			return statusAccessDenied, nil
+		}
+		var e encoder
+		var serverCaps uint32
+		if dialect != dialect202 {
+			serverCaps = capLargeMTU
+		}
+		e.u32(serverCaps)
+		e.bytes(c.s.guid[:])
+		e.u16(c.s.securityMode())
+		e.u16(dialect)
+		out = e.b
+	case fsctlDFSGetReferrals, fsctlDFSGetReferralsEx:
+		return statusFSDriverRequired, nil
+	default:
+		return statusNotSupported, nil
+	}
+	var e encoder
+	e.u16(49)
+	e.u16(0)
+	e.u32(ctlCode)
+	e.bytes(b[8:24]) // FileId
+	e.u32(headerSize + 48)
+	e.u32(0)
+	e.u32(headerSize + 48)
+	e.u32(uint32(len(out)))
+	e.u32(0)
+	e.u32(0)
+	e.bytes(out)
+	return statusSuccess, e.b
+}
+
+// setInfo handles the SET_INFO request
+func (c *conn) setInfo(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 32 {
+		return statusInvalidParameter, nil
+	}
+	infoType := b[2]
+	class := b[3]
+	in := buffer(b, int(le.Uint16(b[8:])), int(le.Uint32(b[4:])))
+	o := c.getOpen(r, b[16:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	ok := []byte{2, 0}
+	switch infoType {
+	case infoFile:
+	case infoSecurity:
+		// Security descriptors can't be changed so ignore them
+		return statusSuccess, ok
+	default:
+		return statusNotSupported, nil
+	}
+	if o.vfs.Opt.ReadOnly {
+		return statusAccessDenied, nil
+	}
+	switch class {
+	case fileBasicInformation:
+		if len(in) < 40 {
+			return statusInfoLengthMismatch, nil
+		}
+		// Only the last write time can be set. 0 means don't
+		// change and -1 means don't update it automatically.
+		ft := le.Uint64(in[16:])
+		if ft != 0 && ft != ^uint64(0) {
+			node, err := o.node()
+			if err != nil {
+				return errorStatus(err), nil
+			}
+			if err := node.SetModTime(fromFiletime(ft)); err != nil {
+				return errorStatus(err), nil
+			}
+		}
+	case fileRenameInformation:
+		if len(in) < 20 {
+			return statusInfoLengthMismatch, nil
+		}
+		replace := in[0] != 0
+		newName := decodeString(buffer(in, headerSize+20, int(le.Uint32(in[16:]))))
+		newPath, status := vfsPath(newName)
+		if status != statusSuccess {
+			return status, nil
+		}
+		if newPath == "" {
+			return statusAccessDenied, nil
+		}
+		if status := c.rename(o, newPath, replace); status != statusSuccess {
+			return status, nil
+		}
+	case fileDispositionInformation, fileDispositionInformationEx:
+		if len(in) < 1 {
+			return statusInfoLengthMismatch, nil
+		}
+		deletePending := in[0]&fileDispositionFlagDelete != 0
+		if deletePending {
+			if o.access&accessDelete == 0 {
+				return statusAccessDenied, nil
+			}
+			if o.isDir {
+				node, err := o.node()
+				if err != nil {
+					return errorStatus(err), nil
+				}
+				items, err := node.(*vfs.Dir).ReadDirAll()
+				if err != nil {
+					return errorStatus(err), nil
+				}
+				if len(items) > 0 {
+					return statusDirectoryNotEmpty, nil
+				}
+			}
+		}
+		o.mu.Lock()
+		o.deleteOnClose = deletePending
+		o.mu.Unlock()
+	case fileEndOfFileInformation:
+		if len(in) < 8 {
+			return statusInfoLengthMismatch, nil
+		}
+		if !o.canWrite() {
+			return statusAccessDenied, nil
+		}
+		size := int64(le.Uint64(in))
+		o.mu.Lock()
+		var err error
+		if o.fh != nil {
+			err = o.fh.Truncate(size)
+		} else {
+			var node vfs.Node
+			node, err = o.vfs.Stat(o.path)
+			if err == nil {
+				err = node.Truncate(size)
+			}
+		}
+		o.mu.Unlock()
+		if err != nil {
+			return errorStatus(err), nil
+		}
+	case fileAllocationInformation, filePositionInformation, fileModeInformation:
+		// These don't mean anything for the VFS
+	default:
+		return statusNotSupported, nil
+	}
+	return statusSuccess, ok
+}
+
+// rename o to newPath
+func (c *conn) rename(o *open, newPath string, replace bool) uint32 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if newPath == o.path {
+		return statusSuccess
+	}
+	node, err := o.vfs.Stat(newPath)
+	if err == nil {
+		// Allow renames which only change the case
+		if !strings.EqualFold(newPath, o.path) {
+			if !replace {
+				return statusObjectNameCollision
+			}
+			if !node.IsFile() || o.isDir {
+				return statusAccessDenied
+			}
+		}
+	} else if !errors.Is(err, vfs.ENOENT) {
+		return errorStatus(err)
+	}
+	err = o.vfs.Rename(o.path, newPath)
+	if err != nil {
+		return errorStatus(err)
+	}
+	o.path = newPath
+	o.dir = nil
+	return statusSuccess
+}
+
+// putTimes encodes the creation, access, write and change times for node
+func putTimes(e *encoder, node os.FileInfo) {
+	t := node.ModTime()
+	e.time(t)
+	e.time(t)
+	e.time(t)
+	e.time(t)
+}
+
+// endOfFile returns the size of node
+func endOfFile(node os.FileInfo) uint64 {
+	if node.IsDir() || node.Size() < 0 {
+		return 0
+	}
+	return uint64(node.Size())
+}
+
+// allocationSize returns the space used on disk by node
+func allocationSize(node os.FileInfo) uint64 {
+	const blockSize = 4096
+	return (endOfFile(node) + blockSize - 1) &^ (blockSize - 1)
+}
+
+// fileAttributes returns the attributes for node
+func fileAttributes(node os.FileInfo) uint32 {
+	if node.IsDir() {
+		return fileAttributeDirectory
+	}
+	return fileAttributeArchive
+}
@@ -0,0 +1,470 @@
+package smb
+
+// Directory listings and file and filesystem information
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rclone/rclone/vfs"
+)
+
+// dirListing is a directory listing in progress
+type dirListing struct {
+	pattern string
+	entries []dirEntry
+	pos     int
+}
+
+// dirEntry is an entry in a directory listing
+type dirEntry struct {
+	name string
+	node vfs.Node
+}
+
+// matchPattern returns true if name matches the SMB wildcard pattern
+// case insensitively.
+//
+// As well as * and ? this supports the DOS wildcards <, > and ".
+func matchPattern(pattern, name string) bool {
+	if pattern == "*" || pattern == "" {
+		return true
+	}
+	return matchRunes([]rune(strings.ToLower(pattern)), []rune(strings.ToLower(name)))
+}
+
+// matchRunes does the work for matchPattern
+func matchRunes(pattern, name []rune) bool {
+	for len(pattern) > 0 {
+		switch p := pattern[0]; p {
+		case '*', '<':
+			// Try to match the rest of the pattern at every position
+			for i := 0; i <= len(name); i++ {
+				if matchRunes(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?', '>':
+			if len(name) == 0 {
+				// > matches nothing at the end of the name
+				return p == '>' && matchRunes(pattern[1:], name)
+			}
+		case '"':
+			if len(name) == 0 {
+				return matchRunes(pattern[1:], name)
+			}
+			if name[0] != '.' {
+				return false
+			}
+		default:
+			if len(name) == 0 || unicode.ToLower(name[0]) != p {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// list makes the directory listing for o matching pattern
+func (o *open) list(pattern string) (*dirListing, error) {
+	node, err := o.vfs.Stat(o.path)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return nil, vfs.EINVAL
+	}
+	items, err := dir.ReadDirAll()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := o.vfs.Stat(parentPath(o.path))
+	if err != nil {
+		parent = node
+	}
+	l := &dirListing{pattern: pattern}
+	add := func(name string, node vfs.Node) {
+		if matchPattern(pattern, name) {
+			l.entries = append(l.entries, dirEntry{name: name, node: node})
+		}
+	}
+	add(".", node)
+	add("..", parent)
+	for _, item := range items {
+		add(item.Name(), item)
+	}
+	return l, nil
+}
+
+// queryDirectory handles the QUERY_DIRECTORY request
+func (c *conn) queryDirectory(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 32 {
+		return statusInvalidParameter, nil
+	}
+	class := b[2]
+	flags := b[3]
+	o := c.getOpen(r, b[8:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	if !o.isDir {
+		return statusInvalidParameter, nil
+	}
+	pattern := decodeString(buffer(b, int(le.Uint16(b[24:])), int(le.Uint16(b[26:]))))
+	outLen := int(le.Uint32(b[28:]))
+	switch class {
+	case fileDirectoryInformation, fileFullDirectoryInformation, fileBothDirectoryInformation,
+		fileNamesInformation, fileIDBothDirectoryInformation, fileIDFullDirectoryInformation:
+	default:
+		return statusInvalidInfoClass, nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	first := false
+	if o.dir == nil || flags&(queryRestartScans|queryReopen) != 0 || (pattern != "" && pattern != o.dir.pattern) {
+		if pattern == "" {
+			pattern = "*"
+		}
+		l, err := o.list(pattern)
+		if err != nil {
+			return errorStatus(err), nil
+		}
+		o.dir = l
+		first = true
+	}
+	l := o.dir
+
+	var out encoder
+	lastEntry := -1
+	for l.pos < len(l.entries) {
+		entry := encodeDirEntry(class, l.entries[l.pos])
+		start := len(out.b)
+		if lastEntry >= 0 {
+			start = (start + 7) &^ 7
+		}
+		if start+len(entry) > outLen {
+			if lastEntry < 0 {
+				return statusInfoLengthMismatch, nil
+			}
+			break
+		}
+		out.align(8)
+		if lastEntry >= 0 {
+			le.PutUint32(out.b[lastEntry:], uint32(start-lastEntry))
+		}
+		lastEntry = start
+		out.bytes(entry)
+		l.pos++
+		if flags&queryReturnSingleEntry != 0 {
+			break
+		}
+	}
+	if lastEntry < 0 {
+		if first {
+			return statusNoSuchFile, nil
+		}
+		return statusNoMoreFiles, nil
+	}
+	return statusSuccess, infoResponse(out.b)
+}
+
+// infoResponse makes a QUERY_DIRECTORY or QUERY_INFO response
+// containing out
+func infoResponse(out []byte) []byte {
+	var e encoder
+	e.u16(9)
+	e.u16(headerSize + 8)
+	e.u32(uint32(len(out)))
+	e.bytes(out)
+	return e.b
+}
+
+// encodeDirEntry encodes entry for a directory listing of class.
+//
+// NextEntryOffset is left as 0.
+func encodeDirEntry(class byte, entry dirEntry) []byte {
+	name := encodeString(entry.name)
+	var e encoder
+	e.u32(0) // NextEntryOffset
+	e.u32(0) // FileIndex
+	if class == fileNamesInformation {
+		e.u32(uint32(len(name)))
+		e.bytes(name)
+		return e.b
+	}
+	putTimes(&e, entry.node)
+	e.u64(endOfFile(entry.node))
+	e.u64(allocationSize(entry.node))
+	e.u32(fileAttributes(entry.node))
+	e.u32(uint32(len(name)))
+	if class != fileDirectoryInformation {
+		e.u32(0) // EaSize
+	}
+	switch class {
+	case fileBothDirectoryInformation, fileIDBothDirectoryInformation:
+		e.u8(0)    // ShortNameLength
+		e.u8(0)    // Reserved1
+		e.zero(24) // ShortName
+		if class == fileIDBothDirectoryInformation {
+			e.u16(0) // Reserved2
+			e.u64(entry.node.Inode())
+		}
+	case fileIDFullDirectoryInformation:
+		e.u32(0) // Reserved
+		e.u64(entry.node.Inode())
+	}
+	e.bytes(name)
+	return e.b
+}
+
+// isVariableInfo returns true if the info class of infoType has a
+// variable length so may be returned truncated
+func isVariableInfo(infoType, class byte) bool {
+	switch infoType {
+	case infoFile:
+		return class == fileAllInformation || class == fileNameInformation || class == fileStreamInformation
+	case infoFilesystem:
+		return class == fileFsVolumeInformation || class == fileFsAttributeInformation
+	}
+	return false
+}
+
+// queryInfo handles the QUERY_INFO request
+func (c *conn) queryInfo(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 40 {
+		return statusInvalidParameter, nil
+	}
+	infoType := b[2]
+	class := b[3]
+	outLen := int(le.Uint32(b[4:]))
+	o := c.getOpen(r, b[24:])
+	if o == nil {
+		return statusFileClosed, nil
+	}
+	var out []byte
+	switch infoType {
+	case infoFile:
+		node, err := o.node()
+		if err != nil {
+			return errorStatus(err), nil
+		}
+		out, status = o.fileInfo(class, node)
+	case infoFilesystem:
+		out, status = fsInfo(class, o.vfs)
+	case infoSecurity:
+		out = securityDescriptor()
+	default:
+		status = statusNotSupported
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	if len(out) > outLen {
+		if infoType == infoSecurity {
+			// Tell the client how big a buffer is needed
+			return statusBufferTooSmall, []byte{9, 0, 0, 0, 4, 0, 0, 0, byte(len(out)), byte(len(out) >> 8), 0, 0}
+		}
+		if !isVariableInfo(infoType, class) {
+			return statusInfoLengthMismatch, nil
+		}
+		return statusBufferOverflow, infoResponse(out[:outLen])
+	}
+	return statusSuccess, infoResponse(out)
+}
+
+// fileInfo returns the file information of class for node
+func (o *open) fileInfo(class byte, node vfs.Node) ([]byte, uint32) {
+	var e encoder
+	basic := func() {
+		putTimes(&e, node)
+		e.u32(fileAttributes(node))
+		e.u32(0)
+	}
+	standard := func() {
+		e.u64(allocationSize(node))
+		e.u64(endOfFile(node))
+		e.u32(1) // NumberOfLinks
+		o.mu.Lock()
+		deletePending := o.deleteOnClose
+		o.mu.Unlock()
+		if deletePending {
+			e.u8(1)
+		} else {
+			e.u8(0)
+		}
+		if node.IsDir() {
+			e.u8(1)
+		} else {
+			e.u8(0)
+		}
+		e.u16(0)
+	}
+	name := func() {
+		n := encodeString(`\` + strings.ReplaceAll(node.Path(), "/", `\`))
+		e.u32(uint32(len(n)))
+		e.bytes(n)
+	}
+	switch class {
+	case fileBasicInformation:
+		basic()
+	case fileStandardInformation:
+		standard()
+	case fileInternalInformation:
+		e.u64(node.Inode())
+	case fileEaInformation:
+		e.u32(0)
+	case fileAccessInformation:
+		e.u32(o.access)
+	case fileNameInformation:
+		name()
+	case filePositionInformation:
+		e.u64(0)
+	case fileModeInformation:
+		e.u32(0)
+	case fileAlignmentInformation:
+		e.u32(0)
+	case fileAllInformation:
+		basic()
+		standard()
+		e.u64(node.Inode())
+		e.u32(0) // EaSize
+		e.u32(o.access)
+		e.u64(0) // CurrentByteOffset
+		e.u32(0) // Mode
+		e.u32(0) // AlignmentRequirement
+		name()
+	case fileNetworkOpenInformation:
+		putTimes(&e, node)
+		e.u64(allocationSize(node))
+		e.u64(endOfFile(node))
+		e.u32(fileAttributes(node))
+		e.u32(0)
+	case fileAttributeTagInformation:
+		e.u32(fileAttributes(node))
+		e.u32(0)
+	case fileStreamInformation:
+		if node.IsFile() {
+			n := encodeString("::$DATA")
+			e.u32(0)
+			e.u32(uint32(len(n)))
+			e.u64(endOfFile(node))
+			e.u64(allocationSize(node))
+			e.bytes(n)
+		}
+	default:
+		return nil, statusInvalidInfoClass
+	}
+	return e.b, statusSuccess
+}
+
+// Values used for the filesystem info
+const (
+	bytesPerSector     = 512
+	sectorsPerUnit     = 8
+	bytesPerUnit       = bytesPerSector * sectorsPerUnit
+	defaultTotalSpace  = 1 << 50 // used if the size of the remote is unknown
+	maxComponentLength = 255
+	fileDeviceDisk     = 0x00000007
+)
+
+// fsInfo returns the filesystem information of class for VFS
+func fsInfo(class byte, VFS *vfs.VFS) ([]byte, uint32) {
+	var e encoder
+	sizes := func(full bool) {
+		total, _, free := VFS.Statfs()
+		if total < 0 {
+			total = defaultTotalSpace
+		}
+		if free < 0 || free > total {
+			free = total
+		}
+		e.u64(uint64(total / bytesPerUnit))
+		e.u64(uint64(free / bytesPerUnit))
+		if full {
+			e.u64(uint64(free / bytesPerUnit))
+		}
+		e.u32(sectorsPerUnit)
+		e.u32(bytesPerSector)
+	}
+	switch class {
+	case fileFsVolumeInformation:
+		label := encodeString(VFS.Fs().Name())
+		e.time(time.Time{})
+		e.u32(0) // VolumeSerialNumber
+		e.u32(uint32(len(label)))
+		e.u8(0) // SupportsObjects
+		e.u8(0)
+		e.bytes(label)
+	case fileFsSizeInformation:
+		sizes(false)
+	case fileFsFullSizeInformation:
+		sizes(true)
+	case fileFsDeviceInformation:
+		e.u32(fileDeviceDisk)
+		e.u32(0)
+	case fileFsAttributeInformation:
+		name := encodeString("NTFS")
+		attr := uint32(fsCasePreservedNames | fsUnicodeOnDisk)
+		if !VFS.Opt.CaseInsensitive {
+			attr |= fsCaseSensitiveSearch
+		}
+		e.u32(attr)
+		e.u32(maxComponentLength)
+		e.u32(uint32(len(name)))
+		e.bytes(name)
+	case fileFsSectorSizeInformation:
+		for range 4 {
+			e.u32(bytesPerSector)
+		}
+		e.u32(0) // Flags
+		e.u32(0) // ByteOffsetForSectorAlignment
+		e.u32(0) // ByteOffsetForPartitionAlignment
+	default:
+		return nil, statusInvalidInfoClass
+	}
+	return e.b, statusSuccess
+}
+
+// securityDescriptor returns a self relative security descriptor
+// giving Everyone full access
+func securityDescriptor() []byte {
+	// S-1-1-0 - Everyone
+	everyone := []byte{1, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+	const (
+		seDACLPresent  = 0x0004
+		seSelfRelative = 0x8000
+		aceSize        = 8 + 12
+		aclSize        = 8 + aceSize
+		sdSize         = 20
+	)
+	var e encoder
+	e.u8(1) // Revision
+	e.u8(0)
+	e.u16(seDACLPresent | seSelfRelative)
+	e.u32(sdSize)                         // Owner
+	e.u32(sdSize + uint32(len(everyone))) // Group
+	e.u32(0)                              // SACL
+	e.u32(sdSize + 2*uint32(len(everyone)))
+	e.bytes(everyone)
+	e.bytes(everyone)
+	// DACL
+	e.u8(2) // AclRevision
+	e.u8(0)
+	e.u16(aclSize)
+	e.u16(1) // AceCount
+	e.u16(0)
+	// ACCESS_ALLOWED_ACE
+	e.u8(0)                        // AceType
+	e.u8(0x03)                     // AceFlags: OBJECT_INHERIT | CONTAINER_INHERIT
+	e.u16(aceSize)                 // AceSize
+	e.u32(maximalAccessFullAccess) // Mask
+	e.bytes(everyone)
+	return e.b
+}
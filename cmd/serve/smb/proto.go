@@ -0,0 +1,385 @@
+package smb
+
+// Constants and packet layouts from MS-SMB2 and MS-FSCC
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+)
+
+var le = binary.LittleEndian
+
+// protocol IDs at the start of each message
+var (
+	smb1ProtocolID = []byte{0xFF, 'S', 'M', 'B'}
+	smb2ProtocolID = []byte{0xFE, 'S', 'M', 'B'}
+)
+
+// Size of the SMB2 header
+const headerSize = 64
+
+// Commands
+const (
+	cmdNegotiate      = 0x0000
+	cmdSessionSetup   = 0x0001
+	cmdLogoff         = 0x0002
+	cmdTreeConnect    = 0x0003
+	cmdTreeDisconnect = 0x0004
+	cmdCreate         = 0x0005
+	cmdClose          = 0x0006
+	cmdFlush          = 0x0007
+	cmdRead           = 0x0008
+	cmdWrite          = 0x0009
+	cmdLock           = 0x000A
+	cmdIoctl          = 0x000B
+	cmdCancel         = 0x000C
+	cmdEcho           = 0x000D
+	cmdQueryDirectory = 0x000E
+	cmdChangeNotify   = 0x000F
+	cmdQueryInfo      = 0x0010
+	cmdSetInfo        = 0x0011
+	cmdOplockBreak    = 0x0012
+)
+
+// Header flags
+const (
+	flagServerToRedir = 0x00000001
+	flagAsyncCommand  = 0x00000002
+	flagRelatedOps    = 0x00000004
+	flagSigned        = 0x00000008
+)
+
+// Dialects
+const (
+	dialect202      = 0x0202
+	dialect210      = 0x0210
+	dialect300      = 0x0300
+	dialect302      = 0x0302
+	dialect311      = 0x0311
+	dialectWildcard = 0x02FF
+)
+
+// Security mode
+const (
+	securitySigningEnabled  = 0x0001
+	securitySigningRequired = 0x0002
+)
+
+// Global capabilities
+const capLargeMTU = 0x00000004
+
+// Negotiate contexts for SMB 3.1.1
+const (
+	contextPreauthIntegrity = 0x0001
+	hashSHA512              = 0x0001
+)
+
+// Session flags
+const (
+	sessionFlagIsGuest = 0x0001
+	sessionFlagIsNull  = 0x0002
+)
+
+// Share types and flags
+const (
+	shareTypeDisk           = 0x01
+	shareTypePipe           = 0x02
+	shareFlagNoCaching      = 0x00000030
+	maximalAccessFullAccess = 0x001F01FF
+	maximalAccessPipe       = 0x0012019F
+	maximalAccessReadOnly   = 0x001200A9
+)
+
+// NTSTATUS codes
+const (
+	statusSuccess                = 0x00000000
+	statusBufferOverflow         = 0x80000005
+	statusNoMoreFiles            = 0x80000006
+	statusInvalidInfoClass       = 0xC0000003
+	statusInfoLengthMismatch     = 0xC0000004
+	statusInvalidParameter       = 0xC000000D
+	statusNoSuchFile             = 0xC000000F
+	statusInvalidDeviceRequest   = 0xC0000010
+	statusEndOfFile              = 0xC0000011
+	statusMoreProcessingRequired = 0xC0000016
+	statusAccessDenied           = 0xC0000022
+	statusBufferTooSmall         = 0xC0000023
+	statusObjectNameInvalid      = 0xC0000033
+	statusObjectNameNotFound     = 0xC0000034
+	statusObjectNameCollision    = 0xC0000035
+	statusObjectPathNotFound     = 0xC000003A
+	statusLogonFailure           = 0xC000006D
+	statusFileIsADirectory       = 0xC00000BA
+	statusNotSupported           = 0xC00000BB
+	statusNetworkNameDeleted     = 0xC00000C9
+	statusBadNetworkName         = 0xC00000CC
+	statusUnexpectedIOError      = 0xC00000E9
+	statusDirectoryNotEmpty      = 0xC0000101
+	statusNotADirectory          = 0xC0000103
+	statusFileClosed             = 0xC0000128
+	statusUserSessionDeleted     = 0xC0000203
+	statusFSDriverRequired       = 0xC000019C
+)
+
+// Access mask bits
+const (
+	accessReadData        = 0x00000001
+	accessWriteData       = 0x00000002
+	accessAppendData      = 0x00000004
+	accessReadEA          = 0x00000008
+	accessWriteEA         = 0x00000010
+	accessExecute         = 0x00000020
+	accessReadAttributes  = 0x00000080
+	accessWriteAttributes = 0x00000100
+	accessDelete          = 0x00010000
+	accessReadControl     = 0x00020000
+	accessMaximumAllowed  = 0x02000000
+	accessGenericAll      = 0x10000000
+	accessGenericExecute  = 0x20000000
+	accessGenericWrite    = 0x40000000
+	accessGenericRead     = 0x80000000
+)
+
+// Create dispositions
+const (
+	fileSupersede   = 0x00000000
+	fileOpen        = 0x00000001
+	fileCreate      = 0x00000002
+	fileOverwrite   = 0x00000004
+	fileOverwriteIf = 0x00000005
+)
+
+// Create options
+const (
+	fileDirectoryFile    = 0x00000001
+	fileNonDirectoryFile = 0x00000040
+	fileDeleteOnClose    = 0x00001000
+)
+
+// Create actions
+const (
+	fileSuperseded  = 0x00000000
+	fileOpened      = 0x00000001
+	fileCreated     = 0x00000002
+	fileOverwritten = 0x00000003
+)
+
+// File attributes
+const (
+	fileAttributeDirectory = 0x00000010
+	fileAttributeArchive   = 0x00000020
+)
+
+// Info types for QUERY_INFO and SET_INFO
+const (
+	infoFile       = 0x01
+	infoFilesystem = 0x02
+	infoSecurity   = 0x03
+)
+
+// File information classes
+const (
+	fileDirectoryInformation       = 1
+	fileFullDirectoryInformation   = 2
+	fileBothDirectoryInformation   = 3
+	fileBasicInformation           = 4
+	fileStandardInformation        = 5
+	fileInternalInformation        = 6
+	fileEaInformation              = 7
+	fileAccessInformation          = 8
+	fileNameInformation            = 9
+	fileRenameInformation          = 10
+	fileNamesInformation           = 12
+	fileDispositionInformation     = 13
+	filePositionInformation        = 14
+	fileModeInformation            = 16
+	fileAlignmentInformation       = 17
+	fileAllInformation             = 18
+	fileAllocationInformation      = 19
+	fileEndOfFileInformation       = 20
+	fileStreamInformation          = 22
+	fileNetworkOpenInformation     = 34
+	fileAttributeTagInformation    = 35
+	fileIDBothDirectoryInformation = 37
+	fileIDFullDirectoryInformation = 38
+	fileDispositionInformationEx   = 64
+	fileDispositionFlagDelete      = 0x00000001
+)
+
+// Filesystem information classes
+const (
+	fileFsVolumeInformation     = 1
+	fileFsSizeInformation       = 3
+	fileFsDeviceInformation     = 4
+	fileFsAttributeInformation  = 5
+	fileFsFullSizeInformation   = 7
+	fileFsSectorSizeInformation = 11
+)
+
+// QUERY_DIRECTORY flags
+const (
+	queryRestartScans      = 0x01
+	queryReturnSingleEntry = 0x02
+	queryReopen            = 0x10
+)
+
+// CLOSE flags
+const closeFlagPostQueryAttrib = 0x0001
+
+// IOCTL codes
+const (
+	fsctlDFSGetReferrals   = 0x00060194
+	fsctlValidateNegotiate = 0x00140204
+	fsctlDFSGetReferralsEx = 0x000601B0
+)
+
+// Filesystem attributes
+const (
+	fsCaseSensitiveSearch = 0x00000001
+	fsCasePreservedNames  = 0x00000002
+	fsUnicodeOnDisk       = 0x00000004
+)
+
+// Limits advertised to clients
+const (
+	maxTransactSize = 1 << 20
+	maxReadSize     = 1 << 20
+	maxWriteSize    = 1 << 20
+	maxCredits      = 512
+)
+
+// header is an SMB2 packet header
+type header struct {
+	CreditCharge uint16
+	Status       uint32
+	Command      uint16
+	Credits      uint16
+	Flags        uint32
+	NextCommand  uint32
+	MessageID    uint64
+	AsyncID      uint64
+	TreeID       uint32
+	SessionID    uint64
+}
+
+// decodeHeader decodes the header from the start of b which must be
+// at least headerSize long
+func decodeHeader(b []byte) (h header) {
+	h.CreditCharge = le.Uint16(b[6:])
+	h.Status = le.Uint32(b[8:])
+	h.Command = le.Uint16(b[12:])
+	h.Credits = le.Uint16(b[14:])
+	h.Flags = le.Uint32(b[16:])
+	h.NextCommand = le.Uint32(b[20:])
+	h.MessageID = le.Uint64(b[24:])
+	if h.Flags&flagAsyncCommand != 0 {
+		h.AsyncID = le.Uint64(b[32:])
+	} else {
+		h.TreeID = le.Uint32(b[36:])
+	}
+	h.SessionID = le.Uint64(b[40:])
+	return h
+}
+
+// encode the header into b which must be at least headerSize long
+func (h *header) encode(b []byte) {
+	copy(b[0:4], smb2ProtocolID)
+	le.PutUint16(b[4:], headerSize)
+	le.PutUint16(b[6:], h.CreditCharge)
+	le.PutUint32(b[8:], h.Status)
+	le.PutUint16(b[12:], h.Command)
+	le.PutUint16(b[14:], h.Credits)
+	le.PutUint32(b[16:], h.Flags)
+	le.PutUint32(b[20:], h.NextCommand)
+	le.PutUint64(b[24:], h.MessageID)
+	if h.Flags&flagAsyncCommand != 0 {
+		le.PutUint64(b[32:], h.AsyncID)
+	} else {
+		le.PutUint32(b[32:], 0)
+		le.PutUint32(b[36:], h.TreeID)
+	}
+	le.PutUint64(b[40:], h.SessionID)
+}
+
+// encoder builds little endian structures
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) u8(v uint8) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) u16(v uint16) {
+	e.b = le.AppendUint16(e.b, v)
+}
+
+func (e *encoder) u32(v uint32) {
+	e.b = le.AppendUint32(e.b, v)
+}
+
+func (e *encoder) u64(v uint64) {
+	e.b = le.AppendUint64(e.b, v)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) zero(n int) {
+	e.b = append(e.b, make([]byte, n)...)
+}
+
+func (e *encoder) time(t time.Time) {
+	e.u64(filetime(t))
+}
+
+// align pads the buffer to a multiple of n bytes
+func (e *encoder) align(n int) {
+	if r := len(e.b) % n; r != 0 {
+		e.zero(n - r)
+	}
+}
+
+// buffer returns a slice of the request body b at offset (from the
+// start of the header) and length or nil if it is out of range
+func buffer(b []byte, offset, length int) []byte {
+	offset -= headerSize
+	if length == 0 || offset < 0 || offset+length > len(b) {
+		return nil
+	}
+	return b[offset : offset+length]
+}
+
+// filetime converts t into the number of 100ns intervals since 1601
+func filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+// fromFiletime converts the number of 100ns intervals since 1601 into a time
+func fromFiletime(ft uint64) time.Time {
+	return time.Unix(0, (int64(ft)-116444736000000000)*100)
+}
+
+// encodeString encodes s as UTF-16LE
+func encodeString(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		le.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// decodeString decodes UTF-16LE b into a string
+func decodeString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = le.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
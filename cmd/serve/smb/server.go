@@ -0,0 +1,1029 @@
+package smb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// maximum size of a message we accept - enough for a write of
+// maxWriteSize plus headers
+const maxMessageSize = maxWriteSize + 64*1024
+
+// number of requests processed at once on each connection
+const maxConcurrentRequests = 16
+
+// Server contains everything to run the SMB server
+type Server struct {
+	f         fs.Fs
+	ctx       context.Context // for global config
+	opt       Options
+	globalVFS *vfs.VFS     // the VFS if not using auth proxy
+	proxy     *proxy.Proxy // may be nil if not in use
+	listener  net.Listener
+	guid      [16]byte  // server GUID
+	startTime time.Time // when the server started
+	sessionID atomic.Uint64
+	fileID    atomic.Uint64
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+	wg     sync.WaitGroup // for the connections
+}
+
+// newServer makes a new SMB server serving f
+func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (s *Server, err error) {
+	s = &Server{
+		f:         f,
+		ctx:       ctx,
+		opt:       *opt,
+		startTime: time.Now(),
+		conns:     make(map[*conn]struct{}),
+	}
+	if s.opt.ShareName == "" || strings.ContainsAny(s.opt.ShareName, `\/`) || strings.EqualFold(s.opt.ShareName, "IPC$") {
+		return nil, fmt.Errorf("invalid share name %q", s.opt.ShareName)
+	}
+	if proxyOpt.AuthProxy != "" {
+		if s.opt.User != "" || s.opt.Pass != "" {
+			return nil, errors.New("--auth-proxy and --user/--pass cannot be used at the same time")
+		}
+		if s.opt.AllowGuest {
+			return nil, errors.New("--auth-proxy and --allow-guest cannot be used at the same time")
+		}
+		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	} else {
+		if (s.opt.User == "") != (s.opt.Pass == "") {
+			return nil, errors.New("--user and --pass must be used together")
+		}
+		if s.opt.User != "" && s.opt.AllowGuest {
+			return nil, errors.New("--user and --allow-guest cannot be used at the same time")
+		}
+		if s.opt.User == "" && !s.opt.AllowGuest {
+			return nil, errors.New("set --user and --pass, --auth-proxy, or --allow-guest to allow guest logins")
+		}
+		s.globalVFS = vfs.New(f, vfsOpt)
+	}
+	_, err = rand.Read(s.guid[:])
+	if err != nil {
+		return nil, err
+	}
+	s.listener, err = net.Listen("tcp", s.opt.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open listening socket: %w", err)
+	}
+	return s, nil
+}
+
+// Addr returns the listening address of the server
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve runs the SMB server until it is shutdown
+func (s *Server) Serve() error {
+	fs.Logf(s.f, "SMB server serving share %q on %s", s.opt.ShareName, s.listener.Addr())
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			fs.Errorf(nil, "SMB: failed to accept incoming connection: %v", err)
+			continue
+		}
+		c := s.newConn(nc)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = nc.Close()
+			continue
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops the server and closes all the connections
+func (s *Server) Shutdown() error {
+	s.mu.Lock()
+	s.closed = true
+	err := s.listener.Close()
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// getVFS returns the VFS for user authenticated with check
+//
+// check should return an error if the client didn't prove it knows
+// the password with the NT hash passed in.
+func (s *Server) getVFS(user string, check func(passHash []byte) error) (VFS *vfs.VFS, err error) {
+	if s.proxy != nil {
+		VFS, _, err = s.proxy.CallWithPassword(user, ntHash, check)
+		return VFS, err
+	}
+	if !strings.EqualFold(user, s.opt.User) {
+		return nil, fmt.Errorf("unknown user %q", user)
+	}
+	err = check(ntHash(s.opt.Pass))
+	if err != nil {
+		return nil, err
+	}
+	return s.globalVFS, nil
+}
+
+// guestAllowed returns true if logins don't need a password
+func (s *Server) guestAllowed() bool {
+	return s.opt.AllowGuest && s.proxy == nil && s.opt.User == ""
+}
+
+// securityMode returns the security mode to send to clients.
+//
+// Signing is required unless guests are allowed as all
+// authenticated sessions are signed.
+func (s *Server) securityMode() uint16 {
+	if s.guestAllowed() {
+		return securitySigningEnabled
+	}
+	return securitySigningEnabled | securitySigningRequired
+}
+
+// conn is a connection from a client
+type conn struct {
+	s       *Server
+	nc      net.Conn
+	what    string // for logging
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	negotiated  bool
+	dialect     uint16
+	clientGUID  [16]byte
+	clientCaps  uint32
+	clientSec   uint16
+	dialects    []uint16
+	preauthHash [64]byte // for SMB 3.1.1
+	sessions    map[uint64]*session
+	opens       map[uint64]*open
+}
+
+// newConn makes a conn for nc
+func (s *Server) newConn(nc net.Conn) *conn {
+	return &conn{
+		s:        s,
+		nc:       nc,
+		what:     "SMB client " + nc.RemoteAddr().String(),
+		sessions: make(map[uint64]*session),
+		opens:    make(map[uint64]*open),
+	}
+}
+
+// serve reads requests from the connection until it is closed
+func (c *conn) serve() {
+	fs.Debugf(c.what, "connected")
+	var wg sync.WaitGroup
+	tokens := make(chan struct{}, maxConcurrentRequests)
+	defer func() {
+		_ = c.nc.Close()
+		wg.Wait()
+		c.closeAll()
+		fs.Debugf(c.what, "disconnected")
+	}()
+	var lenBuf [4]byte
+	for {
+		_, err := io.ReadFull(c.nc, lenBuf[:])
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fs.Debugf(c.what, "read failed: %v", err)
+			}
+			return
+		}
+		n := int(lenBuf[1])<<16 | int(lenBuf[2])<<8 | int(lenBuf[3])
+		if lenBuf[0] != 0 || n > maxMessageSize {
+			fs.Debugf(c.what, "bad message length %d", n)
+			return
+		}
+		msg := make([]byte, n)
+		_, err = io.ReadFull(c.nc, msg)
+		if err != nil {
+			fs.Debugf(c.what, "read failed: %v", err)
+			return
+		}
+		switch {
+		case bytes.HasPrefix(msg, smb1ProtocolID):
+			err = c.negotiateSMB1(msg)
+		case bytes.HasPrefix(msg, smb2ProtocolID) && len(msg) >= headerSize:
+			// Negotiation and authentication are done in order,
+			// everything else can be done concurrently
+			cmd := le.Uint16(msg[12:])
+			if cmd == cmdNegotiate || cmd == cmdSessionSetup {
+				err = c.handleMessage(msg)
+				break
+			}
+			tokens <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := c.handleMessage(msg); err != nil {
+					fs.Debugf(c.what, "closing connection: %v", err)
+					_ = c.nc.Close()
+				}
+				<-tokens
+			}()
+		default:
+			err = errors.New("unknown protocol")
+		}
+		if err != nil {
+			fs.Debugf(c.what, "closing connection: %v", err)
+			return
+		}
+	}
+}
+
+// closeAll closes all the open files on the connection
+func (c *conn) closeAll() {
+	c.mu.Lock()
+	opens := c.opens
+	c.opens = make(map[uint64]*open)
+	c.sessions = make(map[uint64]*session)
+	c.mu.Unlock()
+	for _, o := range opens {
+		_ = o.close()
+	}
+}
+
+// writeMessage sends msg to the client
+func (c *conn) writeMessage(msg []byte) error {
+	buf := make([]byte, 4, 4+len(msg))
+	buf[1] = byte(len(msg) >> 16)
+	buf[2] = byte(len(msg) >> 8)
+	buf[3] = byte(len(msg))
+	buf = append(buf, msg...)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.nc.Write(buf)
+	return err
+}
+
+// response is the response to a single request
+type response struct {
+	hdr    header
+	body   []byte
+	signer *session         // session to sign the response with if set
+	onSend func(pkt []byte) // called with the finished packet if set
+}
+
+// compoundState is carried between the requests in a compound
+// message
+type compoundState struct {
+	sessionID uint64
+	treeID    uint32
+	fileID    uint64
+	hasFileID bool
+	status    uint32 // status of the last request
+}
+
+// request is a single request being processed
+type request struct {
+	c     *conn
+	hdr   header
+	msg   []byte // the whole request including the header
+	body  []byte // the request without the header
+	sess  *session
+	tree  *tree
+	state *compoundState
+	resp  *response
+}
+
+// handleMessage handles a possibly compound message and sends the
+// responses
+func (c *conn) handleMessage(msg []byte) error {
+	var (
+		responses []*response
+		state     compoundState
+		first     = true
+	)
+	for len(msg) > 0 {
+		if len(msg) < headerSize || !bytes.HasPrefix(msg, smb2ProtocolID) {
+			return errors.New("bad SMB2 header")
+		}
+		hdr := decodeHeader(msg)
+		this := msg
+		msg = nil
+		if next := int(hdr.NextCommand); next != 0 {
+			if next < headerSize || next > len(this) || next%8 != 0 {
+				return errors.New("bad SMB2 next command")
+			}
+			this, msg = this[:next], this[next:]
+		}
+		if !first && hdr.Flags&flagRelatedOps == 0 {
+			// unrelated requests in a compound start afresh
+			state = compoundState{}
+		}
+		resp, err := c.handleRequest(&state, hdr, this, first)
+		if err != nil {
+			return err
+		}
+		first = false
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return c.sendResponses(responses)
+}
+
+// sendResponses assembles the responses into a single message, signs
+// them and sends them
+func (c *conn) sendResponses(responses []*response) error {
+	var out []byte
+	for i, resp := range responses {
+		pkt := make([]byte, headerSize, headerSize+len(resp.body)+8)
+		pkt = append(pkt, resp.body...)
+		if i < len(responses)-1 {
+			// pad all but the last to 8 bytes
+			for len(pkt)%8 != 0 {
+				pkt = append(pkt, 0)
+			}
+			resp.hdr.NextCommand = uint32(len(pkt))
+		}
+		resp.hdr.encode(pkt)
+		if resp.signer != nil {
+			resp.signer.sign(pkt)
+		}
+		if resp.onSend != nil {
+			resp.onSend(pkt)
+		}
+		out = append(out, pkt...)
+	}
+	return c.writeMessage(out)
+}
+
+// commands which need a session
+var needsSession = map[uint16]bool{
+	cmdLogoff:         true,
+	cmdTreeConnect:    true,
+	cmdTreeDisconnect: true,
+	cmdCreate:         true,
+	cmdClose:          true,
+	cmdFlush:          true,
+	cmdRead:           true,
+	cmdWrite:          true,
+	cmdLock:           true,
+	cmdIoctl:          true,
+	cmdQueryDirectory: true,
+	cmdChangeNotify:   true,
+	cmdQueryInfo:      true,
+	cmdSetInfo:        true,
+	cmdOplockBreak:    true,
+}
+
+// commands which need a tree connect
+var needsTree = map[uint16]bool{
+	cmdTreeDisconnect: true,
+	cmdCreate:         true,
+	cmdClose:          true,
+	cmdFlush:          true,
+	cmdRead:           true,
+	cmdWrite:          true,
+	cmdLock:           true,
+	cmdIoctl:          true,
+	cmdQueryDirectory: true,
+	cmdChangeNotify:   true,
+	cmdQueryInfo:      true,
+	cmdSetInfo:        true,
+}
+
+// handleRequest handles a single request returning the response to
+// send or nil if none should be sent.
+//
+// An error means the connection should be closed.
+func (c *conn) handleRequest(state *compoundState, hdr header, msg []byte, first bool) (*response, error) {
+	r := &request{
+		c:     c,
+		hdr:   hdr,
+		msg:   msg,
+		body:  msg[headerSize:],
+		state: state,
+	}
+	r.resp = &response{
+		hdr: header{
+			Command:   hdr.Command,
+			MessageID: hdr.MessageID,
+			SessionID: hdr.SessionID,
+			TreeID:    hdr.TreeID,
+			Flags:     flagServerToRedir | hdr.Flags&flagRelatedOps,
+			Credits:   min(max(hdr.Credits, 1), maxCredits),
+		},
+	}
+	if hdr.Command == cmdCancel {
+		// There is no response to a cancel and we don't go async
+		return nil, nil
+	}
+	c.mu.Lock()
+	negotiated := c.negotiated
+	c.mu.Unlock()
+	if !negotiated && hdr.Command != cmdNegotiate {
+		return nil, errors.New("request before negotiate")
+	}
+
+	// Related requests use the IDs from the previous request
+	if !first && hdr.Flags&flagRelatedOps != 0 {
+		if state.status != statusSuccess {
+			return r.errorResponse(state.status), nil
+		}
+		r.hdr.SessionID = state.sessionID
+		r.hdr.TreeID = state.treeID
+		r.resp.hdr.SessionID = state.sessionID
+		r.resp.hdr.TreeID = state.treeID
+	}
+
+	// Find the session and check the signature
+	if needsSession[hdr.Command] {
+		c.mu.Lock()
+		r.sess = c.sessions[r.hdr.SessionID]
+		c.mu.Unlock()
+		if r.sess == nil || !r.sess.isValid() {
+			return r.errorResponse(statusUserSessionDeleted), nil
+		}
+		// Once a session is signed every request must be signed
+		// otherwise an attacker could strip the signature
+		if r.sess.signer != nil {
+			if hdr.Flags&flagSigned == 0 {
+				fs.Debugf(c.what, "unsigned %s request on signed session", commandName(hdr.Command))
+				return r.errorResponse(statusAccessDenied), nil
+			}
+			if !r.sess.verify(msg) {
+				fs.Debugf(c.what, "bad signature on %s request", commandName(hdr.Command))
+				return r.errorResponse(statusAccessDenied), nil
+			}
+			r.resp.signer = r.sess
+		}
+	}
+	if needsTree[hdr.Command] {
+		r.tree = r.sess.getTree(r.hdr.TreeID)
+		if r.tree == nil {
+			return r.errorResponse(statusNetworkNameDeleted), nil
+		}
+	}
+
+	status, body := c.dispatch(r)
+	if status != statusSuccess && status != statusMoreProcessingRequired {
+		fs.Debugf(c.what, "%s failed: status 0x%08X", commandName(hdr.Command), status)
+	}
+	state.status = status
+	state.sessionID = r.resp.hdr.SessionID
+	state.treeID = r.resp.hdr.TreeID
+	if body == nil && status != statusSuccess {
+		return r.errorResponse(status), nil
+	}
+	r.resp.hdr.Status = status
+	r.resp.body = body
+	return r.resp, nil
+}
+
+// errorResponse sets the response to an error with status
+func (r *request) errorResponse(status uint32) *response {
+	r.resp.hdr.Status = status
+	// StructureSize, ErrorContextCount, Reserved, ByteCount, ErrorData
+	r.resp.body = []byte{9, 0, 0, 0, 0, 0, 0, 0, 0}
+	return r.resp
+}
+
+// dispatch the request to the handler for its command
+func (c *conn) dispatch(r *request) (status uint32, body []byte) {
+	switch r.hdr.Command {
+	case cmdNegotiate:
+		return c.negotiate(r)
+	case cmdSessionSetup:
+		return c.sessionSetup(r)
+	case cmdLogoff:
+		return c.logoff(r)
+	case cmdTreeConnect:
+		return c.treeConnect(r)
+	case cmdTreeDisconnect:
+		return c.treeDisconnect(r)
+	case cmdCreate:
+		return c.create(r)
+	case cmdClose:
+		return c.closeFile(r)
+	case cmdFlush:
+		return c.flush(r)
+	case cmdRead:
+		return c.read(r)
+	case cmdWrite:
+		return c.write(r)
+	case cmdLock:
+		return c.lock(r)
+	case cmdIoctl:
+		return c.ioctl(r)
+	case cmdEcho:
+		return statusSuccess, []byte{4, 0, 0, 0}
+	case cmdQueryDirectory:
+		return c.queryDirectory(r)
+	case cmdQueryInfo:
+		return c.queryInfo(r)
+	case cmdSetInfo:
+		return c.setInfo(r)
+	}
+	return statusNotSupported, nil
+}
+
+// commandName returns the name of cmd for logging
+func commandName(cmd uint16) string {
+	names := []string{"NEGOTIATE", "SESSION_SETUP", "LOGOFF", "TREE_CONNECT", "TREE_DISCONNECT", "CREATE", "CLOSE", "FLUSH", "READ", "WRITE", "LOCK", "IOCTL", "CANCEL", "ECHO", "QUERY_DIRECTORY", "CHANGE_NOTIFY", "QUERY_INFO", "SET_INFO", "OPLOCK_BREAK"}
+	if int(cmd) < len(names) {
+		return names[cmd]
+	}
+	return fmt.Sprintf("0x%04X", cmd)
+}
+
+// updatePreauth updates the SMB 3.1.1 pre-authentication hash h with pkt
+func updatePreauth(h *[64]byte, pkt []byte) {
+	d := sha512.New()
+	d.Write(h[:])
+	d.Write(pkt)
+	d.Sum(h[:0])
+}
+
+// supported dialects in order of preference
+var supportedDialects = []uint16{dialect311, dialect302, dialect300, dialect210, dialect202}
+
+// negotiate handles the NEGOTIATE request
+func (c *conn) negotiate(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 36 {
+		return statusInvalidParameter, nil
+	}
+	count := int(le.Uint16(b[2:]))
+	if len(b) < 36+2*count {
+		return statusInvalidParameter, nil
+	}
+	dialects := make([]uint16, count)
+	for i := range dialects {
+		dialects[i] = le.Uint16(b[36+2*i:])
+	}
+	dialect := uint16(0)
+	for _, d := range supportedDialects {
+		for _, want := range dialects {
+			if d == want && dialect == 0 {
+				dialect = d
+			}
+		}
+	}
+	if dialect == 0 {
+		return statusNotSupported, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.negotiated {
+		// Negotiate may only happen once
+		c.mu.Unlock()
+		_ = c.nc.Close()
+		c.mu.Lock()
+		return statusAccessDenied, nil
+	}
+	c.negotiated = true
+	c.dialect = dialect
+	c.clientSec = le.Uint16(b[4:])
+	c.clientCaps = le.Uint32(b[8:])
+	copy(c.clientGUID[:], b[12:28])
+	c.dialects = dialects
+
+	var contexts []byte
+	if dialect == dialect311 {
+		// Check the client offered SHA-512 for the preauth hash
+		ctxOff := int(le.Uint32(b[28:])) - headerSize
+		ctxCount := int(le.Uint16(b[32:]))
+		hasSHA512 := false
+		for i := 0; i < ctxCount && ctxOff >= 0 && ctxOff+8 <= len(b); i++ {
+			ctxType := le.Uint16(b[ctxOff:])
+			dataLen := int(le.Uint16(b[ctxOff+2:]))
+			data := b[ctxOff+8 : min(ctxOff+8+dataLen, len(b))]
+			if ctxType == contextPreauthIntegrity && len(data) >= 4 {
+				n := int(le.Uint16(data))
+				for j := 0; j < n && 4+2*j+2 <= len(data); j++ {
+					if le.Uint16(data[4+2*j:]) == hashSHA512 {
+						hasSHA512 = true
+					}
+				}
+			}
+			ctxOff += (8 + dataLen + 7) &^ 7
+		}
+		if !hasSHA512 {
+			c.negotiated = false
+			return statusInvalidParameter, nil
+		}
+		salt := make([]byte, 32)
+		_, _ = rand.Read(salt)
+		var e encoder
+		e.u16(contextPreauthIntegrity)
+		e.u16(uint16(4 + 2 + len(salt)))
+		e.u32(0)
+		e.u16(1)
+		e.u16(uint16(len(salt)))
+		e.u16(hashSHA512)
+		e.bytes(salt)
+		contexts = e.b
+		updatePreauth(&c.preauthHash, r.msg)
+		r.resp.onSend = func(pkt []byte) {
+			c.mu.Lock()
+			updatePreauth(&c.preauthHash, pkt)
+			c.mu.Unlock()
+		}
+	}
+	return statusSuccess, c.negotiateResponse(dialect, contexts)
+}
+
+// negotiateResponse makes the body of the NEGOTIATE response
+func (c *conn) negotiateResponse(dialect uint16, contexts []byte) []byte {
+	secBuf := spnegoInitToken()
+	var caps uint32
+	if dialect != dialect202 {
+		caps |= capLargeMTU
+	}
+	var e encoder
+	e.u16(65)
+	e.u16(c.s.securityMode())
+	e.u16(dialect)
+	if contexts != nil {
+		e.u16(1)
+	} else {
+		e.u16(0)
+	}
+	e.bytes(c.s.guid[:])
+	e.u32(caps)
+	e.u32(maxTransactSize)
+	e.u32(maxReadSize)
+	e.u32(maxWriteSize)
+	e.time(time.Now())
+	e.time(c.s.startTime)
+	e.u16(headerSize + 64)
+	e.u16(uint16(len(secBuf)))
+	ctxOffset := len(e.b) // patched below
+	e.u32(0)
+	e.bytes(secBuf)
+	if contexts != nil {
+		e.align(8)
+		le.PutUint32(e.b[ctxOffset:], uint32(headerSize+len(e.b)))
+		e.bytes(contexts)
+	}
+	return e.b
+}
+
+// negotiateSMB1 handles an SMB1 NEGOTIATE which clients send to find
+// out if SMB2 is supported
+func (c *conn) negotiateSMB1(msg []byte) error {
+	c.mu.Lock()
+	negotiated := c.negotiated
+	c.mu.Unlock()
+	// SMB1 header is 32 bytes then WordCount and ByteCount
+	if negotiated || len(msg) < 35 || msg[4] != 0x72 {
+		return errors.New("unsupported SMB1 request")
+	}
+	var has202, hasWildcard bool
+	for _, d := range bytes.Split(msg[35:], []byte{0}) {
+		switch string(bytes.TrimPrefix(d, []byte{2})) {
+		case "SMB 2.002":
+			has202 = true
+		case "SMB 2.???":
+			hasWildcard = true
+		}
+	}
+	dialect := uint16(dialectWildcard)
+	switch {
+	case hasWildcard:
+	case has202:
+		dialect = dialect202
+		c.mu.Lock()
+		c.negotiated = true
+		c.dialect = dialect
+		c.mu.Unlock()
+	default:
+		return errors.New("client doesn't support SMB2")
+	}
+	resp := &response{
+		hdr: header{
+			Command: cmdNegotiate,
+			Flags:   flagServerToRedir,
+			Credits: 1,
+		},
+		body: c.negotiateResponse(dialect, nil),
+	}
+	return c.sendResponses([]*response{resp})
+}
+
+// session is an authenticated session
+type session struct {
+	id   uint64
+	conn *conn
+
+	mu          sync.Mutex
+	auth        *ntlmAuth // authentication in progress
+	raw         bool      // set if client is using raw NTLM not SPNEGO
+	preauthHash [64]byte
+	valid       bool
+	guest       bool
+	user        string
+	vfs         *vfs.VFS
+	signer      hash.Hash
+	trees       map[uint32]*tree
+	nextTreeID  uint32
+}
+
+// tree is a connection to a share
+type tree struct {
+	id   uint32
+	pipe bool // set for IPC$
+}
+
+// isValid returns true if the session is authenticated
+func (sess *session) isValid() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.valid
+}
+
+// sign pkt with the session key
+func (sess *session) sign(pkt []byte) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sign(sess.signer, pkt)
+}
+
+// verify the signature on pkt
+func (sess *session) verify(pkt []byte) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return verify(sess.signer, pkt)
+}
+
+// getTree finds the tree with id
+func (sess *session) getTree(id uint32) *tree {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.trees[id]
+}
+
+// sessionSetup handles the SESSION_SETUP request which authenticates
+// the user with NTLM
+func (c *conn) sessionSetup(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	secBuf := buffer(b, int(le.Uint16(b[12:])), int(le.Uint16(b[14:])))
+
+	// Find or make the session
+	c.mu.Lock()
+	dialect := c.dialect
+	sess := c.sessions[r.hdr.SessionID]
+	if r.hdr.SessionID == 0 {
+		sess = &session{
+			id:          c.s.sessionID.Add(1),
+			conn:        c,
+			preauthHash: c.preauthHash,
+			trees:       make(map[uint32]*tree),
+		}
+		c.sessions[sess.id] = sess
+	}
+	c.mu.Unlock()
+	if sess == nil {
+		return statusUserSessionDeleted, nil
+	}
+	r.resp.hdr.SessionID = sess.id
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if dialect == dialect311 {
+		updatePreauth(&sess.preauthHash, r.msg)
+	}
+	fail := func(err error) (uint32, []byte) {
+		fs.Infof(c.what, "SMB login failed: %v", err)
+		sess.auth = nil
+		if !sess.valid {
+			c.mu.Lock()
+			delete(c.sessions, sess.id)
+			c.mu.Unlock()
+		}
+		return statusLogonFailure, nil
+	}
+
+	tok, err := parseSPNEGO(secBuf)
+	if err != nil {
+		return fail(err)
+	}
+	if !tok.hasNTLM || len(tok.responseToken) < 12 {
+		return fail(errors.New("only NTLM authentication is supported"))
+	}
+	wrap := func(state int, token, mic []byte) []byte {
+		if sess.raw {
+			return token
+		}
+		return spnegoResponse(state, token, mic)
+	}
+	switch le.Uint32(tok.responseToken[8:]) {
+	case ntlmNegotiate:
+		sess.auth = newNTLMAuth(netbiosName())
+		sess.auth.mechTypes = tok.mechTypes
+		sess.raw = bytes.HasPrefix(secBuf, ntlmSignature)
+		challenge, err := sess.auth.Challenge(tok.responseToken)
+		if err != nil {
+			return fail(err)
+		}
+		if dialect == dialect311 {
+			r.resp.onSend = func(pkt []byte) {
+				sess.mu.Lock()
+				updatePreauth(&sess.preauthHash, pkt)
+				sess.mu.Unlock()
+			}
+		}
+		return statusMoreProcessingRequired, sessionSetupResponse(0, wrap(negStateAcceptIncomplete, challenge, nil))
+	case ntlmAuthenticate:
+		if sess.auth == nil {
+			return fail(errors.New("NTLM AUTHENTICATE without NEGOTIATE"))
+		}
+		am, err := sess.auth.ParseAuthenticate(tok.responseToken)
+		if err != nil {
+			return fail(err)
+		}
+		var flags uint16
+		var res *ntlmResult
+		var VFS *vfs.VFS
+		if c.s.guestAllowed() {
+			VFS = c.s.globalVFS
+			flags = sessionFlagIsGuest
+			if am.Anonymous() {
+				flags = sessionFlagIsNull
+			}
+		} else {
+			if am.Anonymous() {
+				return fail(errors.New("anonymous login not allowed"))
+			}
+			VFS, err = c.s.getVFS(am.user, func(passHash []byte) (err error) {
+				res, err = sess.auth.Verify(am, passHash)
+				return err
+			})
+			if err != nil {
+				return fail(fmt.Errorf("user %q: %w", am.user, err))
+			}
+		}
+		var mic []byte
+		if res != nil {
+			mic, err = sess.auth.MechListMIC(res, tok.mechListMIC)
+			if err != nil {
+				return fail(err)
+			}
+			sess.signer, err = newSigner(dialect, res.sessionKey, sess.preauthHash[:])
+			if err != nil {
+				return fail(err)
+			}
+			// The final response is always signed so the client
+			// can check the server knew the password
+			r.resp.signer = sess
+		}
+		sess.auth = nil
+		sess.valid = true
+		sess.guest = flags != 0
+		sess.user = am.user
+		sess.vfs = VFS
+		fs.Infof(c.what, "SMB login for user %q", am.user)
+		return statusSuccess, sessionSetupResponse(flags, wrap(negStateAcceptCompleted, nil, mic))
+	}
+	return fail(errors.New("unexpected NTLM message"))
+}
+
+// sessionSetupResponse makes the body of a SESSION_SETUP response
+func sessionSetupResponse(flags uint16, secBuf []byte) []byte {
+	var e encoder
+	e.u16(9)
+	e.u16(flags)
+	e.u16(headerSize + 8)
+	e.u16(uint16(len(secBuf)))
+	e.bytes(secBuf)
+	return e.b
+}
+
+// netbiosName returns the name the server uses for itself
+func netbiosName() string {
+	return "RCLONE"
+}
+
+// logoff handles the LOGOFF request
+func (c *conn) logoff(r *request) (status uint32, body []byte) {
+	c.mu.Lock()
+	delete(c.sessions, r.sess.id)
+	var opens []*open
+	for id, o := range c.opens {
+		if o.sess == r.sess {
+			opens = append(opens, o)
+			delete(c.opens, id)
+		}
+	}
+	c.mu.Unlock()
+	for _, o := range opens {
+		_ = o.close()
+	}
+	r.sess.mu.Lock()
+	r.sess.valid = false
+	r.sess.mu.Unlock()
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// treeConnect handles the TREE_CONNECT request
+func (c *conn) treeConnect(r *request) (status uint32, body []byte) {
+	b := r.body
+	if len(b) < 8 {
+		return statusInvalidParameter, nil
+	}
+	p := decodeString(buffer(b, int(le.Uint16(b[4:])), int(le.Uint16(b[6:]))))
+	share := p[strings.LastIndex(p, `\`)+1:]
+	t := &tree{}
+	switch {
+	case strings.EqualFold(share, c.s.opt.ShareName):
+	case strings.EqualFold(share, "IPC$"):
+		t.pipe = true
+	default:
+		fs.Debugf(c.what, "unknown share %q", p)
+		return statusBadNetworkName, nil
+	}
+	sess := r.sess
+	sess.mu.Lock()
+	sess.nextTreeID++
+	t.id = sess.nextTreeID
+	sess.trees[t.id] = t
+	readOnly := sess.vfs.Opt.ReadOnly
+	sess.mu.Unlock()
+	r.resp.hdr.TreeID = t.id
+
+	var e encoder
+	e.u16(16)
+	access := uint32(maximalAccessFullAccess)
+	if t.pipe {
+		e.u8(shareTypePipe)
+		access = maximalAccessPipe
+	} else {
+		e.u8(shareTypeDisk)
+		if readOnly {
+			access = maximalAccessReadOnly
+		}
+	}
+	e.u8(0)
+	e.u32(shareFlagNoCaching)
+	e.u32(0)
+	e.u32(access)
+	return statusSuccess, e.b
+}
+
+// treeDisconnect handles the TREE_DISCONNECT request
+func (c *conn) treeDisconnect(r *request) (status uint32, body []byte) {
+	r.sess.mu.Lock()
+	delete(r.sess.trees, r.tree.id)
+	r.sess.mu.Unlock()
+	c.mu.Lock()
+	var opens []*open
+	for id, o := range c.opens {
+		if o.sess == r.sess && o.tree == r.tree {
+			opens = append(opens, o)
+			delete(c.opens, id)
+		}
+	}
+	c.mu.Unlock()
+	for _, o := range opens {
+		_ = o.close()
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
@@ -0,0 +1,155 @@
+package smb
+
+// Message signing for SMB2 and SMB3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash"
+)
+
+// cmac implements AES-CMAC from RFC 4493 as a hash.Hash
+type cmac struct {
+	c      cipher.Block
+	k1, k2 [aes.BlockSize]byte
+	x      [aes.BlockSize]byte // running MAC
+	buf    [aes.BlockSize]byte // unprocessed input
+	n      int                 // bytes in buf
+}
+
+// newCMAC returns an AES-CMAC hash with key
+func newCMAC(key []byte) (hash.Hash, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	m := &cmac{c: c}
+	// Generate the subkeys
+	var l [aes.BlockSize]byte
+	c.Encrypt(l[:], l[:])
+	shiftLeft(m.k1[:], l[:])
+	if l[0]&0x80 != 0 {
+		m.k1[aes.BlockSize-1] ^= 0x87
+	}
+	shiftLeft(m.k2[:], m.k1[:])
+	if m.k1[0]&0x80 != 0 {
+		m.k2[aes.BlockSize-1] ^= 0x87
+	}
+	return m, nil
+}
+
+// shiftLeft sets dst to src shifted left by one bit
+func shiftLeft(dst, src []byte) {
+	var carry byte
+	for i := len(src) - 1; i >= 0; i-- {
+		b := src[i]
+		dst[i] = b<<1 | carry
+		carry = b >> 7
+	}
+}
+
+// Write adds more data to the running hash
+func (m *cmac) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// Only process a full buffer when there is more input as
+		// the last block is treated specially
+		if m.n == aes.BlockSize {
+			subtle.XORBytes(m.x[:], m.x[:], m.buf[:])
+			m.c.Encrypt(m.x[:], m.x[:])
+			m.n = 0
+		}
+		c := copy(m.buf[m.n:], p)
+		m.n += c
+		p = p[c:]
+	}
+	return n, nil
+}
+
+// Sum appends the MAC to b
+func (m *cmac) Sum(b []byte) []byte {
+	var last [aes.BlockSize]byte
+	if m.n == aes.BlockSize {
+		subtle.XORBytes(last[:], m.buf[:], m.k1[:])
+	} else {
+		copy(last[:], m.buf[:m.n])
+		last[m.n] = 0x80
+		subtle.XORBytes(last[:], last[:], m.k2[:])
+	}
+	subtle.XORBytes(last[:], last[:], m.x[:])
+	m.c.Encrypt(last[:], last[:])
+	return append(b, last[:]...)
+}
+
+// Reset the hash to its initial state
+func (m *cmac) Reset() {
+	m.x = [aes.BlockSize]byte{}
+	m.n = 0
+}
+
+// Size returns the number of bytes Sum returns
+func (m *cmac) Size() int {
+	return aes.BlockSize
+}
+
+// BlockSize returns the hash's underlying block size
+func (m *cmac) BlockSize() int {
+	return aes.BlockSize
+}
+
+// kdf is the SP800-108 counter mode key derivation function used by
+// SMB3 to make the session keys
+func kdf(key, label, context []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(label)
+	h.Write([]byte{0})
+	h.Write(context)
+	h.Write(binary.BigEndian.AppendUint32(nil, 128))
+	return h.Sum(nil)[:16]
+}
+
+// newSigner returns the hash used to sign messages in a session
+// using dialect with sessionKey.
+//
+// preauthHash is only used for SMB 3.1.1.
+func newSigner(dialect uint16, sessionKey []byte, preauthHash []byte) (hash.Hash, error) {
+	// The session key is always 16 bytes
+	key := make([]byte, 16)
+	copy(key, sessionKey)
+	switch dialect {
+	case dialect202, dialect210:
+		return hmac.New(sha256.New, key), nil
+	case dialect300, dialect302:
+		return newCMAC(kdf(key, []byte("SMB2AESCMAC\x00"), []byte("SmbSign\x00")))
+	default:
+		return newCMAC(kdf(key, []byte("SMBSigningKey\x00"), preauthHash))
+	}
+}
+
+// sign the message msg with h.
+//
+// This sets the signed flag and the signature in the header.
+func sign(h hash.Hash, msg []byte) {
+	le.PutUint32(msg[16:], le.Uint32(msg[16:])|flagSigned)
+	clear(msg[48:64])
+	h.Reset()
+	h.Write(msg)
+	copy(msg[48:64], h.Sum(nil))
+}
+
+// verify the signature on msg with h
+func verify(h hash.Hash, msg []byte) bool {
+	var signature [16]byte
+	copy(signature[:], msg[48:64])
+	clear(msg[48:64])
+	h.Reset()
+	h.Write(msg)
+	sum := h.Sum(nil)
+	copy(msg[48:64], signature[:])
+	return hmac.Equal(signature[:], sum[:16])
+}
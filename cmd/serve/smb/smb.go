@@ -0,0 +1,174 @@
+// Package smb implements an SMB server for rclone
+package smb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// OptionsInfo descripts the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "addr",
+	Default: "localhost:445",
+	Help:    "IPaddress:Port or :Port to bind server to",
+}, {
+	Name:    "user",
+	Default: "",
+	Help:    "User name for authentication",
+}, {
+	Name:    "pass",
+	Default: "",
+	Help:    "Password for authentication",
+}, {
+	Name:    "allow_guest",
+	Default: false,
+	Help:    "Allow guest logins without a password if --user isn't set",
+}, {
+	Name:    "share_name",
+	Default: "rclone",
+	Help:    "Name of the SMB share to serve",
+}}
+
+// Options contains options for the SMB Server
+type Options struct {
+	ListenAddr string `config:"addr"`        // Port to listen on
+	User       string `config:"user"`        // single username for NTLM auth if not using auth proxy
+	Pass       string `config:"pass"`        // password for User
+	AllowGuest bool   `config:"allow_guest"` // allow guest logins if User isn't set
+	ShareName  string `config:"share_name"`  // name of the share to serve
+}
+
+// Opt is options set by command line flags
+var Opt Options
+
+// AddFlags adds flags for smb
+func AddFlags(flagSet *pflag.FlagSet) {
+	flags.AddFlagsFromOptions(flagSet, "", OptionsInfo)
+}
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "smb", Opt: &Opt, Options: OptionsInfo})
+	vfsflags.AddFlags(Command.Flags())
+	proxyflags.AddFlags(Command.Flags())
+	AddFlags(Command.Flags())
+	serve.Command.AddCommand(Command)
+	serve.AddRc("smb", func(ctx context.Context, f fs.Fs, in rc.Params) (serve.Handle, error) {
+		// Read VFS Opts
+		var vfsOpt = vfscommon.Opt // set default opts
+		err := configstruct.SetAny(in, &vfsOpt)
+		if err != nil {
+			return nil, err
+		}
+		// Read Proxy Opts
+		var proxyOpt = proxy.Opt // set default opts
+		err = configstruct.SetAny(in, &proxyOpt)
+		if err != nil {
+			return nil, err
+		}
+		// Read opts
+		var opt = Opt // set default opts
+		err = configstruct.SetAny(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		// Create server
+		return newServer(ctx, f, &opt, &vfsOpt, &proxyOpt)
+	})
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "smb remote:path",
+	Short: `Serve remote:path over SMB.`,
+	Long: `Run an SMB server to serve a remote over the SMB2/SMB3 protocol.
+
+This can be used as a network share by Windows, macOS and Linux
+clients, or you can make a remote of type [smb](/smb) to read and
+write it.
+
+The remote is served as a single share called ` + "`rclone`" + ` which can
+be changed with the ` + "`--share-name`" + ` flag. Listing the shares on
+the server isn't supported so clients need to be given the full path
+to the share, e.g. ` + "`\\\\server\\rclone`" + ` or
+` + "`smb://server/rclone`" + `.
+
+SMB clients read and write files in pieces and in any order so you
+will likely need to use ` + "`--vfs-cache-mode writes`" + ` or
+` + "`--vfs-cache-mode full`" + ` to write files.
+
+Windows and macOS clients expect file names to be case insensitive
+so you may want to use ` + "`--vfs-case-insensitive`" + ` too.
+
+### Server options
+
+Use ` + "`--addr`" + ` to specify which IP address and port the server
+should listen on, e.g. ` + "`--addr 1.2.3.4:445`" + ` or ` + "`--addr :1445`" + `
+to listen to all IPs. By default it only listens on localhost on the
+standard SMB port 445, which usually needs root or administrator
+privileges. You can use port ` + "`:0`" + ` to let the OS choose an
+available port.
+
+Note that Windows clients can only connect to port 445, so if you
+want to use the share from Windows you will need to use that port and
+stop any other SMB server running on the machine.
+
+If you set ` + "`--addr`" + ` to listen on a public or LAN accessible IP
+address then using Authentication is advised - see the next section for
+info.
+
+#### Authentication
+
+You must set either a username and password or an authentication
+proxy, or use ` + "`--allow-guest`" + ` to serve files without needing a
+login.
+
+With ` + "`--allow-guest`" + ` any user name and password will be accepted
+as a guest login and anyone who can connect to the server can read and
+write the files. Note that recent versions of Windows refuse to use
+guest logins.
+
+You can set a single username and password with the ` + "`--user`" + ` and
+` + "`--pass`" + ` flags. Clients authenticate with NTLMv2 and all messages
+are signed once the user has logged in. The server requires signing
+so unsigned requests on a logged in session are rejected.
+
+SMB does not encrypt the data sent so you should only use this server
+on trusted networks or over a secure tunnel.
+
+` + strings.TrimSpace(vfs.Help()+proxy.Help),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.74",
+		"groups":            "Filter",
+		"status":            "Experimental",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		var f fs.Fs
+		if proxy.Opt.AuthProxy == "" {
+			cmd.CheckArgs(1, 1, command, args)
+			f = cmd.NewFsSrc(args)
+		} else {
+			cmd.CheckArgs(0, 0, command, args)
+		}
+		cmd.Run(false, false, command, func() error {
+			s, err := newServer(context.Background(), f, &Opt, &vfscommon.Opt, &proxy.Opt)
+			if err != nil {
+				return err
+			}
+			return s.Serve()
+		})
+	},
+}
@@ -0,0 +1,311 @@
+// Serve smb tests set up a server and run operations against it with
+// the smb backend.
+
+//go:build !plan9
+
+package smb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/smb"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/servetest"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUSER = "rclone"
+	testPASS = "password"
+)
+
+// start an SMB server serving dir returning the port it is on
+func start(t *testing.T, dir string, opt Options, vfsOpt vfscommon.Options) string {
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	return startWithProxy(t, f, opt, vfsOpt, proxy.Opt)
+}
+
+// startWithProxy starts an SMB server serving f or using the auth
+// proxy if set returning the port it is on
+func startWithProxy(t *testing.T, f fs.Fs, opt Options, vfsOpt vfscommon.Options, proxyOpt proxy.Options) string {
+	ctx := context.Background()
+	opt.ListenAddr = "localhost:0"
+	s, err := newServer(ctx, f, &opt, &vfsOpt, &proxyOpt)
+	require.NoError(t, err)
+	quit := make(chan struct{})
+	go func() {
+		assert.NoError(t, s.Serve())
+		close(quit)
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, s.Shutdown())
+		<-quit
+	})
+	_, port, err := net.SplitHostPort(s.Addr().String())
+	require.NoError(t, err)
+	return port
+}
+
+// newRemote makes an smb backend talking to the server on port
+func newRemote(t *testing.T, port, user, pass, root string) (fs.Fs, error) {
+	// Don't retry failed logins
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.LowLevelRetries = 1
+	remote := fmt.Sprintf(":smb,host=127.0.0.1,port=%s,user=%s,pass=%s:%s", port, user, obscure.MustObscure(pass), root)
+	f, err := fs.NewFs(ctx, remote)
+	if err == nil {
+		t.Cleanup(func() {
+			_ = f.Features().Shutdown(context.Background())
+		})
+	}
+	return f, err
+}
+
+// testOperations runs some operations against the remote
+func testOperations(t *testing.T, f fs.Fs) {
+	ctx := context.Background()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Upload
+	file1 := fstest.NewItem("file1.txt", "hello world", modTime)
+	o := fstests.PutTestContents(ctx, t, f, &file1, "hello world", true)
+	assert.Equal(t, int64(11), o.Size())
+
+	// Make directories and upload into them
+	require.NoError(t, f.Mkdir(ctx, "sub/dir"))
+	file2 := fstest.NewItem("sub/dir/file2.txt", "potato", modTime)
+	fstests.PutTestContents(ctx, t, f, &file2, "potato", true)
+	fstest.CheckListingWithPrecision(t, f, []fstest.Item{file1, file2}, []string{"sub", "sub/dir"}, time.Second)
+
+	// Read
+	o, err := f.NewObject(ctx, "file1.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", fstests.ReadObject(ctx, t, o, -1))
+
+	// Set the modification time
+	newModTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, o.SetModTime(ctx, newModTime))
+	o, err = f.NewObject(ctx, "file1.txt")
+	require.NoError(t, err)
+	assert.True(t, o.ModTime(ctx).Equal(newModTime), o.ModTime(ctx))
+
+	// Overwrite
+	file1 = fstest.NewItem("file1.txt", "goodbye", modTime)
+	fstests.PutTestContents(ctx, t, f, &file1, "goodbye", true)
+
+	// Rename
+	o, err = f.NewObject(ctx, "file1.txt")
+	require.NoError(t, err)
+	_, err = operations.Move(ctx, f, nil, "sub/file3.txt", o)
+	require.NoError(t, err)
+	file1.Path = "sub/file3.txt"
+	fstest.CheckListingWithPrecision(t, f, []fstest.Item{file1, file2}, []string{"sub", "sub/dir"}, time.Second)
+
+	// Can't remove a non empty directory
+	assert.Error(t, f.Rmdir(ctx, "sub/dir"))
+
+	// Delete
+	require.NoError(t, operations.Purge(ctx, f, "sub"))
+	fstest.CheckListingWithPrecision(t, f, nil, nil, time.Second)
+
+	// Disk usage
+	usage, err := f.Features().About(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, usage.Total)
+}
+
+func TestSMB(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			opt := Opt
+			opt.User = testUSER
+			opt.Pass = testPASS
+			vfsOpt := vfscommon.Opt
+			vfsOpt.CacheMode = cacheMode
+			vfsOpt.CacheMaxAge = fs.Duration(0)
+			port := start(t, dir, opt, vfsOpt)
+
+			f, err := newRemote(t, port, testUSER, testPASS, "rclone")
+			require.NoError(t, err)
+			testOperations(t, f)
+		})
+	}
+}
+
+func TestSMBAuth(t *testing.T) {
+	dir := t.TempDir()
+	opt := Opt
+	opt.User = testUSER
+	opt.Pass = testPASS
+	port := start(t, dir, opt, vfscommon.Opt)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	for _, test := range []struct {
+		name string
+		user string
+		pass string
+		root string
+		ok   bool
+	}{
+		{"OK", testUSER, testPASS, "rclone", true},
+		{"CaseInsensitive", "RCLONE", testPASS, "RClone", true},
+		{"BadPassword", testUSER, "potato", "rclone", false},
+		{"BadUser", "potato", testPASS, "rclone", false},
+		{"BadShare", testUSER, testPASS, "potato", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := newRemote(t, port, test.user, test.pass, test.root)
+			if err == nil {
+				_, err = f.List(context.Background(), "")
+			}
+			if test.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestSMBAuthProxy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+	prog, err := filepath.Abs("../servetest/proxy_code.go")
+	require.NoError(t, err)
+	proxyOpt := proxy.Opt
+	proxyOpt.AuthProxy = "go run " + prog + " " + dir
+	port := startWithProxy(t, nil, Opt, vfscommon.Opt, proxyOpt)
+
+	// The proxy returns "pass-" + user as the password
+	f, err := newRemote(t, port, "potato", "pass-potato", "rclone")
+	require.NoError(t, err)
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "file.txt", entries[0].Remote())
+
+	// Try again with the cached VFS and a wrong password
+	f, err = newRemote(t, port, "potato", "wrong", "rclone")
+	if err == nil {
+		_, err = f.List(context.Background(), "")
+	}
+	assert.Error(t, err)
+}
+
+func TestSMBGuest(t *testing.T) {
+	dir := t.TempDir()
+
+	// Guests must be allowed explicitly
+	opt := Opt
+	opt.ListenAddr = "localhost:0"
+	_, err := newServer(context.Background(), nil, &opt, &vfscommon.Opt, &proxy.Opt)
+	assert.ErrorContains(t, err, "--allow-guest")
+
+	opt = Opt
+	opt.AllowGuest = true
+	port := start(t, dir, opt, vfscommon.Opt)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	f, err := newRemote(t, port, "anyone", "anything", "rclone")
+	require.NoError(t, err)
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "file.txt", entries[0].Remote())
+}
+
+func TestMatchPattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*", "file.txt", true},
+		{"", "file.txt", true},
+		{"file.txt", "FILE.TXT", true},
+		{"*.txt", "file.txt", true},
+		{"*.txt", "file.jpg", false},
+		{"f?le.*", "file.txt", true},
+		{"f?le.*", "fle.txt", false},
+		{"<.txt", "file.txt", true},
+		{"file\"txt", "file.txt", true},
+		{"file>>", "file", true},
+	} {
+		assert.Equal(t, test.want, matchPattern(test.pattern, test.name), fmt.Sprintf("%q %q", test.pattern, test.name))
+	}
+}
+
+func TestRc(t *testing.T) {
+	servetest.TestRc(t, rc.Params{
+		"type":           "smb",
+		"vfs_cache_mode": "off",
+		"allow_guest":    true,
+	})
+}
+
+func TestSigningRequired(t *testing.T) {
+	s := &Server{opt: Options{User: testUSER, Pass: testPASS}}
+	assert.Equal(t, uint16(securitySigningEnabled|securitySigningRequired), s.securityMode())
+	assert.Equal(t, uint16(securitySigningEnabled), (&Server{opt: Options{AllowGuest: true}}).securityMode())
+
+	signer, err := newSigner(dialect311, make([]byte, 16), make([]byte, 64))
+	require.NoError(t, err)
+	c := &conn{
+		s:          s,
+		what:       "test",
+		negotiated: true,
+		dialect:    dialect311,
+		sessions:   make(map[uint64]*session),
+		opens:      make(map[uint64]*open),
+	}
+	sess := &session{id: 1, conn: c, valid: true, signer: signer}
+	c.sessions[sess.id] = sess
+
+	// makeLogoff makes a LOGOFF request for the session
+	makeLogoff := func() []byte {
+		msg := make([]byte, headerSize+4)
+		hdr := header{Command: cmdLogoff, Credits: 1, MessageID: 2, SessionID: sess.id}
+		hdr.encode(msg)
+		le.PutUint16(msg[headerSize:], 4)
+		return msg
+	}
+	send := func(msg []byte) uint32 {
+		resp, err := c.handleRequest(&compoundState{}, decodeHeader(msg), msg, true)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return resp.hdr.Status
+	}
+
+	// An unsigned request on a signed session is rejected
+	assert.Equal(t, uint32(statusAccessDenied), send(makeLogoff()))
+
+	// A tampered request is rejected
+	msg := makeLogoff()
+	sign(signer, msg)
+	msg[headerSize+2] = 1
+	assert.Equal(t, uint32(statusAccessDenied), send(msg))
+	assert.True(t, sess.isValid())
+
+	// A correctly signed request is accepted
+	msg = makeLogoff()
+	sign(signer, msg)
+	assert.Equal(t, uint32(statusSuccess), send(msg))
+	assert.False(t, sess.isValid())
+}
@@ -249,6 +249,7 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
 		// override auth
 		w.opt.Auth.CustomAuthFn = w.auth
+		w.opt.Auth.CustomTokenAuthFn = w.tokenAuth
 	} else {
 		w._vfs = vfs.New(f, vfsOpt)
 	}
@@ -324,12 +325,39 @@ func (w *WebDAV) auth(user, pass string) (value any, err error) {
 	return VFS, err
 }
 
+// tokenAuth does proxy authorization for bearer tokens
+func (w *WebDAV) tokenAuth(user string, claims map[string]any) (value any, err error) {
+	VFS, _, err := w.proxy.CallWithClaims(user, claims)
+	if err != nil {
+		return nil, err
+	}
+	return VFS, err
+}
+
 type webdavRW struct {
 	http.ResponseWriter
-	status int
+	status        int
+	quotaExceeded bool // set if the request failed because of the quota
+}
+
+// webdavRWKey is the context key for the webdavRW of the request
+type webdavRWKey struct{}
+
+// checkQuotaError notes if err was caused by going over the quota so
+// the request fails with 507 Insufficient Storage
+func checkQuotaError(ctx context.Context, err error) {
+	if !errors.Is(err, vfs.ENOSPC) {
+		return
+	}
+	if rw, ok := ctx.Value(webdavRWKey{}).(*webdavRW); ok {
+		rw.quotaExceeded = true
+	}
 }
 
 func (rw *webdavRW) WriteHeader(statusCode int) {
+	if rw.quotaExceeded && statusCode >= 400 {
+		statusCode = http.StatusInsufficientStorage
+	}
 	rw.status = statusCode
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
@@ -382,6 +410,7 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// return absolute references.
 	r.URL.Path = w.opt.HTTP.BaseURL + r.URL.Path
 	wrw := &webdavRW{ResponseWriter: rw}
+	r = r.WithContext(context.WithValue(r.Context(), webdavRWKey{}, wrw))
 	w.webdavhandler.ServeHTTP(wrw, r)
 
 	if wrw.isSuccessfull() {
@@ -503,8 +532,9 @@ func (w *WebDAV) OpenFile(ctx context.Context, name string, flags int, perm os.F
 	if err != nil {
 		return nil, err
 	}
-	f, err := VFS.OpenFile(name, flags, perm)
+	f, err := VFS.OpenFileContext(ctx, name, flags, perm)
 	if err != nil {
+		checkQuotaError(ctx, err)
 		return nil, err
 	}
 	return Handle{Handle: f, w: w, ctx: ctx}, nil
@@ -517,15 +547,7 @@ func (w *WebDAV) RemoveAll(ctx context.Context, name string) (err error) {
 	if err != nil {
 		return err
 	}
-	node, err := VFS.Stat(name)
-	if err != nil {
-		return err
-	}
-	err = node.RemoveAll()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.RemoveAllContext(ctx, name)
 }
 
 // Rename a file or a directory
@@ -535,7 +557,7 @@ func (w *WebDAV) Rename(ctx context.Context, oldName, newName string) (err error
 	if err != nil {
 		return err
 	}
-	return VFS.Rename(oldName, newName)
+	return VFS.RenameContext(ctx, oldName, newName)
 }
 
 // Stat returns info about the file or directory
@@ -572,6 +594,13 @@ func (h Handle) Readdir(count int) (fis []os.FileInfo, err error) {
 	return fis, nil
 }
 
+// Write data to the handle
+func (h Handle) Write(p []byte) (n int, err error) {
+	n, err = h.Handle.Write(p)
+	checkQuotaError(h.ctx, err)
+	return n, err
+}
+
 // Stat the handle
 func (h Handle) Stat() (fi os.FileInfo, err error) {
 	fi, err = h.Handle.Stat()
@@ -614,6 +643,22 @@ func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
 	property.InnerXML = strconv.AppendInt(nil, h.Handle.Node().ModTime().Unix(), 10)
 	properties[xmlName] = property
 
+	// Report the quota on directories as in RFC 4331
+	if node := h.Handle.Node(); node.IsDir() {
+		if usedBytes, maxBytes, _, _, ok := node.VFS().Quota(); ok && maxBytes >= 0 {
+			for name, value := range map[string]int64{
+				"quota-available-bytes": max(maxBytes-usedBytes, 0),
+				"quota-used-bytes":      usedBytes,
+			} {
+				xmlName = xml.Name{Space: "DAV:", Local: name}
+				properties[xmlName] = webdav.Property{
+					XMLName:  xmlName,
+					InnerXML: strconv.AppendInt(nil, value, 10),
+				}
+			}
+		}
+	}
+
 	return properties, nil
 }
 
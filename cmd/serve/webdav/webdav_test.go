@@ -271,3 +271,51 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+func TestQuota(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+
+	opt := Opt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	vfsOpt := vfscommon.Opt
+	vfsOpt.QuotaBytes = 10
+
+	w, err := newWebDAV(context.Background(), f, &opt, &vfsOpt, &proxy.Opt)
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, w.Serve())
+	}()
+	defer func() {
+		assert.NoError(t, w.Shutdown())
+	}()
+	testURL := w.server.URLs()[0]
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, testURL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if method == "PROPFIND" {
+			req.Header.Set("Depth", "0")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+
+	status, _ := do("PUT", "file1.txt", "12345")
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, body := do("PROPFIND", "", `<?xml version="1.0"?>
+<propfind xmlns="DAV:"><prop><quota-available-bytes/><quota-used-bytes/></prop></propfind>`)
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, `<D:quota-available-bytes>5</D:quota-available-bytes>`)
+	assert.Contains(t, body, `<D:quota-used-bytes>5</D:quota-used-bytes>`)
+
+	status, _ = do("PUT", "file2.txt", "123456")
+	assert.Equal(t, http.StatusInsufficientStorage, status)
+}
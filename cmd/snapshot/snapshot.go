@@ -0,0 +1,349 @@
+// Package snapshot provides the snapshot command.
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// snapshotsDir is the directory under dest:path holding the snapshots
+	snapshotsDir = "snapshots"
+	// timeFormat is the format of the snapshot directory names
+	//
+	// These sort in time order and don't contain characters which
+	// are illegal on common remotes.
+	timeFormat = "2006-01-02T150405Z"
+	// completeSuffix is added to the snapshot name to make the name
+	// of the file marking a snapshot as complete
+	completeSuffix = ".complete"
+)
+
+// Options for the snapshot command
+type Options struct {
+	KeepDaily          int  // number of daily snapshots to keep
+	KeepWeekly         int  // number of weekly snapshots to keep
+	KeepMonthly        int  // number of monthly snapshots to keep
+	CreateEmptySrcDirs bool // create empty source dirs in the snapshot
+}
+
+// Globals
+var (
+	opt = Options{}
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.IntVarP(cmdFlags, &opt.KeepDaily, "keep-daily", "", opt.KeepDaily, "Number of daily snapshots to keep", "")
+	flags.IntVarP(cmdFlags, &opt.KeepWeekly, "keep-weekly", "", opt.KeepWeekly, "Number of weekly snapshots to keep", "")
+	flags.IntVarP(cmdFlags, &opt.KeepMonthly, "keep-monthly", "", opt.KeepMonthly, "Number of monthly snapshots to keep", "")
+	flags.BoolVarP(cmdFlags, &opt.CreateEmptySrcDirs, "create-empty-src-dirs", "", opt.CreateEmptySrcDirs, "Create empty source dirs in the snapshot", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "snapshot source:path dest:path",
+	Short: `Make a point in time copy of source in dest:path/snapshots.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Make a point in time copy of the source in a new directory
+|dest:path/snapshots/TIMESTAMP| and optionally remove old snapshots.
+
+The TIMESTAMP is the time the snapshot was started in UTC, for
+example |2024-05-06T102030Z|.
+
+Each snapshot is a complete copy of the source. However only files
+which have changed since the previous snapshot are uploaded. Files
+which are unchanged are copied from the previous snapshot using
+server-side copy, so each snapshot is quick to make and, on remotes
+which share data between copies, takes little extra space. This works
+like the |--copy-dest| flag with the previous snapshot.
+
+If the destination doesn't support server-side copy then all the
+files will be uploaded each time.
+
+For example
+
+|||sh
+rclone snapshot /home/user remote:backup
+|||
+
+Will make a directory like |remote:backup/snapshots/2024-05-06T102030Z|
+containing a copy of |/home/user|.
+
+Old snapshots can be removed with |--keep-daily|, |--keep-weekly| and
+|--keep-monthly|. These keep the newest snapshot in each of the last N
+days, weeks and months which have a snapshot. The newest snapshot is
+always kept and a snapshot is kept if any of the rules keep it. Days,
+weeks (starting on a Monday) and months are in UTC. If none of these
+are set no snapshots are removed.
+
+For example to keep one snapshot for each of the last 7 days, 4 weeks
+and 12 months
+
+|||sh
+rclone snapshot --keep-daily 7 --keep-weekly 4 --keep-monthly 12 /home/user remote:backup
+|||
+
+When a snapshot completes without errors a file called
+|TIMESTAMP.complete| is written next to it. Only complete snapshots
+are used as the previous snapshot and counted by the retention rules.
+
+Old snapshots are only removed if the new snapshot completed without
+errors. If a snapshot fails, its directory is left in place without
+the |.complete| file, and it is removed along with the other old
+snapshots by the next snapshot which completes.
+
+Directories in |dest:path/snapshots| which don't have a name in the
+TIMESTAMP format are ignored, so don't rename the snapshots or their
+|.complete| files.
+
+Filters apply to the files copied into the snapshot but not to the
+snapshots being removed.
+
+**Note**: Use the |--dry-run| or the |--interactive|/|-i| flag to test without
+copying or removing anything.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.74",
+		"groups":            "Copy,Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		cmd.Run(true, true, command, func() error {
+			_, err := Snapshot(context.Background(), fdst, fsrc, &opt, time.Now())
+			return err
+		})
+	},
+}
+
+// snapshot describes a snapshot directory
+type snapshot struct {
+	name     string    // name of the directory
+	t        time.Time // time parsed from the name
+	complete bool      // set if the snapshot completed without errors
+}
+
+// snapshotPath returns the config string of the snapshot directory called name
+func snapshotPath(fdst fs.Fs, name string) string {
+	return fspath.JoinRootPath(fs.ConfigString(fdst), path.Join(snapshotsDir, name))
+}
+
+// listSnapshots returns the snapshots in fdst sorted oldest first
+func listSnapshots(ctx context.Context, fdst fs.Fs) (snapshots []snapshot, err error) {
+	entries, err := fdst.List(ctx, snapshotsDir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	complete := make(map[string]bool)
+	for _, entry := range entries {
+		name := path.Base(entry.Remote())
+		if _, ok := entry.(fs.Directory); !ok {
+			if marked, found := strings.CutSuffix(name, completeSuffix); found {
+				complete[marked] = true
+			}
+			continue
+		}
+		t, err := time.Parse(timeFormat, name)
+		if err != nil {
+			fs.Debugf(fdst, "Ignoring %q in %s as it isn't a snapshot", name, snapshotsDir)
+			continue
+		}
+		snapshots = append(snapshots, snapshot{name: name, t: t})
+	}
+	for i := range snapshots {
+		snapshots[i].complete = complete[snapshots[i].name]
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].t.Before(snapshots[j].t)
+	})
+	return snapshots, nil
+}
+
+// Snapshot makes a new snapshot of fsrc in fdst/snapshots then
+// removes old snapshots according to the retention options.
+//
+// It returns the name of the snapshot made.
+func Snapshot(ctx context.Context, fdst, fsrc fs.Fs, opt *Options, now time.Time) (name string, err error) {
+	ci := fs.GetConfig(ctx)
+	if len(ci.CopyDest) > 0 || len(ci.CompareDest) > 0 {
+		return "", errors.New("can't use --copy-dest or --compare-dest with snapshot")
+	}
+	snapshots, err := listSnapshots(ctx, fdst)
+	if err != nil {
+		return "", err
+	}
+	name = now.UTC().Format(timeFormat)
+	for _, s := range snapshots {
+		if s.name == name {
+			return "", fmt.Errorf("snapshot %q already exists", name)
+		}
+	}
+	fnew, err := cache.Get(ctx, snapshotPath(fdst, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to make snapshot directory: %w", err)
+	}
+
+	// Copy unchanged files from the previous complete snapshot
+	if prev := lastComplete(snapshots); prev != nil {
+		if fnew.Features().Copy != nil {
+			fs.Infof(fdst, "Making snapshot %q using unchanged files from %q", name, prev.name)
+			var newCi *fs.ConfigInfo
+			ctx, newCi = fs.AddConfig(ctx)
+			newCi.CopyDest = []string{snapshotPath(fdst, prev.name)}
+		} else {
+			fs.Logf(fdst, "Making snapshot %q uploading all files as server-side copy isn't supported", name)
+		}
+	} else {
+		fs.Infof(fdst, "Making first snapshot %q", name)
+	}
+	err = operations.Mkdir(ctx, fnew, "")
+	if err != nil {
+		return name, err
+	}
+	err = sync.CopyDir(ctx, fnew, fsrc, opt.CreateEmptySrcDirs)
+	if err != nil {
+		return name, fmt.Errorf("snapshot %q failed: %w", name, err)
+	}
+	// Mark the snapshot as complete
+	_, err = operations.Rcat(ctx, fdst, path.Join(snapshotsDir, name+completeSuffix), io.NopCloser(strings.NewReader(name+"\n")), now, nil)
+	if err != nil {
+		return name, fmt.Errorf("snapshot %q failed to mark as complete: %w", name, err)
+	}
+	fs.Infof(fdst, "Made snapshot %q", name)
+
+	snapshots = append(snapshots, snapshot{name: name, t: now.UTC(), complete: true})
+	return name, prune(ctx, fdst, snapshots, opt)
+}
+
+// lastComplete returns the newest complete snapshot or nil if there
+// isn't one. snapshots should be sorted oldest first.
+func lastComplete(snapshots []snapshot) *snapshot {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].complete {
+			return &snapshots[i]
+		}
+	}
+	return nil
+}
+
+// selectKeep returns the names of the snapshots the retention options
+// keep. snapshots should be sorted oldest first.
+//
+// Only complete snapshots are counted. Incomplete snapshots are kept
+// if they are newer than the newest complete snapshot as they may
+// still be being made, otherwise they are failures and aren't kept.
+func selectKeep(snapshots []snapshot, opt *Options) map[string]bool {
+	keep := make(map[string]bool)
+	newest := lastComplete(snapshots)
+	if newest == nil {
+		return keep
+	}
+	var complete []snapshot
+	for _, s := range snapshots {
+		if s.complete {
+			complete = append(complete, s)
+		} else if s.t.After(newest.t) {
+			keep[s.name] = true
+		}
+	}
+	snapshots = complete
+	// Always keep the newest
+	keep[newest.name] = true
+	rules := []struct {
+		n      int
+		period func(t time.Time) string
+	}{
+		{opt.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{opt.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{opt.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, rule := range rules {
+		n := rule.n
+		lastPeriod := ""
+		for i := len(snapshots) - 1; i >= 0 && n > 0; i-- {
+			period := rule.period(snapshots[i].t)
+			if period == lastPeriod {
+				continue
+			}
+			keep[snapshots[i].name] = true
+			lastPeriod = period
+			n--
+		}
+	}
+	return keep
+}
+
+// prune removes the snapshots the retention options don't keep
+func prune(ctx context.Context, fdst fs.Fs, snapshots []snapshot, opt *Options) error {
+	if opt.KeepDaily <= 0 && opt.KeepWeekly <= 0 && opt.KeepMonthly <= 0 {
+		return nil
+	}
+	// Remove the whole snapshot whatever the filters are
+	fi, err := filter.NewFilter(&filter.Options{
+		MinAge:  fs.DurationOff,
+		MaxAge:  fs.DurationOff,
+		MinSize: fs.SizeSuffix(-1),
+		MaxSize: fs.SizeSuffix(-1),
+	})
+	if err != nil {
+		return err
+	}
+	ctx = filter.ReplaceConfig(ctx, fi)
+	keep := selectKeep(snapshots, opt)
+	var errCount int
+	for _, s := range snapshots {
+		if keep[s.name] {
+			continue
+		}
+		fs.Infof(fdst, "Removing snapshot %q", s.name)
+		err := removeSnapshot(ctx, fdst, s)
+		if err != nil {
+			fs.Errorf(fdst, "Failed to remove snapshot %q: %v", s.name, err)
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("failed to remove %d old snapshots", errCount)
+	}
+	return nil
+}
+
+// removeSnapshot removes the snapshot s
+//
+// The complete marker is removed first so if removing the directory
+// fails it is treated as a failed snapshot from then on.
+func removeSnapshot(ctx context.Context, fdst fs.Fs, s snapshot) error {
+	if s.complete {
+		o, err := fdst.NewObject(ctx, path.Join(snapshotsDir, s.name+completeSuffix))
+		if err == nil {
+			err = operations.DeleteFile(ctx, o)
+		}
+		if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+			return err
+		}
+	}
+	return operations.Purge(ctx, fdst, path.Join(snapshotsDir, s.name))
+}
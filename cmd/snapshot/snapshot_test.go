@@ -0,0 +1,154 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06.499999999Z")
+	t2 = fstest.Time("2018-03-04T05:06:07.123456789Z")
+)
+
+// inSnapshot returns items moved into the snapshot called name
+func inSnapshot(name string, items ...fstest.Item) []fstest.Item {
+	out := make([]fstest.Item, len(items))
+	for i, item := range items {
+		item.Path = path.Join(snapshotsDir, name, item.Path)
+		out[i] = item
+	}
+	return out
+}
+
+// completed returns the marker showing the snapshot called name made
+// at t is complete
+func completed(name string, t time.Time) fstest.Item {
+	return fstest.NewItem(path.Join(snapshotsDir, name+completeSuffix), name+"\n", t)
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	stats := accounting.GlobalStats()
+	canCopy := r.Fremote.Features().Copy != nil
+
+	file1 := r.WriteFile("one", "one", t1)
+	file2 := r.WriteFile("dir/two", "two", t1)
+	now := time.Date(2024, 5, 6, 10, 20, 30, 0, time.UTC)
+	name1, err := Snapshot(ctx, r.Fremote, r.Flocal, &Options{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-06T102030Z", name1)
+	done1 := completed(name1, now)
+	r.CheckRemoteItems(t, append(inSnapshot(name1, file1, file2), done1)...)
+
+	// Change one file - only it should be uploaded
+	file2 = r.WriteFile("dir/two", "two changed", t2)
+	stats.ResetCounters()
+	name2, err := Snapshot(ctx, r.Fremote, r.Flocal, &Options{}, now.Add(time.Hour))
+	require.NoError(t, err)
+	if canCopy {
+		out, err := stats.RemoteStats(false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), out["serverSideCopies"])
+	}
+	done2 := completed(name2, now.Add(time.Hour))
+	r.CheckRemoteItems(t, append(append(inSnapshot(name1, file1, fstest.NewItem("dir/two", "two", t1)), inSnapshot(name2, file1, file2)...), done1, done2)...)
+
+	// Can't make the same snapshot twice
+	_, err = Snapshot(ctx, r.Fremote, r.Flocal, &Options{}, now.Add(time.Hour))
+	assert.ErrorContains(t, err, "already exists")
+
+	// Keeping two daily snapshots should keep the newest from each
+	// day, removing the first
+	name3, err := Snapshot(ctx, r.Fremote, r.Flocal, &Options{KeepDaily: 2}, now.Add(24*time.Hour))
+	require.NoError(t, err)
+	done3 := completed(name3, now.Add(24*time.Hour))
+	r.CheckRemoteItems(t, append(append(inSnapshot(name2, file1, file2), inSnapshot(name3, file1, file2)...), done2, done3)...)
+
+	// A failed snapshot isn't marked as complete
+	failed := now.Add(48 * time.Hour).Format(timeFormat)
+	r.WriteObject(ctx, path.Join(snapshotsDir, failed, "partial"), "partial", t1)
+	snapshots, err := listSnapshots(ctx, r.Fremote)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3)
+	assert.False(t, snapshots[2].complete)
+	assert.Equal(t, name3, lastComplete(snapshots).name, "not used as the previous snapshot")
+
+	// and is removed by the next snapshot which prunes
+	name4, err := Snapshot(ctx, r.Fremote, r.Flocal, &Options{KeepDaily: 2}, now.Add(72*time.Hour))
+	require.NoError(t, err)
+	done4 := completed(name4, now.Add(72*time.Hour))
+	r.CheckRemoteItems(t, append(append(inSnapshot(name3, file1, file2), inSnapshot(name4, file1, file2)...), done3, done4)...)
+}
+
+func TestSelectKeep(t *testing.T) {
+	parse := func(s string) time.Time {
+		t, err := time.Parse(timeFormat, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	var snapshots []snapshot
+	for _, name := range []string{
+		"2024-01-15T000000Z",
+		"2024-02-10T000000Z",
+		"2024-02-20T000000Z",
+		"2024-03-04T000000Z", // Monday
+		"2024-03-05T000000Z",
+		"2024-03-10T000000Z", // Sunday
+		"2024-03-11T000000Z", // Monday
+		"2024-03-11T120000Z",
+	} {
+		snapshots = append(snapshots, snapshot{name: name, t: parse(name), complete: true})
+	}
+	// failed snapshots don't count and aren't kept unless they may
+	// still be running
+	snapshots = append(snapshots[:2], append([]snapshot{{name: "2024-02-15T000000Z", t: parse("2024-02-15T000000Z")}}, snapshots[2:]...)...)
+	snapshots = append(snapshots, snapshot{name: "2024-03-12T000000Z", t: parse("2024-03-12T000000Z")})
+	for _, test := range []struct {
+		opt  Options
+		want []string
+	}{{
+		opt:  Options{},
+		want: []string{"2024-03-12T000000Z", "2024-03-11T120000Z"},
+	}, {
+		opt:  Options{KeepDaily: 3},
+		want: []string{"2024-03-12T000000Z", "2024-03-11T120000Z", "2024-03-10T000000Z", "2024-03-05T000000Z"},
+	}, {
+		opt:  Options{KeepWeekly: 2},
+		want: []string{"2024-03-12T000000Z", "2024-03-11T120000Z", "2024-03-10T000000Z"},
+	}, {
+		opt:  Options{KeepMonthly: 3},
+		want: []string{"2024-03-12T000000Z", "2024-03-11T120000Z", "2024-02-20T000000Z", "2024-01-15T000000Z"},
+	}, {
+		opt:  Options{KeepDaily: 1, KeepMonthly: 2},
+		want: []string{"2024-03-12T000000Z", "2024-03-11T120000Z", "2024-02-20T000000Z"},
+	}, {
+		opt:  Options{KeepDaily: 100},
+		want: []string{"2024-03-12T000000Z", "2024-03-11T120000Z", "2024-03-10T000000Z", "2024-03-05T000000Z", "2024-03-04T000000Z", "2024-02-20T000000Z", "2024-02-10T000000Z", "2024-01-15T000000Z"},
+	}} {
+		keep := selectKeep(snapshots, &test.opt)
+		var got []string
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			if keep[snapshots[i].name] {
+				got = append(got, snapshots[i].name)
+			}
+		}
+		assert.Equal(t, test.want, got, fmt.Sprintf("%+v", test.opt))
+	}
+}
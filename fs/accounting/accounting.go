@@ -495,6 +495,17 @@ func (acc *Account) AccountReadN(n int64) {
 	acc.accountReadN(n)
 }
 
+// AccountReadNoNetwork account having read n bytes without using
+// the network, eg for the chunks of a resumed upload which were
+// written before.
+//
+// These count towards the bytes transferred but not the speed.
+func (acc *Account) AccountReadNoNetwork(n int64) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.accountReadNoNetwork(n)
+}
+
 // Close the object
 func (acc *Account) Close() error {
 	acc.mu.Lock()
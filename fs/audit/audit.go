@@ -0,0 +1,565 @@
+// Package audit keeps a log of the destructive operations rclone does.
+//
+// Each entry is a line of JSON which includes the hash of the previous
+// entry so editing, inserting or removing entries breaks the chain and
+// can be detected with Verify. The hashes are only tamper evident if
+// they are keyed with --audit-key, otherwise anyone who can edit the
+// log can recalculate them.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/file"
+)
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "audit_log",
+	Default: "",
+	Help:    "Append a log of deletes, overwrites, moves and purges to this file",
+	Groups:  "Logging",
+}, {
+	Name:    "audit_syslog",
+	Default: false,
+	Help:    "Send the audit log to syslog",
+	Groups:  "Logging",
+}, {
+	Name:      "audit_key",
+	Default:   "",
+	Help:      "Key to sign the audit log entries with HMAC-SHA256",
+	Groups:    "Logging",
+	Sensitive: true,
+}, {
+	Name:    "audit_slow_hash",
+	Default: false,
+	Help:    "Record a hash in the audit log even if it is slow to calculate",
+	Groups:  "Logging",
+}}
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "audit", Opt: &Opt, Options: OptionsInfo, Reload: Reload})
+}
+
+// Options contains options for the audit log
+type Options struct {
+	File     string `config:"audit_log"`       // append the audit log to this file
+	Syslog   bool   `config:"audit_syslog"`    // send the audit log to syslog
+	Key      string `config:"audit_key"`       // key for the HMAC of the entries if set
+	SlowHash bool   `config:"audit_slow_hash"` // record hashes even if slow
+}
+
+// Opt is the options for the audit log
+var Opt Options
+
+// Actions recorded in the audit log
+const (
+	ActionDelete    = "delete"    // a file was deleted
+	ActionOverwrite = "overwrite" // a file was replaced with new contents
+	ActionMove      = "move"      // a file was moved or renamed
+	ActionPurge     = "purge"     // a directory and everything in it was deleted
+	ActionRmdir     = "rmdir"     // an empty directory was removed
+)
+
+// Types of Actor
+const (
+	ActorCLI   = "cli"   // the rclone command line
+	ActorRC    = "rc"    // a call to the remote control
+	ActorServe = "serve" // a request to one of the rclone servers
+)
+
+// Actor describes who did an action
+type Actor struct {
+	Type    string `json:"type"`              // one of the Actor constants
+	User    string `json:"user,omitempty"`    // the OS user for the command line or the authenticated user
+	Command string `json:"command,omitempty"` // the rclone command running, eg "rclone sync"
+}
+
+// Entry is a line in the audit log
+type Entry struct {
+	Seq       int64             `json:"seq"`                 // number of the entry starting from 1
+	Time      time.Time         `json:"time"`                // when the action completed
+	Action    string            `json:"action"`              // one of the Action constants
+	Actor     Actor             `json:"actor"`               // who did it
+	Remote    string            `json:"remote"`              // the remote the action was done on
+	Path      string            `json:"path"`                // path of the file or directory on the remote
+	DstRemote string            `json:"dstRemote,omitempty"` // the remote moved to
+	DstPath   string            `json:"dstPath,omitempty"`   // the path moved to
+	Size      int64             `json:"size"`                // size of the file or -1 if unknown or a directory
+	Hashes    map[string]string `json:"hashes,omitempty"`    // hashes of the file before the action
+	Prev      string            `json:"prev"`                // hash of the previous entry
+	Hash      string            `json:"hash,omitempty"`      // SHA-256 or HMAC-SHA256 of this entry without the hash
+}
+
+// sum returns the hash of the entry which is the hex encoded SHA-256
+// of the entry as JSON without the Hash, or its HMAC-SHA256 if key is
+// set.
+func (e *Entry) sum(key string) (string, error) {
+	entry := *e
+	entry.Hash = ""
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+type actorKey struct{}
+
+// WithActor returns a new context with the actor for the actions done
+// with it.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// GetActor returns the actor set in the context or the command line
+// actor if not set.
+func GetActor(ctx context.Context) Actor {
+	mu.Lock()
+	defer mu.Unlock()
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	if !ok {
+		return defaultActor
+	}
+	if actor.Command == "" {
+		actor.Command = defaultActor.Command
+	}
+	return actor
+}
+
+// CopyActor returns dst with the actor from src.
+//
+// Use this when making a new context which is unlinked from src so
+// the actor isn't lost.
+func CopyActor(dst, src context.Context) context.Context {
+	if actor, ok := src.Value(actorKey{}).(Actor); ok {
+		return WithActor(dst, actor)
+	}
+	return dst
+}
+
+// HasActor returns true if an actor has been set in the context
+func HasActor(ctx context.Context) bool {
+	_, ok := ctx.Value(actorKey{}).(Actor)
+	return ok
+}
+
+type quietKey struct{}
+
+// Quiet returns a new context in which no actions are recorded.
+//
+// Use this for the steps of an action which is recorded as a whole,
+// eg the copy and delete a move falls back to.
+func Quiet(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quietKey{}, true)
+}
+
+// isQuiet returns true if actions done with ctx shouldn't be recorded
+func isQuiet(ctx context.Context) bool {
+	quiet, _ := ctx.Value(quietKey{}).(bool)
+	return quiet
+}
+
+// SetCommand sets the rclone command being run for the actors
+func SetCommand(command string) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultActor.Command = command
+}
+
+// currentUser returns the name of the OS user running rclone
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// sink is somewhere the audit log is written
+type sink interface {
+	write(line []byte) error
+	close() error
+}
+
+var (
+	mu           sync.Mutex
+	defaultActor = Actor{Type: ActorCLI, User: currentUser()}
+	opened       bool      // set if we've tried to open the sinks
+	openErr      error     // error opening the sinks if any
+	sinks        []sink    // where the entries are written
+	logFile      *fileSink // the audit log file if open - also in sinks
+	seq          int64     // sequence number of the last entry
+	prev         string    // hash of the last entry
+)
+
+// Enabled returns true if the audit log is in use
+func Enabled() bool {
+	return Opt.File != "" || Opt.Syslog
+}
+
+// Reload closes the audit log so it is reopened with the new options
+// when next used
+func Reload(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	closeSinks()
+	return nil
+}
+
+// closeSinks closes the sinks - call with mu held
+func closeSinks() {
+	for _, s := range sinks {
+		if err := s.close(); err != nil {
+			fs.Errorf(nil, "audit: failed to close audit log: %v", err)
+		}
+	}
+	sinks = nil
+	logFile = nil
+	opened = false
+	openErr = nil
+	seq, prev = 0, ""
+}
+
+// openSinks opens the sinks if not already open - call with mu held
+//
+// The chain is continued from the last entry in the file if there is
+// one. If any of the sinks can't be opened the error is returned now
+// and each time it is called until the audit log is reloaded.
+func openSinks() error {
+	if opened {
+		return openErr
+	}
+	opened = true
+	if Opt.File != "" {
+		s, last, err := openFile(Opt.File)
+		if err != nil {
+			fs.Errorf(nil, "audit: failed to open audit log: %v", err)
+			openErr = fmt.Errorf("failed to open audit log: %w", err)
+		} else {
+			sinks = append(sinks, s)
+			logFile = s
+			if last != nil {
+				seq, prev = last.Seq, last.Hash
+			}
+		}
+	}
+	if Opt.Syslog {
+		s, err := openSyslog()
+		if err != nil {
+			fs.Errorf(nil, "audit: failed to open syslog: %v", err)
+			if openErr == nil {
+				openErr = fmt.Errorf("failed to open audit syslog: %w", err)
+			}
+		} else {
+			sinks = append(sinks, s)
+		}
+	}
+	return openErr
+}
+
+// write adds the entry to the chain and writes it to the sinks
+//
+// It returns an error if the entry couldn't be written to all of
+// them.
+func write(e *Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := openSinks(); err != nil {
+		return err
+	}
+	// Lock the file while the entry is added so other rclones using
+	// the same file can't write in between and break the chain
+	if logFile != nil {
+		last, err := logFile.lock()
+		if err != nil {
+			return fmt.Errorf("failed to lock audit log: %w", err)
+		}
+		defer logFile.unlock()
+		// Carry on from any entries the others wrote
+		if last != nil {
+			seq, prev = last.Seq, last.Hash
+		}
+	}
+	e.Seq = seq + 1
+	e.Prev = prev
+	var err error
+	e.Hash, err = e.sum(Opt.Key)
+	if err != nil {
+		return fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+	var writeErr error
+	for _, s := range sinks {
+		if err := s.write(line); err != nil {
+			fs.Errorf(nil, "audit: failed to write %s of %q to audit log: %v", e.Action, e.Path, err)
+			if writeErr == nil {
+				writeErr = fmt.Errorf("failed to write %s of %q to audit log: %w", e.Action, e.Path, err)
+			}
+		}
+	}
+	seq, prev = e.Seq, e.Hash
+	return writeErr
+}
+
+// Pending is an entry which will be written to the audit log if the
+// action succeeds.
+//
+// A nil *Pending does nothing so the methods can be called when the
+// audit log isn't enabled.
+type Pending struct {
+	ctx   context.Context
+	entry Entry
+}
+
+// hashes returns the hashes of o which are cheap to read.
+//
+// If the hashes are slow to calculate none are returned unless
+// --audit-slow-hash is set in which case just one is, SHA-256 if
+// possible.
+func hashes(ctx context.Context, o fs.Object) map[string]string {
+	f := o.Fs()
+	if f == nil {
+		return nil
+	}
+	types := f.Hashes()
+	if f.Features().SlowHash {
+		if !Opt.SlowHash {
+			return nil
+		}
+		if types.Contains(hash.SHA256) {
+			types = hash.NewHashSet(hash.SHA256)
+		} else {
+			types = hash.NewHashSet(types.GetOne())
+		}
+	}
+	var sums map[string]string
+	for _, ht := range types.Array() {
+		sum, err := o.Hash(ctx, ht)
+		if err != nil || sum == "" {
+			continue
+		}
+		if sums == nil {
+			sums = map[string]string{}
+		}
+		sums[ht.String()] = sum
+	}
+	return sums
+}
+
+// Object starts an entry for action on o.
+//
+// Call this before doing the action so the size and hashes can be
+// read. It returns nil if the audit log isn't in use or ctx is Quiet.
+func Object(ctx context.Context, action string, o fs.Object) *Pending {
+	if !Enabled() || o == nil || isQuiet(ctx) {
+		return nil
+	}
+	return &Pending{
+		ctx: ctx,
+		entry: Entry{
+			Action: action,
+			Actor:  GetActor(ctx),
+			Remote: fs.ConfigString(o.Fs()),
+			Path:   o.Remote(),
+			Size:   o.Size(),
+			Hashes: hashes(ctx, o),
+		},
+	}
+}
+
+// Dir starts an entry for action on dir in f.
+//
+// It returns nil if the audit log isn't in use or ctx is Quiet.
+func Dir(ctx context.Context, action string, f fs.Info, dir string) *Pending {
+	if !Enabled() || isQuiet(ctx) {
+		return nil
+	}
+	return &Pending{
+		ctx: ctx,
+		entry: Entry{
+			Action: action,
+			Actor:  GetActor(ctx),
+			Remote: fs.ConfigString(f),
+			Path:   dir,
+			Size:   -1,
+		},
+	}
+}
+
+// Moved sets the destination of a move
+func (p *Pending) Moved(dst fs.Object) {
+	if p == nil || dst == nil {
+		return
+	}
+	p.entry.DstRemote = fs.ConfigString(dst.Fs())
+	p.entry.DstPath = dst.Remote()
+}
+
+// Done writes the entry to the audit log if err is nil.
+//
+// It returns err or, if the action succeeded but couldn't be
+// recorded, the error from the audit log so the caller fails rather
+// than carrying on without a record of what it did.
+func (p *Pending) Done(err error) error {
+	if p == nil || err != nil {
+		return err
+	}
+	p.entry.Time = time.Now()
+	return write(&p.entry)
+}
+
+// fileSink writes the audit log to a file
+type fileSink struct {
+	f *os.File
+}
+
+// maxLine is the largest last line openFile will look for
+const maxLine = 16 * 1024 * 1024
+
+// openFile opens the audit log file for appending returning the last
+// entry in it if there is one.
+func openFile(path string) (s *fileSink, last *Entry, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	last, err = lastEntry(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("failed to read last entry of %q: %w", path, err)
+	}
+	return &fileSink{f: f}, last, nil
+}
+
+// lastEntry reads the last entry from f
+func lastEntry(f *os.File) (*Entry, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	for n := int64(4096); ; n *= 2 {
+		if n > size {
+			n = size
+		}
+		buf := make([]byte, n)
+		_, err = f.ReadAt(buf, size-n)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		if len(buf) == 0 {
+			return nil, nil
+		}
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 && n < size {
+			if n >= maxLine {
+				return nil, errors.New("last line too long")
+			}
+			continue
+		}
+		var e Entry
+		err = json.Unmarshal(buf[i+1:], &e)
+		if err != nil {
+			return nil, err
+		}
+		return &e, nil
+	}
+}
+
+// lock takes an exclusive lock on the file, waiting for any other
+// process to finish with it, and returns its last entry.
+func (s *fileSink) lock() (last *Entry, err error) {
+	err = file.Lock(s.f)
+	if err != nil {
+		return nil, err
+	}
+	last, err = lastEntry(s.f)
+	if err != nil {
+		s.unlock()
+		return nil, fmt.Errorf("failed to read last entry: %w", err)
+	}
+	return last, nil
+}
+
+// unlock releases the lock taken by lock
+func (s *fileSink) unlock() {
+	if err := file.Unlock(s.f); err != nil {
+		fs.Errorf(nil, "audit: failed to unlock audit log: %v", err)
+	}
+}
+
+// write a line to the file
+func (s *fileSink) write(line []byte) error {
+	_, err := s.f.Write(line)
+	return err
+}
+
+// close the file
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
+
+// Verify reads an audit log from in checking the hash chain is
+// intact using key if it was written with one. It returns the number
+// of entries read.
+//
+// The log must start at the first entry and each entry after that
+// must follow on from the one before.
+func Verify(in io.Reader, key string) (n int64, err error) {
+	dec := json.NewDecoder(in)
+	var last *Entry
+	for {
+		var e Entry
+		err = dec.Decode(&e)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("entry %d: failed to decode: %w", n+1, err)
+		}
+		n++
+		sum, err := e.sum(key)
+		if err != nil {
+			return n, fmt.Errorf("entry %d: %w", n, err)
+		}
+		if !hmac.Equal([]byte(sum), []byte(e.Hash)) {
+			return n, fmt.Errorf("entry %d (seq %d) has been modified or the key is wrong: hash is %s but should be %s", n, e.Seq, e.Hash, sum)
+		}
+		if last != nil {
+			if e.Prev != last.Hash {
+				return n, fmt.Errorf("entry %d (seq %d) doesn't follow the previous entry: chain broken", n, e.Seq)
+			}
+			if e.Seq != last.Seq+1 {
+				return n, fmt.Errorf("entry %d has seq %d but should be %d: entries missing", n, e.Seq, last.Seq+1)
+			}
+		} else if e.Seq != 1 || e.Prev != "" {
+			return n, fmt.Errorf("entry %d has seq %d but the log should start the chain at seq 1: entries missing", n, e.Seq)
+		}
+		last = &e
+	}
+}
@@ -0,0 +1,211 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+
+	oldOpt := Opt
+	defer func() {
+		Opt = oldOpt
+		_ = Reload(ctx)
+	}()
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	f.(*mockfs.Fs).SetHashes(hash.NewHashSet(hash.MD5))
+	o := mockobject.New("dir/file.txt").WithContent([]byte("potato"), mockobject.SeekModeNone)
+	o.SetFs(f)
+
+	// nothing is recorded unless enabled
+	Opt = Options{}
+	assert.Nil(t, Object(ctx, ActionDelete, o))
+	require.NoError(t, Object(ctx, ActionDelete, o).Done(nil))
+
+	Opt.File = logFile
+	SetCommand("rclone test")
+	require.NoError(t, Object(ctx, ActionDelete, o).Done(nil))
+	failed := errors.New("failed")
+	assert.Equal(t, failed, Object(ctx, ActionDelete, o).Done(failed))
+	rcCtx := WithActor(ctx, Actor{Type: ActorRC, User: "ci"})
+	move := Object(CopyActor(context.Background(), rcCtx), ActionMove, o)
+	dst := mockobject.New("dir/new.txt").WithContent(nil, mockobject.SeekModeNone)
+	dst.SetFs(f)
+	move.Moved(dst)
+	require.NoError(t, move.Done(nil))
+
+	// the chain continues after a restart
+	require.NoError(t, Reload(ctx))
+	require.NoError(t, Dir(ctx, ActionRmdir, f, "dir").Done(nil))
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	n, err := Verify(bytes.NewReader(data), "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"seq":1,`)
+	assert.Contains(t, lines[0], `"action":"delete","actor":{"type":"cli","user":"`)
+	assert.Contains(t, lines[0], `"command":"rclone test"},"remote":"mock:root","path":"dir/file.txt","size":6,"hashes":{"md5":"8ee2027983915ec78acc45027d874316"},"prev":"",`)
+	assert.Contains(t, lines[1], `"actor":{"type":"rc","user":"ci","command":"rclone test"}`)
+	assert.Contains(t, lines[1], `"dstPath":"dir/new.txt"`)
+	assert.Contains(t, lines[2], `"seq":3,`)
+	assert.Contains(t, lines[2], `"action":"rmdir"`)
+	assert.Contains(t, lines[2], `"size":-1,`)
+
+	// a log missing its start isn't OK
+	_, err = Verify(strings.NewReader(lines[1]+"\n"+lines[2]+"\n"), "")
+	assert.ErrorContains(t, err, "entry 1 has seq 2 but the log should start the chain at seq 1")
+
+	// tampering is detected
+	for _, test := range []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{strings.Replace(lines[0], "file.txt", "other.txt", 1), lines[1]}, "entry 1 (seq 1) has been modified"},
+		{[]string{lines[0], lines[2]}, "entry 2 (seq 3) doesn't follow the previous entry"},
+		{[]string{lines[0], lines[0]}, "entry 2 (seq 1) doesn't follow the previous entry"},
+		{[]string{lines[1], lines[0]}, "entry 1 has seq 2 but the log should start the chain at seq 1"},
+		{[]string{lines[0], "potato"}, "entry 2: failed to decode"},
+	} {
+		_, err = Verify(strings.NewReader(strings.Join(test.lines, "\n")), "")
+		assert.ErrorContains(t, err, test.want)
+	}
+}
+
+func TestAuditLogShared(t *testing.T) {
+	ctx := context.Background()
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	oldOpt := Opt
+	defer func() {
+		Opt = oldOpt
+		_ = Reload(ctx)
+	}()
+	Opt = Options{File: logFile}
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+
+	Dir(ctx, ActionRmdir, f, "one").Done(nil)
+
+	// Another rclone appends to the log while this one has it open
+	other, last, err := openFile(logFile)
+	require.NoError(t, err)
+	e := Entry{Seq: last.Seq + 1, Action: ActionRmdir, Path: "other", Size: -1, Prev: last.Hash}
+	e.Hash, err = e.sum(Opt.Key)
+	require.NoError(t, err)
+	line, err := json.Marshal(&e)
+	require.NoError(t, err)
+	require.NoError(t, other.write(append(line, '\n')))
+	require.NoError(t, other.close())
+
+	// This rclone carries on the chain from the other's entry
+	Dir(ctx, ActionRmdir, f, "two").Done(nil)
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	n, err := Verify(bytes.NewReader(data), "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
+
+func TestAuditLogKey(t *testing.T) {
+	ctx := context.Background()
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	oldOpt := Opt
+	defer func() {
+		Opt = oldOpt
+		_ = Reload(ctx)
+	}()
+	Opt = Options{File: logFile, Key: "secret"}
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, Dir(ctx, ActionRmdir, f, "one").Done(nil))
+	require.NoError(t, Dir(ctx, ActionRmdir, f, "two").Done(nil))
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	n, err := Verify(bytes.NewReader(data), "secret")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// the wrong key or no key fails
+	_, err = Verify(bytes.NewReader(data), "wrong")
+	assert.ErrorContains(t, err, "entry 1 (seq 1) has been modified or the key is wrong")
+	_, err = Verify(bytes.NewReader(data), "")
+	assert.ErrorContains(t, err, "entry 1 (seq 1) has been modified or the key is wrong")
+
+	// an edited entry with its hashes recalculated without the key fails
+	var e Entry
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &e))
+	e.Path = "other"
+	e.Hash, err = e.sum("")
+	require.NoError(t, err)
+	line, err := json.Marshal(&e)
+	require.NoError(t, err)
+	_, err = Verify(strings.NewReader(string(line)+"\n"), "secret")
+	assert.ErrorContains(t, err, "entry 1 (seq 1) has been modified or the key is wrong")
+}
+
+func TestAuditLogQuiet(t *testing.T) {
+	ctx := context.Background()
+	oldOpt := Opt
+	defer func() {
+		Opt = oldOpt
+		_ = Reload(ctx)
+	}()
+	Opt = Options{File: filepath.Join(t.TempDir(), "audit.log")}
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	o := mockobject.New("file.txt").WithContent(nil, mockobject.SeekModeNone)
+	o.SetFs(f)
+
+	quietCtx := Quiet(ctx)
+	assert.Nil(t, Object(quietCtx, ActionDelete, o))
+	assert.Nil(t, Dir(quietCtx, ActionRmdir, f, "dir"))
+	assert.NotNil(t, Object(ctx, ActionDelete, o))
+}
+
+func TestAuditLogError(t *testing.T) {
+	ctx := context.Background()
+	oldOpt := Opt
+	defer func() {
+		Opt = oldOpt
+		_ = Reload(ctx)
+	}()
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+
+	// an action which can't be recorded returns an error
+	Opt = Options{File: filepath.Join(t.TempDir(), "missing", "audit.log")}
+	require.NoError(t, Reload(ctx))
+	err = Dir(ctx, ActionRmdir, f, "dir").Done(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open audit log")
+
+	// and keeps doing so
+	err = Dir(ctx, ActionRmdir, f, "dir").Done(nil)
+	require.Error(t, err)
+
+	// but a failed action returns its own error
+	failed := errors.New("failed")
+	assert.Equal(t, failed, Dir(ctx, ActionRmdir, f, "dir").Done(failed))
+}
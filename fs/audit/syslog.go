@@ -0,0 +1,15 @@
+// Syslog interface for non-Unix variants only
+
+//go:build windows || nacl || plan9
+
+package audit
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// openSyslog opens syslog for the audit log
+func openSyslog() (sink, error) {
+	return nil, fmt.Errorf("--audit-syslog not supported on %s platform", runtime.GOOS)
+}
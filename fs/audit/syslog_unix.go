@@ -0,0 +1,33 @@
+// Syslog interface for Unix variants only
+
+//go:build !windows && !nacl && !plan9
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+// syslogSink writes the audit log to syslog
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// openSyslog opens syslog for the audit log
+func openSyslog() (sink, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, "rclone-audit")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+// write a line to syslog
+func (s *syslogSink) write(line []byte) error {
+	return s.w.Notice(string(line))
+}
+
+// close syslog
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
@@ -161,6 +161,16 @@ var ConfigOptionsInfo = Options{{
 	Default: "hash",
 	Help:    "Strategies to use when synchronizing using track-renames hash|modtime|leaf",
 	Groups:  "Sync",
+}, {
+	Name:    "sync_journal",
+	Default: false,
+	Help:    "Record the progress of sync or copy on disk so an interrupted run can resume",
+	Groups:  "Sync",
+}, {
+	Name:    "sync_journal_max_age",
+	Default: Duration(7 * 24 * time.Hour),
+	Help:    "Discard progress in the sync journal older than this",
+	Groups:  "Sync",
 }, {
 	Name:    "retries",
 	Default: 3,
@@ -464,6 +474,11 @@ var ConfigOptionsInfo = Options{{
 	Default: SizeSuffix(64 * 1024 * 1024),
 	Help:    "Chunk size for multi-thread downloads / uploads, if not set by filesystem",
 	Groups:  "Copy",
+}, {
+	Name:    "resume_uploads",
+	Default: false,
+	Help:    "Save the progress of multipart uploads so they can be resumed if interrupted",
+	Groups:  "Copy",
 }, {
 	Name:    "use_json_log",
 	Default: false,
@@ -594,6 +609,8 @@ type ConfigInfo struct {
 	MaxDeleteSize              SizeSuffix        `config:"max_delete_size"`
 	TrackRenames               bool              `config:"track_renames"`          // Track file renames.
 	TrackRenamesStrategy       string            `config:"track_renames_strategy"` // Comma separated list of strategies used to track renames
+	SyncJournal                bool              `config:"sync_journal"`           // Record sync progress to resume interrupted syncs
+	SyncJournalMaxAge          Duration          `config:"sync_journal_max_age"`   // Discard sync journals started longer ago than this
 	Retries                    int               `config:"retries"`                // High-level retries
 	RetriesInterval            Duration          `config:"retries_sleep"`
 	LowLevelRetries            int               `config:"low_level_retries"`
@@ -656,6 +673,7 @@ type ConfigInfo struct {
 	MultiThreadSet             bool              `config:"multi_thread_set"`        // whether MultiThreadStreams was set (set in fs/config/configflags)
 	MultiThreadChunkSize       SizeSuffix        `config:"multi_thread_chunk_size"` // Chunk size for multi-thread downloads / uploads, if not set by filesystem
 	MultiThreadWriteBufferSize SizeSuffix        `config:"multi_thread_write_buffer_size"`
+	ResumeUploads              bool              `config:"resume_uploads"`
 	OrderBy                    string            `config:"order_by"` // instructions on how to order the transfer
 	UploadHeaders              []*HTTPOption     `config:"upload_headers"`
 	DownloadHeaders            []*HTTPOption     `config:"download_headers"`
@@ -715,6 +715,105 @@ func DumpRcBlob() (dump rc.Params) {
 	return dump
 }
 
+// redactedValue replaces the values of sensitive options
+const redactedValue = "XXX"
+
+// sensitiveKey normalises an option name so the backend and global
+// option names, flag names and Go field names all match
+func sensitiveKey(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// sensitiveOptions returns the normalised names of the options
+// which "rclone config redacted" redacts in any backend and the
+// global options.
+func sensitiveOptions() map[string]struct{} {
+	names := map[string]struct{}{}
+	add := func(opts fs.Options) {
+		for _, o := range opts {
+			if o.IsPassword || o.Sensitive {
+				names[sensitiveKey(o.Name)] = struct{}{}
+			}
+		}
+	}
+	for _, ri := range fs.Registry {
+		add(ri.Options)
+	}
+	for _, oi := range fs.OptionsRegistry {
+		add(oi.Options)
+	}
+	return names
+}
+
+// RedactParams returns a copy of in with the values of sensitive
+// options replaced with "XXX" for storing or showing.
+//
+// Any parameter, at any depth, named like a password or sensitive
+// option of a backend or the global options is redacted, as "rclone
+// config redacted" does, as are those options in connection strings.
+func RedactParams(in rc.Params) rc.Params {
+	return redactValue(sensitiveOptions(), in).(rc.Params)
+}
+
+// redactValue returns a copy of v with the sensitive values redacted
+func redactValue(names map[string]struct{}, v any) any {
+	redactMap := func(in map[string]any) map[string]any {
+		out := make(map[string]any, len(in))
+		for k, v := range in {
+			if _, found := names[sensitiveKey(k)]; found && v != "" && v != nil {
+				out[k] = redactedValue
+			} else {
+				out[k] = redactValue(names, v)
+			}
+		}
+		return out
+	}
+	switch x := v.(type) {
+	case rc.Params:
+		return rc.Params(redactMap(x))
+	case map[string]any:
+		return redactMap(x)
+	case []any:
+		out := make([]any, len(x))
+		for i := range x {
+			out[i] = redactValue(names, x[i])
+		}
+		return out
+	case []string:
+		out := make([]string, len(x))
+		for i := range x {
+			out[i] = redactConnectionString(names, x[i])
+		}
+		return out
+	case string:
+		return redactConnectionString(names, x)
+	}
+	return v
+}
+
+// redactConnectionString redacts the sensitive options in s if it is
+// a remote with a connection string
+func redactConnectionString(names map[string]struct{}, s string) string {
+	if !strings.Contains(s, ",") {
+		return s
+	}
+	parsed, err := fspath.Parse(s)
+	if err != nil || len(parsed.Config) == 0 {
+		return s
+	}
+	redacted := false
+	for k, v := range parsed.Config {
+		if _, found := names[sensitiveKey(k)]; found && v != "" {
+			parsed.Config[k] = redactedValue
+			redacted = true
+		}
+	}
+	if !redacted {
+		return s
+	}
+	return parsed.Name + "," + parsed.Config.String() + ":" + parsed.Path
+}
+
 // Dump dumps all the config as a JSON file
 func Dump() error {
 	dump := DumpRcBlob()
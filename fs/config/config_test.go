@@ -5,8 +5,10 @@ package config_test
 import (
 	"testing"
 
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configfile"
+	"github.com/rclone/rclone/fs/rc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +31,54 @@ func TestConfigLoad(t *testing.T) {
 	expect = []string{"type", "nounc"}
 	assert.Equal(t, expect, keys)
 }
+
+func TestRedactParams(t *testing.T) {
+	if regInfo, _ := fs.Find("config_redact_test"); regInfo == nil {
+		fs.Register(&fs.RegInfo{
+			Name: "config_redact_test",
+			Options: fs.Options{{
+				Name:      "api_key",
+				Sensitive: true,
+			}, {
+				Name:       "pass",
+				IsPassword: true,
+			}, {
+				Name: "region",
+			}},
+		})
+	}
+	in := rc.Params{
+		"srcFs":  ":config_redact_test,api_key=secret,region=eu:bucket/dir",
+		"dstFs":  "remote:dir",
+		"region": "eu",
+		"pass":   "secret",
+		"apiKey": "",
+		"_config": map[string]any{
+			"ClientPass": "secret",
+			"Transfers":  4,
+		},
+		"parameters": rc.Params{
+			"pass":   "secret",
+			"region": "us",
+		},
+		"files": []any{"file", map[string]any{"api_key": "secret"}},
+	}
+	want := rc.Params{
+		"srcFs":  ":config_redact_test,api_key='XXX',region='eu':bucket/dir",
+		"dstFs":  "remote:dir",
+		"region": "eu",
+		"pass":   "XXX",
+		"apiKey": "",
+		"_config": map[string]any{
+			"ClientPass": "XXX",
+			"Transfers":  4,
+		},
+		"parameters": rc.Params{
+			"pass":   "XXX",
+			"region": "us",
+		},
+		"files": []any{"file", map[string]any{"api_key": "XXX"}},
+	}
+	assert.Equal(t, want, config.RedactParams(in))
+	assert.Equal(t, "secret", in["pass"], "input mustn't be changed")
+}
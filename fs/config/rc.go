@@ -274,6 +274,7 @@ Parameters:
 
 - path - path to the config file to use
 `,
+		RemoteParams: map[string]string{"path": ""},
 	})
 }
 
@@ -767,6 +767,23 @@ type ChunkWriter interface {
 	Abort(ctx context.Context) error
 }
 
+// ResumableChunkWriter is an optional interface for ChunkWriter to
+// allow an upload to be carried on by a later process
+type ResumableChunkWriter interface {
+	// ResumeState returns the state of the upload so far. This
+	// must include every chunk for which WriteChunk has returned
+	// without error.
+	//
+	// Pass it to OpenChunkWriter in a ChunkWriterResumeOption to
+	// carry on with the upload.
+	ResumeState() ([]byte, error)
+
+	// Resumed returns true if the ChunkWriter is carrying on with
+	// the upload passed in a ChunkWriterResumeOption and false if
+	// it started a new upload.
+	Resumed() bool
+}
+
 // UserInfoer is an optional interface for Fs
 type UserInfoer interface {
 	// UserInfo returns info about the connected user
@@ -35,6 +35,11 @@ var OptionsInfo = fs.Options{{
 	Default: []string{},
 	Help:    "Exclude directories if filename is present",
 	Groups:  "Filter",
+}, {
+	Name:    "filter_file_name",
+	Default: "",
+	Help:    "Read gitignore style filter rules from files with this name in each directory",
+	Groups:  "Filter",
 }, {
 	Name:    "files_from",
 	Default: []string{},
@@ -143,6 +148,7 @@ type Options struct {
 	DeleteExcluded bool          `config:"delete_excluded"`
 	RulesOpt                     // embedded so we don't change the JSON API
 	ExcludeFile    []string      `config:"exclude_if_present"`
+	FilterFileName string        `config:"filter_file_name"`
 	FilesFrom      []string      `config:"files_from"`
 	FilesFromRaw   []string      `config:"files_from_raw"`
 	MetaRules      RulesOpt      `config:"metadata"`
@@ -177,10 +183,12 @@ type Filter struct {
 	fileRules   rules
 	dirRules    rules
 	metaRules   rules
-	files       FilesMap // files if filesFrom
-	dirs        FilesMap // dirs from filesFrom
-	hashFilterN uint64   // if non 0 do hash filtering
-	hashFilterK uint64   // select partition K/N
+	files       FilesMap    // files if filesFrom
+	dirs        FilesMap    // dirs from filesFrom
+	hashFilterN uint64      // if non 0 do hash filtering
+	hashFilterK uint64      // select partition K/N
+	dirFilters  *dirFilters // rules from --filter-file-name if set
+	filterFs    fs.Fs       // if set read the filter files from here
 }
 
 // NewFilter parses the command line options and creates a Filter
@@ -215,6 +223,14 @@ func NewFilter(opt *Options) (f *Filter, err error) {
 		fs.Debugf(nil, "Using --hash-filter %d/%d", f.hashFilterK, f.hashFilterN)
 	}
 
+	if f.Opt.FilterFileName != "" {
+		if strings.ContainsRune(f.Opt.FilterFileName, '/') {
+			return nil, fmt.Errorf("filter: --filter-file-name %q must not contain a /", f.Opt.FilterFileName)
+		}
+		f.dirFilters = newDirFilters(f.Opt.FilterFileName, f.Opt.IgnoreCase)
+		fs.Debugf(nil, "Reading filter rules from %q files", f.Opt.FilterFileName)
+	}
+
 	err = parseRules(&f.Opt.RulesOpt, f.Add, f.Clear)
 	if err != nil {
 		return nil, err
@@ -414,6 +430,7 @@ func (f *Filter) InActive() bool {
 		f.dirRules.len() == 0 &&
 		f.metaRules.len() == 0 &&
 		len(f.Opt.ExcludeFile) == 0 &&
+		f.Opt.FilterFileName == "" &&
 		f.hashFilterN == 0)
 }
 
@@ -474,6 +491,15 @@ func (f *Filter) IncludeDirectory(ctx context.Context, fs fs.Fs) func(string) (b
 			return false, nil
 		}
 
+		// then the rules from the filter files in the parent
+		// directories
+		if f.dirFilters != nil {
+			include, err := f.dirFilters.include(ctx, f.filterFileFs(fs), remote, true)
+			if err != nil || !include {
+				return false, err
+			}
+		}
+
 		// filesFrom takes precedence
 		if f.files != nil {
 			_, include := f.dirs[remote]
@@ -484,6 +510,30 @@ func (f *Filter) IncludeDirectory(ctx context.Context, fs fs.Fs) func(string) (b
 	}
 }
 
+// UsesFilterFiles returns true if rules are read from the filter
+// files set with --filter-file-name.
+func (f *Filter) UsesFilterFiles() bool {
+	return f.dirFilters != nil
+}
+
+// SetFilterFileFs makes the filter read the --filter-file-name files
+// from fremote whichever Fs is being filtered.
+//
+// This is used by sync so the destination is filtered with the rules
+// from the source, the same as the other filter flags.
+func (f *Filter) SetFilterFileFs(fremote fs.Fs) {
+	f.filterFs = fremote
+}
+
+// filterFileFs returns the Fs to read the filter files from when
+// filtering fremote
+func (f *Filter) filterFileFs(fremote fs.Fs) fs.Fs {
+	if f.filterFs != nil {
+		return f.filterFs
+	}
+	return fremote
+}
+
 // DirContainsExcludeFile checks if exclude file is present in a
 // directory. If fs is nil, it works properly if ExcludeFile is an
 // empty string (for testing).
@@ -572,7 +622,25 @@ func (f *Filter) IncludeObject(ctx context.Context, o fs.Object) bool {
 		}
 
 	}
-	return f.Include(o.Remote(), o.Size(), modTime, metadata)
+	if !f.Include(o.Remote(), o.Size(), modTime, metadata) {
+		return false
+	}
+	if f.dirFilters != nil {
+		if fremote, ok := o.Fs().(fs.Fs); ok {
+			include, err := f.dirFilters.include(ctx, f.filterFileFs(fremote), o.Remote(), false)
+			if err != nil {
+				// Exclude the object and count the error so a
+				// sync won't delete files it can't filter
+				err = fs.CountError(ctx, err)
+				fs.Errorf(o, "Excluded as failed to read filter file: %v", err)
+				return false
+			} else if !include {
+				fs.Debugf(o, "Excluded (Filter File)")
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // DumpFilters dumps the filters in textual form, 1 per line
@@ -590,6 +658,9 @@ func (f *Filter) DumpFilters() string {
 	if f.Opt.MaxSize >= 0 {
 		rules = append(rules, fmt.Sprintf("Maximum size is: %s", f.Opt.MaxSize.ByteUnit()))
 	}
+	if f.Opt.FilterFileName != "" {
+		rules = append(rules, fmt.Sprintf("Filter rules are read from: %s", f.Opt.FilterFileName))
+	}
 	rules = append(rules, "--- File filter rules ---")
 	for _, rule := range f.fileRules.rules {
 		rules = append(rules, rule.String())
@@ -0,0 +1,302 @@
+// Per directory filter files with gitignore semantics
+
+package filter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// How long the rules read from a filter file are used before it is
+// read again
+const filterFileCacheTime = time.Minute
+
+// The most directories to cache the rules for. If there are more then
+// some are discarded and read again when needed.
+const filterFileCacheSize = 10000
+
+// ignoreRule is one line of a filter file
+type ignoreRule struct {
+	Include bool           // set if the line was negated with !
+	DirOnly bool           // set if the line only matches directories
+	Regexp  *regexp.Regexp // matches paths relative to the filter file
+}
+
+// dirFilter holds the rules read from the filter file in a directory
+type dirFilter struct {
+	once  sync.Once
+	read  time.Time    // when the rules were read - protected by dirFilters.mu
+	rules []ignoreRule // rules in file order - nil if no file
+	err   error        // error reading the rules
+}
+
+// match returns whether any rule matches the relative path and if
+// so whether that rule excludes it. The last matching rule wins.
+func (d *dirFilter) match(relative string, isDir bool) (matched, exclude bool) {
+	for i := len(d.rules) - 1; i >= 0; i-- {
+		rule := &d.rules[i]
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		if rule.Regexp.MatchString(relative) {
+			return true, !rule.Include
+		}
+	}
+	return false, false
+}
+
+// dirFilters reads and caches the filter files in each directory
+type dirFilters struct {
+	name       string // name of the filter file
+	ignoreCase bool
+	mu         sync.Mutex
+	cache      map[string]*dirFilter // keyed on Fs and directory
+	swept      time.Time             // when expired rules were last removed from the cache
+}
+
+func newDirFilters(name string, ignoreCase bool) *dirFilters {
+	return &dirFilters{
+		name:       name,
+		ignoreCase: ignoreCase,
+		cache:      make(map[string]*dirFilter),
+	}
+}
+
+// get returns the rules for dir in fremote, reading them if necessary
+func (d *dirFilters) get(ctx context.Context, fremote fs.Fs, dir string) (*dirFilter, error) {
+	key := fs.ConfigString(fremote) + "\x00" + dir
+	d.mu.Lock()
+	df := d.cache[key]
+	if df == nil || (!df.read.IsZero() && time.Since(df.read) >= filterFileCacheTime) {
+		d._evict()
+		df = &dirFilter{}
+		d.cache[key] = df
+	}
+	d.mu.Unlock()
+	df.once.Do(func() {
+		df.rules, df.err = d.read(ctx, fremote, path.Join(dir, d.name))
+		d.mu.Lock()
+		df.read = time.Now()
+		d.mu.Unlock()
+	})
+	return df, df.err
+}
+
+// _evict removes the expired rules from the cache every
+// filterFileCacheTime, and if it is still full removes some more.
+//
+// call with mu held
+func (d *dirFilters) _evict() {
+	now := time.Now()
+	if now.Sub(d.swept) >= filterFileCacheTime {
+		d.swept = now
+		for key, df := range d.cache {
+			if !df.read.IsZero() && now.Sub(df.read) >= filterFileCacheTime {
+				delete(d.cache, key)
+			}
+		}
+	}
+	for key := range d.cache {
+		if len(d.cache) < filterFileCacheSize {
+			break
+		}
+		delete(d.cache, key)
+	}
+}
+
+// read the rules from the filter file at remote returning nil if
+// there isn't one
+func (d *dirFilters) read(ctx context.Context, fremote fs.Fs, remote string) (rules []ignoreRule, err error) {
+	o, err := fremote.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) || errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find filter file %q: %w", remote, err)
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open filter file %q: %w", remote, err)
+	}
+	defer fs.CheckClose(in, &err)
+	scanner := bufio.NewScanner(in)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		rule, ok, err := parseIgnoreRule(scanner.Text(), d.ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("filter file %q line %d: %w", remote, lineNumber, err)
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read filter file %q: %w", remote, err)
+	}
+	fs.Debugf(fremote, "Read %d rules from filter file %q", len(rules), remote)
+	if rules == nil {
+		rules = []ignoreRule{}
+	}
+	return rules, nil
+}
+
+// include checks remote and all its parent directories against the
+// filter files in the directories above them, returning false if any
+// are excluded.
+//
+// The filter file nearest to a path takes precedence, as does the
+// last matching line in a file.
+func (d *dirFilters) include(ctx context.Context, fremote fs.Fs, remote string, isDir bool) (bool, error) {
+	if remote == "" {
+		return true, nil
+	}
+	parts := strings.Split(remote, "/")
+	for i := 1; i <= len(parts); i++ {
+		isDirPart := isDir || i < len(parts)
+		for j := i - 1; j >= 0; j-- {
+			df, err := d.get(ctx, fremote, strings.Join(parts[:j], "/"))
+			if err != nil {
+				return false, err
+			}
+			matched, exclude := df.match(strings.Join(parts[j:i], "/"), isDirPart)
+			if matched {
+				if exclude {
+					return false, nil
+				}
+				break
+			}
+		}
+	}
+	return true, nil
+}
+
+// parseIgnoreRule parses a line of a filter file, returning ok false
+// for blank lines and comments.
+//
+// The syntax is the same as .gitignore files
+func parseIgnoreRule(line string, ignoreCase bool) (rule ignoreRule, ok bool, err error) {
+	// Trailing spaces are ignored unless escaped
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return rule, false, nil
+	}
+	if line[0] == '!' {
+		rule.Include = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false, nil
+	}
+	rule.Regexp, err = gitignoreToRegexp(line, ignoreCase)
+	if err != nil {
+		return rule, false, err
+	}
+	return rule, true, nil
+}
+
+// gitignoreToRegexp converts a gitignore pattern to a regexp
+// matching paths relative to the directory of the filter file.
+//
+// A pattern with a / at the start or in the middle is anchored to
+// the directory of the filter file, otherwise it matches at any
+// level. * and ? don't match /, a leading **/ matches in all
+// directories, a trailing /** matches everything inside and /**/
+// matches zero or more directories.
+func gitignoreToRegexp(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	var re strings.Builder
+	if ignoreCase {
+		re.WriteString("(?i)")
+	}
+	re.WriteString("^")
+	if strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	} else if !strings.Contains(pattern, "/") {
+		re.WriteString("(?:.*/)?")
+	}
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				re.WriteString(".*")
+			} else {
+				re.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		if err := globSegmentToRegexp(&re, segment); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		if !last {
+			re.WriteString("/")
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// globSegmentToRegexp converts a glob for a single path segment
+func globSegmentToRegexp(re *strings.Builder, segment string) error {
+	runes := []rune(segment)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '\\':
+			i++
+			if i >= len(runes) {
+				return errors.New("trailing backslash")
+			}
+			re.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '*':
+			// consecutive stars which aren't a whole segment are like one
+			for i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+			}
+			re.WriteString("[^/]*")
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := i + 1
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return errors.New("mismatched '['")
+			}
+			class := runes[i+1 : end]
+			re.WriteString("[")
+			if len(class) > 0 && class[0] == '!' {
+				re.WriteString("^")
+				class = class[1:]
+			}
+			re.WriteString(strings.ReplaceAll(string(class), `\`, `\\`))
+			re.WriteString("]")
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitignoreToRegexp(t *testing.T) {
+	for _, test := range []struct {
+		pattern    string
+		ignoreCase bool
+		want       string
+	}{
+		{"*.log", false, `^(?:.*/)?[^/]*\.log$`},
+		{"*.log", true, `(?i)^(?:.*/)?[^/]*\.log$`},
+		{"/build", false, `^build$`},
+		{"doc/*.txt", false, `^doc/[^/]*\.txt$`},
+		{"**/foo", false, `^(?:.*/)?foo$`},
+		{"**/foo/bar", false, `^(?:.*/)?foo/bar$`},
+		{"abc/**", false, `^abc/.*$`},
+		{"a/**/b", false, `^a/(?:.*/)?b$`},
+		{"file?.[ch]", false, `^(?:.*/)?file[^/]\.[ch]$`},
+		{"[!a-c]x", false, `^(?:.*/)?[^a-c]x$`},
+		{"a**b", false, `^(?:.*/)?a[^/]*b$`},
+		{`\*star`, false, `^(?:.*/)?\*star$`},
+		{"[abc", false, ""},
+		{`trailing\`, false, ""},
+	} {
+		re, err := gitignoreToRegexp(test.pattern, test.ignoreCase)
+		if test.want == "" {
+			assert.Error(t, err, test.pattern)
+			continue
+		}
+		require.NoError(t, err, test.pattern)
+		assert.Equal(t, test.want, re.String(), test.pattern)
+	}
+}
+
+func TestParseIgnoreRule(t *testing.T) {
+	for _, test := range []struct {
+		line    string
+		ok      bool
+		include bool
+		dirOnly bool
+		re      string
+	}{
+		{"", false, false, false, ""},
+		{"   ", false, false, false, ""},
+		{"# comment", false, false, false, ""},
+		{`\#hash`, true, false, false, `^(?:.*/)?#hash$`},
+		{"!keep", true, true, false, `^(?:.*/)?keep$`},
+		{`\!bang`, true, false, false, `^(?:.*/)?!bang$`},
+		{"dir/", true, false, true, `^(?:.*/)?dir$`},
+		{"/dir/sub/", true, false, true, `^dir/sub$`},
+		{"space  ", true, false, false, `^(?:.*/)?space$`},
+		{`space\ `, true, false, false, `^(?:.*/)?space $`},
+		{"crlf\r", true, false, false, `^(?:.*/)?crlf$`},
+	} {
+		rule, ok, err := parseIgnoreRule(test.line, false)
+		require.NoError(t, err, test.line)
+		assert.Equal(t, test.ok, ok, test.line)
+		if !ok {
+			continue
+		}
+		assert.Equal(t, test.include, rule.Include, test.line)
+		assert.Equal(t, test.dirOnly, rule.DirOnly, test.line)
+		assert.Equal(t, test.re, rule.Regexp.String(), test.line)
+	}
+}
+
+// filterFileFs is a mock Fs which can find objects in subdirectories
+type filterFileFs struct {
+	*mockfs.Fs
+	objects map[string]fs.Object
+}
+
+func (f *filterFileFs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if o, ok := f.objects[remote]; ok {
+		return o, nil
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+func (f *filterFileFs) add(remote, content string) fs.Object {
+	o := mockobject.New(remote).WithContent([]byte(content), mockobject.SeekModeNone)
+	o.SetFs(f)
+	f.objects[remote] = o
+	return o
+}
+
+func TestFilterFileName(t *testing.T) {
+	ctx := context.Background()
+	mf, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	f := &filterFileFs{Fs: mf.(*mockfs.Fs), objects: map[string]fs.Object{}}
+	f.add(".rcloneignore", `
+# top level rules
+*.log
+!keep.log
+/build/
+tmp/
+docs/**/*.bak
+`)
+	f.add("dir/.rcloneignore", `
+!*.log
+secret
+`)
+
+	opt := Opt
+	opt.FilterFileName = ".rcloneignore"
+	fi, err := NewFilter(&opt)
+	require.NoError(t, err)
+	assert.False(t, fi.InActive())
+	assert.Contains(t, fi.DumpFilters(), "Filter rules are read from: .rcloneignore")
+
+	includeDirectory := fi.IncludeDirectory(ctx, f)
+	for _, test := range []struct {
+		dir  string
+		want bool
+	}{
+		{"", true},
+		{"dir", true},
+		{"build", false},
+		{"dir/build", true},
+		{"tmp", false},
+		{"dir/tmp", false},
+		{"dir/tmp/deeper", false},
+		{"dir/secret", false},
+		{"docs", true},
+	} {
+		got, err := includeDirectory(test.dir)
+		require.NoError(t, err, test.dir)
+		assert.Equal(t, test.want, got, test.dir)
+	}
+
+	for _, test := range []struct {
+		remote string
+		want   bool
+	}{
+		{".rcloneignore", true},
+		{"file.txt", true},
+		{"file.log", false},
+		{"keep.log", true},
+		{"sub/file.log", false},
+		{"sub/keep.log", true},
+		{"build/file.txt", false},
+		{"dir/file.log", true},
+		{"dir/secret", false},
+		{"dir/tmp/file.txt", false},
+		{"dir/sub/file.log", true},
+		{"docs/a.bak", false},
+		{"docs/x/y/a.bak", false},
+		{"docs/x/y/a.txt", true},
+		{"other/docs/a.bak", true},
+	} {
+		o := mockobject.New(test.remote).WithContent(nil, mockobject.SeekModeNone)
+		o.SetFs(f)
+		assert.Equal(t, test.want, fi.IncludeObject(ctx, o), test.remote)
+	}
+}
+
+func TestFilterFileNameBad(t *testing.T) {
+	opt := Opt
+	opt.FilterFileName = "dir/.rcloneignore"
+	_, err := NewFilter(&opt)
+	assert.ErrorContains(t, err, "must not contain a /")
+
+	opt = Opt
+	opt.FilterFileName = ".rcloneignore"
+	opt.FilesFrom = []string{"files"}
+	_, err = NewFilter(&opt)
+	assert.ErrorContains(t, err, "--files-from")
+}
+
+func TestFilterFileNameError(t *testing.T) {
+	ctx := context.Background()
+	mf, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	f := &filterFileFs{Fs: mf.(*mockfs.Fs), objects: map[string]fs.Object{}}
+	f.add("dir/.rcloneignore", "bad\\\n")
+
+	opt := Opt
+	opt.FilterFileName = ".rcloneignore"
+	fi, err := NewFilter(&opt)
+	require.NoError(t, err)
+
+	// Objects under an unreadable filter file are excluded
+	for _, test := range []struct {
+		remote string
+		want   bool
+	}{
+		{"file.txt", true},
+		{"dir/file.txt", false},
+		{"dir/sub/file.txt", false},
+	} {
+		o := mockobject.New(test.remote).WithContent(nil, mockobject.SeekModeNone)
+		o.SetFs(f)
+		assert.Equal(t, test.want, fi.IncludeObject(ctx, o), test.remote)
+	}
+}
+
+func TestDirFiltersEvict(t *testing.T) {
+	d := newDirFilters(".rcloneignore", false)
+	expired := time.Now().Add(-filterFileCacheTime)
+	d.cache["old"] = &dirFilter{read: expired}
+	d.cache["new"] = &dirFilter{read: time.Now()}
+	d.cache["reading"] = &dirFilter{}
+
+	d._evict()
+	assert.Equal(t, []string{"new", "reading"}, slices.Sorted(maps.Keys(d.cache)))
+
+	for i := range filterFileCacheSize {
+		d.cache[fmt.Sprint(i)] = &dirFilter{read: time.Now()}
+	}
+	d._evict()
+	assert.Less(t, len(d.cache), filterFileCacheSize)
+}
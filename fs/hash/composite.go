@@ -0,0 +1,121 @@
+package hash
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Composite describes a composite hash of an object.
+//
+// This is made by splitting the data into chunks of ChunkSize bytes,
+// hashing each chunk, then hashing the concatenated binary hashes of
+// the chunks. This is how S3 makes the ETag of multipart uploads and
+// its composite checksums.
+type Composite struct {
+	Type      Type   // hash used for the chunks and the result
+	ChunkSize int64  // size of each chunk except the last
+	Sum       string // lower case hex hash followed by "-" and the number of chunks
+}
+
+// String returns a description of the composite hash
+func (c *Composite) String() string {
+	return fmt.Sprintf("%v composite with %d byte chunks %s", c.Type, c.ChunkSize, c.Sum)
+}
+
+// Parts returns the number of chunks in c.Sum or 0 if it can't be
+// read.
+func (c *Composite) Parts() int64 {
+	i := strings.LastIndexByte(c.Sum, '-')
+	if i < 0 {
+		return 0
+	}
+	parts, err := strconv.ParseInt(c.Sum[i+1:], 10, 64)
+	if err != nil || parts < 0 {
+		return 0
+	}
+	return parts
+}
+
+// Stream calculates the composite hash of the data read from r using
+// the Type and ChunkSize of c, returning it in the same form as
+// c.Sum.
+func (c *Composite) Stream(r io.Reader) (string, error) {
+	h, err := NewCompositeHasher(c.Type, c.ChunkSize)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	return h.Sum(), nil
+}
+
+// CompositeHasher calculates a composite hash of the data written to
+// it.
+type CompositeHasher struct {
+	hashType  Type
+	chunkSize int64
+	chunk     hash.Hash // hash of the current chunk
+	n         int64     // bytes written to the current chunk
+	sums      hash.Hash // hash of the chunk hashes
+	parts     int64     // number of chunks finished
+}
+
+// NewCompositeHasher makes a CompositeHasher for hashType with chunks
+// of chunkSize bytes.
+func NewCompositeHasher(hashType Type, chunkSize int64) (*CompositeHasher, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("composite hash: chunk size must be positive")
+	}
+	def := type2hash[hashType]
+	if def == nil {
+		return nil, fmt.Errorf("composite hash: unsupported hash type %v", hashType)
+	}
+	return &CompositeHasher{
+		hashType:  hashType,
+		chunkSize: chunkSize,
+		chunk:     def.newFunc(),
+		sums:      def.newFunc(),
+	}, nil
+}
+
+// Write data to the hasher
+func (h *CompositeHasher) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		toWrite := min(int64(len(p)), h.chunkSize-h.n)
+		_, _ = h.chunk.Write(p[:toWrite])
+		h.n += toWrite
+		n += int(toWrite)
+		p = p[toWrite:]
+		if h.n == h.chunkSize {
+			h.finishChunk()
+		}
+	}
+	return n, nil
+}
+
+// finishChunk adds the hash of the current chunk to the sums and
+// starts a new chunk.
+func (h *CompositeHasher) finishChunk() {
+	_, _ = h.sums.Write(h.chunk.Sum(nil))
+	h.chunk.Reset()
+	h.n = 0
+	h.parts++
+}
+
+// Sum returns the composite hash of the data written so far as lower
+// case hex followed by "-" and the number of chunks.
+//
+// It should only be called once all the data has been written.
+func (h *CompositeHasher) Sum() string {
+	if h.n > 0 || h.parts == 0 {
+		h.finishChunk()
+	}
+	return hex.EncodeToString(h.sums.Sum(nil)) + "-" + strconv.FormatInt(h.parts, 10)
+}
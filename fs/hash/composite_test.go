@@ -0,0 +1,106 @@
+package hash_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compositeMD5 calculates the multipart ETag S3 would give data
+// uploaded in chunkSize parts
+func compositeMD5(data []byte, chunkSize int) string {
+	var sums []byte
+	parts := 0
+	for len(data) > 0 || parts == 0 {
+		n := min(chunkSize, len(data))
+		sum := md5.Sum(data[:n])
+		sums = append(sums, sum[:]...)
+		data = data[n:]
+		parts++
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts)
+}
+
+func TestCompositeHasher(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 100) // 1600 bytes
+	for _, test := range []struct {
+		size      int
+		chunkSize int
+		parts     string
+	}{
+		{size: 0, chunkSize: 100, parts: "-1"},
+		{size: 1, chunkSize: 100, parts: "-1"},
+		{size: 100, chunkSize: 100, parts: "-1"},
+		{size: 101, chunkSize: 100, parts: "-2"},
+		{size: 1600, chunkSize: 100, parts: "-16"},
+		{size: 1600, chunkSize: 7, parts: "-229"},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", test.size, test.chunkSize), func(t *testing.T) {
+			c := hash.Composite{Type: hash.MD5, ChunkSize: int64(test.chunkSize)}
+			got, err := c.Stream(bytes.NewReader(data[:test.size]))
+			require.NoError(t, err)
+			assert.Equal(t, compositeMD5(data[:test.size], test.chunkSize), got)
+			assert.Contains(t, got, test.parts)
+
+			// Check writing in odd sized pieces gives the same result
+			h, err := hash.NewCompositeHasher(hash.MD5, int64(test.chunkSize))
+			require.NoError(t, err)
+			for p := data[:test.size]; len(p) > 0; {
+				n := min(13, len(p))
+				_, err = h.Write(p[:n])
+				require.NoError(t, err)
+				p = p[n:]
+			}
+			assert.Equal(t, got, h.Sum())
+		})
+	}
+}
+
+func TestCompositeHasherCRC32C(t *testing.T) {
+	// The composite CRC-32C is the CRC-32C of the big endian CRC-32Cs of the parts
+	table := crc32.MakeTable(crc32.Castagnoli)
+	data := []byte("hello world")
+	part1 := crc32.Checksum(data[:6], table)
+	part2 := crc32.Checksum(data[6:], table)
+	want := crc32.Checksum([]byte{
+		byte(part1 >> 24), byte(part1 >> 16), byte(part1 >> 8), byte(part1),
+		byte(part2 >> 24), byte(part2 >> 16), byte(part2 >> 8), byte(part2),
+	}, table)
+
+	c := hash.Composite{Type: hash.CRC32C, ChunkSize: 6}
+	got, err := c.Stream(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%08x-2", want), got)
+}
+
+func TestCompositeHasherErrors(t *testing.T) {
+	_, err := hash.NewCompositeHasher(hash.MD5, 0)
+	assert.ErrorContains(t, err, "chunk size")
+	_, err = hash.NewCompositeHasher(hash.None, 100)
+	assert.ErrorContains(t, err, "unsupported hash type")
+}
+
+func TestCompositeParts(t *testing.T) {
+	for _, test := range []struct {
+		sum  string
+		want int64
+	}{
+		{"", 0},
+		{"d41d8cd98f00b204e9800998ecf8427e", 0},
+		{"d41d8cd98f00b204e9800998ecf8427e-", 0},
+		{"d41d8cd98f00b204e9800998ecf8427e-x", 0},
+		{"d41d8cd98f00b204e9800998ecf8427e-1", 1},
+		{"d41d8cd98f00b204e9800998ecf8427e-10000", 10000},
+	} {
+		c := hash.Composite{Sum: test.sum}
+		assert.Equal(t, test.want, c.Parts(), test.sum)
+	}
+}
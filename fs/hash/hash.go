@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha3"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
@@ -12,6 +13,7 @@ import (
 	"fmt"
 	"hash"
 	"hash/crc32"
+	"hash/crc64"
 	"io"
 	"strings"
 
@@ -102,6 +104,20 @@ var (
 
 	// XXH128 indicates XXH128 support, also known as XXH3-128, a variant of xxHash
 	XXH128 Type
+
+	// CRC32C indicates CRC-32C support, the Castagnoli variant of CRC-32
+	CRC32C Type
+
+	// CRC64NVME indicates CRC-64/NVME support, also used by Azure as CRC64
+	CRC64NVME Type
+
+	// SHA3256 indicates SHA3-256 support
+	SHA3256 Type
+)
+
+var (
+	crc32cTable    = crc32.MakeTable(crc32.Castagnoli)
+	crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
 )
 
 type xxh128Hasher struct {
@@ -124,6 +140,9 @@ func init() {
 	BLAKE3 = RegisterHash("blake3", "BLAKE3", 64, func() hash.Hash { return blake3.New() })
 	XXH3 = RegisterHash("xxh3", "XXH3", 16, func() hash.Hash { return xxh3.New() })
 	XXH128 = RegisterHash("xxh128", "XXH128", 32, func() hash.Hash { return &xxh128Hasher{} })
+	CRC32C = RegisterHash("crc32c", "CRC-32C", 8, func() hash.Hash { return crc32.New(crc32cTable) })
+	CRC64NVME = RegisterHash("crc64nvme", "CRC-64/NVME", 16, func() hash.Hash { return crc64.New(crc64NVMETable) })
+	SHA3256 = RegisterHash("sha3-256", "SHA3-256", 64, func() hash.Hash { return sha3.New256() })
 }
 
 // Supported returns a set of all the supported hashes by
@@ -58,6 +58,16 @@ type Marcher interface {
 	Match(ctx context.Context, dst, src fs.DirEntry) (recurse bool)
 }
 
+// DirMarcher is an optional interface for a Marcher which wants to
+// know when all the entries in a source directory have been processed
+type DirMarcher interface {
+	// DirDone is called when all the entries in the source
+	// directory dir have been passed to the Marcher. subdirs are
+	// the source directories which will be recursed into and err
+	// is any error listing dir.
+	DirDone(dir string, subdirs []string, err error)
+}
+
 // init sets up a march over opt.Fsrc, and opt.Fdst calling back callback for each match
 // Note: this will flag filter-aware backends on the source side
 func (m *March) init(ctx context.Context) {
@@ -92,7 +102,7 @@ func (m *March) srcOrDstKey(entry fs.DirEntry, isSrc bool) string {
 	name := path.Base(entry.Remote())
 	_, isDirectory := entry.(fs.Directory)
 	if isSrc {
-		name = transform.Path(m.Ctx, name, isDirectory)
+		name = transform.Leaf(m.Ctx, entry, isDirectory)
 	}
 	for _, transform := range m.transforms {
 		name = transform(name)
@@ -215,6 +225,15 @@ func (m *March) Run(ctx context.Context) error {
 						return
 					}
 					jobs, err := m.processJob(job)
+					if dirMarcher, ok := m.Callback.(DirMarcher); ok && !job.noSrc {
+						var subdirs []string
+						for _, newJob := range jobs {
+							if !newJob.noSrc {
+								subdirs = append(subdirs, newJob.srcRemote)
+							}
+						}
+						dirMarcher.DirDone(job.srcRemote, subdirs, err)
+					}
 					if err != nil {
 						mu.Lock()
 						// Keep reference only to the first encountered error
@@ -306,6 +306,41 @@ func (o *ChunkOption) String() string {
 	return fmt.Sprintf("ChunkOption(%v)", o.ChunkSize)
 }
 
+// ChunkWriterResumeOption asks OpenChunkWriter to carry on with the
+// upload whose state was returned by ResumableChunkWriter.ResumeState
+// rather than starting a new one.
+//
+// Backends which can't resume the upload should ignore it.
+type ChunkWriterResumeOption struct {
+	State []byte
+}
+
+// Header formats the option as an http header
+func (o *ChunkWriterResumeOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *ChunkWriterResumeOption) Mandatory() bool {
+	return false
+}
+
+// String formats the option into human-readable form
+func (o *ChunkWriterResumeOption) String() string {
+	return fmt.Sprintf("ChunkWriterResumeOption(%d bytes)", len(o.State))
+}
+
+// ChunkWriterResumeState returns the state from the first
+// ChunkWriterResumeOption in options or nil if there isn't one
+func ChunkWriterResumeState(options []OpenOption) []byte {
+	for _, option := range options {
+		if o, ok := option.(*ChunkWriterResumeOption); ok {
+			return o.State
+		}
+	}
+	return nil
+}
+
 // OpenOptionAddHeaders adds each header found in options to the
 // headers map provided the key was non empty.
 func OpenOptionAddHeaders(options []OpenOption, headers map[string]string) {
@@ -17,6 +17,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/atexit"
@@ -402,7 +403,7 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 		f:           f,
 		dstFeatures: f.Features(),
 		dst:         dst,
-		remote:      transform.Path(ctx, remote, false),
+		remote:      transform.PathInfo(ctx, remote, false, src),
 		src:         src,
 		ci:          ci,
 		tr:          tr,
@@ -410,8 +411,10 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 		doUpdate:    dst != nil,
 	}
 	c.hashType, c.hashOption = CommonHash(ctx, f, src.Fs())
-	if c.dst != nil {
-		c.remote = transform.Path(ctx, c.dst.Remote(), false)
+	if c.dst != nil && c.dst.Remote() != c.remote {
+		// dst is already at the transformed name if it was matched
+		// with src after transforming
+		c.remote = transform.PathInfo(ctx, c.dst.Remote(), false, src)
 	}
 	// Are we using partials?
 	//
@@ -420,8 +423,12 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 	if err != nil {
 		return nil, err
 	}
+	// Record overwriting the destination
+	entry := audit.Object(ctx, audit.ActionOverwrite, c.dst)
 	// Do the copy now everything is set up
-	return c.copy(ctx)
+	newDst, err = c.copy(ctx)
+	err = entry.Done(err)
+	return newDst, err
 }
 
 // CopyFile moves a single file possibly to a new name
@@ -154,17 +154,18 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: can't copy zero sized file")
 	}
 
-	info, chunkWriter, err := openChunkWriter(ctx, remote, src, options...)
+	info, chunkWriter, resumer, err := multipart.OpenResumable(ctx, f, openChunkWriter, remote, src, options...)
 	if err != nil {
 		return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
 	}
+	defer func() { resumer.Finish(err) }()
 
 	uploadCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	uploadedOK := false
 	defer atexit.OnError(&err, func() {
 		cancel()
-		if info.LeavePartsOnError || uploadedOK {
+		if info.LeavePartsOnError || uploadedOK || resumer.LeaveParts() {
 			return
 		}
 		fs.Debugf(src, "multi-thread copy: cancelling transfer on exit")
@@ -224,6 +225,11 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		}
 		end := min(start+mc.partSize, mc.size)
 		size := end - start
+		if resumer.IsDone(chunk) {
+			fs.Debugf(src, "multi-thread copy: chunk %d/%d (%d-%d) size %v already written", chunk+1, mc.numChunks, start, end, fs.SizeSuffix(size))
+			mc.acc.AccountReadNoNetwork(size)
+			continue
+		}
 
 		// Reserve the memory first so we don't open the source and wait for memory buffers for ages
 		// This also avoids creating an excess of goroutines all waiting on memory.
@@ -233,7 +239,11 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		}
 
 		g.Go(func() error {
-			return mc.copyChunk(gCtx, chunk, chunkWriter, start, end, size, rw)
+			err := mc.copyChunk(gCtx, chunk, chunkWriter, start, end, size, rw)
+			if err == nil {
+				resumer.ChunkDone(chunk)
+			}
+			return err
 		})
 	}
 
@@ -243,9 +253,11 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 	}
 	err = chunkWriter.Close(ctx)
 	if err != nil {
+		resumer.Discard()
 		return nil, fmt.Errorf("multi-thread copy: failed to close object after copy: %w", err)
 	}
 	uploadedOK = true // file is definitely uploaded OK so no need to abort
+	resumer.Discard() // or to resume
 
 	obj, err := f.NewObject(ctx, remote)
 	if err != nil {
@@ -26,6 +26,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/filter"
@@ -54,19 +55,78 @@ import (
 // hash - the HashType. This is HashNone if either of the hashes were
 // unset or a compatible hash couldn't be found.
 //
-// err - may return an error which will already have been logged
+// err - may return an error which will already have been logged.
+// When an error is returned equal will be false.
 //
-// If an error is returned it will return equal as false
+// If there is no common hash, but one of the objects has a composite
+// hash, such as the ETag of an S3 multipart upload, and the other is
+// on the local disk, then the composite hash is calculated from the
+// local object and compared.
 func CheckHashes(ctx context.Context, src fs.ObjectInfo, dst fs.Object) (equal bool, ht hash.Type, err error) {
 	common := src.Fs().Hashes().Overlap(dst.Fs().Hashes())
 	// fs.Debugf(nil, "Shared hashes: %v", common)
 	if common.Count() == 0 {
-		return true, hash.None, nil
+		return checkCompositeHashes(ctx, src, dst)
 	}
 	equal, ht, _, _, err = checkHashes(ctx, src, dst, common.GetOne())
+	if err == nil && ht == hash.None {
+		return checkCompositeHashes(ctx, src, dst)
+	}
 	return equal, ht, err
 }
 
+// checkCompositeHashes compares the composite hash of src or dst
+// with the composite hash calculated from the other one if it is on
+// the local disk.
+//
+// It returns hash.None as the hash type if this wasn't possible.
+func checkCompositeHashes(ctx context.Context, src fs.ObjectInfo, dst fs.Object) (equal bool, ht hash.Type, err error) {
+	var (
+		remote fs.CompositeHasher
+		local  fs.Object
+	)
+	srcObj, srcIsObj := src.(fs.Object)
+	if c, ok := dst.(fs.CompositeHasher); ok && srcIsObj && src.Fs().Features().IsLocal {
+		remote, local = c, srcObj
+	} else if c, ok := src.(fs.CompositeHasher); ok && dst.Fs().Features().IsLocal {
+		remote, local = c, dst
+	} else {
+		return true, hash.None, nil
+	}
+	composite, err := remote.CompositeHash(ctx)
+	if err != nil {
+		err = fs.CountError(ctx, err)
+		fs.Errorf(remote, "Failed to read composite hash: %v", err)
+		return false, hash.None, err
+	}
+	if composite == nil {
+		return true, hash.None, nil
+	}
+	in, err := local.Open(ctx)
+	if err != nil {
+		err = fs.CountError(ctx, err)
+		fs.Errorf(local, "Failed to open to calculate composite hash: %v", err)
+		return false, composite.Type, err
+	}
+	sum, err := composite.Stream(readers.NewContextReader(ctx, in))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		err = fs.CountError(ctx, err)
+		fs.Errorf(local, "Failed to calculate composite hash: %v", err)
+		return false, composite.Type, err
+	}
+	if sum != composite.Sum {
+		fs.Debugf(local, "%v = %s (%v)", composite.Type, sum, local.Fs())
+		fs.Debugf(remote, "%v", composite)
+		return false, composite.Type, nil
+	}
+	fs.Debugf(local, "%v OK", composite)
+	return true, composite.Type, nil
+}
+
 var errNoHash = errors.New("no hash available")
 
 // checkHashes does the work of CheckHashes but takes a hash.Type and
@@ -432,7 +492,7 @@ func MoveTransfer(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string,
 // move - see Move for help
 func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.Object, isTransfer bool) (newDst fs.Object, err error) {
 	origRemote := remote // avoid double-transform on fallback to copy
-	remote = transform.Path(ctx, remote, false)
+	remote = transform.PathInfo(ctx, remote, false, src)
 	ci := fs.GetConfig(ctx)
 	newDst = dst
 	if ci.DryRun && dst != nil && SameObject(src, dst) && src.Remote() == transform.Path(ctx, dst.Remote(), false) {
@@ -459,11 +519,16 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 		in.DryRun(src.Size())
 		return newDst, nil
 	}
+	entry := audit.Object(ctx, audit.ActionMove, src)
 	// See if we have Move available
 	if doMove := fdst.Features().Move; doMove != nil && (SameConfig(src.Fs(), fdst) || (SameRemoteType(src.Fs(), fdst) && (fdst.Features().ServerSideAcrossConfigs || ci.ServerSideAcrossConfigs))) {
 		// Delete destination if it exists and is not the same file as src (could be same file while seemingly different if the remote is case insensitive)
 		if dst != nil {
-			remote = transform.Path(ctx, dst.Remote(), false)
+			if dst.Remote() != remote {
+				// dst is already at the transformed name if
+				// it was matched with src after transforming
+				remote = transform.PathInfo(ctx, dst.Remote(), false, src)
+			}
 			if !SameObject(src, dst) {
 				err = DeleteFile(ctx, dst)
 				if err != nil {
@@ -494,6 +559,8 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 			}
 			in.ServerSideMoveEnd(newDst.Size()) // account the bytes for the server-side transfer
 			_ = in.Close()
+			entry.Moved(newDst)
+			entry.Done(nil)
 			return newDst, nil
 		case fs.ErrorCantMove:
 			fs.Debugf(src, "Can't move, switching to copy")
@@ -509,13 +576,18 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 	if origRemote != remote {
 		dst = nil
 	}
-	newDst, err = Copy(ctx, fdst, dst, origRemote, src)
+	// The copy and delete are recorded as the move in the audit log
+	quietCtx := audit.Quiet(ctx)
+	newDst, err = Copy(quietCtx, fdst, dst, origRemote, src)
 	if err != nil {
 		fs.Errorf(src, "Not deleting source as copy failed: %v", err)
 		return newDst, err
 	}
 	// Delete src if no error on copy
-	return newDst, DeleteFile(ctx, src)
+	err = DeleteFile(quietCtx, src)
+	entry.Moved(newDst)
+	err = entry.Done(err)
+	return newDst, err
 }
 
 // CanServerSideMove returns true if fdst support server-side moves or
@@ -566,7 +638,8 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 	} else if backupDir != nil {
 		err = MoveBackupDir(ctx, backupDir, dst)
 	} else {
-		err = dst.Remove(ctx)
+		entry := audit.Object(ctx, audit.ActionDelete, dst)
+		err = entry.Done(dst.Remove(ctx))
 	}
 	if err != nil {
 		fs.Errorf(dst, "Couldn't %s: %v", action, err)
@@ -1130,7 +1203,8 @@ func TryRmdir(ctx context.Context, f fs.Fs, dir string) error {
 		return nil
 	}
 	fs.Infof(fs.LogDirName(f, dir), "Removing directory")
-	return f.Rmdir(ctx, dir)
+	entry := audit.Dir(ctx, audit.ActionRmdir, f, dir)
+	return entry.Done(f.Rmdir(ctx, dir))
 }
 
 // Rmdir removes a container but not if not empty
@@ -1152,7 +1226,8 @@ func Purge(ctx context.Context, f fs.Fs, dir string) (err error) {
 		if SkipDestructive(ctx, fs.LogDirName(f, dir), "purge directory") {
 			return nil
 		}
-		err = doPurge(ctx, dir)
+		entry := audit.Dir(ctx, audit.ActionPurge, f, dir)
+		err = entry.Done(doPurge(ctx, dir))
 		if errors.Is(err, fs.ErrorCantPurge) {
 			doFallbackPurge = true
 		}
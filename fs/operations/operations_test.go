@@ -22,12 +22,14 @@ package operations_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -36,12 +38,15 @@ import (
 	_ "github.com/rclone/rclone/backend/all" // import all backends
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fshttp"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/rclone/rclone/lib/pacer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -310,6 +315,71 @@ func TestHashSumsWithErrors(t *testing.T) {
 	// TODO mock an unreadable file
 }
 
+// compositeObject is a mock object with a composite hash
+type compositeObject struct {
+	*mockobject.ContentMockObject
+	composite *hash.Composite
+}
+
+// CompositeHash returns the composite hash of the object
+func (o compositeObject) CompositeHash(ctx context.Context) (*hash.Composite, error) {
+	return o.composite, nil
+}
+
+func TestCheckHashesComposite(t *testing.T) {
+	ctx := context.Background()
+	const content = "hello world"
+
+	// Make a local object
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte(content), 0666))
+	localFs, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	localObj, err := localFs.NewObject(ctx, "file")
+	require.NoError(t, err)
+
+	// Make a remote object with no hashes other than the composite hash
+	remoteFs, err := mockfs.NewFs(ctx, "remote", "", nil)
+	require.NoError(t, err)
+	contentObj := mockobject.Object("file").WithContent([]byte(content), mockobject.SeekModeNone)
+	contentObj.SetFs(remoteFs)
+	composite := &hash.Composite{Type: hash.MD5, ChunkSize: 6}
+	composite.Sum, err = composite.Stream(strings.NewReader(content))
+	require.NoError(t, err)
+	remoteObj := compositeObject{ContentMockObject: contentObj, composite: composite}
+
+	// Check the composite hash is used in either direction
+	equal, ht, err := operations.CheckHashes(ctx, localObj, remoteObj)
+	require.NoError(t, err)
+	assert.True(t, equal)
+	assert.Equal(t, hash.MD5, ht)
+	equal, ht, err = operations.CheckHashes(ctx, remoteObj, localObj)
+	require.NoError(t, err)
+	assert.True(t, equal)
+	assert.Equal(t, hash.MD5, ht)
+
+	// Check a different composite hash is detected
+	remoteObj.composite = &hash.Composite{Type: hash.MD5, ChunkSize: 6, Sum: "d41d8cd98f00b204e9800998ecf8427e-2"}
+	equal, ht, err = operations.CheckHashes(ctx, localObj, remoteObj)
+	require.NoError(t, err)
+	assert.False(t, equal)
+	assert.Equal(t, hash.MD5, ht)
+
+	// Check no composite hash means no hash is checked
+	remoteObj.composite = nil
+	equal, ht, err = operations.CheckHashes(ctx, localObj, remoteObj)
+	require.NoError(t, err)
+	assert.True(t, equal)
+	assert.Equal(t, hash.None, ht)
+
+	// Check the composite hash isn't used unless the other object is local
+	remoteObj.composite = composite
+	equal, ht, err = operations.CheckHashes(ctx, remoteObj, remoteObj)
+	require.NoError(t, err)
+	assert.True(t, equal)
+	assert.Equal(t, hash.None, ht)
+}
+
 func TestHashStream(t *testing.T) {
 	reader := strings.NewReader("")
 	in := io.NopCloser(reader)
@@ -978,6 +1048,100 @@ func TestMoveFile(t *testing.T) {
 	r.CheckRemoteItems(t, file2)
 }
 
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	oldOpt := audit.Opt
+	audit.Opt.File = logFile
+	defer func() {
+		audit.Opt = oldOpt
+		_ = audit.Reload(ctx)
+	}()
+
+	r.WriteObject(ctx, "dir/file1", "file1 contents", t1)
+	r.WriteFile("file2", "file2 contents is longer", t2)
+
+	// overwrite
+	require.NoError(t, operations.CopyFile(ctx, r.Fremote, r.Flocal, "dir/file1", "file2"))
+	// move
+	require.NoError(t, operations.MoveFile(ctx, r.Fremote, r.Fremote, "moved", "dir/file1"))
+	// delete
+	o, err := r.Fremote.NewObject(ctx, "moved")
+	require.NoError(t, err)
+	require.NoError(t, operations.DeleteFile(ctx, o))
+	// rmdir
+	require.NoError(t, operations.Rmdir(ctx, r.Fremote, "dir"))
+	// dry runs aren't recorded
+	r.WriteFile("file3", "file3 contents", t2)
+	dryCtx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	require.NoError(t, operations.MoveFile(dryCtx, r.Fremote, r.Flocal, "file3", "file3"))
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	_, err = audit.Verify(bytes.NewReader(data), "")
+	require.NoError(t, err)
+	var entries []audit.Entry
+	var actions []string
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var e audit.Entry
+		require.NoError(t, dec.Decode(&e))
+		entries = append(entries, e)
+		actions = append(actions, e.Action)
+	}
+	require.NotEmpty(t, entries)
+	assert.Equal(t, audit.ActionOverwrite, entries[0].Action)
+	assert.Equal(t, "dir/file1", entries[0].Path)
+	assert.Equal(t, int64(14), entries[0].Size)
+	assert.Equal(t, audit.ActorCLI, entries[0].Actor.Type)
+	assert.Contains(t, actions, audit.ActionMove)
+	for _, e := range entries {
+		if e.Action == audit.ActionMove {
+			assert.Equal(t, "dir/file1", e.Path)
+			assert.Equal(t, "moved", e.DstPath)
+		}
+	}
+	assert.Contains(t, actions, audit.ActionDelete)
+	assert.Equal(t, audit.ActionRmdir, entries[len(entries)-1].Action)
+	assert.Equal(t, "dir", entries[len(entries)-1].Path)
+}
+
+func TestAuditLogMoveWithCopy(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	oldOpt := audit.Opt
+	audit.Opt.File = logFile
+	defer func() {
+		audit.Opt = oldOpt
+		_ = audit.Reload(ctx)
+	}()
+	r.Flocal.Features().Disable("Move")
+	r.Fremote.Features().Disable("Move")
+
+	// A move done with a copy and a delete over an existing file is
+	// recorded as a single move
+	r.WriteFile("file1", "file1 contents", t1)
+	r.WriteObject(ctx, "file1", "old contents", t2)
+	require.NoError(t, operations.MoveFile(ctx, r.Fremote, r.Flocal, "file1", "file1"))
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	var entries []audit.Entry
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var e audit.Entry
+		require.NoError(t, dec.Decode(&e))
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionMove, entries[0].Action)
+	assert.Equal(t, "file1", entries[0].Path)
+	assert.Equal(t, "file1", entries[0].DstPath)
+}
+
 func TestMoveFileWithIgnoreExisting(t *testing.T) {
 	ctx := context.Background()
 	ctx, ci := fs.AddConfig(ctx)
@@ -675,6 +675,7 @@ Returns:
 }
 ` + "```" + `
 `,
+		RemoteParams: map[string]string{"dir": ""},
 	})
 }
 
@@ -750,6 +751,7 @@ Returns:
 - error - array of strings of all files with errors (hashing or reading)
 
 `,
+		RemoteParams: map[string]string{"checkFileFs": "checkFileRemote"},
 	})
 }
 
@@ -0,0 +1,332 @@
+package jobs
+
+// The job history records the async jobs in a kv database so that
+// what ran and whether it failed is known after a restart.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+const (
+	historyFacility   = "jobhistory"                          // name of the kv database
+	historyTimeFmt    = "2006-01-02T15:04:05.000000000Z07:00" // sortable key prefix
+	errJobInterrupted = "interrupted as rclone stopped before the job finished"
+)
+
+// historyPruneInterval is the minimum time between prunes of the job
+// history as jobs finish
+var historyPruneInterval = time.Hour
+
+// Record is the record of a job kept in the job history
+type Record struct {
+	ID        int64     `json:"id"`
+	ExecuteID string    `json:"executeId"`
+	Path      string    `json:"path"`
+	Group     string    `json:"group"`
+	Params    rc.Params `json:"params"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  float64   `json:"duration"`
+	Finished  bool      `json:"finished"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error"`
+	Stats     rc.Params `json:"stats,omitempty"` // core/stats for the group when the job finished
+}
+
+// key returns the database key for the record which sorts by start time
+func (r *Record) key() string {
+	return fmt.Sprintf("%s/%s/%d", r.StartTime.UTC().Format(historyTimeFmt), r.ExecuteID, r.ID)
+}
+
+// HistoryStats summarises the job history for metrics
+type HistoryStats struct {
+	Success     int64     // number of successful jobs in the history
+	Failed      int64     // number of failed jobs in the history
+	LastSuccess time.Time // end time of the last successful job
+	LastFailure time.Time // end time of the last failed job
+}
+
+// jobHistory is the persistent store of the jobs
+type jobHistory struct {
+	db     *kv.DB
+	maxAge time.Duration
+
+	mu        sync.Mutex
+	stats     HistoryStats
+	lastPrune time.Time // when the history was last pruned
+}
+
+var (
+	historyMu sync.Mutex
+	history   *jobHistory // nil if the history isn't enabled
+)
+
+// startHistory opens the job history if it is enabled in opt and
+// isn't open already.
+//
+// Errors are logged rather than returned as the rc can work without
+// the history.
+func startHistory(ctx context.Context, opt *rc.Options) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if !opt.JobHistory || history != nil {
+		return
+	}
+	db, err := kv.Start(ctx, historyFacility, nil)
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to open job history: %v", err)
+		return
+	}
+	h := &jobHistory{
+		db:     db,
+		maxAge: time.Duration(opt.JobHistoryMaxAge),
+	}
+	if err = h.open(); err != nil {
+		fs.Errorf(nil, "rc: failed to load job history: %v", err)
+		_ = db.Stop(false)
+		return
+	}
+	fs.Debugf(nil, "rc: job history in %q", db.Path())
+	history = h
+}
+
+// stopHistory closes the job history if open
+func stopHistory() {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if history != nil {
+		_ = history.db.Stop(false)
+		history = nil
+	}
+}
+
+// getHistory returns the job history or nil if not enabled
+func getHistory() *jobHistory {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return history
+}
+
+// open prunes the history, marks the jobs of previous runs which
+// never finished as failed and counts the jobs for the metrics.
+func (h *jobHistory) open() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h._prune()
+}
+
+// _prune does the work of open. It is called again from record while
+// rclone is running so jobs older than maxAge are removed without a
+// restart.
+//
+// Call with h.mu held
+func (h *jobHistory) _prune() error {
+	now := time.Now()
+	op := &opHistoryPrune{
+		executeID: executeID,
+	}
+	if h.maxAge > 0 {
+		op.cutoff = []byte(now.Add(-h.maxAge).UTC().Format(historyTimeFmt))
+	}
+	err := h.db.Do(true, op)
+	if err != nil && err != kv.ErrEmpty {
+		return err
+	}
+	h.stats = op.stats
+	h.lastPrune = now
+	return nil
+}
+
+// opHistoryPrune is the database operation done by _prune
+type opHistoryPrune struct {
+	executeID string
+	cutoff    []byte // remove records which sort before this if set
+	stats     HistoryStats
+}
+
+// Do the prune
+func (op *opHistoryPrune) Do(ctx context.Context, b kv.Bucket) error {
+	var remove [][]byte
+	update := map[string][]byte{}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if op.cutoff != nil && bytes.Compare(k, op.cutoff) < 0 {
+			remove = append(remove, bytes.Clone(k))
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			fs.Debugf(nil, "rc: removing corrupt job history record %q: %v", k, err)
+			remove = append(remove, bytes.Clone(k))
+			continue
+		}
+		if !r.Finished && r.ExecuteID != op.executeID {
+			r.Finished = true
+			r.Error = errJobInterrupted
+			data, err := json.Marshal(&r)
+			if err != nil {
+				return err
+			}
+			update[string(k)] = data
+		}
+		op.stats.add(&r)
+	}
+	for _, k := range remove {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for k, v := range update {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add a finished record to the stats
+func (s *HistoryStats) add(r *Record) {
+	if !r.Finished {
+		return
+	}
+	if r.Success {
+		s.Success++
+		if r.EndTime.After(s.LastSuccess) {
+			s.LastSuccess = r.EndTime
+		}
+	} else {
+		s.Failed++
+		if r.EndTime.After(s.LastFailure) {
+			s.LastFailure = r.EndTime
+		}
+	}
+}
+
+// opHistoryPut writes a record to the history
+type opHistoryPut struct {
+	key  string
+	data []byte
+}
+
+// Do the put
+func (op *opHistoryPut) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Put([]byte(op.key), op.data)
+}
+
+// record writes the current state of job to the history
+func (h *jobHistory) record(ctx context.Context, job *Job, path string, params rc.Params) {
+	job.mu.Lock()
+	r := Record{
+		ID:        job.ID,
+		ExecuteID: job.ExecuteID,
+		Path:      path,
+		Group:     job.Group,
+		Params:    params,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Duration:  job.Duration,
+		Finished:  job.Finished,
+		Success:   job.Success,
+		Error:     job.Error,
+	}
+	job.mu.Unlock()
+	if r.Finished {
+		stats, err := accounting.StatsGroup(ctx, r.Group).RemoteStats(true)
+		if err == nil {
+			r.Stats = stats
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := json.Marshal(&r)
+	if err == nil {
+		err = h.db.Do(true, &opHistoryPut{key: r.key(), data: data})
+	}
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to write job %d to job history: %v", r.ID, err)
+		return
+	}
+	if !r.Finished {
+		return
+	}
+	h.stats.add(&r)
+	if h.maxAge > 0 && time.Since(h.lastPrune) >= historyPruneInterval {
+		if err := h._prune(); err != nil {
+			fs.Errorf(nil, "rc: failed to prune job history: %v", err)
+		}
+	}
+}
+
+// opHistoryList reads the records in the history
+type opHistoryList struct {
+	filter  *listFilter
+	records []*Record
+}
+
+// Do the list
+func (op *opHistoryList) Do(ctx context.Context, b kv.Bucket) error {
+	c := b.Cursor()
+	k, v := c.First()
+	if !op.filter.startedAfter.IsZero() {
+		k, v = c.Seek([]byte(op.filter.startedAfter.UTC().Format(historyTimeFmt)))
+	}
+	for ; k != nil; k, v = c.Next() {
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			continue
+		}
+		if !op.filter.startedBefore.IsZero() && !r.StartTime.Before(op.filter.startedBefore) {
+			break
+		}
+		if op.filter.match(r.Group, r.StartTime, r.Finished, r.Success) {
+			op.records = append(op.records, &r)
+		}
+	}
+	return nil
+}
+
+// list returns the records in the history which match filter oldest
+// first
+func (h *jobHistory) list(filter *listFilter) ([]*Record, error) {
+	op := &opHistoryList{filter: filter}
+	err := h.db.Do(false, op)
+	if err != nil && err != kv.ErrEmpty {
+		return nil, err
+	}
+	return op.records, nil
+}
+
+// GetHistoryStats returns a summary of the job history for metrics.
+//
+// It returns false if the job history isn't enabled.
+func GetHistoryStats() (stats HistoryStats, ok bool) {
+	h := getHistory()
+	if h == nil {
+		return stats, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats, true
+}
+
+// historyParams returns the parameters of a job to keep in the history
+//
+// The values of sensitive options are redacted so secrets aren't
+// stored in the history or returned by job/list.
+func historyParams(in rc.Params) rc.Params {
+	params := in.Copy()
+	delete(params, "_request")
+	delete(params, "_response")
+	return config.RedactParams(params)
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHistory(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported")
+	}
+	ctx := context.Background()
+
+	// Seed the history with the records of a previous rclone
+	db, err := kv.Start(ctx, historyFacility, nil)
+	require.NoError(t, err)
+	defer func() { _ = db.Stop(true) }()
+	put := func(r Record) {
+		data, err := json.Marshal(&r)
+		require.NoError(t, err)
+		require.NoError(t, db.Do(true, &opHistoryPut{key: r.key(), data: data}))
+	}
+	now := time.Now()
+	put(Record{ID: 1, ExecuteID: "old", Path: "sync/sync", StartTime: now.Add(-48 * time.Hour), Finished: true, Success: true})
+	put(Record{ID: 2, ExecuteID: "old", Path: "sync/copy", Group: "nightly", StartTime: now.Add(-time.Hour)})
+	put(Record{ID: 3, ExecuteID: "old", Path: "sync/copy", Group: "nightly", StartTime: now.Add(-400 * 24 * time.Hour), Finished: true})
+
+	startHistory(ctx, &rc.Options{JobHistory: true, JobHistoryMaxAge: fs.Duration(30 * 24 * time.Hour)})
+	defer stopHistory()
+	require.NotNil(t, getHistory())
+
+	stats, ok := GetHistoryStats()
+	require.True(t, ok)
+	assert.Equal(t, int64(1), stats.Success)
+	assert.Equal(t, int64(1), stats.Failed, "interrupted job counts as failed")
+
+	// Run some async jobs
+	jobs := newJobs()
+	wait := func(job *Job) {
+		finished := make(chan struct{})
+		job.OnFinish(func() { close(finished) })
+		<-finished
+	}
+	job, _, err := jobs.NewJob(ctx, noopFn, rc.Params{"_async": true, "_path": "rc/noop", "_group": "nightly", "potato": 1, "notify_secret": "secret"})
+	require.NoError(t, err)
+	wait(job)
+	assert.Equal(t, "rc/noop", job.Path)
+	errFn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		return nil, errors.New("failed")
+	}
+	failed, _, err := jobs.NewJob(ctx, errFn, rc.Params{"_async": true, "_path": "rc/error"})
+	require.NoError(t, err)
+	wait(failed)
+	// synchronous jobs aren't recorded
+	_, _, err = jobs.NewJob(ctx, noopFn, rc.Params{"_path": "core/stats"})
+	require.NoError(t, err)
+
+	list := func(in rc.Params) (paths []string) {
+		out, err := rcJobList(ctx, in)
+		require.NoError(t, err)
+		for _, r := range out["history"].([]*Record) {
+			paths = append(paths, r.Path)
+		}
+		return paths
+	}
+	require.Eventually(t, func() bool {
+		return len(list(rc.Params{})) == 4
+	}, 10*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, []string{"sync/sync", "sync/copy", "rc/noop", "rc/error"}, list(rc.Params{}))
+	assert.Equal(t, []string{"sync/sync", "rc/noop"}, list(rc.Params{"status": "success"}))
+	assert.Equal(t, []string{"sync/copy", "rc/error"}, list(rc.Params{"status": "error"}))
+	assert.Equal(t, []string{"sync/copy", "rc/noop"}, list(rc.Params{"group": "nightly"}))
+	assert.Equal(t, []string{"sync/copy", "rc/noop", "rc/error"}, list(rc.Params{"startedAfter": "2h"}))
+	assert.Equal(t, []string{"sync/sync"}, list(rc.Params{"startedBefore": "2h"}))
+	assert.Equal(t, []string{"sync/copy"}, list(rc.Params{"startedAfter": "2h", "startedBefore": now.Add(-time.Minute).Format(time.RFC3339)}))
+
+	out, err := rcJobList(ctx, rc.Params{"status": "error"})
+	require.NoError(t, err)
+	records := out["history"].([]*Record)
+	assert.Equal(t, errJobInterrupted, records[0].Error)
+	assert.Equal(t, "failed", records[1].Error)
+	assert.Equal(t, executeID, records[1].ExecuteID)
+	assert.NotNil(t, records[1].Stats)
+
+	out, err = rcJobList(ctx, rc.Params{"group": "nightly", "status": "success"})
+	require.NoError(t, err)
+	records = out["history"].([]*Record)
+	require.Len(t, records, 1)
+	// sensitive parameters are redacted
+	assert.Equal(t, rc.Params{"potato": float64(1), "notify_secret": "XXX", "_async": true, "_group": "nightly"}, records[0].Params)
+	filter, err := newListFilter(rc.Params{"group": "nightly", "status": "success"})
+	require.NoError(t, err)
+	all, runningIDs, finishedIDs := jobs.list(filter)
+	assert.Equal(t, []int64{job.ID}, all)
+	assert.Equal(t, []int64{}, runningIDs)
+	assert.Equal(t, []int64{job.ID}, finishedIDs)
+
+	stats, _ = GetHistoryStats()
+	assert.Equal(t, int64(2), stats.Success)
+	assert.Equal(t, int64(2), stats.Failed)
+	assert.False(t, stats.LastFailure.IsZero())
+
+	_, err = rcJobList(ctx, rc.Params{"status": "potato"})
+	assert.True(t, rc.IsErrParamInvalid(err))
+}
+
+func TestJobHistoryPrune(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported")
+	}
+	ctx := context.Background()
+	oldInterval := historyPruneInterval
+	historyPruneInterval = 0
+	defer func() { historyPruneInterval = oldInterval }()
+
+	startHistory(ctx, &rc.Options{JobHistory: true, JobHistoryMaxAge: fs.Duration(time.Hour)})
+	h := getHistory()
+	require.NotNil(t, h)
+	defer func() {
+		stopHistory()
+		db, err := kv.Start(ctx, historyFacility, nil)
+		require.NoError(t, err)
+		_ = db.Stop(true)
+	}()
+
+	// A job which has aged out since rclone started
+	r := Record{ID: 1, ExecuteID: executeID, Path: "sync/sync", StartTime: time.Now().Add(-2 * time.Hour), Finished: true, Success: true}
+	data, err := json.Marshal(&r)
+	require.NoError(t, err)
+	require.NoError(t, h.db.Do(true, &opHistoryPut{key: r.key(), data: data}))
+
+	jobs := newJobs()
+	job, _, err := jobs.NewJob(ctx, noopFn, rc.Params{"_async": true, "_path": "rc/noop"})
+	require.NoError(t, err)
+	finished := make(chan struct{})
+	job.OnFinish(func() { close(finished) })
+	<-finished
+
+	var paths []string
+	require.Eventually(t, func() bool {
+		out, err := rcJobList(ctx, rc.Params{})
+		require.NoError(t, err)
+		paths = nil
+		for _, r := range out["history"].([]*Record) {
+			paths = append(paths, r.Path)
+		}
+		return len(paths) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"rc/noop"}, paths)
+	stats, _ := GetHistoryStats()
+	assert.Equal(t, int64(1), stats.Success)
+}
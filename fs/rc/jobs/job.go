@@ -18,6 +18,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/rc"
@@ -35,6 +36,7 @@ type Job struct {
 	mu        sync.Mutex
 	ID        int64     `json:"id"`
 	ExecuteID string    `json:"executeId"`
+	Path      string    `json:"path"`
 	Group     string    `json:"group"`
 	StartTime time.Time `json:"startTime"`
 	EndTime   time.Time `json:"endTime"`
@@ -139,8 +141,11 @@ func newJobs() *Jobs {
 }
 
 // SetOpt sets the options when they are known
+//
+// This starts the job history if it is enabled.
 func SetOpt(opt *rc.Options) {
 	running.opt = opt
+	startHistory(context.Background(), opt)
 }
 
 // SetInitialJobID allows for setting jobID before starting any jobs.
@@ -236,8 +241,10 @@ func getAsync(ctx context.Context, in rc.Params) (context.Context, bool, error)
 	}
 	delete(in, "_async") // remove the async parameter after parsing
 	if isAsync {
-		// unlink this job from the current context
-		ctx = context.Background()
+		// unlink this job from the current context keeping the
+		// access checks for any rc calls it makes and the actor
+		// for the audit log
+		ctx = audit.CopyActor(rc.CopyAccess(context.Background(), ctx), ctx)
 	}
 	return ctx, isAsync, nil
 }
@@ -287,6 +294,17 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 	id := jobID.Add(1)
 	in = in.Copy() // copy input so we can change it
 
+	path, err := in.GetString("_path")
+	if rc.NotErrParamNotFound(err) {
+		return nil, nil, err
+	}
+	delete(in, "_path")
+	h := getHistory()
+	var params rc.Params
+	if h != nil {
+		params = historyParams(in)
+	}
+
 	ctx, isAsync, err := getAsync(ctx, in)
 	if err != nil {
 		return nil, nil, err
@@ -316,6 +334,7 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 	job = &Job{
 		ID:        id,
 		ExecuteID: executeID,
+		Path:      path,
 		Group:     group,
 		StartTime: time.Now(),
 		Stop:      stop,
@@ -329,7 +348,20 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 	ctx = context.WithValue(ctx, jobKey, job)
 
 	if isAsync {
-		go job.run(ctx, fn, in)
+		// Only async jobs are recorded in the history and notified
+		// as the synchronous calls are mostly quick queries like
+		// core/stats
+		if h != nil {
+			h.record(ctx, job, path, params)
+		}
+		notifyJob(ctx, jobs.opt, job)
+		go func() {
+			job.run(ctx, fn, in)
+			if h != nil {
+				h.record(ctx, job, path, params)
+			}
+			notifyJob(ctx, jobs.opt, job)
+		}()
 		out = make(rc.Params)
 		out["jobid"] = job.ID
 		out["executeId"] = job.ExecuteID
@@ -390,6 +422,7 @@ Results:
 - error - error from the job or empty string for no error
 - finished - boolean whether the job has finished or not
 - id - as passed in above
+- path - the rc command the job is running
 - executeId - rclone instance ID (changes after restart); combined with id uniquely identifies a job
 - startTime - time the job started (e.g. "2018-10-26T18:50:20.528336039+01:00")
 - success - boolean - true for success false otherwise
@@ -424,7 +457,15 @@ func init() {
 		Path:  "job/list",
 		Fn:    rcJobList,
 		Title: "Lists the IDs of the running jobs",
-		Help: `Parameters: None.
+		Help: `Parameters:
+
+- status - only list jobs which are "running", "finished", "success" or "error" (optional)
+- group - only list jobs in this stats group (optional)
+- startedAfter - only list jobs started at or after this time (optional)
+- startedBefore - only list jobs started before this time (optional)
+
+The times can be given as a date like "2006-01-02T15:04:05Z" or as
+a duration before now like "24h".
 
 Results:
 
@@ -432,18 +473,152 @@ Results:
 - jobids - array of integer job ids (starting at 1 on each restart)
 - runningIds - array of integer job ids that are running
 - finishedIds - array of integer job ids that are finished
+- history - array of the jobs in the job history oldest first - only if --rc-job-history is set
+
+Each entry in the history has
+
+- id - id of the job
+- executeId - id of the rclone which ran the job
+- path - the rc command which was run
+- group - the stats group of the job
+- params - the parameters of the command with the values of passwords and other sensitive options replaced with XXX
+- startTime - time the job started
+- endTime - time the job finished
+- duration - time in seconds that the job ran for
+- finished - boolean whether the job has finished or not
+- success - boolean - true for success false otherwise
+- error - error from the job or empty string for no error
+- stats - core/stats for the group of the job when it finished
+
+The job history keeps the jobs run with _async in a database in the
+cache directory so they survive a restart. Jobs which were running when
+rclone stopped are shown as failed.
 `,
 	})
 }
 
+// listFilter selects the jobs which job/list returns
+type listFilter struct {
+	status        string
+	group         string
+	startedAfter  time.Time
+	startedBefore time.Time
+}
+
+// newListFilter reads the filter from the parameters of job/list
+func newListFilter(in rc.Params) (f *listFilter, err error) {
+	f = &listFilter{}
+	f.status, err = in.GetString("status")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	switch f.status {
+	case "", "running", "finished", "success", "error":
+	default:
+		return nil, rc.NewErrParamInvalid(fmt.Errorf("unknown status %q", f.status))
+	}
+	f.group, err = in.GetString("group")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	for _, t := range []struct {
+		key string
+		out *time.Time
+	}{
+		{"startedAfter", &f.startedAfter},
+		{"startedBefore", &f.startedBefore},
+	} {
+		value, err := in.GetString(t.key)
+		if rc.IsErrParamNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		*t.out, err = fs.ParseTime(value)
+		if err != nil {
+			return nil, rc.NewErrParamInvalid(fmt.Errorf("bad %s: %w", t.key, err))
+		}
+	}
+	return f, nil
+}
+
+// match returns true if a job with these attributes should be listed
+func (f *listFilter) match(group string, startTime time.Time, finished, success bool) bool {
+	switch f.status {
+	case "running":
+		if finished {
+			return false
+		}
+	case "finished":
+		if !finished {
+			return false
+		}
+	case "success":
+		if !finished || !success {
+			return false
+		}
+	case "error":
+		if !finished || success {
+			return false
+		}
+	}
+	if f.group != "" && group != f.group {
+		return false
+	}
+	if !f.startedAfter.IsZero() && startTime.Before(f.startedAfter) {
+		return false
+	}
+	if !f.startedBefore.IsZero() && !startTime.Before(f.startedBefore) {
+		return false
+	}
+	return true
+}
+
+// list returns the IDs of the jobs which match filter
+func (jobs *Jobs) list(filter *listFilter) (all, running, finished []int64) {
+	jobs.mu.RLock()
+	defer jobs.mu.RUnlock()
+	all, running, finished = []int64{}, []int64{}, []int64{}
+	for ID, job := range jobs.jobs {
+		job.mu.Lock()
+		match := filter.match(job.Group, job.StartTime, job.Finished, job.Success)
+		isFinished := job.Finished
+		job.mu.Unlock()
+		if !match {
+			continue
+		}
+		all = append(all, ID)
+		if isFinished {
+			finished = append(finished, ID)
+		} else {
+			running = append(running, ID)
+		}
+	}
+	return all, running, finished
+}
+
 // Returns list of job ids.
 func rcJobList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	filter, err := newListFilter(in)
+	if err != nil {
+		return nil, err
+	}
 	out = make(rc.Params)
-	out["jobids"] = running.IDs()
-	runningIDs, finishedIDs := running.Stats()
+	allIDs, runningIDs, finishedIDs := running.list(filter)
+	out["jobids"] = allIDs
 	out["runningIds"] = runningIDs
 	out["finishedIds"] = finishedIDs
 	out["executeId"] = executeID
+	if h := getHistory(); h != nil {
+		records, err := h.list(filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job history: %w", err)
+		}
+		if records == nil {
+			records = []*Record{}
+		}
+		out["history"] = records
+	}
 	return out, nil
 }
 
@@ -538,6 +713,10 @@ func NewJobFromParams(ctx context.Context, in rc.Params) (out rc.Params) {
 	if call.NeedsResponse {
 		return rcError(fmt.Errorf("can't run path %q as it needs the response", path), http.StatusBadRequest)
 	}
+	err = rc.CheckAccess(ctx, path, in)
+	if err != nil {
+		return rcError(err, http.StatusForbidden)
+	}
 
 	// Pass on the group if one is set in the context and it isn't set in the input.
 	if _, found := in["_group"]; !found {
@@ -548,7 +727,9 @@ func NewJobFromParams(ctx context.Context, in rc.Params) (out rc.Params) {
 	}
 
 	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
-	_, out, err = NewJob(ctx, call.Fn, in)
+	jobIn := in.Copy()
+	jobIn["_path"] = path
+	_, out, err = NewJob(ctx, call.Fn, jobIn)
 	if err != nil {
 		return rcError(err, http.StatusInternalServerError)
 	}
@@ -674,7 +855,6 @@ func runBatchJob(ctx context.Context, inputAny any) (out rc.Params, err error) {
 	if err != nil {
 		return nil, err
 	}
-	delete(in, "_path")
 	call := rc.Calls.Get(path)
 
 	// Check call
@@ -0,0 +1,250 @@
+package jobs
+
+// Notifications POST a JSON description of a job to the --notify-url
+// when it starts and finishes.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// Notification events
+const (
+	EventStart  = "start"  // the job has started
+	EventFinish = "finish" // the job finished successfully
+	EventError  = "error"  // the job finished with an error
+)
+
+// notifyQueueSize is the number of notifications which can wait to be
+// sent before new ones are dropped
+const notifyQueueSize = 100
+
+// notifyWaitTime is how long a command line run of rclone waits for
+// its notifications to be sent before exiting
+var notifyWaitTime = time.Minute
+
+// Headers sent with the notifications
+const (
+	NotifyEventHeader     = "X-Rclone-Event"
+	NotifySignatureHeader = "X-Rclone-Signature-256"
+)
+
+// retryErrorCodes is a slice of error codes that we will retry
+var retryErrorCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Notification is the JSON which is POSTed to the --notify-url
+type Notification struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	ExecuteID string    `json:"executeId"`
+	ID        int64     `json:"id"`    // 0 for a command line run
+	Path      string    `json:"path"`  // the rc command or the rclone command line run
+	Group     string    `json:"group"` // empty for a command line run
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  float64   `json:"duration"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error"`
+	Stats     rc.Params `json:"stats,omitempty"` // core/stats for the group when the job finished
+}
+
+// notifier sends the notifications in the background in order
+type notifier struct {
+	once   sync.Once
+	queue  chan notifyRequest
+	wg     sync.WaitGroup // counts the notifications not sent yet
+	client *rest.Client
+	pacer  *fs.Pacer
+}
+
+// notifyRequest is a notification queued for sending
+type notifyRequest struct {
+	opt *rc.Options
+	n   *Notification
+}
+
+var notifications notifier
+
+// wantNotify returns true if notifications for event should be sent
+func wantNotify(opt *rc.Options, event string) bool {
+	return len(opt.NotifyURL) > 0 && slices.Contains(opt.NotifyEvents, event)
+}
+
+// notify queues n for sending if it is wanted
+//
+// This never blocks as it is called when starting jobs. If the queue
+// is full the notification is dropped and an error logged.
+func notify(ctx context.Context, opt *rc.Options, n *Notification) {
+	if !wantNotify(opt, n.Event) {
+		return
+	}
+	notifications.once.Do(func() {
+		ctx := context.Background()
+		notifications.queue = make(chan notifyRequest, notifyQueueSize)
+		notifications.client = rest.NewClient(fshttp.NewClient(ctx))
+		notifications.pacer = fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(100*time.Millisecond), pacer.MaxSleep(30*time.Second)))
+		go notifications.run()
+	})
+	n.Time = time.Now()
+	n.ExecuteID = executeID
+	notifications.wg.Add(1)
+	select {
+	case notifications.queue <- notifyRequest{opt: opt, n: n}:
+	default:
+		notifications.wg.Done()
+		fs.Errorf(nil, "Dropped %s notification for %q as %d are waiting to be sent", n.Event, n.Path, notifyQueueSize)
+	}
+}
+
+// run sends the queued notifications
+func (nr *notifier) run() {
+	for req := range nr.queue {
+		data, err := json.Marshal(req.n)
+		if err != nil {
+			fs.Errorf(nil, "Failed to encode notification: %v", err)
+		} else {
+			for _, url := range req.opt.NotifyURL {
+				err = nr.post(url, req.opt.NotifySecret, req.n.Event, data)
+				if err != nil {
+					fs.Errorf(nil, "Failed to send %s notification for %q to %q: %v", req.n.Event, req.n.Path, url, err)
+				}
+			}
+		}
+		nr.wg.Done()
+	}
+}
+
+// post data to url retrying if necessary
+func (nr *notifier) post(url, secret, event string, data []byte) error {
+	ctx := context.Background()
+	opts := rest.Opts{
+		Method:      "POST",
+		RootURL:     url,
+		ContentType: "application/json",
+		NoResponse:  true,
+		ExtraHeaders: map[string]string{
+			NotifyEventHeader: event,
+		},
+	}
+	if secret != "" {
+		opts.ExtraHeaders[NotifySignatureHeader] = "sha256=" + signNotification(secret, data)
+	}
+	return nr.pacer.Call(func() (bool, error) {
+		opts.Body = bytes.NewReader(data)
+		resp, err := nr.client.Call(ctx, &opts)
+		return fserrors.ShouldRetry(err) || fserrors.ShouldRetryHTTP(resp, retryErrorCodes), err
+	})
+}
+
+// signNotification returns the hex encoded HMAC-SHA256 of data
+func signNotification(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WaitNotify waits for the queued notifications to be sent or for ctx
+// to be done, returning the error from ctx if so
+func WaitNotify(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		notifications.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notifyJob sends the notification for job for the start or end of
+// the job.
+func notifyJob(ctx context.Context, opt *rc.Options, job *Job) {
+	job.mu.Lock()
+	n := &Notification{
+		Event:     EventStart,
+		ID:        job.ID,
+		Path:      job.Path,
+		Group:     job.Group,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Duration:  job.Duration,
+		Success:   job.Success,
+		Error:     job.Error,
+	}
+	finished := job.Finished
+	job.mu.Unlock()
+	if finished {
+		n.Event = EventFinish
+		if !n.Success {
+			n.Event = EventError
+		}
+		if wantNotify(opt, n.Event) {
+			n.Stats, _ = accounting.StatsGroup(ctx, n.Group).RemoteStats(true)
+		}
+	}
+	notify(ctx, opt, n)
+}
+
+// NotifyCommand sends the start notification for a command line run
+// of rclone if --notify-url is set.
+//
+// It returns a function to call with the result of the command which
+// sends the finish or error notification and waits up to
+// notifyWaitTime for all the notifications to be sent.
+func NotifyCommand(ctx context.Context, command string) (finish func(err error)) {
+	opt := &rc.Opt
+	startTime := time.Now()
+	notify(ctx, opt, &Notification{
+		Event:     EventStart,
+		Path:      command,
+		StartTime: startTime,
+	})
+	return func(err error) {
+		n := &Notification{
+			Event:     EventFinish,
+			Path:      command,
+			StartTime: startTime,
+			EndTime:   time.Now(),
+			Success:   err == nil,
+		}
+		n.Duration = n.EndTime.Sub(startTime).Seconds()
+		if err != nil {
+			n.Event = EventError
+			n.Error = err.Error()
+		}
+		if wantNotify(opt, n.Event) {
+			n.Stats, _ = accounting.GlobalStats().RemoteStats(true)
+		}
+		notify(ctx, opt, n)
+		waitCtx, cancel := context.WithTimeout(context.Background(), notifyWaitTime)
+		defer cancel()
+		if err := WaitNotify(waitCtx); err != nil {
+			fs.Errorf(nil, "Gave up waiting for the notifications to be sent after %v", notifyWaitTime)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyServer records the notifications POSTed to it
+type notifyServer struct {
+	mu       sync.Mutex
+	failures int // number of requests to fail before succeeding
+	received []Notification
+	*httptest.Server
+}
+
+func newNotifyServer(t *testing.T, secret string) *notifyServer {
+	s := &notifyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if secret != "" {
+			assert.Equal(t, "sha256="+signNotification(secret, body), r.Header.Get(NotifySignatureHeader))
+		}
+		var n Notification
+		assert.NoError(t, json.Unmarshal(body, &n))
+		assert.Equal(t, n.Event, r.Header.Get(NotifyEventHeader))
+		s.received = append(s.received, n)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *notifyServer) notifications() []Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Notification(nil), s.received...)
+}
+
+func TestNotifyJob(t *testing.T) {
+	ctx := context.Background()
+	s := newNotifyServer(t, "potato")
+	s.failures = 1
+	jobs := newJobs()
+	jobs.opt = &rc.Options{
+		NotifyURL:    []string{s.URL},
+		NotifySecret: "potato",
+		NotifyEvents: fs.CommaSepList{EventStart, EventFinish, EventError},
+	}
+	errFn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		return nil, errors.New("failed")
+	}
+
+	job, _, err := jobs.NewJob(ctx, noopFn, rc.Params{"_async": true, "_path": "rc/noop", "_group": "mygroup"})
+	require.NoError(t, err)
+	failed, _, err := jobs.NewJob(ctx, errFn, rc.Params{"_async": true, "_path": "rc/error"})
+	require.NoError(t, err)
+	// synchronous jobs aren't notified
+	_, _, err = jobs.NewJob(ctx, noopFn, rc.Params{"_path": "core/stats"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		require.NoError(t, WaitNotify(ctx))
+		return len(s.notifications()) == 4
+	}, 10*time.Second, 10*time.Millisecond)
+	events := map[string]Notification{}
+	for _, n := range s.notifications() {
+		events[n.Path+" "+n.Event] = n
+	}
+	assert.Equal(t, job.ID, events["rc/noop start"].ID)
+	assert.Equal(t, "mygroup", events["rc/noop start"].Group)
+	assert.Equal(t, executeID, events["rc/noop start"].ExecuteID)
+	finish := events["rc/noop finish"]
+	assert.True(t, finish.Success)
+	assert.NotNil(t, finish.Stats)
+	assert.Equal(t, "mygroup", finish.Group)
+	errored := events["rc/error error"]
+	assert.Equal(t, failed.ID, errored.ID)
+	assert.False(t, errored.Success)
+	assert.Equal(t, "failed", errored.Error)
+	assert.Contains(t, events, "rc/error start")
+}
+
+func TestNotifyCommand(t *testing.T) {
+	ctx := context.Background()
+	s := newNotifyServer(t, "")
+	oldOpt := rc.Opt
+	defer func() { rc.Opt = oldOpt }()
+	rc.Opt.NotifyURL = []string{s.URL, s.URL}
+	rc.Opt.NotifyEvents = fs.CommaSepList{EventError}
+
+	finish := NotifyCommand(ctx, "rclone sync")
+	finish(nil)
+	assert.Len(t, s.notifications(), 0, "only errors wanted")
+
+	finish = NotifyCommand(ctx, "rclone sync")
+	finish(errors.New("boom"))
+	got := s.notifications()
+	require.Len(t, got, 2, "one for each URL")
+	assert.Equal(t, EventError, got[0].Event)
+	assert.Equal(t, "rclone sync", got[0].Path)
+	assert.Equal(t, "boom", got[0].Error)
+	assert.Equal(t, int64(0), got[0].ID)
+	assert.NotNil(t, got[0].Stats)
+}
+
+func TestNotifyQueueFull(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	var received atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		received.Add(1)
+	}))
+	defer s.Close()
+	opt := &rc.Options{
+		NotifyURL:    []string{s.URL},
+		NotifyEvents: fs.CommaSepList{EventStart},
+	}
+
+	// Queue more notifications than fit while the first is stuck
+	const total = notifyQueueSize + 10
+	done := make(chan struct{})
+	go func() {
+		for range total {
+			notify(ctx, opt, &Notification{Event: EventStart, Path: "rc/noop"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		close(release)
+		t.Fatal("notify blocked with a full queue")
+	}
+
+	// Waiting for the stuck notifications gives up
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, WaitNotify(waitCtx), context.DeadlineExceeded)
+
+	close(release)
+	require.NoError(t, WaitNotify(ctx))
+	assert.GreaterOrEqual(t, int(received.Load()), notifyQueueSize)
+	assert.Less(t, int(received.Load()), total)
+}
@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HistoryCollector is a Prometheus collector for the job history
+type HistoryCollector struct {
+	jobs        *prometheus.Desc
+	lastSuccess *prometheus.Desc
+	lastFailure *prometheus.Desc
+}
+
+// NewHistoryCollector makes a new HistoryCollector
+//
+// It only reports metrics if the job history is enabled.
+func NewHistoryCollector() *HistoryCollector {
+	return &HistoryCollector{
+		jobs: prometheus.NewDesc("rclone_job_history_jobs",
+			"Number of finished async jobs in the job history",
+			[]string{"status"}, nil,
+		),
+		lastSuccess: prometheus.NewDesc("rclone_job_history_last_success_timestamp_seconds",
+			"Time the last successful async job in the job history finished",
+			nil, nil,
+		),
+		lastFailure: prometheus.NewDesc("rclone_job_history_last_failure_timestamp_seconds",
+			"Time the last failed async job in the job history finished",
+			nil, nil,
+		),
+	}
+}
+
+// Describe is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+func (c *HistoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.jobs
+	ch <- c.lastSuccess
+	ch <- c.lastFailure
+}
+
+// Collect is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+func (c *HistoryCollector) Collect(ch chan<- prometheus.Metric) {
+	s, ok := GetHistoryStats()
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.jobs, prometheus.GaugeValue, float64(s.Success), "success")
+	ch <- prometheus.MustNewConstMetric(c.jobs, prometheus.GaugeValue, float64(s.Failed), "error")
+	if !s.LastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastSuccess, prometheus.GaugeValue, float64(s.LastSuccess.Unix()))
+	}
+	if !s.LastFailure.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastFailure, prometheus.GaugeValue, float64(s.LastFailure.Unix()))
+	}
+}
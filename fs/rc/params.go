@@ -300,6 +300,8 @@ func Error(path string, in Params, err error, status int) (Params, int) {
 		status = http.StatusNotFound
 	case IsErrParamInvalid(err) || IsErrParamNotFound(err):
 		status = http.StatusBadRequest
+	case errors.Is(err, ErrAccessDenied):
+		status = http.StatusForbidden
 	}
 	result := Params{
 		"status": status,
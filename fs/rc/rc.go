@@ -43,6 +43,11 @@ var OptionsInfo = fs.Options{{
 	Default: false,
 	Help:    "Don't require auth for certain methods",
 	Groups:  "RC",
+}, {
+	Name:    "rc_roles",
+	Default: "",
+	Help:    "File of roles limiting the rc commands and remotes each user may use",
+	Groups:  "RC",
 }, {
 	Name:    "rc_web_gui",
 	Default: false,
@@ -83,6 +88,32 @@ var OptionsInfo = fs.Options{{
 	Default: fs.Duration(10 * time.Second),
 	Help:    "Interval to check for expired async jobs",
 	Groups:  "RC",
+}, {
+	Name:    "rc_job_history",
+	Default: false,
+	Help:    "Keep a history of async jobs which survives a restart",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_history_max_age",
+	Default: fs.Duration(30 * 24 * time.Hour),
+	Help:    "Remove jobs older than this from the job history (0 to keep forever)",
+	Groups:  "RC",
+}, {
+	Name:    "notify_url",
+	Default: []string{},
+	Help:    "URL to POST a JSON notification to when a job starts or finishes (can be repeated)",
+	Groups:  "RC",
+}, {
+	Name:      "notify_secret",
+	Default:   "",
+	Help:      "Secret to sign the notifications with using HMAC-SHA256",
+	Groups:    "RC",
+	Sensitive: true,
+}, {
+	Name:    "notify_events",
+	Default: fs.CommaSepList{"start", "finish", "error"},
+	Help:    "Comma separated list of events to send notifications for",
+	Groups:  "RC",
 }, {
 	Name:    "metrics_addr",
 	Default: []string{},
@@ -111,6 +142,7 @@ type Options struct {
 	Serve               bool                   `config:"rc_serve"`                   // set to serve files from remotes
 	ServeNoModTime      bool                   `config:"rc_serve_no_modtime"`        // don't read the modification time
 	NoAuth              bool                   `config:"rc_no_auth"`                 // set to disable auth checks on AuthRequired methods
+	Roles               string                 `config:"rc_roles"`                   // file of roles to limit what users can do
 	WebUI               bool                   `config:"rc_web_gui"`                 // set to launch the web ui
 	WebGUIUpdate        bool                   `config:"rc_web_gui_update"`          // set to check new update
 	WebGUIForceUpdate   bool                   `config:"rc_web_gui_force_update"`    // set to force download new update
@@ -122,6 +154,11 @@ type Options struct {
 	MetricsTemplate     libhttp.TemplateConfig `config:"metrics"`
 	JobExpireDuration   fs.Duration            `config:"rc_job_expire_duration"`
 	JobExpireInterval   fs.Duration            `config:"rc_job_expire_interval"`
+	JobHistory          bool                   `config:"rc_job_history"`
+	JobHistoryMaxAge    fs.Duration            `config:"rc_job_history_max_age"`
+	NotifyURL           []string               `config:"notify_url"`
+	NotifySecret        string                 `config:"notify_secret"`
+	NotifyEvents        fs.CommaSepList        `config:"notify_events"`
 }
 
 // Opt is the default values used for Options
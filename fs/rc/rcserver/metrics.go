@@ -22,6 +22,7 @@ var promHandlerFunc http.HandlerFunc
 func init() {
 	rcloneCollector := accounting.NewRcloneCollector(context.Background())
 	prometheus.MustRegister(rcloneCollector)
+	prometheus.MustRegister(jobs.NewHistoryCollector())
 
 	m := fshttp.NewMetrics("rclone")
 	for _, c := range m.Collectors() {
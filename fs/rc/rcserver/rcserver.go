@@ -18,6 +18,7 @@ import (
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/list"
@@ -41,7 +42,10 @@ func Start(ctx context.Context, opt *rc.Options) (*Server, error) {
 		if err != nil {
 			return nil, err
 		}
-		return s, s.Serve()
+		if err = s.Serve(); err != nil {
+			return s, err
+		}
+		return s, nil
 	}
 	return nil, nil
 }
@@ -53,6 +57,7 @@ type Server struct {
 	files          http.Handler
 	pluginsHandler http.Handler
 	opt            *rc.Options
+	roles          *rc.Roles // set if --rc-roles is in use
 }
 
 func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Server, error) {
@@ -77,7 +82,7 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 		}
 		if opt.NoAuth {
 			fs.Logf(nil, "It is recommended to use web gui with auth.")
-		} else {
+		} else if opt.Auth.JWTIssuer == "" && opt.Auth.JWTKey == "" {
 			if opt.Auth.BasicUser == "" && opt.Auth.HtPasswd == "" {
 				opt.Auth.BasicUser = "gui"
 				fs.Infof(nil, "No username specified. Using default username: %s \n", rc.Opt.Auth.BasicUser)
@@ -107,6 +112,13 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 	}
 
 	var err error
+	if opt.Roles != "" {
+		s.roles, err = rc.LoadRoles(opt.Roles)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	s.server, err = libhttp.NewServer(ctx,
 		libhttp.WithConfig(opt.HTTP),
 		libhttp.WithAuth(opt.Auth),
@@ -268,6 +280,23 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 		return
 	}
 
+	// Record the changes made by the call against the user
+	user, _ := libhttp.CtxGetUser(ctx)
+	ctx = audit.WithActor(ctx, audit.Actor{Type: audit.ActorRC, User: user})
+
+	// Check the user's roles allow the call
+	if s.roles != nil {
+		check := func(path string, in rc.Params) error {
+			return s.roles.Check(user, path, in)
+		}
+		if err := check(path, in); err != nil {
+			writeError(path, in, w, err, http.StatusForbidden)
+			return
+		}
+		// check any rc calls this call makes too
+		ctx = rc.WithAccess(ctx, check)
+	}
+
 	inOrig := in.Copy()
 
 	if call.NeedsRequest {
@@ -279,6 +308,8 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 		in["_response"] = w
 	}
 
+	in["_path"] = path
+
 	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
 	job, out, err := jobs.NewJob(ctx, call.Fn, in)
 	if job != nil {
@@ -362,6 +393,23 @@ func (s *Server) serveRemote(w http.ResponseWriter, r *http.Request, path string
 	}
 }
 
+// checkRemote checks the user's roles allow access to remote writing
+// an error and returning false if not.
+//
+// A remote of "*" checks the user can access all the remotes.
+func (s *Server) checkRemote(w http.ResponseWriter, r *http.Request, path string, remote string) bool {
+	if s.roles == nil {
+		return true
+	}
+	user, _ := libhttp.CtxGetUser(r.Context())
+	err := s.roles.CheckRemote(user, remote)
+	if err != nil {
+		writeError(path, nil, w, err, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // Match URLS of the form [fs]/remote
 var fsMatch = regexp.MustCompile(`^\[(.*?)\](.*)$`)
 
@@ -372,6 +420,9 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 	switch {
 	case fsMatchResult != nil && s.opt.Serve:
 		// Serve /[fs]/remote files
+		if !s.checkRemote(w, r, path, fsMatchResult[1]+"/"+strings.TrimLeft(fsMatchResult[2], "/")) {
+			return
+		}
 		s.serveRemote(w, r, fsMatchResult[2], fsMatchResult[1])
 		return
 	case path == "metrics" && s.opt.EnableMetrics:
@@ -379,6 +430,9 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 		return
 	case path == "*" && s.opt.Serve:
 		// Serve /* as the remote listing
+		if !s.checkRemote(w, r, path, "*") {
+			return
+		}
 		s.serveRoot(w, r)
 		return
 	case s.files != nil:
@@ -403,6 +457,9 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 		return
 	case path == "" && s.opt.Serve:
 		// Serve the root as a remote listing
+		if !s.checkRemote(w, r, path, "*") {
+			return
+		}
 		s.serveRoot(w, r)
 		return
 	}
@@ -3,6 +3,8 @@ package rcserver
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -913,3 +915,103 @@ func normalizeJSON(t *testing.T, jsonStr string) string {
 	require.NoError(t, err, "JSON marshalling failed")
 	return string(normalizedJSON)
 }
+
+func TestRoles(t *testing.T) {
+	dir := t.TempDir()
+	sha := func(pass string) string {
+		sum := sha1.Sum([]byte(pass))
+		return "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	htpasswd := filepath.Join(dir, "htpasswd")
+	require.NoError(t, os.WriteFile(htpasswd, []byte("grafana:"+sha("pass")+"\nci:"+sha("pass")+"\n"), 0600))
+	roles := filepath.Join(dir, "roles")
+	require.NoError(t, os.WriteFile(roles, []byte(`
+@dashboard:core/version:
+@ci:rc/noop,job/batch:`+testFs+`
+grafana:dashboard
+ci:ci,dashboard
+`), 0600))
+
+	tests := []testRun{{
+		Name:        "allowed",
+		URL:         "core/version",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{}`,
+		Status:      http.StatusOK,
+		Contains:    regexp.MustCompile(`"version"`),
+		User:        "grafana",
+		Pass:        "pass",
+	}, {
+		Name:        "path-denied",
+		URL:         "core/command",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{"command":"version"}`,
+		Status:      http.StatusForbidden,
+		Contains:    regexp.MustCompile(`access denied: user \\"grafana\\" may not call \\"core/command\\"`),
+		User:        "grafana",
+		Pass:        "pass",
+	}, {
+		Name:        "remote-allowed",
+		URL:         "rc/noop",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{"fs":"` + testFs + `","remote":"dir"}`,
+		Status:      http.StatusOK,
+		Contains:    regexp.MustCompile(`"remote": "dir"`),
+		User:        "ci",
+		Pass:        "pass",
+	}, {
+		Name:        "remote-denied",
+		URL:         "rc/noop",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{"fs":"` + testFs + `","remote":".."}`,
+		Status:      http.StatusForbidden,
+		Contains:    regexp.MustCompile(`may not call \\"rc/noop\\" on \\"testdata/files/..\\"`),
+		User:        "ci",
+		Pass:        "pass",
+	}, {
+		Name:        "batch",
+		URL:         "job/batch",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{"concurrency":1,"inputs":[{"_path":"core/version"},{"_path":"config/dump"}]}`,
+		Status:      http.StatusOK,
+		Contains:    regexp.MustCompile(`(?s)"version".*"status": 403`),
+		User:        "ci",
+		Pass:        "pass",
+	}, {
+		Name:     "serve-allowed",
+		URL:      remoteURL + "file.txt",
+		Status:   http.StatusOK,
+		Expected: "this is file1.txt\n",
+		User:     "ci",
+		Pass:     "pass",
+	}, {
+		Name:     "serve-denied",
+		URL:      remoteURL + "file.txt",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`access denied`),
+		User:     "grafana",
+		Pass:     "pass",
+	}, {
+		Name:     "serve-root-denied",
+		URL:      "*",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`access denied`),
+		User:     "ci",
+		Pass:     "pass",
+	}}
+	opt := newTestOpt()
+	opt.Serve = true
+	opt.Files = ""
+	opt.Auth.HtPasswd = htpasswd
+	opt.Roles = roles
+	testServer(t, tests, &opt)
+
+	opt.Roles = filepath.Join(dir, "notfound")
+	_, err := newServer(context.Background(), &opt, http.NewServeMux())
+	assert.ErrorContains(t, err, "failed to open roles file")
+}
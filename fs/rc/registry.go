@@ -22,6 +22,11 @@ type Call struct {
 	Help          string // multi-line markdown formatted help
 	NeedsRequest  bool   // if set then this call will be passed the original request object as _request
 	NeedsResponse bool   // if set then this call will be passed the original response object as _response
+	// RemoteParams are the parameters, other than fs, srcFs, dstFs
+	// and path1, path2, ..., which name remotes or local paths
+	// mapped to the parameter holding the path within them, if
+	// any. These are checked by --rc-roles.
+	RemoteParams map[string]string `json:"-"`
 }
 
 // Registry holds the list of all the registered remote control functions
@@ -0,0 +1,391 @@
+// Role based access control for the rc
+
+package rc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+// ErrAccessDenied is returned when a user isn't allowed to make an rc
+// call or touch the remotes in its parameters
+var ErrAccessDenied = errors.New("access denied")
+
+// AnyUser is the user in the roles file which matches all the users
+// not listed, including unauthenticated ones
+const AnyUser = "*"
+
+// Role is a named set of rc paths and remotes
+type Role struct {
+	Name    string
+	Paths   []string // rc paths allowed which may use path.Match wildcards, "*" for all
+	Remotes []string // remotes and the paths below them which are allowed, "*" for all
+}
+
+// Roles maps users to the roles they have
+type Roles struct {
+	roles map[string]*Role
+	users map[string][]*Role
+	calls *Registry // the rc calls to check
+}
+
+// matches the parameters which name remotes
+var fsParamMatch = regexp.MustCompile(`^(fs|srcFs|dstFs|path\d+)$`)
+
+// the parameter holding the path within the remote for each fs parameter
+var remoteParams = map[string]string{
+	"fs":    "remote",
+	"srcFs": "srcRemote",
+	"dstFs": "dstRemote",
+}
+
+// the _config options which may be set by roles not allowing all
+// remotes. The others can run programs, read local files or change
+// how the connections are made so aren't allowed.
+var safeConfigOptions = map[string]bool{}
+
+func init() {
+	for _, name := range []string{
+		"DryRun", "CheckSum", "SizeOnly", "IgnoreTimes", "IgnoreExisting",
+		"IgnoreErrors", "ModifyWindow", "Checkers", "Transfers",
+		"DeleteMode", "MaxDelete", "MaxDeleteSize", "TrackRenames",
+		"TrackRenamesStrategy", "SyncJournal", "Retries", "RetriesInterval",
+		"LowLevelRetries", "UpdateOlder", "MaxDepth", "IgnoreSize",
+		"IgnoreChecksum", "IgnoreCaseSync", "FixCase", "NoTraverse",
+		"CheckFirst", "NoCheckDest", "NoUpdateModTime", "NoUpdateDirModTime",
+		"CompareDest", "CopyDest", "BackupDir", "Suffix", "SuffixKeepExtension",
+		"UseListR", "BufferSize", "Immutable", "UseServerModTime",
+		"MaxTransfer", "MaxDuration", "CutoffMode", "MaxBacklog",
+		"ErrorOnNoTransfer", "MultiThreadCutoff", "MultiThreadStreams",
+		"MultiThreadChunkSize", "ResumeUploads", "OrderBy", "RefreshTimes",
+		"Metadata", "Inplace", "PartialSuffix",
+	} {
+		safeConfigOptions[strings.ToLower(name)] = true
+	}
+}
+
+// LoadRoles reads the roles file at filePath.
+//
+// Roles are defined with lines of the form
+//
+//	@role:path,path,...:remote,remote,...
+//
+// and users are given roles with lines of the form
+//
+//	user:role,role,...
+//
+// Blank lines and lines starting with # are ignored.
+func LoadRoles(filePath string) (*Roles, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open roles file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	r, err := parseRoles(bufio.NewScanner(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roles file %q: %w", filePath, err)
+	}
+	return r, nil
+}
+
+// splitList splits a comma separated list ignoring empty items
+func splitList(s string) (items []string) {
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRoles parses the lines of a roles file
+func parseRoles(scanner *bufio.Scanner) (*Roles, error) {
+	r := &Roles{
+		roles: map[string]*Role{},
+		users: map[string][]*Role{},
+		calls: Calls,
+	}
+	userRoles := map[string][]string{}
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if role, ok := strings.CutPrefix(line, "@"); ok {
+			parts := strings.SplitN(role, ":", 3)
+			if len(parts) != 3 || parts[0] == "" {
+				return nil, fmt.Errorf("line %d: role must be of the form @role:paths:remotes", lineNumber)
+			}
+			name := parts[0]
+			if _, found := r.roles[name]; found {
+				return nil, fmt.Errorf("line %d: duplicate role %q", lineNumber, name)
+			}
+			role := &Role{
+				Name:    name,
+				Paths:   splitList(parts[1]),
+				Remotes: splitList(parts[2]),
+			}
+			for _, pattern := range role.Paths {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("line %d: bad path %q: %w", lineNumber, pattern, err)
+				}
+			}
+			for _, remote := range role.Remotes {
+				if _, _, err := splitRemote(remote); err != nil && remote != "*" {
+					return nil, fmt.Errorf("line %d: bad remote %q: %w", lineNumber, remote, err)
+				}
+			}
+			r.roles[name] = role
+			continue
+		}
+		user, roles, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: user must be of the form user:roles", lineNumber)
+		}
+		if _, found := userRoles[user]; found {
+			return nil, fmt.Errorf("line %d: duplicate user %q", lineNumber, user)
+		}
+		userRoles[user] = splitList(roles)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for user, names := range userRoles {
+		r.users[user] = []*Role{}
+		for _, name := range names {
+			role, found := r.roles[name]
+			if !found {
+				return nil, fmt.Errorf("user %q has unknown role %q", user, name)
+			}
+			r.users[user] = append(r.users[user], role)
+		}
+	}
+	return r, nil
+}
+
+// userRoles returns the roles for user
+func (r *Roles) userRoles(user string) []*Role {
+	roles, found := r.users[user]
+	if !found {
+		roles = r.users[AnyUser]
+	}
+	return roles
+}
+
+// allowsPath returns true if the role allows the rc path
+func (role *Role) allowsPath(rcPath string) bool {
+	for _, pattern := range role.Paths {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rcPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRemote splits remote into its remote name, including any
+// connection string parameters, and a cleaned path which always
+// starts with /
+func splitRemote(remote string) (name, remotePath string, err error) {
+	name, remotePath, err = fspath.SplitFs(remote)
+	if err != nil {
+		return "", "", err
+	}
+	return name, path.Clean("/" + remotePath), nil
+}
+
+// allowsRemote returns true if the role allows access to remote
+//
+// A remote of "*" is only allowed if the role allows all remotes.
+func (role *Role) allowsRemote(remote string) bool {
+	name, remotePath, err := splitRemote(remote)
+	for _, allowed := range role.Remotes {
+		if allowed == "*" {
+			return true
+		}
+		if remote == "*" || err != nil {
+			continue
+		}
+		allowedName, allowedPath, err := splitRemote(allowed)
+		if err != nil || allowedName != name {
+			continue
+		}
+		if allowedPath == "/" || remotePath == allowedPath || strings.HasPrefix(remotePath, allowedPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// remotes returns the remotes named in the parameters of the rc call
+// rcPath joined with their remote paths if set
+//
+// The parameters checked are fs, srcFs, dstFs, path1, path2, ... and
+// the RemoteParams the call declares. If rcPath isn't a known call
+// then "*" is returned so only roles allowing all remotes may call it.
+func (r *Roles) remotes(rcPath string, in Params) (remotes []string) {
+	call := r.calls.Get(rcPath)
+	if call == nil {
+		return []string{"*"}
+	}
+	for key := range in {
+		remoteKey, declared := call.RemoteParams[key]
+		if !declared && !fsParamMatch.MatchString(key) {
+			continue
+		}
+		if !declared {
+			remoteKey = remoteParams[key]
+		}
+		fsString, err := getFsName(in, key)
+		if err != nil {
+			// the call will fail on its own with a bad fs
+			fsString = fmt.Sprint(in[key])
+		}
+		if declared && fsString == "" {
+			// unset optional parameter
+			continue
+		}
+		if remoteKey != "" {
+			if remote, err := in.GetString(remoteKey); err == nil && remote != "" {
+				fsString = strings.TrimSuffix(fsString, "/") + "/" + remote
+			}
+		}
+		remotes = append(remotes, fsString)
+	}
+	remotes = append(remotes, optionRemotes(in)...)
+	slices.Sort(remotes)
+	return remotes
+}
+
+// optionRemotes returns the remotes and local files named in the
+// _config and _filter parameters of an rc call.
+//
+// If either can't be read, or _config sets an option which isn't in
+// safeConfigOptions, then "*" is returned so only roles allowing all
+// remotes may make the call.
+func optionRemotes(in Params) (remotes []string) {
+	var options map[string]any
+	if err := in.GetStructMissingOK("_config", &options); err != nil {
+		return []string{"*"}
+	}
+	for name := range options {
+		if !safeConfigOptions[strings.ToLower(name)] {
+			return []string{"*"}
+		}
+	}
+	var ci fs.ConfigInfo
+	if err := in.GetStructMissingOK("_config", &ci); err != nil {
+		return []string{"*"}
+	}
+	if ci.BackupDir != "" {
+		remotes = append(remotes, ci.BackupDir)
+	}
+	remotes = append(remotes, ci.CompareDest...)
+	remotes = append(remotes, ci.CopyDest...)
+	var fi filter.Options
+	if err := in.GetStructMissingOK("_filter", &fi); err != nil {
+		return []string{"*"}
+	}
+	for _, files := range [][]string{
+		fi.FilesFrom, fi.FilesFromRaw,
+		fi.FilterFrom, fi.ExcludeFrom, fi.IncludeFrom,
+		fi.MetaRules.FilterFrom, fi.MetaRules.ExcludeFrom, fi.MetaRules.IncludeFrom,
+	} {
+		remotes = append(remotes, files...)
+	}
+	return remotes
+}
+
+// Check returns an error wrapping ErrAccessDenied unless user has a
+// role which allows the rc call rcPath with parameters in.
+//
+// The remotes in the parameters, including those named in the
+// RemoteParams of the call, must all be allowed by the role which
+// allows rcPath. This includes the remotes in the backup and compare
+// directories of _config and the local files _filter reads rules
+// from.
+func (r *Roles) Check(user, rcPath string, in Params) error {
+	fsStrings := r.remotes(rcPath, in)
+	for _, role := range r.userRoles(user) {
+		if !role.allowsPath(rcPath) {
+			continue
+		}
+		allowed := true
+		for _, fsString := range fsStrings {
+			if !role.allowsRemote(fsString) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return nil
+		}
+	}
+	if len(fsStrings) > 0 {
+		return fmt.Errorf("%w: user %q may not call %q on %q", ErrAccessDenied, user, rcPath, strings.Join(fsStrings, ", "))
+	}
+	return fmt.Errorf("%w: user %q may not call %q", ErrAccessDenied, user, rcPath)
+}
+
+// CheckRemote returns an error wrapping ErrAccessDenied unless user
+// has a role which allows access to remote.
+func (r *Roles) CheckRemote(user, remote string) error {
+	for _, role := range r.userRoles(user) {
+		if role.allowsRemote(remote) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: user %q may not access %q", ErrAccessDenied, user, remote)
+}
+
+// AccessFunc checks whether the rc call path with parameters in is
+// allowed, returning an error if not
+type AccessFunc func(path string, in Params) error
+
+type accessKey struct{}
+
+// WithAccess returns a new context which checks the rc calls made
+// with it using check
+func WithAccess(ctx context.Context, check AccessFunc) context.Context {
+	return context.WithValue(ctx, accessKey{}, check)
+}
+
+// CopyAccess returns dst with the access check from src if it has one
+//
+// Use this when making a new context which is unlinked from src so
+// the access checks aren't lost.
+func CopyAccess(dst, src context.Context) context.Context {
+	if check, ok := src.Value(accessKey{}).(AccessFunc); ok {
+		return WithAccess(dst, check)
+	}
+	return dst
+}
+
+// CheckAccess checks the rc call path with parameters in is allowed
+// by the access check in ctx. It returns nil if ctx doesn't have one.
+//
+// This should be used by rc calls which run other rc calls.
+func CheckAccess(ctx context.Context, path string, in Params) error {
+	if check, ok := ctx.Value(accessKey{}).(AccessFunc); ok {
+		return check(path, in)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package rc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRoles = `
+# roles
+@dashboard:core/stats,core/version,job/*:
+@backup:sync/copy,operations/*,job/*:s3:backups,/data
+@admin:*:*
+
+# users
+grafana:dashboard
+ci:backup,dashboard
+root:admin
+*:dashboard
+nobody:
+`
+
+func TestLoadRoles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles")
+	require.NoError(t, os.WriteFile(path, []byte(testRoles), 0600))
+	r, err := LoadRoles(path)
+	require.NoError(t, err)
+	assert.Len(t, r.roles, 3)
+	assert.Equal(t, []string{"sync/copy", "operations/*", "job/*"}, r.roles["backup"].Paths)
+	assert.Equal(t, []string{"s3:backups", "/data"}, r.roles["backup"].Remotes)
+	assert.Len(t, r.users["ci"], 2)
+	assert.Len(t, r.users["nobody"], 0)
+
+	_, err = LoadRoles(filepath.Join(t.TempDir(), "notfound"))
+	assert.ErrorContains(t, err, "failed to open roles file")
+}
+
+func TestParseRolesErrors(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"@role:paths", "role must be of the form"},
+		{"@:core/stats:", "role must be of the form"},
+		{"@a::\n@a::", "duplicate role"},
+		{"@a:[:", "bad path"},
+		{"user", "user must be of the form"},
+		{":role", "user must be of the form"},
+		{"@a::\nuser:a\nuser:a", "duplicate user"},
+		{"user:potato", "unknown role"},
+	} {
+		_, err := parseRoles(bufio.NewScanner(strings.NewReader(test.in)))
+		assert.ErrorContains(t, err, test.want, test.in)
+	}
+}
+
+func TestRolesCheck(t *testing.T) {
+	r, err := parseRoles(bufio.NewScanner(strings.NewReader(testRoles)))
+	require.NoError(t, err)
+	r.calls = NewRegistry()
+	for _, call := range []Call{
+		{Path: "core/stats"},
+		{Path: "core/command"},
+		{Path: "config/dump"},
+		{Path: "job/status"},
+		{Path: "sync/copy"},
+		{Path: "sync/sync"},
+		{Path: "operations/list"},
+		{Path: "operations/deletefile"},
+		{Path: "operations/copyfile"},
+		{Path: "operations/check", RemoteParams: map[string]string{"checkFileFs": "checkFileRemote"}},
+	} {
+		r.calls.Add(call)
+	}
+	for _, test := range []struct {
+		user string
+		path string
+		in   Params
+		ok   bool
+	}{
+		{"grafana", "core/stats", nil, true},
+		{"grafana", "job/status", Params{"jobid": 1}, true},
+		{"grafana", "core/command", Params{"command": "ls"}, false},
+		{"grafana", "operations/list", Params{"fs": "s3:backups"}, false},
+		{"ci", "core/stats", nil, true},
+		{"ci", "sync/copy", Params{"srcFs": "/data/docs", "dstFs": "s3:backups/docs"}, true},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/etc", "dstFs": "s3:backups"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data/../etc", "dstFs": "s3:backups"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups2"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3,endpoint=example.com:backups"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": Params{"type": "s3", "_root": "backups"}}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": Params{"_name": "s3", "_root": "backups"}}, true},
+		{"ci", "sync/sync", Params{"srcFs": "/data", "dstFs": "s3:backups"}, false},
+		{"ci", "operations/deletefile", Params{"fs": "s3:backups", "remote": "file.txt"}, true},
+		{"ci", "operations/deletefile", Params{"fs": "s3:backups", "remote": "../file.txt"}, false},
+		{"ci", "operations/copyfile", Params{"srcFs": "/data", "srcRemote": "a", "dstFs": "s3:", "dstRemote": "backups/a"}, true},
+		{"ci", "operations/list", Params{"fs": "/data", "path3": "/tmp"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"BackupDir": "s3:backups/old"}}, true},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"BackupDir": "s3:other"}}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": `{"CompareDest": ["/etc"]}`}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"CopyDest": []string{"s3:backups/x", "s3:other"}}}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": "not json"}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"checksum": true, "Transfers": 8}}, true},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"MetadataMapper": []string{"/bin/sh"}}}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": `{"ClientKey": "/etc/ssl/private/key.pem"}`}, false},
+		{"root", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"MetadataMapper": []string{"/bin/sh"}}}, true},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_filter": Params{"FilesFrom": []string{"/data/files.txt"}}}, true},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_filter": Params{"FilesFrom": []string{"/etc/shadow"}}}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_filter": Params{"ExcludeFrom": []string{"/etc/shadow"}}}, false},
+		{"ci", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_filter": Params{"MetaRules": Params{"IncludeFrom": []string{"/etc/shadow"}}}}, false},
+		{"root", "sync/copy", Params{"srcFs": "/data", "dstFs": "s3:backups", "_config": Params{"BackupDir": "s3:other"}, "_filter": Params{"FilesFrom": []string{"/etc/shadow"}}}, true},
+		{"ci", "operations/check", Params{"srcFs": "/data", "dstFs": "s3:backups", "checkFileFs": "/data", "checkFileRemote": "sums.md5"}, true},
+		{"ci", "operations/check", Params{"srcFs": "/data", "dstFs": "s3:backups", "checkFileFs": "/data", "checkFileRemote": "../etc/shadow"}, false},
+		{"ci", "operations/check", Params{"srcFs": "/data", "dstFs": "s3:backups", "checkFileFs": "/etc"}, false},
+		{"ci", "operations/unknown", Params{"srcFs": "/data"}, false},
+		{"root", "operations/unknown", Params{"srcFs": "/data"}, true},
+		{"root", "core/command", Params{"command": "ls"}, true},
+		{"root", "sync/sync", Params{"srcFs": ":s3,env_auth:", "dstFs": "/"}, true},
+		{"", "core/stats", nil, true},
+		{"unknown", "core/stats", nil, true},
+		{"", "config/dump", nil, false},
+		{"nobody", "core/stats", nil, false},
+	} {
+		err := r.Check(test.user, test.path, test.in)
+		if test.ok {
+			assert.NoError(t, err, "%s %s %v", test.user, test.path, test.in)
+		} else {
+			assert.True(t, errors.Is(err, ErrAccessDenied), "%s %s %v: %v", test.user, test.path, test.in, err)
+		}
+	}
+
+	assert.NoError(t, r.CheckRemote("ci", "/data/file.txt"))
+	assert.Error(t, r.CheckRemote("ci", "*"))
+	assert.NoError(t, r.CheckRemote("root", "*"))
+	assert.Error(t, r.CheckRemote("grafana", "s3:backups"))
+
+	err = r.Check("ci", "sync/copy", Params{"srcFs": "/etc", "dstFs": "s3:"})
+	assert.EqualError(t, err, `access denied: user "ci" may not call "sync/copy" on "/etc, s3:"`)
+	_, status := Error("sync/copy", nil, err, 500)
+	assert.Equal(t, 403, status)
+}
+
+func TestCheckAccess(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, CheckAccess(ctx, "core/command", nil))
+
+	check := func(path string, in Params) error {
+		if path != "core/stats" {
+			return ErrAccessDenied
+		}
+		return nil
+	}
+	ctx = WithAccess(ctx, check)
+	assert.NoError(t, CheckAccess(ctx, "core/stats", nil))
+	assert.Equal(t, ErrAccessDenied, CheckAccess(ctx, "core/command", nil))
+
+	unlinked := CopyAccess(context.Background(), ctx)
+	assert.Equal(t, ErrAccessDenied, CheckAccess(unlinked, "core/command", nil))
+	assert.NoError(t, CheckAccess(CopyAccess(context.Background(), context.Background()), "core/command", nil))
+}
@@ -0,0 +1,173 @@
+package schedule
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rclone/rclone/fs/rc"
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/add",
+		AuthRequired: true, // require auth always since the scheduled command may require it
+		Fn:           rcAdd,
+		Title:        "Run an rc command on a cron schedule.",
+		Help: strings.ReplaceAll(`
+This adds a schedule which runs an rc command whenever a cron
+expression matches. The schedules are only run by |rclone rcd|.
+Other rclone commands run with |--rc| can add, list and remove
+schedules but don't run them.
+
+Parameters:
+
+- cron - cron expression saying when to run the command (string)
+- command - rc command to run, e.g. |sync/sync| (string)
+- params - parameters for the command (object, optional)
+- name - name of the schedule (string, optional) - one is made up if not set
+- keep - number of results to keep (integer, optional) - default 10
+
+The cron expression has the standard 5 fields
+
+    minute hour day-of-month month day-of-week
+
+Each field can be |*|, a number, a range like |1-5|, a list like
+|1,3,5| and can have a step like |*/15|. Months and days of the week
+can be given by name, e.g. |jan| or |mon|. The macros |@yearly|,
+|@monthly|, |@weekly|, |@daily| and |@hourly| can be used instead.
+Times are in the local time zone.
+
+The params can contain the special parameters |_config|, |_filter| and
+|_group|. If |_group| isn't set the stats for each run are put in the
+group |schedule/NAME|.
+
+If |--rc-roles| is in use the user adding the schedule must be
+allowed to run the command with its parameters.
+
+A run is skipped if the previous run of the same schedule is still
+running and this is recorded in its results.
+
+The schedules are saved in |schedules.json| in the same directory as
+the config file so they survive a restart. If rclone has no config
+file they are kept in memory only. Each change re-reads the file
+while holding a lock on it so rclones sharing it don't lose each
+other's schedules, and a running |rclone rcd| picks up schedules
+added by others within a minute.
+
+The params are saved unencrypted, including any secrets in them, in
+a file only readable by the user running rclone. Prefer remotes from
+the config file, which can be encrypted, to credentials in the params.
+
+Example
+
+    rclone rc schedule/add name=nightly cron="30 2 * * *" command=sync/sync \
+        params='{"srcFs": "/home/user/docs", "dstFs": "remote:docs"}'
+
+Results:
+
+- name - name of the schedule
+- next - time of the next run if the scheduler is running
+
+along with the other values returned by schedule/list for the
+schedule.
+`, "|", "`"),
+	})
+}
+
+// Add a schedule
+func rcAdd(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	cron, err := in.GetString("cron")
+	if err != nil {
+		return nil, err
+	}
+	command, err := in.GetString("command")
+	if err != nil {
+		return nil, err
+	}
+	var params rc.Params
+	if err = in.GetStructMissingOK("params", &params); err != nil {
+		return nil, err
+	}
+	name, err := in.GetString("name")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	keep, err := in.GetInt64("keep")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	// the user adding the schedule must be allowed to run it
+	if err = rc.CheckAccess(ctx, command, params); err != nil {
+		return nil, err
+	}
+	out, err = scheduler.Add(name, cron, command, params, int(keep))
+	if err != nil {
+		return nil, rc.NewErrParamInvalid(err)
+	}
+	return out, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "schedule/list",
+		Fn:    rcList,
+		Title: "List the scheduled rc commands.",
+		Help: `Parameters: None.
+
+Results:
+
+- schedules - array of schedules sorted by name, each with
+    - name - name of the schedule
+    - cron - cron expression
+    - command - rc command run
+    - params - parameters for the command
+    - keep - number of results kept
+    - running - true if a run is in progress
+    - next - time of the next run if the scheduler is running
+    - results - the most recent results, oldest first, each with
+        - jobid - id of the job which ran the command
+        - startTime - time the run started
+        - endTime - time the run finished
+        - duration - time in seconds the run took
+        - success - true if the run succeeded
+        - skipped - true if the run was skipped as the previous one was still running
+        - error - error from the run or empty string
+        - output - output of the command
+`,
+	})
+}
+
+// List the schedules
+func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	return rc.Params{
+		"schedules": scheduler.List(),
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/remove",
+		AuthRequired: true,
+		Fn:           rcRemove,
+		Title:        "Remove a scheduled rc command.",
+		Help: `Parameters:
+
+- name - name of the schedule to remove (string)
+
+A run of the schedule which is in progress is not stopped - use
+job/stop or job/stopgroup for that.
+`,
+	})
+}
+
+// Remove a schedule
+func rcRemove(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	name, err := in.GetString("name")
+	if err != nil {
+		return nil, err
+	}
+	if err = scheduler.Remove(name); err != nil {
+		return nil, rc.NewErrParamInvalid(err)
+	}
+	return rc.Params{}, nil
+}
@@ -0,0 +1,542 @@
+// Package schedule runs rc calls on a cron schedule.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	"github.com/rclone/rclone/lib/file"
+)
+
+// DefaultKeep is the number of results kept for each schedule if not set
+const DefaultKeep = 10
+
+// fileName is the name of the file the schedules are saved in the
+// config directory
+const fileName = "schedules.json"
+
+// reloadEvery is how often a running scheduler reads the file to find
+// schedules added, changed or removed by other rclones
+const reloadEvery = time.Minute
+
+// Result describes one run of a schedule
+type Result struct {
+	JobID     int64     `json:"jobid"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  float64   `json:"duration"`
+	Success   bool      `json:"success"`
+	Skipped   bool      `json:"skipped"`
+	Error     string    `json:"error"`
+	Output    rc.Params `json:"output,omitempty"`
+}
+
+// Schedule describes an rc call which is run on a cron schedule
+type Schedule struct {
+	Name    string    `json:"name"`
+	Cron    string    `json:"cron"`
+	Command string    `json:"command"`
+	Params  rc.Params `json:"params"`
+	Keep    int       `json:"keep"`    // number of results to keep
+	Results []Result  `json:"results"` // most recent last
+
+	spec    *cronSpec
+	timer   *time.Timer
+	next    time.Time
+	running bool
+}
+
+// Scheduler runs the schedules
+type Scheduler struct {
+	mu        sync.Mutex
+	ctx       context.Context // set when started
+	getPath   func() string   // returns the file to save the schedules in
+	path      string          // file the schedules are saved in or "" for none
+	loaded    bool
+	schedules map[string]*Schedule
+}
+
+// The global scheduler used by the rc calls
+var scheduler = newScheduler(configFile)
+
+// configFile returns the file the schedules are saved in or "" if
+// there is no config file
+func configFile() string {
+	configPath := config.GetConfigPath()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), fileName)
+}
+
+func newScheduler(getPath func() string) *Scheduler {
+	return &Scheduler{
+		getPath:   getPath,
+		schedules: map[string]*Schedule{},
+	}
+}
+
+// Start runs the saved schedules and any added later until ctx is
+// cancelled.
+func Start(ctx context.Context) {
+	scheduler.Start(ctx)
+}
+
+// Start runs the saved schedules and any added later until ctx is
+// cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return
+	}
+	s.ctx = ctx
+	s.reload()
+	for _, sch := range s.schedules {
+		s.arm(sch)
+	}
+	if len(s.schedules) > 0 {
+		fs.Infof(nil, "rc: started %d scheduled jobs", len(s.schedules))
+	}
+	go func() {
+		ticker := time.NewTicker(reloadEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.mu.Lock()
+				s.reload()
+				s.mu.Unlock()
+			case <-ctx.Done():
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				for _, sch := range s.schedules {
+					s.disarm(sch)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// lockFile takes a lock on the file the schedules are saved in so
+// other rclones can't change it until unlock is called - call with
+// s.mu held.
+//
+// The path is found on first use rather than at startup so that the
+// --config flag has been read.
+func (s *Scheduler) lockFile() (unlock func()) {
+	if !s.loaded {
+		s.loaded = true
+		s.path = s.getPath()
+	}
+	if s.path == "" {
+		return func() {}
+	}
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err == nil {
+		err = file.Lock(lock)
+		if err != nil {
+			_ = lock.Close()
+		}
+	}
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to lock schedules: %v", err)
+		return func() {}
+	}
+	return func() {
+		_ = file.Unlock(lock)
+		_ = lock.Close()
+	}
+}
+
+// reload reads the schedules from the file merging in any changes
+// other rclones sharing it have made - call with s.mu held.
+func (s *Scheduler) reload() {
+	unlock := s.lockFile()
+	defer unlock()
+	s.read()
+}
+
+// update reads the schedules from the file, calls fn to change them
+// and saves them again, holding the lock on the file throughout so
+// changes made by other rclones sharing it aren't lost - call with
+// s.mu held.
+func (s *Scheduler) update(fn func() error) error {
+	unlock := s.lockFile()
+	defer unlock()
+	s.read()
+	if err := fn(); err != nil {
+		return err
+	}
+	s.save()
+	return nil
+}
+
+// read the schedules from the file and merge them with the ones in
+// memory - call with s.mu held and the file locked.
+//
+// The file is the master copy so schedules which aren't in it have
+// been removed and ones which differ have been changed. The results
+// from both are kept.
+//
+// Errors are logged as they shouldn't stop the rc from working.
+func (s *Scheduler) read() {
+	if s.path == "" {
+		return
+	}
+	var saved []*Schedule
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// no schedules saved yet
+	} else if err != nil {
+		fs.Errorf(nil, "rc: failed to read schedules: %v", err)
+		return
+	} else if err = json.Unmarshal(data, &saved); err != nil {
+		fs.Errorf(nil, "rc: failed to parse schedules in %q: %v", s.path, err)
+		return
+	}
+	found := make(map[string]struct{}, len(saved))
+	for _, newSch := range saved {
+		found[newSch.Name] = struct{}{}
+		sch := s.schedules[newSch.Name]
+		if sch != nil && sch.sameAs(newSch) {
+			sch.Keep = newSch.Keep
+			sch.Results = mergeResults(sch.Results, newSch.Results, sch.Keep)
+			continue
+		}
+		newSch.spec, err = parseCron(newSch.Cron)
+		if err != nil {
+			fs.Errorf(nil, "rc: ignoring schedule %q: %v", newSch.Name, err)
+			continue
+		}
+		if sch != nil {
+			s.disarm(sch)
+		}
+		s.schedules[newSch.Name] = newSch
+		s.arm(newSch)
+	}
+	for name, sch := range s.schedules {
+		if _, ok := found[name]; !ok {
+			s.disarm(sch)
+			delete(s.schedules, name)
+		}
+	}
+}
+
+// sameAs returns true if sch and other run the same command at the
+// same times
+func (sch *Schedule) sameAs(other *Schedule) bool {
+	if sch.Cron != other.Cron || sch.Command != other.Command {
+		return false
+	}
+	// Compare the params as JSON as that is how they are saved
+	params, err1 := json.Marshal(sch.Params)
+	otherParams, err2 := json.Marshal(other.Params)
+	return err1 == nil && err2 == nil && string(params) == string(otherParams)
+}
+
+// mergeResults returns the results in a and b without duplicates
+// sorted by the time they finished keeping only the last keep
+func mergeResults(a, b []Result, keep int) []Result {
+	results := make([]Result, 0, len(a)+len(b))
+	type key struct {
+		jobID int64
+		start int64
+	}
+	seen := make(map[key]struct{}, len(a)+len(b))
+	for _, result := range append(append([]Result(nil), a...), b...) {
+		k := key{result.JobID, result.StartTime.UnixNano()}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].EndTime.Before(results[j].EndTime)
+	})
+	if len(results) > keep {
+		results = results[len(results)-keep:]
+	}
+	return results
+}
+
+// save the schedules to the file - call with s.mu held and the file
+// locked
+//
+// The file is only readable by the user as the params may contain
+// secrets.
+func (s *Scheduler) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.list(), "", "\t")
+	if err == nil {
+		tmp := s.path + ".tmp"
+		// Remove any left over temporary file so it is created
+		// with the permissions below
+		_ = os.Remove(tmp)
+		err = os.WriteFile(tmp, data, 0o600)
+		if err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to save schedules: %v", err)
+	}
+}
+
+// list returns the schedules sorted by name - call with the lock held
+func (s *Scheduler) list() []*Schedule {
+	schedules := make([]*Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		schedules = append(schedules, sch)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+	return schedules
+}
+
+// arm sets the timer for the next run of sch if the scheduler is
+// running - call with the lock held
+func (s *Scheduler) arm(sch *Schedule) {
+	if s.ctx == nil || s.ctx.Err() != nil {
+		return
+	}
+	next, err := sch.spec.next(time.Now())
+	if err != nil {
+		fs.Errorf(nil, "rc: schedule %q: %v", sch.Name, err)
+		return
+	}
+	sch.next = next
+	sch.timer = time.AfterFunc(time.Until(next), func() {
+		s.fire(sch)
+	})
+}
+
+// disarm stops the timer of sch - call with the lock held
+func (s *Scheduler) disarm(sch *Schedule) {
+	if sch.timer != nil {
+		sch.timer.Stop()
+		sch.timer = nil
+	}
+	sch.next = time.Time{}
+}
+
+// fire is called when the timer for sch goes off
+func (s *Scheduler) fire(sch *Schedule) {
+	s.mu.Lock()
+	if s.schedules[sch.Name] != sch {
+		// schedule was removed
+		s.mu.Unlock()
+		return
+	}
+	s.arm(sch)
+	if sch.running {
+		fs.Logf(nil, "rc: schedule %q: skipping run as the previous one is still running", sch.Name)
+		now := time.Now()
+		s.addResult(sch, Result{
+			StartTime: now,
+			EndTime:   now,
+			Skipped:   true,
+			Error:     "skipped as the previous run was still running",
+		})
+		s.mu.Unlock()
+		return
+	}
+	sch.running = true
+	ctx, command, params := s.ctx, sch.Command, sch.Params
+	s.mu.Unlock()
+
+	result := run(ctx, sch.Name, command, params)
+
+	s.mu.Lock()
+	sch.running = false
+	s.addResult(sch, result)
+	s.mu.Unlock()
+}
+
+// addResult adds result to sch and saves it unless sch has been
+// removed or changed - call with s.mu held
+func (s *Scheduler) addResult(sch *Schedule, result Result) {
+	_ = s.update(func() error {
+		if s.schedules[sch.Name] == sch {
+			sch.addResult(result)
+		}
+		return nil
+	})
+}
+
+// run the command with params and return the result
+func run(ctx context.Context, name, command string, params rc.Params) (result Result) {
+	result.StartTime = time.Now()
+	defer func() {
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(result.StartTime).Seconds()
+		result.Success = result.Error == ""
+	}()
+	call, err := findCall(command)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	in := params.Copy()
+	if in == nil {
+		in = rc.Params{}
+	}
+	// run the job async so it is recorded in the job history, but
+	// wait for it to finish so runs can't overlap
+	in["_async"] = true
+	in["_path"] = command
+	if _, found := in["_group"]; !found {
+		in["_group"] = "schedule/" + name
+	}
+	fs.Infof(nil, "rc: schedule %q: running %q", name, command)
+	job, _, err := jobs.NewJob(ctx, call.Fn, in)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.JobID = job.ID
+		finished := make(chan struct{})
+		job.OnFinish(func() { close(finished) })
+		<-finished
+		result.Output = job.Output
+		result.Error = job.Error
+	}
+	if result.Error != "" {
+		fs.Errorf(nil, "rc: schedule %q: %q failed: %s", name, command, result.Error)
+	}
+	return result
+}
+
+// findCall finds the rc call for command checking it can be scheduled
+func findCall(command string) (*rc.Call, error) {
+	call := rc.Calls.Get(command)
+	if call == nil {
+		return nil, fmt.Errorf("couldn't find path %q", command)
+	}
+	if call.NeedsRequest || call.NeedsResponse {
+		return nil, fmt.Errorf("can't schedule path %q as it needs the HTTP request", command)
+	}
+	return call, nil
+}
+
+// addResult adds result keeping only the last sch.Keep
+func (sch *Schedule) addResult(result Result) {
+	sch.Results = append(sch.Results, result)
+	if len(sch.Results) > sch.Keep {
+		sch.Results = append([]Result(nil), sch.Results[len(sch.Results)-sch.Keep:]...)
+	}
+}
+
+// Add adds a new schedule which runs command with params whenever the
+// cron expression matches.
+//
+// If name is empty one will be made up. keep is the number of results
+// to keep, or 0 for the default.
+//
+// It returns the status of the new schedule.
+func (s *Scheduler) Add(name, cron, command string, params rc.Params, keep int) (rc.Params, error) {
+	spec, err := parseCron(cron)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = findCall(command); err != nil {
+		return nil, err
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("number of results to keep must be positive: %d", keep)
+	} else if keep == 0 {
+		keep = DefaultKeep
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sch *Schedule
+	err = s.update(func() error {
+		if name == "" {
+			for i := 1; ; i++ {
+				name = fmt.Sprintf("schedule%d", i)
+				if _, found := s.schedules[name]; !found {
+					break
+				}
+			}
+		} else if _, found := s.schedules[name]; found {
+			return fmt.Errorf("schedule %q already exists", name)
+		}
+		sch = &Schedule{
+			Name:    name,
+			Cron:    cron,
+			Command: command,
+			Params:  params,
+			Keep:    keep,
+			Results: []Result{},
+			spec:    spec,
+		}
+		s.schedules[name] = sch
+		s.arm(sch)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sch.status(), nil
+}
+
+// Remove removes the schedule called name.
+//
+// A run of the schedule in progress is not stopped.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func() error {
+		sch, found := s.schedules[name]
+		if !found {
+			return fmt.Errorf("schedule %q not found", name)
+		}
+		s.disarm(sch)
+		delete(s.schedules, name)
+		return nil
+	})
+}
+
+// status returns the rc description of sch - call with the lock held
+func (sch *Schedule) status() rc.Params {
+	out := rc.Params{
+		"name":    sch.Name,
+		"cron":    sch.Cron,
+		"command": sch.Command,
+		"params":  sch.Params,
+		"keep":    sch.Keep,
+		"results": append([]Result{}, sch.Results...),
+		"running": sch.running,
+	}
+	if !sch.next.IsZero() {
+		out["next"] = sch.next
+	}
+	return out
+}
+
+// List returns the status of all the schedules sorted by name
+func (s *Scheduler) List() []rc.Params {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload()
+	out := []rc.Params{}
+	for _, sch := range s.list() {
+		out = append(out, sch.status())
+	}
+	return out
+}
@@ -0,0 +1,250 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronNext(t *testing.T) {
+	// Tuesday
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, test := range []struct {
+		cron string
+		want []string
+	}{
+		{"* * * * *", []string{"2024-01-02 03:05", "2024-01-02 03:06"}},
+		{"*/15 * * * *", []string{"2024-01-02 03:15", "2024-01-02 03:30", "2024-01-02 03:45", "2024-01-02 04:00"}},
+		{"30 2 * * *", []string{"2024-01-03 02:30", "2024-01-04 02:30"}},
+		{"@hourly", []string{"2024-01-02 04:00", "2024-01-02 05:00"}},
+		{"@daily", []string{"2024-01-03 00:00"}},
+		{"0 9-17/4 * * mon-fri", []string{"2024-01-02 09:00", "2024-01-02 13:00", "2024-01-02 17:00", "2024-01-03 09:00"}},
+		{"0 0 * * 7", []string{"2024-01-07 00:00", "2024-01-14 00:00"}},
+		{"0 0 1,15 * *", []string{"2024-01-15 00:00", "2024-02-01 00:00"}},
+		{"0 0 29 feb *", []string{"2024-02-29 00:00", "2028-02-29 00:00"}},
+		// either day of month or day of week matches if both are set
+		{"0 0 10 * fri", []string{"2024-01-05 00:00", "2024-01-10 00:00", "2024-01-12 00:00"}},
+		{"5/20 0 * * *", []string{"2024-01-03 00:05", "2024-01-03 00:25", "2024-01-03 00:45"}},
+	} {
+		spec, err := parseCron(test.cron)
+		require.NoError(t, err, test.cron)
+		next := start
+		for _, want := range test.want {
+			next, err = spec.next(next)
+			require.NoError(t, err, test.cron)
+			assert.Equal(t, want, next.Format("2006-01-02 15:04"), test.cron)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, cron := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"@fortnightly",
+	} {
+		_, err := parseCron(cron)
+		assert.Error(t, err, cron)
+	}
+
+	spec, err := parseCron("0 0 31 feb *")
+	require.NoError(t, err)
+	_, err = spec.next(time.Now())
+	assert.Equal(t, errNoNextTime, err)
+}
+
+// used by rc/scheduleTestBlock to signal it has started and wait to be released
+var (
+	blockStarted = make(chan struct{})
+	blockRelease = make(chan struct{})
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path: "rc/scheduleTestBlock",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			blockStarted <- struct{}{}
+			<-blockRelease
+			return rc.Params{"in": in}, nil
+		},
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), fileName)
+	s := newScheduler(func() string { return path })
+	s.Start(ctx)
+
+	// bad schedules are refused
+	_, err := s.Add("", "* * *", "rc/noop", nil, 0)
+	assert.ErrorContains(t, err, "must have 5 fields")
+	_, err = s.Add("", "* * * * *", "rc/notfound", nil, 0)
+	assert.ErrorContains(t, err, "couldn't find path")
+
+	out, err := s.Add("", "@daily", "rc/noop", rc.Params{"a": "b"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "schedule1", out["name"])
+	assert.Equal(t, DefaultKeep, out["keep"])
+	assert.True(t, out["next"].(time.Time).After(time.Now()))
+	_, err = s.Add("block", "@daily", "rc/scheduleTestBlock", nil, 2)
+	require.NoError(t, err)
+	_, err = s.Add("block", "@daily", "rc/noop", nil, 0)
+	assert.ErrorContains(t, err, "already exists")
+
+	// a run records its result
+	sch := s.schedules["schedule1"]
+	s.fire(sch)
+	list := s.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "block", list[0]["name"])
+	assert.Equal(t, "schedule1", list[1]["name"])
+	results := list[1]["results"].([]Result)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Success)
+	assert.NotZero(t, results[0].JobID)
+	assert.Equal(t, "b", results[0].Output["a"])
+
+	// overlapping runs are skipped
+	block := s.schedules["block"]
+	done := make(chan struct{})
+	go func() {
+		s.fire(block)
+		close(done)
+	}()
+	<-blockStarted
+	assert.Equal(t, true, s.List()[0]["running"])
+	s.fire(block)
+	s.fire(block)
+	blockRelease <- struct{}{}
+	<-done
+	results = s.List()[0]["results"].([]Result)
+	require.Len(t, results, 2, "only keep results are kept")
+	assert.True(t, results[0].Skipped)
+	assert.False(t, results[1].Skipped)
+	assert.True(t, results[1].Success)
+
+	// the schedules are saved
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var saved []*Schedule
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Len(t, saved, 2)
+	assert.Equal(t, "rc/noop", saved[1].Command)
+	assert.Len(t, saved[1].Results, 1)
+
+	// and loaded again
+	s2 := newScheduler(func() string { return path })
+	list = s2.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "@daily", list[1]["cron"])
+	assert.Nil(t, list[1]["next"], "not running")
+
+	require.NoError(t, s.Remove("schedule1"))
+	assert.ErrorContains(t, s.Remove("schedule1"), "not found")
+	require.Len(t, s.List(), 1)
+	s3 := newScheduler(func() string { return path })
+	require.Len(t, s3.List(), 1)
+}
+
+func TestSchedulerShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), fileName)
+	s1 := newScheduler(func() string { return path })
+	s1.Start(ctx)
+	s2 := newScheduler(func() string { return path })
+
+	// schedules added by either are kept
+	_, err := s1.Add("one", "@daily", "rc/noop", rc.Params{"a": 1}, 0)
+	require.NoError(t, err)
+	_, err = s2.Add("two", "@daily", "rc/noop", nil, 0)
+	require.NoError(t, err)
+	_, err = s2.Add("one", "@hourly", "rc/noop", nil, 0)
+	assert.ErrorContains(t, err, "already exists")
+	require.Len(t, s1.List(), 2)
+	require.Len(t, s2.List(), 2)
+
+	// the running scheduler arms schedules added by the other
+	s1.mu.Lock()
+	assert.NotNil(t, s1.schedules["two"].timer)
+	s1.mu.Unlock()
+
+	// results are kept when the other saves
+	s1.mu.Lock()
+	one := s1.schedules["one"]
+	s1.mu.Unlock()
+	s1.fire(one)
+	_, err = s2.Add("three", "@daily", "rc/noop", nil, 0)
+	require.NoError(t, err)
+	list := s1.List()
+	require.Len(t, list, 3)
+	assert.Len(t, list[0]["results"].([]Result), 1)
+	assert.Equal(t, rc.Params{"a": 1}, list[0]["params"], "unchanged schedule keeps its params")
+
+	// and removals by the other are seen
+	require.NoError(t, s2.Remove("one"))
+	list = s1.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "three", list[0]["name"])
+	assert.Nil(t, one.timer, "removed schedule is disarmed")
+
+	// the file is only readable by the user
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	}
+}
+
+func TestRcSchedule(t *testing.T) {
+	old := scheduler
+	defer func() { scheduler = old }()
+	scheduler = newScheduler(func() string { return "" })
+
+	call := rc.Calls.Get("schedule/add")
+	require.NotNil(t, call)
+	out, err := call.Fn(context.Background(), rc.Params{
+		"name":    "test",
+		"cron":    "0 * * * *",
+		"command": "rc/noop",
+		"params":  `{"potato": 1}`,
+		"keep":    3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test", out["name"])
+
+	call = rc.Calls.Get("schedule/list")
+	require.NotNil(t, call)
+	out, err = call.Fn(context.Background(), nil)
+	require.NoError(t, err)
+	schedules := out["schedules"].([]rc.Params)
+	require.Len(t, schedules, 1)
+	assert.Equal(t, rc.Params{"potato": float64(1)}, schedules[0]["params"])
+	assert.Equal(t, 3, schedules[0]["keep"])
+
+	call = rc.Calls.Get("schedule/remove")
+	require.NotNil(t, call)
+	_, err = call.Fn(context.Background(), rc.Params{"name": "test"})
+	require.NoError(t, err)
+	_, err = call.Fn(context.Background(), rc.Params{"name": "test"})
+	assert.True(t, rc.IsErrParamInvalid(err))
+}
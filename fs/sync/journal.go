@@ -0,0 +1,432 @@
+package sync
+
+// The sync journal records the progress of a sync on disk so that an
+// interrupted sync can carry on where it left off.
+//
+// It records the files which have been transferred or found to be
+// up to date, and the directories whose entire contents have been
+// done. When the sync is run again, directories which are done
+// aren't listed at all and files which are done aren't checked.
+//
+// A directory is done when all its files are done, all its
+// subdirectories are done and there was nothing to delete in it.
+// When a directory is done the records for its files and
+// subdirectories are removed as the directory record covers them,
+// which keeps the journal small.
+//
+// The journal is removed when the sync completes without errors. It
+// is discarded if it was started longer ago than
+// --sync-journal-max-age so a sync which never completes without
+// errors still checks the done directories again eventually.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+const (
+	journalFacility   = "syncjournal"    // name of the kv database
+	journalBatchSize  = 1000             // flush the journal after this many changes
+	journalFlushEvery = 10 * time.Second // flush the journal at least this often
+)
+
+// journalDir tracks the progress of a directory in this run
+type journalDir struct {
+	dir      string      // path of the directory
+	parent   *journalDir // parent directory or nil for the root
+	pending  int         // things to do before the directory is done
+	failed   bool        // set if anything in the directory failed
+	files    []string    // keys of the files recorded in this directory
+	children []string    // keys of the subdirectories which are done
+}
+
+// journal records the progress of a sync
+type journal struct {
+	db     *kv.DB
+	prefix string // key prefix for this sync
+
+	mu          sync.Mutex
+	dirs        map[string]*journalDir // directories in progress
+	doneDirs    map[string]struct{}    // directories done in a previous run
+	doneFiles   map[string]string      // fingerprints of files done in a previous run
+	loadedFiles map[string][]string    // keys of files from a previous run by directory
+	started     time.Time              // when the first run using the journal started
+	batch       map[string][]byte      // changes to write - nil value means delete
+
+	flushMu sync.Mutex    // serialises flushes
+	stop    chan struct{} // close to stop the background flusher
+	wg      sync.WaitGroup
+}
+
+// parentDir returns the directory of remote with the root being ""
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// journalPrefix returns the key prefix for a sync with these
+// parameters. Anything which changes what the sync does should be
+// in here so a different sync doesn't use the wrong journal.
+func journalPrefix(ctx context.Context, fdst, fsrc fs.Fs, dir string, deleteMode fs.DeleteMode) string {
+	ci := fs.GetConfig(ctx)
+	// The flags which change whether a file is up to date
+	compare := fmt.Sprintf("checksum=%v size-only=%v ignore-times=%v ignore-size=%v ignore-checksum=%v ignore-existing=%v update=%v modify-window=%v immutable=%v ignore-case-sync=%v no-check-dest=%v no-update-modtime=%v metadata=%v compare-dest=%q copy-dest=%q",
+		ci.CheckSum, ci.SizeOnly, ci.IgnoreTimes, ci.IgnoreSize, ci.IgnoreChecksum, ci.IgnoreExisting, ci.UpdateOlder, ci.ModifyWindow, ci.Immutable, ci.IgnoreCaseSync, ci.NoCheckDest, ci.NoUpdateModTime, ci.Metadata, ci.CompareDest, ci.CopyDest)
+	h := sha256.New()
+	for _, s := range []string{
+		fs.ConfigString(fsrc),
+		fs.ConfigString(fdst),
+		dir,
+		strconv.Itoa(int(deleteMode)),
+		filter.GetConfig(ctx).DumpFilters(),
+		compare,
+	} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16] + "/"
+}
+
+// newJournal opens the journal for the sync and loads any progress
+// from a previous run
+func newJournal(ctx context.Context, fdst, fsrc fs.Fs, dir string, deleteMode fs.DeleteMode) (j *journal, err error) {
+	db, err := kv.Start(ctx, journalFacility, fdst)
+	if err != nil {
+		return nil, err
+	}
+	j = &journal{
+		db:          db,
+		prefix:      journalPrefix(ctx, fdst, fsrc, dir, deleteMode),
+		dirs:        make(map[string]*journalDir),
+		doneDirs:    make(map[string]struct{}),
+		doneFiles:   make(map[string]string),
+		loadedFiles: make(map[string][]string),
+		batch:       make(map[string][]byte),
+		stop:        make(chan struct{}),
+	}
+	err = db.Do(false, &opJournalLoad{j: j})
+	if err != nil && err != kv.ErrEmpty {
+		_ = db.Stop(false)
+		return nil, err
+	}
+	maxAge := time.Duration(fs.GetConfig(ctx).SyncJournalMaxAge)
+	if !j.started.IsZero() && maxAge > 0 && time.Since(j.started) > maxAge {
+		fs.Infof(fdst, "Discarding sync journal started %v ago as it is older than --sync-journal-max-age %v", time.Since(j.started).Truncate(time.Second), fs.Duration(maxAge))
+		err = db.Do(true, &opJournalClear{prefix: j.prefix})
+		if err != nil {
+			_ = db.Stop(false)
+			return nil, err
+		}
+		j.doneDirs = make(map[string]struct{})
+		j.doneFiles = make(map[string]string)
+		j.loadedFiles = make(map[string][]string)
+		j.started = time.Time{}
+	}
+	if j.started.IsZero() {
+		j.started = time.Now()
+		j.batch[j.startedKey()] = []byte(j.started.Format(time.RFC3339Nano))
+	}
+	if len(j.doneDirs) > 0 || len(j.doneFiles) > 0 {
+		fs.Infof(fdst, "Resuming sync from journal with %d directories and %d files done", len(j.doneDirs), len(j.doneFiles))
+	}
+	// The root is done when it has been listed
+	j.dirs[dir] = &journalDir{dir: dir, pending: 1}
+	j.wg.Go(j.flusher)
+	return j, nil
+}
+
+// dirKey returns the key for a directory
+func (j *journal) dirKey(dir string) string {
+	return j.prefix + "d/" + dir
+}
+
+// fileKey returns the key for a file
+func (j *journal) fileKey(remote string) string {
+	return j.prefix + "f/" + remote
+}
+
+// startedKey returns the key for when the journal was started
+func (j *journal) startedKey() string {
+	return j.prefix + "t"
+}
+
+// opJournalLoad loads the progress from the journal
+type opJournalLoad struct {
+	j *journal
+}
+
+// Do the load
+func (op *opJournalLoad) Do(ctx context.Context, b kv.Bucket) error {
+	j := op.j
+	prefix := []byte(j.prefix)
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		key := string(k[len(prefix):])
+		switch {
+		case len(key) >= 2 && key[:2] == "d/":
+			j.doneDirs[key[2:]] = struct{}{}
+		case len(key) >= 2 && key[:2] == "f/":
+			remote := key[2:]
+			j.doneFiles[remote] = string(v)
+			dir := parentDir(remote)
+			j.loadedFiles[dir] = append(j.loadedFiles[dir], string(k))
+		case key == "t":
+			started, err := time.Parse(time.RFC3339Nano, string(v))
+			if err == nil {
+				j.started = started
+			}
+		}
+	}
+	return nil
+}
+
+// opJournalWrite writes a batch of changes to the journal
+type opJournalWrite struct {
+	batch map[string][]byte
+}
+
+// Do the write
+func (op *opJournalWrite) Do(ctx context.Context, b kv.Bucket) error {
+	for k, v := range op.batch {
+		var err error
+		if v == nil {
+			err = b.Delete([]byte(k))
+		} else {
+			err = b.Put([]byte(k), v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// opJournalClear removes all the records with a prefix
+type opJournalClear struct {
+	prefix string
+}
+
+// Do the clear
+func (op *opJournalClear) Do(ctx context.Context, b kv.Bucket) error {
+	prefix := []byte(op.prefix)
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flusher flushes the journal periodically until stopped
+func (j *journal) flusher() {
+	ticker := time.NewTicker(journalFlushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.flush()
+		}
+	}
+}
+
+// flush the pending changes to disk
+func (j *journal) flush() {
+	j.flushMu.Lock()
+	defer j.flushMu.Unlock()
+	j.mu.Lock()
+	batch := j.batch
+	j.batch = make(map[string][]byte)
+	j.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	err := j.db.Do(true, &opJournalWrite{batch: batch})
+	if err != nil {
+		fs.Errorf(nil, "Failed to write sync journal: %v", err)
+	}
+}
+
+// getDir returns the journalDir for dir making it if necessary
+//
+// Call with j.mu held
+func (j *journal) getDir(dir string) *journalDir {
+	d := j.dirs[dir]
+	if d == nil {
+		d = &journalDir{dir: dir, pending: 1}
+		j.dirs[dir] = d
+	}
+	return d
+}
+
+// isDirDone returns true if dir was done in a previous run
+func (j *journal) isDirDone(dir string) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, found := j.doneDirs[dir]
+	if found {
+		// Remove the record when the parent is done
+		parent := j.getDir(parentDir(dir))
+		parent.children = append(parent.children, j.dirKey(dir))
+	}
+	return found
+}
+
+// isFileDone returns true if src was done in a previous run
+func (j *journal) isFileDone(ctx context.Context, src fs.ObjectInfo) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	fingerprint, found := j.doneFiles[src.Remote()]
+	j.mu.Unlock()
+	return found && fingerprint == fs.Fingerprint(ctx, src, true)
+}
+
+// add records that src needs to be done before its directory is done
+func (j *journal) add(src fs.ObjectInfo) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.getDir(parentDir(src.Remote())).pending++
+}
+
+// done records that src previously passed to add is done
+//
+// If err is set then its directory won't be marked as done.
+func (j *journal) done(ctx context.Context, src fs.ObjectInfo, err error) {
+	if j == nil {
+		return
+	}
+	fingerprint := fs.Fingerprint(ctx, src, true)
+	j.mu.Lock()
+	d := j.getDir(parentDir(src.Remote()))
+	if err != nil {
+		d.failed = true
+	} else {
+		key := j.fileKey(src.Remote())
+		d.files = append(d.files, key)
+		j.batch[key] = []byte(fingerprint)
+	}
+	d.pending--
+	j.complete(d)
+	full := len(j.batch) >= journalBatchSize
+	j.mu.Unlock()
+	if full {
+		j.flush()
+	}
+}
+
+// notDone records that the directory containing entry can't be done,
+// either because entry needs deleting or because of an error
+func (j *journal) notDone(entry fs.DirEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.getDir(parentDir(entry.Remote())).failed = true
+}
+
+// dirListed records that all the entries in dir have been passed to
+// the sync along with the subdirectories which will be done next.
+func (j *journal) dirListed(dir string, subdirs []string, err error) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	d := j.getDir(dir)
+	if err != nil {
+		d.failed = true
+	}
+	for _, subdir := range subdirs {
+		child := j.getDir(subdir)
+		child.parent = d
+		d.pending++
+	}
+	d.pending--
+	j.complete(d)
+	j.mu.Unlock()
+}
+
+// complete marks d as done if there is nothing left to do in it,
+// then checks its parent.
+//
+// Call with j.mu held
+func (j *journal) complete(d *journalDir) {
+	for d != nil && d.pending <= 0 {
+		delete(j.dirs, d.dir)
+		if !d.failed {
+			// The directory record supersedes the records inside it
+			j.batch[j.dirKey(d.dir)] = []byte{}
+			for _, key := range d.files {
+				j.batch[key] = nil
+			}
+			for _, key := range j.loadedFiles[d.dir] {
+				j.batch[key] = nil
+			}
+			for _, key := range d.children {
+				j.batch[key] = nil
+			}
+		}
+		parent := d.parent
+		if parent != nil {
+			if d.failed {
+				parent.failed = true
+			} else {
+				parent.children = append(parent.children, j.dirKey(d.dir))
+			}
+			parent.pending--
+		}
+		d = parent
+	}
+}
+
+// close the journal
+//
+// If the sync succeeded the journal is removed, otherwise the
+// progress is saved for the next run.
+func (j *journal) close(success bool) {
+	if j == nil {
+		return
+	}
+	close(j.stop)
+	j.wg.Wait()
+	if success {
+		j.flushMu.Lock()
+		err := j.db.Do(true, &opJournalClear{prefix: j.prefix})
+		j.flushMu.Unlock()
+		if err != nil {
+			fs.Errorf(nil, "Failed to clear sync journal: %v", err)
+		}
+	} else {
+		j.flush()
+		fs.Infof(nil, "Saved sync progress to the journal - run the sync again to resume")
+	}
+	_ = j.db.Stop(false)
+}
@@ -0,0 +1,217 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadJournal returns what is recorded in the journal for a copy
+func loadJournal(ctx context.Context, t *testing.T, r *fstest.Run) (doneDirs []string, doneFiles []string) {
+	j, err := newJournal(ctx, r.Fremote, r.Flocal, "", fs.DeleteModeOff)
+	require.NoError(t, err)
+	for dir := range j.doneDirs {
+		doneDirs = append(doneDirs, dir)
+	}
+	for file := range j.doneFiles {
+		doneFiles = append(doneFiles, file)
+	}
+	close(j.stop)
+	j.wg.Wait()
+	require.NoError(t, j.db.Stop(false))
+	return doneDirs, doneFiles
+}
+
+func TestCopyWithSyncJournal(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.SyncJournal = true
+
+	// Keep the journal open between the runs as kv removes the
+	// database when it is first opened in tests
+	db, err := kv.Start(ctx, journalFacility, r.Fremote)
+	require.NoError(t, err)
+	defer func() { _ = db.Stop(false) }()
+
+	top := r.WriteFile("top", "top", t1)
+	a1 := r.WriteFile("a/one", "one", t1)
+	a2 := r.WriteFile("a/sub/two", "two", t1)
+	b3 := r.WriteFile("b/three", "three", t1)
+	b4 := r.WriteFile("b/four", "four", t1)
+
+	// Make b/three fail to copy by putting a directory in its place
+	r.WriteObject(ctx, "b/three/blocker", "blocker", t1)
+
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	accounting.GlobalStats().ResetCounters()
+
+	// a is done, but b and the root aren't so their files are recorded
+	doneDirs, doneFiles := loadJournal(ctx, t, r)
+	assert.ElementsMatch(t, []string{"a"}, doneDirs)
+	assert.ElementsMatch(t, []string{"top", "b/four"}, doneFiles)
+
+	// Change a file in the done directory - this won't be
+	// noticed as the directory isn't checked when resuming
+	r.WriteFile("a/one", "one changed", t2)
+
+	// Remove the blocker and resume
+	require.NoError(t, operations.Purge(ctx, r.Fremote, "b/three"))
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, top, a1, a2, b3, b4)
+
+	// The journal should be removed after a successful run
+	doneDirs, doneFiles = loadJournal(ctx, t, r)
+	assert.Empty(t, doneDirs)
+	assert.Empty(t, doneFiles)
+
+	// So the next run notices the change
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, top, fstest.NewItem("a/one", "one changed", t2), a2, b3, b4)
+}
+
+func TestSyncWithSyncJournalDstOnly(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.SyncJournal = true
+
+	db, err := kv.Start(ctx, journalFacility, r.Fremote)
+	require.NoError(t, err)
+	defer func() { _ = db.Stop(false) }()
+
+	r.WriteFile("a/one", "one", t1)
+	r.WriteFile("c/two", "two", t1)
+	r.WriteFile("d/three", "three", t1)
+	r.WriteObject(ctx, "c/extra", "extra", t1)
+	r.WriteObject(ctx, "d/four/blocker", "blocker", t1)
+	r.WriteFile("d/four", "four", t1)
+
+	// Interrupted by the error in d so nothing is deleted
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	accounting.GlobalStats().ResetCounters()
+
+	// c has something to delete so mustn't be skipped
+	j, err := newJournal(ctx, r.Fremote, r.Flocal, "", fs.DeleteModeDefault)
+	require.NoError(t, err)
+	assert.Contains(t, j.doneDirs, "a")
+	assert.NotContains(t, j.doneDirs, "c")
+	assert.NotContains(t, j.doneDirs, "d")
+	assert.Contains(t, j.doneFiles, "c/two")
+	close(j.stop)
+	j.wg.Wait()
+	require.NoError(t, j.db.Stop(false))
+}
+
+func TestSyncJournalResumesUploads(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.SyncJournal = true
+
+	// Transfers resume multipart uploads when the journal is used
+	s, err := newSyncCopyMove(ctx, r.Fremote, r.Flocal, fs.DeleteModeOff, false, false, false, false)
+	require.NoError(t, err)
+	s.openJournal()
+	require.NotNil(t, s.journal)
+	assert.True(t, fs.GetConfig(s.ctx).ResumeUploads)
+	assert.False(t, ci.ResumeUploads, "mustn't change the caller's config")
+	s.journal.close(true)
+	s.cancel()
+
+	// But not when it isn't
+	s, err = newSyncCopyMove(ctx, r.Fremote, r.Flocal, fs.DeleteModeOff, true, false, false, false)
+	require.NoError(t, err)
+	s.openJournal()
+	assert.Nil(t, s.journal)
+	assert.False(t, fs.GetConfig(s.ctx).ResumeUploads)
+	s.cancel()
+
+	// Nor when there is nothing to do as the source and
+	// destination are the same
+	s, err = newSyncCopyMove(ctx, r.Fremote, r.Fremote, fs.DeleteModeOff, false, false, false, false)
+	require.NoError(t, err)
+	require.NoError(t, s.run())
+	assert.Nil(t, s.journal)
+}
+
+func TestSyncJournalPrefix(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	prefix := journalPrefix(ctx, r.Fremote, r.Flocal, "", fs.DeleteModeOff)
+	assert.Equal(t, prefix, journalPrefix(ctx, r.Fremote, r.Flocal, "", fs.DeleteModeOff))
+	assert.NotEqual(t, prefix, journalPrefix(ctx, r.Fremote, r.Flocal, "dir", fs.DeleteModeOff))
+	assert.NotEqual(t, prefix, journalPrefix(ctx, r.Fremote, r.Flocal, "", fs.DeleteModeDuring))
+
+	// Changing how files are compared uses a different journal
+	for _, set := range []func(ci *fs.ConfigInfo){
+		func(ci *fs.ConfigInfo) { ci.CheckSum = true },
+		func(ci *fs.ConfigInfo) { ci.SizeOnly = true },
+		func(ci *fs.ConfigInfo) { ci.IgnoreExisting = true },
+		func(ci *fs.ConfigInfo) { ci.IgnoreTimes = true },
+		func(ci *fs.ConfigInfo) { ci.UpdateOlder = true },
+		func(ci *fs.ConfigInfo) { ci.CompareDest = []string{"/tmp/compare"} },
+	} {
+		newCtx, ci := fs.AddConfig(ctx)
+		set(ci)
+		assert.NotEqual(t, prefix, journalPrefix(newCtx, r.Fremote, r.Flocal, "", fs.DeleteModeOff))
+	}
+}
+
+func TestSyncJournalMaxAge(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	// Keep the journal open between the runs as kv removes the
+	// database when it is first opened in tests
+	db, err := kv.Start(ctx, journalFacility, r.Fremote)
+	require.NoError(t, err)
+	defer func() { _ = db.Stop(false) }()
+
+	// Save a journal started a day ago
+	j, err := newJournal(ctx, r.Fremote, r.Flocal, "", fs.DeleteModeOff)
+	require.NoError(t, err)
+	j.mu.Lock()
+	j.batch[j.dirKey("a")] = []byte{}
+	j.batch[j.startedKey()] = []byte(time.Now().Add(-24 * time.Hour).Format(time.RFC3339Nano))
+	j.mu.Unlock()
+	j.close(false)
+
+	// It is used if it is young enough
+	ci.SyncJournalMaxAge = fs.Duration(48 * time.Hour)
+	doneDirs, _ := loadJournal(ctx, t, r)
+	assert.Equal(t, []string{"a"}, doneDirs)
+
+	// But discarded if not
+	ci.SyncJournalMaxAge = fs.Duration(time.Hour)
+	doneDirs, _ = loadJournal(ctx, t, r)
+	assert.Empty(t, doneDirs)
+	ci.SyncJournalMaxAge = fs.Duration(48 * time.Hour)
+	doneDirs, _ = loadJournal(ctx, t, r)
+	assert.Empty(t, doneDirs)
+}
@@ -97,6 +97,7 @@ type syncCopyMove struct {
 	setDirModTimesMaxLevel int                    // max level of the directories to set
 	modifiedDirs           map[string]struct{}    // dirs with changed contents (if s.setDirModTimeAfter)
 	allowOverlap           bool                   // whether we allow src and dst to overlap (i.e. for convmv)
+	journal                *journal               // records progress if --sync-journal is set
 }
 
 // For keeping track of delayed modtime sets
@@ -134,6 +135,12 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	}
 	ci := fs.GetConfig(ctx)
 	fi := filter.GetConfig(ctx)
+	if fi.UsesFilterFiles() {
+		// Read the filter files from the source only so files
+		// they exclude are excluded on the destination too
+		ctx, fi = filter.AddConfig(ctx)
+		fi.SetFilterFileFs(fsrc)
+	}
 	s := &syncCopyMove{
 		ci:                     ci,
 		fi:                     fi,
@@ -237,6 +244,9 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			return nil, errors.New("can't use --no-check-dest with --backup-dir")
 		}
 	}
+	if s.deleteMode != fs.DeleteModeOff && transform.AddsDirectories(ctx) {
+		return nil, errors.New("can't use a --name-transform template which adds directories with sync: use copy or move instead")
+	}
 	if s.trackRenames {
 		// Don't track renames for remotes without server-side move support.
 		if !operations.CanServerSideMove(fdst) {
@@ -292,6 +302,39 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	return s, nil
 }
 
+// openJournal opens the sync journal if --sync-journal is set and it
+// can be used with this sync
+func (s *syncCopyMove) openJournal() {
+	if !s.ci.SyncJournal {
+		return
+	}
+	switch {
+	case s.DoMove:
+		fs.Errorf(s.fdst, "Ignoring --sync-journal as it doesn't work with move, only sync or copy")
+	case s.trackRenames:
+		fs.Errorf(s.fdst, "Ignoring --sync-journal with --track-renames")
+	case s.deleteMode == fs.DeleteModeOnly:
+		fs.Errorf(s.fdst, "Ignoring --sync-journal as there is nothing to transfer")
+	case s.ci.MaxDepth >= 0:
+		fs.Errorf(s.fdst, "Ignoring --sync-journal with --max-depth")
+	case transform.Transforming(s.ctx):
+		fs.Errorf(s.fdst, "Ignoring --sync-journal with --name-transform")
+	default:
+		var err error
+		s.journal, err = newJournal(s.ctx, s.fdst, s.fsrc, s.dir, s.deleteMode)
+		if err != nil {
+			fs.Errorf(s.fdst, "Ignoring --sync-journal as the journal couldn't be opened: %v", err)
+			s.journal = nil
+		} else if !s.ci.ResumeUploads {
+			// Resume the uploads which were part way through
+			// too, not just the files not started
+			var tci *fs.ConfigInfo
+			s.ctx, tci = fs.AddConfig(s.ctx)
+			tci.ResumeUploads = true
+		}
+	}
+}
+
 // Check to see if the context has been cancelled
 func (s *syncCopyMove) aborting() bool {
 	return s.ctx.Err() != nil
@@ -377,6 +420,8 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 		}
 		src := pair.Src
 		var err error
+		queued := false    // set if the pair was passed on for transfer
+		var checkErr error // error to record in the journal
 		tr := accounting.Stats(s.ctx).NewCheckingTransfer(src, "checking")
 		// Check to see if can store this
 		if src.Storable() {
@@ -384,6 +429,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 			if needTransfer {
 				NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, pair.Dst, pair.Src, s.compareCopyDest, s.backupDir)
 				if err != nil {
+					checkErr = err
 					s.processError(err)
 					s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, err)
 				}
@@ -395,6 +441,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 			if s.ci.FixCase && !s.ci.Immutable && src.Remote() != pair.Dst.Remote() {
 				if newDst, err := operations.Move(s.ctx, s.fdst, nil, src.Remote(), pair.Dst); err != nil {
 					fs.Errorf(pair.Dst, "Error while attempting to rename to %s: %v", src.Remote(), err)
+					checkErr = err
 					s.processError(err)
 				} else {
 					fs.Infof(pair.Dst, "Fixed case by renaming to: %s", src.Remote())
@@ -406,6 +453,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 				if s.ci.Immutable && pair.Dst != nil {
 					err := fs.CountError(s.ctx, fserrors.NoRetryError(fs.ErrorImmutableModified))
 					fs.Errorf(pair.Dst, "Source and destination exist but do not match: %v", err)
+					checkErr = err
 					s.processError(err)
 				} else {
 					if pair.Dst != nil {
@@ -417,6 +465,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 					if pair.Dst != nil && s.backupDir != nil {
 						err := operations.MoveBackupDir(s.ctx, s.backupDir, pair.Dst)
 						if err != nil {
+							checkErr = err
 							s.processError(err)
 							s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, err)
 						} else {
@@ -426,12 +475,14 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 							if !ok {
 								return
 							}
+							queued = true
 						}
 					} else {
 						ok = out.Put(s.inCtx, pair)
 						if !ok {
 							return
 						}
+						queued = true
 					}
 				}
 			} else {
@@ -458,6 +509,9 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 				}
 			}
 		}
+		if !queued {
+			s.journal.done(s.ctx, src, checkErr)
+		}
 		tr.Done(s.ctx, err)
 	}
 }
@@ -504,6 +558,7 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		} else {
 			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
 		}
+		s.journal.done(ctx, src, err)
 		s.processError(err)
 		if err != nil {
 			s.logger(ctx, operations.TransferError, src, dst, err)
@@ -913,6 +968,12 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	return true
 }
 
+// DirDone is called when all the entries in the source directory dir
+// have been processed
+func (s *syncCopyMove) DirDone(dir string, subdirs []string, err error) {
+	s.journal.dirListed(dir, subdirs, err)
+}
+
 // Syncs fsrc into fdst
 //
 // If Delete is true then it deletes any files in fdst that aren't in fsrc
@@ -926,6 +987,9 @@ func (s *syncCopyMove) run() error {
 		return nil
 	}
 
+	// Open the journal now there is something to do
+	s.openJournal()
+
 	// Start background checking and transferring pipeline
 	s.startCheckers()
 	s.startRenamers()
@@ -1019,6 +1083,9 @@ func (s *syncCopyMove) run() error {
 		fs.Infof(nil, "There was nothing to transfer")
 	}
 
+	// Save or remove the journal
+	s.journal.close(s.currentError() == nil)
+
 	// cancel the contexts to free resources
 	s.inCancel()
 	s.cancel()
@@ -1042,6 +1109,7 @@ func (s *syncCopyMove) DstOnly(dst fs.DirEntry) (recurse bool) {
 		}
 		return false
 	}
+	s.journal.notDone(dst)
 	switch x := dst.(type) {
 	case fs.Object:
 		s.logger(s.ctx, operations.MissingOnSrc, nil, x, nil)
@@ -1226,6 +1294,12 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 	}
 	switch x := src.(type) {
 	case fs.Object:
+		if dst := s.findTransformedDst(x); dst != nil {
+			// Found the destination in a different directory so check it
+			s.markParentNotEmpty(src)
+			s.toBeChecked.Put(s.inCtx, fs.ObjectPair{Src: x, Dst: dst})
+			return false
+		}
 		s.logger(s.ctx, operations.MissingOnDst, x, nil, nil)
 		s.markParentNotEmpty(src)
 
@@ -1243,6 +1317,7 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 				s.processError(err)
 				s.logger(s.ctx, operations.TransferError, x, nil, err)
 			}
+			s.journal.add(x)
 			if !NoNeedTransfer {
 				// No need to check since doesn't exist
 				fs.Debugf(src, "Need to transfer - File not found at Destination")
@@ -1251,6 +1326,8 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 				if !ok {
 					return
 				}
+			} else {
+				s.journal.done(s.ctx, x, err)
 			}
 		}
 	case fs.Directory:
@@ -1259,8 +1336,9 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 		s.logger(s.ctx, operations.MissingOnDst, src, nil, fs.ErrorIsDir)
 
 		// Create the directory and make sure the Metadata/ModTime is correct
-		s.copyDirMetadata(s.ctx, s.fdst, nil, transform.Path(s.ctx, x.Remote(), true), x)
-		s.markDirModified(transform.Path(s.ctx, x.Remote(), true))
+		dstRemote := transform.PathInfo(s.ctx, x.Remote(), true, x)
+		s.copyDirMetadata(s.ctx, s.fdst, nil, dstRemote, x)
+		s.markDirModified(dstRemote)
 		return true
 	default:
 		panic("Bad object in DirEntries")
@@ -1268,6 +1346,26 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 	return false
 }
 
+// findTransformedDst finds the destination of src if --name-transform
+// moved it into a different directory, as march can only match
+// objects in the same directory.
+//
+// It returns nil if it wasn't found.
+func (s *syncCopyMove) findTransformedDst(src fs.Object) fs.Object {
+	if s.noCheckDest || !transform.AddsDirectories(s.ctx) {
+		return nil
+	}
+	remote := transform.PathInfo(s.ctx, src.Remote(), false, src)
+	if path.Dir(remote) == path.Dir(src.Remote()) {
+		return nil
+	}
+	dst, err := s.fdst.NewObject(s.ctx, remote)
+	if err != nil {
+		return nil
+	}
+	return dst
+}
+
 // Match is called when src and dst are present, so sync src to dst
 func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse bool) {
 	switch srcX := src.(type) {
@@ -1278,7 +1376,12 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 			return false
 		}
 		dstX, ok := dst.(fs.Object)
+		if ok && s.journal.isFileDone(ctx, srcX) {
+			fs.Debugf(src, "Skipping as already done according to the sync journal")
+			return false
+		}
 		if ok {
+			s.journal.add(srcX)
 			// No logger here because we'll handle it in equal()
 			ok = s.toBeChecked.Put(s.inCtx, fs.ObjectPair{Src: srcX, Dst: dstX})
 			if !ok {
@@ -1289,11 +1392,12 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 			err := errors.New("can't overwrite directory with file")
 			fs.Errorf(dst, "%v", err)
 			s.processError(err)
+			s.journal.notDone(src)
 			s.logger(ctx, operations.TransferError, srcX, dstX, err)
 		}
 	case fs.Directory:
 		// Do the same thing to the entire contents of the directory
-		srcX = fs.NewOverrideDirectory(srcX, transform.Path(ctx, src.Remote(), true))
+		srcX = fs.NewOverrideDirectory(srcX, transform.PathInfo(ctx, src.Remote(), true, srcX))
 		src = srcX
 		if !transform.Transforming(ctx) || src.Remote() != dst.Remote() {
 			s.markParentNotEmpty(src)
@@ -1316,12 +1420,17 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 				}
 			}
 
+			if s.journal.isDirDone(src.Remote()) {
+				fs.Debugf(src, "Skipping directory as already done according to the sync journal")
+				return false
+			}
 			return true
 		}
 		// FIXME src is dir, dst is file
 		err := errors.New("can't overwrite file with directory")
 		fs.Errorf(dst, "%v", err)
 		s.processError(err)
+		s.journal.notDone(src)
 		s.logger(ctx, operations.TransferError, src.(fs.ObjectInfo), dst.(fs.ObjectInfo), err)
 	default:
 		panic("Bad object in DirEntries")
@@ -1412,6 +1412,30 @@ func TestSyncWithExclude(t *testing.T) {
 	r.CheckLocalItems(t, file2, file1, file3)
 }
 
+// Test with --filter-file-name that files excluded by the filter
+// files on the source aren't deleted from the destination
+func TestSyncWithFilterFileName(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile(".rcloneignore", "*.log\n", t1)
+	file2 := r.WriteBoth(ctx, "potato", "hello", t2)
+	file3 := r.WriteObject(ctx, "server.log", "only on the destination", t1)
+	file4 := r.WriteFile("client.log", "only on the source", t1)
+	r.CheckLocalItems(t, file1, file2, file4)
+	r.CheckRemoteItems(t, file2, file3)
+
+	opt := filter.Opt
+	opt.FilterFileName = ".rcloneignore"
+	fi, err := filter.NewFilter(&opt)
+	require.NoError(t, err)
+	ctx = filter.ReplaceConfig(ctx, fi)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, file1, file2, file3)
+}
+
 // Test with exclude and delete excluded
 func TestSyncWithExcludeAndDeleteExcluded(t *testing.T) {
 	ctx := context.Background()
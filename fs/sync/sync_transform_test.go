@@ -513,3 +513,55 @@ func TestError(t *testing.T) {
 	r.CheckLocalListing(t, []fstest.Item{file1}, []string{"toe", "toe/toe"})
 	r.CheckRemoteListing(t, []fstest.Item{file1}, []string{"toe", "toe/toe"})
 }
+
+func TestTemplate(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	err := transform.SetOptions(ctx, "template={{.ModTime.Year}}/{{.Size}}-{{.Name}}")
+	require.NoError(t, err)
+	r.WriteFile("photos/a.jpg", "hello", t1)
+	r.WriteFile("b.jpg", "potato", t2)
+	r.Mkdir(ctx, r.Fremote)
+
+	// sync can't delete files moved into other directories
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "can't use a --name-transform template which adds directories with sync")
+
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+	aItem := fstest.NewItem("photos/2001/5-a.jpg", "hello", t1)
+	bItem := fstest.NewItem("2011/6-b.jpg", "potato", t2)
+	r.CheckRemoteItems(t, aItem, bItem)
+
+	// Nothing to do the second time
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, aItem, bItem)
+
+	// Updating the file updates the destination in place
+	r.WriteFile("b.jpg", "potatO", t3)
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, aItem, fstest.NewItem("2011/6-b.jpg", "potatO", t3))
+}
+
+func TestTransformUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	err := transform.SetOptions(ctx, "prefix=tac")
+	require.NoError(t, err)
+	r.WriteFile("toe.txt", "hello world", t1)
+	r.Mkdir(ctx, r.Fremote)
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, true))
+
+	// The existing destination should be updated, not transformed again
+	r.WriteFile("toe.txt", "hello world again", t2)
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, true))
+	r.CheckRemoteItems(t, fstest.NewItem("tactoe.txt", "hello world again", t2))
+}
@@ -195,6 +195,14 @@ type GetTierer interface {
 	GetTier() string
 }
 
+// CompositeHasher is an optional interface for Object
+type CompositeHasher interface {
+	// CompositeHash returns the composite hash of the Object,
+	// such as the ETag of a multipart upload, or nil if it
+	// doesn't have one.
+	CompositeHash(ctx context.Context) (*hash.Composite, error)
+}
+
 // Metadataer is an optional interface for DirEntry
 type Metadataer interface {
 	// Metadata returns metadata for an DirEntry
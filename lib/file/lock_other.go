@@ -0,0 +1,21 @@
+//go:build !windows && (!unix || aix)
+
+package file
+
+import "os"
+
+// LockImplemented is a constant indicating whether the
+// implementation of Lock actually does anything.
+const LockImplemented = false
+
+// Lock takes an exclusive lock on f
+//
+// It does nothing on this OS.
+func Lock(f *os.File) error {
+	return nil
+}
+
+// Unlock releases a lock taken with Lock
+func Unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	if !LockImplemented {
+		t.Skip("Lock not implemented on this OS")
+	}
+	path := filepath.Join(t.TempDir(), "lockfile")
+	f1, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	require.NoError(t, err)
+	defer func() { _ = f1.Close() }()
+	f2, err := os.OpenFile(path, os.O_RDWR, 0600)
+	require.NoError(t, err)
+	defer func() { _ = f2.Close() }()
+
+	require.NoError(t, Lock(f1))
+
+	// A second lock waits for the first to be released
+	locked := make(chan error)
+	go func() {
+		locked <- Lock(f2)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second lock taken while first held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, Unlock(f1))
+	select {
+	case err := <-locked:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("second lock not taken after first released")
+	}
+	require.NoError(t, Unlock(f2))
+}
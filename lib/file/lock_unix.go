@@ -0,0 +1,33 @@
+//go:build unix && !aix
+
+package file
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockImplemented is a constant indicating whether the
+// implementation of Lock actually does anything.
+const LockImplemented = true
+
+// Lock takes an exclusive advisory lock on f waiting until it can be
+// taken.
+//
+// It stops other processes taking the lock on the same file, but
+// doesn't stop them reading or writing it.
+func Lock(f *os.File) error {
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX)
+		if !errors.Is(err, unix.EINTR) {
+			return err
+		}
+	}
+}
+
+// Unlock releases a lock taken with Lock
+func Unlock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -46,6 +46,41 @@ Use ` + "`--{{ .Prefix }}realm`" + ` to set the authentication realm.
 
 Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the default.
 
+#### Bearer token (JWT / OIDC) authentication
+
+Use ` + "`--{{ .Prefix }}jwt-issuer`" + ` to require clients to send a JWT
+issued by an OpenID Connect provider in an ` + "`Authorization: Bearer`" + `
+header, for example ` + "`--{{ .Prefix }}jwt-issuer https://sso.example.com/realms/main`" + `.
+Rclone reads the signing keys from the JWKS named in the provider's
+` + "`/.well-known/openid-configuration`" + ` when it starts, and reads them
+again every hour or when it sees a token signed with a key it doesn't
+know. The ` + "`iss`" + ` claim of the token must match the issuer and the
+token must have an ` + "`exp`" + ` claim which hasn't passed.
+
+Use ` + "`--{{ .Prefix }}jwt-audience`" + ` to require the ` + "`aud`" + ` claim of
+the token to contain the value given, which is normally the client ID
+registered with the provider. This must be set with
+` + "`--{{ .Prefix }}jwt-issuer`" + ` otherwise tokens issued for other
+applications would be accepted.
+
+The user name is read from the ` + "`sub`" + ` claim of the token. Use
+` + "`--{{ .Prefix }}jwt-user-claim`" + ` to read it from a different claim,
+for example ` + "`preferred_username`" + ` or ` + "`email`" + `.
+
+Instead of fetching the keys from an issuer, the tokens can be checked
+with ` + "`--{{ .Prefix }}jwt-key /path/to/key`" + `. This file may contain a PEM
+encoded public key or certificate, or a shared secret for tokens signed
+with HMAC which is useful for testing. ` + "`--{{ .Prefix }}jwt-issuer`" + ` may be
+set with this to check the ` + "`iss`" + ` claim, and
+` + "`--{{ .Prefix }}jwt-audience`" + ` is then optional.
+
+S3 clients, which use the ` + "`Authorization`" + ` header for their
+signature, may send the token as their session token instead.
+
+Bearer token authentication takes the place of the htpasswd file and
+user and password.  If used with ` + "`--auth-proxy`" + ` then the proxy
+program is passed the user and the claims from the token.
+
 `
 	tmpl, err := template.New("auth help").Parse(help)
 	if err != nil {
@@ -71,6 +106,13 @@ Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the
 // If a non nil value is returned then it is added to the context under the key
 type CustomAuthFn func(user, pass string) (value any, err error)
 
+// CustomTokenAuthFn if used will be used to authenticate a user whose
+// bearer token has been verified, with the claims from the token. If an
+// error is returned then the user is not authenticated.
+//
+// If a non nil value is returned then it is added to the context under the key
+type CustomTokenAuthFn func(user string, claims map[string]any) (value any, err error)
+
 // AuthConfigInfo descripts the Options in use
 var AuthConfigInfo = fs.Options{{
 	Name:    "htpasswd",
@@ -96,17 +138,38 @@ var AuthConfigInfo = fs.Options{{
 	Name:    "user_from_header",
 	Default: "",
 	Help:    "User name from a defined HTTP header",
+}, {
+	Name:    "jwt_issuer",
+	Default: "",
+	Help:    "OpenID Connect issuer URL to fetch the keys to check bearer tokens with",
+}, {
+	Name:    "jwt_key",
+	Default: "",
+	Help:    "PEM public key or shared secret file to check bearer tokens with instead of the issuer's keys",
+}, {
+	Name:    "jwt_audience",
+	Default: "",
+	Help:    "Audience which bearer tokens must be issued for",
+}, {
+	Name:    "jwt_user_claim",
+	Default: "sub",
+	Help:    "Claim in bearer tokens to read the user name from",
 }}
 
 // AuthConfig contains options for the http authentication
 type AuthConfig struct {
-	HtPasswd       string       `config:"htpasswd"`         // htpasswd file - if not provided no authentication is done
-	Realm          string       `config:"realm"`            // realm for authentication
-	BasicUser      string       `config:"user"`             // single username for basic auth if not using Htpasswd
-	BasicPass      string       `config:"pass"`             // password for BasicUser
-	Salt           string       `config:"salt"`             // password hashing salt
-	UserFromHeader string       `config:"user_from_header"` // retrieve user name from a defined HTTP header
-	CustomAuthFn   CustomAuthFn `json:"-" config:"-"`       // custom Auth (not set by command line flags)
+	HtPasswd          string            `config:"htpasswd"`         // htpasswd file - if not provided no authentication is done
+	Realm             string            `config:"realm"`            // realm for authentication
+	BasicUser         string            `config:"user"`             // single username for basic auth if not using Htpasswd
+	BasicPass         string            `config:"pass"`             // password for BasicUser
+	Salt              string            `config:"salt"`             // password hashing salt
+	UserFromHeader    string            `config:"user_from_header"` // retrieve user name from a defined HTTP header
+	JWTIssuer         string            `config:"jwt_issuer"`       // OIDC issuer to fetch the keys to check bearer tokens with
+	JWTKey            string            `config:"jwt_key"`          // file with a key to check bearer tokens with instead
+	JWTAudience       string            `config:"jwt_audience"`     // audience bearer tokens must be issued for
+	JWTUserClaim      string            `config:"jwt_user_claim"`   // claim to read the user name from
+	CustomAuthFn      CustomAuthFn      `json:"-" config:"-"`       // custom Auth (not set by command line flags)
+	CustomTokenAuthFn CustomTokenAuthFn `json:"-" config:"-"`       // custom Auth for bearer tokens (not set by command line flags)
 }
 
 // AddFlagsPrefix adds flags to the flag set for AuthConfig
@@ -117,6 +180,10 @@ func (cfg *AuthConfig) AddFlagsPrefix(flagSet *pflag.FlagSet, prefix string) {
 	flags.StringVarP(flagSet, &cfg.BasicPass, prefix+"pass", "", cfg.BasicPass, "Password for authentication", prefix)
 	flags.StringVarP(flagSet, &cfg.Salt, prefix+"salt", "", cfg.Salt, "Password hashing salt", prefix)
 	flags.StringVarP(flagSet, &cfg.UserFromHeader, prefix+"user-from-header", "", cfg.UserFromHeader, "Retrieve the username from a specified HTTP header if no other authentication methods are configured (ideal for proxied setups)", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTIssuer, prefix+"jwt-issuer", "", cfg.JWTIssuer, "OpenID Connect issuer URL to fetch the keys to check bearer tokens with", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTKey, prefix+"jwt-key", "", cfg.JWTKey, "PEM public key or shared secret file to check bearer tokens with instead of the issuer's keys", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTAudience, prefix+"jwt-audience", "", cfg.JWTAudience, "Audience which bearer tokens must be issued for", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTUserClaim, prefix+"jwt-user-claim", "", cfg.JWTUserClaim, "Claim in bearer tokens to read the user name from", prefix)
 }
 
 // AddAuthFlagsPrefix adds flags to the flag set for AuthConfig
@@ -130,6 +197,7 @@ func AddAuthFlagsPrefix(flagSet *pflag.FlagSet, prefix string, cfg *AuthConfig)
 // can be removed when all callers have been converted.
 func DefaultAuthCfg() AuthConfig {
 	return AuthConfig{
-		Salt: "dlPL2MqE",
+		Salt:         "dlPL2MqE",
+		JWTUserClaim: "sub",
 	}
 }
@@ -13,6 +13,7 @@ const (
 	ctxKeyPublicURL
 	ctxKeyUnixSock
 	ctxKeyUser
+	ctxKeyClaims
 )
 
 // NewBaseContext initializes the context for all requests, adding info for use in middleware and handlers
@@ -53,6 +54,13 @@ func CtxGetUser(ctx context.Context) (string, bool) {
 	return v, ok
 }
 
+// CtxGetClaims returns the claims from the bearer token used to
+// authenticate the request if there was one
+func CtxGetClaims(ctx context.Context) (map[string]any, bool) {
+	v, ok := ctx.Value(ctxKeyClaims).(map[string]any)
+	return v, ok
+}
+
 // CtxSetUser is a test helper that injects a User value into context
 func CtxSetUser(ctx context.Context, value string) context.Context {
 	return context.WithValue(ctx, ctxKeyUser, value)
@@ -0,0 +1,361 @@
+package http
+
+// JWT / OIDC bearer token authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+const (
+	jwksRefresh     = time.Hour        // how often to refresh the keys from the issuer
+	jwksMinRefresh  = time.Minute      // minimum time between fetches if an unknown key is seen
+	jwksHTTPTimeout = 30 * time.Second // timeout for fetching the keys
+	jwtLeeway       = time.Minute      // allowed clock skew when checking times in the token
+)
+
+// signing methods allowed with public keys
+var jwtPublicKeyMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// signing methods allowed with a shared secret
+var jwtSecretMethods = []string{"HS256", "HS384", "HS512"}
+
+// jwtVerifier checks bearer tokens and extracts the user from them
+type jwtVerifier struct {
+	userClaim string
+	parser    *jwt.Parser
+	keyFunc   jwt.Keyfunc
+	jwks      *jwks // set if the keys are fetched from the issuer
+}
+
+// newJWTVerifier makes a jwtVerifier from the config.
+//
+// If JWTKey is set the tokens are checked with that, otherwise the
+// keys are fetched from the OIDC discovery document of the JWTIssuer.
+//
+// JWTAudience must be set when the keys come from the issuer as
+// otherwise any token the issuer makes for any of its clients would
+// be accepted.
+func newJWTVerifier(ctx context.Context, cfg AuthConfig) (*jwtVerifier, error) {
+	if cfg.JWTAudience == "" {
+		if cfg.JWTKey == "" {
+			return nil, errors.New("--jwt-audience must be set with --jwt-issuer otherwise tokens issued for other applications would be accepted")
+		}
+		if cfg.JWTIssuer != "" {
+			fs.Logf(nil, "Bearer tokens from %q are accepted whatever their audience - set --jwt-audience to check it", cfg.JWTIssuer)
+		}
+	}
+	v := &jwtVerifier{
+		userClaim: cfg.JWTUserClaim,
+	}
+	if v.userClaim == "" {
+		v.userClaim = "sub"
+	}
+	parserOptions := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.JWTIssuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(cfg.JWTAudience))
+	}
+	if cfg.JWTKey != "" {
+		key, methods, err := loadJWTKey(cfg.JWTKey)
+		if err != nil {
+			return nil, err
+		}
+		v.keyFunc = func(*jwt.Token) (any, error) {
+			return key, nil
+		}
+		parserOptions = append(parserOptions, jwt.WithValidMethods(methods))
+	} else {
+		v.jwks = newJWKS(cfg.JWTIssuer)
+		if err := v.jwks.fetch(ctx); err != nil {
+			return nil, err
+		}
+		v.keyFunc = v.jwks.keyFunc
+		parserOptions = append(parserOptions, jwt.WithValidMethods(jwtPublicKeyMethods))
+	}
+	v.parser = jwt.NewParser(parserOptions...)
+	return v, nil
+}
+
+// verify checks the token and returns the user and the claims from it
+func (v *jwtVerifier) verify(tokenString string) (user string, claims jwt.MapClaims, err error) {
+	claims = jwt.MapClaims{}
+	_, err = v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil {
+		return "", nil, err
+	}
+	user, _ = claims[v.userClaim].(string)
+	if user == "" {
+		return "", nil, fmt.Errorf("token has no %q claim", v.userClaim)
+	}
+	return user, claims, nil
+}
+
+// loadJWTKey reads the key to check the tokens with from filePath
+// returning it along with the signing methods it may be used with.
+//
+// The file may contain a PEM encoded public key or certificate, or
+// anything else which is used as the shared secret.
+func loadJWTKey(filePath string) (key any, methods []string, err error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return nil, nil, fmt.Errorf("JWT key file %q is empty", filePath)
+		}
+		return secret, jwtSecretMethods, nil
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse JWT key certificate: %w", err)
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse JWT key: %w", err)
+	}
+	return key, jwtPublicKeyMethods, nil
+}
+
+// jwks holds the keys fetched from an OIDC issuer
+type jwks struct {
+	issuer  string
+	client  *rest.Client
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey // keyed on kid
+	last    time.Time                   // time of last successful fetch
+	lastTry time.Time                   // time of last attempt to fetch
+}
+
+// openIDConfiguration is the part of the OIDC discovery document we use
+type openIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// jsonWebKey is a single key in a JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jsonWebKeySet is the document at the jwks_uri
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func newJWKS(issuer string) *jwks {
+	return &jwks{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		client: rest.NewClient(&http.Client{Timeout: jwksHTTPTimeout}),
+	}
+}
+
+// fetch reads the discovery document and the keys from the issuer
+func (j *jwks) fetch(ctx context.Context) error {
+	if j.issuer == "" {
+		return errors.New("need a JWT issuer or key")
+	}
+	var config openIDConfiguration
+	_, err := j.client.CallJSON(ctx, &rest.Opts{
+		Method:  "GET",
+		RootURL: j.issuer + "/.well-known/openid-configuration",
+	}, nil, &config)
+	if err != nil {
+		return fmt.Errorf("failed to read OIDC discovery document from %q: %w", j.issuer, err)
+	}
+	// The issuer must be the one configured otherwise the keys could
+	// belong to someone else
+	if strings.TrimSuffix(config.Issuer, "/") != j.issuer {
+		return fmt.Errorf("OIDC discovery document from %q has wrong issuer %q", j.issuer, config.Issuer)
+	}
+	if config.JWKSURI == "" {
+		return fmt.Errorf("no jwks_uri in OIDC discovery document from %q", j.issuer)
+	}
+	var set jsonWebKeySet
+	_, err = j.client.CallJSON(ctx, &rest.Opts{
+		Method:  "GET",
+		RootURL: config.JWKSURI,
+	}, nil, &set)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS from %q: %w", config.JWKSURI, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			fs.Debugf(nil, "Ignoring JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable keys in JWKS from %q", config.JWKSURI)
+	}
+	j.mu.Lock()
+	j.keys = keys
+	j.last = time.Now()
+	j.lastTry = j.last
+	j.mu.Unlock()
+	fs.Debugf(nil, "Read %d JWT keys from %q", len(keys), config.JWKSURI)
+	return nil
+}
+
+// getKey returns the key with kid, refreshing the keys if they are
+// old or kid isn't known.
+func (j *jwks) getKey(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, found := j.keys[kid]
+	stale := !found || time.Since(j.last) >= jwksRefresh
+	canFetch := time.Since(j.lastTry) >= jwksMinRefresh
+	if stale && canFetch {
+		j.lastTry = time.Now()
+	}
+	j.mu.Unlock()
+	if stale && canFetch {
+		if err := j.fetch(context.Background()); err != nil {
+			fs.Errorf(nil, "Failed to refresh JWT keys: %v", err)
+		}
+		j.mu.Lock()
+		key, found = j.keys[kid]
+		j.mu.Unlock()
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// keyFunc finds the key for the token from the kid in its header
+//
+// If the token has no kid it may only be used if there is a single key.
+func (j *jwks) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if len(j.keys) != 1 {
+			return nil, errors.New("token has no kid")
+		}
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return j.getKey(kid)
+}
+
+// decode a base64url encoded big endian number
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns the public key described by the JWK
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad n: %w", err)
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("bad e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != size {
+			return nil, errors.New("bad x")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil || len(y) != size {
+			return nil, errors.New("bad y")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad x")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// parseBearer returns the token from an Authorization: Bearer header.
+//
+// S3 clients use the Authorization header for their signature so they
+// may send the token as their session token instead.
+func parseBearer(r *http.Request) (token string, ok bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		token = r.Header.Get("X-Amz-Security-Token")
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,257 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJWTServer starts a server using auth which replies with the user
+// and returns its URL
+func testJWTServer(t *testing.T, auth AuthConfig) string {
+	s, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(auth))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, s.Shutdown())
+	})
+	s.Router().Mount("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := CtxGetUser(r.Context())
+		if value := CtxGetAuth(r.Context()); value != nil {
+			user += " " + value.(string)
+		}
+		_, _ = w.Write([]byte(user))
+	}))
+	s.Serve()
+	return testGetServerURL(t, s)
+}
+
+// testJWTGet does a GET on url with token returning the status and body
+func testJWTGet(t *testing.T, url, header, token string) (int, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set(header, token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if resp.StatusCode == http.StatusUnauthorized {
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer ")
+	}
+	return resp.StatusCode, string(body)
+}
+
+func testSign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestJWTStaticKey(t *testing.T) {
+	dir := t.TempDir()
+	secret := []byte("potato")
+	keyFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(keyFile, append(secret, '\n'), 0600))
+
+	url := testJWTServer(t, AuthConfig{
+		Realm:        "test",
+		JWTKey:       keyFile,
+		JWTIssuer:    "https://sso.example.com",
+		JWTUserClaim: "preferred_username",
+	})
+	exp := time.Now().Add(time.Hour).Unix()
+	sign := func(claims jwt.MapClaims) string {
+		return testSign(t, jwt.SigningMethodHS256, secret, "", claims)
+	}
+	good := sign(jwt.MapClaims{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "alice"})
+
+	for _, test := range []struct {
+		name   string
+		header string
+		token  string
+		status int
+		body   string
+	}{
+		{"NoToken", "Authorization", "", http.StatusUnauthorized, ""},
+		{"Basic", "Authorization", "Basic YWxpY2U6cGFzcw==", http.StatusUnauthorized, ""},
+		{"Good", "Authorization", "Bearer " + good, http.StatusOK, "alice"},
+		{"S3SessionToken", "X-Amz-Security-Token", good, http.StatusOK, "alice"},
+		{"BadSignature", "Authorization", "Bearer " + testSign(t, jwt.SigningMethodHS256, []byte("wrong"), "", jwt.MapClaims{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "alice"}), http.StatusUnauthorized, ""},
+		{"Expired", "Authorization", "Bearer " + sign(jwt.MapClaims{"iss": "https://sso.example.com", "exp": time.Now().Add(-time.Hour).Unix(), "preferred_username": "alice"}), http.StatusUnauthorized, ""},
+		{"NoExpiry", "Authorization", "Bearer " + sign(jwt.MapClaims{"iss": "https://sso.example.com", "preferred_username": "alice"}), http.StatusUnauthorized, ""},
+		{"WrongIssuer", "Authorization", "Bearer " + sign(jwt.MapClaims{"iss": "https://evil.example.com", "exp": exp, "preferred_username": "alice"}), http.StatusUnauthorized, ""},
+		{"NoUser", "Authorization", "Bearer " + sign(jwt.MapClaims{"iss": "https://sso.example.com", "exp": exp, "sub": "alice"}), http.StatusUnauthorized, ""},
+		{"None", "Authorization", "Bearer " + testSign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", jwt.MapClaims{"iss": "https://sso.example.com", "exp": exp, "preferred_username": "alice"}), http.StatusUnauthorized, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := testJWTGet(t, url, test.header, test.token)
+			assert.Equal(t, test.status, status)
+			if test.body != "" {
+				assert.Equal(t, test.body, body)
+			}
+		})
+	}
+}
+
+func TestJWTPublicKeyFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	url := testJWTServer(t, AuthConfig{JWTKey: keyFile})
+	claims := jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}
+	status, body := testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, key, "", claims))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "bob", body)
+
+	// a token signed with the public key as an HMAC secret must fail
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodHS256, der, "", claims))
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestJWTIssuer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	b64 := base64.RawURLEncoding.EncodeToString
+	ecBytes, err := ecKey.PublicKey.Bytes()
+	require.NoError(t, err)
+	keys := []map[string]string{{
+		"kty": "RSA",
+		"kid": "rsa",
+		"use": "sig",
+		"n":   b64(rsaKey.N.Bytes()),
+		"e":   "AQAB",
+	}, {
+		"kty": "EC",
+		"kid": "ec",
+		"crv": "P-256",
+		"x":   b64(ecBytes[1:33]),
+		"y":   b64(ecBytes[33:]),
+	}, {
+		"kty": "RSA",
+		"kid": "enc",
+		"use": "enc",
+		"n":   b64(rsaKey.N.Bytes()),
+		"e":   "AQAB",
+	}}
+
+	var jwksFetches atomic.Int32
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/other/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		jwksFetches.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	idp := httptest.NewServer(mux)
+	defer idp.Close()
+	issuer = idp.URL
+
+	url := testJWTServer(t, AuthConfig{
+		Realm:       "test",
+		JWTIssuer:   issuer,
+		JWTAudience: "rclone",
+		CustomTokenAuthFn: func(user string, claims map[string]any) (value any, err error) {
+			if claims["email"] == nil {
+				return nil, errors.New("no email")
+			}
+			return claims["email"], nil
+		},
+	})
+	assert.Equal(t, int32(1), jwksFetches.Load())
+
+	claims := func(user string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   issuer,
+			"aud":   []string{"other", "rclone"},
+			"sub":   user,
+			"email": user + "@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	status, body := testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa", claims("carol")))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "carol carol@example.com", body)
+
+	status, body = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodES256, ecKey, "ec", claims("dave")))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "dave dave@example.com", body)
+
+	// key not for signing
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "enc", claims("carol")))
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// no kid with more than one key
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "", claims("carol")))
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// wrong audience
+	wrongAudience := claims("carol")
+	wrongAudience["aud"] = "other"
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa", wrongAudience))
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// rejected by the custom auth
+	noEmail := claims("carol")
+	delete(noEmail, "email")
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa", noEmail))
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// an unknown kid doesn't make the keys be read again so soon
+	// after the last time
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "new", claims("carol")))
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = testJWTGet(t, url, "Authorization", "Bearer "+testSign(t, jwt.SigningMethodRS256, rsaKey, "new", claims("carol")))
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, int32(1), jwksFetches.Load(), "keys read too soon")
+
+	// can't start without an audience
+	_, err = NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(AuthConfig{JWTIssuer: issuer}))
+	assert.ErrorContains(t, err, "--jwt-audience must be set")
+
+	// can't start if the issuer can't be read
+	_, err = NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(AuthConfig{JWTIssuer: issuer + "/notfound", JWTAudience: "rclone"}))
+	assert.ErrorContains(t, err, "failed to read OIDC discovery document")
+
+	// can't start if the discovery document is for a different issuer
+	_, err = NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(AuthConfig{JWTIssuer: issuer + "/other", JWTAudience: "rclone"}))
+	assert.ErrorContains(t, err, "wrong issuer")
+}
@@ -11,6 +11,7 @@ import (
 
 	goauth "github.com/abbot/go-http-auth"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 )
 
 // parseAuthorization parses the Authorization header into user, pass
@@ -154,6 +155,78 @@ func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) M
 	}
 }
 
+// MiddlewareAuthJWT instantiates middleware that authenticates the
+// bearer token in the request using v, setting the user and the
+// claims from it in the context.
+func MiddlewareAuthJWT(v *jwtVerifier, realm string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip auth for CORS preflight
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := parseBearer(r)
+			if !ok {
+				requireBearer(w, realm, "")
+				return
+			}
+			user, claims, err := v.verify(token)
+			if err != nil {
+				fs.Infof(r.URL.Path, "%s: Unauthorized request: invalid bearer token: %v", r.RemoteAddr, err)
+				requireBearer(w, realm, "invalid_token")
+				return
+			}
+			ctx := context.WithValue(r.Context(), ctxKeyUser, user)
+			ctx = context.WithValue(ctx, ctxKeyClaims, map[string]any(claims))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requireBearer returns a 401 asking for a bearer token
+func requireBearer(w http.ResponseWriter, realm, errorCode string) {
+	challenge := fmt.Sprintf(`Bearer realm=%q`, realm)
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error=%q`, errorCode)
+	}
+	code := http.StatusUnauthorized
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(code), code)
+}
+
+// MiddlewareAuthCustomToken instantiates middleware that authenticates
+// the user and claims from a verified bearer token using a custom
+// function
+func MiddlewareAuthCustomToken(fn CustomTokenAuthFn, realm string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip auth for CORS preflight
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, _ := CtxGetUser(r.Context())
+			claims, _ := CtxGetClaims(r.Context())
+			value, err := fn(user, claims)
+			if err != nil {
+				fs.Infof(r.URL.Path, "%s: Auth failed from %s: %v", r.RemoteAddr, user, err)
+				requireBearer(w, realm, "invalid_token")
+				return
+			}
+
+			if value != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ctxKeyAuth, value))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 var validUsernameRegexp = regexp.MustCompile(`^[\p{L}\d@._-]+$`)
 
 // MiddlewareAuthGetUserFromHeader middleware that bypasses authentication and extracts the user via a specified HTTP header(ideal for proxied setups).
@@ -176,6 +249,19 @@ func MiddlewareAuthGetUserFromHeader(header string) Middleware {
 
 var onlyOnceWarningAllowOrigin sync.Once
 
+// MiddlewareAuditActor instantiates middleware that records the
+// authenticated user as the actor for the audit log
+func MiddlewareAuditActor() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := CtxGetUser(r.Context()); ok {
+				r = r.WithContext(audit.WithActor(r.Context(), audit.Actor{Type: audit.ActorServe, User: user}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // MiddlewareCORS instantiates middleware that handles basic CORS protections for rcd
 func MiddlewareCORS(allowOrigin string) Middleware {
 	onlyOnceWarningAllowOrigin.Do(func() {
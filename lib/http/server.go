@@ -335,7 +335,13 @@ func NewServer(ctx context.Context, options ...Option) (*Server, error) {
 
 	s.mux.Use(MiddlewareCORS(s.cfg.AllowOrigin))
 
-	s.initAuth()
+	err = s.initAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.usingAuth {
+		s.mux.Use(MiddlewareAuditActor())
+	}
 
 	// (Only) listen on FDs provided by the service manager, if any.
 	sdListeners, err := sdActivation.ListenersWithNames()
@@ -396,8 +402,24 @@ func NewServer(ctx context.Context, options ...Option) (*Server, error) {
 	return s, nil
 }
 
-func (s *Server) initAuth() {
+func (s *Server) initAuth(ctx context.Context) error {
 	s.usingAuth = false
+
+	if s.auth.JWTIssuer != "" || s.auth.JWTKey != "" {
+		v, err := newJWTVerifier(ctx, s.auth)
+		if err != nil {
+			return fmt.Errorf("failed to init bearer token auth: %w", err)
+		}
+		s.usingAuth = true
+		s.mux.Use(MiddlewareAuthJWT(v, s.auth.Realm))
+		if s.auth.CustomTokenAuthFn != nil {
+			s.mux.Use(MiddlewareAuthCustomToken(s.auth.CustomTokenAuthFn, s.auth.Realm))
+		} else if s.auth.CustomAuthFn != nil {
+			s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, true))
+		}
+		return nil
+	}
+
 	altUsernameEnabled := s.auth.HtPasswd == "" && s.auth.BasicUser == ""
 
 	if altUsernameEnabled {
@@ -415,20 +437,21 @@ func (s *Server) initAuth() {
 	if s.auth.CustomAuthFn != nil {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, altUsernameEnabled))
-		return
+		return nil
 	}
 
 	if s.auth.HtPasswd != "" {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthHtpasswd(s.auth.HtPasswd, s.auth.Realm))
-		return
+		return nil
 	}
 
 	if s.auth.BasicUser != "" {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthBasic(s.auth.BasicUser, s.auth.BasicPass, s.auth.Realm, s.auth.Salt))
-		return
+		return nil
 	}
+	return nil
 }
 
 func (s *Server) initTemplate() error {
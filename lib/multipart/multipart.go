@@ -36,10 +36,12 @@ type UploadMultipartOptions struct {
 //
 // It returns the chunkWriter used in case the caller needs to extract any private info from it.
 func UploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, opt UploadMultipartOptions) (chunkWriterOut fs.ChunkWriter, err error) {
-	info, chunkWriter, err := opt.Open.OpenChunkWriter(ctx, src.Remote(), src, opt.OpenOptions...)
+	f, _ := opt.Open.(fs.Fs)
+	info, chunkWriter, resumer, err := OpenResumable(ctx, f, opt.Open.OpenChunkWriter, src.Remote(), src, opt.OpenOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("multipart upload failed to initialise: %w", err)
 	}
+	defer func() { resumer.Finish(err) }()
 
 	// make concurrency machinery
 	concurrency := max(info.Concurrency, 1)
@@ -49,7 +51,7 @@ func UploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, opt U
 	defer cancel()
 	defer atexit.OnError(&err, func() {
 		cancel()
-		if info.LeavePartsOnError {
+		if info.LeavePartsOnError || resumer.LeaveParts() {
 			return
 		}
 		fs.Debugf(src, "Cancelling multipart upload")
@@ -65,6 +67,7 @@ func UploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, opt U
 		off       int64
 		size      = src.Size()
 		chunkSize = info.ChunkSize
+		readErr   error
 	)
 
 	// Do the accounting manually
@@ -102,27 +105,44 @@ func UploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, opt U
 			finished = true
 		} else if err != nil {
 			free()
-			return nil, fmt.Errorf("multipart upload: failed to read source: %w", err)
+			// Let the chunks in progress finish so their progress is saved
+			readErr = fmt.Errorf("multipart upload: failed to read source: %w", err)
+			break
 		}
 
 		partNum := partNum
 		partOff := off
 		off += n
+		if resumer.IsDone(int(partNum)) {
+			fs.Debugf(src, "multipart upload: skipping chunk %d size %v offset %v/%v as already written", partNum, fs.SizeSuffix(n), fs.SizeSuffix(partOff), fs.SizeSuffix(size))
+			if acc != nil {
+				acc.AccountReadNoNetwork(n)
+			}
+			free()
+			continue
+		}
 		g.Go(func() (err error) {
 			defer free()
 			fs.Debugf(src, "multipart upload: starting chunk %d size %v offset %v/%v", partNum, fs.SizeSuffix(n), fs.SizeSuffix(partOff), fs.SizeSuffix(size))
 			_, err = chunkWriter.WriteChunk(gCtx, int(partNum), rw)
+			if err == nil {
+				resumer.ChunkDone(int(partNum))
+			}
 			return err
 		})
 	}
 
 	err = g.Wait()
+	if readErr != nil {
+		return nil, readErr
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	err = chunkWriter.Close(ctx)
 	if err != nil {
+		resumer.Discard()
 		return nil, fmt.Errorf("multipart upload: failed to finalise: %w", err)
 	}
 
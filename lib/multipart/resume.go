@@ -0,0 +1,298 @@
+package multipart
+
+// Saving the progress of multipart uploads so they can be resumed
+// if rclone is restarted.
+//
+// The state of each upload is saved in a kv database for the
+// destination Fs, keyed by the remote being uploaded. It is saved
+// each time a chunk is written so an interrupted upload only needs
+// to write the chunks which weren't finished.
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+const (
+	resumeFacility = "multipart" // name of the kv database
+	resumeHeadSize = 1 << 20     // bytes at the start of the source hashed for the fingerprint
+)
+
+// resumeRecord is what is saved about an upload in progress
+type resumeRecord struct {
+	Fingerprint string `json:"fp"`    // size, modification time and hash of the source
+	ChunkSize   int64  `json:"cs"`    // chunk size in use
+	Done        []int  `json:"done"`  // chunks which have been written
+	State       []byte `json:"state"` // state from the ChunkWriter
+}
+
+// Resumer saves the progress of a multipart upload.
+//
+// A nil Resumer is valid and does nothing, which is what is used
+// when uploads aren't being resumed.
+type Resumer struct {
+	db     *kv.DB
+	remote string
+	src    fs.ObjectInfo
+	writer fs.ResumableChunkWriter
+
+	mu        sync.Mutex
+	rec       resumeRecord
+	done      map[int]struct{} // chunks written before this run
+	discarded bool             // set if the saved state shouldn't be kept
+}
+
+// resumeFingerprint returns a string which changes if src changes
+//
+// As well as the size and modification time this has a hash of src
+// if the source can supply one cheaply, or otherwise a hash of the
+// first resumeHeadSize bytes of src, so a source which has changed
+// without changing its size or modification time isn't resumed.
+func resumeFingerprint(ctx context.Context, src fs.ObjectInfo) string {
+	fingerprint := fmt.Sprintf("%d,%v", src.Size(), src.ModTime(ctx).UTC())
+	if srcFs := src.Fs(); srcFs != nil && srcFs.Features() != nil && !srcFs.Features().SlowHash {
+		for _, ht := range srcFs.Hashes().Array() {
+			sum, err := src.Hash(ctx, ht)
+			if err == nil && sum != "" {
+				return fmt.Sprintf("%s,%v:%s", fingerprint, ht, sum)
+			}
+		}
+	}
+	o := fs.UnWrapObjectInfo(src)
+	if o == nil || src.Size() == 0 {
+		return fingerprint
+	}
+	in, err := o.Open(ctx, &fs.RangeOption{Start: 0, End: resumeHeadSize - 1})
+	if err != nil {
+		fs.Debugf(src, "Failed to open source to fingerprint upload: %v", err)
+		return fingerprint
+	}
+	defer func() { _ = in.Close() }()
+	hasher := md5.New()
+	_, err = io.Copy(hasher, io.LimitReader(in, resumeHeadSize))
+	if err != nil {
+		fs.Debugf(src, "Failed to read source to fingerprint upload: %v", err)
+		return fingerprint
+	}
+	return fmt.Sprintf("%s,head:%s", fingerprint, hex.EncodeToString(hasher.Sum(nil)))
+}
+
+// OpenResumable opens a ChunkWriter with open for uploading src to
+// remote on f.
+//
+// If --resume-uploads is set and there is a saved upload of src to
+// remote, it asks open to carry on with it. The Resumer returned
+// records the progress of the upload. It is nil if the upload isn't
+// being saved, because --resume-uploads isn't set or the backend
+// doesn't support it.
+func OpenResumable(ctx context.Context, f fs.Fs, open fs.OpenChunkWriterFn, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, r *Resumer, err error) {
+	ci := fs.GetConfig(ctx)
+	if !ci.ResumeUploads || f == nil || src.Size() < 0 || !kv.Supported() {
+		info, writer, err = open(ctx, remote, src, options...)
+		return info, writer, nil, err
+	}
+	db, err := kv.Start(ctx, resumeFacility, f)
+	if err != nil {
+		fs.Errorf(src, "Can't save progress of upload: %v", err)
+		info, writer, err = open(ctx, remote, src, options...)
+		return info, writer, nil, err
+	}
+	r = &Resumer{
+		db:     db,
+		remote: remote,
+		src:    src,
+		done:   make(map[int]struct{}),
+	}
+	fingerprint := resumeFingerprint(ctx, src)
+
+	// Try to carry on with the saved upload
+	var rec resumeRecord
+	err = db.Do(false, &opResumeGet{key: remote, rec: &rec})
+	if err == nil && rec.Fingerprint != fingerprint {
+		fs.Infof(src, "Not resuming upload as the source has changed")
+		err = kv.ErrEmpty
+	}
+	if err == nil {
+		resumeOptions := append(slices.Clone(options), &fs.ChunkWriterResumeOption{State: rec.State})
+		info, writer, err = open(ctx, remote, src, resumeOptions...)
+		if err != nil {
+			r.stop()
+			return info, nil, nil, err
+		}
+		rw, ok := writer.(fs.ResumableChunkWriter)
+		switch {
+		case !ok:
+			// carry on with a new upload without saving it
+			r.stop()
+			return info, writer, nil, nil
+		case !rw.Resumed():
+			fs.Infof(src, "Starting new upload as the saved upload can't be resumed")
+		case info.ChunkSize != rec.ChunkSize:
+			fs.Infof(src, "Starting new upload as the chunk size has changed from %v to %v", fs.SizeSuffix(rec.ChunkSize), fs.SizeSuffix(info.ChunkSize))
+			if abortErr := writer.Abort(ctx); abortErr != nil {
+				fs.Debugf(src, "Failed to abort saved upload: %v", abortErr)
+			}
+			writer = nil
+		default:
+			for _, chunk := range rec.Done {
+				r.done[chunk] = struct{}{}
+			}
+			fs.Infof(src, "Resuming upload with %d chunks of size %v already written", len(r.done), fs.SizeSuffix(info.ChunkSize))
+			r.rec = rec
+		}
+	} else if err != kv.ErrEmpty {
+		fs.Errorf(src, "Failed to read saved upload: %v", err)
+	}
+
+	// Otherwise start a new upload
+	if writer == nil {
+		info, writer, err = open(ctx, remote, src, options...)
+		if err != nil {
+			r.stop()
+			return info, nil, nil, err
+		}
+	}
+	rw, ok := writer.(fs.ResumableChunkWriter)
+	if !ok {
+		r.stop()
+		return info, writer, nil, nil
+	}
+	r.writer = rw
+	if len(r.done) == 0 {
+		r.rec = resumeRecord{
+			Fingerprint: fingerprint,
+			ChunkSize:   info.ChunkSize,
+		}
+		r.save()
+	}
+	return info, writer, r, nil
+}
+
+// IsDone returns true if chunk was written before the upload was
+// resumed so doesn't need writing again.
+//
+// The caller should account the size of the chunk with
+// AccountReadNoNetwork so the transfer is shown complete in the stats.
+func (r *Resumer) IsDone(chunk int) bool {
+	if r == nil {
+		return false
+	}
+	_, found := r.done[chunk]
+	return found
+}
+
+// ChunkDone records that chunk has been written
+func (r *Resumer) ChunkDone(chunk int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Done = append(r.rec.Done, chunk)
+	r.save()
+}
+
+// save the state of the upload
+//
+// Call with r.mu held
+func (r *Resumer) save() {
+	state, err := r.writer.ResumeState()
+	if err != nil {
+		fs.Errorf(r.src, "Failed to read upload state: %v", err)
+		return
+	}
+	r.rec.State = state
+	buf, err := json.Marshal(&r.rec)
+	if err != nil {
+		fs.Errorf(r.src, "Failed to encode upload state: %v", err)
+		return
+	}
+	err = r.db.Do(true, &opResumePut{key: r.remote, value: buf})
+	if err != nil {
+		fs.Errorf(r.src, "Failed to save upload state: %v", err)
+	}
+}
+
+// LeaveParts returns true if the parts written should be left on
+// error so the upload can be resumed
+func (r *Resumer) LeaveParts() bool {
+	return r != nil
+}
+
+// Discard the saved state when the upload is finished
+//
+// Use this if the upload failed in a way which means it can't be
+// resumed.
+func (r *Resumer) Discard() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.discarded = true
+	r.mu.Unlock()
+}
+
+// Finish should be called when the upload has finished with the
+// error it returned.
+//
+// If the upload succeeded or was discarded the saved state is
+// removed, otherwise it is kept so the upload can be resumed.
+func (r *Resumer) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil || r.discarded {
+		delErr := r.db.Do(true, &opResumePut{key: r.remote})
+		if delErr != nil {
+			fs.Errorf(r.src, "Failed to remove saved upload state: %v", delErr)
+		}
+	} else {
+		fs.Infof(r.src, "Saved progress of upload with %d chunks written - copy the file again to resume", len(r.rec.Done))
+	}
+	r.stop()
+}
+
+// stop the database
+func (r *Resumer) stop() {
+	_ = r.db.Stop(false)
+}
+
+// opResumeGet reads a saved upload
+type opResumeGet struct {
+	key string
+	rec *resumeRecord
+}
+
+// Do the get
+func (op *opResumeGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if data == nil {
+		return kv.ErrEmpty
+	}
+	return json.Unmarshal(data, op.rec)
+}
+
+// opResumePut saves an upload or removes it if value is nil
+type opResumePut struct {
+	key   string
+	value []byte
+}
+
+// Do the put
+func (op *opResumePut) Do(ctx context.Context, b kv.Bucket) error {
+	if op.value == nil {
+		return b.Delete([]byte(op.key))
+	}
+	return b.Put([]byte(op.key), op.value)
+}
@@ -0,0 +1,52 @@
+package multipart
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeFingerprint(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("potato"), resumeHeadSize/2)
+	changed := func(i int) []byte {
+		out := bytes.Clone(data)
+		out[i] = 'X'
+		return out
+	}
+	fingerprint := func(content []byte, f *mockfs.Fs) string {
+		o := mockobject.New("potato").WithContent(content, mockobject.SeekModeNone)
+		if f != nil {
+			o.SetFs(f)
+		}
+		return resumeFingerprint(ctx, o)
+	}
+
+	// Without a hash the start of the source is used
+	fp := fingerprint(data, nil)
+	assert.True(t, strings.Contains(fp, ",head:"), fp)
+	assert.Equal(t, fp, fingerprint(data, nil))
+	assert.NotEqual(t, fp, fingerprint(changed(0), nil))
+	assert.Equal(t, fp, fingerprint(changed(len(data)-1), nil), "only the start is hashed")
+
+	// The source hash is used if it is cheap to read
+	mf, err := mockfs.NewFs(ctx, "mock", "", nil)
+	require.NoError(t, err)
+	f := mf.(*mockfs.Fs)
+	f.SetHashes(hash.NewHashSet(hash.MD5))
+	fp = fingerprint(data, f)
+	assert.True(t, strings.Contains(fp, ",md5:"), fp)
+	assert.NotEqual(t, fp, fingerprint(changed(len(data)-1), f))
+
+	// But not if it is slow
+	f.Features().SlowHash = true
+	fp = fingerprint(data, f)
+	assert.True(t, strings.Contains(fp, ",head:"), fp)
+}
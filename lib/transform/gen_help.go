@@ -55,6 +55,7 @@ var commandList = []commands{
 	{command: "--name-transform nfkc", description: "Converts the file name to NFKC Unicode normalization form."},
 	{command: "--name-transform nfkd", description: "Converts the file name to NFKD Unicode normalization form."},
 	{command: "--name-transform command=/path/to/my/programfile names.", description: "Executes an external program to transform."},
+	{command: "--name-transform template=TEMPLATE", description: "Replaces the name with a Go template which may use the modification time, size, hashes and metadata."},
 }
 
 var examples = []example{
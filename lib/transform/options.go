@@ -6,14 +6,16 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"text/template"
 
 	"github.com/rclone/rclone/fs"
 )
 
 type transform struct {
-	key   Algo   // for example, "prefix"
-	value string // for example, "some_prefix_"
-	tag   tag    // file, dir, or all
+	key   Algo               // for example, "prefix"
+	value string             // for example, "some_prefix_"
+	tag   tag                // file, dir, or all
+	tmpl  *template.Template // parsed value if key is template
 }
 
 // tag controls which part of the file path is affected (file, dir, all)
@@ -123,10 +125,7 @@ func (t *transform) parseKeyVal(s string) (err error) {
 		}
 		return nil
 	}
-	split := strings.Split(s, "=")
-	if len(split) != 2 {
-		return errors.New("too many values")
-	}
+	split := strings.SplitN(s, "=", 2)
 	if split[0] == "" {
 		return errors.New("key cannot be blank")
 	}
@@ -135,6 +134,14 @@ func (t *transform) parseKeyVal(s string) (err error) {
 		return err
 	}
 	t.value = split[1]
+	if t.key == ConvTemplate {
+		// templates may contain = signs
+		t.tmpl, err = parseTemplate(t.value)
+		return err
+	}
+	if strings.ContainsRune(t.value, '=') {
+		return errors.New("too many values")
+	}
 	return nil
 }
 
@@ -173,6 +180,8 @@ func (t *transform) requiresValue() bool {
 		return true
 	case ConvCommand:
 		return true
+	case ConvTemplate:
+		return true
 	}
 	return false
 }
@@ -214,6 +223,7 @@ const (
 	ConvURL
 	ConvRegex
 	ConvCommand
+	ConvTemplate
 )
 
 type transformChoices struct{}
@@ -252,6 +262,7 @@ func (transformChoices) Choices() []string {
 		ConvURL:                        "url",
 		ConvRegex:                      "regex",
 		ConvCommand:                    "command",
+		ConvTemplate:                   "template",
 	}
 }
 
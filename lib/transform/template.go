@@ -0,0 +1,129 @@
+// The template transform
+
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"text/template"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// templateData is the data passed to the template transform
+//
+// The path is always available but the other fields are only
+// available if the object being transformed is known.
+type templateData struct {
+	ctx   context.Context
+	entry fs.DirEntry // object or directory being transformed - may be nil
+
+	Name string // the name being transformed, eg "file.txt"
+	Base string // the name without its extension, eg "file"
+	Ext  string // the extension of the name, eg ".txt"
+	Dir  string // the directory of the whole path, eg "path/to"
+	Path string // the whole path, eg "path/to/file.txt"
+}
+
+func newTemplateData(ctx context.Context, name string, whole string, entry fs.DirEntry) *templateData {
+	ext := path.Ext(name)
+	dir := path.Dir(whole)
+	if dir == "." {
+		dir = ""
+	}
+	return &templateData{
+		ctx:   ctx,
+		entry: entry,
+		Name:  name,
+		Base:  name[:len(name)-len(ext)],
+		Ext:   ext,
+		Dir:   dir,
+		Path:  whole,
+	}
+}
+
+// check the object is known
+func (d *templateData) check(what string) error {
+	if d.entry == nil {
+		return fmt.Errorf("%s of %q is not known here", what, d.Path)
+	}
+	return nil
+}
+
+// ModTime returns the modification time in the local time zone
+func (d *templateData) ModTime() (time.Time, error) {
+	if err := d.check("modification time"); err != nil {
+		return time.Time{}, err
+	}
+	return d.entry.ModTime(d.ctx).Local(), nil
+}
+
+// Size returns the size or -1 if not known
+func (d *templateData) Size() (int64, error) {
+	if err := d.check("size"); err != nil {
+		return 0, err
+	}
+	return d.entry.Size(), nil
+}
+
+// Hash returns the hash named, eg "md5"
+func (d *templateData) Hash(name string) (string, error) {
+	if err := d.check("hash"); err != nil {
+		return "", err
+	}
+	var ht hash.Type
+	if err := ht.Set(name); err != nil {
+		return "", err
+	}
+	o, ok := d.entry.(fs.ObjectInfo)
+	if !ok {
+		return "", fmt.Errorf("can't read hash of directory %q", d.Path)
+	}
+	return o.Hash(d.ctx, ht)
+}
+
+// MimeType returns the MIME type
+func (d *templateData) MimeType() (string, error) {
+	if err := d.check("MIME type"); err != nil {
+		return "", err
+	}
+	return fs.MimeType(d.ctx, d.entry), nil
+}
+
+// Metadata returns the metadata which may be empty
+func (d *templateData) Metadata() (fs.Metadata, error) {
+	if err := d.check("metadata"); err != nil {
+		return nil, err
+	}
+	metadata, err := fs.GetMetadata(d.ctx, d.entry)
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		metadata = fs.Metadata{}
+	}
+	return metadata, nil
+}
+
+// parseTemplate parses the value of the template transform
+func parseTemplate(value string) (*template.Template, error) {
+	tmpl, err := template.New("template").Option("missingkey=zero").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("bad template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// applyTemplate runs the template returning the new name
+func applyTemplate(tmpl *template.Template, data *templateData) (string, error) {
+	var out bytes.Buffer
+	err := tmpl.Execute(&out, data)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -41,6 +41,15 @@ func Help() string {
 //
 // If no transforms are in use, s is returned unchanged
 func Path(ctx context.Context, s string, isDir bool) string {
+	return PathInfo(ctx, s, isDir, nil)
+}
+
+// PathInfo transforms a path s like Path does, but also makes entry,
+// the object or directory at s, available to transforms which need
+// it such as template.
+//
+// entry may be nil if it isn't known.
+func PathInfo(ctx context.Context, s string, isDir bool, entry fs.DirEntry) string {
 	if !Transforming(ctx) {
 		return s
 	}
@@ -51,24 +60,29 @@ func Path(ctx context.Context, s string, isDir bool) string {
 		err = fs.CountError(ctx, err)
 		fs.Errorf(s, "Failed to parse transform flags: %v", err)
 	}
+	addsDirs := false
 	for _, t := range opt {
 		if isDir && t.tag == file {
 			continue
 		}
 		baseOnly := !isDir && t.tag == file
-		if t.tag == dir && !isDir {
-			s, err = transformDir(s, t)
-		} else {
-			s, err = transformPath(s, t, baseOnly)
-		}
+		transformed, err := transformOne(ctx, s, t, isDir, entry)
 		if err != nil {
 			err = fs.CountError(ctx, fserrors.NoRetryError(err))
 			fs.Errorf(s, "Failed to transform: %v", err)
+			continue
+		}
+		s = transformed
+		if baseOnly && t.key == ConvTemplate {
+			addsDirs = true
 		}
 	}
 	if old != s {
 		fs.Debugf(old, "transformed to: %v", s)
 	}
+	if addsDirs && strings.Count(old, "/") <= strings.Count(s, "/") {
+		return s
+	}
 	if strings.Count(old, "/") != strings.Count(s, "/") {
 		err = fs.CountError(ctx, fserrors.NoRetryError(fmt.Errorf("number of path segments must match: %v (%v), %v (%v)", old, strings.Count(old, "/"), s, strings.Count(s, "/"))))
 		fs.Errorf(old, "%v", err)
@@ -77,18 +91,92 @@ func Path(ctx context.Context, s string, isDir bool) string {
 	return s
 }
 
+// Leaf transforms the leaf name of entry as PathInfo would when
+// transforming its whole path.
+//
+// If a template adds directories then they are returned too.
+func Leaf(ctx context.Context, entry fs.DirEntry, isDir bool) string {
+	remote := entry.Remote()
+	leaf := path.Base(remote)
+	if !usesTemplate(ctx) {
+		return PathInfo(ctx, leaf, isDir, entry)
+	}
+	// Templates may use the whole path so transform that
+	depth := strings.Count(remote, "/")
+	segments := strings.Split(PathInfo(ctx, remote, isDir, entry), "/")
+	if depth >= len(segments) {
+		return leaf
+	}
+	return strings.Join(segments[depth:], "/")
+}
+
+// usesTemplate returns true if any of the transforms are templates
+func usesTemplate(ctx context.Context) bool {
+	opt, err := getOptions(ctx)
+	if err != nil {
+		return false
+	}
+	for _, t := range opt {
+		if t.key == ConvTemplate {
+			return true
+		}
+	}
+	return false
+}
+
+// AddsDirectories returns true if the transforms in use may move
+// files into different directories.
+//
+// Only templates applied to file names with a / in them can do this.
+func AddsDirectories(ctx context.Context) bool {
+	opt, err := getOptions(ctx)
+	if err != nil {
+		return false
+	}
+	for _, t := range opt {
+		if t.key == ConvTemplate && t.tag == file && strings.ContainsRune(t.value, '/') {
+			return true
+		}
+	}
+	return false
+}
+
+// transformOne applies the single transform t to the path s
+// according to its tag
+func transformOne(ctx context.Context, s string, t transform, isDir bool, entry fs.DirEntry) (string, error) {
+	if isDir && t.tag == file {
+		return s, nil
+	}
+	if t.tag == dir && !isDir {
+		return transformDir(ctx, s, t, entry)
+	}
+	return transformPath(ctx, s, t, !isDir && t.tag == file, entry)
+}
+
 // transformPath transforms a path string according to the chosen TransformAlgo.
 // Each path segment is transformed separately, to preserve path separators.
 // If baseOnly is true, only the base will be transformed (useful for renaming while walking a dir tree recursively.)
 // for example, "some/nested/path" -> "some/nested/CONVERTEDPATH"
 // otherwise, the entire is path is transformed.
-func transformPath(s string, t transform, baseOnly bool) (string, error) {
+func transformPath(ctx context.Context, s string, t transform, baseOnly bool, entry fs.DirEntry) (string, error) {
 	if s == "" || s == "/" || s == "\\" || s == "." {
 		return "", nil
 	}
 
 	if baseOnly {
-		transformedBase, err := transformPathSegment(path.Base(s), t)
+		transformedBase, err := transformSegment(ctx, path.Base(s), s, t, entry)
+		if t.key == ConvTemplate && err == nil {
+			// Templates may add directories to the base but
+			// only with separators in the template itself
+			if strings.ContainsRune(transformedBase, '/') && !strings.ContainsRune(t.value, '/') {
+				return "", fmt.Errorf("template output cannot contain path separators unless the template does: %v", transformedBase)
+			}
+			err = validateSegments(transformedBase)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(path.Dir(s), transformedBase), nil
+		}
 		if err := validateSegment(transformedBase); err != nil {
 			return "", err
 		}
@@ -98,7 +186,7 @@ func transformPath(s string, t transform, baseOnly bool) (string, error) {
 	segments := strings.Split(s, "/")
 	transformedSegments := make([]string, len(segments))
 	for _, seg := range segments {
-		convSeg, err := transformPathSegment(seg, t)
+		convSeg, err := transformSegment(ctx, seg, s, t, entry)
 		if err != nil {
 			return "", err
 		}
@@ -111,14 +199,22 @@ func transformPath(s string, t transform, baseOnly bool) (string, error) {
 }
 
 // transform all but the last path segment
-func transformDir(s string, t transform) (string, error) {
-	dirPath, err := transformPath(path.Dir(s), t, false)
+func transformDir(ctx context.Context, s string, t transform, entry fs.DirEntry) (string, error) {
+	dirPath, err := transformPath(ctx, path.Dir(s), t, false, entry)
 	if err != nil {
 		return "", err
 	}
 	return path.Join(dirPath, path.Base(s)), nil
 }
 
+// transformSegment transforms the path segment seg of the path whole
+func transformSegment(ctx context.Context, seg string, whole string, t transform, entry fs.DirEntry) (string, error) {
+	if t.key == ConvTemplate {
+		return applyTemplate(t.tmpl, newTemplateData(ctx, seg, whole, entry))
+	}
+	return transformPathSegment(seg, t)
+}
+
 // transformPathSegment transforms one path segment (or really any string) according to the chosen TransformAlgo.
 // It assumes path separators have already been trimmed.
 func transformPathSegment(s string, t transform) (string, error) {
@@ -141,9 +237,9 @@ func transformPathSegment(s string, t transform) (string, error) {
 		}
 		b, err := base64.URLEncoding.DecodeString(s)
 		if err != nil {
-			fs.Errorf(s, "base64 error")
+			return s, fmt.Errorf("base64 error: %w", err)
 		}
-		return string(b), err
+		return string(b), nil
 	case ConvFindReplace:
 		split := strings.Split(t.value, ":")
 		if len(split) != 2 {
@@ -315,6 +411,20 @@ func validateSegment(s string) error {
 	return nil
 }
 
+// validateSegments checks each segment of the output of a transform
+// which is allowed to add path separators
+func validateSegments(s string) error {
+	for seg := range strings.SplitSeq(s, "/") {
+		if err := validateSegment(seg); err != nil {
+			return err
+		}
+		if seg == "." || seg == ".." {
+			return fmt.Errorf("transform cannot add relative path segments: %v", s)
+		}
+	}
+	return nil
+}
+
 // ParseGlobs determines whether a string contains {brackets}
 // and returns the substring (including both brackets) for replacing
 // substring is first opening bracket to last closing bracket --
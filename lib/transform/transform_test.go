@@ -5,6 +5,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -146,3 +149,144 @@ func TestVarious(t *testing.T) {
 		assert.Equal(t, test.want, got)
 	}
 }
+
+func TestTemplate(t *testing.T) {
+	modTime := time.Date(2024, 3, 7, 12, 0, 0, 0, time.Local)
+	src := object.NewStaticObjectInfo("photos/IMG_0001.JPG", modTime, 1234, true, map[hash.Type]string{hash.MD5: "0123456789abcdef0123456789abcdef"}, nil).
+		WithMetadata(fs.Metadata{"camera": "Pentax"})
+	for _, test := range []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"template={{.ModTime.Year}}/{{.ModTime.Month}}/{{.Name}}"}, "photos/2024/March/IMG_0001.JPG"},
+		{[]string{`template={{.ModTime.Format "2006-01-02"}}_{{.Base}}{{.Ext}}`}, "photos/2024-03-07_IMG_0001.JPG"},
+		{[]string{"template={{.Size}}-{{.Name}}"}, "photos/1234-IMG_0001.JPG"},
+		{[]string{`template={{slice (.Hash "md5") 0 8}}{{.Ext}}`}, "photos/01234567.JPG"},
+		{[]string{`template={{index .Metadata "camera"}}/{{.Name}}`}, "photos/Pentax/IMG_0001.JPG"},
+		{[]string{`template={{with index .Metadata "missing"}}{{.}}{{else}}unknown{{end}}/{{.Name}}`}, "photos/unknown/IMG_0001.JPG"},
+		{[]string{"all,template={{.Name}}-{{.Size}}"}, "photos-1234/IMG_0001.JPG-1234"},
+		{[]string{"template={{.Dir}}_{{.Name}}", "lowercase"}, "photos/photos_img_0001.jpg"},
+		{[]string{"template={{.MimeType}}"}, "photos/IMG_0001.JPG"},             // separators must be in the template
+		{[]string{"template=a/../{{.Name}}"}, "photos/IMG_0001.JPG"},            // relative segments not allowed
+		{[]string{"template=/{{.Name}}"}, "photos/IMG_0001.JPG"},                // empty segments not allowed
+		{[]string{"all,template={{.Name}}/x"}, "photos/IMG_0001.JPG"},           // only file names can add directories
+		{[]string{`template={{.Hash "potato"}}`}, "photos/IMG_0001.JPG"},        // unknown hash
+		{[]string{`template={{.Hash "sha1"}}{{.Name}}`}, "photos/IMG_0001.JPG"}, // hash not available
+	} {
+		ctx, err := newOptions(test.flags...)
+		require.NoError(t, err, test.flags)
+		got := PathInfo(ctx, src.Remote(), false, src)
+		assert.Equal(t, test.want, got, test.flags)
+	}
+
+	// Without the object only the path is known
+	ctx, err := newOptions("template={{.Base}}_{{.Size}}{{.Ext}}")
+	require.NoError(t, err)
+	assert.Equal(t, "photos/IMG_0001.JPG", Path(ctx, "photos/IMG_0001.JPG", false))
+	ctx, err = newOptions("template={{.Base}}={{.Ext}}")
+	require.NoError(t, err)
+	assert.Equal(t, "photos/IMG_0001=.JPG", Path(ctx, "photos/IMG_0001.JPG", false))
+
+	// Directories aren't changed by file templates
+	ctx, err = newOptions("template={{.ModTime.Year}}/{{.Name}}")
+	require.NoError(t, err)
+	assert.Equal(t, "photos", PathInfo(ctx, "photos", true, src))
+
+	_, err = newOptions("template={{.Name")
+	assert.ErrorContains(t, err, "bad template")
+	_, err = newOptions("template")
+	assert.Error(t, err)
+}
+
+func TestLeaf(t *testing.T) {
+	modTime := time.Date(2024, 3, 7, 12, 0, 0, 0, time.Local)
+	src := object.NewStaticObjectInfo("a/b/file.txt", modTime, 3, true, nil, nil)
+
+	ctx, err := newOptions("prefix=x")
+	require.NoError(t, err)
+	assert.Equal(t, "xfile.txt", Leaf(ctx, src, false))
+	assert.False(t, AddsDirectories(ctx))
+
+	ctx, err = newOptions("template={{.ModTime.Year}}-{{.Dir}}-{{.Name}}", "all,replace=/:_")
+	require.NoError(t, err)
+	assert.Equal(t, "file.txt", Leaf(ctx, src, false))
+	assert.False(t, AddsDirectories(ctx))
+
+	ctx, err = newOptions("template={{.ModTime.Year}}-{{.Base}}{{.Ext}}")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-file.txt", Leaf(ctx, src, false))
+	assert.False(t, AddsDirectories(ctx))
+
+	ctx, err = newOptions("template={{.ModTime.Year}}/{{.Name}}", "dir,uppercase")
+	require.NoError(t, err)
+	assert.Equal(t, "2024/file.txt", Leaf(ctx, src, false))
+	assert.True(t, AddsDirectories(ctx))
+}
+
+func TestTransformer(t *testing.T) {
+	ctx := context.Background()
+	_, err := New("all,template={{.Name}}")
+	assert.ErrorContains(t, err, "templates can't be used here")
+	_, err = New("potato")
+	assert.Error(t, err)
+
+	tr, err := New("all,trimprefix=legacy_", "dir,replace=_:-")
+	require.NoError(t, err)
+	got, err := tr.Path(ctx, "legacy_my_dir/legacy_file_1.txt", false)
+	require.NoError(t, err)
+	assert.Equal(t, "my-dir/file_1.txt", got)
+	got, err = tr.Path(ctx, "legacy_my_dir/legacy_sub_dir", true)
+	require.NoError(t, err)
+	assert.Equal(t, "my-dir/sub-dir", got)
+	_, err = tr.Path(ctx, "legacy_", false)
+	assert.Error(t, err)
+
+	inv, err := tr.Inverse()
+	require.NoError(t, err)
+	got, err = inv.Path(ctx, "my-dir/file_1.txt", false)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy_my_dir/legacy_file_1.txt", got)
+	assert.NoError(t, tr.CheckInverse(ctx, inv))
+
+	tr, err = New("all,base64decode")
+	require.NoError(t, err)
+	inv, err = tr.Inverse()
+	require.NoError(t, err)
+	assert.NoError(t, tr.CheckInverse(ctx, inv))
+	assert.NoError(t, inv.CheckInverse(ctx, tr))
+
+	tr, err = New("all,encoder=Slash,Dot")
+	require.NoError(t, err)
+	inv, err = tr.Inverse()
+	require.NoError(t, err)
+	assert.NoError(t, tr.CheckInverse(ctx, inv))
+}
+
+func TestTransformerBadInverse(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		transform string
+		inverse   string
+		wantErr   string
+	}{
+		{"all,lowercase", "", "can't be reversed automatically"},
+		{"all,lowercase", "all,none", "loses information"},
+		{"all,prefix=a", "all,trimprefix=b", "isn't undone"},
+		{"file,suffix=.txt", "", "isn't undone"},
+		{"all,replace=e:E", "", "isn't undone"},
+		{"all,base64encode", "all,none", "isn't undone"},
+	} {
+		tr, err := New(test.transform)
+		require.NoError(t, err, test.transform)
+		var inv *Transformer
+		if test.inverse == "" {
+			inv, err = tr.Inverse()
+		} else {
+			inv, err = New(test.inverse)
+		}
+		if err == nil {
+			err = tr.CheckInverse(ctx, inv)
+		}
+		assert.ErrorContains(t, err, test.wantErr, test.transform)
+	}
+}
@@ -0,0 +1,160 @@
+// Fixed lists of transforms which may be reversed
+
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Transformer applies a fixed list of transforms independent of the
+// --name-transform flags in use.
+type Transformer struct {
+	opt []transform
+}
+
+// New makes a Transformer from transforms in the same format as the
+// --name-transform flag, e.g. "all,prefix=XXX"
+func New(transforms ...string) (*Transformer, error) {
+	t := &Transformer{}
+	for _, s := range transforms {
+		tr, err := parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad transform %q: %w", s, err)
+		}
+		if tr.key == ConvTemplate {
+			return nil, fmt.Errorf("bad transform %q: templates can't be used here", s)
+		}
+		t.opt = append(t.opt, tr)
+	}
+	return t, nil
+}
+
+// Path transforms the path s returning an error if any of the
+// transforms fail
+func (t *Transformer) Path(ctx context.Context, s string, isDir bool) (string, error) {
+	old := s
+	for _, tr := range t.opt {
+		var err error
+		s, err = transformOne(ctx, s, tr, isDir, nil)
+		if err != nil {
+			return old, err
+		}
+	}
+	if strings.Count(old, "/") != strings.Count(s, "/") {
+		return old, fmt.Errorf("number of path segments must match: %q, %q", old, s)
+	}
+	return s, nil
+}
+
+// inverse returns the transform which undoes t if known
+func (t transform) inverse() (transform, error) {
+	r := transform{tag: t.tag, value: t.value}
+	switch t.key {
+	case ConvNone:
+		r.key = ConvNone
+	case ConvPrefix:
+		r.key = ConvTrimPrefix
+	case ConvTrimPrefix:
+		r.key = ConvPrefix
+	case ConvSuffix:
+		r.key = ConvTrimSuffix
+	case ConvTrimSuffix:
+		r.key = ConvSuffix
+	case ConvFindReplace:
+		oldNew := strings.Split(t.value, ":")
+		if len(oldNew) != 2 {
+			return r, fmt.Errorf("wrong number of values: %v", t.value)
+		}
+		r.key = ConvFindReplace
+		r.value = oldNew[1] + ":" + oldNew[0]
+	case ConvBase64Encode:
+		r.key = ConvBase64Decode
+	case ConvBase64Decode:
+		r.key = ConvBase64Encode
+	case ConvEncoder:
+		r.key = ConvDecoder
+	case ConvDecoder:
+		r.key = ConvEncoder
+	default:
+		return r, fmt.Errorf("%v can't be reversed automatically - set the inverse explicitly", t.key)
+	}
+	return r, nil
+}
+
+// Inverse returns a Transformer which undoes t if it can be worked
+// out, otherwise it returns an error.
+func (t *Transformer) Inverse() (*Transformer, error) {
+	inv := &Transformer{}
+	for i := len(t.opt) - 1; i >= 0; i-- {
+		r, err := t.opt[i].inverse()
+		if err != nil {
+			return nil, err
+		}
+		inv.opt = append(inv.opt, r)
+	}
+	return inv, nil
+}
+
+// reversible is true for the transforms which don't lose information
+// so can be undone with the right inverse
+var reversible = map[Algo]bool{
+	ConvNone:         true,
+	ConvPrefix:       true,
+	ConvSuffix:       true,
+	ConvTrimPrefix:   true,
+	ConvTrimSuffix:   true,
+	ConvFindReplace:  true,
+	ConvBase64Encode: true,
+	ConvBase64Decode: true,
+	ConvEncoder:      true,
+	ConvDecoder:      true,
+}
+
+// Names used to check that transforms are undone by their inverse
+var checkNames = []string{
+	"file.txt",
+	"file name with spaces.tar.gz",
+	".hidden",
+	"ÜñíçØdé ☺",
+	"a:b*c?d<e>f|g",
+	"ZmlsZS50eHQ=",
+	"ZGlyZWN0b3J5",
+}
+
+// CheckInverse checks that all the transforms in t and inverse can
+// be undone and that names made with inverse are transformed back to
+// the original by t for a selection of names.
+func (t *Transformer) CheckInverse(ctx context.Context, inverse *Transformer) error {
+	for _, tr := range append(t.opt[:len(t.opt):len(t.opt)], inverse.opt...) {
+		if !reversible[tr.key] {
+			return fmt.Errorf("%v loses information so can't be reversed", tr.key)
+		}
+	}
+	checked := 0
+	for _, isDir := range []bool{false, true} {
+		for _, name := range checkNames {
+			for _, s := range []string{name, "dir/" + name} {
+				inverted, err := inverse.Path(ctx, s, isDir)
+				if err != nil {
+					// name can't be made so is never seen
+					continue
+				}
+				redone, err := t.Path(ctx, inverted, isDir)
+				if err != nil {
+					return fmt.Errorf("transform failed on %q reversed from %q: %w", inverted, s, err)
+				}
+				if redone != s {
+					return fmt.Errorf("inverse isn't undone by the transform: %q reverses to %q which transforms to %q", s, inverted, redone)
+				}
+				checked++
+			}
+		}
+	}
+	if checked == 0 {
+		return errors.New("inverse failed on all the names checked")
+	}
+	return nil
+}
@@ -114,7 +114,9 @@ func RPC(method string, input string) (output string, status int) {
 
 	fs.Debugf(nil, "rc: %q: with parameters %+v", method, in)
 
-	_, out, err := jobs.NewJob(context.Background(), call.Fn, in)
+	jobIn := in.Copy()
+	jobIn["_path"] = method
+	_, out, err := jobs.NewJob(context.Background(), call.Fn, jobIn)
 	if err != nil {
 		return writeError(method, in, err, http.StatusInternalServerError)
 	}
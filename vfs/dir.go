@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/dirtree"
 	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/log"
@@ -1055,12 +1056,18 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 	if d.vfs.Opt.ReadOnly {
 		return nil, EROFS
 	}
+	if err = d.vfs.quota.reserve(0, 1); err != nil {
+		return nil, err
+	}
 	if err = d.SetModTime(time.Now()); err != nil {
 		fs.Errorf(d, "Dir.Create failed to set modtime on parent dir: %v", err)
+		d.vfs.quota.release(0, 1)
 		return nil, err
 	}
 	// This gets added to the directory when the file is opened for write
-	return newFile(d, d.Path(), nil, name), nil
+	f := newFile(d, d.Path(), nil, name)
+	f.created = true
+	return f, nil
 }
 
 // Mkdir creates a new directory
@@ -1103,6 +1110,12 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 
 // Remove the directory
 func (d *Dir) Remove() error {
+	return d.removeContext(context.Background())
+}
+
+// removeContext removes the directory recording it in the audit log
+// against the actor in ctx
+func (d *Dir) removeContext(ctx context.Context) error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
@@ -1117,7 +1130,10 @@ func (d *Dir) Remove() error {
 		return ENOTEMPTY
 	}
 	// remove directory
-	err = d.f.Rmdir(context.TODO(), d.path)
+	ctx = d.vfs.auditContext(ctx)
+	entry := audit.Dir(ctx, audit.ActionRmdir, d.f, d.path)
+	err = d.f.Rmdir(ctx, d.path)
+	auditErr := entry.Done(err)
 	if err != nil {
 		fs.Errorf(d, "Dir.Remove failed to remove directory: %v", err)
 		return err
@@ -1126,11 +1142,18 @@ func (d *Dir) Remove() error {
 	if d.parent != nil {
 		d.parent.delObject(d.Name())
 	}
-	return nil
+	// The directory is gone but report it if it wasn't recorded
+	return auditErr
 }
 
 // RemoveAll removes the directory and any contents recursively
 func (d *Dir) RemoveAll() error {
+	return d.removeAllContext(context.Background())
+}
+
+// removeAllContext removes the directory and any contents
+// recursively recording it in the audit log against the actor in ctx
+func (d *Dir) removeAllContext(ctx context.Context) error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
@@ -1141,13 +1164,20 @@ func (d *Dir) RemoveAll() error {
 		return err
 	}
 	for _, node := range nodes {
-		err = node.RemoveAll()
+		switch x := node.(type) {
+		case *File:
+			err = x.removeContext(ctx)
+		case *Dir:
+			err = x.removeAllContext(ctx)
+		default:
+			err = node.RemoveAll()
+		}
 		if err != nil {
 			fs.Errorf(node.Path(), "Dir.RemoveAll failed to remove: %v", err)
 			return err
 		}
 	}
-	return d.Remove()
+	return d.removeContext(ctx)
 }
 
 // DirEntry returns the underlying fs.DirEntry
@@ -1177,6 +1207,12 @@ func (d *Dir) RemoveName(name string) error {
 
 // Rename the file
 func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
+	return d.renameContext(context.Background(), oldName, newName, destDir)
+}
+
+// renameContext renames the file recording it in the audit log
+// against the actor in ctx
+func (d *Dir) renameContext(ctx context.Context, oldName, newName string, destDir *Dir) error {
 	// fs.Debugf(d, "BEFORE\n%s", d.dump())
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
@@ -1189,10 +1225,18 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 		return err
 	}
+	// Note the size of a file which will be overwritten so it can
+	// be released from the quota
+	replacedSize := int64(-1)
+	if d.vfs.quota != nil && oldNode.IsFile() {
+		if newNode, err := destDir.stat(newName); err == nil && newNode != oldNode && newNode.IsFile() {
+			replacedSize = nonNegative(newNode.Size())
+		}
+	}
 	switch x := oldNode.DirEntry().(type) {
 	case nil:
 		if oldFile, ok := oldNode.(*File); ok {
-			if err = oldFile.rename(context.TODO(), destDir, newName); err != nil {
+			if err = oldFile.rename(ctx, destDir, newName); err != nil {
 				fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 				return err
 			}
@@ -1202,7 +1246,7 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		}
 	case fs.Object:
 		if oldFile, ok := oldNode.(*File); ok {
-			if err = oldFile.rename(context.TODO(), destDir, newName); err != nil {
+			if err = oldFile.rename(ctx, destDir, newName); err != nil {
 				fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 				return err
 			}
@@ -1220,7 +1264,7 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		}
 		srcRemote := x.Remote()
 		dstRemote := newPath
-		err = operations.DirMove(context.TODO(), d.f, srcRemote, dstRemote)
+		err = operations.DirMove(d.vfs.auditContext(ctx), d.f, srcRemote, dstRemote)
 		if err != nil {
 			fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 			return err
@@ -1242,6 +1286,9 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 	// Show moved - delete from old dir and add to new
 	d.delObject(oldName)
 	destDir.addObject(oldNode)
+	if replacedSize >= 0 {
+		d.vfs.quota.release(replacedSize, 1)
+	}
 	if err = d.SetModTime(time.Now()); err != nil {
 		fs.Errorf(d, "Dir.Rename failed to set modtime on parent dir: %v", err)
 		return err
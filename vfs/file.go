@@ -15,6 +15,7 @@ import (
 	"slices"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/vfs/vfscommon"
@@ -58,6 +59,7 @@ type File struct {
 	nwriters         atomic.Int32                    // len(writers)
 	appendMode       bool                            // file was opened with O_APPEND
 	isLink           bool                            // file represents a symlink
+	created          bool                            // made by Dir.Create and holds a file in the quota until opened
 }
 
 // newFile creates a new File
@@ -244,6 +246,7 @@ func (f *File) rename(ctx context.Context, destDir *Dir, newName string) error {
 
 	// File.mu is unlocked here to call Dir.Path()
 	newPath := path.Join(destDir.Path(), newCacheName)
+	actorCtx := ctx
 
 	renameCall := func(ctx context.Context) (err error) {
 		// chain rename calls if any
@@ -258,6 +261,8 @@ func (f *File) rename(ctx context.Context, destDir *Dir, newName string) error {
 		o := f.o
 		d := f.d
 		f.mu.RUnlock()
+		// the rename may be delayed so use the actor of the call
+		ctx = d.vfs.auditContext(audit.CopyActor(ctx, actorCtx))
 		var newObject fs.Object
 		// if o is nil then are writing the file so no need to rename the object
 		if o != nil {
@@ -615,7 +620,7 @@ func (f *File) openRead() (fh *ReadFileHandle, err error) {
 }
 
 // openWrite open the file for write
-func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
+func (f *File) openWrite(ctx context.Context, flags int) (fh *WriteFileHandle, err error) {
 	f.mu.RLock()
 	d := f.d
 	f.mu.RUnlock()
@@ -625,7 +630,7 @@ func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
 	}
 	// fs.Debugf(f.Path(), "File.openWrite")
 
-	fh, err = newWriteFileHandle(d, f, f.Path(), flags)
+	fh, err = newWriteFileHandle(ctx, d, f, f.Path(), flags)
 	if err != nil {
 		fs.Debugf(f.Path(), "File.openWrite failed: %v", err)
 		return nil, err
@@ -636,7 +641,7 @@ func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
 // openRW open the file for read and write using a temporary file
 //
 // It uses the open flags passed in.
-func (f *File) openRW(flags int) (fh *RWFileHandle, err error) {
+func (f *File) openRW(ctx context.Context, flags int) (fh *RWFileHandle, err error) {
 	f.mu.RLock()
 	d := f.d
 	f.mu.RUnlock()
@@ -647,7 +652,7 @@ func (f *File) openRW(flags int) (fh *RWFileHandle, err error) {
 	}
 	// fs.Debugf(f.Path(), "File.openRW")
 
-	fh, err = newRWFileHandle(d, f, flags)
+	fh, err = newRWFileHandle(ctx, d, f, flags)
 	if err != nil {
 		fs.Debugf(f.Path(), "File.openRW failed: %v", err)
 		return nil, err
@@ -664,6 +669,12 @@ func (f *File) Sync() error {
 
 // Remove the file
 func (f *File) Remove() (err error) {
+	return f.removeContext(context.Background())
+}
+
+// removeContext removes the file recording it in the audit log
+// against the actor in ctx
+func (f *File) removeContext(ctx context.Context) (err error) {
 	defer log.Trace(f.Path(), "")("err=%v", &err)
 	f.mu.RLock()
 	d := f.d
@@ -673,16 +684,23 @@ func (f *File) Remove() (err error) {
 		return EROFS
 	}
 
+	// Read the size before the file is removed to release from the quota
+	size := f.Size()
+
 	// Remove the object from the cache
 	wasWriting := false
 	if d.vfs.cache != nil && d.vfs.cache.Exists(f.CachePath()) {
 		wasWriting = d.vfs.cache.Remove(f.CachePath())
 	}
 
+	var auditErr error
 	f.muRW.Lock() // muRW must be locked before mu to avoid
 	f.mu.Lock()   // deadlock in RWFileHandle.openPending and .close
 	if f.o != nil {
-		err = f.o.Remove(context.TODO())
+		ctx := d.vfs.auditContext(ctx)
+		entry := audit.Object(ctx, audit.ActionDelete, f.o)
+		err = f.o.Remove(ctx)
+		auditErr = entry.Done(err)
 	}
 	f.mu.Unlock()
 	f.muRW.Unlock()
@@ -700,6 +718,9 @@ func (f *File) Remove() (err error) {
 	// called with File.mu released when there is no error removing the underlying file
 	if err == nil {
 		d.delObject(f.Name())
+		d.vfs.quota.release(size, 1)
+		// The file is gone but report it if it wasn't recorded
+		err = auditErr
 	}
 	return err
 }
@@ -830,7 +851,24 @@ const o_SYMLINK = 0x4000_0000 //nolint:revive
 //
 // We ignore O_SYNC and O_EXCL
 func (f *File) Open(flags int) (fd Handle, err error) {
+	return f.openContext(context.Background(), flags)
+}
+
+// openContext opens the file like Open. The changes made through the
+// handle are recorded in the audit log against the actor in ctx.
+func (f *File) openContext(ctx context.Context, flags int) (fd Handle, err error) {
 	defer log.Trace(f.Path(), "flags=%s", decodeOpenFlags(flags))("fd=%v, err=%v", &fd, &err)
+	defer func() {
+		// if the file made by Dir.Create wasn't added to the
+		// directory then release it from the quota
+		f.mu.Lock()
+		created := f.created
+		f.created = false
+		f.mu.Unlock()
+		if created && (err != nil || flags&os.O_CREATE == 0) {
+			f.VFS().quota.release(0, 1)
+		}
+	}()
 	var (
 		write    bool // if set need write support
 		read     bool // if set need read support
@@ -843,6 +881,9 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 		if err != nil {
 			return nil, err
 		}
+		if file, ok := target.(*File); ok {
+			return file.openContext(ctx, flags)
+		}
 		return target.Open(flags)
 	}
 	flags &^= o_SYMLINK
@@ -892,25 +933,25 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 	f.mu.RUnlock()
 	CacheMode := d.vfs.Opt.CacheMode
 	if CacheMode >= vfscommon.CacheModeMinimal && (d.vfs.cache.InUse(f.CachePath()) || d.vfs.cache.Exists(f.CachePath())) {
-		fd, err = f.openRW(flags)
+		fd, err = f.openRW(ctx, flags)
 	} else if read && write {
 		if CacheMode >= vfscommon.CacheModeMinimal {
-			fd, err = f.openRW(flags)
+			fd, err = f.openRW(ctx, flags)
 		} else {
 			// Open write only and hope the user doesn't
 			// want to read.  If they do they will get an
 			// EPERM plus an Error log.
-			fd, err = f.openWrite(flags)
+			fd, err = f.openWrite(ctx, flags)
 		}
 	} else if write {
 		if CacheMode >= vfscommon.CacheModeWrites {
-			fd, err = f.openRW(flags)
+			fd, err = f.openRW(ctx, flags)
 		} else {
-			fd, err = f.openWrite(flags)
+			fd, err = f.openWrite(ctx, flags)
 		}
 	} else if read {
 		if CacheMode >= vfscommon.CacheModeFull {
-			fd, err = f.openRW(flags)
+			fd, err = f.openRW(ctx, flags)
 		} else {
 			fd, err = f.openRead()
 		}
@@ -231,7 +231,7 @@ func TestFileOpenReadUnknownSize(t *testing.T) {
 func TestFileOpenWrite(t *testing.T) {
 	_, vfs, file, _ := fileCreate(t, vfscommon.CacheModeOff)
 
-	fd, err := file.openWrite(os.O_WRONLY | os.O_TRUNC)
+	fd, err := file.openWrite(context.Background(), os.O_WRONLY|os.O_TRUNC)
 	require.NoError(t, err)
 
 	newContents := []byte("this is some new contents")
@@ -243,7 +243,7 @@ func TestFileOpenWrite(t *testing.T) {
 	assert.Equal(t, int64(25), file.Size())
 
 	vfs.Opt.ReadOnly = true
-	_, err = file.openWrite(os.O_WRONLY | os.O_TRUNC)
+	_, err = file.openWrite(context.Background(), os.O_WRONLY|os.O_TRUNC)
 	assert.Equal(t, EROFS, err)
 }
 
@@ -0,0 +1,208 @@
+// Storage quotas
+
+package vfs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// quota limits the space used by the VFS as set by --vfs-quota-bytes
+// and --vfs-quota-files.
+//
+// The space used is counted by listing the whole remote and is then
+// kept up to date by the writes and deletes done through the VFS. It
+// is counted again in the background every DirCacheTime to pick up
+// changes made elsewhere. The changes made through the VFS while
+// counting are added to the new count so they aren't lost.
+//
+// Until a count has succeeded the space in use isn't known so writes
+// fail and the count is retried every quotaRetryInterval.
+type quota struct {
+	vfs       *VFS
+	maxBytes  int64             // max bytes which may be stored or -1
+	maxFiles  int64             // max files which may be stored or -1
+	countHook func(error) error // if set called with the error from listing the remote and returns the error to use - for testing
+	mu        sync.Mutex        // protects the below
+	bytes     int64             // bytes in use
+	files     int64             // files in use
+	counted   time.Time         // when the last count was started
+	counting  bool              // set while counting
+	newBytes  int64             // bytes reserved while counting
+	newFiles  int64             // files reserved while counting
+	valid     bool              // set once a count has succeeded
+	firstDone chan struct{}     // closed when a count is done while !valid, nil otherwise
+}
+
+// how often to retry counting the space in use until a count succeeds
+var quotaRetryInterval = 10 * time.Second
+
+// newQuota returns a quota for the VFS or nil if no limits are set
+func newQuota(vfs *VFS) *quota {
+	q := &quota{
+		vfs:       vfs,
+		maxBytes:  int64(vfs.Opt.QuotaBytes),
+		maxFiles:  vfs.Opt.QuotaFiles,
+		firstDone: make(chan struct{}),
+	}
+	if q.maxBytes < 0 && q.maxFiles < 0 {
+		return nil
+	}
+	return q
+}
+
+// _startCount starts counting the space in use in the background if
+// it hasn't been counted recently.
+//
+// call with mu held
+func (q *quota) _startCount() {
+	every := time.Duration(q.vfs.Opt.DirCacheTime)
+	if !q.valid {
+		every = quotaRetryInterval
+	}
+	if q.counting || (!q.counted.IsZero() && time.Since(q.counted) < every) {
+		return
+	}
+	if !q.valid && q.firstDone == nil {
+		q.firstDone = make(chan struct{})
+	}
+	q.counting = true
+	q.counted = time.Now()
+	q.newBytes, q.newFiles = 0, 0
+	go q.count()
+}
+
+// count the space in use by listing the remote without holding the
+// lock, then add on the space reserved while it was listing.
+func (q *quota) count() {
+	var bytes, files int64
+	// This ignores filters like --vfs-used-is-size does
+	err := walk.ListR(context.TODO(), q.vfs.f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			files++
+			bytes += nonNegative(o.Size())
+		})
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		// the remote is empty
+		err = nil
+	}
+	if q.countHook != nil {
+		err = q.countHook(err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.counting = false
+	if q.firstDone != nil {
+		close(q.firstDone)
+		q.firstDone = nil
+	}
+	if err != nil {
+		fs.Errorf(q.vfs.f, "Failed to count the space used for the quota: %v", err)
+		return
+	}
+	q.bytes = max(bytes+q.newBytes, 0)
+	q.files = max(files+q.newFiles, 0)
+	q.valid = true
+}
+
+// lock the quota, starting a count of the space in use if necessary
+// and waiting for the count to finish if none has succeeded yet.
+//
+// It returns an error if the space in use couldn't be counted. The
+// quota is locked whether or not an error is returned.
+func (q *quota) lock() error {
+	q.mu.Lock()
+	q._startCount()
+	if firstDone := q.firstDone; firstDone != nil {
+		q.mu.Unlock()
+		<-firstDone
+		q.mu.Lock()
+	}
+	if !q.valid {
+		return errQuotaNotCounted
+	}
+	return nil
+}
+
+var errQuotaNotCounted = errors.New("space used for the quota couldn't be counted")
+
+// _add adds bytes and files to the space in use
+//
+// call with mu held
+func (q *quota) _add(bytes, files int64) {
+	q.bytes = max(q.bytes+bytes, 0)
+	q.files = max(q.files+files, 0)
+	if q.counting {
+		q.newBytes += bytes
+		q.newFiles += files
+	}
+}
+
+// reserve adds bytes and files to the space in use.
+//
+// If this would take the space in use over either limit then it
+// returns ENOSPC and the space in use isn't changed.
+//
+// It is safe to call on a nil quota.
+func (q *quota) reserve(bytes, files int64) error {
+	if q == nil {
+		return nil
+	}
+	err := q.lock()
+	defer q.mu.Unlock()
+	if err != nil && (bytes > 0 || files > 0) {
+		fs.Errorf(q.vfs.f, "Can't write: %v", err)
+		return ENOSPC
+	}
+	if bytes > 0 && q.maxBytes >= 0 && q.bytes+bytes > q.maxBytes {
+		fs.Debugf(q.vfs.f, "Quota of %v exceeded", fs.SizeSuffix(q.maxBytes))
+		return ENOSPC
+	}
+	if files > 0 && q.maxFiles >= 0 && q.files+files > q.maxFiles {
+		fs.Debugf(q.vfs.f, "Quota of %d files exceeded", q.maxFiles)
+		return ENOSPC
+	}
+	q._add(bytes, files)
+	return nil
+}
+
+// release removes bytes and files from the space in use.
+//
+// It is safe to call on a nil quota.
+func (q *quota) release(bytes, files int64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q._add(-bytes, -files)
+}
+
+// usage returns the space in use, or the last known space in use if
+// it couldn't be counted
+func (q *quota) usage() (bytes, files int64) {
+	_ = q.lock()
+	defer q.mu.Unlock()
+	return q.bytes, q.files
+}
+
+// Quota returns the space in use and the limits set with
+// --vfs-quota-bytes and --vfs-quota-files. A limit is -1 if it isn't
+// set.
+//
+// ok is false if no limits are set.
+func (vfs *VFS) Quota() (usedBytes, maxBytes, usedFiles, maxFiles int64, ok bool) {
+	q := vfs.quota
+	if q == nil {
+		return -1, -1, -1, -1, false
+	}
+	usedBytes, usedFiles = q.usage()
+	return usedBytes, q.maxBytes, usedFiles, q.maxFiles, true
+}
@@ -0,0 +1,231 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaNone(t *testing.T) {
+	_, vfs := newTestVFS(t)
+	assert.Nil(t, vfs.quota)
+	_, _, _, _, ok := vfs.Quota()
+	assert.False(t, ok)
+	require.NoError(t, vfs.WriteFile("file", []byte("hello"), 0600))
+}
+
+func TestQuota(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			opt := vfscommon.Opt
+			opt.CacheMode = cacheMode
+			opt.WriteBack = writeBackDelay
+			opt.QuotaBytes = 10
+			opt.QuotaFiles = 2
+			r, vfs := newTestVFSOpt(t, &opt)
+			r.WriteObject(context.Background(), "existing", "1234", t1)
+
+			checkUsage := func(wantBytes, wantFiles int64) {
+				t.Helper()
+				usedBytes, maxBytes, usedFiles, maxFiles, ok := vfs.Quota()
+				require.True(t, ok)
+				assert.Equal(t, wantBytes, usedBytes, "bytes")
+				assert.Equal(t, int64(10), maxBytes)
+				assert.Equal(t, wantFiles, usedFiles, "files")
+				assert.Equal(t, int64(2), maxFiles)
+				total, used, free := vfs.Statfs()
+				assert.Equal(t, int64(10), total)
+				assert.Equal(t, wantBytes, used)
+				assert.Equal(t, 10-wantBytes, free)
+			}
+			checkUsage(4, 1)
+
+			// Write a new file
+			require.NoError(t, vfs.WriteFile("a", []byte("12345"), 0600))
+			checkUsage(9, 2)
+
+			// Too many files
+			_, err := vfs.OpenFile("b", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			assert.Equal(t, ENOSPC, err)
+			checkUsage(9, 2)
+
+			// Overwriting releases the space of the old file
+			require.NoError(t, vfs.WriteFile("a", []byte("123456"), 0600))
+			checkUsage(10, 2)
+
+			// Too many bytes
+			var fh Handle
+			if cacheMode == vfscommon.CacheModeOff {
+				// can't append without the cache so overwrite
+				fh, err = vfs.OpenFile("a", os.O_WRONLY|os.O_TRUNC, 0600)
+				require.NoError(t, err)
+				_, err = fh.Write([]byte("123456"))
+				require.NoError(t, err)
+			} else {
+				fh, err = vfs.OpenFile("a", os.O_RDWR|os.O_APPEND, 0600)
+				require.NoError(t, err)
+			}
+			_, err = fh.Write([]byte("12345"))
+			assert.Equal(t, ENOSPC, err)
+			if cacheMode == vfscommon.CacheModeOff {
+				require.NoError(t, fh.Close())
+				checkUsage(10, 2)
+			} else {
+				assert.Equal(t, ENOSPC, fh.Truncate(11))
+				require.NoError(t, fh.Truncate(3))
+				require.NoError(t, fh.Close())
+				checkUsage(7, 2)
+			}
+
+			// Removing releases the space
+			require.NoError(t, vfs.Remove("a"))
+			checkUsage(4, 1)
+			require.NoError(t, vfs.WriteFile("b", []byte("123456"), 0600))
+			checkUsage(10, 2)
+		})
+	}
+}
+
+func TestQuotaRecount(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.QuotaFiles = 5
+	r, vfs := newTestVFSOpt(t, &opt)
+	r.WriteObject(context.Background(), "existing", "1234", t1)
+
+	usedBytes, maxBytes, usedFiles, maxFiles, ok := vfs.Quota()
+	require.True(t, ok)
+	assert.Equal(t, []int64{4, -1, 1, 5}, []int64{usedBytes, maxBytes, usedFiles, maxFiles})
+
+	// Changes made elsewhere aren't seen until the usage is counted again
+	r.WriteObject(context.Background(), "dir/other", "12", t1)
+	usedBytes, _, usedFiles, _, _ = vfs.Quota()
+	assert.Equal(t, []int64{4, 1}, []int64{usedBytes, usedFiles})
+
+	vfs.quota.mu.Lock()
+	vfs.quota.counted = time.Time{}
+	vfs.quota.mu.Unlock()
+	require.Eventually(t, func() bool {
+		usedBytes, _, usedFiles, _, _ = vfs.Quota()
+		return usedBytes == 6 && usedFiles == 2
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestQuotaRecountKeepsReservations(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.QuotaBytes = 100
+	r, vfs := newTestVFSOpt(t, &opt)
+	r.WriteObject(context.Background(), "existing", "1234", t1)
+	q := vfs.quota
+
+	usedBytes, _, usedFiles, _, _ := vfs.Quota()
+	assert.Equal(t, []int64{4, 1}, []int64{usedBytes, usedFiles})
+
+	// Reserve space while the remote is being counted again
+	counted := make(chan struct{})
+	q.countHook = func(err error) error {
+		assert.NoError(t, q.reserve(5, 1))
+		close(counted)
+		return err
+	}
+	q.mu.Lock()
+	q.counted = time.Time{}
+	q.mu.Unlock()
+	_, _, _, _, _ = vfs.Quota()
+	<-counted
+
+	// The reservation isn't lost when the count finishes
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return !q.counting
+	}, 10*time.Second, 10*time.Millisecond)
+	usedBytes, _, usedFiles, _, _ = vfs.Quota()
+	assert.Equal(t, []int64{9, 2}, []int64{usedBytes, usedFiles})
+}
+
+func TestQuotaReleased(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			opt := vfscommon.Opt
+			opt.CacheMode = cacheMode
+			opt.WriteBack = writeBackDelay
+			opt.QuotaFiles = 5
+			r, vfs := newTestVFSOpt(t, &opt)
+			r.WriteObject(context.Background(), "existing", "1234", t1)
+
+			checkUsage := func(wantBytes, wantFiles int64) {
+				t.Helper()
+				usedBytes, _, usedFiles, _, _ := vfs.Quota()
+				assert.Equal(t, []int64{wantBytes, wantFiles}, []int64{usedBytes, usedFiles})
+			}
+			checkUsage(4, 1)
+
+			// A file created but not opened is released
+			_, err := vfs.OpenFile("bad", os.O_WRONLY|os.O_RDWR|os.O_CREATE, 0600)
+			assert.Equal(t, EPERM, err)
+			checkUsage(4, 1)
+
+			// A file renamed over another releases the other
+			require.NoError(t, vfs.WriteFile("a", []byte("12"), 0600))
+			checkUsage(6, 2)
+			require.NoError(t, vfs.Rename("a", "existing"))
+			checkUsage(2, 1)
+
+			// Renaming a file over itself doesn't
+			require.NoError(t, vfs.Rename("existing", "existing"))
+			checkUsage(2, 1)
+		})
+	}
+}
+
+func TestQuotaEmptyRemote(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.QuotaFiles = 5
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	// The root of the remote not existing isn't an error
+	require.NoError(t, vfs.WriteFile("a", []byte("12345"), 0600))
+	usedBytes, _, usedFiles, _, _ := vfs.Quota()
+	assert.Equal(t, []int64{5, 1}, []int64{usedBytes, usedFiles})
+}
+
+func TestQuotaCountFailed(t *testing.T) {
+	oldRetryInterval := quotaRetryInterval
+	quotaRetryInterval = 0
+	defer func() { quotaRetryInterval = oldRetryInterval }()
+
+	opt := vfscommon.Opt
+	opt.QuotaBytes = 100
+	r, vfs := newTestVFSOpt(t, &opt)
+	r.WriteObject(context.Background(), "existing", "1234", t1)
+	q := vfs.quota
+
+	// Writes fail while the space in use can't be counted
+	countErr := errors.New("list failed")
+	var mu sync.Mutex
+	q.countHook = func(err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if countErr != nil {
+			return countErr
+		}
+		return err
+	}
+	assert.Equal(t, ENOSPC, vfs.WriteFile("a", []byte("12345"), 0600))
+	assert.Equal(t, ENOSPC, vfs.WriteFile("a", []byte("12345"), 0600))
+
+	// The count is retried and writes work once it succeeds
+	mu.Lock()
+	countErr = nil
+	mu.Unlock()
+	require.NoError(t, vfs.WriteFile("a", []byte("12345"), 0600))
+	usedBytes, _, usedFiles, _, _ := vfs.Quota()
+	assert.Equal(t, []int64{9, 2}, []int64{usedBytes, usedFiles})
+}
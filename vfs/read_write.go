@@ -1,12 +1,14 @@
 package vfs
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"sync"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/vfs/vfscache"
 )
@@ -27,7 +29,8 @@ type RWFileHandle struct {
 	offset      int64 // file pointer offset
 	closed      bool  // set if handle has been closed
 	opened      bool
-	writeCalled bool // if any Write() methods have been called
+	writeCalled bool            // if any Write() methods have been called
+	actorCtx    context.Context // holds the audit actor for the changes
 }
 
 // Lock performs Unix locking, not supported
@@ -40,7 +43,7 @@ func (fh *RWFileHandle) Unlock() error {
 	return os.ErrInvalid
 }
 
-func newRWFileHandle(d *Dir, f *File, flags int) (fh *RWFileHandle, err error) {
+func newRWFileHandle(ctx context.Context, d *Dir, f *File, flags int) (fh *RWFileHandle, err error) {
 	defer log.Trace(f.Path(), "")("err=%v", &err)
 	// get an item to represent this from the cache
 	item := d.vfs.cache.Item(f.CachePath())
@@ -57,6 +60,8 @@ func newRWFileHandle(d *Dir, f *File, flags int) (fh *RWFileHandle, err error) {
 		d:     d,
 		flags: flags,
 		item:  item,
+		// the upload outlives ctx so only keep the actor
+		actorCtx: audit.CopyActor(context.Background(), ctx),
 	}
 
 	// truncate immediately if O_TRUNC is set or O_CREATE is set and file doesn't exist
@@ -111,6 +116,10 @@ func (fh *RWFileHandle) openPending() (err error) {
 	} else {
 		fh.offset = 0
 	}
+	if !fh.readOnly() {
+		// record the upload against the actor which opened the file
+		fh.item.SetAuditContext(fh.d.vfs.auditContext(fh.actorCtx))
+	}
 	fh.opened = true
 	fh.d.addObject(fh.file) // make sure the directory has this object in it now
 	return nil
@@ -344,6 +353,16 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 		fh.offset = size
 		off = fh.offset
 	}
+	// Reserve the space for any growth of the file
+	quota := fh.d.vfs.quota
+	var oldSize, reserved int64
+	if quota != nil {
+		oldSize = fh._size()
+		reserved = max(off+int64(len(b))-oldSize, 0)
+		if err = quota.reserve(reserved, 0); err != nil {
+			return n, err
+		}
+	}
 	fh.writeCalled = true
 	if release {
 		// Do the writing with fh.mu unlocked
@@ -353,6 +372,8 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 	if release {
 		fh.mu.Lock()
 	}
+	// Give back any space reserved but not used
+	quota.release(reserved-max(off+int64(n)-oldSize, 0), 0)
 	if err != nil {
 		return n, err
 	}
@@ -390,11 +411,20 @@ func (fh *RWFileHandle) WriteString(s string) (n int, err error) {
 //
 // Call with mutex held
 func (fh *RWFileHandle) _truncate(size int64) (err error) {
-	if size == fh._size() {
+	oldSize := fh._size()
+	if size == oldSize {
 		return nil
 	}
+	quota := fh.d.vfs.quota
+	if err = quota.reserve(size-oldSize, 0); err != nil {
+		return err
+	}
 	fh.file.setSize(size)
-	return fh.item.Truncate(size)
+	err = fh.item.Truncate(size)
+	if err != nil {
+		quota.release(size-oldSize, 0)
+	}
+	return err
 }
 
 // Truncate file to given size
@@ -37,6 +37,7 @@ import (
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/rc"
@@ -186,6 +187,8 @@ type VFS struct {
 	usage       *fs.Usage
 	pollChan    chan time.Duration
 	inUse       atomic.Int32 // count of number of opens
+	auditActor  atomic.Pointer[audit.Actor]
+	quota       *quota // nil if no quota set
 }
 
 // Keep track of active VFS keyed on fs.ConfigString(f)
@@ -232,6 +235,9 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 	// Create root directory
 	vfs.root = newDir(vfs, f, nil, fsDir)
 
+	// Limit the space used if required
+	vfs.quota = newQuota(vfs)
+
 	// Start polling function
 	features := vfs.f.Features()
 	if do := features.ChangeNotify; do != nil {
@@ -346,6 +352,27 @@ func (vfs *VFS) Fs() fs.Fs {
 	return vfs.f
 }
 
+// SetAuditActor sets who the changes made through the VFS are
+// recorded against in the audit log.
+//
+// This is used for the changes which don't pass in an actor with the
+// Context methods such as OpenFileContext.
+func (vfs *VFS) SetAuditActor(actor audit.Actor) {
+	vfs.auditActor.Store(&actor)
+}
+
+// auditContext returns ctx with the audit actor of the VFS set if ctx
+// doesn't already have one
+func (vfs *VFS) auditContext(ctx context.Context) context.Context {
+	if audit.HasActor(ctx) {
+		return ctx
+	}
+	if actor := vfs.auditActor.Load(); actor != nil {
+		return audit.WithActor(ctx, *actor)
+	}
+	return ctx
+}
+
 // SetCacheMode change the cache mode
 func (vfs *VFS) SetCacheMode(cacheMode vfscommon.CacheMode) {
 	vfs.shutdownCache()
@@ -548,6 +575,12 @@ func decodeOpenFlags(flags int) string {
 
 // OpenFile a file according to the flags and perm provided
 func (vfs *VFS) OpenFile(name string, flags int, perm os.FileMode) (fd Handle, err error) {
+	return vfs.OpenFileContext(context.Background(), name, flags, perm)
+}
+
+// OpenFileContext opens a file like OpenFile. The changes made through
+// the handle are recorded in the audit log against the actor in ctx.
+func (vfs *VFS) OpenFileContext(ctx context.Context, name string, flags int, perm os.FileMode) (fd Handle, err error) {
 	defer log.Trace(name, "flags=%s, perm=%v", decodeOpenFlags(flags), perm)("fd=%v, err=%v", &fd, &err)
 
 	// http://pubs.opengroup.org/onlinepubs/7908799/xsh/open.html
@@ -572,6 +605,9 @@ func (vfs *VFS) OpenFile(name string, flags int, perm os.FileMode) (fd Handle, e
 			return nil, err
 		}
 	}
+	if file, ok := node.(*File); ok {
+		return file.openContext(ctx, flags)
+	}
 	return node.Open(flags)
 }
 
@@ -592,6 +628,12 @@ func (vfs *VFS) Create(name string) (Handle, error) {
 
 // Rename oldName to newName
 func (vfs *VFS) Rename(oldName, newName string) error {
+	return vfs.RenameContext(context.Background(), oldName, newName)
+}
+
+// RenameContext renames oldName to newName like Rename recording it in
+// the audit log against the actor in ctx.
+func (vfs *VFS) RenameContext(ctx context.Context, oldName, newName string) error {
 	// find the parent directories
 	oldDir, oldLeaf, err := vfs.StatParent(oldName)
 	if err != nil {
@@ -601,7 +643,7 @@ func (vfs *VFS) Rename(oldName, newName string) error {
 	if err != nil {
 		return err
 	}
-	err = oldDir.Rename(oldLeaf, newLeaf, newDir)
+	err = oldDir.renameContext(ctx, oldLeaf, newLeaf, newDir)
 	if err != nil {
 		return err
 	}
@@ -643,9 +685,14 @@ const unknownFreeBytes = 1 << 50
 //
 // The values will be -1 if they aren't known
 //
-// This information is cached for the DirCacheTime interval
+// This information is cached for the DirCacheTime interval unless
+// --vfs-quota-bytes is set in which case the quota is reported.
 func (vfs *VFS) Statfs() (total, used, free int64) {
 	// defer log.Trace("/", "")("total=%d, used=%d, free=%d", &total, &used, &free)
+	if q := vfs.quota; q != nil && q.maxBytes >= 0 {
+		used, _ = q.usage()
+		return q.maxBytes, used, max(q.maxBytes-used, 0)
+	}
 	vfs.usageMu.Lock()
 	defer vfs.usageMu.Unlock()
 	total, used, free = -1, -1, -1
@@ -702,15 +749,40 @@ func (vfs *VFS) Statfs() (total, used, free int64) {
 
 // Remove removes the named file or (empty) directory.
 func (vfs *VFS) Remove(name string) error {
+	return vfs.RemoveContext(context.Background(), name)
+}
+
+// RemoveContext removes the named file or (empty) directory like
+// Remove recording it in the audit log against the actor in ctx.
+func (vfs *VFS) RemoveContext(ctx context.Context, name string) error {
 	node, err := vfs.Stat(name)
 	if err != nil {
 		return err
 	}
-	err = node.Remove()
+	switch x := node.(type) {
+	case *File:
+		return x.removeContext(ctx)
+	case *Dir:
+		return x.removeContext(ctx)
+	}
+	return node.Remove()
+}
+
+// RemoveAllContext removes the named file or directory and any
+// contents recursively recording it in the audit log against the
+// actor in ctx.
+func (vfs *VFS) RemoveAllContext(ctx context.Context, name string) error {
+	node, err := vfs.Stat(name)
 	if err != nil {
 		return err
 	}
-	return nil
+	switch x := node.(type) {
+	case *File:
+		return x.removeContext(ctx)
+	case *Dir:
+		return x.removeAllContext(ctx)
+	}
+	return node.RemoveAll()
 }
 
 // Chtimes changes the access and modification times of the named file, similar
@@ -3,15 +3,19 @@
 package vfs
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
@@ -500,3 +504,51 @@ func TestVFSIsMetadataFile(t *testing.T) {
 	assert.Equal(t, "leaf", rawName)
 	assert.Equal(t, true, found)
 }
+
+// Check the changes made with the Context methods are recorded
+// against the actor passed in
+func TestVFSAuditActor(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			ctx := context.Background()
+			logFile := filepath.Join(t.TempDir(), "audit.log")
+			oldOpt := audit.Opt
+			audit.Opt = audit.Options{File: logFile}
+			defer func() {
+				audit.Opt = oldOpt
+				_ = audit.Reload(ctx)
+			}()
+			opt := vfscommon.Opt
+			opt.CacheMode = cacheMode
+			opt.WriteBack = 0
+			_, vfs := newTestVFSOpt(t, &opt)
+			require.NoError(t, vfs.WriteFile("file", []byte("one"), 0666))
+			vfs.WaitForWriters(waitForWritersDelay)
+
+			actorCtx := audit.WithActor(ctx, audit.Actor{Type: audit.ActorServe, User: "alice"})
+			fd, err := vfs.OpenFileContext(actorCtx, "file", os.O_WRONLY|os.O_TRUNC, 0666)
+			require.NoError(t, err)
+			_, err = fd.Write([]byte("two"))
+			require.NoError(t, err)
+			require.NoError(t, fd.Close())
+			vfs.WaitForWriters(waitForWritersDelay)
+			require.NoError(t, vfs.RenameContext(actorCtx, "file", "renamed"))
+			require.NoError(t, vfs.Mkdir("dir", 0777))
+			require.NoError(t, vfs.RemoveContext(actorCtx, "renamed"))
+			require.NoError(t, vfs.RemoveAllContext(actorCtx, "dir"))
+
+			in, err := os.Open(logFile)
+			require.NoError(t, err)
+			defer func() { _ = in.Close() }()
+			var actions []string
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				var e audit.Entry
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+				assert.Equal(t, "alice", e.Actor.User, e.Action)
+				actions = append(actions, e.Action)
+			}
+			assert.Equal(t, []string{audit.ActionOverwrite, audit.ActionMove, audit.ActionDelete, audit.ActionRmdir}, actions)
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/lib/file"
@@ -68,6 +69,7 @@ type Item struct {
 	pendingAccesses int                      // number of threads - cache reset not allowed if not zero
 	modified        bool                     // set if the file has been modified since the last Open
 	beingReset      bool                     // cache cleaner is resetting the cache file, access not allowed
+	auditCtx        context.Context          // holds the audit actor the upload is recorded against - may be nil
 }
 
 // Info is persisted to backing store
@@ -607,12 +609,23 @@ func unlockMutexForCall(mu *sync.Mutex, f func()) {
 	f()
 }
 
+// SetAuditContext sets the context holding the audit actor the next
+// upload of the item is recorded against
+func (item *Item) SetAuditContext(ctx context.Context) {
+	item.mu.Lock()
+	item.auditCtx = ctx
+	item.mu.Unlock()
+}
+
 // Store stores the local cache file to the remote object, returning
 // the new remote object. objOld is the old object if known.
 //
 // Call with lock held
 func (item *Item) _store(ctx context.Context, storeFn StoreFn) (err error) {
 	// defer log.Trace(item.name, "item=%p", item)("err=%v", &err)
+	if item.auditCtx != nil {
+		ctx = audit.CopyActor(ctx, item.auditCtx)
+	}
 
 	// Transfer the temp file to the remote
 	cacheObj, err := item.c.fcache.NewObject(ctx, item.name)
@@ -150,6 +150,16 @@ var OptionsInfo = fs.Options{{
 	Default: fs.SizeSuffix(-1),
 	Help:    "Specify the total space of disk",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_quota_bytes",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Max total size of the files which may be stored",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_quota_files",
+	Default: int64(-1),
+	Help:    "Max number of files which may be stored",
+	Groups:  "VFS",
 }, {
 	Name:    "umask",
 	Default: FileMode(getUmask()),
@@ -209,6 +219,8 @@ type Options struct {
 	UsedIsSize         bool          `config:"vfs_used_is_size"`     // if true, use the `rclone size` algorithm for Used size
 	FastFingerprint    bool          `config:"vfs_fast_fingerprint"` // if set use fast fingerprints
 	DiskSpaceTotalSize fs.SizeSuffix `config:"vfs_disk_space_total_size"`
+	QuotaBytes         fs.SizeSuffix `config:"vfs_quota_bytes"`        // max bytes which may be stored or -1
+	QuotaFiles         int64         `config:"vfs_quota_files"`        // max files which may be stored or -1
 	MetadataExtension  string        `config:"vfs_metadata_extension"` // if set respond to files with this extension with metadata
 }
 
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/operations"
 )
 
@@ -27,6 +28,7 @@ type WriteFileHandle struct {
 	writeCalled bool // set the first time Write() is called
 	opened      bool
 	truncated   bool
+	actorCtx    context.Context // holds the audit actor for the changes
 }
 
 // Check interfaces
@@ -36,7 +38,7 @@ var (
 	_ io.Closer   = (*WriteFileHandle)(nil)
 )
 
-func newWriteFileHandle(d *Dir, f *File, remote string, flags int) (*WriteFileHandle, error) {
+func newWriteFileHandle(ctx context.Context, d *Dir, f *File, remote string, flags int) (*WriteFileHandle, error) {
 	if f.IsSymlink() {
 		remote += fs.LinkSuffix
 	}
@@ -45,6 +47,8 @@ func newWriteFileHandle(d *Dir, f *File, remote string, flags int) (*WriteFileHa
 		flags:  flags,
 		result: make(chan error, 1),
 		file:   f,
+		// the upload outlives ctx so only keep the actor
+		actorCtx: audit.CopyActor(context.Background(), ctx),
 	}
 	fh.cond = sync.Cond{L: &fh.mu}
 	fh.file.addWriter(fh)
@@ -69,12 +73,22 @@ func (fh *WriteFileHandle) openPending() (err error) {
 	}
 	var pipeReader *io.PipeReader
 	pipeReader, fh.pipeWriter = io.Pipe()
+	vfs := fh.file.Dir().vfs
+	ctx := vfs.auditContext(fh.actorCtx)
+	// Record overwriting the existing object
+	oldObj := fh.file.getObject()
+	entry := audit.Object(ctx, audit.ActionOverwrite, oldObj)
+	// The existing object is replaced so release its space
+	if oldObj != nil {
+		vfs.quota.release(nonNegative(oldObj.Size()), 0)
+	}
 	go func() {
 		// NB Rcat deals with Stats.Transferring, etc.
-		o, err := operations.Rcat(context.TODO(), fh.file.Fs(), fh.remote, pipeReader, time.Now(), nil)
+		o, err := operations.Rcat(ctx, fh.file.Fs(), fh.remote, pipeReader, time.Now(), nil)
 		if err != nil {
 			fs.Errorf(fh.remote, "WriteFileHandle.New Rcat failed: %v", err)
 		}
+		err = entry.Done(err)
 		// Close the pipeReader so the pipeWriter fails with ErrClosedPipe
 		_ = pipeReader.Close()
 		fh.o = o
@@ -142,8 +156,14 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 	if err = fh.openPending(); err != nil {
 		return 0, err
 	}
+	quota := fh.file.VFS().quota
+	if err = quota.reserve(int64(len(p)), 0); err != nil {
+		fs.Errorf(fh.remote, "WriteFileHandle.Write error: %v", err)
+		return 0, err
+	}
 	fh.writeCalled = true
 	n, err = fh.pipeWriter.Write(p)
+	quota.release(int64(len(p)-n), 0)
 	fh.offset += int64(n)
 	fh.file.setSize(fh.offset)
 	if err != nil {
@@ -206,9 +226,12 @@ func (fh *WriteFileHandle) close() (err error) {
 	if err == nil {
 		fh.file.setObject(fh.o)
 		err = writeCloseErr
-	} else if fh.file.getObject() == nil {
+	} else if o := fh.file.getObject(); o == nil {
 		// Remove vfs file entry when no object is present
 		_ = fh.file.Remove()
+	} else {
+		// The existing object wasn't replaced so restore its space
+		fh.file.VFS().quota.release(fh.offset-nonNegative(o.Size()), 0)
 	}
 	return err
 }